@@ -0,0 +1,185 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v61/github"
+)
+
+// errActorTeamsRateLimited is returned while the team memberships can't be
+// looked up because GitHub rate limited the lookups.
+var errActorTeamsRateLimited = errors.New("rate limited looking up team memberships")
+
+// defaultSecondaryRateLimitBackoff is how long lookups are skipped after a
+// secondary rate limit that does not tell when to retry.
+const defaultSecondaryRateLimitBackoff = time.Minute
+
+// actorTeamsEntry is a cached fetch of the team memberships of an
+// organization. done is closed once memberships and err are set.
+type actorTeamsEntry struct {
+	done        chan struct{}
+	memberships map[string][]string // lowercase login -> sorted team slugs
+	err         error
+}
+
+// actorTeamsCache resolves the teams of an organization that the actors of
+// workflow runs are members of. The members of all teams of an organization
+// are fetched the first time it is looked up and cached for the lifetime of
+// the job, as listing the teams of a single user is not supported by the
+// GitHub API. Once GitHub rate limits the lookups, they are skipped until the
+// rate limit resets rather than spending the remaining quota of the
+// installation.
+type actorTeamsCache struct {
+	ghClient *github.Client
+	now      func() time.Time
+
+	mu               sync.Mutex
+	entries          map[string]*actorTeamsEntry // keyed by lowercase org
+	rateLimitedUntil time.Time
+}
+
+// newActorTeamsCache creates an empty actorTeamsCache.
+func newActorTeamsCache(ghClient *github.Client) *actorTeamsCache {
+	return &actorTeamsCache{
+		ghClient: ghClient,
+		now:      time.Now,
+		entries:  make(map[string]*actorTeamsEntry),
+	}
+}
+
+// get returns the sorted slugs of the teams of the organization the actor is
+// a member of, or nil if the actor is not a member of any team. Callers for an
+// organization that is being fetched wait for the result of that fetch.
+// Failed fetches are not cached.
+func (c *actorTeamsCache) get(ctx context.Context, org, actor string) ([]string, error) {
+	key := strings.ToLower(org)
+
+	c.mu.Lock()
+	if until := c.rateLimitedUntil; c.now().Before(until) {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%w until %s", errActorTeamsRateLimited, until.Format(time.RFC3339))
+	}
+	entry, ok := c.entries[key]
+	if ok {
+		c.mu.Unlock()
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to wait for teams of %s: %w", org, ctx.Err())
+		}
+	} else {
+		entry = &actorTeamsEntry{done: make(chan struct{})}
+		c.entries[key] = entry
+		c.mu.Unlock()
+
+		entry.memberships, entry.err = c.fetch(ctx, org)
+		if entry.err != nil {
+			c.mu.Lock()
+			delete(c.entries, key)
+			if until, ok := c.rateLimitReset(entry.err); ok && until.After(c.rateLimitedUntil) {
+				c.rateLimitedUntil = until
+			}
+			c.mu.Unlock()
+		}
+		close(entry.done)
+	}
+
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	return entry.memberships[strings.ToLower(actor)], nil
+}
+
+// fetch lists all teams of the given organization and their members, and
+// returns the sorted team slugs of each member keyed by their lowercase login.
+func (c *actorTeamsCache) fetch(ctx context.Context, org string) (map[string][]string, error) {
+	var teams []*github.Team
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := c.ghClient.Teams.ListTeams(ctx, org, opts)
+		if err != nil {
+			return nil, c.wrapError(err, "failed to list teams of %s", org)
+		}
+		teams = append(teams, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	memberships := make(map[string][]string)
+	for _, team := range teams {
+		slug := team.GetSlug()
+		opts := &github.TeamListTeamMembersOptions{
+			ListOptions: github.ListOptions{PerPage: 100},
+		}
+		for {
+			members, resp, err := c.ghClient.Teams.ListTeamMembersBySlug(ctx, org, slug, opts)
+			if err != nil {
+				return nil, c.wrapError(err, "failed to list members of team %s/%s", org, slug)
+			}
+			for _, member := range members {
+				login := strings.ToLower(member.GetLogin())
+				memberships[login] = append(memberships[login], slug)
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+	}
+
+	for _, slugs := range memberships {
+		sort.Strings(slugs)
+	}
+	return memberships, nil
+}
+
+// wrapError wraps an error of the GitHub API, marking rate limit errors with
+// errActorTeamsRateLimited.
+func (c *actorTeamsCache) wrapError(err error, format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	if _, ok := c.rateLimitReset(err); ok {
+		return fmt.Errorf("%s: %w: %w", msg, errActorTeamsRateLimited, err)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// rateLimitReset returns when the rate limit that caused the error resets, if
+// the error is a rate limit error.
+func (c *actorTeamsCache) rateLimitReset(err error) (time.Time, bool) {
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return rateLimitErr.Rate.Reset.Time, true
+	}
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if retryAfter := abuseErr.GetRetryAfter(); retryAfter > 0 {
+			return c.now().Add(retryAfter), true
+		}
+		return c.now().Add(defaultSecondaryRateLimitBackoff), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,242 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v61/github"
+)
+
+// newActorTeamsServer fakes the GitHub teams API and counts the requests made
+// for each path. The teams of limited-org are rate limited. It also serves
+// workflow logs at "logs".
+func newActorTeamsServer(t *testing.T) (*github.Client, map[string]*atomic.Int64) {
+	t.Helper()
+
+	requests := map[string]*atomic.Int64{
+		"test-org/teams":                  {},
+		"test-org/teams/platform/members": {},
+		"test-org/teams/security/members": {},
+		"limited-org/teams":               {},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/orgs/test-org/teams", func(w http.ResponseWriter, r *http.Request) {
+		requests["test-org/teams"].Add(1)
+		fmt.Fprint(w, `[{"slug": "security"}, {"slug": "platform"}]`)
+	})
+	mux.HandleFunc("GET /api/v3/orgs/test-org/teams/platform/members", func(w http.ResponseWriter, r *http.Request) {
+		requests["test-org/teams/platform/members"].Add(1)
+		fmt.Fprint(w, `[{"login": "Octocat"}, {"login": "hubot"}]`)
+	})
+	mux.HandleFunc("GET /api/v3/orgs/test-org/teams/security/members", func(w http.ResponseWriter, r *http.Request) {
+		requests["test-org/teams/security/members"].Add(1)
+		fmt.Fprint(w, `[{"login": "octocat"}]`)
+	})
+	mux.HandleFunc("GET /api/v3/orgs/limited-org/teams", func(w http.ResponseWriter, r *http.Request) {
+		requests["limited-org/teams"].Add(1)
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "API rate limit exceeded for installation ID 12345."}`)
+	})
+	mux.HandleFunc("GET /api/v3/logs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "logs")
+	})
+	fakeGitHub := httptest.NewServer(mux)
+	t.Cleanup(fakeGitHub.Close)
+
+	client, err := github.NewClient(fakeGitHub.Client()).WithEnterpriseURLs(fakeGitHub.URL, fakeGitHub.URL)
+	if err != nil {
+		t.Fatalf("failed to create github client: %v", err)
+	}
+	return client, requests
+}
+
+func TestActorTeamsCache_Get(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, requests := newActorTeamsServer(t)
+	cache := newActorTeamsCache(client)
+
+	// Concurrent lookups in the same organization share a single fetch.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			got, err := cache.get(ctx, "test-org", "octocat")
+			if err != nil {
+				t.Errorf("get failed: %v", err)
+				return
+			}
+			if diff := cmp.Diff(got, []string{"platform", "security"}); diff != "" {
+				t.Errorf("get got unexpected teams (-got,+want):\n%s", diff)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Organizations and logins are case-insensitive.
+	got, err := cache.get(ctx, "Test-Org", "HUBOT")
+	if err != nil {
+		t.Errorf("get failed: %v", err)
+	}
+	if diff := cmp.Diff(got, []string{"platform"}); diff != "" {
+		t.Errorf("get got unexpected teams (-got,+want):\n%s", diff)
+	}
+
+	// An actor that is not a member of any team has no teams.
+	got, err = cache.get(ctx, "test-org", "nobody")
+	if err != nil {
+		t.Errorf("get failed: %v", err)
+	}
+	if got != nil {
+		t.Errorf("get got teams %q for an actor without teams, want nil", got)
+	}
+
+	for path, count := range requests {
+		want := int64(1)
+		if path == "limited-org/teams" {
+			want = 0
+		}
+		if got := count.Load(); got != want {
+			t.Errorf("expected %d requests for %s, got %d", want, path, got)
+		}
+	}
+}
+
+func TestActorTeamsCache_Get_RateLimited(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, requests := newActorTeamsServer(t)
+	cache := newActorTeamsCache(client)
+
+	if _, err := cache.get(ctx, "limited-org", "octocat"); !errors.Is(err, errActorTeamsRateLimited) {
+		t.Errorf("get got error %v, want %v", err, errActorTeamsRateLimited)
+	}
+
+	// Lookups are skipped until the rate limit resets, in any organization.
+	for _, org := range []string{"limited-org", "test-org"} {
+		if _, err := cache.get(ctx, org, "octocat"); !errors.Is(err, errActorTeamsRateLimited) {
+			t.Errorf("get(%s) got error %v, want %v", org, err, errActorTeamsRateLimited)
+		}
+	}
+	if got, want := requests["limited-org/teams"].Load(), int64(1); got != want {
+		t.Errorf("expected %d requests for limited-org/teams, got %d", want, got)
+	}
+	if got := requests["test-org/teams"].Load(); got != 0 {
+		t.Errorf("expected no requests for test-org/teams while rate limited, got %d", got)
+	}
+
+}
+
+func TestPipeline_ProcessElement_ActorTeams(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cases := []struct {
+		name      string
+		enabled   bool
+		org       string
+		actor     string
+		wantTeams []string
+	}{
+		{
+			name:  "enrichment_disabled",
+			org:   "test-org",
+			actor: "octocat",
+		},
+		{
+			name:      "enrichment_enabled",
+			enabled:   true,
+			org:       "test-org",
+			actor:     "octocat",
+			wantTeams: []string{"platform", "security"},
+		},
+		{
+			name:    "actor_without_teams",
+			enabled: true,
+			org:     "test-org",
+			actor:   "nobody",
+		},
+		{
+			name:    "no_actor",
+			enabled: true,
+			org:     "test-org",
+		},
+		{
+			name:    "rate_limited",
+			enabled: true,
+			org:     "limited-org",
+			actor:   "octocat",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, requests := newActorTeamsServer(t)
+			ingest := logIngester{
+				bucketName: "test",
+				storage:    &testObjectWriter{},
+				ghClient:   client,
+			}
+			if tc.enabled {
+				ingest.actorTeams = newActorTeamsCache(client)
+			}
+
+			got := ingest.ProcessElement(ctx, EventRecord{
+				DeliveryID:       "delivery",
+				GitHubActor:      tc.actor,
+				OrganizationName: tc.org,
+				RepositoryName:   "test-repo",
+				RepositorySlug:   tc.org + "/test-repo",
+				LogsURL:          "logs",
+			})
+
+			// team unavailability does not affect the ingestion itself
+			if got, want := got.Status, "SUCCESS"; got != want {
+				t.Errorf("ProcessElement got status %q, want %q", got, want)
+			}
+			if diff := cmp.Diff(got.GitHubActorTeams, tc.wantTeams); diff != "" {
+				t.Errorf("ProcessElement got unexpected teams (-got,+want):\n%s", diff)
+			}
+			if !tc.enabled || tc.actor == "" {
+				if got := requests["test-org/teams"].Load(); got != 0 {
+					t.Errorf("expected no requests for teams, got %d", got)
+				}
+			}
+		})
+	}
+}
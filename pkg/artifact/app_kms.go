@@ -0,0 +1,175 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"golang.org/x/oauth2"
+)
+
+// defaultGitHubAPIURL is the GitHub API that installation access tokens are
+// requested from.
+const defaultGitHubAPIURL = "https://api.github.com"
+
+// digestSigner signs SHA-256 digests with the private key of a GitHub App.
+type digestSigner interface {
+	SignSHA256(ctx context.Context, digest []byte) ([]byte, error)
+}
+
+// kmsSigner signs digests with an asymmetric Cloud KMS key, so that the private
+// key of the GitHub App never leaves KMS. The key must use the
+// RSA_SIGN_PKCS1_2048_SHA256 algorithm or another PKCS #1 v1.5 SHA-256 variant.
+type kmsSigner struct {
+	client *kms.KeyManagementClient
+	keyID  string
+}
+
+// SignSHA256 signs the digest with the KMS crypto key version.
+func (s *kmsSigner) SignSHA256(ctx context.Context, digest []byte) ([]byte, error) {
+	resp, err := s.client.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+		Name: s.keyID,
+		Digest: &kmspb.Digest{
+			Digest: &kmspb.Digest_Sha256{Sha256: digest},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with kms key %s: %w", s.keyID, err)
+	}
+	return resp.GetSignature(), nil
+}
+
+// appInstallationTokenSource requests access tokens of a GitHub App
+// installation, authenticating as the app with a JWT signed by signer.
+type appInstallationTokenSource struct {
+	ctx            context.Context //nolint:containedctx // oauth2.TokenSource has no context
+	signer         digestSigner
+	appID          string
+	installationID string
+	permissions    map[string]string
+	baseURL        string
+	httpClient     *http.Client
+}
+
+// newKMSInstallationTokenSources creates a token source for the access tokens
+// of the GitHub App installation for each of the given permissions, signing
+// the app JWTs with the Cloud KMS crypto key version keyID. Each token source
+// reuses its tokens until they expire, and they are requested with httpClient.
+func newKMSInstallationTokenSources(ctx context.Context, appID, installationID, keyID string, permissions []map[string]string, httpClient *http.Client) ([]oauth2.TokenSource, error) {
+	client, err := kms.NewKeyManagementClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kms client: %w", err)
+	}
+	signer := &kmsSigner{client: client, keyID: keyID}
+
+	sources := make([]oauth2.TokenSource, 0, len(permissions))
+	for _, p := range permissions {
+		sources = append(sources, oauth2.ReuseTokenSource(nil, &appInstallationTokenSource{
+			ctx:            ctx,
+			signer:         signer,
+			appID:          appID,
+			installationID: installationID,
+			permissions:    p,
+			baseURL:        defaultGitHubAPIURL,
+			httpClient:     httpClient,
+		}))
+	}
+	return sources, nil
+}
+
+// Token requests a new installation access token.
+func (ts *appInstallationTokenSource) Token() (*oauth2.Token, error) {
+	jwt, err := ts.appJWT(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]any{"permissions": ts.permissions})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal access token request: %w", err)
+	}
+
+	u := fmt.Sprintf("%s/app/installations/%s/access_tokens", strings.TrimSuffix(ts.baseURL, "/"), ts.installationID)
+	req, err := http.NewRequestWithContext(ts.ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create access token request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ts.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("failed to request access token: unexpected status %d: %s", resp.StatusCode, b)
+	}
+
+	var token struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode access token response: %w", err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: token.Token,
+		TokenType:   "Bearer",
+		Expiry:      token.ExpiresAt,
+	}, nil
+}
+
+// appJWT creates the RS256 JWT that authenticates as the GitHub App. It is
+// backdated by a minute to allow for clock drift and expires well within the
+// ten minute maximum accepted by GitHub.
+func (ts *appInstallationTokenSource) appJWT(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal jwt header: %w", err)
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"iss": ts.appID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal jwt claims: %w", err)
+	}
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := ts.signer.SignSHA256(ts.ctx, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign jwt: %w", err)
+	}
+	return signingInput + "." + enc.EncodeToString(signature), nil
+}
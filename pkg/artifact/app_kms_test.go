@@ -0,0 +1,134 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// rsaSigner signs digests with an in-memory RSA key in place of Cloud KMS.
+type rsaSigner struct {
+	key *rsa.PrivateKey
+}
+
+func (s *rsaSigner) SignSHA256(ctx context.Context, digest []byte) ([]byte, error) {
+	return rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest) //nolint:wrapcheck // Want passthrough
+}
+
+func TestAppInstallationTokenSource_Token(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	expiresAt := time.Date(2024, 7, 12, 11, 0, 0, 0, time.UTC)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /app/installations/test-install-id/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		// the JWT must be signed by the app key and issued by the app
+		jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parts := strings.Split(jwt, ".")
+		if len(parts) != 3 {
+			t.Errorf("expected a jwt with 3 parts, got %q", jwt)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			t.Errorf("failed to decode jwt signature: %v", err)
+		}
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			t.Errorf("invalid jwt signature: %v", err)
+		}
+
+		claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			t.Errorf("failed to decode jwt claims: %v", err)
+		}
+		var claims struct {
+			Issuer    string `json:"iss"`
+			IssuedAt  int64  `json:"iat"`
+			ExpiresAt int64  `json:"exp"`
+		}
+		if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+			t.Errorf("failed to unmarshal jwt claims: %v", err)
+		}
+		if got, want := claims.Issuer, "test-app-id"; got != want {
+			t.Errorf("expected issuer %q, got %q", want, got)
+		}
+		if lifetime := time.Duration(claims.ExpiresAt-claims.IssuedAt) * time.Second; lifetime > 10*time.Minute {
+			t.Errorf("expected jwt to expire within 10 minutes, got %s", lifetime)
+		}
+
+		var body struct {
+			Permissions map[string]string `json:"permissions"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		if diff := cmp.Diff(body.Permissions, InstallationPermissions); diff != "" {
+			t.Errorf("unexpected permissions (-got,+want):\n%s", diff)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "test-token", "expires_at": %q}`, expiresAt.Format(time.RFC3339))
+	})
+	fakeGitHub := httptest.NewServer(mux)
+	t.Cleanup(fakeGitHub.Close)
+
+	ts := &appInstallationTokenSource{
+		ctx:            context.Background(),
+		signer:         &rsaSigner{key: key},
+		appID:          "test-app-id",
+		installationID: "test-install-id",
+		permissions:    InstallationPermissions,
+		baseURL:        fakeGitHub.URL,
+		httpClient:     fakeGitHub.Client(),
+	}
+
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if got, want := token.AccessToken, "test-token"; got != want {
+		t.Errorf("expected access token %q, got %q", want, got)
+	}
+	if got, want := token.Expiry, expiresAt; !got.Equal(want) {
+		t.Errorf("expected expiry %s, got %s", want, got)
+	}
+
+	// an unknown installation fails
+	ts.installationID = "missing-install-id"
+	if _, err := ts.Token(); err == nil {
+		t.Errorf("Token: expected error for unknown installation")
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errBufferLimitExceeded is returned when content has to be held in memory in
+// full but is larger than the maximum buffer size.
+var errBufferLimitExceeded = errors.New("content exceeds the maximum buffer size")
+
+// readAllLimited reads all of the content into memory. Content larger than the
+// limit is not read past the limit, instead errBufferLimitExceeded is
+// returned.
+func readAllLimited(content io.Reader, limit int64) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(content, limit+1))
+	if err != nil {
+		return nil, err //nolint:wrapcheck // Want passthrough
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("%w of %d bytes", errBufferLimitExceeded, limit)
+	}
+	return b, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path"
+	"strings"
+)
+
+// CollisionPolicy determines how an object is written when an object with
+// different content already exists at the same descriptor.
+type CollisionPolicy string
+
+const (
+	// CollisionPolicyOverwrite silently replaces the existing object.
+	CollisionPolicyOverwrite CollisionPolicy = "overwrite"
+
+	// CollisionPolicyError fails the write and leaves the existing object in
+	// place.
+	CollisionPolicyError CollisionPolicy = "error"
+
+	// CollisionPolicySuffix writes the object next to the existing one with a
+	// numeric suffix appended to its name, e.g. artifacts-1.zip.
+	CollisionPolicySuffix CollisionPolicy = "suffix"
+)
+
+// maxCollisionSuffix bounds the number of suffixes tried before giving up.
+const maxCollisionSuffix = 100
+
+// errObjectCollision is returned when an object with different content already
+// exists at the descriptor being written to.
+var errObjectCollision = errors.New("object already exists with different content")
+
+// crc32cTable is the Castagnoli table used by Cloud Storage checksums.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksumObjectWriter is an ObjectWriter that can also report the checksum
+// of an existing object.
+type checksumObjectWriter interface {
+	ObjectWriter
+	checksum(ctx context.Context, descriptor string) (uint32, bool, error)
+}
+
+// collisionDetectingWriter is an ObjectWriter that detects when a write would
+// replace an existing object with different content and handles it according
+// to its policy.
+type collisionDetectingWriter struct {
+	store         checksumObjectWriter
+	policy        CollisionPolicy
+	maxBufferSize int64
+}
+
+// newCollisionDetectingWriter wraps the store so that writes follow the given
+// collision policy. The store is returned as is for CollisionPolicyOverwrite.
+// Handling a collision requires buffering the content, content larger than
+// maxBufferSize fails to be written if it collides with an existing object.
+func newCollisionDetectingWriter(store checksumObjectWriter, policy CollisionPolicy, maxBufferSize int64) ObjectWriter {
+	if policy == "" || policy == CollisionPolicyOverwrite {
+		return store
+	}
+	return &collisionDetectingWriter{
+		store:         store,
+		policy:        policy,
+		maxBufferSize: maxBufferSize,
+	}
+}
+
+// Write writes the content to the descriptor unless an object with different
+// content already exists there. Rewriting identical content is a no-op so that
+// reprocessing the same delivery is idempotent.
+func (w *collisionDetectingWriter) Write(ctx context.Context, content io.Reader, descriptor string) (string, error) {
+	existing, exists, err := w.store.checksum(ctx, descriptor)
+	if err != nil {
+		return "", fmt.Errorf("failed to check for existing object: %w", err)
+	}
+	if !exists {
+		return w.store.Write(ctx, content, descriptor) //nolint:wrapcheck // Want passthrough
+	}
+
+	// The content has to be buffered to compare it against the existing object
+	// and to be able to write it again under a different name. Content that does
+	// not fit into the buffer is never read in full.
+	b, err := readAllLimited(content, w.maxBufferSize)
+	if err != nil {
+		if errors.Is(err, errBufferLimitExceeded) {
+			return "", fmt.Errorf("cannot apply collision policy %q to %s: %w", w.policy, descriptor, err)
+		}
+		return "", fmt.Errorf("failed to read object content: %w", err)
+	}
+	sum := crc32.Checksum(b, crc32cTable)
+	if sum == existing {
+		return descriptor, nil
+	}
+
+	if w.policy != CollisionPolicySuffix {
+		return "", fmt.Errorf("%w: %s", errObjectCollision, descriptor)
+	}
+
+	for i := 1; i <= maxCollisionSuffix; i++ {
+		candidate := suffixDescriptor(descriptor, i)
+		existing, exists, err := w.store.checksum(ctx, candidate)
+		if err != nil {
+			return "", fmt.Errorf("failed to check for existing object: %w", err)
+		}
+		if !exists {
+			return w.store.Write(ctx, bytes.NewReader(b), candidate) //nolint:wrapcheck // Want passthrough
+		}
+		// The content was already written under this suffix by a previous run.
+		if sum == existing {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no free suffix found for %s", errObjectCollision, descriptor)
+}
+
+// suffixDescriptor inserts a numeric suffix between the name and the
+// extension(s) of the last path segment of the descriptor, e.g.
+// gs://bucket/a/artifacts.log.gz becomes gs://bucket/a/artifacts-1.log.gz.
+func suffixDescriptor(descriptor string, n int) string {
+	dir, file := path.Split(descriptor)
+	name, ext, _ := strings.Cut(file, ".")
+	if ext != "" {
+		ext = "." + ext
+	}
+	return fmt.Sprintf("%s%s-%d%s", dir, name, n, ext)
+}
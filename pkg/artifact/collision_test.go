@@ -0,0 +1,261 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestCollisionDetectingWriter_Write(t *testing.T) {
+	t.Parallel()
+
+	const descriptor = "gs://test/repo/delivery/artifacts.tar.gz"
+
+	cases := []struct {
+		name           string
+		policy         CollisionPolicy
+		existing       map[string]string
+		content        string
+		wantDescriptor string
+		wantObjects    map[string]string
+		wantErr        string
+	}{
+		{
+			name:           "no_existing_object",
+			policy:         CollisionPolicyError,
+			content:        "logs",
+			wantDescriptor: descriptor,
+			wantObjects: map[string]string{
+				descriptor: "logs",
+			},
+		},
+		{
+			name:   "existing_object_with_same_content",
+			policy: CollisionPolicyError,
+			existing: map[string]string{
+				descriptor: "logs",
+			},
+			content:        "logs",
+			wantDescriptor: descriptor,
+			wantObjects: map[string]string{
+				descriptor: "logs",
+			},
+		},
+		{
+			name:   "overwrite_detected_with_error_policy",
+			policy: CollisionPolicyError,
+			existing: map[string]string{
+				descriptor: "other logs",
+			},
+			content: "logs",
+			wantObjects: map[string]string{
+				descriptor: "other logs",
+			},
+			wantErr: "object already exists with different content: " + descriptor,
+		},
+		{
+			name:   "suffix_appended",
+			policy: CollisionPolicySuffix,
+			existing: map[string]string{
+				descriptor: "other logs",
+			},
+			content:        "logs",
+			wantDescriptor: "gs://test/repo/delivery/artifacts-1.tar.gz",
+			wantObjects: map[string]string{
+				descriptor: "other logs",
+				"gs://test/repo/delivery/artifacts-1.tar.gz": "logs",
+			},
+		},
+		{
+			name:   "next_free_suffix_used",
+			policy: CollisionPolicySuffix,
+			existing: map[string]string{
+				descriptor: "other logs",
+				"gs://test/repo/delivery/artifacts-1.tar.gz": "more logs",
+			},
+			content:        "logs",
+			wantDescriptor: "gs://test/repo/delivery/artifacts-2.tar.gz",
+			wantObjects: map[string]string{
+				descriptor: "other logs",
+				"gs://test/repo/delivery/artifacts-1.tar.gz": "more logs",
+				"gs://test/repo/delivery/artifacts-2.tar.gz": "logs",
+			},
+		},
+		{
+			name:   "suffix_with_same_content_reused",
+			policy: CollisionPolicySuffix,
+			existing: map[string]string{
+				descriptor: "other logs",
+				"gs://test/repo/delivery/artifacts-1.tar.gz": "logs",
+			},
+			content:        "logs",
+			wantDescriptor: "gs://test/repo/delivery/artifacts-1.tar.gz",
+			wantObjects: map[string]string{
+				descriptor: "other logs",
+				"gs://test/repo/delivery/artifacts-1.tar.gz": "logs",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &testChecksumObjectWriter{objects: make(map[string]string)}
+			for k, v := range tc.existing {
+				store.objects[k] = v
+			}
+
+			writer := newCollisionDetectingWriter(store, tc.policy, 1024)
+			got, err := writer.Write(context.Background(), strings.NewReader(tc.content), descriptor)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if got != tc.wantDescriptor {
+				t.Errorf("expected descriptor %q, got %q", tc.wantDescriptor, got)
+			}
+			if diff := cmp.Diff(store.objects, tc.wantObjects); diff != "" {
+				t.Errorf("unexpected objects (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCollisionDetectingWriter_Write_LargeContent(t *testing.T) {
+	t.Parallel()
+
+	const (
+		descriptor    = "gs://test/repo/delivery/artifacts.tar.gz"
+		maxBufferSize = 1024
+		contentSize   = 10 << 20
+	)
+
+	cases := []struct {
+		name     string
+		existing map[string]string
+		wantRead int64
+		wantErr  string
+	}{
+		{
+			name:     "streamed_without_collision",
+			wantRead: contentSize,
+		},
+		{
+			name: "not_buffered_on_collision",
+			existing: map[string]string{
+				descriptor: "other logs",
+			},
+			wantRead: maxBufferSize + 1,
+			wantErr:  `cannot apply collision policy "suffix" to ` + descriptor + ": content exceeds the maximum buffer size of 1024 bytes",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &testChecksumObjectWriter{objects: make(map[string]string)}
+			for k, v := range tc.existing {
+				store.objects[k] = v
+			}
+
+			content := &countingReader{r: io.LimitReader(zeroReader{}, contentSize)}
+			writer := newCollisionDetectingWriter(store, CollisionPolicySuffix, maxBufferSize)
+			_, err := writer.Write(context.Background(), content, descriptor)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if got := content.n.Load(); got != tc.wantRead {
+				t.Errorf("expected %d bytes to be read, got %d", tc.wantRead, got)
+			}
+		})
+	}
+}
+
+func TestSuffixDescriptor(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		descriptor string
+		want       string
+	}{
+		{
+			name:       "multiple_extensions",
+			descriptor: "gs://test/repo/delivery/artifacts.tar.gz",
+			want:       "gs://test/repo/delivery/artifacts-3.tar.gz",
+		},
+		{
+			name:       "no_extension",
+			descriptor: "gs://test/repo/delivery/artifacts",
+			want:       "gs://test/repo/delivery/artifacts-3",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := suffixDescriptor(tc.descriptor, 3); got != tc.want {
+				t.Errorf("suffixDescriptor(%q) got %q, want %q", tc.descriptor, got, tc.want)
+			}
+		})
+	}
+}
+
+// zeroReader is an endless stream of zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// testChecksumObjectWriter is an in-memory checksumObjectWriter.
+type testChecksumObjectWriter struct {
+	objects map[string]string
+}
+
+func (w *testChecksumObjectWriter) Write(ctx context.Context, reader io.Reader, descriptor string) (string, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("read failed: %w", err)
+	}
+	w.objects[descriptor] = string(content)
+	return descriptor, nil
+}
+
+func (w *testChecksumObjectWriter) checksum(ctx context.Context, descriptor string) (uint32, bool, error) {
+	content, ok := w.objects[descriptor]
+	if !ok {
+		return 0, false, nil
+	}
+	return crc32.Checksum([]byte(content), crc32cTable), true, nil
+}
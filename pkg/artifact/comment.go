@@ -0,0 +1,86 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// DefaultCommentTemplate is the template of the comment posted on the pull
+// requests of a workflow run once its logs were ingested.
+const DefaultCommentTemplate = `Logs for workflow run [{{ .Event.WorkflowRunID }}]({{ .Event.WorkflowURL }}) ` +
+	`attempt {{ .Event.WorkflowRunAttempt }} uploaded to {{ .StorageName }} [here]({{ .ArtifactURL }})`
+
+// defaultCommentTemplate is the parsed DefaultCommentTemplate.
+var defaultCommentTemplate = template.Must(parseCommentTemplate(DefaultCommentTemplate))
+
+// commentMarkerFormat is the format of the hidden HTML comment appended to the
+// body of each PR comment. It identifies the workflow run attempt the comment
+// was posted for, so that reprocessing the run doesn't post it again.
+const commentMarkerFormat = "<!-- github-metrics-aggregator workflow_run_id=%s workflow_run_attempt=%s -->"
+
+// CommentData is the data a comment template is rendered with.
+type CommentData struct {
+	// Event is the workflow run event whose logs were ingested.
+	Event *EventRecord
+
+	// Artifact is the record of the ingested logs.
+	Artifact *ArtifactRecord
+
+	// ArtifactURL is the URL of the ingested logs in the storage backend.
+	ArtifactURL string
+
+	// StorageName is the human readable name of the storage backend, e.g. GCS.
+	StorageName string
+}
+
+// parseCommentTemplate parses a comment template and renders it once with
+// empty data, so that references to unknown fields are reported when the job
+// starts rather than when the first comment is posted.
+func parseCommentTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("comment").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse comment template: %w", err)
+	}
+
+	if err := tmpl.Execute(io.Discard, &CommentData{
+		Event:    &EventRecord{},
+		Artifact: &ArtifactRecord{},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to render comment template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// commentMarker returns the hidden marker of the comments posted for the
+// given workflow run attempt.
+func commentMarker(event *EventRecord) string {
+	return fmt.Sprintf(commentMarkerFormat, event.WorkflowRunID, event.WorkflowRunAttempt)
+}
+
+// renderComment renders the comment template with the given data, followed by
+// the marker of the workflow run attempt.
+func renderComment(tmpl *template.Template, data *CommentData) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render comment template: %w", err)
+	}
+	sb.WriteString("\n\n")
+	sb.WriteString(commentMarker(data.Event))
+	return sb.String(), nil
+}
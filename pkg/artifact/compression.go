@@ -0,0 +1,83 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// zipMagic is the signature at the start of a zip archive, which is the
+	// format GitHub serves workflow run logs in.
+	zipMagic = []byte("PK\x03\x04")
+
+	// gzipMagic is the signature at the start of a gzip stream.
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// compressingWriter is an ObjectWriter that stores content compressed. Content
+// that is already a zip archive or gzip stream is passed through unchanged,
+// anything else is gzipped. The descriptor given to Write must not have an
+// extension, the extension matching the stored content is appended to it.
+type compressingWriter struct {
+	next ObjectWriter
+}
+
+// newCompressingWriter wraps the given ObjectWriter so that content is stored
+// compressed.
+func newCompressingWriter(next ObjectWriter) ObjectWriter {
+	return &compressingWriter{next: next}
+}
+
+// Write writes the content compressed to the descriptor with the extension of
+// the stored format appended, e.g. .zip or .gz.
+func (w *compressingWriter) Write(ctx context.Context, content io.Reader, descriptor string) (string, error) {
+	br := bufio.NewReader(content)
+	header, err := br.Peek(len(zipMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read content header: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(header, zipMagic):
+		return w.next.Write(ctx, br, descriptor+".zip") //nolint:wrapcheck // Want passthrough
+	case bytes.HasPrefix(header, gzipMagic):
+		return w.next.Write(ctx, br, descriptor+".gz") //nolint:wrapcheck // Want passthrough
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		if _, err := io.Copy(gz, br); err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to compress content: %w", err))
+			return
+		}
+		pw.CloseWithError(gz.Close())
+	}()
+
+	written, err := w.next.Write(ctx, pr, descriptor+".gz")
+	// Unblock the compressing goroutine if the write stopped reading early.
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return "", err //nolint:wrapcheck // Want passthrough
+	}
+	return written, nil
+}
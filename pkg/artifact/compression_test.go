@@ -0,0 +1,168 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestCompressingWriter_Write(t *testing.T) {
+	t.Parallel()
+
+	const descriptor = "gs://test/repo/delivery/artifacts"
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	f, err := zw.Create("1_build.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("build logs")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	if _, err := gw.Write([]byte("build logs")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name           string
+		content        []byte
+		writerFunc     func(context.Context, io.Reader, string) error
+		wantDescriptor string
+		wantContent    []byte
+		wantGzip       string
+		wantErr        string
+	}{
+		{
+			name:           "zip_passed_through",
+			content:        zipped.Bytes(),
+			wantDescriptor: descriptor + ".zip",
+			wantContent:    zipped.Bytes(),
+		},
+		{
+			name:           "gzip_passed_through",
+			content:        gzipped.Bytes(),
+			wantDescriptor: descriptor + ".gz",
+			wantContent:    gzipped.Bytes(),
+		},
+		{
+			name:           "plain_text_gzipped",
+			content:        []byte("build logs"),
+			wantDescriptor: descriptor + ".gz",
+			wantGzip:       "build logs",
+		},
+		{
+			name:           "empty_content_gzipped",
+			content:        []byte{},
+			wantDescriptor: descriptor + ".gz",
+			wantGzip:       "",
+		},
+		{
+			name:    "write_failure",
+			content: []byte("build logs"),
+			writerFunc: func(ctx context.Context, r io.Reader, s string) error {
+				return fmt.Errorf("write failed")
+			},
+			wantErr: "write failed",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &testObjectWriter{writerFunc: tc.writerFunc}
+			writer := newCompressingWriter(store)
+
+			got, err := writer.Write(context.Background(), bytes.NewReader(tc.content), descriptor)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if err != nil {
+				return
+			}
+			if got != tc.wantDescriptor {
+				t.Errorf("expected descriptor %q, got %q", tc.wantDescriptor, got)
+			}
+
+			if tc.wantContent != nil && store.gotArtifact != string(tc.wantContent) {
+				t.Errorf("expected content to be passed through unchanged")
+			}
+
+			if tc.wantContent == nil {
+				gr, err := gzip.NewReader(strings.NewReader(store.gotArtifact))
+				if err != nil {
+					t.Fatalf("written content is not gzip decodable: %v", err)
+				}
+				decoded, err := io.ReadAll(gr)
+				if err != nil {
+					t.Fatalf("failed to decode written content: %v", err)
+				}
+				if got, want := string(decoded), tc.wantGzip; got != want {
+					t.Errorf("decoded content got %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressingWriter_Write_Streams(t *testing.T) {
+	t.Parallel()
+
+	const contentSize = 10 << 20
+
+	// The next writer stops after reading the start of the compressed stream,
+	// the rest of the content must not have been read ahead.
+	next := &testObjectWriter{
+		writerFunc: func(ctx context.Context, r io.Reader, descriptor string) error {
+			if _, err := io.ReadFull(r, make([]byte, 16)); err != nil {
+				return fmt.Errorf("read failed: %w", err)
+			}
+			return fmt.Errorf("write failed")
+		},
+	}
+
+	// Random content is incompressible, so compressed output is produced while
+	// the content is read.
+	content := &countingReader{r: io.LimitReader(rand.New(rand.NewSource(1)), contentSize)}
+	_, err := newCompressingWriter(next).Write(context.Background(), content, "gs://test/repo/delivery/artifacts")
+	if diff := testutil.DiffErrString(err, "write failed"); diff != "" {
+		t.Error(diff)
+	}
+	if n := content.n.Load(); n >= contentSize {
+		t.Errorf("expected content to be streamed, but all %d bytes were read", n)
+	}
+}
@@ -17,9 +17,16 @@ package artifact
 import (
 	"context"
 	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/sethvargo/go-envconfig"
 
+	"github.com/abcxyz/github-metrics-aggregator/pkg/redact"
 	"github.com/abcxyz/pkg/cfgloader"
 	"github.com/abcxyz/pkg/cli"
 )
@@ -27,11 +34,22 @@ import (
 // Config defines the set of environment variables required
 // for running the artifact job.
 type Config struct {
-	GitHubAppID            string `env:"GITHUB_APP_ID,required"`             // The GitHub App ID
-	GitHubInstallID        string `env:"GITHUB_INSTALL_ID,required"`         // The provisioned GitHub App Installation reference
-	GitHubPrivateKeySecret string `env:"GITHUB_PRIVATE_KEY_SECRET,required"` // The secret name & version containing the GitHub App private key
+	GitHubAppID            string `env:"GITHUB_APP_ID"`                              // The GitHub App ID
+	GitHubInstallID        string `env:"GITHUB_INSTALL_ID"`                          // The provisioned GitHub App Installation reference
+	GitHubPrivateKeySecret string `env:"GITHUB_PRIVATE_KEY_SECRET" sensitive:"true"` // The secret name & version containing the GitHub App private key
 
-	BatchSize int `env:"BATCH_SIZE,default=100"` // The number of items to process in this pipeline run
+	GitHubAppIDFile      string `env:"GITHUB_APP_ID_FILE"`      // The file holding the GitHub App ID, instead of GITHUB_APP_ID
+	GitHubInstallIDFile  string `env:"GITHUB_INSTALL_ID_FILE"`  // The file holding the GitHub App Installation reference, instead of GITHUB_INSTALL_ID
+	GitHubPrivateKeyFile string `env:"GITHUB_PRIVATE_KEY_FILE"` // The file holding the GitHub App private key, instead of GITHUB_PRIVATE_KEY_SECRET
+
+	GitHubPrivateKeyKMSKeyID string `env:"GITHUB_PRIVATE_KEY_KMS_KEY_ID"` // The Cloud KMS crypto key version holding the GitHub App private key, instead of GITHUB_PRIVATE_KEY_SECRET
+
+	BatchSize      int           `env:"BATCH_SIZE,default=100"`      // The number of items to process in this pipeline run
+	MaxAttempts    int           `env:"MAX_ATTEMPTS,default=10"`     // The number of times to attempt ingesting the logs of an event before giving up
+	ElementTimeout time.Duration `env:"ELEMENT_TIMEOUT,default=10m"` // The maximum time to spend ingesting the logs of a single event
+	MinEventAge    time.Duration `env:"MIN_EVENT_AGE,default=5m"`    // The minimum time since an event was received before ingesting its logs
+	HTTPTimeout    time.Duration `env:"HTTP_TIMEOUT,default=0"`      // The maximum time of a single request to GitHub, including reading its response, unbounded when 0
+	LookbackDays   int           `env:"LOOKBACK_DAYS,default=0"`     // The maximum age in days of the events whose logs are ingested, unbounded when 0
 
 	ProjectID string `env:"PROJECT_ID,required"` // The project id where the tables live
 	DatasetID string `env:"DATASET_ID,required"` // The dataset id where the tables live
@@ -39,11 +57,71 @@ type Config struct {
 	EventsTableID    string `env:"EVENTS_TABLE_ID,required"`    // The table_name of the events table
 	ArtifactsTableID string `env:"ARTIFACTS_TABLE_ID,required"` // The table_name of the artifact_status table
 
-	BucketName string `env:"BUCKET_NAME,required"` // The name of the GCS bucket to store artifact logs
+	DLQTopicID string `env:"DLQ_TOPIC_ID"` // The pubsub topic that events whose logs failed to be ingested MAX_ATTEMPTS times are published to
+
+	BucketName            string `env:"BUCKET_NAME,required"`                      // The name of the bucket to store artifact logs, optionally prefixed with gs:// or s3://
+	ObjectCollisionPolicy string `env:"OBJECT_COLLISION_POLICY,default=overwrite"` // How to handle an existing object with different content: overwrite, error or suffix
+
+	MaxBufferSize int64 `env:"MAX_BUFFER_SIZE,default=104857600"` // The maximum size in bytes of logs held in memory, larger logs are only ever streamed
+
+	S3Endpoint string `env:"S3_ENDPOINT"` // The endpoint of an S3-compatible service, e.g. MinIO, for s3:// buckets
+	S3Region   string `env:"S3_REGION"`   // The AWS region of s3:// buckets
+
+	EmitProcessingLag bool `env:"EMIT_PROCESSING_LAG,default=false"` // Whether to record the age of the oldest event that needs to be processed at the start of each run
+
+	EnrichRepositoryMetadata bool `env:"ENRICH_REPOSITORY_METADATA,default=false"` // Whether to record the visibility, language and topics of each repository
+	EnrichActorTeams         bool `env:"ENRICH_ACTOR_TEAMS,default=false"`         // Whether to record the teams of the organization the actor of each workflow run is a member of
+
+	GitHubQPS    float64           `env:"GITHUB_QPS,default=0"`    // The maximum number of requests per second to GitHub of all organizations, unlimited when 0
+	OrgQPSShare  float64           `env:"ORG_QPS_SHARE,default=1"` // The share of GITHUB_QPS, between 0 and 1, that the events of a single organization may use
+	OrgQPSShares map[string]string `env:"ORG_QPS_SHARES"`          // Per-organization overrides of ORG_QPS_SHARE keyed by organization name
+
+	Concurrency    int  `env:"CONCURRENCY,default=0"`         // The maximum number of events to ingest concurrently, defaults to the number of CPUs
+	FairScheduling bool `env:"FAIR_SCHEDULING,default=false"` // Whether to start ingesting the events of each repository in turn
+
+	CommentTemplate     string        `env:"COMMENT_TEMPLATE"`                 // The text/template of the comment posted on pull requests, defaults to DefaultCommentTemplate
+	CommentMaxRetries   int           `env:"COMMENT_MAX_RETRIES,default=3"`    // The maximum number of retries of a comment that failed with a 5xx response or a rate limit
+	CommentRetryBackoff time.Duration `env:"COMMENT_RETRY_BACKOFF,default=1s"` // The backoff before the first retry of a comment after a 5xx response, doubling with each retry
+
+	CommentQPS float64 `env:"COMMENT_QPS,default=0"` // The maximum number of comments per second posted on pull requests by all events, unlimited when 0
+
+	DisablePRComments bool `env:"DISABLE_PR_COMMENTS,default=false"` // Whether to only archive the logs without commenting on the pull requests
+
+	ConcurrentInit bool `env:"CONCURRENT_INIT,default=true"` // Whether to initialize the object store and the GitHub App concurrently
+
+	DownscopeTokens bool `env:"DOWNSCOPE_TOKENS,default=false"` // Whether to request separate access tokens with only the permissions of each operation
+
+	RedactPattern     string `env:"REDACT_PATTERN"`                        // The regular expression whose matches in the logs are redacted before they are stored, nothing is redacted if empty
+	RedactPlaceholder string `env:"REDACT_PLACEHOLDER,default=[REDACTED]"` // The text that replaces the redacted matches
+
+	AddMissingColumns bool `env:"ADD_MISSING_COLUMNS,default=false"` // Whether to add the columns of fields the rows have but the BigQuery tables lack before writing them
+}
+
+// bucket returns the URI scheme of the storage backend and the name of the
+// bucket to store artifact logs in. A bucket name without a scheme refers to a
+// Cloud Storage bucket.
+func (cfg *Config) bucket() (string, string) {
+	scheme, name, ok := strings.Cut(cfg.BucketName, "://")
+	if !ok {
+		return schemeGCS, cfg.BucketName
+	}
+	return scheme, name
 }
 
 // Validate validates the artifacts config after load.
+//
+// The GitHub App credentials are read from their files first, e.g. a private
+// key mounted from a Kubernetes secret. A file takes precedence over the raw
+// value of the same credential: GITHUB_APP_ID_FILE over GITHUB_APP_ID,
+// GITHUB_INSTALL_ID_FILE over GITHUB_INSTALL_ID and GITHUB_PRIVATE_KEY_FILE
+// over GITHUB_PRIVATE_KEY_SECRET. GITHUB_PRIVATE_KEY_FILE is a private key
+// source like GITHUB_PRIVATE_KEY_SECRET, so it may not be set together with
+// GITHUB_PRIVATE_KEY_KMS_KEY_ID.
 func (cfg *Config) Validate() error {
+	if err := cfg.readCredentialFiles(); err != nil {
+		return err
+	}
+
 	if cfg.GitHubAppID == "" {
 		return fmt.Errorf("GITHUB_APP_ID is required")
 	}
@@ -51,18 +129,96 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf("GITHUB_INSTALL_ID is required")
 	}
 
-	if cfg.GitHubPrivateKeySecret == "" {
-		return fmt.Errorf("GITHUB_PRIVATE_KEY_SECRET is required")
+	if cfg.GitHubPrivateKeyFile != "" && cfg.GitHubPrivateKeyKMSKeyID != "" {
+		return fmt.Errorf("only one of GITHUB_PRIVATE_KEY_FILE or GITHUB_PRIVATE_KEY_KMS_KEY_ID may be set")
+	}
+	if cfg.GitHubPrivateKeySecret == "" && cfg.GitHubPrivateKeyKMSKeyID == "" {
+		return fmt.Errorf("one of GITHUB_PRIVATE_KEY_SECRET, GITHUB_PRIVATE_KEY_FILE or GITHUB_PRIVATE_KEY_KMS_KEY_ID is required")
+	}
+	if cfg.GitHubPrivateKeySecret != "" && cfg.GitHubPrivateKeyKMSKeyID != "" {
+		return fmt.Errorf("only one of GITHUB_PRIVATE_KEY_SECRET or GITHUB_PRIVATE_KEY_KMS_KEY_ID may be set")
 	}
 
 	if cfg.BucketName == "" {
 		return fmt.Errorf("BUCKET_NAME is required")
 	}
 
+	scheme, bucketName := cfg.bucket()
+	if scheme != schemeGCS && scheme != schemeS3 {
+		return fmt.Errorf("BUCKET_NAME scheme must be one of %q or %q, got %q", schemeGCS, schemeS3, scheme)
+	}
+	if bucketName == "" || strings.Contains(bucketName, "/") {
+		return fmt.Errorf("BUCKET_NAME must be a bucket name, got %q", cfg.BucketName)
+	}
+
 	if (cfg.EventsTableID) == "" {
 		return fmt.Errorf("EVENTS_TABLE_ID is required")
 	}
 
+	switch CollisionPolicy(cfg.ObjectCollisionPolicy) {
+	case "", CollisionPolicyOverwrite, CollisionPolicyError, CollisionPolicySuffix:
+	default:
+		return fmt.Errorf("OBJECT_COLLISION_POLICY must be one of %q, %q or %q, got %q",
+			CollisionPolicyOverwrite, CollisionPolicyError, CollisionPolicySuffix, cfg.ObjectCollisionPolicy)
+	}
+	// S3 does not expose a checksum comparable to the one computed for the
+	// content being written, so collisions cannot be detected.
+	if scheme == schemeS3 && cfg.ObjectCollisionPolicy != "" && CollisionPolicy(cfg.ObjectCollisionPolicy) != CollisionPolicyOverwrite {
+		return fmt.Errorf("OBJECT_COLLISION_POLICY %q is not supported for s3 buckets", cfg.ObjectCollisionPolicy)
+	}
+
+	if cfg.MaxAttempts <= 0 {
+		return fmt.Errorf("MAX_ATTEMPTS must be positive, got %d", cfg.MaxAttempts)
+	}
+
+	if cfg.ElementTimeout <= 0 {
+		return fmt.Errorf("ELEMENT_TIMEOUT must be positive, got %s", cfg.ElementTimeout)
+	}
+
+	if cfg.HTTPTimeout < 0 {
+		return fmt.Errorf("HTTP_TIMEOUT must be non-negative, got %s", cfg.HTTPTimeout)
+	}
+
+	if cfg.MinEventAge < 0 {
+		return fmt.Errorf("MIN_EVENT_AGE must be non-negative, got %s", cfg.MinEventAge)
+	}
+
+	if cfg.LookbackDays < 0 {
+		return fmt.Errorf("LOOKBACK_DAYS must be non-negative, got %d", cfg.LookbackDays)
+	}
+
+	if cfg.CommentMaxRetries < 0 {
+		return fmt.Errorf("COMMENT_MAX_RETRIES must be non-negative, got %d", cfg.CommentMaxRetries)
+	}
+
+	if cfg.CommentMaxRetries > 0 && cfg.CommentRetryBackoff <= 0 {
+		return fmt.Errorf("COMMENT_RETRY_BACKOFF must be positive, got %s", cfg.CommentRetryBackoff)
+	}
+
+	if cfg.CommentQPS < 0 {
+		return fmt.Errorf("COMMENT_QPS must be non-negative, got %g", cfg.CommentQPS)
+	}
+
+	if cfg.Concurrency < 0 {
+		return fmt.Errorf("CONCURRENCY must be non-negative, got %d", cfg.Concurrency)
+	}
+
+	if cfg.GitHubQPS < 0 {
+		return fmt.Errorf("GITHUB_QPS must be non-negative, got %g", cfg.GitHubQPS)
+	}
+
+	if cfg.GitHubQPS > 0 && (cfg.OrgQPSShare <= 0 || cfg.OrgQPSShare > 1) {
+		return fmt.Errorf("ORG_QPS_SHARE must be greater than 0 and at most 1, got %g", cfg.OrgQPSShare)
+	}
+
+	if _, err := cfg.orgQPSShares(); err != nil {
+		return fmt.Errorf("invalid ORG_QPS_SHARES: %w", err)
+	}
+
+	if cfg.MaxBufferSize <= 0 {
+		return fmt.Errorf("MAX_BUFFER_SIZE must be positive, got %d", cfg.MaxBufferSize)
+	}
+
 	if cfg.ProjectID == "" {
 		return fmt.Errorf("PROJECT_ID is required")
 	}
@@ -71,9 +227,95 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf("DATASET_ID is required")
 	}
 
+	if cfg.CommentTemplate != "" {
+		if _, err := parseCommentTemplate(cfg.CommentTemplate); err != nil {
+			return fmt.Errorf("invalid COMMENT_TEMPLATE: %w", err)
+		}
+	}
+
+	if _, err := cfg.redactPattern(); err != nil {
+		return fmt.Errorf("invalid REDACT_PATTERN: %w", err)
+	}
+
 	return nil
 }
 
+// readCredentialFiles replaces the GitHub App credentials with the content of
+// their files, if set. Surrounding whitespace is trimmed from the IDs, e.g. a
+// trailing newline.
+func (cfg *Config) readCredentialFiles() error {
+	if cfg.GitHubAppIDFile != "" {
+		b, err := os.ReadFile(cfg.GitHubAppIDFile)
+		if err != nil {
+			return fmt.Errorf("failed to read GITHUB_APP_ID_FILE: %w", err)
+		}
+		cfg.GitHubAppID = strings.TrimSpace(string(b))
+	}
+
+	if cfg.GitHubInstallIDFile != "" {
+		b, err := os.ReadFile(cfg.GitHubInstallIDFile)
+		if err != nil {
+			return fmt.Errorf("failed to read GITHUB_INSTALL_ID_FILE: %w", err)
+		}
+		cfg.GitHubInstallID = strings.TrimSpace(string(b))
+	}
+
+	if cfg.GitHubPrivateKeyFile != "" {
+		b, err := os.ReadFile(cfg.GitHubPrivateKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read GITHUB_PRIVATE_KEY_FILE: %w", err)
+		}
+		cfg.GitHubPrivateKeySecret = string(b)
+	}
+
+	return nil
+}
+
+// orgQPSShares returns the parsed per-organization shares of the requests per
+// second to GitHub.
+func (cfg *Config) orgQPSShares() (map[string]float64, error) {
+	shares := make(map[string]float64, len(cfg.OrgQPSShares))
+	for org, v := range cfg.OrgQPSShares {
+		share, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse share of organization %q: %w", org, err)
+		}
+		if share <= 0 || share > 1 {
+			return nil, fmt.Errorf("share of organization %q must be greater than 0 and at most 1, got %g", org, share)
+		}
+		shares[org] = share
+	}
+	return shares, nil
+}
+
+// redactPattern returns the compiled pattern of the matches to redact from the
+// logs, or nil if nothing is redacted.
+func (cfg *Config) redactPattern() (*regexp.Regexp, error) {
+	if cfg.RedactPattern == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(cfg.RedactPattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse redact pattern: %w", err)
+	}
+	return pattern, nil
+}
+
+// commentTemplate returns the parsed comment template, or the default one if
+// none is configured.
+func (cfg *Config) commentTemplate() (*template.Template, error) {
+	if cfg.CommentTemplate == "" {
+		return defaultCommentTemplate, nil
+	}
+	return parseCommentTemplate(cfg.CommentTemplate)
+}
+
+// LogConfig returns the config for logging, with the values of sensitive
+// fields redacted.
+func (cfg *Config) LogConfig() map[string]any {
+	return redact.Fields(cfg)
+}
+
 // NewConfig creates a new Config from environment variables.
 func NewConfig(ctx context.Context) (*Config, error) {
 	return newConfig(ctx, envconfig.OsLookuper())
@@ -113,13 +355,91 @@ func (cfg *Config) ToFlags(set *cli.FlagSet) *cli.FlagSet {
 	})
 
 	f.StringVar(&cli.StringVar{
-		Name:    "bucket-name",
-		Target:  &cfg.BucketName,
-		EnvVar:  "BUCKET_NAME",
-		Usage:   `The name of the bucket that holds artifact logs files from GitHub`,
+		Name:   "github-app-id-file",
+		Target: &cfg.GitHubAppIDFile,
+		EnvVar: "GITHUB_APP_ID_FILE",
+		Usage:  `The file holding the GitHub App ID, which takes precedence over --github-app-id.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "github-install-id-file",
+		Target: &cfg.GitHubInstallIDFile,
+		EnvVar: "GITHUB_INSTALL_ID_FILE",
+		Usage:  `The file holding the GitHub App installation ID, which takes precedence over --github-install-id.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "github-private-key-file",
+		Target: &cfg.GitHubPrivateKeyFile,
+		EnvVar: "GITHUB_PRIVATE_KEY_FILE",
+		Usage: `The file holding the PEM encoded GitHub App private key, e.g. mounted ` +
+			`from a Kubernetes secret, which takes precedence over --github-private-key-secret.`,
+		Example: "/var/run/secrets/github/private-key.pem",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "github-private-key-kms-key-id",
+		Target: &cfg.GitHubPrivateKeyKMSKeyID,
+		EnvVar: "GITHUB_PRIVATE_KEY_KMS_KEY_ID",
+		Usage: `The resource name of the Cloud KMS crypto key version holding the GitHub App ` +
+			`private key, which signs the GitHub App tokens instead of a key read from ` +
+			`--github-private-key-secret. The key must use a PKCS #1 v1.5 SHA-256 RSA signing algorithm.`,
+		Example: "projects/my-project/locations/global/keyRings/github/cryptoKeys/app/cryptoKeyVersions/1",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "bucket-name",
+		Target: &cfg.BucketName,
+		EnvVar: "BUCKET_NAME",
+		Usage: `The name of the bucket that holds artifact logs files from GitHub. ` +
+			`Prefix the name with "s3://" to store the logs in S3 instead of Cloud Storage.`,
 		Example: "retry-lock-xxxx",
 	})
 
+	f.StringVar(&cli.StringVar{
+		Name:    "object-collision-policy",
+		Target:  &cfg.ObjectCollisionPolicy,
+		EnvVar:  "OBJECT_COLLISION_POLICY",
+		Default: string(CollisionPolicyOverwrite),
+		Usage: `How to handle writing logs to an object that already exists with ` +
+			`different content. One of "overwrite", "error" or "suffix".`,
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "element-timeout",
+		Target:  &cfg.ElementTimeout,
+		EnvVar:  "ELEMENT_TIMEOUT",
+		Default: 10 * time.Minute,
+		Usage: `The maximum time to spend fetching and storing the logs of a single ` +
+			`event. Events that exceed it are marked as failed and retried.`,
+	})
+
+	f.Int64Var(&cli.Int64Var{
+		Name:    "max-buffer-size",
+		Target:  &cfg.MaxBufferSize,
+		EnvVar:  "MAX_BUFFER_SIZE",
+		Default: 100 << 20,
+		Usage: `The maximum size in bytes of logs to hold in memory. Larger logs are ` +
+			`only ever streamed and fail to be written if a feature, such as the ` +
+			`"error" or "suffix" object collision policy, requires buffering them.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "s3-endpoint",
+		Target:  &cfg.S3Endpoint,
+		EnvVar:  "S3_ENDPOINT",
+		Usage:   `The endpoint of an S3-compatible service, e.g. MinIO, to store logs in for s3:// buckets.`,
+		Example: "https://minio.example.com",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "s3-region",
+		Target:  &cfg.S3Region,
+		EnvVar:  "S3_REGION",
+		Usage:   `The AWS region of s3:// buckets. Defaults to the region from the AWS environment.`,
+		Example: "us-east-1",
+	})
+
 	f.StringVar(&cli.StringVar{
 		Name:   "events-table-id",
 		Target: &cfg.EventsTableID,
@@ -134,6 +454,24 @@ func (cfg *Config) ToFlags(set *cli.FlagSet) *cli.FlagSet {
 		Usage:  `The artifacts table ID within the dataset.`,
 	})
 
+	f.BoolVar(&cli.BoolVar{
+		Name:    "add-missing-columns",
+		Target:  &cfg.AddMissingColumns,
+		EnvVar:  "ADD_MISSING_COLUMNS",
+		Default: false,
+		Usage: `Whether to add the columns of fields the artifact records have but the BigQuery table ` +
+			`lacks, instead of failing the write until the table is altered manually.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "dlq-topic-id",
+		Target: &cfg.DLQTopicID,
+		EnvVar: "DLQ_TOPIC_ID",
+		Usage: `The pubsub topic ID within the project that events are published to ` +
+			`as JSON once their logs failed to be ingested --max-attempts times, ` +
+			`so that they can be handled as dead letters. Nothing is published if empty.`,
+	})
+
 	f.StringVar(&cli.StringVar{
 		Name:   "project-id",
 		Target: &cfg.ProjectID,
@@ -156,5 +494,208 @@ func (cfg *Config) ToFlags(set *cli.FlagSet) *cli.FlagSet {
 		Usage:   `The number of items to process in this execution`,
 	})
 
+	f.IntVar(&cli.IntVar{
+		Name:    "max-attempts",
+		Target:  &cfg.MaxAttempts,
+		EnvVar:  "MAX_ATTEMPTS",
+		Default: 10,
+		Usage: `The number of times to attempt ingesting the logs of an event. ` +
+			`Events that failed fewer times are retried on the next execution.`,
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "http-timeout",
+		Target:  &cfg.HTTPTimeout,
+		EnvVar:  "HTTP_TIMEOUT",
+		Default: 0,
+		Usage: `The maximum time of a single request to GitHub, including reading ` +
+			`the logs it returns, e.g. to fail fast behind an unresponsive proxy. ` +
+			`Requests are only bounded by the element timeout when 0.`,
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "min-event-age",
+		Target:  &cfg.MinEventAge,
+		EnvVar:  "MIN_EVENT_AGE",
+		Default: 5 * time.Minute,
+		Usage: `The minimum time since an event was received before its logs are ` +
+			`ingested, giving GitHub time to finalize the log archive. Set to 0 ` +
+			`to ingest events as soon as they are received.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "lookback-days",
+		Target:  &cfg.LookbackDays,
+		EnvVar:  "LOOKBACK_DAYS",
+		Default: 0,
+		Usage: `The maximum age in days of the events whose logs are ingested, which bounds ` +
+			`the events and artifacts scanned by the query selecting the events. Older events ` +
+			`are never ingested. Set to 0 to ingest events of any age.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "emit-processing-lag",
+		Target:  &cfg.EmitProcessingLag,
+		EnvVar:  "EMIT_PROCESSING_LAG",
+		Default: false,
+		Usage: `Whether to log and record the age of the oldest event whose logs need to be ` +
+			`ingested at the start of each run, e.g. to alert when the job falls so far ` +
+			`behind that logs expire before they are ingested.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "enrich-repository-metadata",
+		Target:  &cfg.EnrichRepositoryMetadata,
+		EnvVar:  "ENRICH_REPOSITORY_METADATA",
+		Default: false,
+		Usage: `Whether to record the visibility, primary language and topics of the ` +
+			`repository with each artifact. This costs one GitHub API call per ` +
+			`repository per execution.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "enrich-actor-teams",
+		Target:  &cfg.EnrichActorTeams,
+		EnvVar:  "ENRICH_ACTOR_TEAMS",
+		Default: false,
+		Usage: `Whether to record the teams of the organization that the actor of each workflow ` +
+			`run is a member of with each artifact, e.g. to route the logs to their owners. This ` +
+			`costs one GitHub API call per team of each organization per execution, and the ` +
+			`GitHub App requires read access to the members of the organization.`,
+	})
+
+	f.Float64Var(&cli.Float64Var{
+		Name:    "github-qps",
+		Target:  &cfg.GitHubQPS,
+		EnvVar:  "GITHUB_QPS",
+		Default: 0,
+		Usage: `The maximum number of requests per second to GitHub of the events of all ` +
+			`organizations together. Set to 0 to not limit the requests.`,
+	})
+
+	f.Float64Var(&cli.Float64Var{
+		Name:    "org-qps-share",
+		Target:  &cfg.OrgQPSShare,
+		EnvVar:  "ORG_QPS_SHARE",
+		Default: 1,
+		Usage: `The share of --github-qps, greater than 0 and at most 1, that the events ` +
+			`of a single organization may use, so that an organization with heavy traffic ` +
+			`can't exhaust the GitHub rate limit and starve the other organizations.`,
+	})
+
+	f.StringMapVar(&cli.StringMapVar{
+		Name:    "org-qps-shares",
+		Target:  &cfg.OrgQPSShares,
+		EnvVar:  "ORG_QPS_SHARES",
+		Usage:   `Overrides --org-qps-share for the given organization. Can be repeated.`,
+		Example: "my-busy-org=0.25",
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "concurrency",
+		Target:  &cfg.Concurrency,
+		EnvVar:  "CONCURRENCY",
+		Default: 0,
+		Usage:   `The maximum number of events whose logs are ingested concurrently. Defaults to the number of CPUs.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "fair-scheduling",
+		Target:  &cfg.FairScheduling,
+		EnvVar:  "FAIR_SCHEDULING",
+		Default: false,
+		Usage: `Whether to start ingesting the events of each repository in turn, so ` +
+			`that a repository with many events in a batch does not occupy all ` +
+			`workers while the events of other repositories wait.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "comment-template",
+		Target: &cfg.CommentTemplate,
+		EnvVar: "COMMENT_TEMPLATE",
+		Usage: `The Go text/template of the comment posted on the pull requests of a workflow run ` +
+			`once its logs were ingested. The template is rendered with .Event, .Artifact, ` +
+			`.ArtifactURL and .StorageName. Defaults to a link to the logs. A hidden marker is ` +
+			`appended to each comment so it isn't posted again when the workflow run is reprocessed.`,
+		Example: `Logs of run {{ .Event.WorkflowRunID }} are [here]({{ .ArtifactURL }}), see also https://dashboards.example.com`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "comment-max-retries",
+		Target:  &cfg.CommentMaxRetries,
+		EnvVar:  "COMMENT_MAX_RETRIES",
+		Default: 3,
+		Usage: `The maximum number of retries of a pull request comment that failed with ` +
+			`a 5xx response or a rate limit. Other 4xx responses are not retried.`,
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "comment-retry-backoff",
+		Target:  &cfg.CommentRetryBackoff,
+		EnvVar:  "COMMENT_RETRY_BACKOFF",
+		Default: time.Second,
+		Usage: `The backoff before the first retry of a pull request comment after a 5xx ` +
+			`response, it doubles with each retry. Rate limited comments are retried once ` +
+			`the rate limit resets.`,
+	})
+
+	f.Float64Var(&cli.Float64Var{
+		Name:    "comment-qps",
+		Target:  &cfg.CommentQPS,
+		EnvVar:  "COMMENT_QPS",
+		Default: 0,
+		Usage: `The maximum number of comments per second posted on pull requests, shared by ` +
+			`all events being ingested concurrently, to stay clear of the secondary rate ` +
+			`limits of GitHub. Comments are not paced when 0.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "disable-pr-comments",
+		Target:  &cfg.DisablePRComments,
+		EnvVar:  "DISABLE_PR_COMMENTS",
+		Default: false,
+		Usage: `Whether to skip commenting on the pull requests of a workflow run once its ` +
+			`logs were ingested. The logs are still archived and recorded.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "concurrent-init",
+		Target:  &cfg.ConcurrentInit,
+		EnvVar:  "CONCURRENT_INIT",
+		Default: true,
+		Usage: `Whether to initialize the object store and the GitHub App concurrently at ` +
+			`startup, rather than one after the other.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "downscope-tokens",
+		Target:  &cfg.DownscopeTokens,
+		EnvVar:  "DOWNSCOPE_TOKENS",
+		Default: false,
+		Usage: `Whether to request a separate GitHub access token for each operation with ` +
+			`only the permissions it needs, i.e. a read-only token to download logs ` +
+			`and a token that may write pull requests to comment on them.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "redact-pattern",
+		Target: &cfg.RedactPattern,
+		EnvVar: "REDACT_PATTERN",
+		Usage: `The regular expression whose matches in the logs are replaced with the ` +
+			`redact placeholder before the logs are stored, e.g. to remove leaked secrets. ` +
+			`Combine several patterns with "|". The logs are redacted line by line as they ` +
+			`are streamed, zip archives and gzip streams are decompressed and compressed ` +
+			`again. Nothing is redacted if empty.`,
+		Example: `gh[pousr]_[A-Za-z0-9]{36}|AKIA[0-9A-Z]{16}`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "redact-placeholder",
+		Target:  &cfg.RedactPlaceholder,
+		EnvVar:  "REDACT_PLACEHOLDER",
+		Default: "[REDACTED]",
+		Usage:   `The text that replaces the matches of the redact pattern in the logs.`,
+	})
+
 	return set
 }
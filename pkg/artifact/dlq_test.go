@@ -0,0 +1,127 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v61/github"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/webhook"
+)
+
+const (
+	testDLQProjectID = "test-project-id"
+	testDLQTopicID   = "test-dlq-topic-id"
+)
+
+func TestPipeline_ProcessElement_DeadLetter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /success/logs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "workflow logs")
+	})
+	mux.HandleFunc("GET /failure/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "internal error")
+	})
+	mux.HandleFunc("GET /expired/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	fakeGitHub := httptest.NewServer(mux)
+	t.Cleanup(fakeGitHub.Close)
+
+	srv := pstest.NewServer()
+	t.Cleanup(func() { srv.Close() })
+	conn, err := grpc.NewClient(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to connect to test pubsub server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	client, err := pubsub.NewClient(ctx, testDLQProjectID, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("failed to create test pubsub client: %v", err)
+	}
+	if _, err := client.CreateTopic(ctx, testDLQTopicID); err != nil {
+		t.Fatalf("failed to create test pubsub topic: %v", err)
+	}
+
+	dlq, err := webhook.NewPubSubMessenger(ctx, testDLQProjectID, testDLQTopicID, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ingest := logIngester{
+		bucketName:  "test",
+		storage:     &testObjectWriter{},
+		ghClient:    github.NewClient(fakeGitHub.Client()),
+		dlq:         dlq,
+		maxAttempts: 3,
+	}
+	t.Cleanup(func() {
+		if err := ingest.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	for _, event := range []EventRecord{
+		// the last attempt fails
+		{DeliveryID: "exceeded", LogsURL: fakeGitHub.URL + "/failure/logs", Attempts: 2},
+		// later attempts are left
+		{DeliveryID: "retried", LogsURL: fakeGitHub.URL + "/failure/logs", Attempts: 1},
+		// the last attempt succeeds or finds the logs expired
+		{DeliveryID: "succeeded", LogsURL: fakeGitHub.URL + "/success/logs", Attempts: 2},
+		{DeliveryID: "expired", LogsURL: fakeGitHub.URL + "/expired/logs", Attempts: 2},
+	} {
+		event.RepositorySlug = "org/repo"
+		ingest.ProcessElement(ctx, event)
+	}
+
+	var got []EventRecord
+	for _, msg := range srv.Messages() {
+		var event EventRecord
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			t.Fatalf("failed to decode message: %v", err)
+		}
+		got = append(got, event)
+	}
+
+	want := []EventRecord{
+		{
+			DeliveryID:     "exceeded",
+			RepositorySlug: "org/repo",
+			LogsURL:        fakeGitHub.URL + "/failure/logs",
+			Attempts:       3,
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("dead letter events (-got,+want):\n%s", diff)
+	}
+}
@@ -21,16 +21,25 @@ package artifact
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"runtime/debug"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/google/go-github/v61/github"
 	"golang.org/x/oauth2"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/option"
 
+	"github.com/abcxyz/github-metrics-aggregator/pkg/webhook"
 	"github.com/abcxyz/pkg/githubauth"
 	"github.com/abcxyz/pkg/logging"
 )
@@ -47,7 +56,13 @@ type EventRecord struct {
 	WorkflowURL        string   `bigquery:"workflow_url" json:"workflow_url"`
 	WorkflowRunID      string   `bigquery:"workflow_run_id" json:"workflow_run_id"`
 	WorkflowRunAttempt string   `bigquery:"workflow_run_attempt" json:"workflow_run_attempt"`
+	Conclusion         string   `bigquery:"conclusion" json:"conclusion"`
 	PullRequestNumbers []string `bigquery:"pull_request_numbers" json:"pull_request_numbers"`
+	Attempts           int      `bigquery:"attempts" json:"attempts"`
+
+	// OldestReceived is when the oldest of all events that need to be
+	// processed was received, not only of the events of the batch.
+	OldestReceived time.Time `bigquery:"oldest_received" json:"oldest_received"`
 }
 
 // ArtifactRecord is the output data structure that maps to the leech pipeline's
@@ -63,61 +78,352 @@ type ArtifactRecord struct {
 	RepositoryName   string    `bigquery:"repository_name" json:"repository_name"`
 	RepositorySlug   string    `bigquery:"repository_slug" json:"repository_slug"`
 	JobName          string    `bigquery:"job_name" json:"job_name"`
+	Attempts         int       `bigquery:"attempts" json:"attempts"`
+	Conclusion       string    `bigquery:"conclusion" json:"conclusion"`
+
+	// The repository metadata is only populated when enrichment is enabled.
+	RepositoryVisibility string   `bigquery:"repository_visibility" json:"repository_visibility"`
+	RepositoryLanguage   string   `bigquery:"repository_language" json:"repository_language"`
+	RepositoryTopics     []string `bigquery:"repository_topics" json:"repository_topics"`
+
+	// The teams of the actor are only populated when enrichment is enabled.
+	GitHubActorTeams []string `bigquery:"github_actor_teams" json:"github_actor_teams"`
+
+	// Error is the message of the panic of an element that failed
+	// unexpectedly, e.g. on a malformed event.
+	Error string `bigquery:"error" json:"error"`
 }
 
 // errLogsExpired is a marker error so that upstream processing knows
 // that the logs for a given event no longer exist.
 var errLogsExpired = errors.New("GitHub logs expired")
 
+// errCommentsPartiallyFailed is a marker error for when the artifact was
+// commented on some but not all of its pull requests.
+var errCommentsPartiallyFailed = errors.New("failed to comment artifact on some pull requests")
+
 // logIngester is an object that provides the main processing of the event.
 type logIngester struct {
 	ghClient   *github.Client
 	storage    ObjectWriter
 	projectID  string
+	scheme     string
 	bucketName string
+
+	// elementTimeout bounds the processing of a single element, if set.
+	elementTimeout time.Duration
+
+	// repositoryMetadata enriches records with the metadata of their
+	// repository, if set.
+	repositoryMetadata *repositoryMetadataCache
+
+	// actorTeams enriches records with the teams of their actor, if set.
+	actorTeams *actorTeamsCache
+
+	// commentTemplate renders the comments posted on pull requests, the
+	// default template is used if nil.
+	commentTemplate *template.Template
+
+	// commentMaxRetries is the maximum number of retries of a comment that
+	// failed with a 5xx response or a rate limit.
+	commentMaxRetries int
+
+	// commentRetryBackoff is the backoff before the first retry of a comment
+	// after a 5xx response, it doubles with each retry.
+	commentRetryBackoff time.Duration
+
+	// commentLimiter paces the comments posted by all elements, comments are
+	// not paced if nil.
+	commentLimiter *rate.Limiter
+
+	// ghCommentClient comments on pull requests with access tokens that may
+	// write them when tokens are downscoped, ghClient is used if nil.
+	ghCommentClient *github.Client
+
+	// disableComments skips commenting on pull requests entirely.
+	disableComments bool
+
+	// metrics records the outcome of each element, nothing is recorded if nil.
+	metrics MetricsRecorder
+
+	// rateBudgets limits the requests to GitHub of each organization, if set.
+	rateBudgets *orgRateBudgets
+
+	// dlq is the topic that events are published to once the last of their
+	// maxAttempts attempts failed, nothing is published if nil.
+	dlq         *webhook.PubSubMessenger
+	maxAttempts int
+}
+
+// LogIngesterOptions encapsulate client config options of the logIngester.
+type LogIngesterOptions struct {
+	// HTTPTransport is the transport of the requests to GitHub, e.g. an
+	// [*http.Transport] with proxy or TLS settings. [http.DefaultTransport] is
+	// used if nil.
+	HTTPTransport http.RoundTripper
+
+	// DLQPubsubClientOpts are the options of the pubsub client of the dead
+	// letter topic.
+	DLQPubsubClientOpts []option.ClientOption
 }
 
 // NewLogIngester creates a logIngester and initializes the object store, GitHub app and http client.
-func NewLogIngester(ctx context.Context, projectID, logsBucketName, gitHubAppID, gitHubInstallID, gitHubPrivateKey string) (*logIngester, error) {
-	// create an object store
-	store, err := NewObjectStore(ctx)
+// The outcome of each element is recorded with the metrics recorder, if not nil.
+func NewLogIngester(ctx context.Context, cfg *Config, metrics MetricsRecorder, opts *LogIngesterOptions) (*logIngester, error) {
+	commentTemplate, err := cfg.commentTemplate()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create object store client: %w", err)
+		return nil, err
 	}
 
-	app, err := githubauth.NewApp(gitHubAppID, gitHubPrivateKey)
+	redactPattern, err := cfg.redactPattern()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create github app: %w", err)
+		return nil, err
 	}
 
-	installation, err := app.InstallationForID(ctx, gitHubInstallID)
+	orgQPSShares, err := cfg.orgQPSShares()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get github app installation: %w", err)
+		return nil, err
+	}
+
+	// the object store and the GitHub App are independent, so they are
+	// initialized concurrently unless configured otherwise to reduce the
+	// startup latency of workers
+	var g errgroup.Group
+	if !cfg.ConcurrentInit {
+		g.SetLimit(1)
 	}
 
-	ts := installation.AllReposOAuth2TokenSource(ctx, map[string]string{
-		"actions":       "read",
-		"pull_requests": "write",
+	scheme, bucketName := cfg.bucket()
+	var storage ObjectWriter
+	var storageErr error
+	g.Go(func() error {
+		storage, storageErr = newObjectWriter(ctx, cfg, scheme)
+		return storageErr
 	})
 
-	ghClient := github.NewClient(oauth2.NewClient(ctx, ts))
+	// the timeout bounds each request to GitHub, including reading the
+	// response body, so it must leave time to stream the largest logs
+	httpClient := &http.Client{
+		Timeout:   cfg.HTTPTimeout,
+		Transport: opts.HTTPTransport,
+	}
+
+	permissions := tokenPermissions(cfg)
+
+	var sources []oauth2.TokenSource
+	var tsErr error
+	g.Go(func() error {
+		sources, tsErr = installationTokenSources(ctx, cfg, httpClient, permissions)
+		return tsErr
+	})
+
+	// both initializations run to completion, so that all of their errors
+	// are reported at once
+	if err := g.Wait(); err != nil {
+		return nil, errors.Join(storageErr, tsErr)
+	}
+
+	var rateBudgets *orgRateBudgets
+	if cfg.GitHubQPS > 0 {
+		rateBudgets = newOrgRateBudgets(cfg.GitHubQPS, cfg.OrgQPSShare, orgQPSShares)
+	}
+
+	// the clients of all tokens share the rate limit budgets
+	clients := make([]*github.Client, 0, len(sources))
+	for _, ts := range sources {
+		var ghTransport http.RoundTripper = &oauth2.Transport{
+			Base:   opts.HTTPTransport,
+			Source: ts,
+		}
+		if rateBudgets != nil {
+			ghTransport = &orgRateBudgetTransport{
+				base:    ghTransport,
+				budgets: rateBudgets,
+			}
+		}
+		clients = append(clients, github.NewClient(&http.Client{
+			Timeout:   cfg.HTTPTimeout,
+			Transport: ghTransport,
+		}))
+	}
+	ghClient := clients[0]
+	var ghCommentClient *github.Client
+	if len(clients) > 1 {
+		ghCommentClient = clients[1]
+	}
+
+	// comments are spaced out evenly rather than posted in bursts, which is
+	// what the secondary rate limits of GitHub are wary of
+	var commentLimiter *rate.Limiter
+	if cfg.CommentQPS > 0 {
+		commentLimiter = rate.NewLimiter(rate.Limit(cfg.CommentQPS), 1)
+	}
+
+	var dlq *webhook.PubSubMessenger
+	if cfg.DLQTopicID != "" {
+		dlq, err = webhook.NewPubSubMessenger(ctx, cfg.ProjectID, cfg.DLQTopicID, opts.DLQPubsubClientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create dlq pubsub: %w", err)
+		}
+	}
+
+	var repositoryMetadata *repositoryMetadataCache
+	if cfg.EnrichRepositoryMetadata {
+		repositoryMetadata = newRepositoryMetadataCache(ghClient)
+	}
+
+	var actorTeams *actorTeamsCache
+	if cfg.EnrichActorTeams {
+		actorTeams = newActorTeamsCache(ghClient)
+	}
+
+	// logs are redacted before they are compressed, so that compressed logs
+	// are decompressed only once
+	storage = newCompressingWriter(storage)
+	if redactPattern != nil {
+		storage = newRedactingWriter(storage, redactPattern, cfg.RedactPlaceholder)
+	}
 
 	return &logIngester{
-		storage:    store,
+		storage:    storage,
 		ghClient:   ghClient,
-		bucketName: logsBucketName,
-		projectID:  projectID,
+		scheme:     scheme,
+		bucketName: bucketName,
+		projectID:  cfg.ProjectID,
+
+		elementTimeout:     cfg.ElementTimeout,
+		repositoryMetadata: repositoryMetadata,
+		actorTeams:         actorTeams,
+		commentTemplate:    commentTemplate,
+		metrics:            metrics,
+
+		commentMaxRetries:   cfg.CommentMaxRetries,
+		commentRetryBackoff: cfg.CommentRetryBackoff,
+		commentLimiter:      commentLimiter,
+		ghCommentClient:     ghCommentClient,
+		disableComments:     cfg.DisablePRComments,
+
+		rateBudgets: rateBudgets,
+
+		dlq:         dlq,
+		maxAttempts: cfg.MaxAttempts,
 	}, nil
 }
 
+// Close handles the graceful shutdown of the dead letter topic, if any.
+func (f *logIngester) Close() error {
+	if f.dlq == nil {
+		return nil
+	}
+	return f.dlq.Close() //nolint:wrapcheck // Want passthrough
+}
+
+// commentClient returns the client commenting on pull requests.
+func (f *logIngester) commentClient() *github.Client {
+	if f.ghCommentClient != nil {
+		return f.ghCommentClient
+	}
+	return f.ghClient
+}
+
 // ProcessElement is the main processing function for the logIngester implementation that
-// reads workflow logs from GitHub and stores them in Cloud Storage.
-func (f *logIngester) ProcessElement(ctx context.Context, event EventRecord) ArtifactRecord {
+// reads workflow logs from GitHub and stores them in Cloud Storage. An element
+// that panics, e.g. on a malformed event, is recorded as a FAILURE with the
+// panic message so that the other elements are still processed.
+func (f *logIngester) ProcessElement(ctx context.Context, event EventRecord) (result ArtifactRecord) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = f.recoverElement(ctx, &event, r)
+		}
+		f.publishDeadLetter(ctx, &event, &result)
+	}()
+	return f.processElement(ctx, event)
+}
+
+// publishDeadLetter publishes the event to the dead letter topic if the last
+// of its attempts failed, so that it is not retried by later runs. Failing to
+// publish it is only logged, the element is recorded as failed either way.
+func (f *logIngester) publishDeadLetter(ctx context.Context, event *EventRecord, artifact *ArtifactRecord) {
+	if f.dlq == nil || artifact.Status != "FAILURE" || artifact.Attempts < f.maxAttempts {
+		return
+	}
+
+	logger := logging.FromContext(ctx)
+
+	// the event is published with the attempts including this one
+	deadLetter := *event
+	deadLetter.Attempts = artifact.Attempts
+	msg, err := json.Marshal(&deadLetter)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to marshal dead letter event",
+			"error", err,
+			"delivery_id", event.DeliveryID,
+		)
+		return
+	}
+
+	if err := f.dlq.Send(ctx, msg); err != nil {
+		logger.ErrorContext(ctx, "failed to publish event to dlq",
+			"error", err,
+			"delivery_id", event.DeliveryID,
+		)
+		return
+	}
+	logger.WarnContext(ctx, "published event to dlq after its last attempt failed",
+		"delivery_id", event.DeliveryID,
+		"attempts", artifact.Attempts,
+	)
+}
+
+// recoverElement returns the FAILURE record of an element whose processing
+// panicked with the given value.
+func (f *logIngester) recoverElement(ctx context.Context, event *EventRecord, r any) ArtifactRecord {
+	failure := fmt.Errorf("panic processing element: %v", r)
+	logging.FromContext(ctx).ErrorContext(ctx, "recovered from panic processing element",
+		"error", failure,
+		"delivery_id", event.DeliveryID,
+		"stack", string(debug.Stack()),
+	)
+
+	result := ArtifactRecord{
+		DeliveryID:       event.DeliveryID,
+		ProcessedAt:      time.Now(),
+		WorkflowURI:      event.WorkflowURL,
+		GitHubActor:      event.GitHubActor,
+		OrganizationName: event.OrganizationName,
+		RepositoryName:   event.RepositoryName,
+		RepositorySlug:   event.RepositorySlug,
+		Status:           "FAILURE",
+		Attempts:         event.Attempts + 1,
+		Conclusion:       event.Conclusion,
+		Error:            failure.Error(),
+	}
+	f.recordOutcome(ctx, event, &result, failure)
+	return result
+}
+
+// processElement reads the workflow logs of the event from GitHub and stores
+// them.
+func (f *logIngester) processElement(ctx context.Context, event EventRecord) ArtifactRecord {
 	logger := logging.FromContext(ctx)
 
+	// Bound both fetching the logs from GitHub and writing them to storage so
+	// that a hung call cannot block a worker indefinitely.
+	if f.elementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.elementTimeout)
+		defer cancel()
+	}
+
 	logger.InfoContext(ctx, "process element", "delivery_id", event.DeliveryID)
 
-	gcsPath := fmt.Sprintf("gs://%s/%s/%s/artifacts.tar.gz", f.bucketName, event.RepositorySlug, event.DeliveryID)
+	// the requests to GitHub count against the rate limit budget of the
+	// organization of the event
+	ctx = withOrganization(ctx, event.OrganizationName)
+
+	// The extension is added when the logs are written, based on whether GitHub
+	// served them as a zip archive or they had to be compressed.
+	gcsPath := fmt.Sprintf("%s://%s/%s/%s/artifacts", f.objectScheme(), f.bucketName, event.RepositorySlug, event.DeliveryID)
 	result := ArtifactRecord{
 		DeliveryID:       event.DeliveryID,
 		ProcessedAt:      time.Now(),
@@ -128,83 +434,312 @@ func (f *logIngester) ProcessElement(ctx context.Context, event EventRecord) Art
 		RepositorySlug:   event.RepositorySlug,
 		LogsURI:          gcsPath,
 		Status:           "SUCCESS",
+		Attempts:         event.Attempts + 1,
+		Conclusion:       event.Conclusion,
 	}
 	logger.InfoContext(ctx, "processing element",
 		"delivery_id", event.DeliveryID,
 		"event", event,
 		"result", result)
 
-	if err := f.handleMessage(ctx, event.LogsURL, gcsPath); err != nil {
+	// failure is the reason the element failed, if it did
+	var failure error
+
+	logsURI, logsBytes, err := f.handleMessage(ctx, event.LogsURL, gcsPath)
+	if err != nil {
 		// Expired logs can never be retrieved, mark them as gone and move on
 		if errors.Is(err, errLogsExpired) {
 			logger.InfoContext(ctx, "logs for workflow not available", "delivery_id", event.DeliveryID)
 			result.Status = "NOT_FOUND"
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			// Timeouts are retried like any other failure
+			logger.ErrorContext(ctx, "timed out retrieving logs for workflow",
+				"error", err,
+				"timeout", f.elementTimeout,
+				"delivery_id", event.DeliveryID,
+			)
+			result.Status = "FAILURE"
+			failure = err
 		} else {
-			// Other failures can be retried
-			// @TODO(bradegler): These are currently filtered out of the query, need to figure
-			// out a way to mark how many attempts have been made for a particular delivery id
-			// preferably without causing an update to the row in BigQuery. The simplest approach
-			// would be to just not write a FAILURE status and let the query try again. The drawback
-			// is that something could be stuck forever in that situation and we wouldn't want to
-			// keep processing it. I think a secondary FAILURE table might work that we can join
-			// into the main query as WHERE count(failures where delivery_id = x) < 10 or something.
-			// This adds complexity to the write operation though so it requires some thought.
-			// For now just flag rows as FAILUREs and we can delete them from the table to trigger
-			// reprocessing.
+			// Other failures are retried by later runs until the maximum number
+			// of attempts is reached. Each attempt is recorded as a FAILURE row
+			// which the driving query counts.
 			logger.ErrorContext(ctx, "failed to retrieve logs for workflow",
 				"error", err,
 				"delivery_id", event.DeliveryID,
 			)
 			result.Status = "FAILURE"
+			failure = err
 		}
+	} else {
+		// The logs are written with an extension matching their format and may
+		// have been written elsewhere to avoid a naming collision.
+		result.LogsURI = logsURI
+		f.metricsRecorder().RecordBytes(ctx, &event, logsBytes)
 	}
 
 	artifactURL := fmt.Sprintf("https://console.cloud.google.com/storage/browser/%s/%s/%s?project=%s", f.bucketName, event.RepositorySlug, event.DeliveryID, f.projectID)
+	if f.objectScheme() == schemeS3 {
+		artifactURL = fmt.Sprintf("https://s3.console.aws.amazon.com/s3/buckets/%s?prefix=%s/%s/", f.bucketName, event.RepositorySlug, event.DeliveryID)
+	}
 	if err := f.commentArtifactOnPRs(ctx, &event, &result, artifactURL); err != nil {
 		logger.ErrorContext(ctx, "failed to comment artifact on PRs",
 			"error", err,
 			"delivery_id", event.DeliveryID,
 		)
-		result.Status = "FAILURE"
+		// The logs were ingested, so the element is only retried if none of its
+		// pull requests were commented.
+		if errors.Is(err, errCommentsPartiallyFailed) {
+			result.Status = "PARTIAL_SUCCESS"
+		} else {
+			result.Status = "FAILURE"
+			failure = err
+		}
 	}
+
+	f.enrichRepositoryMetadata(ctx, &event, &result)
+	f.enrichActorTeams(ctx, &event, &result)
+	f.recordOutcome(ctx, &event, &result, failure)
 	return result
 }
 
+// recordOutcome records the outcome of an element according to the status of
+// its artifact record.
+func (f *logIngester) recordOutcome(ctx context.Context, event *EventRecord, artifact *ArtifactRecord, failure error) {
+	metrics := f.metricsRecorder()
+	switch artifact.Status {
+	case "SUCCESS", "PARTIAL_SUCCESS":
+		metrics.RecordProcessed(ctx, event)
+	case "NOT_FOUND":
+		metrics.RecordNotFound(ctx, event)
+	default:
+		metrics.RecordFailure(ctx, event, failure)
+	}
+}
+
+// metricsRecorder returns the recorder of the outcome of each element, which
+// does nothing if none is configured.
+func (f *logIngester) metricsRecorder() MetricsRecorder {
+	if f.metrics == nil {
+		return noopMetricsRecorder{}
+	}
+	return f.metrics
+}
+
+// enrichRepositoryMetadata populates the repository metadata of the artifact
+// record if enrichment is enabled. Failing to fetch the metadata only leaves
+// it empty, it does not fail the ingestion of the logs.
+func (f *logIngester) enrichRepositoryMetadata(ctx context.Context, event *EventRecord, artifact *ArtifactRecord) {
+	if f.repositoryMetadata == nil {
+		return
+	}
+
+	metadata, err := f.repositoryMetadata.get(ctx, event.OrganizationName, event.RepositoryName)
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to enrich artifact with repository metadata",
+			"error", err,
+			"delivery_id", event.DeliveryID,
+		)
+		return
+	}
+
+	artifact.RepositoryVisibility = metadata.Visibility
+	artifact.RepositoryLanguage = metadata.Language
+	artifact.RepositoryTopics = metadata.Topics
+}
+
+// enrichActorTeams populates the teams of the actor of the artifact record if
+// enrichment is enabled. An actor that is not a member of any team has no
+// teams. Failing to look up the teams, e.g. while rate limited, only leaves
+// them empty, it does not fail the ingestion of the logs.
+func (f *logIngester) enrichActorTeams(ctx context.Context, event *EventRecord, artifact *ArtifactRecord) {
+	if f.actorTeams == nil || event.GitHubActor == "" {
+		return
+	}
+
+	teams, err := f.actorTeams.get(ctx, event.OrganizationName, event.GitHubActor)
+	if err != nil {
+		logger := logging.FromContext(ctx)
+		if errors.Is(err, errActorTeamsRateLimited) {
+			logger.WarnContext(ctx, "skipped enriching artifact with actor teams",
+				"error", err,
+				"delivery_id", event.DeliveryID,
+			)
+			return
+		}
+		logger.ErrorContext(ctx, "failed to enrich artifact with actor teams",
+			"error", err,
+			"delivery_id", event.DeliveryID,
+		)
+		return
+	}
+
+	artifact.GitHubActorTeams = teams
+}
+
+// objectScheme returns the URI scheme of the bucket the logs are written to.
+func (f *logIngester) objectScheme() string {
+	if f.scheme == "" {
+		return schemeGCS
+	}
+	return f.scheme
+}
+
+// storageName returns the human readable name of the storage backend.
+func (f *logIngester) storageName() string {
+	if f.objectScheme() == schemeS3 {
+		return "S3"
+	}
+	return "GCS"
+}
+
+// InstallationPermissions are the permissions requested for the access tokens
+// of the GitHub App installation, the app must be granted at least these
+// permissions.
+var InstallationPermissions = map[string]string{
+	"actions":       "read",
+	"pull_requests": "write",
+}
+
+// DownloadPermissions are the permissions requested for the access tokens
+// downloading logs when tokens are downscoped. The repository metadata is
+// readable with any token.
+var DownloadPermissions = map[string]string{
+	"actions": "read",
+}
+
+// CommentPermissions are the permissions requested for the access tokens
+// commenting on pull requests when tokens are downscoped.
+var CommentPermissions = map[string]string{
+	"pull_requests": "write",
+}
+
+// ActorTeamsPermissions are the additional permissions requested for the
+// access tokens looking up the teams of the actors of workflow runs.
+var ActorTeamsPermissions = map[string]string{
+	"members": "read",
+}
+
+// tokenPermissions returns the permissions requested for each access token of
+// the installation. Downscoped tokens are minted and cached separately for
+// each operation, so that the token downloading logs can't write anything. The
+// teams of the actors are looked up with the first token.
+func tokenPermissions(cfg *Config) []map[string]string {
+	permissions := []map[string]string{InstallationPermissions}
+	if cfg.DownscopeTokens {
+		permissions = []map[string]string{DownloadPermissions, CommentPermissions}
+	}
+	if cfg.EnrichActorTeams {
+		permissions[0] = maps.Clone(permissions[0])
+		maps.Copy(permissions[0], ActorTeamsPermissions)
+	}
+	return permissions
+}
+
+// RequiredPermissions returns the permissions the GitHub App installation
+// must be granted to run the pipeline with the given configuration.
+func RequiredPermissions(cfg *Config) map[string]string {
+	required := make(map[string]string)
+	for _, permissions := range tokenPermissions(cfg) {
+		maps.Copy(required, permissions)
+	}
+	return required
+}
+
+// newObjectWriter creates the object store for the backend of the bucket with
+// the given scheme.
+func newObjectWriter(ctx context.Context, cfg *Config, scheme string) (ObjectWriter, error) {
+	switch scheme {
+	case schemeS3:
+		store, err := NewS3ObjectStore(ctx, cfg.S3Endpoint, cfg.S3Region)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create s3 object store client: %w", err)
+		}
+		return store, nil
+	default:
+		store, err := NewObjectStore(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create object store client: %w", err)
+		}
+		return newCollisionDetectingWriter(store, CollisionPolicy(cfg.ObjectCollisionPolicy), cfg.MaxBufferSize), nil
+	}
+}
+
+// installationTokenSources returns a source of access tokens of the GitHub
+// App installation for each of the given permissions, authenticating as the
+// app with either its private key or a Cloud KMS key holding it. Each source
+// caches its own tokens, which are requested with httpClient.
+func installationTokenSources(ctx context.Context, cfg *Config, httpClient *http.Client, permissions []map[string]string) ([]oauth2.TokenSource, error) {
+	if cfg.GitHubPrivateKeyKMSKeyID != "" {
+		sources, err := newKMSInstallationTokenSources(ctx, cfg.GitHubAppID, cfg.GitHubInstallID, cfg.GitHubPrivateKeyKMSKeyID, permissions, httpClient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create github app token source: %w", err)
+		}
+		return sources, nil
+	}
+
+	app, err := githubauth.NewApp(cfg.GitHubAppID, cfg.GitHubPrivateKeySecret, githubauth.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create github app: %w", err)
+	}
+
+	installation, err := app.InstallationForID(ctx, cfg.GitHubInstallID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get github app installation: %w", err)
+	}
+
+	sources := make([]oauth2.TokenSource, 0, len(permissions))
+	for _, p := range permissions {
+		sources = append(sources, installation.AllReposOAuth2TokenSource(ctx, p))
+	}
+	return sources, nil
+}
+
 // handleMessage is the main event processor. It generates a GitHub token, reads the workflow
-// log files if they exist and persists them to Cloud Storage.
-func (f *logIngester) handleMessage(ctx context.Context, ghLogsURL, gcsPath string) error {
+// log files if they exist and persists them to Cloud Storage. It returns the
+// location the logs were written to and the number of bytes read from GitHub.
+func (f *logIngester) handleMessage(ctx context.Context, ghLogsURL, gcsPath string) (string, int64, error) {
 	req, err := f.ghClient.NewRequest(http.MethodGet, ghLogsURL, nil)
 	if err != nil {
-		return fmt.Errorf("error creating GitHub request GET %s: %w", ghLogsURL, err)
+		return "", 0, fmt.Errorf("error creating GitHub request GET %s: %w", ghLogsURL, err)
 	}
 	res, err := f.ghClient.BareDo(ctx, req)
 	if err != nil {
 		if res == nil {
-			return fmt.Errorf("error executing GitHub request GET %s: %w", ghLogsURL, err)
+			return "", 0, fmt.Errorf("error executing GitHub request GET %s: %w", ghLogsURL, err)
 		}
 		// Check for not found conditions. This signals that the logs have expired
 		// and there is nothing that can be done about it.
 		if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone {
-			return errLogsExpired
+			return "", 0, errLogsExpired
 		}
 
 		content, readErr := io.ReadAll(io.LimitReader(res.Body, 256_000))
 		if readErr != nil {
-			return fmt.Errorf("error response from GitHub - failed to read response body: %w", err)
+			return "", 0, fmt.Errorf("error response from GitHub - failed to read response body: %w", err)
 		}
-		return fmt.Errorf("error response from GitHub - response body: %q - error: %w", string(content), err)
+		return "", 0, fmt.Errorf("error response from GitHub - response body: %q - error: %w", string(content), err)
 	}
 
-	if err := f.storage.Write(ctx, res.Body, gcsPath); err != nil {
-		return fmt.Errorf("error copying logs to cloud storage: %w", err)
+	body := &countingReader{r: res.Body}
+	logsURI, err := f.storage.Write(ctx, body, gcsPath)
+	if err != nil {
+		return "", 0, fmt.Errorf("error copying logs to cloud storage: %w", err)
 	}
 
-	return nil
+	return logsURI, body.n.Load(), nil
 }
 
 func (f *logIngester) commentArtifactOnPRs(ctx context.Context, event *EventRecord, artifact *ArtifactRecord, artifactURL string) error {
 	logger := logging.FromContext(ctx)
 
+	if f.disableComments {
+		logger.InfoContext(ctx, "skipping PR comment, PR comments are disabled",
+			"delivery_id", event.DeliveryID,
+		)
+		return nil
+	}
+
 	if artifact.Status != "SUCCESS" {
 		logger.InfoContext(
 			ctx,
@@ -214,25 +749,195 @@ func (f *logIngester) commentArtifactOnPRs(ctx context.Context, event *EventReco
 		return nil
 	}
 
+	tmpl := f.commentTemplate
+	if tmpl == nil {
+		tmpl = defaultCommentTemplate
+	}
+	comment, err := renderComment(tmpl, &CommentData{
+		Event:       event,
+		Artifact:    artifact,
+		ArtifactURL: artifactURL,
+		StorageName: f.storageName(),
+	})
+	if err != nil {
+		return err
+	}
+	marker := commentMarker(event)
+
+	// Every pull request is attempted even if commenting on another one failed,
+	// the errors are reported together once all were attempted.
+	var errs []error
 	for _, prNumberStr := range event.PullRequestNumbers {
-		comment := fmt.Sprintf("Logs for workflow run [%s](%s) attempt %s uploaded to GCS [here](%s)", event.WorkflowRunID, event.WorkflowURL, event.WorkflowRunAttempt, artifactURL)
 		prNumber, err := strconv.Atoi(prNumberStr)
 		if err != nil {
-			return fmt.Errorf("error parsing pr number from event payload: %w", err)
+			errs = append(errs, fmt.Errorf("error parsing pr number from event payload: %w", err))
+			continue
 		}
-		_, resp, err := f.ghClient.Issues.CreateComment(ctx, event.OrganizationName, event.RepositoryName, prNumber, &github.IssueComment{
-			Body: github.String(comment),
-		})
+
+		commented, err := f.hasMarkedComment(ctx, event, prNumber, marker)
 		if err != nil {
-			return fmt.Errorf("error commenting artifact on pull request: %w", err)
+			errs = append(errs, fmt.Errorf("pull request %d: %w", prNumber, err))
+			continue
 		}
-		if resp.StatusCode != http.StatusCreated {
-			content, err := io.ReadAll(io.LimitReader(resp.Body, 256_000))
-			if err != nil {
-				return fmt.Errorf("unexpected response status %s for commenting artifact on pull request - failed to read response body: %w", resp.Status, err)
-			}
-			return fmt.Errorf("unexpected response status %s for commenting artifact on pull request: %q", resp.Status, string(content))
+		if commented {
+			logger.InfoContext(ctx, "skipping PR comment already posted for workflow run attempt",
+				"delivery_id", event.DeliveryID,
+				"pull_request_number", prNumber,
+				"workflow_run_id", event.WorkflowRunID,
+				"workflow_run_attempt", event.WorkflowRunAttempt,
+			)
+			continue
+		}
+
+		if err := f.createCommentWithRetry(ctx, event, prNumber, comment); err != nil {
+			errs = append(errs, fmt.Errorf("pull request %d: %w", prNumber, err))
+		}
+	}
+
+	switch {
+	case len(errs) == 0:
+		return nil
+	case len(errs) < len(event.PullRequestNumbers):
+		return fmt.Errorf("%w (%d of %d): %w", errCommentsPartiallyFailed, len(errs), len(event.PullRequestNumbers), errors.Join(errs...))
+	default:
+		return errors.Join(errs...)
+	}
+}
+
+// createCommentWithRetry posts the comment on the pull request. Comments that
+// failed with a 5xx response are retried with an exponential backoff and rate
+// limited comments once the rate limit resets, up to commentMaxRetries times.
+// Other errors, e.g. 4xx responses, are not retried.
+func (f *logIngester) createCommentWithRetry(ctx context.Context, event *EventRecord, prNumber int, comment string) error {
+	logger := logging.FromContext(ctx)
+
+	backoff := f.commentRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := f.createComment(ctx, event, prNumber, comment)
+		if err == nil {
+			return nil
+		}
+
+		delay, ok := commentRetryDelay(err, backoff)
+		if !ok || attempt > f.commentMaxRetries {
+			return err
+		}
+		logger.WarnContext(ctx, "failed to comment artifact on pull request, retrying",
+			"delivery_id", event.DeliveryID,
+			"pull_request_number", prNumber,
+			"attempt", attempt,
+			"delay", delay.String(),
+			"error", err,
+		)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (gave up retrying: %w)", err, ctx.Err())
+		case <-time.After(delay):
+		}
+		backoff *= 2
+	}
+}
+
+// createComment posts the comment on the pull request once, once the comment
+// limiter allows it.
+func (f *logIngester) createComment(ctx context.Context, event *EventRecord, prNumber int, comment string) error {
+	if f.commentLimiter != nil {
+		if err := f.commentLimiter.Wait(ctx); err != nil {
+			return fmt.Errorf("failed to wait for comment rate limit: %w", err)
 		}
 	}
+
+	_, resp, err := f.commentClient().Issues.CreateComment(ctx, event.OrganizationName, event.RepositoryName, prNumber, &github.IssueComment{
+		Body: github.String(comment),
+	})
+	if err != nil {
+		return fmt.Errorf("error commenting artifact on pull request: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		content, err := io.ReadAll(io.LimitReader(resp.Body, 256_000))
+		if err != nil {
+			return fmt.Errorf("unexpected response status %s for commenting artifact on pull request - failed to read response body: %w", resp.Status, err)
+		}
+		return fmt.Errorf("unexpected response status %s for commenting artifact on pull request: %q", resp.Status, string(content))
+	}
 	return nil
 }
+
+// commentRetryDelay returns how long to wait before retrying a comment that
+// failed with err, and false if it is not worth retrying. Rate limited
+// comments, including 403 and 429 responses with a Retry-After header, are
+// retried after the time GitHub asks for, 5xx responses after the backoff.
+func commentRetryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if retryAfter := abuseErr.GetRetryAfter(); retryAfter > 0 {
+			return retryAfter, true
+		}
+		return backoff, true
+	}
+
+	var rateLimitErr *github.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		if untilReset := time.Until(rateLimitErr.Rate.Reset.Time); untilReset > 0 {
+			return untilReset, true
+		}
+		return backoff, true
+	}
+
+	var errResp *github.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil {
+		switch code := errResp.Response.StatusCode; {
+		case code == http.StatusTooManyRequests, code == http.StatusForbidden:
+			// a 403 without Retry-After is a missing permission, not a rate limit
+			if retryAfter, ok := parseRetryAfter(errResp.Response.Header, time.Now()); ok {
+				return retryAfter, true
+			}
+			if code == http.StatusTooManyRequests {
+				return backoff, true
+			}
+		case code >= http.StatusInternalServerError:
+			return backoff, true
+		}
+	}
+	return 0, false
+}
+
+// parseRetryAfter returns the delay requested by the Retry-After header, in
+// seconds or as an HTTP date relative to now, and false if there is none.
+func parseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(0, at.Sub(now)), true
+	}
+	return 0, false
+}
+
+// hasMarkedComment reports whether the pull request already has a comment
+// containing the given marker.
+func (f *logIngester) hasMarkedComment(ctx context.Context, event *EventRecord, prNumber int, marker string) (bool, error) {
+	opts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		comments, resp, err := f.commentClient().Issues.ListComments(ctx, event.OrganizationName, event.RepositoryName, prNumber, opts)
+		if err != nil {
+			return false, fmt.Errorf("error listing comments on pull request: %w", err)
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.GetBody(), marker) {
+				return true, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return false, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -19,17 +19,24 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-github/v61/github"
 	"golang.org/x/oauth2"
+	"golang.org/x/time/rate"
 
 	"github.com/abcxyz/pkg/githubauth"
 	"github.com/abcxyz/pkg/pointer"
@@ -100,7 +107,7 @@ func TestPipeline_handleMessage(t *testing.T) {
 			name:       "object_write_bad_url",
 			bucketName: "test",
 			gcsPath:    "HOT GARBAGE",
-			wantErr:    "error copying logs to cloud storage: malformed gcs url: invalid uri: [HOT GARBAGE]",
+			wantErr:    "error copying logs to cloud storage: malformed object url: invalid uri: [HOT GARBAGE]",
 		},
 		{
 			name:       "object_write_failure",
@@ -211,7 +218,7 @@ func TestPipeline_handleMessage(t *testing.T) {
 				ghClient:   ghClient,
 			}
 
-			err = ingest.handleMessage(ctx, fmt.Sprintf("%s/%s", fakeGitHub.URL, "test/repo/logs"), tc.gcsPath)
+			_, _, err = ingest.handleMessage(ctx, fmt.Sprintf("%s/%s", fakeGitHub.URL, "test/repo/logs"), tc.gcsPath)
 			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
 				t.Errorf("Process(%+v) got unexpected err: %s", tc.name, diff)
 			}
@@ -223,6 +230,387 @@ func TestPipeline_handleMessage(t *testing.T) {
 	}
 }
 
+func TestPipeline_ProcessElement_Attempts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cases := []struct {
+		name         string
+		attempts     int
+		logsStatus   int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{
+			name:         "first_attempt_fails",
+			attempts:     0,
+			logsStatus:   http.StatusInternalServerError,
+			wantStatus:   "FAILURE",
+			wantAttempts: 1,
+		},
+		{
+			name:         "retry_fails_again",
+			attempts:     3,
+			logsStatus:   http.StatusInternalServerError,
+			wantStatus:   "FAILURE",
+			wantAttempts: 4,
+		},
+		{
+			name:         "retry_succeeds",
+			attempts:     2,
+			logsStatus:   http.StatusOK,
+			wantStatus:   "SUCCESS",
+			wantAttempts: 3,
+		},
+		{
+			name:         "logs_expired",
+			attempts:     1,
+			logsStatus:   http.StatusNotFound,
+			wantStatus:   "NOT_FOUND",
+			wantAttempts: 2,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			fakeGitHub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.logsStatus)
+				fmt.Fprintf(w, "logs")
+			}))
+			t.Cleanup(fakeGitHub.Close)
+
+			ingest := logIngester{
+				bucketName: "test",
+				storage:    &testObjectWriter{},
+				ghClient:   github.NewClient(fakeGitHub.Client()),
+			}
+
+			got := ingest.ProcessElement(ctx, EventRecord{
+				DeliveryID:     "delivery",
+				RepositorySlug: "org/repo",
+				LogsURL:        fakeGitHub.URL + "/logs",
+				Attempts:       tc.attempts,
+			})
+			if got.Status != tc.wantStatus {
+				t.Errorf("ProcessElement got status %q, want %q", got.Status, tc.wantStatus)
+			}
+			if got.Attempts != tc.wantAttempts {
+				t.Errorf("ProcessElement got attempts %d, want %d", got.Attempts, tc.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestPipeline_ProcessElement_Conclusion(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cases := []struct {
+		name       string
+		conclusion string
+		logsStatus int
+		wantStatus string
+	}{
+		{
+			name:       "success",
+			conclusion: "success",
+			logsStatus: http.StatusOK,
+			wantStatus: "SUCCESS",
+		},
+		{
+			name:       "failed_run",
+			conclusion: "failure",
+			logsStatus: http.StatusOK,
+			wantStatus: "SUCCESS",
+		},
+		{
+			name:       "cancelled_run_logs_expired",
+			conclusion: "cancelled",
+			logsStatus: http.StatusNotFound,
+			wantStatus: "NOT_FOUND",
+		},
+		{
+			name:       "ingestion_failure",
+			conclusion: "success",
+			logsStatus: http.StatusInternalServerError,
+			wantStatus: "FAILURE",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			fakeGitHub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.logsStatus)
+				fmt.Fprintf(w, "logs")
+			}))
+			t.Cleanup(fakeGitHub.Close)
+
+			ingest := logIngester{
+				bucketName: "test",
+				storage:    &testObjectWriter{},
+				ghClient:   github.NewClient(fakeGitHub.Client()),
+			}
+
+			got := ingest.ProcessElement(ctx, EventRecord{
+				DeliveryID:     "delivery",
+				RepositorySlug: "org/repo",
+				LogsURL:        fakeGitHub.URL + "/logs",
+				Conclusion:     tc.conclusion,
+			})
+			if got.Status != tc.wantStatus {
+				t.Errorf("ProcessElement got status %q, want %q", got.Status, tc.wantStatus)
+			}
+			if got.Conclusion != tc.conclusion {
+				t.Errorf("ProcessElement got conclusion %q, want %q", got.Conclusion, tc.conclusion)
+			}
+		})
+	}
+}
+
+func TestPipeline_ProcessElement_PartialComments(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cases := []struct {
+		name          string
+		failingPRs    map[string]int
+		wantStatus    string
+		wantCommented []string
+	}{
+		{
+			name:          "all_commented",
+			wantStatus:    "SUCCESS",
+			wantCommented: []string{"455", "456", "457"},
+		},
+		{
+			name:          "middle_fails",
+			failingPRs:    map[string]int{"456": http.StatusUnauthorized},
+			wantStatus:    "PARTIAL_SUCCESS",
+			wantCommented: []string{"455", "457"},
+		},
+		{
+			name: "all_fail",
+			failingPRs: map[string]int{
+				"455": http.StatusUnauthorized,
+				"456": http.StatusUnauthorized,
+				"457": http.StatusUnprocessableEntity,
+			},
+			wantStatus: "FAILURE",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			var attempted, commented []string
+			mux := http.NewServeMux()
+			mux.Handle("GET /logs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "logs")
+			}))
+			mux.Handle("GET /api/v3/repos/testorg/testrepo/issues/{number}/comments", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `[]`)
+			}))
+			mux.Handle("POST /api/v3/repos/testorg/testrepo/issues/{number}/comments", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				number := r.PathValue("number")
+				mu.Lock()
+				defer mu.Unlock()
+				attempted = append(attempted, number)
+				if status, ok := tc.failingPRs[number]; ok {
+					w.WriteHeader(status)
+					return
+				}
+				commented = append(commented, number)
+				w.WriteHeader(http.StatusCreated)
+			}))
+			fakeGitHub := httptest.NewServer(mux)
+			t.Cleanup(fakeGitHub.Close)
+
+			ghClient, err := github.NewClient(nil).WithEnterpriseURLs(fakeGitHub.URL, fakeGitHub.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ingest := logIngester{
+				bucketName: "test",
+				storage:    &testObjectWriter{},
+				ghClient:   ghClient,
+			}
+
+			got := ingest.ProcessElement(ctx, EventRecord{
+				DeliveryID:         "delivery",
+				RepositorySlug:     "testorg/testrepo",
+				RepositoryName:     "testrepo",
+				OrganizationName:   "testorg",
+				LogsURL:            fakeGitHub.URL + "/logs",
+				WorkflowRunID:      "987",
+				WorkflowRunAttempt: "1",
+				PullRequestNumbers: []string{"455", "456", "457"},
+			})
+			if got.Status != tc.wantStatus {
+				t.Errorf("ProcessElement got status %q, want %q", got.Status, tc.wantStatus)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if diff := cmp.Diff(attempted, []string{"455", "456", "457"}); diff != "" {
+				t.Errorf("attempted pull requests (-got,+want):\n%s", diff)
+			}
+			if diff := cmp.Diff(commented, tc.wantCommented); diff != "" {
+				t.Errorf("commented pull requests (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPipeline_ProcessElement_CommentsDisabled(t *testing.T) {
+	t.Parallel()
+
+	var commentRequestCount atomic.Int32
+	mux := http.NewServeMux()
+	mux.Handle("GET /logs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "logs")
+	}))
+	mux.Handle("/api/v3/repos/testorg/testrepo/issues/{number}/comments", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commentRequestCount.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	fakeGitHub := httptest.NewServer(mux)
+	t.Cleanup(fakeGitHub.Close)
+
+	ghClient, err := github.NewClient(nil).WithEnterpriseURLs(fakeGitHub.URL, fakeGitHub.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ingest := logIngester{
+		bucketName:      "test",
+		storage:         &testObjectWriter{},
+		ghClient:        ghClient,
+		disableComments: true,
+	}
+
+	got := ingest.ProcessElement(context.Background(), EventRecord{
+		DeliveryID:         "delivery",
+		RepositorySlug:     "testorg/testrepo",
+		RepositoryName:     "testrepo",
+		OrganizationName:   "testorg",
+		LogsURL:            fakeGitHub.URL + "/logs",
+		WorkflowRunID:      "987",
+		WorkflowRunAttempt: "1",
+		PullRequestNumbers: []string{"455", "456"},
+	})
+	if got, want := got.Status, "SUCCESS"; got != want {
+		t.Errorf("ProcessElement got status %q, want %q", got, want)
+	}
+	if got.LogsURI == "" {
+		t.Errorf("ProcessElement expected the logs to be archived")
+	}
+	if got := commentRequestCount.Load(); got != 0 {
+		t.Errorf("expected no comment API calls, got %d", got)
+	}
+}
+
+func TestPipeline_ProcessElement_Timeout(t *testing.T) {
+	t.Parallel()
+
+	fakeGitHub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "logs")
+	}))
+	t.Cleanup(fakeGitHub.Close)
+
+	// The writer hangs until its context is done, like a stuck storage call.
+	var writeErr error
+	ingest := logIngester{
+		bucketName: "test",
+		storage: &testObjectWriter{
+			writerFunc: func(ctx context.Context, r io.Reader, descriptor string) error {
+				<-ctx.Done()
+				writeErr = ctx.Err()
+				return writeErr
+			},
+		},
+		ghClient:       github.NewClient(fakeGitHub.Client()),
+		elementTimeout: 50 * time.Millisecond,
+	}
+
+	start := time.Now()
+	got := ingest.ProcessElement(context.Background(), EventRecord{
+		DeliveryID:     "delivery",
+		RepositorySlug: "org/repo",
+		LogsURL:        fakeGitHub.URL + "/logs",
+	})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ProcessElement took %s, expected the element timeout to stop it", elapsed)
+	}
+	if !errors.Is(writeErr, context.DeadlineExceeded) {
+		t.Errorf("expected the write to be stopped by the deadline, got %v", writeErr)
+	}
+	if got, want := got.Status, "FAILURE"; got != want {
+		t.Errorf("ProcessElement got status %q, want %q", got, want)
+	}
+}
+
+func TestPipeline_ProcessElement_Panic(t *testing.T) {
+	t.Parallel()
+
+	fakeGitHub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "logs")
+	}))
+	t.Cleanup(fakeGitHub.Close)
+
+	// The writer panics like processing a malformed event would.
+	metrics := &recordingMetricsRecorder{}
+	ingest := logIngester{
+		bucketName: "test",
+		storage: &testObjectWriter{
+			writerFunc: func(ctx context.Context, r io.Reader, descriptor string) error {
+				var event *EventRecord
+				_ = event.DeliveryID
+				return nil
+			},
+		},
+		ghClient: github.NewClient(fakeGitHub.Client()),
+		metrics:  metrics,
+	}
+
+	got := ingest.ProcessElement(context.Background(), EventRecord{
+		DeliveryID:     "delivery",
+		RepositorySlug: "org/repo",
+		LogsURL:        fakeGitHub.URL + "/logs",
+		Attempts:       1,
+	})
+	if got, want := got.Status, "FAILURE"; got != want {
+		t.Errorf("ProcessElement got status %q, want %q", got, want)
+	}
+	if got, want := got.DeliveryID, "delivery"; got != want {
+		t.Errorf("ProcessElement got delivery id %q, want %q", got, want)
+	}
+	if got, want := got.Attempts, 2; got != want {
+		t.Errorf("ProcessElement got attempts %d, want %d", got, want)
+	}
+	if want := "panic processing element: runtime error: invalid memory address or nil pointer dereference"; got.Error != want {
+		t.Errorf("ProcessElement got error %q, want %q", got.Error, want)
+	}
+	if diff := cmp.Diff(metrics.failures, []string{"delivery: " + got.Error}); diff != "" {
+		t.Errorf("failed elements (-got,+want):\n%s", diff)
+	}
+}
+
 func TestPipeline_commentArtifactOnPRs(t *testing.T) {
 	t.Parallel()
 
@@ -235,8 +623,11 @@ func TestPipeline_commentArtifactOnPRs(t *testing.T) {
 		artifactStatus        string
 		tokenHandler          http.HandlerFunc
 		commentResponseStatus *int
+		commentTemplate       string
+		existingComments      string
 		wantErr               string
 		expectedCommentCount  int
+		expectedCommentBody   string
 	}{
 		{
 			name:       "success",
@@ -255,6 +646,73 @@ func TestPipeline_commentArtifactOnPRs(t *testing.T) {
 			},
 			artifactStatus:       "SUCCESS",
 			expectedCommentCount: 1,
+			expectedCommentBody: "Logs for workflow run [987](https://api.github.com/repos/testorg/testrepo/actions/runs/987) attempt 1 uploaded to GCS [here](testurl)" +
+				"\n\n<!-- github-metrics-aggregator workflow_run_id=987 workflow_run_attempt=1 -->",
+		},
+		{
+			name:       "skip-already-commented",
+			bucketName: "test",
+			event: EventRecord{
+				DeliveryID:         "123",
+				RepositorySlug:     "testorg/testrepo",
+				RepositoryName:     "testrepo",
+				OrganizationName:   "testorg",
+				LogsURL:            "https://api.github.com/repos/testorg/testrepo/actions/runs/987/logs",
+				GitHubActor:        "user",
+				WorkflowURL:        "https://api.github.com/repos/testorg/testrepo/actions/runs/987",
+				WorkflowRunID:      "987",
+				WorkflowRunAttempt: "1",
+				PullRequestNumbers: []string{"456"},
+			},
+			artifactStatus: "SUCCESS",
+			existingComments: `[
+				{"body": "LGTM"},
+				{"body": "Logs for workflow run 987 attempt 1\n\n<!-- github-metrics-aggregator workflow_run_id=987 workflow_run_attempt=1 -->"}
+			]`,
+			expectedCommentCount: 0,
+		},
+		{
+			name:       "comment-new-attempt",
+			bucketName: "test",
+			event: EventRecord{
+				DeliveryID:         "123",
+				RepositorySlug:     "testorg/testrepo",
+				RepositoryName:     "testrepo",
+				OrganizationName:   "testorg",
+				LogsURL:            "https://api.github.com/repos/testorg/testrepo/actions/runs/987/logs",
+				GitHubActor:        "user",
+				WorkflowURL:        "https://api.github.com/repos/testorg/testrepo/actions/runs/987",
+				WorkflowRunID:      "987",
+				WorkflowRunAttempt: "2",
+				PullRequestNumbers: []string{"456"},
+			},
+			artifactStatus:       "SUCCESS",
+			existingComments:     `[{"body": "Logs for workflow run 987 attempt 1\n\n<!-- github-metrics-aggregator workflow_run_id=987 workflow_run_attempt=1 -->"}]`,
+			expectedCommentCount: 1,
+			expectedCommentBody: "Logs for workflow run [987](https://api.github.com/repos/testorg/testrepo/actions/runs/987) attempt 2 uploaded to GCS [here](testurl)" +
+				"\n\n<!-- github-metrics-aggregator workflow_run_id=987 workflow_run_attempt=2 -->",
+		},
+		{
+			name:       "custom-template",
+			bucketName: "test",
+			event: EventRecord{
+				DeliveryID:         "123",
+				RepositorySlug:     "testorg/testrepo",
+				RepositoryName:     "testrepo",
+				OrganizationName:   "testorg",
+				LogsURL:            "https://api.github.com/repos/testorg/testrepo/actions/runs/987/logs",
+				GitHubActor:        "user",
+				WorkflowURL:        "https://api.github.com/repos/testorg/testrepo/actions/runs/987",
+				WorkflowRunID:      "987",
+				WorkflowRunAttempt: "1",
+				PullRequestNumbers: []string{"456"},
+			},
+			artifactStatus: "SUCCESS",
+			commentTemplate: "Run {{ .Event.WorkflowRunID }} of @{{ .Event.GitHubActor }} ({{ .Artifact.JobName }}): " +
+				"[logs]({{ .ArtifactURL }}) in {{ .StorageName }}, see https://dashboards.example.com/{{ .Artifact.RepositorySlug }}",
+			expectedCommentCount: 1,
+			expectedCommentBody: "Run 987 of @user (testjob): [logs](testurl) in GCS, see https://dashboards.example.com/testorg/testrepo" +
+				"\n\n<!-- github-metrics-aggregator workflow_run_id=987 workflow_run_attempt=1 -->",
 		},
 		{
 			name:       "skip-on-bad-artifact-status",
@@ -322,6 +780,7 @@ func TestPipeline_commentArtifactOnPRs(t *testing.T) {
 			t.Parallel()
 
 			commentRequestCount := 0
+			var commentBody string
 			fakeGitHub := func() *httptest.Server {
 				mux := http.NewServeMux()
 				mux.Handle("GET /app/installations/123", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -335,8 +794,20 @@ func TestPipeline_commentArtifactOnPRs(t *testing.T) {
 					w.WriteHeader(201)
 					fmt.Fprintf(w, `{"token": "this-is-the-token-from-github"}`)
 				}))
+				mux.Handle("GET /api/v3/repos/testorg/testrepo/issues/456/comments", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if tc.existingComments == "" {
+						fmt.Fprint(w, `[]`)
+						return
+					}
+					fmt.Fprint(w, tc.existingComments)
+				}))
 				mux.Handle("POST /api/v3/repos/testorg/testrepo/issues/456/comments", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					commentRequestCount += 1
+					var comment github.IssueComment
+					if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
+						t.Errorf("failed to decode comment: %v", err)
+					}
+					commentBody = comment.GetBody()
 					if tc.commentResponseStatus != nil {
 						w.WriteHeader(*tc.commentResponseStatus)
 					} else {
@@ -386,6 +857,12 @@ func TestPipeline_commentArtifactOnPRs(t *testing.T) {
 				bucketName: tc.bucketName,
 				ghClient:   ghClient,
 			}
+			if tc.commentTemplate != "" {
+				ingest.commentTemplate, err = parseCommentTemplate(tc.commentTemplate)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
 
 			artifact := ArtifactRecord{
 				DeliveryID:       tc.event.DeliveryID,
@@ -407,6 +884,586 @@ func TestPipeline_commentArtifactOnPRs(t *testing.T) {
 			if tc.expectedCommentCount != commentRequestCount {
 				t.Errorf("commentArtifactOnPRs(%+v) expected to make %d CommentPR API calls but instead made %d", tc.name, tc.expectedCommentCount, commentRequestCount)
 			}
+			if tc.expectedCommentBody != "" {
+				if diff := cmp.Diff(commentBody, tc.expectedCommentBody); diff != "" {
+					t.Errorf("commentArtifactOnPRs(%+v) unexpected comment body (-got,+want):\n%s", tc.name, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestPipeline_commentArtifactOnPRs_Retry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	secondaryRateLimit := func(w http.ResponseWriter) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "You have exceeded a secondary rate limit.", `+
+			`"documentation_url": "https://docs.github.com/rest/overview/rate-limits-for-the-rest-api#about-secondary-rate-limits"}`)
+	}
+
+	cases := []struct {
+		name                 string
+		maxRetries           int
+		responses            []func(w http.ResponseWriter)
+		wantErr              string
+		expectedCommentCount int
+		minElapsed           time.Duration
+	}{
+		{
+			name:       "server-error-retried",
+			maxRetries: 3,
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) },
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusCreated) },
+			},
+			expectedCommentCount: 2,
+		},
+		{
+			name:       "server-error-retries-exhausted",
+			maxRetries: 2,
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) },
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) },
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) },
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusCreated) },
+			},
+			expectedCommentCount: 3,
+			wantErr:              "502",
+		},
+		{
+			name:       "client-error-not-retried",
+			maxRetries: 3,
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusUnprocessableEntity) },
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusCreated) },
+			},
+			expectedCommentCount: 1,
+			wantErr:              "422",
+		},
+		{
+			name:       "rate-limit-retried-after-retry-after",
+			maxRetries: 3,
+			responses: []func(w http.ResponseWriter){
+				secondaryRateLimit,
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusCreated) },
+			},
+			expectedCommentCount: 2,
+			minElapsed:           time.Second,
+		},
+		{
+			name:       "too-many-requests-retried-after-retry-after",
+			maxRetries: 3,
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.Header().Set("Retry-After", "1")
+					w.WriteHeader(http.StatusTooManyRequests)
+				},
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusCreated) },
+			},
+			expectedCommentCount: 2,
+			minElapsed:           time.Second,
+		},
+		{
+			name:       "forbidden-without-retry-after-not-retried",
+			maxRetries: 3,
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.WriteHeader(http.StatusForbidden)
+					fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+				},
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusCreated) },
+			},
+			expectedCommentCount: 1,
+			wantErr:              "403",
+		},
+		{
+			name:       "retries-disabled",
+			maxRetries: 0,
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) },
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusCreated) },
+			},
+			expectedCommentCount: 1,
+			wantErr:              "500",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var commentRequestCount int
+			mux := http.NewServeMux()
+			mux.Handle("GET /api/v3/repos/testorg/testrepo/issues/456/comments", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `[]`)
+			}))
+			mux.Handle("POST /api/v3/repos/testorg/testrepo/issues/456/comments", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				commentRequestCount++
+				tc.responses[commentRequestCount-1](w)
+			}))
+			fakeGitHub := httptest.NewServer(mux)
+			t.Cleanup(fakeGitHub.Close)
+
+			ghClient, err := github.NewClient(nil).WithEnterpriseURLs(fakeGitHub.URL, fakeGitHub.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ingest := logIngester{
+				bucketName:          "test",
+				ghClient:            ghClient,
+				commentMaxRetries:   tc.maxRetries,
+				commentRetryBackoff: time.Millisecond,
+			}
+
+			event := EventRecord{
+				DeliveryID:         "123",
+				RepositorySlug:     "testorg/testrepo",
+				RepositoryName:     "testrepo",
+				OrganizationName:   "testorg",
+				WorkflowURL:        "https://api.github.com/repos/testorg/testrepo/actions/runs/987",
+				WorkflowRunID:      "987",
+				WorkflowRunAttempt: "1",
+				PullRequestNumbers: []string{"456"},
+			}
+			artifact := ArtifactRecord{
+				DeliveryID: event.DeliveryID,
+				Status:     "SUCCESS",
+			}
+
+			start := time.Now()
+			err = ingest.commentArtifactOnPRs(ctx, &event, &artifact, "testurl")
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Errorf("commentArtifactOnPRs(%+v) got unexpected err: %s", tc.name, diff)
+			}
+			if tc.expectedCommentCount != commentRequestCount {
+				t.Errorf("commentArtifactOnPRs(%+v) expected to make %d CommentPR API calls but instead made %d", tc.name, tc.expectedCommentCount, commentRequestCount)
+			}
+			if elapsed := time.Since(start); elapsed < tc.minElapsed {
+				t.Errorf("commentArtifactOnPRs(%+v) retried after %s, expected to wait at least %s", tc.name, elapsed, tc.minElapsed)
+			}
+		})
+	}
+}
+
+func TestPipeline_commentArtifactOnPRs_Paced(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var commentTimes []time.Time
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v3/repos/testorg/testrepo/issues/{number}/comments", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	}))
+	mux.Handle("POST /api/v3/repos/testorg/testrepo/issues/{number}/comments", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		commentTimes = append(commentTimes, time.Now())
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	fakeGitHub := httptest.NewServer(mux)
+	t.Cleanup(fakeGitHub.Close)
+
+	ghClient, err := github.NewClient(nil).WithEnterpriseURLs(fakeGitHub.URL, fakeGitHub.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 comments per second, one at a time
+	ingest := logIngester{
+		bucketName:     "test",
+		ghClient:       ghClient,
+		commentLimiter: rate.NewLimiter(10, 1),
+	}
+
+	// the limiter is shared by the comments of all elements
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, prs := range [][]string{{"1", "2"}, {"3", "4"}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			event := EventRecord{
+				DeliveryID:         "123",
+				RepositorySlug:     "testorg/testrepo",
+				RepositoryName:     "testrepo",
+				OrganizationName:   "testorg",
+				WorkflowRunID:      "987",
+				WorkflowRunAttempt: "1",
+				PullRequestNumbers: prs,
+			}
+			errs <- ingest.commentArtifactOnPRs(ctx, &event, &ArtifactRecord{Status: "SUCCESS"}, "testurl")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := len(commentTimes), 4; got != want {
+		t.Fatalf("expected %d comments, got %d", want, got)
+	}
+	// the first comment is posted right away, each of the others 100ms later
+	if elapsed, want := commentTimes[3].Sub(commentTimes[0]), 250*time.Millisecond; elapsed < want {
+		t.Errorf("expected comments to be paced over at least %s, took %s", want, elapsed)
+	}
+}
+
+// redirectTransport sends all requests to the target server, regardless of
+// their host.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t *redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	r.Host = ""
+	return http.DefaultTransport.RoundTrip(r) //nolint:wrapcheck // Want passthrough
+}
+
+func TestNewLogIngester_HTTPTimeout(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /app/installations/123", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_tokens_url": "https://api.github.com/app/installations/123/access_tokens"}`)
+	}))
+	mux.Handle("POST /app/installations/123/access_tokens", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"token": "this-is-the-token-from-github"}`)
+	}))
+	mux.Handle("GET /repos/testorg/testrepo/actions/runs/987/logs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// respond slower than the timeout of the client
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	fakeGitHub := httptest.NewServer(mux)
+	t.Cleanup(fakeGitHub.Close)
+
+	target, err := url.Parse(fakeGitHub.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testPrivateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeyPem := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(testPrivateKey),
+	})
+
+	cfg := &Config{
+		GitHubAppID:            "test-app-id",
+		GitHubInstallID:        "123",
+		GitHubPrivateKeySecret: string(privateKeyPem),
+		BucketName:             "s3://test",
+		S3Region:               "us-east-1",
+		HTTPTimeout:            50 * time.Millisecond,
+	}
+	ingest, err := NewLogIngester(ctx, cfg, nil, &LogIngesterOptions{
+		HTTPTransport: &redirectTransport{target: target},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, _, err = ingest.handleMessage(ctx, "https://api.github.com/repos/testorg/testrepo/actions/runs/987/logs", "s3://test/testorg/testrepo/123/artifacts.tar.gz")
+	if diff := testutil.DiffErrString(err, "Client.Timeout exceeded"); diff != "" {
+		t.Fatal(diff)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the request to time out after %s, took %s", cfg.HTTPTimeout, elapsed)
+	}
+}
+
+func TestNewLogIngester_DownscopedTokens(t *testing.T) {
+	t.Parallel()
+
+	testPrivateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeyPem := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(testPrivateKey),
+	}))
+
+	cases := []struct {
+		name                   string
+		downscope              bool
+		enrichActorTeams       bool
+		wantDownloadPermission map[string]string
+		wantCommentPermission  map[string]string
+		wantTokens             int
+	}{
+		{
+			name:                   "shared_token",
+			wantDownloadPermission: InstallationPermissions,
+			wantCommentPermission:  InstallationPermissions,
+			wantTokens:             1,
+		},
+		{
+			name:                   "downscoped",
+			downscope:              true,
+			wantDownloadPermission: map[string]string{"actions": "read"},
+			wantCommentPermission:  map[string]string{"pull_requests": "write"},
+			wantTokens:             2,
+		},
+		{
+			name:                   "shared_token_actor_teams",
+			enrichActorTeams:       true,
+			wantDownloadPermission: map[string]string{"actions": "read", "members": "read", "pull_requests": "write"},
+			wantCommentPermission:  map[string]string{"actions": "read", "members": "read", "pull_requests": "write"},
+			wantTokens:             1,
+		},
+		{
+			name:                   "downscoped_actor_teams",
+			downscope:              true,
+			enrichActorTeams:       true,
+			wantDownloadPermission: map[string]string{"actions": "read", "members": "read"},
+			wantCommentPermission:  map[string]string{"pull_requests": "write"},
+			wantTokens:             2,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			// each minted token is named after the order it was requested in,
+			// and keeps the permissions it was requested with
+			var mu sync.Mutex
+			tokenPermissions := make(map[string]map[string]string)
+			var downloadAuth, commentAuth string
+
+			mux := http.NewServeMux()
+			mux.Handle("GET /app/installations/123", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"access_tokens_url": "https://api.github.com/app/installations/123/access_tokens"}`)
+			}))
+			mux.Handle("POST /app/installations/123/access_tokens", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var request struct {
+					Permissions map[string]string `json:"permissions"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				mu.Lock()
+				token := fmt.Sprintf("token-%d", len(tokenPermissions))
+				tokenPermissions[token] = request.Permissions
+				mu.Unlock()
+
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprintf(w, `{"token": %q}`, token)
+			}))
+			mux.Handle("GET /repos/testorg/testrepo/actions/runs/987/logs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				downloadAuth = r.Header.Get("Authorization")
+				mu.Unlock()
+				fmt.Fprint(w, "logs")
+			}))
+			mux.Handle("POST /repos/testorg/testrepo/issues/1/comments", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				commentAuth = r.Header.Get("Authorization")
+				mu.Unlock()
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"id": 1}`)
+			}))
+			fakeGitHub := httptest.NewServer(mux)
+			t.Cleanup(fakeGitHub.Close)
+
+			target, err := url.Parse(fakeGitHub.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ingest, err := NewLogIngester(ctx, &Config{
+				GitHubAppID:            "test-app-id",
+				GitHubInstallID:        "123",
+				GitHubPrivateKeySecret: privateKeyPem,
+				BucketName:             "s3://test",
+				S3Region:               "us-east-1",
+				DownscopeTokens:        tc.downscope,
+				EnrichActorTeams:       tc.enrichActorTeams,
+			}, nil, &LogIngesterOptions{
+				HTTPTransport: &redirectTransport{target: target},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ingest.storage = &testObjectWriter{}
+
+			// each operation twice, so that cached tokens are reused
+			for i := 0; i < 2; i++ {
+				if _, _, err := ingest.handleMessage(ctx, "https://api.github.com/repos/testorg/testrepo/actions/runs/987/logs", "s3://test/testorg/testrepo/123/artifacts.tar.gz"); err != nil {
+					t.Fatal(err)
+				}
+				if _, _, err := ingest.commentClient().Issues.CreateComment(ctx, "testorg", "testrepo", 1, &github.IssueComment{
+					Body: github.String("comment"),
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if got, want := len(tokenPermissions), tc.wantTokens; got != want {
+				t.Errorf("expected %d tokens to be minted, got %d", want, got)
+			}
+			downloadPermissions := tokenPermissions[strings.TrimPrefix(downloadAuth, "Bearer ")]
+			if diff := cmp.Diff(downloadPermissions, tc.wantDownloadPermission); diff != "" {
+				t.Errorf("download token permissions (-got,+want):\n%s", diff)
+			}
+			if tc.downscope {
+				for permission, access := range downloadPermissions {
+					if access == "write" {
+						t.Errorf("expected download token to lack write scope, got %s:%s", permission, access)
+					}
+				}
+			}
+			commentPermissions := tokenPermissions[strings.TrimPrefix(commentAuth, "Bearer ")]
+			if diff := cmp.Diff(commentPermissions, tc.wantCommentPermission); diff != "" {
+				t.Errorf("comment token permissions (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewLogIngester_Init(t *testing.T) {
+	t.Parallel()
+
+	testPrivateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeyPem := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(testPrivateKey),
+	}))
+
+	cases := []struct {
+		name              string
+		concurrentInit    bool
+		privateKey        string
+		installationCode  int
+		wantInstallations int32
+		wantErr           string
+	}{
+		{
+			name:              "concurrent",
+			concurrentInit:    true,
+			privateKey:        privateKeyPem,
+			installationCode:  http.StatusOK,
+			wantInstallations: 1,
+		},
+		{
+			name:              "sequential",
+			privateKey:        privateKeyPem,
+			installationCode:  http.StatusOK,
+			wantInstallations: 1,
+		},
+		{
+			name:              "installation_error",
+			concurrentInit:    true,
+			privateKey:        privateKeyPem,
+			installationCode:  http.StatusInternalServerError,
+			wantInstallations: 1,
+			wantErr:           "failed to get github app installation",
+		},
+		{
+			name:           "invalid_private_key",
+			concurrentInit: true,
+			privateKey:     "not-a-private-key",
+			wantErr:        "failed to create github app",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			var installations atomic.Int32
+			mux := http.NewServeMux()
+			mux.Handle("GET /app/installations/123", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				installations.Add(1)
+				w.WriteHeader(tc.installationCode)
+				fmt.Fprint(w, `{"access_tokens_url": "https://api.github.com/app/installations/123/access_tokens"}`)
+			}))
+			fakeGitHub := httptest.NewServer(mux)
+			t.Cleanup(fakeGitHub.Close)
+
+			target, err := url.Parse(fakeGitHub.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := &Config{
+				GitHubAppID:            "test-app-id",
+				GitHubInstallID:        "123",
+				GitHubPrivateKeySecret: tc.privateKey,
+				BucketName:             "s3://test",
+				S3Region:               "us-east-1",
+				ConcurrentInit:         tc.concurrentInit,
+			}
+			ingest, err := NewLogIngester(ctx, cfg, nil, &LogIngesterOptions{
+				HTTPTransport: &redirectTransport{target: target},
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			if got, want := installations.Load(), tc.wantInstallations; got != want {
+				t.Errorf("expected %d installation lookups, got %d", want, got)
+			}
+
+			if err != nil {
+				if ingest != nil {
+					t.Errorf("expected no log ingester on error, got %#v", ingest)
+				}
+				return
+			}
+			if ingest.storage == nil {
+				t.Errorf("expected the object store to be initialized")
+			}
+			if ingest.ghClient == nil {
+				t.Errorf("expected the github client to be initialized")
+			}
+			if got, want := ingest.scheme, schemeS3; got != want {
+				t.Errorf("expected scheme %q, got %q", want, got)
+			}
 		})
 	}
 }
@@ -416,20 +1473,20 @@ type testObjectWriter struct {
 	gotArtifact string
 }
 
-func (w *testObjectWriter) Write(ctx context.Context, reader io.Reader, descriptor string) error {
+func (w *testObjectWriter) Write(ctx context.Context, reader io.Reader, descriptor string) (string, error) {
 	if w.writerFunc != nil {
-		return w.writerFunc(ctx, reader, descriptor)
+		return descriptor, w.writerFunc(ctx, reader, descriptor)
 	}
 	if reader == nil {
-		return fmt.Errorf("no reader provided")
+		return "", fmt.Errorf("no reader provided")
 	}
-	if _, _, _, err := parseGCSURI(descriptor); err != nil {
-		return fmt.Errorf("malformed gcs url: %w", err)
+	if _, _, _, _, err := parseObjectURI(descriptor); err != nil {
+		return "", fmt.Errorf("malformed object url: %w", err)
 	}
 	content, err := io.ReadAll(reader)
 	if err != nil {
-		return fmt.Errorf("read failed: %w", err)
+		return "", fmt.Errorf("read failed: %w", err)
 	}
 	w.gotArtifact = string(content)
-	return nil
+	return descriptor, nil
 }
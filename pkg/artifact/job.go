@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"time"
 
 	"github.com/abcxyz/github-metrics-aggregator/pkg/bq"
 	"github.com/abcxyz/github-metrics-aggregator/pkg/version"
@@ -26,8 +27,9 @@ import (
 )
 
 // ExecuteJob runs the ingestion pipeline job to read GitHub
-// action workflow logs from GitHub and store them into GCS.
-func ExecuteJob(ctx context.Context, cfg *Config) error {
+// action workflow logs from GitHub and store them into GCS. The outcome of
+// each event is recorded with the metrics recorder, if not nil.
+func ExecuteJob(ctx context.Context, cfg *Config, metrics MetricsRecorder) error {
 	logger := logging.FromContext(ctx)
 
 	bqClient, err := bq.NewBigQuery(ctx, cfg.ProjectID, cfg.DatasetID)
@@ -35,18 +37,29 @@ func ExecuteJob(ctx context.Context, cfg *Config) error {
 		return fmt.Errorf("failed to create bigquery client: %w", err)
 	}
 	defer bqClient.Close()
+	bqClient.AddMissingColumns = cfg.AddMissingColumns
+
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
 
 	// Create a pool of workers to manage all of the log ingestions
 	pool := workerpool.New[ArtifactRecord](&workerpool.Config{
-		Concurrency: int64(runtime.NumCPU()),
+		Concurrency: int64(concurrency),
 		StopOnError: false,
 	})
 
 	// Setup a log ingester to process ingestion events
-	logsFn, err := NewLogIngester(ctx, cfg.ProjectID, cfg.BucketName, cfg.GitHubAppID, cfg.GitHubInstallID, cfg.GitHubPrivateKeySecret)
+	logsFn, err := NewLogIngester(ctx, cfg, metrics, &LogIngesterOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create log ingester: %w", err)
 	}
+	defer func() {
+		if err := logsFn.Close(); err != nil {
+			logger.ErrorContext(ctx, "failed to close log ingester", "error", err)
+		}
+	}()
 
 	logger.InfoContext(ctx, "ingestion job starting",
 		"name", version.Name,
@@ -54,7 +67,7 @@ func ExecuteJob(ctx context.Context, cfg *Config) error {
 		"version", version.Version)
 
 	// Read up to `BatchSize` number of events that need to be processed
-	query, err := makeQuery(bqClient, cfg.EventsTableID, cfg.ArtifactsTableID, cfg.BatchSize)
+	query, err := makeQuery(bqClient, cfg.EventsTableID, cfg.ArtifactsTableID, cfg.BatchSize, cfg.MaxAttempts, cfg.MinEventAge, cfg.LookbackDays)
 	if err != nil {
 		return fmt.Errorf("failed to populate query template: %w", err)
 	}
@@ -63,6 +76,20 @@ func ExecuteJob(ctx context.Context, cfg *Config) error {
 		return fmt.Errorf("failed to query bigquery for events: %w", err)
 	}
 
+	if cfg.EmitProcessingLag {
+		lag := processingLag(events, time.Now())
+		logger.InfoContext(ctx, "processing lag",
+			"lag", lag.String(),
+			"lag_seconds", lag.Seconds())
+		logsFn.metricsRecorder().RecordProcessingLag(ctx, lag)
+	}
+
+	// Workers pick up events in the order they are submitted, interleave the
+	// repositories so that none of them occupies all workers
+	if cfg.FairScheduling {
+		events = roundRobinByRepository(events)
+	}
+
 	// Fan out the work of processing all of the events that were found
 	for _, event := range events {
 		if err := pool.Do(ctx, func() (ArtifactRecord, error) {
@@ -79,6 +106,11 @@ func ExecuteJob(ctx context.Context, cfg *Config) error {
 	if err != nil {
 		return fmt.Errorf("failed to ingest logs for events: %w", err)
 	}
+	if logsFn.rateBudgets != nil {
+		logger.InfoContext(ctx, "github requests per organization",
+			"requests", logsFn.rateBudgets.usage())
+	}
+
 	artifacts := make([]*ArtifactRecord, 0, len(results))
 	for _, v := range results {
 		artifacts = append(artifacts, &v.Value)
@@ -0,0 +1,89 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsRecorder records the outcome of each element processed by the
+// pipeline, e.g. to aggregate throughput and failure rates for dashboards.
+// Elements are processed concurrently, so implementations must be safe for
+// concurrent use.
+type MetricsRecorder interface {
+	// RecordProcessed records an element whose logs were ingested.
+	RecordProcessed(ctx context.Context, event *EventRecord)
+
+	// RecordFailure records an element that failed and is retried by later
+	// runs, along with the reason it failed.
+	RecordFailure(ctx context.Context, event *EventRecord, err error)
+
+	// RecordNotFound records an element whose logs have expired on GitHub.
+	RecordNotFound(ctx context.Context, event *EventRecord)
+
+	// RecordBytes records the size of the logs of an element read from GitHub,
+	// before they were compressed.
+	RecordBytes(ctx context.Context, event *EventRecord, n int64)
+
+	// RecordProcessingLag records the age of the oldest event that needs to be
+	// processed at the start of a run, which grows while the pipeline falls
+	// behind, until logs expire before they are ingested.
+	RecordProcessingLag(ctx context.Context, lag time.Duration)
+}
+
+// noopMetricsRecorder is the MetricsRecorder used when none is configured.
+type noopMetricsRecorder struct{}
+
+func (noopMetricsRecorder) RecordProcessed(context.Context, *EventRecord)      {}
+func (noopMetricsRecorder) RecordFailure(context.Context, *EventRecord, error) {}
+func (noopMetricsRecorder) RecordNotFound(context.Context, *EventRecord)       {}
+func (noopMetricsRecorder) RecordBytes(context.Context, *EventRecord, int64)   {}
+func (noopMetricsRecorder) RecordProcessingLag(context.Context, time.Duration) {}
+
+// processingLag returns the age at the given time of the oldest event that
+// needs to be processed, from the events selected by the driving query. The
+// lag is 0 if there are no events.
+func processingLag(events []*EventRecord, now time.Time) time.Duration {
+	var oldest time.Time
+	for _, event := range events {
+		if event.OldestReceived.IsZero() {
+			continue
+		}
+		if oldest.IsZero() || event.OldestReceived.Before(oldest) {
+			oldest = event.OldestReceived
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return max(0, now.Sub(oldest))
+}
+
+// countingReader counts the bytes read from the underlying reader. The count
+// may be read while another goroutine reads, e.g. when the content is
+// compressed through a pipe.
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err //nolint:wrapcheck // Want passthrough
+}
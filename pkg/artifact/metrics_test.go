@@ -0,0 +1,176 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v61/github"
+)
+
+// recordingMetricsRecorder records the delivery IDs of the elements per
+// outcome and the total bytes.
+type recordingMetricsRecorder struct {
+	mu        sync.Mutex
+	processed []string
+	failures  []string
+	notFound  []string
+	bytes     int64
+}
+
+func (r *recordingMetricsRecorder) RecordProcessed(ctx context.Context, event *EventRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.processed = append(r.processed, event.DeliveryID)
+}
+
+func (r *recordingMetricsRecorder) RecordFailure(ctx context.Context, event *EventRecord, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		err = fmt.Errorf("no reason")
+	}
+	r.failures = append(r.failures, fmt.Sprintf("%s: %v", event.DeliveryID, err))
+}
+
+func (r *recordingMetricsRecorder) RecordNotFound(ctx context.Context, event *EventRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notFound = append(r.notFound, event.DeliveryID)
+}
+
+func (r *recordingMetricsRecorder) RecordBytes(ctx context.Context, event *EventRecord, n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bytes += n
+}
+
+func (r *recordingMetricsRecorder) RecordProcessingLag(ctx context.Context, lag time.Duration) {}
+
+func TestPipeline_ProcessElement_Metrics(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /success/logs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "workflow logs")
+	})
+	mux.HandleFunc("GET /expired/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("GET /failure/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "internal error")
+	})
+	fakeGitHub := httptest.NewServer(mux)
+	t.Cleanup(fakeGitHub.Close)
+
+	metrics := &recordingMetricsRecorder{}
+	ingest := logIngester{
+		bucketName: "test",
+		storage:    &testObjectWriter{},
+		ghClient:   github.NewClient(fakeGitHub.Client()),
+		metrics:    metrics,
+	}
+
+	for _, event := range []EventRecord{
+		{DeliveryID: "success-1", LogsURL: fakeGitHub.URL + "/success/logs"},
+		{DeliveryID: "expired-1", LogsURL: fakeGitHub.URL + "/expired/logs"},
+		{DeliveryID: "success-2", LogsURL: fakeGitHub.URL + "/success/logs"},
+		{DeliveryID: "failure-1", LogsURL: fakeGitHub.URL + "/failure/logs"},
+		{DeliveryID: "success-3", LogsURL: fakeGitHub.URL + "/success/logs"},
+	} {
+		event.RepositorySlug = "org/repo"
+		ingest.ProcessElement(ctx, event)
+	}
+
+	if diff := cmp.Diff(metrics.processed, []string{"success-1", "success-2", "success-3"}); diff != "" {
+		t.Errorf("processed elements (-got,+want):\n%s", diff)
+	}
+	if diff := cmp.Diff(metrics.notFound, []string{"expired-1"}); diff != "" {
+		t.Errorf("not found elements (-got,+want):\n%s", diff)
+	}
+	if got, want := len(metrics.failures), 1; got != want {
+		t.Fatalf("expected %d failed elements, got %d: %v", want, got, metrics.failures)
+	}
+	if got, want := metrics.failures[0], "failure-1: error response from GitHub"; !strings.HasPrefix(got, want) {
+		t.Errorf("expected failure %q to start with %q", got, want)
+	}
+	if got, want := metrics.bytes, int64(3*len("workflow logs")); got != want {
+		t.Errorf("expected %d bytes to be recorded, got %d", want, got)
+	}
+}
+
+func TestProcessingLag(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name   string
+		events []*EventRecord
+		want   time.Duration
+	}{
+		{
+			name: "no_events",
+			want: 0,
+		},
+		{
+			name: "oldest_of_events",
+			events: []*EventRecord{
+				{DeliveryID: "1", OldestReceived: now.Add(-2 * time.Hour)},
+				{DeliveryID: "2", OldestReceived: now.Add(-26 * time.Hour)},
+				{DeliveryID: "3", OldestReceived: now.Add(-5 * time.Minute)},
+			},
+			want: 26 * time.Hour,
+		},
+		{
+			name: "ignores_missing_received",
+			events: []*EventRecord{
+				{DeliveryID: "1"},
+				{DeliveryID: "2", OldestReceived: now.Add(-time.Hour)},
+			},
+			want: time.Hour,
+		},
+		{
+			name: "received_in_the_future",
+			events: []*EventRecord{
+				{DeliveryID: "1", OldestReceived: now.Add(time.Minute)},
+			},
+			want: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, want := processingLag(tc.events, now), tc.want; got != want {
+				t.Errorf("expected processing lag %s to be %s", got, want)
+			}
+		})
+	}
+}
@@ -18,13 +18,34 @@ import (
 	"fmt"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/abcxyz/github-metrics-aggregator/pkg/bq"
 )
 
 // sourceQuery is the driving BigQuery query that selects events
-// that need to be processed.
+// that need to be processed. Events whose logs failed to be ingested are
+// retried until they have been attempted MaxAttempts times, along with the
+// number of attempts made so far. Events received less than MinAgeSeconds
+// ago are skipped, as GitHub may still be finalizing their logs. Events
+// received more than LookbackDays ago are skipped so that the query does not
+// scan the whole events table, which also bounds the artifacts scanned for
+// the anti-join since the artifact of an event is processed after it was
+// received. The oldest time an event that needs to be processed was received
+// is selected with each event, which is computed before the events are
+// limited to the batch size.
 const sourceQuery = `
+WITH failures AS (
+SELECT
+  delivery_id,
+  COUNT(*) attempts
+FROM {{.BT}}{{.ProjectID}}.{{.DatasetID}}.{{.ArtifactTableID}}{{.BT}}
+WHERE status = "FAILURE"
+{{- if .LookbackDays}}
+AND processed_at >= TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -{{.LookbackDays}} DAY)
+{{- end}}
+GROUP BY delivery_id
+)
 SELECT
 	delivery_id,
 	JSON_VALUE(payload, "$.repository.full_name") repo_slug,
@@ -35,14 +56,18 @@ SELECT
 	JSON_VALUE(payload, "$.workflow_run.html_url") workflow_url,
 	JSON_VALUE(payload, "$.workflow_run.id") workflow_run_id,
 	JSON_VALUE(payload, "$.workflow_run.run_attempt") workflow_run_attempt,
+	JSON_VALUE(payload, "$.workflow_run.conclusion") conclusion,
 	ARRAY(
 		SELECT
 			JSON_QUERY(pull_request, "$.number")
 		FROM UNNEST(
 			JSON_QUERY_ARRAY(payload, "$.workflow_run.pull_requests")
 		) pull_request
-	) pull_request_numbers
+	) pull_request_numbers,
+	IFNULL(failures.attempts, 0) attempts,
+	MIN(received) OVER () oldest_received
 FROM {{.BT}}{{.ProjectID}}.{{.DatasetID}}.{{.EventTableID}}{{.BT}}
+LEFT JOIN failures USING (delivery_id)
 WHERE
 event = "workflow_run"
 AND JSON_VALUE(payload, "$.workflow_run.status") = "completed"
@@ -50,7 +75,18 @@ AND delivery_id NOT IN (
 SELECT
   delivery_id
 FROM {{.BT}}{{.ProjectID}}.{{.DatasetID}}.{{.ArtifactTableID}}{{.BT}}
+WHERE status != "FAILURE"
+{{- if .LookbackDays}}
+AND processed_at >= TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -{{.LookbackDays}} DAY)
+{{- end}}
 )
+AND IFNULL(failures.attempts, 0) < {{.MaxAttempts}}
+{{- if .MinAgeSeconds}}
+AND received <= TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL {{.MinAgeSeconds}} SECOND)
+{{- end}}
+{{- if .LookbackDays}}
+AND received >= TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -{{.LookbackDays}} DAY)
+{{- end}}
 LIMIT {{.BatchSize}}
 `
 
@@ -60,11 +96,15 @@ type queryParameters struct {
 	EventTableID    string
 	ArtifactTableID string
 	BatchSize       int
+	MaxAttempts     int
+	MinAgeSeconds   int64 // BigQuery intervals do not accept fractional seconds
+	LookbackDays    int
 	BT              string
 }
 
-// makeQuery renders a string template representing the SQL query.
-func makeQuery(client *bq.BigQuery, eventsTable, artifactTable string, batchSize int) (string, error) {
+// makeQuery renders a string template representing the SQL query. The events
+// are not bounded by age if lookbackDays is 0.
+func makeQuery(client *bq.BigQuery, eventsTable, artifactTable string, batchSize, maxAttempts int, minEventAge time.Duration, lookbackDays int) (string, error) {
 	tmpl, err := template.New("query").Parse(sourceQuery)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse query template: %w", err)
@@ -77,6 +117,9 @@ func makeQuery(client *bq.BigQuery, eventsTable, artifactTable string, batchSize
 		EventTableID:    eventsTable,
 		ArtifactTableID: artifactTable,
 		BatchSize:       batchSize,
+		MaxAttempts:     maxAttempts,
+		MinAgeSeconds:   int64(minEventAge / time.Second),
+		LookbackDays:    lookbackDays,
 		BT:              "`",
 	}); err != nil {
 		return "", fmt.Errorf("failed to apply query template parameters: %w", err)
@@ -0,0 +1,211 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/bq"
+)
+
+func TestMakeQuery(t *testing.T) {
+	t.Parallel()
+
+	client := &bq.BigQuery{
+		ProjectID: "my_project",
+		DatasetID: "my_dataset",
+	}
+
+	got, err := makeQuery(client, "events", "artifacts", 100, 5, 0, 0)
+	if err != nil {
+		t.Fatalf("makeQuery failed: %v", err)
+	}
+
+	want := `
+WITH failures AS (
+SELECT
+  delivery_id,
+  COUNT(*) attempts
+FROM ` + "`my_project.my_dataset.artifacts`" + `
+WHERE status = "FAILURE"
+GROUP BY delivery_id
+)
+SELECT
+	delivery_id,
+	JSON_VALUE(payload, "$.repository.full_name") repo_slug,
+	JSON_VALUE(payload, "$.repository.name") repo_name,
+	JSON_VALUE(payload, "$.repository.owner.login") org_name,
+	JSON_VALUE(payload, "$.workflow_run.logs_url") logs_url,
+	JSON_VALUE(payload, "$.workflow_run.actor.login") github_actor,
+	JSON_VALUE(payload, "$.workflow_run.html_url") workflow_url,
+	JSON_VALUE(payload, "$.workflow_run.id") workflow_run_id,
+	JSON_VALUE(payload, "$.workflow_run.run_attempt") workflow_run_attempt,
+	JSON_VALUE(payload, "$.workflow_run.conclusion") conclusion,
+	ARRAY(
+		SELECT
+			JSON_QUERY(pull_request, "$.number")
+		FROM UNNEST(
+			JSON_QUERY_ARRAY(payload, "$.workflow_run.pull_requests")
+		) pull_request
+	) pull_request_numbers,
+	IFNULL(failures.attempts, 0) attempts,
+	MIN(received) OVER () oldest_received
+FROM ` + "`my_project.my_dataset.events`" + `
+LEFT JOIN failures USING (delivery_id)
+WHERE
+event = "workflow_run"
+AND JSON_VALUE(payload, "$.workflow_run.status") = "completed"
+AND delivery_id NOT IN (
+SELECT
+  delivery_id
+FROM ` + "`my_project.my_dataset.artifacts`" + `
+WHERE status != "FAILURE"
+)
+AND IFNULL(failures.attempts, 0) < 5
+LIMIT 100
+`
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("makeQuery got unexpected result (-got,+want):\n%s", diff)
+	}
+}
+
+func TestMakeQuery_MinEventAge(t *testing.T) {
+	t.Parallel()
+
+	client := &bq.BigQuery{
+		ProjectID: "my_project",
+		DatasetID: "my_dataset",
+	}
+
+	got, err := makeQuery(client, "events", "artifacts", 100, 5, 5*time.Minute, 0)
+	if err != nil {
+		t.Fatalf("makeQuery failed: %v", err)
+	}
+
+	want := `
+WITH failures AS (
+SELECT
+  delivery_id,
+  COUNT(*) attempts
+FROM ` + "`my_project.my_dataset.artifacts`" + `
+WHERE status = "FAILURE"
+GROUP BY delivery_id
+)
+SELECT
+	delivery_id,
+	JSON_VALUE(payload, "$.repository.full_name") repo_slug,
+	JSON_VALUE(payload, "$.repository.name") repo_name,
+	JSON_VALUE(payload, "$.repository.owner.login") org_name,
+	JSON_VALUE(payload, "$.workflow_run.logs_url") logs_url,
+	JSON_VALUE(payload, "$.workflow_run.actor.login") github_actor,
+	JSON_VALUE(payload, "$.workflow_run.html_url") workflow_url,
+	JSON_VALUE(payload, "$.workflow_run.id") workflow_run_id,
+	JSON_VALUE(payload, "$.workflow_run.run_attempt") workflow_run_attempt,
+	JSON_VALUE(payload, "$.workflow_run.conclusion") conclusion,
+	ARRAY(
+		SELECT
+			JSON_QUERY(pull_request, "$.number")
+		FROM UNNEST(
+			JSON_QUERY_ARRAY(payload, "$.workflow_run.pull_requests")
+		) pull_request
+	) pull_request_numbers,
+	IFNULL(failures.attempts, 0) attempts,
+	MIN(received) OVER () oldest_received
+FROM ` + "`my_project.my_dataset.events`" + `
+LEFT JOIN failures USING (delivery_id)
+WHERE
+event = "workflow_run"
+AND JSON_VALUE(payload, "$.workflow_run.status") = "completed"
+AND delivery_id NOT IN (
+SELECT
+  delivery_id
+FROM ` + "`my_project.my_dataset.artifacts`" + `
+WHERE status != "FAILURE"
+)
+AND IFNULL(failures.attempts, 0) < 5
+AND received <= TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 300 SECOND)
+LIMIT 100
+`
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("makeQuery got unexpected result (-got,+want):\n%s", diff)
+	}
+}
+
+func TestMakeQuery_LookbackDays(t *testing.T) {
+	t.Parallel()
+
+	client := &bq.BigQuery{
+		ProjectID: "my_project",
+		DatasetID: "my_dataset",
+	}
+
+	got, err := makeQuery(client, "events", "artifacts", 100, 5, 0, 7)
+	if err != nil {
+		t.Fatalf("makeQuery failed: %v", err)
+	}
+
+	want := `
+WITH failures AS (
+SELECT
+  delivery_id,
+  COUNT(*) attempts
+FROM ` + "`my_project.my_dataset.artifacts`" + `
+WHERE status = "FAILURE"
+AND processed_at >= TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -7 DAY)
+GROUP BY delivery_id
+)
+SELECT
+	delivery_id,
+	JSON_VALUE(payload, "$.repository.full_name") repo_slug,
+	JSON_VALUE(payload, "$.repository.name") repo_name,
+	JSON_VALUE(payload, "$.repository.owner.login") org_name,
+	JSON_VALUE(payload, "$.workflow_run.logs_url") logs_url,
+	JSON_VALUE(payload, "$.workflow_run.actor.login") github_actor,
+	JSON_VALUE(payload, "$.workflow_run.html_url") workflow_url,
+	JSON_VALUE(payload, "$.workflow_run.id") workflow_run_id,
+	JSON_VALUE(payload, "$.workflow_run.run_attempt") workflow_run_attempt,
+	JSON_VALUE(payload, "$.workflow_run.conclusion") conclusion,
+	ARRAY(
+		SELECT
+			JSON_QUERY(pull_request, "$.number")
+		FROM UNNEST(
+			JSON_QUERY_ARRAY(payload, "$.workflow_run.pull_requests")
+		) pull_request
+	) pull_request_numbers,
+	IFNULL(failures.attempts, 0) attempts,
+	MIN(received) OVER () oldest_received
+FROM ` + "`my_project.my_dataset.events`" + `
+LEFT JOIN failures USING (delivery_id)
+WHERE
+event = "workflow_run"
+AND JSON_VALUE(payload, "$.workflow_run.status") = "completed"
+AND delivery_id NOT IN (
+SELECT
+  delivery_id
+FROM ` + "`my_project.my_dataset.artifacts`" + `
+WHERE status != "FAILURE"
+AND processed_at >= TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -7 DAY)
+)
+AND IFNULL(failures.attempts, 0) < 5
+AND received >= TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -7 DAY)
+LIMIT 100
+`
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("makeQuery got unexpected result (-got,+want):\n%s", diff)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// orgRateBudgets limits the requests to GitHub of each organization to its
+// share of the overall requests per second, so that the events of an
+// organization with heavy traffic don't exhaust the shared GitHub rate limit
+// and starve the events of the other organizations. The number of requests of
+// each organization is tracked for the run.
+type orgRateBudgets struct {
+	qps          float64
+	defaultShare float64
+	shares       map[string]float64
+
+	// overall limits the requests of all organizations together, the shares
+	// of the organizations may add up to more than the overall requests per
+	// second.
+	overall *rate.Limiter
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	requests map[string]int
+}
+
+// newOrgRateBudgets creates the budgets of the organizations of the given
+// overall requests per second. Each organization may use the default share of
+// it, between 0 and 1, unless it has its own share.
+func newOrgRateBudgets(qps, defaultShare float64, shares map[string]float64) *orgRateBudgets {
+	return &orgRateBudgets{
+		qps:          qps,
+		defaultShare: defaultShare,
+		shares:       shares,
+		overall:      newRateLimiter(qps),
+		limiters:     make(map[string]*rate.Limiter),
+		requests:     make(map[string]int),
+	}
+}
+
+// newRateLimiter creates a limiter of the given requests per second that
+// allows up to a second worth of requests at once.
+func newRateLimiter(qps float64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(qps), int(math.Max(1, math.Floor(qps))))
+}
+
+// reserve reserves a request of the organization at the given time and
+// returns the reservations, which the request must wait for.
+func (b *orgRateBudgets) reserve(org string, now time.Time) []*rate.Reservation {
+	b.mu.Lock()
+	limiter, ok := b.limiters[org]
+	if !ok {
+		share, ok := b.shares[org]
+		if !ok {
+			share = b.defaultShare
+		}
+		limiter = newRateLimiter(b.qps * share)
+		b.limiters[org] = limiter
+	}
+	b.requests[org]++
+	b.mu.Unlock()
+
+	return []*rate.Reservation{
+		limiter.ReserveN(now, 1),
+		b.overall.ReserveN(now, 1),
+	}
+}
+
+// wait blocks until a request of the organization is within its budget, or
+// the context is done.
+func (b *orgRateBudgets) wait(ctx context.Context, org string) error {
+	now := time.Now()
+	reservations := b.reserve(org, now)
+
+	var delay time.Duration
+	for _, r := range reservations {
+		delay = max(delay, r.DelayFrom(now))
+	}
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// the request is not made, so the others may use its reservations
+		for _, r := range reservations {
+			r.Cancel()
+		}
+		return fmt.Errorf("failed to wait for rate limit budget of organization %q: %w", org, ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// usage returns the number of requests of each organization.
+func (b *orgRateBudgets) usage() map[string]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	usage := make(map[string]int, len(b.requests))
+	for org, n := range b.requests {
+		usage[org] = n
+	}
+	return usage
+}
+
+type organizationKey struct{}
+
+// withOrganization returns a context whose requests to GitHub are made on
+// behalf of the organization.
+func withOrganization(ctx context.Context, org string) context.Context {
+	return context.WithValue(ctx, organizationKey{}, org)
+}
+
+// orgRateBudgetTransport waits for the rate limit budget of the organization
+// of the context of each request before making it. Requests whose context has
+// no organization count against the budget of the unnamed organization.
+type orgRateBudgetTransport struct {
+	base    http.RoundTripper
+	budgets *orgRateBudgets
+}
+
+// RoundTrip implements [http.RoundTripper].
+func (t *orgRateBudgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	org, _ := req.Context().Value(organizationKey{}).(string)
+	if err := t.budgets.wait(req.Context(), org); err != nil {
+		// a round tripper closes the body of the request, even on errors
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req) //nolint:wrapcheck // Want passthrough
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOrgRateBudgets_Reserve(t *testing.T) {
+	t.Parallel()
+
+	// 10 requests per second, of which the busy organization may use 2 and
+	// any other organization 5
+	budgets := newOrgRateBudgets(10, 0.5, map[string]float64{"busy-org": 0.2})
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	delays := func(org string, n int) []time.Duration {
+		var got []time.Duration
+		for i := 0; i < n; i++ {
+			var delay time.Duration
+			for _, r := range budgets.reserve(org, now) {
+				delay = max(delay, r.DelayFrom(now))
+			}
+			got = append(got, delay)
+		}
+		return got
+	}
+
+	// the busy organization waits once it exceeds its budget, while the
+	// budget of the other organizations is left
+	if diff := cmp.Diff(delays("busy-org", 4), []time.Duration{0, 0, 500 * time.Millisecond, time.Second}); diff != "" {
+		t.Errorf("busy-org delays (-got,+want):\n%s", diff)
+	}
+	if diff := cmp.Diff(delays("other-org", 5), []time.Duration{0, 0, 0, 0, 0}); diff != "" {
+		t.Errorf("other-org delays (-got,+want):\n%s", diff)
+	}
+
+	// the overall budget is exhausted, so a third organization waits even
+	// though its own budget is left
+	if diff := cmp.Diff(delays("third-org", 2), []time.Duration{0, 100 * time.Millisecond}); diff != "" {
+		t.Errorf("third-org delays (-got,+want):\n%s", diff)
+	}
+
+	want := map[string]int{"busy-org": 4, "other-org": 5, "third-org": 2}
+	if diff := cmp.Diff(budgets.usage(), want); diff != "" {
+		t.Errorf("usage (-got,+want):\n%s", diff)
+	}
+}
+
+func TestOrgRateBudgetTransport_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	fakeGitHub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(fakeGitHub.Close)
+
+	budgets := newOrgRateBudgets(1, 1, nil)
+	client := &http.Client{
+		Transport: &orgRateBudgetTransport{
+			base:    http.DefaultTransport,
+			budgets: budgets,
+		},
+	}
+
+	do := func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fakeGitHub.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err //nolint:wrapcheck // Want passthrough
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	ctx := withOrganization(context.Background(), "my-org")
+	if err := do(ctx); err != nil {
+		t.Fatalf("expected first request within budget to succeed: %v", err)
+	}
+
+	// the budget is exhausted for a second, so the request is stopped by the
+	// deadline of its context
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := do(timeoutCtx); err == nil {
+		t.Errorf("expected request exceeding the budget to wait past its deadline")
+	}
+
+	if diff := cmp.Diff(budgets.usage(), map[string]int{"my-org": 2}); diff != "" {
+		t.Errorf("usage (-got,+want):\n%s", diff)
+	}
+}
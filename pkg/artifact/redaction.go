@@ -0,0 +1,295 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxRedactLineSize is the maximum size of a line of logs that is redacted as
+// a whole. Longer lines are redacted in chunks of this size, so a match that
+// spans two chunks is not redacted.
+const maxRedactLineSize = 64 << 10
+
+const (
+	// zipLocalHeaderSignature starts each entry of a zip archive.
+	zipLocalHeaderSignature = 0x04034b50
+
+	// zipDataDescriptorSignature optionally starts the data descriptor that
+	// follows the data of an entry whose sizes are not in its local header.
+	zipDataDescriptorSignature = 0x08074b50
+
+	// zipCentralDirectorySignature and zipEndOfCentralDirectorySignature start
+	// the central directory, which follows the last entry.
+	zipCentralDirectorySignature      = 0x02014b50
+	zipEndOfCentralDirectorySignature = 0x06054b50
+
+	// zipDataDescriptorFlag is set on entries followed by a data descriptor.
+	zipDataDescriptorFlag = 0x8
+)
+
+// redactingWriter is an ObjectWriter that replaces the matches of a pattern in
+// logs with a placeholder before they are stored, e.g. to remove secrets that
+// leaked into the logs. Content is redacted line by line as it is streamed,
+// the entries of a zip archive and a gzip stream are decompressed, redacted
+// and compressed again in the same format.
+type redactingWriter struct {
+	next        ObjectWriter
+	pattern     *regexp.Regexp
+	placeholder []byte
+}
+
+// newRedactingWriter wraps the given ObjectWriter so that the matches of the
+// pattern are replaced with the placeholder.
+func newRedactingWriter(next ObjectWriter, pattern *regexp.Regexp, placeholder string) ObjectWriter {
+	return &redactingWriter{
+		next:        next,
+		pattern:     pattern,
+		placeholder: []byte(placeholder),
+	}
+}
+
+// Write writes the redacted content to the descriptor.
+func (w *redactingWriter) Write(ctx context.Context, content io.Reader, descriptor string) (string, error) {
+	br := bufio.NewReader(content)
+	header, err := br.Peek(len(zipMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read content header: %w", err)
+	}
+
+	var redact func(dst io.Writer) error
+	switch {
+	case bytes.HasPrefix(header, zipMagic):
+		redact = func(dst io.Writer) error { return w.redactZip(dst, br) }
+	case bytes.HasPrefix(header, gzipMagic):
+		redact = func(dst io.Writer) error { return w.redactGzip(dst, br) }
+	default:
+		redact = func(dst io.Writer) error { return w.redactLines(dst, br) }
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		if err := redact(pw); err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to redact content: %w", err))
+			return
+		}
+		pw.Close()
+	}()
+
+	written, err := w.next.Write(ctx, pr, descriptor)
+	// Unblock the redacting goroutine if the write stopped reading early.
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return "", err //nolint:wrapcheck // Want passthrough
+	}
+	return written, nil
+}
+
+// redactLines copies the lines of src to dst with the matches of the pattern
+// replaced.
+func (w *redactingWriter) redactLines(dst io.Writer, src io.Reader) error {
+	br := bufio.NewReaderSize(src, maxRedactLineSize)
+	for {
+		line, err := br.ReadSlice('\n')
+		if len(line) > 0 {
+			if _, err := dst.Write(w.pattern.ReplaceAllLiteral(line, w.placeholder)); err != nil {
+				return fmt.Errorf("failed to write redacted content: %w", err)
+			}
+		}
+		switch {
+		case err == nil, errors.Is(err, bufio.ErrBufferFull):
+		case errors.Is(err, io.EOF):
+			return nil
+		default:
+			return fmt.Errorf("failed to read content: %w", err)
+		}
+	}
+}
+
+// redactGzip decompresses the gzip stream of src, redacts it and writes it to
+// dst compressed again.
+func (w *redactingWriter) redactGzip(dst io.Writer, src io.Reader) error {
+	gr, err := gzip.NewReader(src)
+	if err != nil {
+		return fmt.Errorf("failed to read gzip stream: %w", err)
+	}
+	defer gr.Close()
+
+	gw := gzip.NewWriter(dst)
+	if err := w.redactLines(gw, gr); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("failed to compress redacted content: %w", err)
+	}
+	return nil
+}
+
+// redactZip redacts each entry of the zip archive of src and writes them to a
+// new archive in dst. The archive is read as a stream of entries from their
+// local headers, so it never has to be held in memory to read its central
+// directory at the end.
+func (w *redactingWriter) redactZip(dst io.Writer, src *bufio.Reader) error {
+	zw := zip.NewWriter(dst)
+	for {
+		var signature uint32
+		if err := binary.Read(src, binary.LittleEndian, &signature); err != nil {
+			return fmt.Errorf("failed to read zip archive: %w", err)
+		}
+		if signature == zipCentralDirectorySignature || signature == zipEndOfCentralDirectorySignature {
+			break
+		}
+		if signature != zipLocalHeaderSignature {
+			return fmt.Errorf("failed to read zip archive: unexpected signature %#x", signature)
+		}
+
+		if err := w.redactZipEntry(zw, src); err != nil {
+			return err
+		}
+	}
+
+	// the central directory of the archive is rewritten by the zip writer
+	if _, err := io.Copy(io.Discard, src); err != nil {
+		return fmt.Errorf("failed to read zip archive: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write redacted zip archive: %w", err)
+	}
+	return nil
+}
+
+// zipLocalHeader is the fixed size part of the local header of a zip entry,
+// following its signature.
+type zipLocalHeader struct {
+	ReaderVersion    uint16
+	Flags            uint16
+	Method           uint16
+	ModifiedTime     uint16
+	ModifiedDate     uint16
+	CRC32            uint32
+	CompressedSize   uint32
+	UncompressedSize uint32
+	NameLength       uint16
+	ExtraLength      uint16
+}
+
+// redactZipEntry redacts the zip entry whose local header follows in src and
+// writes it to zw.
+func (w *redactingWriter) redactZipEntry(zw *zip.Writer, src *bufio.Reader) error {
+	var header zipLocalHeader
+	if err := binary.Read(src, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("failed to read zip entry header: %w", err)
+	}
+	name := make([]byte, header.NameLength)
+	if _, err := io.ReadFull(src, name); err != nil {
+		return fmt.Errorf("failed to read zip entry name: %w", err)
+	}
+	if _, err := src.Discard(int(header.ExtraLength)); err != nil {
+		return fmt.Errorf("failed to read zip entry %s: %w", name, err)
+	}
+
+	// sizes of entries larger than 4GB are in a zip64 extra field
+	if header.CompressedSize == 0xffffffff || header.UncompressedSize == 0xffffffff {
+		return fmt.Errorf("failed to read zip entry %s: zip64 entries are not supported", name)
+	}
+
+	var data io.Reader
+	switch header.Method {
+	case zip.Store:
+		// the end of stored data is only known from its size
+		if header.Flags&zipDataDescriptorFlag != 0 {
+			return fmt.Errorf("failed to read zip entry %s: stored entry without size", name)
+		}
+		data = io.LimitReader(src, int64(header.CompressedSize))
+	case zip.Deflate:
+		// src is an io.ByteReader, so the deflate reader does not read past
+		// the end of the compressed data
+		fr := flate.NewReader(src)
+		defer fr.Close()
+		data = fr
+	default:
+		return fmt.Errorf("failed to read zip entry %s: unsupported compression method %d", name, header.Method)
+	}
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     string(name),
+		Method:   zip.Deflate,
+		Modified: msDOSTime(header.ModifiedDate, header.ModifiedTime),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write zip entry %s: %w", name, err)
+	}
+
+	if strings.HasSuffix(string(name), "/") {
+		// directories have no content
+		if _, err := io.Copy(io.Discard, data); err != nil {
+			return fmt.Errorf("failed to read zip entry %s: %w", name, err)
+		}
+	} else if err := w.redactLines(entry, data); err != nil {
+		return fmt.Errorf("failed to redact zip entry %s: %w", name, err)
+	}
+
+	if header.Flags&zipDataDescriptorFlag != 0 {
+		if err := discardZipDataDescriptor(src); err != nil {
+			return fmt.Errorf("failed to read zip entry %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// discardZipDataDescriptor skips the data descriptor following the data of a
+// zip entry, whose signature is optional.
+func discardZipDataDescriptor(src *bufio.Reader) error {
+	signature, err := src.Peek(4)
+	if err != nil {
+		return fmt.Errorf("failed to read data descriptor: %w", err)
+	}
+	if binary.LittleEndian.Uint32(signature) == zipDataDescriptorSignature {
+		if _, err := src.Discard(4); err != nil {
+			return fmt.Errorf("failed to read data descriptor: %w", err)
+		}
+	}
+	// the crc-32, compressed and uncompressed sizes
+	if _, err := src.Discard(12); err != nil {
+		return fmt.Errorf("failed to read data descriptor: %w", err)
+	}
+	return nil
+}
+
+// msDOSTime converts the MS-DOS date and time of a zip entry to a time.
+func msDOSTime(date, t uint16) time.Time {
+	return time.Date(
+		int(date>>9)+1980,
+		time.Month(date>>5&0xf),
+		int(date&0x1f),
+		int(t>>11),
+		int(t>>5&0x3f),
+		int(t&0x1f)*2,
+		0,
+		time.UTC,
+	)
+}
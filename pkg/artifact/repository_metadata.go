@@ -0,0 +1,106 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v61/github"
+)
+
+// repositoryMetadata is the metadata of a repository that artifact records are
+// enriched with.
+type repositoryMetadata struct {
+	Visibility string
+	Language   string
+	Topics     []string
+}
+
+// repositoryMetadataEntry is a cached fetch of the metadata of a repository.
+// done is closed once metadata and err are set.
+type repositoryMetadataEntry struct {
+	done     chan struct{}
+	metadata *repositoryMetadata
+	err      error
+}
+
+// repositoryMetadataCache fetches the metadata of repositories from GitHub and
+// caches it for the lifetime of the job. Repository metadata rarely changes,
+// so each repository is fetched at most once unless the fetch fails, even when
+// the events of a repository are processed concurrently.
+type repositoryMetadataCache struct {
+	ghClient *github.Client
+
+	mu      sync.Mutex
+	entries map[string]*repositoryMetadataEntry // keyed by lowercase owner/repo
+}
+
+// newRepositoryMetadataCache creates an empty repositoryMetadataCache.
+func newRepositoryMetadataCache(ghClient *github.Client) *repositoryMetadataCache {
+	return &repositoryMetadataCache{
+		ghClient: ghClient,
+		entries:  make(map[string]*repositoryMetadataEntry),
+	}
+}
+
+// get returns the metadata of the given repository, fetching it if it is not
+// cached yet. Callers for a repository that is being fetched wait for the
+// result of that fetch. Failed fetches are not cached.
+func (c *repositoryMetadataCache) get(ctx context.Context, owner, repo string) (*repositoryMetadata, error) {
+	key := strings.ToLower(owner + "/" + repo)
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		c.mu.Unlock()
+
+		select {
+		case <-entry.done:
+			return entry.metadata, entry.err
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to wait for metadata of %s/%s: %w", owner, repo, ctx.Err())
+		}
+	}
+	entry = &repositoryMetadataEntry{done: make(chan struct{})}
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	entry.metadata, entry.err = c.fetch(ctx, owner, repo)
+	if entry.err != nil {
+		c.mu.Lock()
+		delete(c.entries, key)
+		c.mu.Unlock()
+	}
+	close(entry.done)
+
+	return entry.metadata, entry.err
+}
+
+// fetch retrieves the metadata of the given repository from GitHub.
+func (c *repositoryMetadataCache) fetch(ctx context.Context, owner, repo string) (*repositoryMetadata, error) {
+	repository, _, err := c.ghClient.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository %s/%s: %w", owner, repo, err)
+	}
+
+	return &repositoryMetadata{
+		Visibility: repository.GetVisibility(),
+		Language:   repository.GetLanguage(),
+		Topics:     repository.Topics,
+	}, nil
+}
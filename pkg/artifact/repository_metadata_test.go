@@ -0,0 +1,190 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v61/github"
+)
+
+// newRepositoryMetadataServer fakes the GitHub repositories API and counts the
+// requests made for each repository. It also serves workflow logs at "logs".
+func newRepositoryMetadataServer(t *testing.T) (*github.Client, map[string]*atomic.Int64) {
+	t.Helper()
+
+	requests := map[string]*atomic.Int64{
+		"test-org/test-repo":    {},
+		"test-org/missing-repo": {},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/test-org/test-repo", func(w http.ResponseWriter, r *http.Request) {
+		requests["test-org/test-repo"].Add(1)
+		fmt.Fprint(w, `{"visibility": "internal", "language": "Go", "topics": ["metrics", "github"]}`)
+	})
+	mux.HandleFunc("GET /api/v3/repos/test-org/missing-repo", func(w http.ResponseWriter, r *http.Request) {
+		requests["test-org/missing-repo"].Add(1)
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	})
+	mux.HandleFunc("GET /api/v3/logs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "logs")
+	})
+	fakeGitHub := httptest.NewServer(mux)
+	t.Cleanup(fakeGitHub.Close)
+
+	client, err := github.NewClient(fakeGitHub.Client()).WithEnterpriseURLs(fakeGitHub.URL, fakeGitHub.URL)
+	if err != nil {
+		t.Fatalf("failed to create github client: %v", err)
+	}
+	return client, requests
+}
+
+func TestRepositoryMetadataCache_Get(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client, requests := newRepositoryMetadataServer(t)
+	cache := newRepositoryMetadataCache(client)
+
+	want := &repositoryMetadata{
+		Visibility: "internal",
+		Language:   "Go",
+		Topics:     []string{"metrics", "github"},
+	}
+
+	// Concurrent lookups of the same repository share a single fetch.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			got, err := cache.get(ctx, "test-org", "test-repo")
+			if err != nil {
+				t.Errorf("get failed: %v", err)
+				return
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("get got unexpected result (-got,+want):\n%s", diff)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Repository names are case-insensitive.
+	if _, err := cache.get(ctx, "Test-Org", "Test-Repo"); err != nil {
+		t.Errorf("get failed: %v", err)
+	}
+
+	if got, want := requests["test-org/test-repo"].Load(), int64(1); got != want {
+		t.Errorf("expected %d requests for test-org/test-repo, got %d", want, got)
+	}
+
+	// Failures are not cached, so the next lookup fetches again.
+	for i := 0; i < 2; i++ {
+		if _, err := cache.get(ctx, "test-org", "missing-repo"); err == nil {
+			t.Errorf("get: expected error for missing repository")
+		}
+	}
+	if got, want := requests["test-org/missing-repo"].Load(), int64(2); got != want {
+		t.Errorf("expected %d requests for test-org/missing-repo, got %d", want, got)
+	}
+}
+
+func TestPipeline_ProcessElement_RepositoryMetadata(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cases := []struct {
+		name           string
+		enabled        bool
+		repositoryName string
+		wantVisibility string
+		wantLanguage   string
+		wantTopics     []string
+	}{
+		{
+			name:           "enrichment_disabled",
+			repositoryName: "test-repo",
+		},
+		{
+			name:           "enrichment_enabled",
+			enabled:        true,
+			repositoryName: "test-repo",
+			wantVisibility: "internal",
+			wantLanguage:   "Go",
+			wantTopics:     []string{"metrics", "github"},
+		},
+		{
+			name:           "metadata_unavailable",
+			enabled:        true,
+			repositoryName: "missing-repo",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, requests := newRepositoryMetadataServer(t)
+			ingest := logIngester{
+				bucketName: "test",
+				storage:    &testObjectWriter{},
+				ghClient:   client,
+			}
+			if tc.enabled {
+				ingest.repositoryMetadata = newRepositoryMetadataCache(client)
+			}
+
+			got := ingest.ProcessElement(ctx, EventRecord{
+				DeliveryID:       "delivery",
+				OrganizationName: "test-org",
+				RepositoryName:   tc.repositoryName,
+				RepositorySlug:   "test-org/" + tc.repositoryName,
+				LogsURL:          "logs",
+			})
+
+			// metadata unavailability does not affect the ingestion itself
+			if got, want := got.Status, "SUCCESS"; got != want {
+				t.Errorf("ProcessElement got status %q, want %q", got, want)
+			}
+			if got, want := got.RepositoryVisibility, tc.wantVisibility; got != want {
+				t.Errorf("ProcessElement got visibility %q, want %q", got, want)
+			}
+			if got, want := got.RepositoryLanguage, tc.wantLanguage; got != want {
+				t.Errorf("ProcessElement got language %q, want %q", got, want)
+			}
+			if diff := cmp.Diff(got.RepositoryTopics, tc.wantTopics); diff != "" {
+				t.Errorf("ProcessElement got unexpected topics (-got,+want):\n%s", diff)
+			}
+			if !tc.enabled {
+				if got := requests["test-org/test-repo"].Load(); got != 0 {
+					t.Errorf("expected no requests for repository metadata, got %d", got)
+				}
+			}
+		})
+	}
+}
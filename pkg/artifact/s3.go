@@ -0,0 +1,83 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3ObjectStore is an implementation of the ObjectWriter interface that
+// writes to Amazon S3 or an S3-compatible service such as MinIO.
+type S3ObjectStore struct {
+	uploader *manager.Uploader
+}
+
+// NewS3ObjectStore creates a ObjectWriter implementation that uses S3 to store
+// its objects. Credentials are loaded from the default AWS credential chain.
+// If an endpoint is given, requests are sent to it using path-style
+// addressing, as required by most S3-compatible services. If a region is
+// given, it overrides the one from the environment.
+func NewS3ObjectStore(ctx context.Context, endpoint, region string) (*S3ObjectStore, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading aws config: %w", err)
+	}
+	return newS3ObjectStore(awsCfg, endpoint), nil
+}
+
+func newS3ObjectStore(awsCfg aws.Config, endpoint string) *S3ObjectStore {
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &S3ObjectStore{uploader: manager.NewUploader(client)}
+}
+
+// Write writes an object to S3. The content does not need to be seekable, it
+// is uploaded in parts if it does not fit into a single request.
+func (s *S3ObjectStore) Write(ctx context.Context, content io.Reader, objectDescriptor string) (string, error) {
+	// Split the descriptor into chunks
+	scheme, bucketName, objectName, _, err := parseObjectURI(objectDescriptor)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse s3 uri: %w", err)
+	}
+	if scheme != schemeS3 {
+		return "", fmt.Errorf("unsupported scheme %q for s3 uri: [%s]", scheme, objectDescriptor)
+	}
+
+	if _, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectName),
+		Body:   content,
+	}); err != nil {
+		return "", fmt.Errorf("failed to upload s3 object: %w", err)
+	}
+
+	return objectDescriptor, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestS3ObjectStore_Write(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		descriptor     string
+		status         int
+		wantDescriptor string
+		wantObjects    map[string]string
+		wantErr        string
+	}{
+		{
+			name:           "success",
+			descriptor:     "s3://test-bucket/org/repo/delivery/artifacts.gz",
+			status:         http.StatusOK,
+			wantDescriptor: "s3://test-bucket/org/repo/delivery/artifacts.gz",
+			wantObjects: map[string]string{
+				"/test-bucket/org/repo/delivery/artifacts.gz": "logs",
+			},
+		},
+		{
+			name:       "gcs_descriptor",
+			descriptor: "gs://test-bucket/org/repo/delivery/artifacts.gz",
+			status:     http.StatusOK,
+			wantErr:    `unsupported scheme "gs" for s3 uri`,
+		},
+		{
+			name:       "malformed_descriptor",
+			descriptor: "HOT GARBAGE",
+			status:     http.StatusOK,
+			wantErr:    "failed to parse s3 uri: invalid uri: [HOT GARBAGE]",
+		},
+		{
+			name:       "access_denied",
+			descriptor: "s3://test-bucket/org/repo/delivery/artifacts.gz",
+			status:     http.StatusForbidden,
+			wantErr:    "failed to upload s3 object",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			gotObjects := make(map[string]string)
+			fakeS3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut {
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				if tc.status != http.StatusOK {
+					w.WriteHeader(tc.status)
+					return
+				}
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				mu.Lock()
+				gotObjects[r.URL.Path] = string(body)
+				mu.Unlock()
+				w.Header().Set("ETag", `"test-etag"`)
+				w.WriteHeader(http.StatusOK)
+			}))
+			t.Cleanup(fakeS3.Close)
+
+			store := newS3ObjectStore(aws.Config{
+				Region:      "us-east-1",
+				Credentials: credentials.NewStaticCredentialsProvider("test-access-key", "test-secret-key", ""),
+				HTTPClient:  fakeS3.Client(),
+			}, fakeS3.URL)
+
+			// The content is not seekable, as is the case for compressed logs.
+			got, err := store.Write(context.Background(), io.NopCloser(strings.NewReader("logs")), tc.descriptor)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if got != tc.wantDescriptor {
+				t.Errorf("Write(%q) got descriptor %q, want %q", tc.descriptor, got, tc.wantDescriptor)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if tc.wantObjects == nil {
+				tc.wantObjects = map[string]string{}
+			}
+			if diff := cmp.Diff(gotObjects, tc.wantObjects); diff != "" {
+				t.Errorf("Write(%q) unexpected objects (-got,+want):\n%s", tc.descriptor, diff)
+			}
+		})
+	}
+}
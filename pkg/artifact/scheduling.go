@@ -0,0 +1,41 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+// roundRobinByRepository reorders the events so that the repositories take
+// turns: the first event of every repository comes first, followed by the
+// second event of every repository and so on. Repositories keep the order in
+// which they first appear, and the events of a repository keep their relative
+// order.
+func roundRobinByRepository(events []*EventRecord) []*EventRecord {
+	var repos []string
+	byRepo := make(map[string][]*EventRecord)
+	for _, event := range events {
+		if _, ok := byRepo[event.RepositorySlug]; !ok {
+			repos = append(repos, event.RepositorySlug)
+		}
+		byRepo[event.RepositorySlug] = append(byRepo[event.RepositorySlug], event)
+	}
+
+	ordered := make([]*EventRecord, 0, len(events))
+	for round := 0; len(ordered) < len(events); round++ {
+		for _, repo := range repos {
+			if round < len(byRepo[repo]) {
+				ordered = append(ordered, byRepo[repo][round])
+			}
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRoundRobinByRepository(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		events []string // repository/delivery id
+		want   []string
+	}{
+		{
+			name: "no_events",
+			want: []string{},
+		},
+		{
+			name:   "single_repository_keeps_order",
+			events: []string{"org/a/1", "org/a/2", "org/a/3"},
+			want:   []string{"org/a/1", "org/a/2", "org/a/3"},
+		},
+		{
+			name: "dominant_repository_interleaved",
+			events: []string{
+				"org/a/1", "org/a/2", "org/a/3", "org/a/4",
+				"org/b/1",
+				"org/a/5",
+				"org/c/1", "org/c/2",
+			},
+			want: []string{
+				"org/a/1", "org/b/1", "org/c/1",
+				"org/a/2", "org/c/2",
+				"org/a/3",
+				"org/a/4",
+				"org/a/5",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			events := make([]*EventRecord, 0, len(tc.events))
+			for _, e := range tc.events {
+				idx := strings.LastIndex(e, "/")
+				events = append(events, &EventRecord{RepositorySlug: e[:idx], DeliveryID: e[idx+1:]})
+			}
+
+			ordered := roundRobinByRepository(events)
+			got := make([]string, 0, len(ordered))
+			for _, event := range ordered {
+				got = append(got, event.RepositorySlug+"/"+event.DeliveryID)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("roundRobinByRepository (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
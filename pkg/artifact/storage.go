@@ -16,6 +16,7 @@ package artifact
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"regexp"
@@ -25,8 +26,10 @@ import (
 )
 
 // ObjectWriter is an interface for writing a object/blob to a storage medium.
+// Write returns the descriptor the object was actually written to, which may
+// differ from the requested descriptor, e.g. to avoid a naming collision.
 type ObjectWriter interface {
-	Write(ctx context.Context, content io.Reader, descriptor string) error
+	Write(ctx context.Context, content io.Reader, descriptor string) (string, error)
 }
 
 // ObjectStore is an implementation of the ObjectWriter interface that
@@ -46,55 +49,93 @@ func NewObjectStore(ctx context.Context) (*ObjectStore, error) {
 }
 
 // Write writes an object to Google Cloud Storage.
-func (s *ObjectStore) Write(ctx context.Context, content io.Reader, objectDescriptor string) error {
-	// Split the descriptor into chunks
-	bucketName, objectName, _, err := parseGCSURI(objectDescriptor)
+func (s *ObjectStore) Write(ctx context.Context, content io.Reader, objectDescriptor string) (string, error) {
+	obj, err := s.object(objectDescriptor)
 	if err != nil {
-		return fmt.Errorf("failed to parse gcs uri: %w", err)
+		return "", err
 	}
 
-	// Connect to bucket
-	bucket := s.client.Bucket(bucketName)
-	// Setup the GCS object with the filename to write to
-	obj := bucket.Object(objectName)
-
 	writer := obj.NewWriter(ctx)
 
 	if _, err := io.Copy(writer, content); err != nil {
-		return fmt.Errorf("failed to copy contents of reader to cloud storage object: %w", err)
+		return "", fmt.Errorf("failed to copy contents of reader to cloud storage object: %w", err)
 	}
 
 	// File appears in GCS after Close
 	if err := writer.Close(); err != nil {
-		return fmt.Errorf("failed to close gcs file: %w", err)
+		return "", fmt.Errorf("failed to close gcs file: %w", err)
+	}
+
+	return objectDescriptor, nil
+}
+
+// checksum returns the CRC32C checksum of an existing object in Google Cloud
+// Storage. The returned boolean is false if the object does not exist.
+func (s *ObjectStore) checksum(ctx context.Context, objectDescriptor string) (uint32, bool, error) {
+	obj, err := s.object(objectDescriptor)
+	if err != nil {
+		return 0, false, err
+	}
+
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to get gcs object attributes: %w", err)
 	}
+	return attrs.CRC32C, true, nil
+}
 
-	return nil
+// object returns the handle of the Cloud Storage object the descriptor refers
+// to.
+func (s *ObjectStore) object(objectDescriptor string) (*storage.ObjectHandle, error) {
+	// Split the descriptor into chunks
+	scheme, bucketName, objectName, _, err := parseObjectURI(objectDescriptor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse gcs uri: %w", err)
+	}
+	if scheme != schemeGCS {
+		return nil, fmt.Errorf("unsupported scheme %q for gcs uri: [%s]", scheme, objectDescriptor)
+	}
+
+	// Connect to bucket and setup the GCS object with the filename to write to
+	return s.client.Bucket(bucketName).Object(objectName), nil
 }
 
-// parseGCSURI parses a gcs uri of the type gs://blah/blah/blah.blah
+// The URI schemes of the supported object storage backends.
+const (
+	schemeGCS = "gs"
+	schemeS3  = "s3"
+)
+
+// parseObjectURI parses an object uri of the type gs://blah/blah/blah.blah or
+// s3://blah/blah/blah.blah
 // The parts are:
 //
+//	scheme
 //	bucket name
 //	object path
 //	file name
 //
 // Throws an error if the uri cannot be parsed.
-func parseGCSURI(objectURI string) (string, string, string, error) {
+func parseObjectURI(objectURI string) (string, string, string, string, error) {
 	// First verify that all of the parts exist
-	r, _ := regexp.Compile("gs://(.*)/(.*)")
-	if !r.MatchString(objectURI) {
-		return "", "", "", fmt.Errorf("invalid uri: [%s]", objectURI)
+	r, _ := regexp.Compile("^(gs|s3)://(.*)/(.*)")
+	match := r.FindStringSubmatch(objectURI)
+	if match == nil {
+		return "", "", "", "", fmt.Errorf("invalid uri: [%s]", objectURI)
 	}
+	scheme := match[1]
 	// Extract bucket name by splitting string by '/'
 	// take the 3rd item in the list (index position 2) which is the bucket name
 	parts := strings.Split(objectURI, "/")
 	bucket := parts[2]
 
-	// Extract object name by splitting string to remove gs:// prefix and bucket name
-	// rejoin to rebuild the file path
+	// Extract object name by splitting string to remove the scheme prefix and
+	// bucket name rejoin to rebuild the file path
 	objectName := strings.Join(parts[3:], "/")
 	// Extract the last segment as the filename
 	fileName := parts[len(parts)-1]
-	return bucket, objectName, fileName, nil
+	return scheme, bucket, objectName, fileName, nil
 }
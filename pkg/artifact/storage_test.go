@@ -0,0 +1,75 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifact
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestParseObjectURI(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		uri     string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "gcs",
+			uri:  "gs://bucket/repo/delivery/artifacts.zip",
+			want: []string{"gs", "bucket", "repo/delivery/artifacts.zip", "artifacts.zip"},
+		},
+		{
+			name: "s3",
+			uri:  "s3://bucket/repo/delivery/artifacts.gz",
+			want: []string{"s3", "bucket", "repo/delivery/artifacts.gz", "artifacts.gz"},
+		},
+		{
+			name:    "unsupported_scheme",
+			uri:     "ftp://bucket/repo/delivery/artifacts.gz",
+			wantErr: "invalid uri: [ftp://bucket/repo/delivery/artifacts.gz]",
+		},
+		{
+			name:    "missing_object",
+			uri:     "s3://bucket",
+			wantErr: "invalid uri: [s3://bucket]",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			scheme, bucket, objectName, fileName, err := parseObjectURI(tc.uri)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if err != nil {
+				return
+			}
+			got := []string{scheme, bucket, objectName, fileName}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("parseObjectURI(%q) unexpected result (-got,+want):\n%s", tc.uri, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auditlog polls the audit log of a GitHub organization and writes
+// its entries to BigQuery.
+package auditlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v61/github"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/bq"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// AuditLogClient gets the audit log entries of an organization, it is
+// implemented by [github.OrganizationsService].
+type AuditLogClient interface {
+	GetAuditLog(ctx context.Context, org string, opts *github.GetAuditLogOptions) ([]*github.AuditEntry, *github.Response, error)
+}
+
+// Checkpointer reads and writes the checkpoint of the poller, it is
+// implemented by the BigQuery datastore of the retry service, so that the
+// checkpoint is stored the same way as the retry service's.
+type Checkpointer interface {
+	RetrieveCheckpointID(ctx context.Context, checkpointTableID, installation string) (string, error)
+	WriteCheckpointID(ctx context.Context, checkpointTableID, installation, deliveryID, createdAt string) error
+}
+
+// Entry is the shape of an entry of the audit log table.
+type Entry struct {
+	DocumentID string    `bigquery:"document_id"`
+	Action     string    `bigquery:"action"`
+	Actor      string    `bigquery:"actor"`
+	Org        string    `bigquery:"org"`
+	Created    time.Time `bigquery:"created"`
+	Payload    string    `bigquery:"payload"`
+}
+
+// Result summarizes a poll of the audit log.
+type Result struct {
+	Pages      int
+	Entries    int
+	Checkpoint string
+}
+
+// checkpoint is the position of the last audit log entry that was written to
+// BigQuery. It is stored as "<unix milliseconds>/<document id>".
+type checkpoint struct {
+	timestamp  time.Time
+	documentID string
+}
+
+// parseCheckpoint parses a stored checkpoint, nil is returned for the empty
+// checkpoint of a poller that has not run before.
+func parseCheckpoint(s string) (*checkpoint, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	millis, documentID, ok := strings.Cut(s, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid checkpoint %q", s)
+	}
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp of checkpoint %q: %w", s, err)
+	}
+	return &checkpoint{timestamp: time.UnixMilli(ms).UTC(), documentID: documentID}, nil
+}
+
+func (c *checkpoint) String() string {
+	return fmt.Sprintf("%d/%s", c.timestamp.UnixMilli(), c.documentID)
+}
+
+// precedes reports whether the entry was already written to BigQuery. Entries
+// in the same millisecond as the checkpoint other than its own are written
+// again, as the audit log has no stable order within a millisecond, so rows
+// of the audit log table may need to be deduplicated by document_id.
+func (c *checkpoint) precedes(e *github.AuditEntry) bool {
+	ts := entryTimestamp(e)
+	return ts.Before(c.timestamp) || (ts.Equal(c.timestamp) && e.GetDocumentID() == c.documentID)
+}
+
+// entryTimestamp returns the time the audit log event occurred.
+func entryTimestamp(e *github.AuditEntry) time.Time {
+	if e.Timestamp != nil {
+		return e.GetTimestamp().UTC()
+	}
+	return e.GetCreatedAt().UTC()
+}
+
+// Poller writes the entries of the audit log of an organization to BigQuery,
+// continuing from a checkpoint of the entries written by the previous poll.
+type Poller struct {
+	client       AuditLogClient
+	checkpointer Checkpointer
+	putter       bq.Putter
+	putRetry     *bq.PutRetryConfig
+	cfg          *Config
+}
+
+// NewPoller creates a new Poller for the organization of the cfg. The entries
+// are inserted with the putter, retrying failed inserts according to putRetry.
+func NewPoller(client AuditLogClient, checkpointer Checkpointer, putter bq.Putter, putRetry *bq.PutRetryConfig, cfg *Config) *Poller {
+	return &Poller{
+		client:       client,
+		checkpointer: checkpointer,
+		putter:       putter,
+		putRetry:     putRetry,
+		cfg:          cfg,
+	}
+}
+
+// checkpointKey is the value of the installation column that the checkpoint of
+// the organization is stored with.
+func checkpointKey(org string) string {
+	return "audit-log/" + org
+}
+
+// Poll writes the audit log entries after the checkpoint to BigQuery, page by
+// page in ascending order, until the last page or the maximum number of pages
+// is reached. The checkpoint is advanced past the written entries once at the
+// end of the poll, also when a later page failed, so that the next poll
+// continues after them.
+func (p *Poller) Poll(ctx context.Context) (*Result, error) {
+	logger := logging.FromContext(ctx)
+	key := checkpointKey(p.cfg.Organization)
+
+	prevCheckpoint, err := p.checkpointer.RetrieveCheckpointID(ctx, p.cfg.CheckpointTableID, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve checkpoint: %w", err)
+	}
+	cp, err := parseCheckpoint(prevCheckpoint)
+	if err != nil {
+		return nil, err
+	}
+	logger.InfoContext(ctx, "polling audit log",
+		"organization", p.cfg.Organization,
+		"checkpoint", prevCheckpoint)
+
+	result := &Result{Checkpoint: prevCheckpoint}
+	pollErr := p.poll(ctx, cp, result)
+
+	if result.Checkpoint != prevCheckpoint {
+		createdAt := time.Now().UTC().Format(time.DateTime)
+		if err := p.checkpointer.WriteCheckpointID(ctx, p.cfg.CheckpointTableID, key, result.Checkpoint, createdAt); err != nil {
+			return result, errors.Join(pollErr, fmt.Errorf("failed to write checkpoint: %w", err))
+		}
+	}
+	return result, pollErr
+}
+
+// poll writes the pages of entries after cp, recording the progress in
+// result.
+func (p *Poller) poll(ctx context.Context, cp *checkpoint, result *Result) error {
+	opts := &github.GetAuditLogOptions{
+		Include: github.String(p.cfg.Include),
+		Order:   github.String("asc"),
+		Phrase:  searchPhrase(p.cfg.Phrase, cp),
+		ListCursorOptions: github.ListCursorOptions{
+			PerPage: p.cfg.PageSize,
+		},
+	}
+
+	for {
+		entries, resp, err := p.client.GetAuditLog(ctx, p.cfg.Organization, opts)
+		if err != nil {
+			return fmt.Errorf("failed to get audit log of %s: %w", p.cfg.Organization, err)
+		}
+		result.Pages++
+
+		rows := make([]*Entry, 0, len(entries))
+		var last *github.AuditEntry
+		for _, e := range entries {
+			if cp != nil && cp.precedes(e) {
+				continue
+			}
+			row, err := newEntry(e)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, row)
+			last = e
+		}
+
+		if last != nil {
+			if err := bq.PutWithRetry(ctx, p.putter, rows, p.putRetry); err != nil {
+				return fmt.Errorf("failed to write audit log entries: %w", err)
+			}
+			cp = &checkpoint{timestamp: entryTimestamp(last), documentID: last.GetDocumentID()}
+			result.Entries += len(rows)
+			result.Checkpoint = cp.String()
+		}
+
+		if resp.After == "" || (p.cfg.MaxPages > 0 && result.Pages >= p.cfg.MaxPages) {
+			return nil
+		}
+		opts.After = resp.After
+	}
+}
+
+// searchPhrase returns the search phrase of the audit log, restricted to the
+// entries created at or after the checkpoint. The search only has second
+// precision, the entries before the checkpoint are skipped by the poller.
+func searchPhrase(phrase string, cp *checkpoint) *string {
+	var terms []string
+	if phrase != "" {
+		terms = append(terms, phrase)
+	}
+	if cp != nil {
+		terms = append(terms, "created:>="+cp.timestamp.Format(time.RFC3339))
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+	return github.String(strings.Join(terms, " "))
+}
+
+// newEntry converts an audit log entry to a row of the audit log table, with
+// the complete entry as JSON payload.
+func newEntry(e *github.AuditEntry) (*Entry, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal audit log entry %s: %w", e.GetDocumentID(), err)
+	}
+	return &Entry{
+		DocumentID: e.GetDocumentID(),
+		Action:     e.GetAction(),
+		Actor:      e.GetActor(),
+		Org:        e.GetOrg(),
+		Created:    entryTimestamp(e),
+		Payload:    string(payload),
+	}, nil
+}
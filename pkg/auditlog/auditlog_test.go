@@ -0,0 +1,273 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditlog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v61/github"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/bq"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// fakeCheckpointer returns a fixed checkpoint and records the checkpoints
+// written.
+type fakeCheckpointer struct {
+	checkpoint string
+	written    []string
+}
+
+func (c *fakeCheckpointer) RetrieveCheckpointID(ctx context.Context, checkpointTableID, installation string) (string, error) {
+	if checkpointTableID != "checkpoint" || installation != "audit-log/my-org" {
+		return "", fmt.Errorf("unexpected checkpoint %s of %s", installation, checkpointTableID)
+	}
+	return c.checkpoint, nil
+}
+
+func (c *fakeCheckpointer) WriteCheckpointID(ctx context.Context, checkpointTableID, installation, deliveryID, createdAt string) error {
+	c.written = append(c.written, deliveryID)
+	return nil
+}
+
+// fakePutter records the document IDs of the rows inserted.
+type fakePutter struct {
+	documentIDs []string
+}
+
+func (p *fakePutter) Put(ctx context.Context, src any) error {
+	for _, row := range src.([]*Entry) {
+		p.documentIDs = append(p.documentIDs, row.DocumentID)
+	}
+	return nil
+}
+
+// auditLogPage is a page of audit log entries served for a cursor, with the
+// cursor of the next page.
+type auditLogPage struct {
+	entries string
+	next    string
+}
+
+// newAuditLogServer serves the pages of the audit log of my-org keyed by the
+// after cursor of the request, an unknown cursor fails with a 500. The
+// queries of the requests are recorded in order.
+func newAuditLogServer(t *testing.T, pages map[string]*auditLogPage) (*github.Client, func() []url.Values) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var queries []url.Values
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /orgs/my-org/audit-log", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+
+		page, ok := pages[r.URL.Query().Get("after")]
+		if !ok {
+			http.Error(w, `{"message": "internal error"}`, http.StatusInternalServerError)
+			return
+		}
+		if page.next != "" {
+			next := *r.URL
+			q := next.Query()
+			q.Set("after", page.next)
+			next.RawQuery = q.Encode()
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, r.Host, next.String()))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, page.entries)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+
+	return client, func() []url.Values {
+		mu.Lock()
+		defer mu.Unlock()
+		return queries
+	}
+}
+
+// auditEntries formats audit log entries with the given document IDs and
+// timestamps in unix milliseconds as a JSON response body.
+func auditEntries(entries ...any) string {
+	items := make([]string, 0, len(entries)/2)
+	for i := 0; i < len(entries); i += 2 {
+		items = append(items, fmt.Sprintf(`{"_document_id": %q, "@timestamp": %d, "action": "repo.create", "actor": "octocat", "org": "my-org"}`,
+			entries[i], entries[i+1]))
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+func TestPoller_Poll(t *testing.T) {
+	t.Parallel()
+
+	// 2024-03-01T12:00:00.5Z
+	base := time.Date(2024, 3, 1, 12, 0, 0, 500_000_000, time.UTC).UnixMilli()
+
+	cases := []struct {
+		name           string
+		checkpoint     string
+		maxPages       int
+		pages          map[string]*auditLogPage
+		wantDocuments  []string
+		wantCheckpoint []string
+		wantAfter      []string
+		wantPhrase     string
+		wantResult     *Result
+		wantErr        string
+	}{
+		{
+			name: "paginates_without_checkpoint",
+			pages: map[string]*auditLogPage{
+				"":   {entries: auditEntries("a", base, "b", base+1), next: "c1"},
+				"c1": {entries: auditEntries("c", base+2, "d", base+3), next: "c2"},
+				"c2": {entries: auditEntries("e", base+4)},
+			},
+			wantDocuments:  []string{"a", "b", "c", "d", "e"},
+			wantCheckpoint: []string{fmt.Sprintf("%d/e", base+4)},
+			wantAfter:      []string{"", "c1", "c2"},
+			wantResult:     &Result{Pages: 3, Entries: 5, Checkpoint: fmt.Sprintf("%d/e", base+4)},
+		},
+		{
+			name:       "continues_after_checkpoint",
+			checkpoint: fmt.Sprintf("%d/b", base+1),
+			pages: map[string]*auditLogPage{
+				"":   {entries: auditEntries("a", base, "b", base+1), next: "c1"},
+				"c1": {entries: auditEntries("b2", base+1, "c", base+2)},
+			},
+			wantDocuments:  []string{"b2", "c"},
+			wantCheckpoint: []string{fmt.Sprintf("%d/c", base+2)},
+			wantAfter:      []string{"", "c1"},
+			wantPhrase:     "action:repo created:>=2024-03-01T12:00:00Z",
+			wantResult:     &Result{Pages: 2, Entries: 2, Checkpoint: fmt.Sprintf("%d/c", base+2)},
+		},
+		{
+			name:       "no_new_entries",
+			checkpoint: fmt.Sprintf("%d/b", base+1),
+			pages: map[string]*auditLogPage{
+				"": {entries: auditEntries("a", base, "b", base+1)},
+			},
+			wantAfter:  []string{""},
+			wantPhrase: "action:repo created:>=2024-03-01T12:00:00Z",
+			wantResult: &Result{Pages: 1, Checkpoint: fmt.Sprintf("%d/b", base+1)},
+		},
+		{
+			name:     "stops_at_max_pages",
+			maxPages: 2,
+			pages: map[string]*auditLogPage{
+				"":   {entries: auditEntries("a", base), next: "c1"},
+				"c1": {entries: auditEntries("b", base+1), next: "c2"},
+				"c2": {entries: auditEntries("c", base+2)},
+			},
+			wantDocuments:  []string{"a", "b"},
+			wantCheckpoint: []string{fmt.Sprintf("%d/b", base+1)},
+			wantAfter:      []string{"", "c1"},
+			wantResult:     &Result{Pages: 2, Entries: 2, Checkpoint: fmt.Sprintf("%d/b", base+1)},
+		},
+		{
+			name: "advances_checkpoint_before_failed_page",
+			pages: map[string]*auditLogPage{
+				"": {entries: auditEntries("a", base, "b", base+1), next: "c1"},
+			},
+			wantDocuments:  []string{"a", "b"},
+			wantCheckpoint: []string{fmt.Sprintf("%d/b", base+1)},
+			wantAfter:      []string{"", "c1"},
+			wantResult:     &Result{Pages: 1, Entries: 2, Checkpoint: fmt.Sprintf("%d/b", base+1)},
+			wantErr:        "failed to get audit log of my-org",
+		},
+		{
+			name:       "invalid_checkpoint",
+			checkpoint: "not-a-checkpoint",
+			wantErr:    `invalid checkpoint "not-a-checkpoint"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, queries := newAuditLogServer(t, tc.pages)
+			checkpointer := &fakeCheckpointer{checkpoint: tc.checkpoint}
+			putter := &fakePutter{}
+			cfg := &Config{
+				Organization:      "my-org",
+				CheckpointTableID: "checkpoint",
+				Include:           "all",
+				PageSize:          2,
+				MaxPages:          tc.maxPages,
+			}
+			if tc.wantPhrase != "" {
+				cfg.Phrase = "action:repo"
+			}
+
+			poller := NewPoller(client.Organizations, checkpointer, putter, &bq.PutRetryConfig{}, cfg)
+			got, err := poller.Poll(context.Background())
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+
+			if diff := cmp.Diff(got, tc.wantResult); diff != "" {
+				t.Errorf("result (-got,+want):\n%s", diff)
+			}
+			if diff := cmp.Diff(putter.documentIDs, tc.wantDocuments); diff != "" {
+				t.Errorf("written documents (-got,+want):\n%s", diff)
+			}
+			if diff := cmp.Diff(checkpointer.written, tc.wantCheckpoint); diff != "" {
+				t.Errorf("written checkpoints (-got,+want):\n%s", diff)
+			}
+
+			var gotAfter []string
+			for _, q := range queries() {
+				gotAfter = append(gotAfter, q.Get("after"))
+				if got, want := q.Get("order"), "asc"; got != want {
+					t.Errorf("expected order %q, got %q", want, got)
+				}
+				if got, want := q.Get("include"), "all"; got != want {
+					t.Errorf("expected include %q, got %q", want, got)
+				}
+				if got, want := q.Get("per_page"), "2"; got != want {
+					t.Errorf("expected per_page %q, got %q", want, got)
+				}
+				if got, want := q.Get("phrase"), tc.wantPhrase; got != want {
+					t.Errorf("expected phrase %q, got %q", want, got)
+				}
+			}
+			if diff := cmp.Diff(gotAfter, tc.wantAfter); diff != "" {
+				t.Errorf("requested cursors (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditlog
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/redact"
+	"github.com/abcxyz/pkg/cfgloader"
+	"github.com/abcxyz/pkg/cli"
+)
+
+// includes are the values accepted by the include parameter of the audit log
+// API.
+var includes = []string{"web", "git", "all"}
+
+// Config defines the set of environment variables required for running the
+// audit log job.
+type Config struct {
+	GitHubAppID            string `env:"GITHUB_APP_ID,required"`                              // The GitHub App ID
+	GitHubInstallID        string `env:"GITHUB_INSTALL_ID,required"`                          // The provisioned GitHub App Installation reference
+	GitHubPrivateKeySecret string `env:"GITHUB_PRIVATE_KEY_SECRET,required" sensitive:"true"` // The secret name & version containing the GitHub App private key
+	GitHubAPIURL           string `env:"GITHUB_API_URL,default=https://api.github.com"`       // The GitHub REST API endpoint
+
+	Organization string `env:"ORGANIZATION,required"` // The organization whose audit log is polled
+
+	ProjectID         string `env:"PROJECT_ID,required"`          // The project id where the tables live
+	DatasetID         string `env:"DATASET_ID,required"`          // The dataset id where the tables live
+	AuditLogTableID   string `env:"AUDIT_LOG_TABLE_ID,required"`  // The table_name of the audit log table
+	CheckpointTableID string `env:"CHECKPOINT_TABLE_ID,required"` // The table_name of the checkpoint table
+
+	Include  string `env:"AUDIT_LOG_INCLUDE,default=web"` // The event types of the audit log, web, git or all
+	Phrase   string `env:"AUDIT_LOG_PHRASE"`              // The search phrase the audit log entries are filtered by
+	PageSize int    `env:"PAGE_SIZE,default=100"`         // The number of audit log entries requested per page
+	MaxPages int    `env:"MAX_PAGES,default=0"`           // The maximum number of pages polled in a single run, unlimited when 0
+
+	BigQueryWriteMaxRetries   int           `env:"BIG_QUERY_WRITE_MAX_RETRIES,default=3"`       // The maximum number of retries of a failed BigQuery write
+	BigQueryWriteRetryBackoff time.Duration `env:"BIG_QUERY_WRITE_RETRY_BACKOFF,default=500ms"` // The backoff before the first retry of a failed BigQuery write
+}
+
+// Validate validates the audit log config after load.
+func (cfg *Config) Validate() error {
+	if cfg.GitHubAppID == "" {
+		return fmt.Errorf("GITHUB_APP_ID is required")
+	}
+
+	if cfg.GitHubInstallID == "" {
+		return fmt.Errorf("GITHUB_INSTALL_ID is required")
+	}
+
+	if cfg.GitHubPrivateKeySecret == "" {
+		return fmt.Errorf("GITHUB_PRIVATE_KEY_SECRET is required")
+	}
+
+	u, err := url.Parse(cfg.GitHubAPIURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse GITHUB_API_URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("GITHUB_API_URL must be an http(s) URL, got %q", cfg.GitHubAPIURL)
+	}
+
+	if cfg.Organization == "" {
+		return fmt.Errorf("ORGANIZATION is required")
+	}
+
+	if cfg.ProjectID == "" {
+		return fmt.Errorf("PROJECT_ID is required")
+	}
+
+	if cfg.DatasetID == "" {
+		return fmt.Errorf("DATASET_ID is required")
+	}
+
+	if cfg.AuditLogTableID == "" {
+		return fmt.Errorf("AUDIT_LOG_TABLE_ID is required")
+	}
+
+	if cfg.CheckpointTableID == "" {
+		return fmt.Errorf("CHECKPOINT_TABLE_ID is required")
+	}
+
+	if !slices.Contains(includes, cfg.Include) {
+		return fmt.Errorf("AUDIT_LOG_INCLUDE must be one of %q, got %q", includes, cfg.Include)
+	}
+
+	if cfg.PageSize <= 0 || cfg.PageSize > 100 {
+		return fmt.Errorf("PAGE_SIZE must be between 1 and 100, got %d", cfg.PageSize)
+	}
+
+	if cfg.MaxPages < 0 {
+		return fmt.Errorf("MAX_PAGES must be non-negative, got %d", cfg.MaxPages)
+	}
+
+	if cfg.BigQueryWriteMaxRetries < 0 {
+		return fmt.Errorf("BIG_QUERY_WRITE_MAX_RETRIES must be non-negative, got %d", cfg.BigQueryWriteMaxRetries)
+	}
+
+	if cfg.BigQueryWriteRetryBackoff <= 0 {
+		return fmt.Errorf("BIG_QUERY_WRITE_RETRY_BACKOFF must be positive, got %s", cfg.BigQueryWriteRetryBackoff)
+	}
+
+	return nil
+}
+
+// LogConfig returns the config for logging, with the values of sensitive
+// fields redacted.
+func (cfg *Config) LogConfig() map[string]any {
+	return redact.Fields(cfg)
+}
+
+// NewConfig creates a new Config from environment variables.
+func NewConfig(ctx context.Context) (*Config, error) {
+	return newConfig(ctx, envconfig.OsLookuper())
+}
+
+func newConfig(ctx context.Context, lu envconfig.Lookuper) (*Config, error) {
+	var cfg Config
+	if err := cfgloader.Load(ctx, &cfg, cfgloader.WithLookuper(lu)); err != nil {
+		return nil, fmt.Errorf("failed to parse audit log job config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// ToFlags binds the config to the [cli.FlagSet] and returns it.
+func (cfg *Config) ToFlags(set *cli.FlagSet) *cli.FlagSet {
+	f := set.NewSection("COMMON JOB OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:   "github-app-id",
+		Target: &cfg.GitHubAppID,
+		EnvVar: "GITHUB_APP_ID",
+		Usage:  `The provisioned GitHub App ID.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "github-install-id",
+		Target: &cfg.GitHubInstallID,
+		EnvVar: "GITHUB_INSTALL_ID",
+		Usage:  `The provisioned GitHub App installation ID.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "github-private-key-secret",
+		Target: &cfg.GitHubPrivateKeySecret,
+		EnvVar: "GITHUB_PRIVATE_KEY_SECRET",
+		Usage:  `The secret name & version containing the GitHub App private key.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "github-api-url",
+		Target:  &cfg.GitHubAPIURL,
+		EnvVar:  "GITHUB_API_URL",
+		Default: "https://api.github.com",
+		Usage:   `The REST API endpoint of GitHub, set it for a GitHub Enterprise Server instance.`,
+		Example: "https://ghe.example.com/api/v3",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "organization",
+		Target:  &cfg.Organization,
+		EnvVar:  "ORGANIZATION",
+		Usage:   `The organization whose audit log is polled. The GitHub App requires read access to the administration of the organization.`,
+		Example: "my-org",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "project-id",
+		Target: &cfg.ProjectID,
+		EnvVar: "PROJECT_ID",
+		Usage:  `Google Cloud project ID.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "dataset-id",
+		Target: &cfg.DatasetID,
+		EnvVar: "DATASET_ID",
+		Usage:  `BigQuery dataset ID.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "audit-log-table-id",
+		Target: &cfg.AuditLogTableID,
+		EnvVar: "AUDIT_LOG_TABLE_ID",
+		Usage: `The BigQuery table ID in the dataset that the audit log entries are written to, ` +
+			`with the document_id, action, actor, org, created and payload columns.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "checkpoint-table-id",
+		Target: &cfg.CheckpointTableID,
+		EnvVar: "CHECKPOINT_TABLE_ID",
+		Usage: `The checkpoint table ID within the dataset, with the same schema as the checkpoint ` +
+			`table of the retry service. The checkpoint is keyed by "audit-log/<organization>" ` +
+			`in the installation column, so the table can be shared with the retry service.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "audit-log-include",
+		Target:  &cfg.Include,
+		EnvVar:  "AUDIT_LOG_INCLUDE",
+		Default: "web",
+		Usage:   `The event types of the audit log to poll, one of "web", "git" or "all".`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "audit-log-phrase",
+		Target:  &cfg.Phrase,
+		EnvVar:  "AUDIT_LOG_PHRASE",
+		Usage:   `The search phrase the audit log entries are filtered by, in the syntax of the audit log search.`,
+		Example: "action:repo",
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "page-size",
+		Target:  &cfg.PageSize,
+		EnvVar:  "PAGE_SIZE",
+		Default: 100,
+		Usage:   `The number of audit log entries requested per page, at most 100.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "max-pages",
+		Target:  &cfg.MaxPages,
+		EnvVar:  "MAX_PAGES",
+		Default: 0,
+		Usage: `The maximum number of pages of audit log entries polled in a single run. ` +
+			`The next run continues from the checkpoint. Unlimited when 0.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "big-query-write-max-retries",
+		Target:  &cfg.BigQueryWriteMaxRetries,
+		EnvVar:  "BIG_QUERY_WRITE_MAX_RETRIES",
+		Default: 3,
+		Usage:   `The maximum number of retries of a BigQuery write that failed with a transient error. Writes are not retried when 0.`,
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "big-query-write-retry-backoff",
+		Target:  &cfg.BigQueryWriteRetryBackoff,
+		EnvVar:  "BIG_QUERY_WRITE_RETRY_BACKOFF",
+		Default: 500 * time.Millisecond,
+		Usage:   `The backoff before the first retry of a failed BigQuery write, it doubles with each retry.`,
+	})
+
+	return set
+}
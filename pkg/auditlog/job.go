@@ -0,0 +1,98 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditlog
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v61/github"
+	"golang.org/x/oauth2"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/bq"
+	"github.com/abcxyz/github-metrics-aggregator/pkg/retry"
+	"github.com/abcxyz/github-metrics-aggregator/pkg/version"
+	"github.com/abcxyz/pkg/githubauth"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// InstallationPermissions are the permissions requested for the access tokens
+// of the GitHub App installation, reading the audit log of an organization
+// requires read access to its administration.
+var InstallationPermissions = map[string]string{
+	"organization_administration": "read",
+}
+
+// ExecuteJob polls the audit log of the organization once, writing the new
+// entries to BigQuery.
+func ExecuteJob(ctx context.Context, cfg *Config) error {
+	logger := logging.FromContext(ctx)
+
+	putRetry := &bq.PutRetryConfig{
+		MaxRetries:     uint64(cfg.BigQueryWriteMaxRetries),
+		InitialBackoff: cfg.BigQueryWriteRetryBackoff,
+	}
+
+	bqClient, err := bq.NewBigQuery(ctx, cfg.ProjectID, cfg.DatasetID)
+	if err != nil {
+		return fmt.Errorf("failed to create bigquery client: %w", err)
+	}
+	defer bqClient.Close()
+
+	checkpointer, err := retry.NewBigQuery(ctx, cfg.ProjectID, cfg.DatasetID, putRetry)
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint datastore: %w", err)
+	}
+	defer checkpointer.Close()
+
+	app, err := githubauth.NewApp(cfg.GitHubAppID, cfg.GitHubPrivateKeySecret)
+	if err != nil {
+		return fmt.Errorf("failed to create github app: %w", err)
+	}
+
+	installation, err := app.InstallationForID(ctx, cfg.GitHubInstallID)
+	if err != nil {
+		return fmt.Errorf("failed to get github app installation: %w", err)
+	}
+
+	baseURL, err := url.Parse(strings.TrimSuffix(cfg.GitHubAPIURL, "/") + "/")
+	if err != nil {
+		return fmt.Errorf("failed to parse github api url: %w", err)
+	}
+	ts := installation.AllReposOAuth2TokenSource(ctx, InstallationPermissions)
+	client := github.NewClient(oauth2.NewClient(ctx, ts))
+	client.BaseURL = baseURL
+
+	logger.InfoContext(ctx, "audit log job starting",
+		"name", version.Name,
+		"commit", version.Commit,
+		"version", version.Version)
+
+	poller := NewPoller(client.Organizations, checkpointer, bqClient.Putter(cfg.AuditLogTableID), putRetry, cfg)
+	result, err := poller.Poll(ctx)
+	if result != nil {
+		logger.InfoContext(ctx, "polled audit log",
+			"organization", cfg.Organization,
+			"pages", result.Pages,
+			"entries", result.Entries,
+			"checkpoint", result.Checkpoint)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to poll audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/sethvargo/go-retry"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+const (
+	// addColumnsMaxRetries is the maximum number of retries of an insert after
+	// the missing columns were added, until the new columns are visible to
+	// streaming inserts.
+	addColumnsMaxRetries = 5
+
+	// addColumnsBackoff is the backoff before the first retry of an insert
+	// after the missing columns were added, it doubles with each retry.
+	addColumnsBackoff = 2 * time.Second
+)
+
+// missingColumns returns the names of the columns that the rows of a failed
+// insert have, but the table does not. BigQuery rejects these rows with a "no
+// such field" error located at the column. Only top-level columns are
+// returned, as nested fields can't be added with ADD COLUMN.
+func missingColumns(err error) []string {
+	var multiErr bigquery.PutMultiError
+	if !errors.As(err, &multiErr) {
+		return nil
+	}
+
+	var names []string
+	for _, rowErr := range multiErr {
+		for _, err := range rowErr.Errors {
+			var bqErr *bigquery.Error
+			if !errors.As(err, &bqErr) {
+				continue
+			}
+			if bqErr.Reason != "invalid" || !strings.HasPrefix(bqErr.Message, "no such field") {
+				continue
+			}
+			if bqErr.Location == "" || strings.Contains(bqErr.Location, ".") {
+				continue
+			}
+			if !slices.Contains(names, bqErr.Location) {
+				names = append(names, bqErr.Location)
+			}
+		}
+	}
+	return names
+}
+
+// addColumnsStatement returns the statement that adds the fields of the
+// schema with the given names to the table, a fully qualified table name of
+// the form project.dataset.table. The columns are added as nullable, since
+// BigQuery does not allow adding required columns to a table.
+func addColumnsStatement(table string, schema bigquery.Schema, names []string) (string, error) {
+	clauses := make([]string, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(schema, func(f *bigquery.FieldSchema) bool { return f.Name == name })
+		if i < 0 {
+			return "", fmt.Errorf("column %q is not a field of the rows", name)
+		}
+		typ, err := columnType(schema[i])
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, fmt.Sprintf("ADD COLUMN IF NOT EXISTS `%s` %s", name, typ))
+	}
+	return fmt.Sprintf("ALTER TABLE `%s` %s", table, strings.Join(clauses, ", ")), nil
+}
+
+// columnTypes maps the field types of a schema to the types of the
+// corresponding columns.
+var columnTypes = map[bigquery.FieldType]string{
+	bigquery.StringFieldType:     "STRING",
+	bigquery.BytesFieldType:      "BYTES",
+	bigquery.IntegerFieldType:    "INT64",
+	bigquery.FloatFieldType:      "FLOAT64",
+	bigquery.BooleanFieldType:    "BOOL",
+	bigquery.TimestampFieldType:  "TIMESTAMP",
+	bigquery.DateFieldType:       "DATE",
+	bigquery.TimeFieldType:       "TIME",
+	bigquery.DateTimeFieldType:   "DATETIME",
+	bigquery.NumericFieldType:    "NUMERIC",
+	bigquery.BigNumericFieldType: "BIGNUMERIC",
+	bigquery.GeographyFieldType:  "GEOGRAPHY",
+	bigquery.IntervalFieldType:   "INTERVAL",
+	bigquery.JSONFieldType:       "JSON",
+}
+
+// columnType returns the type of the column of the field, records are structs
+// of their fields and repeated fields are arrays.
+func columnType(f *bigquery.FieldSchema) (string, error) {
+	var typ string
+	if f.Type == bigquery.RecordFieldType {
+		fields := make([]string, 0, len(f.Schema))
+		for _, nested := range f.Schema {
+			nestedType, err := columnType(nested)
+			if err != nil {
+				return "", err
+			}
+			fields = append(fields, fmt.Sprintf("`%s` %s", nested.Name, nestedType))
+		}
+		typ = fmt.Sprintf("STRUCT<%s>", strings.Join(fields, ", "))
+	} else {
+		var ok bool
+		typ, ok = columnTypes[f.Type]
+		if !ok {
+			return "", fmt.Errorf("column %q has unsupported type %s", f.Name, f.Type)
+		}
+	}
+
+	if f.Repeated {
+		return fmt.Sprintf("ARRAY<%s>", typ), nil
+	}
+	return typ, nil
+}
+
+// putAddingMissingColumns inserts src with the putter like [PutWithRetry]. If
+// the insert fails because the table lacks columns of the rows, the columns
+// are added with addColumns and the insert is retried until the new columns
+// are visible, starting after the given backoff.
+func putAddingMissingColumns(ctx context.Context, putter Putter, src any, cfg *PutRetryConfig, backoff time.Duration, addColumns func(ctx context.Context, names []string) error) error {
+	err := PutWithRetry(ctx, putter, src, cfg)
+	names := missingColumns(err)
+	if len(names) == 0 {
+		return err
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.InfoContext(ctx, "adding missing columns to table",
+		"columns", names)
+	if err := addColumns(ctx, names); err != nil {
+		return fmt.Errorf("failed to add missing columns %v: %w", names, err)
+	}
+
+	var attempt int
+	if err := retry.Do(ctx, retry.WithMaxRetries(addColumnsMaxRetries, retry.NewExponential(backoff)), func(ctx context.Context) error {
+		attempt++
+		err := PutWithRetry(ctx, putter, src, cfg)
+		if err == nil {
+			return nil
+		}
+		// the new columns take a while to be visible to streaming inserts
+		if len(missingColumns(err)) > 0 {
+			logger.WarnContext(ctx, "added columns are not visible yet, retrying",
+				"attempt", attempt,
+				"error", err)
+			return retry.RetryableError(err)
+		}
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to put rows after adding missing columns: %w", err)
+	}
+	return nil
+}
+
+// addColumns adds the fields of the schema with the given names to the table
+// as nullable columns.
+func (bq *BigQuery) addColumns(ctx context.Context, tableID string, schema bigquery.Schema, names []string) error {
+	stmt, err := addColumnsStatement(fmt.Sprintf("%s.%s.%s", bq.ProjectID, bq.DatasetID, tableID), schema, names)
+	if err != nil {
+		return err
+	}
+
+	job, err := bq.client.Query(stmt).Run(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start query %q: %w", stmt, err)
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for query job %s: %w", job.ID(), err)
+	}
+	if err := status.Err(); err != nil {
+		return fmt.Errorf("query %q failed: %w", stmt, err)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+type testEvolvedRow struct {
+	Name      string                `bigquery:"name"`
+	Count     int                   `bigquery:"count"`
+	Score     bigquery.NullFloat64  `bigquery:"score"`
+	Labels    []string              `bigquery:"labels"`
+	MergedAt  bigquery.NullDateTime `bigquery:"merged_at"`
+	Approvals []*testEvolvedNested  `bigquery:"approvals"`
+}
+
+type testEvolvedNested struct {
+	Login    string `bigquery:"login"`
+	Approved bool   `bigquery:"approved"`
+}
+
+// noSuchField returns the error of a row that has a field the table lacks.
+func noSuchField(row int, location string) bigquery.RowInsertionError {
+	return bigquery.RowInsertionError{
+		RowIndex: row,
+		Errors: bigquery.MultiError{&bigquery.Error{
+			Location: location,
+			Message:  fmt.Sprintf("no such field: %s.", location),
+			Reason:   "invalid",
+		}},
+	}
+}
+
+func TestMissingColumns(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		err  error
+		want []string
+	}{
+		{
+			name: "no_error",
+		},
+		{
+			name: "other_error",
+			err:  errors.New("backend unavailable"),
+		},
+		{
+			name: "missing_columns",
+			err: fmt.Errorf("failed to put rows: %w", bigquery.PutMultiError{
+				noSuchField(0, "score"),
+				noSuchField(1, "score"),
+				noSuchField(1, "labels"),
+			}),
+			want: []string{"score", "labels"},
+		},
+		{
+			name: "nested_field_ignored",
+			err:  bigquery.PutMultiError{noSuchField(0, "approvals.approved")},
+		},
+		{
+			name: "other_row_error_ignored",
+			err: bigquery.PutMultiError{{
+				RowIndex: 0,
+				Errors: bigquery.MultiError{&bigquery.Error{
+					Location: "count",
+					Message:  "Cannot convert value to integer.",
+					Reason:   "invalid",
+				}},
+			}},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(missingColumns(tc.err), tc.want); diff != "" {
+				t.Errorf("missing columns (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAddColumnsStatement(t *testing.T) {
+	t.Parallel()
+
+	schema, err := bigquery.InferSchema(testEvolvedRow{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		names   []string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "scalar_columns",
+			names: []string{"count", "score", "merged_at"},
+			want:  "ALTER TABLE `test-project.test-dataset.test-table` ADD COLUMN IF NOT EXISTS `count` INT64, ADD COLUMN IF NOT EXISTS `score` FLOAT64, ADD COLUMN IF NOT EXISTS `merged_at` DATETIME",
+		},
+		{
+			name:  "repeated_column",
+			names: []string{"labels"},
+			want:  "ALTER TABLE `test-project.test-dataset.test-table` ADD COLUMN IF NOT EXISTS `labels` ARRAY<STRING>",
+		},
+		{
+			name:  "repeated_record_column",
+			names: []string{"approvals"},
+			want:  "ALTER TABLE `test-project.test-dataset.test-table` ADD COLUMN IF NOT EXISTS `approvals` ARRAY<STRUCT<`login` STRING, `approved` BOOL>>",
+		},
+		{
+			name:    "unknown_column",
+			names:   []string{"unknown"},
+			wantErr: `column "unknown" is not a field of the rows`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := addColumnsStatement("test-project.test-dataset.test-table", schema, tc.names)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q to be %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPutAddingMissingColumns(t *testing.T) {
+	t.Parallel()
+
+	missingScore := bigquery.PutMultiError{noSuchField(0, "score")}
+	rows := []*testEvolvedRow{{Name: "a"}}
+	retryConfig := &PutRetryConfig{MaxRetries: 0}
+
+	cases := []struct {
+		name      string
+		errs      []error
+		addErr    error
+		wantAdded []string
+		wantCalls int
+		wantErr   string
+	}{
+		{
+			name:      "no_missing_columns",
+			wantCalls: 1,
+		},
+		{
+			name:      "columns_added_then_retried",
+			errs:      []error{missingScore},
+			wantAdded: []string{"score"},
+			wantCalls: 2,
+		},
+		{
+			name:      "retried_until_columns_visible",
+			errs:      []error{missingScore, missingScore, missingScore},
+			wantAdded: []string{"score"},
+			wantCalls: 4,
+		},
+		{
+			name:      "adding_columns_fails",
+			errs:      []error{missingScore},
+			addErr:    errors.New("access denied"),
+			wantAdded: []string{"score"},
+			wantCalls: 1,
+			wantErr:   "failed to add missing columns [score]: access denied",
+		},
+		{
+			name:      "other_error_not_retried",
+			errs:      []error{missingScore, errors.New("invalid value")},
+			wantAdded: []string{"score"},
+			wantCalls: 2,
+			wantErr:   "invalid value",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			putter := &fakePutter{errs: tc.errs}
+			var added []string
+			err := putAddingMissingColumns(context.Background(), putter, rows, retryConfig, time.Millisecond, func(ctx context.Context, names []string) error {
+				added = append(added, names...)
+				return tc.addErr
+			})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(added, tc.wantAdded); diff != "" {
+				t.Errorf("added columns (-got,+want):\n%s", diff)
+			}
+			if got, want := putter.calls, tc.wantCalls; got != want {
+				t.Errorf("expected %d calls to Put, got %d", want, got)
+			}
+		})
+	}
+}
@@ -15,9 +15,12 @@
 package bq
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 
 	"cloud.google.com/go/bigquery"
 	"google.golang.org/api/iterator"
@@ -31,6 +34,11 @@ type BigQuery struct {
 	ProjectID string
 	DatasetID string
 	client    *bigquery.Client
+
+	// AddMissingColumns adds the columns of fields that the rows have but the
+	// table lacks, e.g. after a field was added to the row struct, instead of
+	// failing the write until the table is altered manually.
+	AddMissingColumns bool
 }
 
 // NewBigQuery creates a new instance of a BigQuery client.
@@ -76,6 +84,12 @@ func Query[T any](ctx context.Context, bq *BigQuery, queryString string) ([]*T,
 	return rowsToSlice[T](rows, rows.TotalRows)
 }
 
+// Putter returns a [Putter] inserting rows into the table of the dataset, to
+// be used with [PutWithRetry].
+func (bq *BigQuery) Putter(tableID string) Putter {
+	return bq.client.Dataset(bq.DatasetID).Table(tableID).Inserter()
+}
+
 func Write[T any](ctx context.Context, bq *BigQuery, tableID string, rows []*T) error {
 	logger := logging.FromContext(ctx)
 	logger.DebugContext(ctx, "writing rows",
@@ -84,12 +98,97 @@ func Write[T any](ctx context.Context, bq *BigQuery, tableID string, rows []*T)
 		"table_id", tableID,
 		"num_rows", len(rows),
 	)
-	if err := bq.client.Dataset(bq.DatasetID).Table(tableID).Inserter().Put(ctx, rows); err != nil {
+	putter := bq.client.Dataset(bq.DatasetID).Table(tableID).Inserter()
+	if !bq.AddMissingColumns {
+		if err := PutWithRetry(ctx, putter, rows, nil); err != nil {
+			return fmt.Errorf("failed to write to BigQuery: %w", err)
+		}
+		return nil
+	}
+
+	schema, err := bigquery.InferSchema(new(T))
+	if err != nil {
+		return fmt.Errorf("failed to infer schema: %w", err)
+	}
+	if err := putAddingMissingColumns(ctx, putter, rows, nil, addColumnsBackoff, func(ctx context.Context, names []string) error {
+		return bq.addColumns(ctx, tableID, schema, names)
+	}); err != nil {
 		return fmt.Errorf("failed to write to BigQuery: %w", err)
 	}
 	return nil
 }
 
+// Load writes the rows to the table with a load job rather than streaming
+// them like [Write]. The write disposition decides whether the rows are
+// appended to the table or replace its contents, the table is created if it
+// does not exist.
+func Load[T any](ctx context.Context, bq *BigQuery, tableID string, rows []*T, disposition bigquery.TableWriteDisposition) error {
+	logger := logging.FromContext(ctx)
+	logger.DebugContext(ctx, "loading rows",
+		"project_id", bq.client.Project(),
+		"dataset_id", bq.DatasetID,
+		"table_id", tableID,
+		"num_rows", len(rows),
+		"write_disposition", disposition,
+	)
+
+	schema, err := bigquery.InferSchema(new(T))
+	if err != nil {
+		return fmt.Errorf("failed to infer schema: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeRows(&buf, schema, rows); err != nil {
+		return err
+	}
+	src := bigquery.NewReaderSource(&buf)
+	src.SourceFormat = bigquery.JSON
+	src.Schema = schema
+
+	job, err := newLoader(bq.client.Dataset(bq.DatasetID).Table(tableID), src, disposition, bq.AddMissingColumns).Run(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start load job: %w", err)
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for load job %s: %w", job.ID(), err)
+	}
+	if err := status.Err(); err != nil {
+		return fmt.Errorf("load job %s failed: %w", job.ID(), err)
+	}
+	return nil
+}
+
+// newLoader returns a loader of the source into the table with the given write
+// disposition. Appending rows adds the columns the table lacks if
+// addMissingColumns is set, replaced tables take the schema of the source
+// anyway.
+func newLoader(table *bigquery.Table, src bigquery.LoadSource, disposition bigquery.TableWriteDisposition, addMissingColumns bool) *bigquery.Loader {
+	loader := table.LoaderFrom(src)
+	loader.CreateDisposition = bigquery.CreateIfNeeded
+	loader.WriteDisposition = disposition
+	if addMissingColumns && disposition == bigquery.WriteAppend {
+		loader.SchemaUpdateOptions = []string{"ALLOW_FIELD_ADDITION"}
+	}
+	return loader
+}
+
+// encodeRows writes the rows as newline delimited JSON, with the columns named
+// after their bigquery tags as they are when streamed.
+func encodeRows[T any](w io.Writer, schema bigquery.Schema, rows []*T) error {
+	enc := json.NewEncoder(w)
+	for i, row := range rows {
+		values, _, err := (&bigquery.StructSaver{Struct: row, Schema: schema}).Save()
+		if err != nil {
+			return fmt.Errorf("failed to convert row %d: %w", i, err)
+		}
+		if err := enc.Encode(values); err != nil {
+			return fmt.Errorf("failed to encode row %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
 type rowItr[T any] interface {
 	Next(t interface{}) error
 }
@@ -15,11 +15,16 @@
 package bq
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/bigquery"
 	"github.com/google/go-cmp/cmp"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 )
 
 type TestStruct struct {
@@ -126,3 +131,107 @@ func TestRowsToSlice(t *testing.T) {
 		})
 	}
 }
+
+type testNested struct {
+	Name string `bigquery:"name"`
+}
+
+type testLoadRow struct {
+	ID      string      `bigquery:"id"`
+	Created time.Time   `bigquery:"created"`
+	Labels  []string    `bigquery:"labels"`
+	Nested  *testNested `bigquery:"nested,nullable"`
+}
+
+func TestEncodeRows(t *testing.T) {
+	t.Parallel()
+
+	schema, err := bigquery.InferSchema(new(testLoadRow))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []*testLoadRow{
+		{
+			ID:      "a",
+			Created: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+			Labels:  []string{"x", "y"},
+			Nested:  &testNested{Name: "n"},
+		},
+		{
+			ID:      "b",
+			Created: time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := encodeRows(&buf, schema, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"created":"2024-03-01T12:00:00Z","id":"a","labels":["x","y"],"nested":{"name":"n"}}
+{"created":"2024-03-02T12:00:00Z","id":"b"}
+`
+	if diff := cmp.Diff(buf.String(), want); diff != "" {
+		t.Errorf("unexpected rows (-got, +want):\n%s", diff)
+	}
+}
+
+func TestNewLoader(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name                 string
+		disposition          bigquery.TableWriteDisposition
+		addMissingColumns    bool
+		wantSchemaUpdateOpts []string
+	}{
+		{
+			name:        "append",
+			disposition: bigquery.WriteAppend,
+		},
+		{
+			name:        "truncate",
+			disposition: bigquery.WriteTruncate,
+		},
+		{
+			name:                 "append_adding_missing_columns",
+			disposition:          bigquery.WriteAppend,
+			addMissingColumns:    true,
+			wantSchemaUpdateOpts: []string{"ALLOW_FIELD_ADDITION"},
+		},
+		{
+			name:              "truncate_adding_missing_columns",
+			disposition:       bigquery.WriteTruncate,
+			addMissingColumns: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := bigquery.NewClient(context.Background(), "test-project", option.WithoutAuthentication())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { client.Close() })
+
+			table := client.Dataset("test-dataset").Table("test-table")
+			loader := newLoader(table, bigquery.NewReaderSource(&bytes.Buffer{}), tc.disposition, tc.addMissingColumns)
+			if got, want := loader.WriteDisposition, tc.disposition; got != want {
+				t.Errorf("expected write disposition %q, got %q", want, got)
+			}
+			if got, want := loader.CreateDisposition, bigquery.CreateIfNeeded; got != want {
+				t.Errorf("expected create disposition %q, got %q", want, got)
+			}
+			if got, want := loader.Dst.TableID, "test-table"; got != want {
+				t.Errorf("expected destination table %q, got %q", want, got)
+			}
+			if diff := cmp.Diff(loader.SchemaUpdateOptions, tc.wantSchemaUpdateOpts); diff != "" {
+				t.Errorf("schema update options (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sethvargo/go-retry"
+	"google.golang.org/api/googleapi"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// DefaultPutRetryConfig is the retry configuration of inserts used when none
+// is configured.
+var DefaultPutRetryConfig = &PutRetryConfig{
+	MaxRetries:     3,
+	InitialBackoff: 500 * time.Millisecond,
+}
+
+// PutRetryConfig configures the retries of inserts that failed with a
+// transient error.
+type PutRetryConfig struct {
+	// MaxRetries is the maximum number of retries of a failed insert. A failed
+	// insert is not retried when 0.
+	MaxRetries uint64
+
+	// InitialBackoff is the backoff before the first retry, it doubles with
+	// each retry.
+	InitialBackoff time.Duration
+}
+
+// Putter inserts rows into a table, it is implemented by [bigquery.Inserter].
+type Putter interface {
+	Put(ctx context.Context, src any) error
+}
+
+// PutWithRetry inserts src with the putter, retrying transient errors with an
+// exponential backoff. It stops retrying once the context is done. The default
+// retry configuration is used if cfg is nil.
+func PutWithRetry(ctx context.Context, putter Putter, src any, cfg *PutRetryConfig) error {
+	if cfg == nil {
+		cfg = DefaultPutRetryConfig
+	}
+
+	if cfg.MaxRetries == 0 {
+		if err := putter.Put(ctx, src); err != nil {
+			return fmt.Errorf("failed to put rows: %w", err)
+		}
+		return nil
+	}
+
+	logger := logging.FromContext(ctx)
+	backoff := retry.WithMaxRetries(cfg.MaxRetries, retry.NewExponential(cfg.InitialBackoff))
+
+	var attempt int
+	if err := retry.Do(ctx, backoff, func(ctx context.Context) error {
+		attempt++
+		err := putter.Put(ctx, src)
+		if err == nil {
+			return nil
+		}
+		if !isRetryablePutError(err) {
+			return err
+		}
+		logger.WarnContext(ctx, "failed to put rows, retrying",
+			"attempt", attempt,
+			"error", err)
+		return retry.RetryableError(err)
+	}); err != nil {
+		return fmt.Errorf("failed to put rows after %d attempts: %w", attempt, err)
+	}
+	return nil
+}
+
+// isRetryablePutError reports whether a failed insert may succeed when
+// retried. Errors of individual rows are not retried, as they fail again.
+func isRetryablePutError(err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= http.StatusInternalServerError
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bq
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/googleapi"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// fakePutter fails the first calls to Put with the given errors and records
+// the rows of the first successful call.
+type fakePutter struct {
+	errs  []error
+	calls int
+	rows  any
+}
+
+func (p *fakePutter) Put(ctx context.Context, src any) error {
+	p.calls++
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return err
+	}
+	p.rows = src
+	return nil
+}
+
+func TestPutWithRetry(t *testing.T) {
+	t.Parallel()
+
+	unavailable := &googleapi.Error{Code: http.StatusServiceUnavailable, Message: "backend unavailable"}
+	rows := []*TestStruct{{StringField: "a", IntField: 1}}
+	retryConfig := &PutRetryConfig{MaxRetries: 3, InitialBackoff: time.Millisecond}
+
+	cases := []struct {
+		name      string
+		errs      []error
+		cfg       *PutRetryConfig
+		wantCalls int
+		wantRows  any
+		wantErr   string
+	}{
+		{
+			name:      "success",
+			cfg:       retryConfig,
+			wantCalls: 1,
+			wantRows:  rows,
+		},
+		{
+			name:      "fails_twice_then_succeeds",
+			errs:      []error{unavailable, unavailable},
+			cfg:       retryConfig,
+			wantCalls: 3,
+			wantRows:  rows,
+		},
+		{
+			name:      "retries_exhausted",
+			errs:      []error{unavailable, unavailable, unavailable, unavailable},
+			cfg:       retryConfig,
+			wantCalls: 4,
+			wantErr:   "failed to put rows after 4 attempts",
+		},
+		{
+			name:      "not_retried_when_disabled",
+			errs:      []error{unavailable},
+			cfg:       &PutRetryConfig{},
+			wantCalls: 1,
+			wantErr:   "failed to put rows: googleapi: Error 503: backend unavailable",
+		},
+		{
+			name:      "row_errors_not_retried",
+			errs:      []error{bigquery.PutMultiError{{RowIndex: 0}}},
+			cfg:       retryConfig,
+			wantCalls: 1,
+			wantErr:   "1 row insertion failed",
+		},
+		{
+			name:      "client_errors_not_retried",
+			errs:      []error{&googleapi.Error{Code: http.StatusNotFound}, unavailable},
+			cfg:       retryConfig,
+			wantCalls: 1,
+			wantErr:   "HTTP response code 404",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			putter := &fakePutter{errs: tc.errs}
+			err := PutWithRetry(context.Background(), putter, rows, tc.cfg)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if got, want := putter.calls, tc.wantCalls; got != want {
+				t.Errorf("expected %d calls to Put, got %d", want, got)
+			}
+			if diff := cmp.Diff(putter.rows, tc.wantRows); diff != "" {
+				t.Errorf("written rows (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPutWithRetry_ContextDone(t *testing.T) {
+	t.Parallel()
+
+	// the context is done while waiting to retry
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	t.Cleanup(cancel)
+
+	putter := &fakePutter{errs: []error{fmt.Errorf("wrapped: %w", &googleapi.Error{Code: http.StatusServiceUnavailable})}}
+	err := PutWithRetry(ctx, putter, []*TestStruct{}, &PutRetryConfig{MaxRetries: 3, InitialBackoff: time.Hour})
+	if diff := testutil.DiffErrString(err, "context deadline exceeded"); diff != "" {
+		t.Fatal(diff)
+	}
+	if got, want := putter.calls, 1; got != want {
+		t.Errorf("expected %d calls to Put, got %d", want, got)
+	}
+}
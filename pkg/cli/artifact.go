@@ -75,9 +75,9 @@ func (c *ArtifactJobCommand) Run(ctx context.Context, args []string) error {
 	if err := c.cfg.Validate(); err != nil {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
-	logger.DebugContext(ctx, "loaded configuration", "config", c.cfg)
+	logger.InfoContext(ctx, "loaded configuration", "config", c.cfg.LogConfig())
 
-	if err := artifact.ExecuteJob(ctx, c.cfg); err != nil {
+	if err := artifact.ExecuteJob(ctx, c.cfg, nil); err != nil {
 		logger.ErrorContext(ctx, "error executing artifact job", "error", err)
 		return fmt.Errorf("job execution failed: %w", err)
 	}
@@ -0,0 +1,245 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/artifact"
+	"github.com/abcxyz/github-metrics-aggregator/pkg/githubclient"
+	"github.com/abcxyz/github-metrics-aggregator/pkg/review"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/githubauth"
+)
+
+// The pipelines whose GitHub App permissions can be checked.
+const (
+	pipelineArtifact = "artifact"
+	pipelineReview   = "review"
+)
+
+// pipelines are the names of the pipelines that can be checked, in the order
+// they are reported.
+var pipelines = []string{pipelineArtifact, pipelineReview}
+
+var _ cli.Command = (*CheckAuthCommand)(nil)
+
+// The CheckAuthCommand validates the GitHub App credentials and reports
+// whether the installation is granted the permissions the pipelines require.
+type CheckAuthCommand struct {
+	cli.BaseCommand
+
+	gitHubAppID             string
+	gitHubInstallID         string
+	gitHubPrivateKey        string
+	gitHubAPIURL            string
+	pipelines               []string
+	includeBranchProtection bool
+	breakGlassIssueSource   string
+	requiredDistinctTeams   int
+	requireCodeOwners       bool
+	enrichActorTeams        bool
+
+	// testFlagSetOpts is only used for testing.
+	testFlagSetOpts []cli.Option
+}
+
+func (c *CheckAuthCommand) Desc() string {
+	return `Validate the GitHub App credentials and permissions`
+}
+
+func (c *CheckAuthCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+	Validate the GitHub App credentials by minting an installation access
+	token, and report whether the installation is granted the permissions
+	required by each pipeline. Exits with an error listing the missing
+	permissions if any are missing.
+`
+}
+
+func (c *CheckAuthCommand) Flags() *cli.FlagSet {
+	set := cli.NewFlagSet(c.testFlagSetOpts...)
+
+	f := set.NewSection("GITHUB OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:   "github-app-id",
+		Target: &c.gitHubAppID,
+		EnvVar: "GITHUB_APP_ID",
+		Usage:  `The provisioned GitHub App ID.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "github-install-id",
+		Target: &c.gitHubInstallID,
+		EnvVar: "GITHUB_INSTALL_ID",
+		Usage:  `The provisioned GitHub App installation ID.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "github-private-key",
+		Target: &c.gitHubPrivateKey,
+		EnvVar: "GITHUB_PRIVATE_KEY",
+		Usage:  `The private key generated to call GitHub.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "github-api-url",
+		Target:  &c.gitHubAPIURL,
+		EnvVar:  "GITHUB_API_URL",
+		Default: "https://api.github.com",
+		Usage:   `The REST API endpoint of GitHub, set it for a GitHub Enterprise Server instance.`,
+		Example: "https://ghe.example.com/api/v3",
+	})
+
+	f = set.NewSection("CHECK OPTIONS")
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:   "pipeline",
+		Target: &c.pipelines,
+		Usage: fmt.Sprintf(`The pipeline to check the permissions of, one of %s. Can be repeated. `+
+			`All pipelines are checked when unset.`, strings.Join(pipelines, ", ")),
+		Example: pipelineArtifact,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "include-branch-protection",
+		Target:  &c.includeBranchProtection,
+		EnvVar:  "INCLUDE_BRANCH_PROTECTION",
+		Default: false,
+		Usage:   `Whether the review pipeline records branch protection, which requires read access to the administration of the repositories.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "break-glass-issue-source",
+		Target:  &c.breakGlassIssueSource,
+		EnvVar:  "BREAK_GLASS_ISSUE_SOURCE",
+		Default: review.BreakGlassIssueSourceBigQuery,
+		Usage:   `Where the review pipeline reads break glass issues from, the github source requires read access to issues.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "enrich-actor-teams",
+		Target:  &c.enrichActorTeams,
+		EnvVar:  "ENRICH_ACTOR_TEAMS",
+		Default: false,
+		Usage:   `Whether the artifact pipeline records the teams of the actors of workflow runs, which requires read access to the organization members.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "required-distinct-teams",
+		Target:  &c.requiredDistinctTeams,
+		EnvVar:  "REQUIRED_DISTINCT_TEAMS",
+		Default: 0,
+		Usage:   `The number of distinct teams the review pipeline requires approving reviewers from, more than 0 requires read access to the organization members.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "require-code-owner-approval",
+		Target:  &c.requireCodeOwners,
+		EnvVar:  "REQUIRE_CODE_OWNER_APPROVAL",
+		Default: false,
+		Usage:   `Whether the review pipeline requires approvals from code owners, which requires read access to the organization members to expand team owners.`,
+	})
+
+	return set
+}
+
+func (c *CheckAuthCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	args = f.Args()
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %q", args)
+	}
+
+	if c.gitHubAppID == "" {
+		return fmt.Errorf("GITHUB_APP_ID is required")
+	}
+	if c.gitHubInstallID == "" {
+		return fmt.Errorf("GITHUB_INSTALL_ID is required")
+	}
+	if c.gitHubPrivateKey == "" {
+		return fmt.Errorf("GITHUB_PRIVATE_KEY is required")
+	}
+
+	checked := c.pipelines
+	if len(checked) == 0 {
+		checked = pipelines
+	}
+	for _, pipeline := range checked {
+		if !slices.Contains(pipelines, pipeline) {
+			return fmt.Errorf("unknown pipeline %q, must be one of %s", pipeline, strings.Join(pipelines, ", "))
+		}
+	}
+
+	app, err := githubauth.NewApp(c.gitHubAppID, c.gitHubPrivateKey, githubauth.WithBaseURL(c.gitHubAPIURL))
+	if err != nil {
+		return fmt.Errorf("failed to create github app: %w", err)
+	}
+
+	granted, err := githubclient.InstallationPermissions(ctx, app, c.gitHubAPIURL, c.gitHubInstallID)
+	if err != nil {
+		return fmt.Errorf("failed to get github app installation permissions: %w", err)
+	}
+
+	// minting a token verifies the installation can actually be used, e.g. that
+	// it is not suspended
+	installation, err := app.InstallationForID(ctx, c.gitHubInstallID)
+	if err != nil {
+		return fmt.Errorf("failed to get github app installation: %w", err)
+	}
+	if _, err := installation.AllReposTokenSource(granted).GitHubToken(ctx); err != nil {
+		return fmt.Errorf("failed to get github token: %w", err)
+	}
+
+	var failed []string
+	for _, pipeline := range checked {
+		missing := githubclient.MissingPermissions(granted, c.requiredPermissions(pipeline))
+		if len(missing) == 0 {
+			c.Outf("%s: ok", pipeline)
+			continue
+		}
+		c.Outf("%s: missing %s", pipeline, strings.Join(missing, ", "))
+		failed = append(failed, fmt.Sprintf("%s (%s)", pipeline, strings.Join(missing, ", ")))
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("github app installation is missing permissions for %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// requiredPermissions returns the permissions the GitHub App installation must
+// be granted to run the pipeline.
+func (c *CheckAuthCommand) requiredPermissions(pipeline string) map[string]string {
+	if pipeline == pipelineReview {
+		return review.InstallationPermissions(&review.Config{
+			IncludeBranchProtection:  c.includeBranchProtection,
+			BreakGlassIssueSource:    c.breakGlassIssueSource,
+			RequiredDistinctTeams:    c.requiredDistinctTeams,
+			RequireCodeOwnerApproval: c.requireCodeOwners,
+		})
+	}
+	return artifact.RequiredPermissions(&artifact.Config{
+		EnrichActorTeams: c.enrichActorTeams,
+	})
+}
@@ -0,0 +1,248 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sethvargo/go-envconfig"
+
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// newFakeGitHubApps starts a server serving the GitHub API endpoints of the
+// installation with the given ID, which is granted the given permissions.
+// Minting access tokens fails with tokenStatus if it is not 201.
+func newFakeGitHubApps(t *testing.T, installationID string, permissions map[string]string, tokenStatus int) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("GET /app/installations/"+installationID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]any{
+			"id":                1,
+			"access_tokens_url": fmt.Sprintf("%s/app/installations/%s/access_tokens", server.URL, installationID),
+			"permissions":       permissions,
+		}); err != nil {
+			t.Errorf("failed to write installation: %v", err)
+		}
+	})
+	mux.HandleFunc("POST /app/installations/"+installationID+"/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(tokenStatus)
+		fmt.Fprint(w, `{"token": "test-token"}`)
+	})
+
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckAuthCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate private key: %v", err)
+	}
+	privateKeyPEM := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}))
+
+	allPermissions := map[string]string{
+		"actions":        "read",
+		"administration": "read",
+		"contents":       "read",
+		"members":        "read",
+		"pull_requests":  "write",
+	}
+
+	cases := []struct {
+		name        string
+		args        []string
+		permissions map[string]string
+		tokenStatus int
+		expErr      string
+		expStdout   string
+	}{
+		{
+			name:        "all_granted",
+			permissions: allPermissions,
+			expStdout: `artifact: ok
+review: ok
+`,
+		},
+		{
+			name: "artifact_missing_permission",
+			permissions: map[string]string{
+				"actions":       "read",
+				"contents":      "read",
+				"members":       "read",
+				"pull_requests": "read",
+			},
+			expErr: "github app installation is missing permissions for artifact (pull_requests:write)",
+			expStdout: `artifact: missing pull_requests:write
+review: ok
+`,
+		},
+		{
+			name:        "nothing_granted",
+			permissions: map[string]string{},
+			expErr:      "artifact (actions:read, pull_requests:write); review (actions:read, contents:read, pull_requests:read)",
+			expStdout: `artifact: missing actions:read, pull_requests:write
+review: missing actions:read, contents:read, pull_requests:read
+`,
+		},
+		{
+			name: "higher_level_granted",
+			args: []string{"-pipeline", "artifact"},
+			permissions: map[string]string{
+				"actions":       "write",
+				"pull_requests": "admin",
+			},
+			expStdout: `artifact: ok
+`,
+		},
+		{
+			name: "branch_protection_requires_administration",
+			args: []string{"-pipeline", "review", "-include-branch-protection"},
+			permissions: map[string]string{
+				"actions":       "read",
+				"contents":      "read",
+				"members":       "read",
+				"pull_requests": "read",
+			},
+			expErr: "review (administration:read)",
+			expStdout: `review: missing administration:read
+`,
+		},
+		{
+			name: "actor_teams_require_members",
+			args: []string{"-pipeline", "artifact", "-enrich-actor-teams"},
+			permissions: map[string]string{
+				"actions":       "read",
+				"pull_requests": "write",
+			},
+			expErr: "artifact (members:read)",
+			expStdout: `artifact: missing members:read
+`,
+		},
+		{
+			name: "distinct_teams_require_members",
+			args: []string{"-pipeline", "review", "-required-distinct-teams", "2"},
+			permissions: map[string]string{
+				"actions":       "read",
+				"contents":      "read",
+				"pull_requests": "read",
+			},
+			expErr: "review (members:read)",
+			expStdout: `review: missing members:read
+`,
+		},
+		{
+			name: "code_owner_approval_requires_members",
+			args: []string{"-pipeline", "review", "-require-code-owner-approval"},
+			permissions: map[string]string{
+				"actions":       "read",
+				"contents":      "read",
+				"pull_requests": "read",
+			},
+			expErr: "review (members:read)",
+			expStdout: `review: missing members:read
+`,
+		},
+		{
+			name:        "token_not_minted",
+			permissions: allPermissions,
+			tokenStatus: http.StatusForbidden,
+			expErr:      "failed to get github token",
+		},
+		{
+			name:   "unknown_pipeline",
+			args:   []string{"-pipeline", "leech"},
+			expErr: `unknown pipeline "leech", must be one of artifact, review`,
+		},
+		{
+			name:   "too_many_args",
+			args:   []string{"foo"},
+			expErr: `unexpected arguments: ["foo"]`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tokenStatus := tc.tokenStatus
+			if tokenStatus == 0 {
+				tokenStatus = http.StatusCreated
+			}
+			server := newFakeGitHubApps(t, "123", tc.permissions, tokenStatus)
+
+			env := map[string]string{
+				"GITHUB_APP_ID":      "test-github-app-id",
+				"GITHUB_INSTALL_ID":  "123",
+				"GITHUB_PRIVATE_KEY": privateKeyPEM,
+				"GITHUB_API_URL":     server.URL,
+			}
+
+			var cmd CheckAuthCommand
+			cmd.testFlagSetOpts = []cli.Option{cli.WithLookupEnv(envconfig.MapLookuper(env).Lookup)}
+
+			_, stdout, _ := cmd.Pipe()
+
+			err := cmd.Run(ctx, tc.args)
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(stdout.String(), tc.expStdout); diff != "" {
+				t.Errorf("stdout (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckAuthCommand_MissingCredentials(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	var cmd CheckAuthCommand
+	cmd.testFlagSetOpts = []cli.Option{cli.WithLookupEnv(envconfig.MapLookuper(map[string]string{
+		"GITHUB_APP_ID": "test-github-app-id",
+	}).Lookup)}
+
+	err := cmd.Run(ctx, nil)
+	if diff := testutil.DiffErrString(err, "GITHUB_INSTALL_ID is required"); diff != "" {
+		t.Fatal(diff)
+	}
+}
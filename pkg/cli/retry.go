@@ -22,6 +22,7 @@ import (
 	"google.golang.org/api/option"
 
 	"github.com/abcxyz/github-metrics-aggregator/pkg/retry"
+	"github.com/abcxyz/github-metrics-aggregator/pkg/servertls"
 	"github.com/abcxyz/github-metrics-aggregator/pkg/version"
 	"github.com/abcxyz/pkg/cli"
 	"github.com/abcxyz/pkg/logging"
@@ -102,7 +103,7 @@ func (c *RetryServerCommand) RunUnstarted(ctx context.Context, args []string) (*
 	if err := c.cfg.Validate(); err != nil {
 		return nil, nil, fmt.Errorf("invalid configuration: %w", err)
 	}
-	logger.DebugContext(ctx, "loaded configuration", "config", c.cfg)
+	logger.InfoContext(ctx, "loaded configuration", "config", c.cfg.LogConfig())
 
 	retryClientOptions := &retry.RetryClientOptions{}
 
@@ -125,7 +126,7 @@ func (c *RetryServerCommand) RunUnstarted(ctx context.Context, args []string) (*
 
 	mux := retryServer.Routes(ctx)
 
-	server, err := serving.New(c.cfg.Port)
+	server, err := servertls.NewServer(c.cfg.Port, c.cfg.TLS())
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create serving infrastructure: %w", err)
 	}
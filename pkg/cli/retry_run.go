@@ -0,0 +1,131 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/retry"
+	"github.com/abcxyz/github-metrics-aggregator/pkg/version"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+)
+
+var _ cli.Command = (*RetryRunCommand)(nil)
+
+// The RetryRunCommand performs a single retry run and prints a report of what
+// was redelivered.
+type RetryRunCommand struct {
+	cli.BaseCommand
+
+	cfg *retry.Config
+
+	format string
+
+	// testFlagSetOpts is only used for testing.
+	testFlagSetOpts []cli.Option
+
+	// testRetryClientOptions is only used for testing.
+	testRetryClientOptions *retry.RetryClientOptions
+}
+
+func (c *RetryRunCommand) Desc() string {
+	return `Perform a single retry run for GitHub Metrics Aggregator and print a report`
+}
+
+func (c *RetryRunCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+	Perform a single retry run for GitHub Metrics Aggregator and print a report
+	of the found and redelivered events to stdout.
+`
+}
+
+func (c *RetryRunCommand) Flags() *cli.FlagSet {
+	c.cfg = &retry.Config{}
+	set := cli.NewFlagSet(c.testFlagSetOpts...)
+	set = c.cfg.ToFlags(set)
+
+	f := set.NewSection("OUTPUT OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "format",
+		Target:  &c.format,
+		Example: retry.ReportFormatJSON,
+		Default: retry.ReportFormatText,
+		Usage: fmt.Sprintf(`The format of the report printed after the run, one of %s.`,
+			strings.Join(retry.ReportFormats, ", ")),
+	})
+
+	return set
+}
+
+func (c *RetryRunCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	args = f.Args()
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %q", args)
+	}
+
+	if !slices.Contains(retry.ReportFormats, c.format) {
+		return fmt.Errorf("invalid format %q, must be one of %s", c.format, strings.Join(retry.ReportFormats, ", "))
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.DebugContext(ctx, "running retry",
+		"name", version.Name,
+		"commit", version.Commit,
+		"version", version.Version)
+
+	if err := c.cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	logger.InfoContext(ctx, "loaded configuration", "config", c.cfg.LogConfig())
+
+	retryClientOptions := c.testRetryClientOptions
+	if retryClientOptions == nil {
+		retryClientOptions = &retry.RetryClientOptions{}
+	}
+
+	// the server is not serving any requests, so it does not need a renderer
+	retryServer, err := retry.NewServer(ctx, nil, c.cfg, retryClientOptions)
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+	defer retryServer.Close()
+
+	result, summary, err := retryServer.Run(ctx)
+	if err != nil {
+		if result != nil {
+			// the run stopped at a failed redelivery, report the progress made
+			// before the failure
+			if writeErr := retry.NewReport(result, summary).Write(c.Stdout(), c.format); writeErr != nil {
+				return fmt.Errorf("retry run failed: %w (failed to write report: %w)", err, writeErr)
+			}
+		}
+		return fmt.Errorf("retry run failed: %w", err)
+	}
+
+	if err := retry.NewReport(result, summary).Write(c.Stdout(), c.format); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v61/github"
+	"github.com/sethvargo/go-envconfig"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/retry"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// fakeRetryLock is a retry lock that is always acquired.
+type fakeRetryLock struct{}
+
+func (l *fakeRetryLock) Acquire(context.Context, time.Duration) error {
+	return nil
+}
+
+func (l *fakeRetryLock) Close(context.Context) error {
+	return nil
+}
+
+func (l *fakeRetryLock) Renew(context.Context, time.Duration) error {
+	return nil
+}
+
+// fakeRetryGitHub lists a fixed page of deliveries and successfully redelivers
+// all events.
+type fakeRetryGitHub struct {
+	deliveries []*github.HookDelivery
+}
+
+func (g *fakeRetryGitHub) ListDeliveries(ctx context.Context, opts *github.ListCursorOptions) ([]*github.HookDelivery, *github.Response, error) {
+	return g.deliveries, &github.Response{}, nil
+}
+
+func (g *fakeRetryGitHub) RedeliverEvent(ctx context.Context, deliveryID int64) error {
+	return nil
+}
+
+func newTestDelivery(id int64, statusCode int, repositoryID int64) *github.HookDelivery {
+	return &github.HookDelivery{
+		ID:           &id,
+		GUID:         github.String("guid"),
+		StatusCode:   &statusCode,
+		RepositoryID: &repositoryID,
+	}
+}
+
+func TestRetryRunCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	env := map[string]string{
+		"GITHUB_APP_ID":        "test-github-app-id",
+		"GITHUB_PRIVATE_KEY":   "test-github-private-key",
+		"BIG_QUERY_PROJECT_ID": "test-bq-id",
+		"BUCKET_NAME":          "test-bucket-name",
+		"CHECKPOINT_TABLE_ID":  "checkpoint-table-id",
+		"EVENTS_TABLE_ID":      "events-table-id",
+		"DATASET_ID":           "test-dataset-id",
+		"PROJECT_ID":           "test-project-id",
+	}
+
+	// deliveries are listed from newest to oldest
+	gitHub := &fakeRetryGitHub{
+		deliveries: []*github.HookDelivery{
+			newTestDelivery(104, http.StatusOK, 20),
+			newTestDelivery(103, http.StatusInternalServerError, 20),
+			newTestDelivery(102, http.StatusInternalServerError, 10),
+			newTestDelivery(101, http.StatusOK, 10),
+		},
+	}
+
+	cases := []struct {
+		name      string
+		args      []string
+		expErr    string
+		expStdout string
+	}{
+		{
+			name:   "too_many_args",
+			args:   []string{"foo"},
+			expErr: `unexpected arguments: ["foo"]`,
+		},
+		{
+			name:   "invalid_format",
+			args:   []string{"-format", "yaml"},
+			expErr: `invalid format "yaml", must be one of text, json, csv`,
+		},
+		{
+			name: "text",
+			expStdout: `outcome: PROCESSED
+total events: 4
+new events: 4
+failed events: 2
+redelivered events: 2
+repository 10: 2 new, 1 failed, 1 redelivered
+repository 20: 2 new, 1 failed, 1 redelivered
+`,
+		},
+		{
+			name: "csv",
+			args: []string{"-format", "csv"},
+			expStdout: `repository_id,new_event_count,failed_event_count,redelivered_event_count
+10,2,1,1
+20,2,1,1
+total,4,2,2
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cmd RetryRunCommand
+			cmd.testFlagSetOpts = []cli.Option{cli.WithLookupEnv(envconfig.MapLookuper(env).Lookup)}
+			cmd.testRetryClientOptions = &retry.RetryClientOptions{
+				DatastoreClientOverride: &retry.MockDatastore{},
+				GCSLockClientOverride:   &fakeRetryLock{},
+				GitHubOverride:          gitHub,
+			}
+
+			_, stdout, _ := cmd.Pipe()
+
+			err := cmd.Run(ctx, tc.args)
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(stdout.String(), tc.expStdout); diff != "" {
+				t.Errorf("stdout (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRetryRunCommand_JSON(t *testing.T) {
+	t.Parallel()
+
+	ctx := logging.WithLogger(context.Background(), logging.TestLogger(t))
+
+	var cmd RetryRunCommand
+	cmd.testFlagSetOpts = []cli.Option{cli.WithLookupEnv(envconfig.MapLookuper(map[string]string{
+		"GITHUB_APP_ID":        "test-github-app-id",
+		"GITHUB_PRIVATE_KEY":   "test-github-private-key",
+		"BIG_QUERY_PROJECT_ID": "test-bq-id",
+		"BUCKET_NAME":          "test-bucket-name",
+		"CHECKPOINT_TABLE_ID":  "checkpoint-table-id",
+		"EVENTS_TABLE_ID":      "events-table-id",
+		"DATASET_ID":           "test-dataset-id",
+		"PROJECT_ID":           "test-project-id",
+	}).Lookup)}
+	cmd.testRetryClientOptions = &retry.RetryClientOptions{
+		DatastoreClientOverride: &retry.MockDatastore{},
+		GCSLockClientOverride:   &fakeRetryLock{},
+		GitHubOverride: &fakeRetryGitHub{
+			deliveries: []*github.HookDelivery{
+				newTestDelivery(104, http.StatusOK, 20),
+				newTestDelivery(103, http.StatusInternalServerError, 20),
+				newTestDelivery(102, http.StatusInternalServerError, 10),
+				newTestDelivery(101, http.StatusBadGateway, 10),
+			},
+		},
+	}
+
+	_, stdout, _ := cmd.Pipe()
+
+	if err := cmd.Run(ctx, []string{"-format", "json"}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var got retry.Report
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse report %q: %v", stdout.String(), err)
+	}
+
+	want := retry.Report{
+		Outcome:               retry.OutcomeProcessed,
+		TotalEventCount:       4,
+		NewEventCount:         4,
+		FailedEventCount:      3,
+		RedeliveredEventCount: 3,
+		Repositories: []*retry.RepositorySummary{
+			{RepositoryID: 10, NewEventCount: 2, FailedEventCount: 2, RedeliveredEventCount: 2},
+			{RepositoryID: 20, NewEventCount: 2, FailedEventCount: 1, RedeliveredEventCount: 1},
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("report (-got,+want):\n%s", diff)
+	}
+}
@@ -75,7 +75,7 @@ func (c *ReviewJobCommand) Run(ctx context.Context, args []string) error {
 	if err := c.cfg.Validate(); err != nil {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
-	logger.DebugContext(ctx, "loaded configuration", "config", c.cfg)
+	logger.InfoContext(ctx, "loaded configuration", "config", c.cfg.LogConfig())
 
 	if err := review.ExecuteJob(ctx, c.cfg); err != nil {
 		return fmt.Errorf("job execution failed: %w", err)
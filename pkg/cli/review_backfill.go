@@ -0,0 +1,84 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/review"
+	"github.com/abcxyz/github-metrics-aggregator/pkg/version"
+	"github.com/abcxyz/pkg/cli"
+	"github.com/abcxyz/pkg/logging"
+)
+
+var _ cli.Command = (*ReviewBackfillJobCommand)(nil)
+
+// The ReviewBackfillJobCommand reruns the review job for the commits of a
+// historical date range, e.g. after fixing a bug in the approval logic.
+type ReviewBackfillJobCommand struct {
+	cli.BaseCommand
+
+	cfg *review.BackfillConfig
+
+	// testFlagSetOpts is only used for testing.
+	testFlagSetOpts []cli.Option
+}
+
+func (c *ReviewBackfillJobCommand) Desc() string {
+	return `Reprocess the commit review status of a date range for GitHub Metrics Aggregator`
+}
+
+func (c *ReviewBackfillJobCommand) Help() string {
+	return `
+Usage: {{ COMMAND }} [options]
+	Reprocess the commit review status of all commits between --start and --end
+	for GitHub Metrics Aggregator, including commits that were already processed.
+`
+}
+
+func (c *ReviewBackfillJobCommand) Flags() *cli.FlagSet {
+	c.cfg = &review.BackfillConfig{}
+	set := cli.NewFlagSet(c.testFlagSetOpts...)
+	return c.cfg.ToFlags(set)
+}
+
+func (c *ReviewBackfillJobCommand) Run(ctx context.Context, args []string) error {
+	f := c.Flags()
+	if err := f.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+	args = f.Args()
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %q", args)
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.DebugContext(ctx, "running job",
+		"name", version.Name,
+		"commit", version.Commit,
+		"version", version.Version)
+
+	if err := c.cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	logger.InfoContext(ctx, "loaded configuration", "config", c.cfg.LogConfig())
+
+	if err := review.ExecuteBackfillJob(ctx, c.cfg); err != nil {
+		return fmt.Errorf("job execution failed: %w", err)
+	}
+
+	return nil
+}
@@ -27,11 +27,17 @@ var rootCmd = func() cli.Command {
 		Name:    "github-metrics-aggregator",
 		Version: version.HumanVersion,
 		Commands: map[string]cli.CommandFactory{
+			"check-auth": func() cli.Command {
+				return &CheckAuthCommand{}
+			},
 			"retry": func() cli.Command {
 				return &cli.RootCommand{
 					Name:        "retry",
 					Description: "Perform retry operations",
 					Commands: map[string]cli.CommandFactory{
+						"run": func() cli.Command {
+							return &RetryRunCommand{}
+						},
 						"server": func() cli.Command {
 							return &RetryServerCommand{}
 						},
@@ -57,9 +63,15 @@ var rootCmd = func() cli.Command {
 						"artifact": func() cli.Command {
 							return &ArtifactJobCommand{}
 						},
+						"audit-log": func() cli.Command {
+							return &AuditLogJobCommand{}
+						},
 						"review": func() cli.Command {
 							return &ReviewJobCommand{}
 						},
+						"review-backfill": func() cli.Command {
+							return &ReviewBackfillJobCommand{}
+						},
 					},
 				}
 			},
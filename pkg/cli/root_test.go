@@ -25,9 +25,10 @@ func TestRootCommand_Help(t *testing.T) {
 	exp := `
 Usage: github-metrics-aggregator COMMAND
 
-  job        Execute a Cloud Run job
-  retry      Perform retry operations
-  webhook    Perform webhook operations
+  check-auth    Validate the GitHub App credentials and permissions
+  job           Execute a Cloud Run job
+  retry         Perform retry operations
+  webhook       Perform webhook operations
 `
 
 	cmd := rootCmd()
@@ -21,6 +21,7 @@ import (
 
 	"google.golang.org/api/option"
 
+	"github.com/abcxyz/github-metrics-aggregator/pkg/servertls"
 	"github.com/abcxyz/github-metrics-aggregator/pkg/version"
 	"github.com/abcxyz/github-metrics-aggregator/pkg/webhook"
 	"github.com/abcxyz/pkg/cli"
@@ -98,13 +99,14 @@ func (c *WebhookServerCommand) RunUnstarted(ctx context.Context, args []string)
 	if err := c.cfg.Validate(); err != nil {
 		return nil, nil, fmt.Errorf("invalid configuration: %w", err)
 	}
-	logger.DebugContext(ctx, "loaded configuration", "config", c.cfg)
+	logger.InfoContext(ctx, "loaded configuration", "config", c.cfg.LogConfig())
 
 	agent := fmt.Sprintf("abcxyz:github-metrics-aggregator/%s", version.Version)
 	opts := append([]option.ClientOption{option.WithUserAgent(agent)}, c.testPubSubClientOptions...)
 	webhookClientOptions := &webhook.WebhookClientOptions{
-		DLQEventPubsubClientOpts: opts,
-		EventPubsubClientOpts:    opts,
+		DLQEventPubsubClientOpts:    opts,
+		EventPubsubClientOpts:       opts,
+		RoutedEventPubsubClientOpts: opts,
 	}
 
 	// expect tests to pass this attribute
@@ -118,8 +120,9 @@ func (c *WebhookServerCommand) RunUnstarted(ctx context.Context, args []string)
 	}
 
 	mux := webhookServer.Routes(ctx)
+	webhookServer.StartSpoolDrain(ctx)
 
-	server, err := serving.New(c.cfg.Port)
+	server, err := servertls.NewServer(c.cfg.Port, c.cfg.TLS())
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create serving infrastructure: %w", err)
 	}
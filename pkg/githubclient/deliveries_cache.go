@@ -0,0 +1,112 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/google/go-github/v61/github"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// DeliveriesPage is a page of deliveries as listed by GitHub, along with the
+// ETag GitHub returned it with.
+type DeliveriesPage struct {
+	ETag       string                 `json:"etag"`
+	Deliveries []*github.HookDelivery `json:"deliveries"`
+
+	// NextCursor is the cursor of the next page, empty on the last page.
+	NextCursor string `json:"next_cursor"`
+}
+
+// DeliveriesPageCache stores the pages of deliveries by their cursor across
+// runs, so that unchanged pages can be listed with a conditional request.
+type DeliveriesPageCache interface {
+	// Get returns the cached page of the cursor, or nil if it is not cached.
+	Get(ctx context.Context, cursor string) (*DeliveriesPage, error)
+
+	// Put caches the page of the cursor, replacing any previous page.
+	Put(ctx context.Context, cursor string, page *DeliveriesPage) error
+}
+
+// listDeliveriesConditional lists a page of deliveries, sending the ETag of
+// the cached page of the cursor as If-None-Match. If the page is unchanged,
+// GitHub responds with 304 Not Modified, which counts less against the rate
+// limit, and the cached page is returned. Otherwise the listed page is cached.
+// A failure to read or write the cache is logged and the page is listed
+// unconditionally.
+func (gh *GitHub) listDeliveriesConditional(ctx context.Context, opts *github.ListCursorOptions) ([]*github.HookDelivery, *github.Response, error) {
+	logger := logging.FromContext(ctx)
+
+	cached, err := gh.pageCache.Get(ctx, opts.Cursor)
+	if err != nil {
+		logger.WarnContext(ctx, "failed to read cached deliveries page",
+			"cursor", opts.Cursor,
+			"error", err)
+		cached = nil
+	}
+
+	query := url.Values{}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+	if opts.PerPage != 0 {
+		query.Set("per_page", strconv.Itoa(opts.PerPage))
+	}
+	u := "app/hook/deliveries"
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := gh.client.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create list deliveries request: %w", err)
+	}
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	var deliveries []*github.HookDelivery
+	resp, err := gh.client.Do(ctx, req, &deliveries)
+	if err != nil {
+		var errResp *github.ErrorResponse
+		if cached != nil && errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotModified {
+			// the response of a 304 has no body and may not link the next
+			// page, both are taken from the cached page
+			resp.Cursor = cached.NextCursor
+			return cached.Deliveries, resp, nil
+		}
+		return deliveries, resp, fmt.Errorf("failed to list deliveries: %w", err)
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		if err := gh.pageCache.Put(ctx, opts.Cursor, &DeliveriesPage{
+			ETag:       etag,
+			Deliveries: deliveries,
+			NextCursor: resp.Cursor,
+		}); err != nil {
+			logger.WarnContext(ctx, "failed to cache deliveries page",
+				"cursor", opts.Cursor,
+				"error", err)
+		}
+	}
+	return deliveries, resp, nil
+}
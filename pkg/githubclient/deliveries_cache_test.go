@@ -0,0 +1,166 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v61/github"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// fakeDeliveriesPageCache caches pages in memory.
+type fakeDeliveriesPageCache struct {
+	pages map[string]*DeliveriesPage
+}
+
+func (c *fakeDeliveriesPageCache) Get(ctx context.Context, cursor string) (*DeliveriesPage, error) {
+	return c.pages[cursor], nil
+}
+
+func (c *fakeDeliveriesPageCache) Put(ctx context.Context, cursor string, page *DeliveriesPage) error {
+	c.pages[cursor] = page
+	return nil
+}
+
+func TestListDeliveries_Conditional(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cachedPage := &DeliveriesPage{
+		ETag:       `"cached-etag"`,
+		Deliveries: []*github.HookDelivery{{ID: github.Int64(1), StatusCode: github.Int(500)}},
+		NextCursor: "cached-next",
+	}
+
+	cases := []struct {
+		name       string
+		cached     map[string]*DeliveriesPage
+		cursor     string
+		wantHeader string
+		wantIDs    []int64
+		wantCursor string
+		wantCached *DeliveriesPage
+		wantErr    string
+	}{
+		{
+			name:       "not_modified_reuses_cached_page",
+			cached:     map[string]*DeliveriesPage{"abc": cachedPage},
+			cursor:     "abc",
+			wantHeader: `"cached-etag"`,
+			wantIDs:    []int64{1},
+			wantCursor: "cached-next",
+			wantCached: cachedPage,
+		},
+		{
+			name:       "changed_page_is_cached",
+			cached:     map[string]*DeliveriesPage{"abc": {ETag: `"stale-etag"`}},
+			cursor:     "abc",
+			wantHeader: `"stale-etag"`,
+			wantIDs:    []int64{2, 3},
+			wantCursor: "next",
+			wantCached: &DeliveriesPage{
+				ETag:       `"new-etag"`,
+				Deliveries: []*github.HookDelivery{{ID: github.Int64(2)}, {ID: github.Int64(3)}},
+				NextCursor: "next",
+			},
+		},
+		{
+			name:       "uncached_page_is_cached",
+			cached:     map[string]*DeliveriesPage{},
+			cursor:     "abc",
+			wantIDs:    []int64{2, 3},
+			wantCursor: "next",
+			wantCached: &DeliveriesPage{
+				ETag:       `"new-etag"`,
+				Deliveries: []*github.HookDelivery{{ID: github.Int64(2)}, {ID: github.Int64(3)}},
+				NextCursor: "next",
+			},
+		},
+		{
+			name:    "error",
+			cached:  map[string]*DeliveriesPage{},
+			cursor:  "broken",
+			wantErr: "failed to list deliveries",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotHeader string
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /api/v3/app/hook/deliveries", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("cursor") == "broken" {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				gotHeader = r.Header.Get("If-None-Match")
+				if gotHeader == `"cached-etag"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", `"new-etag"`)
+				w.Header().Set("Link", fmt.Sprintf(`<http://%s/api/v3/app/hook/deliveries?cursor=next>; rel="next"`, r.Host))
+				fmt.Fprint(w, `[{"id": 2}, {"id": 3}]`)
+			})
+			server := httptest.NewServer(mux)
+			t.Cleanup(server.Close)
+
+			client, err := github.NewClient(nil).WithEnterpriseURLs(server.URL, server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cache := &fakeDeliveriesPageCache{pages: tc.cached}
+			gh := &GitHub{client: client, pageCache: cache}
+
+			deliveries, resp, err := gh.ListDeliveries(ctx, &github.ListCursorOptions{Cursor: tc.cursor, PerPage: 100})
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if tc.wantErr != "" {
+				return
+			}
+
+			if got, want := gotHeader, tc.wantHeader; got != want {
+				t.Errorf("expected If-None-Match %q, got %q", want, got)
+			}
+			var gotIDs []int64
+			for _, d := range deliveries {
+				gotIDs = append(gotIDs, d.GetID())
+			}
+			if diff := cmp.Diff(gotIDs, tc.wantIDs); diff != "" {
+				t.Errorf("delivery ids (-got,+want):\n%s", diff)
+			}
+			if got, want := resp.Cursor, tc.wantCursor; got != want {
+				t.Errorf("expected cursor %q, got %q", want, got)
+			}
+			if diff := cmp.Diff(cache.pages[tc.cursor], tc.wantCached); diff != "" {
+				t.Errorf("cached page (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
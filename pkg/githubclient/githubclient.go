@@ -26,10 +26,14 @@ import (
 
 type GitHub struct {
 	client *github.Client
+
+	// pageCache enables listing deliveries with conditional requests, if set.
+	pageCache DeliveriesPageCache
 }
 
-// New creates a new instance of a GitHub client.
-func New(ctx context.Context, appID, rsaPrivateKeyPEM string) (*GitHub, error) {
+// New creates a new instance of a GitHub client. Deliveries are listed with
+// conditional requests against the pages in pageCache, if not nil.
+func New(ctx context.Context, appID, rsaPrivateKeyPEM string, pageCache DeliveriesPageCache) (*GitHub, error) {
 	app, err := githubauth.NewApp(appID, rsaPrivateKeyPEM)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create github app: %w", err)
@@ -39,12 +43,17 @@ func New(ctx context.Context, appID, rsaPrivateKeyPEM string) (*GitHub, error) {
 	client := github.NewClient(oauth2.NewClient(ctx, ts))
 
 	return &GitHub{
-		client: client,
+		client:    client,
+		pageCache: pageCache,
 	}, nil
 }
 
 // ListDeliveries lists a paginated result of event deliveries.
 func (gh *GitHub) ListDeliveries(ctx context.Context, opts *github.ListCursorOptions) ([]*github.HookDelivery, *github.Response, error) {
+	if gh.pageCache != nil {
+		return gh.listDeliveriesConditional(ctx, opts)
+	}
+
 	deliveries, resp, err := gh.client.Apps.ListHookDeliveries(ctx, opts)
 	if err != nil {
 		return deliveries, resp, fmt.Errorf("failed to list deliveries: %w", err)
@@ -0,0 +1,83 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package githubclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v61/github"
+	"golang.org/x/oauth2"
+
+	"github.com/abcxyz/pkg/githubauth"
+)
+
+// permissionLevels are the access levels of GitHub App permissions, in
+// increasing order of access.
+var permissionLevels = []string{"read", "write", "admin"}
+
+// InstallationPermissions returns the permissions granted to the installation
+// of the GitHub App, keyed by the name of the permission, e.g.
+// "pull_requests", with the access level as value, e.g. "write". The
+// installation is read with the app's JWT from the GitHub API at apiURL.
+func InstallationPermissions(ctx context.Context, app *githubauth.App, apiURL, installationID string) (map[string]string, error) {
+	id, err := strconv.ParseInt(installationID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid installation id %q: %w", installationID, err)
+	}
+
+	baseURL, err := url.Parse(strings.TrimSuffix(apiURL, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse github api url: %w", err)
+	}
+	client := github.NewClient(oauth2.NewClient(ctx, app.OAuthAppTokenSource()))
+	client.BaseURL = baseURL
+
+	installation, _, err := client.Apps.GetInstallation(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get installation %d: %w", id, err)
+	}
+
+	// the permissions are only exposed as struct fields, they are converted to
+	// a map through their JSON names
+	b, err := json.Marshal(installation.GetPermissions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal installation permissions: %w", err)
+	}
+	permissions := make(map[string]string)
+	if err := json.Unmarshal(b, &permissions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal installation permissions: %w", err)
+	}
+	return permissions, nil
+}
+
+// MissingPermissions returns the required permissions that are not granted,
+// formatted as "name:level" and sorted by name. A permission is missing when it
+// is not granted at all or only at a lower access level than required.
+func MissingPermissions(granted, required map[string]string) []string {
+	var missing []string
+	for name, level := range required {
+		if slices.Index(permissionLevels, granted[name]) < slices.Index(permissionLevels, level) {
+			missing = append(missing, name+":"+level)
+		}
+	}
+	slices.Sort(missing)
+	return missing
+}
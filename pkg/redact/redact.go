@@ -0,0 +1,58 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redact renders configs for logging without exposing their secrets.
+package redact
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Mask replaces the value of a sensitive field that is set.
+const Mask = "REDACTED"
+
+// Fields returns the exported fields of the struct v, or of the struct v
+// points to, keyed by the environment variable they are loaded from. Fields
+// without an env tag are keyed by their name. The values of fields tagged
+// `sensitive:"true"` are replaced by Mask, unless they are empty so that it
+// remains visible whether they were set.
+func Fields(v any) map[string]any {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	rt := rv.Type()
+
+	fields := make(map[string]any, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if env, _, _ := strings.Cut(field.Tag.Get("env"), ","); env != "" {
+			name = env
+		}
+
+		value := rv.Field(i)
+		if field.Tag.Get("sensitive") == "true" && !value.IsZero() {
+			fields[name] = Mask
+			continue
+		}
+		fields[name] = value.Interface()
+	}
+	return fields
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redact
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type testConfig struct {
+	ProjectID string            `env:"PROJECT_ID,required"`
+	Secret    string            `env:"SECRET" sensitive:"true"`
+	Secrets   []string          `env:"SECRETS" sensitive:"true"`
+	Routes    map[string]string `env:"ROUTES"`
+	Untagged  int
+	unexposed string
+}
+
+func TestFields(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   any
+		want map[string]any
+	}{
+		{
+			name: "sensitive_fields_masked",
+			in: &testConfig{
+				ProjectID: "my-project",
+				Secret:    "hunter2",
+				Secrets:   []string{"hunter2", "hunter3"},
+				Routes:    map[string]string{"push": "push-topic"},
+				Untagged:  3,
+				unexposed: "hidden",
+			},
+			want: map[string]any{
+				"PROJECT_ID": "my-project",
+				"SECRET":     Mask,
+				"SECRETS":    Mask,
+				"ROUTES":     map[string]string{"push": "push-topic"},
+				"Untagged":   3,
+			},
+		},
+		{
+			name: "empty_sensitive_fields_not_masked",
+			in: testConfig{
+				ProjectID: "my-project",
+			},
+			want: map[string]any{
+				"PROJECT_ID": "my-project",
+				"SECRET":     "",
+				"SECRETS":    []string(nil),
+				"ROUTES":     map[string]string(nil),
+				"Untagged":   0,
+			},
+		},
+		{
+			name: "not_a_struct",
+			in:   "my-project",
+			want: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(Fields(tc.in), tc.want); diff != "" {
+				t.Errorf("Fields got unexpected result (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
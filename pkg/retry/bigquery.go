@@ -24,6 +24,7 @@ import (
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 
+	bqutil "github.com/abcxyz/github-metrics-aggregator/pkg/bq"
 	"github.com/abcxyz/pkg/logging"
 )
 
@@ -32,17 +33,24 @@ type BigQuery struct {
 	projectID string
 	datasetID string
 	client    *bigquery.Client
+	putRetry  *bqutil.PutRetryConfig
 	logger    *slog.Logger
 }
 
 // CheckpointEntry is the shape of an entry to the checkpoint table.
 type CheckpointEntry struct {
-	deliveryID string
-	createdAt  string
+	installation string
+	deliveryID   string
+	createdAt    string
 }
 
-// NewBigQuery creates a new instance of a BigQuery client.
-func NewBigQuery(ctx context.Context, projectID, datasetID string, opts ...option.ClientOption) (*BigQuery, error) {
+// checkpointInstallationFilter matches the checkpoints of the @installation.
+// Checkpoints written without installation belong to the unnamed installation.
+const checkpointInstallationFilter = "IFNULL(installation, '') = @installation"
+
+// NewBigQuery creates a new instance of a BigQuery client. Writes that fail
+// with a transient error are retried according to putRetry.
+func NewBigQuery(ctx context.Context, projectID, datasetID string, putRetry *bqutil.PutRetryConfig, opts ...option.ClientOption) (*BigQuery, error) {
 	client, err := bigquery.NewClient(ctx, projectID, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new bigquery client: %w", err)
@@ -52,10 +60,20 @@ func NewBigQuery(ctx context.Context, projectID, datasetID string, opts ...optio
 		projectID: projectID,
 		datasetID: datasetID,
 		client:    client,
+		putRetry:  putRetry,
 		logger:    logging.FromContext(ctx),
 	}, nil
 }
 
+// CheckDataset fetches the metadata of the dataset to verify that BigQuery is
+// reachable and the dataset exists. This is used by the readiness check.
+func (bq *BigQuery) CheckDataset(ctx context.Context) error {
+	if _, err := bq.client.Dataset(bq.datasetID).Metadata(ctx); err != nil {
+		return fmt.Errorf("failed to get metadata of dataset %s: %w", bq.datasetID, err)
+	}
+	return nil
+}
+
 // Close releases any resources held by the BigQuery client.
 func (bq *BigQuery) Close() error {
 	if err := bq.client.Close(); err != nil {
@@ -64,11 +82,19 @@ func (bq *BigQuery) Close() error {
 	return nil
 }
 
-// Retrieve the latest checkpoint cursor value (deliveryID) in the checkpoint
-// table. This is used by the retry service.
-func (bq *BigQuery) RetrieveCheckpointID(ctx context.Context, checkpointTableID string) (string, error) {
+// Retrieve the latest checkpoint cursor value (deliveryID) of the installation
+// in the checkpoint table. This is used by the retry service.
+func (bq *BigQuery) RetrieveCheckpointID(ctx context.Context, checkpointTableID, installation string) (string, error) {
 	// Construct a query.
-	q := bq.client.Query(fmt.Sprintf("SELECT delivery_id FROM `%s.%s.%s` ORDER BY created DESC LIMIT 1", bq.projectID, bq.datasetID, checkpointTableID))
+	q := bq.client.Query(fmt.Sprintf("SELECT delivery_id FROM `%s.%s.%s` WHERE %s ORDER BY created DESC LIMIT 1",
+		bq.projectID, bq.datasetID, checkpointTableID, checkpointInstallationFilter))
+
+	q.Parameters = []bigquery.QueryParameter{
+		{
+			Name:  "installation",
+			Value: installation,
+		},
+	}
 
 	// Execute the query.
 	res, err := q.Read(ctx)
@@ -99,21 +125,68 @@ func (bq *BigQuery) RetrieveCheckpointID(ctx context.Context, checkpointTableID
 	return checkpoint, nil
 }
 
-// Write the latest checkpoint that was successfully processed.
-// This is used by the retry service.
-func (bq *BigQuery) WriteCheckpointID(ctx context.Context, checkpointTableID, deliveryID, createdAt string) error {
+// Write the latest checkpoint of the installation that was successfully
+// processed. This is used by the retry service.
+func (bq *BigQuery) WriteCheckpointID(ctx context.Context, checkpointTableID, installation, deliveryID, createdAt string) error {
 	inserter := bq.client.Dataset(bq.datasetID).Table(checkpointTableID).Inserter()
 	items := []*CheckpointEntry{
 		// CheckpointEntry implements the ValueSaver interface
-		{deliveryID: deliveryID, createdAt: createdAt},
+		{installation: installation, deliveryID: deliveryID, createdAt: createdAt},
 	}
-	if err := inserter.Put(ctx, items); err != nil {
+	if err := bqutil.PutWithRetry(ctx, inserter, items, bq.putRetry); err != nil {
 		return fmt.Errorf("failed to execute WriteCheckpointID for deliveryID %s: %w", deliveryID, err)
 	}
 
 	return nil
 }
 
+// pruneCheckpointsSQL deletes all but the latest @keep checkpoints of the
+// @installation. Rows written within the last 90 minutes may still be in the
+// streaming buffer, which DML statements cannot modify, so they are never
+// deleted.
+const pruneCheckpointsSQL = "DELETE FROM `%[1]s.%[2]s.%[3]s` " +
+	"WHERE %[4]s " +
+	"AND created < (SELECT MIN(created) FROM (SELECT created FROM `%[1]s.%[2]s.%[3]s` WHERE %[4]s ORDER BY created DESC LIMIT @keep)) " +
+	"AND created < TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 90 MINUTE)"
+
+// Delete all but the latest keepN checkpoints of the installation, so that the
+// checkpoint table does not grow by one row per run indefinitely. This is used
+// by the retry service.
+func (bq *BigQuery) PruneCheckpoints(ctx context.Context, checkpointTableID, installation string, keepN int) error {
+	q := bq.client.Query(pruneCheckpointsQuery(bq.projectID, bq.datasetID, checkpointTableID))
+
+	q.Parameters = []bigquery.QueryParameter{
+		{
+			Name:  "installation",
+			Value: installation,
+		},
+		{
+			Name:  "keep",
+			Value: keepN,
+		},
+	}
+
+	job, err := q.Run(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to execute PruneCheckpoints: %w", err)
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for PruneCheckpoints: %w", err)
+	}
+	if err := status.Err(); err != nil {
+		return fmt.Errorf("PruneCheckpoints failed: %w", err)
+	}
+
+	return nil
+}
+
+// pruneCheckpointsQuery returns the statement that deletes all but the latest
+// checkpoints of the given table.
+func pruneCheckpointsQuery(projectID, datasetID, checkpointTableID string) string {
+	return fmt.Sprintf(pruneCheckpointsSQL, projectID, datasetID, checkpointTableID, checkpointInstallationFilter)
+}
+
 // Check if an entry with a given delivery_id already exists in the events
 // table, this attempts to prevent duplicate processing of events.
 func (bq *BigQuery) DeliveryEventExists(ctx context.Context, eventsTableID, deliveryID string) (bool, error) {
@@ -161,10 +234,16 @@ func (bq *BigQuery) makeCountQuery(ctx context.Context, tableID, deliveryID stri
 }
 
 // Save implements the ValueSaver interface for a CheckpointEntry. A random
-// insertID is generated by the library to facilitate deduplication.
+// insertID is generated by the library to facilitate deduplication. The
+// installation is omitted for the unnamed installation, so that checkpoint
+// tables without the installation column keep working.
 func (ce *CheckpointEntry) Save() (map[string]bigquery.Value, string, error) {
-	return map[string]bigquery.Value{
+	row := map[string]bigquery.Value{
 		"delivery_id": ce.deliveryID,
 		"created":     ce.createdAt,
-	}, "", nil
+	}
+	if ce.installation != "" {
+		row["installation"] = ce.installation
+	}
+	return row, "", nil
 }
@@ -25,32 +25,68 @@ type writeCheckpointIDRes struct {
 	err error
 }
 
+type pruneCheckpointsRes struct {
+	err error
+}
+
 type deliveryEventExistsRes struct {
 	res bool
 	err error
 }
 
+type checkDatasetRes struct {
+	err error
+}
+
 type MockDatastore struct {
 	retrieveCheckpointID *retrieveCheckpointIDRes
 	writeCheckpointID    *writeCheckpointIDRes
+	pruneCheckpoints     *pruneCheckpointsRes
 	deliveryEventExists  *deliveryEventExistsRes
+	checkDataset         *checkDatasetRes
+
+	// checkpointIDsByInstallation overrides the retrieved checkpoint ID of the
+	// installations it contains.
+	checkpointIDsByInstallation map[string]string
+
+	retrievedInstallations             []string
+	writtenCheckpointIDs               []string
+	writtenCheckpointIDsByInstallation map[string][]string
+	prunedCheckpointsTo                []int
 }
 
 func (f *MockDatastore) WriteFailureEvent(ctx context.Context, failureEventTableID, deliveryID, createdAt string) error {
 	return nil
 }
 
-func (f *MockDatastore) RetrieveCheckpointID(ctx context.Context, checkpointTableID string) (string, error) {
+func (f *MockDatastore) RetrieveCheckpointID(ctx context.Context, checkpointTableID, installation string) (string, error) {
+	f.retrievedInstallations = append(f.retrievedInstallations, installation)
+	if checkpointID, ok := f.checkpointIDsByInstallation[installation]; ok {
+		return checkpointID, nil
+	}
 	if f.retrieveCheckpointID != nil {
 		return f.retrieveCheckpointID.res, f.retrieveCheckpointID.err
 	}
 	return "", nil
 }
 
-func (f *MockDatastore) WriteCheckpointID(ctx context.Context, checkpointTableID, deliveryID, createdAt string) error {
+func (f *MockDatastore) WriteCheckpointID(ctx context.Context, checkpointTableID, installation, deliveryID, createdAt string) error {
 	if f.writeCheckpointID != nil {
 		return f.writeCheckpointID.err
 	}
+	f.writtenCheckpointIDs = append(f.writtenCheckpointIDs, deliveryID)
+	if f.writtenCheckpointIDsByInstallation == nil {
+		f.writtenCheckpointIDsByInstallation = make(map[string][]string)
+	}
+	f.writtenCheckpointIDsByInstallation[installation] = append(f.writtenCheckpointIDsByInstallation[installation], deliveryID)
+	return nil
+}
+
+func (f *MockDatastore) PruneCheckpoints(ctx context.Context, checkpointTableID, installation string, keepN int) error {
+	f.prunedCheckpointsTo = append(f.prunedCheckpointsTo, keepN)
+	if f.pruneCheckpoints != nil {
+		return f.pruneCheckpoints.err
+	}
 	return nil
 }
 
@@ -61,6 +97,13 @@ func (f *MockDatastore) DeliveryEventExists(ctx context.Context, eventsTableID,
 	return false, nil
 }
 
+func (f *MockDatastore) CheckDataset(ctx context.Context) error {
+	if f.checkDataset != nil {
+		return f.checkDataset.err
+	}
+	return nil
+}
+
 func (f *MockDatastore) Close() error {
 	return nil
 }
@@ -0,0 +1,35 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPruneCheckpointsQuery(t *testing.T) {
+	t.Parallel()
+
+	got := pruneCheckpointsQuery("my_project", "my_dataset", "checkpoints")
+
+	want := "DELETE FROM `my_project.my_dataset.checkpoints` " +
+		"WHERE IFNULL(installation, '') = @installation " +
+		"AND created < (SELECT MIN(created) FROM (SELECT created FROM `my_project.my_dataset.checkpoints` WHERE IFNULL(installation, '') = @installation ORDER BY created DESC LIMIT @keep)) " +
+		"AND created < TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL 90 MINUTE)"
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("pruneCheckpointsQuery got unexpected result (-got,+want):\n%s", diff)
+	}
+}
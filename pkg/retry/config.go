@@ -17,10 +17,15 @@ package retry
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/sethvargo/go-envconfig"
 
+	bqutil "github.com/abcxyz/github-metrics-aggregator/pkg/bq"
+	"github.com/abcxyz/github-metrics-aggregator/pkg/redact"
+	"github.com/abcxyz/github-metrics-aggregator/pkg/servertls"
 	"github.com/abcxyz/pkg/cfgloader"
 	"github.com/abcxyz/pkg/cli"
 )
@@ -28,17 +33,66 @@ import (
 // Config defines the set of environment variables required
 // for running the retry service.
 type Config struct {
-	GitHubAppID       string        `env:"GITHUB_APP_ID,required"`
-	GitHubPrivateKey  string        `env:"GITHUB_PRIVATE_KEY,required"`
-	BigQueryProjectID string        `env:"BIG_QUERY_PROJECT_ID,default=$PROJECT_ID"`
-	BucketName        string        `env:"BUCKET_NAME,required"`
-	CheckpointTableID string        `env:"CHECKPOINT_TABLE_ID,required"`
-	EventsTableID     string        `env:"EVENTS_TABLE_ID,required"`
-	DatasetID         string        `env:"DATASET_ID,required"`
-	LockTTLClockSkew  time.Duration `env:"LOCK_TTL_CLOCK_SKEW,default=10s"`
-	LockTTL           time.Duration `env:"LOCK_TTL,default=5m"`
-	ProjectID         string        `env:"PROJECT_ID,required"`
-	Port              string        `env:"PORT,default=8080"`
+	GitHubAppID          string        `env:"GITHUB_APP_ID,required"`
+	GitHubPrivateKey     string        `env:"GITHUB_PRIVATE_KEY,required" sensitive:"true"`
+	BigQueryProjectID    string        `env:"BIG_QUERY_PROJECT_ID,default=$PROJECT_ID"`
+	BucketName           string        `env:"BUCKET_NAME,required"`
+	CheckpointTableID    string        `env:"CHECKPOINT_TABLE_ID,required"`
+	EventsTableID        string        `env:"EVENTS_TABLE_ID,required"`
+	DatasetID            string        `env:"DATASET_ID,required"`
+	LockTTLClockSkew     time.Duration `env:"LOCK_TTL_CLOCK_SKEW,default=10s"`
+	LockTTL              time.Duration `env:"LOCK_TTL,default=5m"`
+	RedeliverConcurrency int           `env:"REDELIVER_CONCURRENCY,default=1"`
+	CheckpointRetention  int           `env:"CHECKPOINT_RETENTION,default=0"`
+	MaxDeliveryAge       time.Duration `env:"MAX_DELIVERY_AGE,default=0"`
+	ProjectID            string        `env:"PROJECT_ID,required"`
+	Port                 string        `env:"PORT,default=8080"`
+
+	// RedeliverOrder is the order the failed events of a run are redelivered
+	// in, either RedeliverOrderOldest or RedeliverOrderNewest.
+	RedeliverOrder string `env:"REDELIVER_ORDER,default=oldest"`
+
+	// LockRenewalRatio is the fraction of the LockTTL after which the lease of
+	// the lock is renewed while a run is in progress. Disabled when 0.
+	LockRenewalRatio float64 `env:"LOCK_RENEWAL_RATIO,default=0"`
+
+	// BigQueryWriteMaxRetries is the maximum number of retries of a BigQuery
+	// write that failed with a transient error. Writes are not retried when 0.
+	BigQueryWriteMaxRetries int `env:"BIG_QUERY_WRITE_MAX_RETRIES,default=3"`
+
+	// BigQueryWriteRetryBackoff is the backoff before the first retry of a
+	// failed BigQuery write, it doubles with each retry.
+	BigQueryWriteRetryBackoff time.Duration `env:"BIG_QUERY_WRITE_RETRY_BACKOFF,default=500ms"`
+
+	// GitHubInstallations maps names, typically the organization, to the IDs
+	// of the installations of the GitHub App whose failed deliveries are
+	// retried. Each installation keeps its own checkpoint, keyed by its name.
+	// All deliveries of the GitHub App share a single checkpoint when empty.
+	GitHubInstallations map[string]string `env:"GITHUB_INSTALLATIONS"`
+
+	// ConditionalListDeliveries caches the pages of deliveries with their ETag
+	// in the BucketName across runs, and lists the deliveries with conditional
+	// requests so that unchanged pages count less against the rate limit.
+	ConditionalListDeliveries bool `env:"CONDITIONAL_LIST_DELIVERIES,default=false"`
+
+	// ResumeCursorPages is the number of pages of deliveries after which the
+	// progress of the walk over them is persisted in the BucketName, so that a
+	// run that is restarted mid-walk resumes near where it left off instead of
+	// walking all pages again. Disabled when 0.
+	ResumeCursorPages int `env:"RESUME_CURSOR_PAGES,default=0"`
+
+	// TLSCertFile and TLSKeyFile are the PEM encoded certificate chain and
+	// private key the server serves HTTPS with. The server serves HTTP unless
+	// set, e.g. when deployed behind a load balancer that terminates TLS.
+	TLSCertFile string `env:"TLS_CERT_FILE"`
+	TLSKeyFile  string `env:"TLS_KEY_FILE"`
+
+	// TLSMinVersion is the minimum TLS version accepted when serving HTTPS.
+	TLSMinVersion string `env:"TLS_MIN_VERSION,default=1.2"`
+
+	// TLSCipherSuites are the cipher suites accepted for TLS 1.2 and lower when
+	// serving HTTPS. The Go defaults are accepted unless set.
+	TLSCipherSuites []string `env:"TLS_CIPHER_SUITES"`
 }
 
 // Validate validates the retry config after load.
@@ -71,15 +125,110 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf("PROJECT_ID is required")
 	}
 
+	if cfg.RedeliverConcurrency < 0 {
+		return fmt.Errorf("REDELIVER_CONCURRENCY must not be negative, got %d", cfg.RedeliverConcurrency)
+	}
+
+	switch cfg.RedeliverOrder {
+	case "", RedeliverOrderOldest, RedeliverOrderNewest:
+	default:
+		return fmt.Errorf("REDELIVER_ORDER must be one of %q or %q, got %q",
+			RedeliverOrderOldest, RedeliverOrderNewest, cfg.RedeliverOrder)
+	}
+
+	if cfg.CheckpointRetention < 0 {
+		return fmt.Errorf("CHECKPOINT_RETENTION must not be negative, got %d", cfg.CheckpointRetention)
+	}
+
+	if cfg.LockRenewalRatio < 0 || cfg.LockRenewalRatio >= 1 {
+		return fmt.Errorf("LOCK_RENEWAL_RATIO must be at least 0 and less than 1, got %v", cfg.LockRenewalRatio)
+	}
+
+	if cfg.MaxDeliveryAge < 0 {
+		return fmt.Errorf("MAX_DELIVERY_AGE must not be negative, got %s", cfg.MaxDeliveryAge)
+	}
+
+	if cfg.BigQueryWriteMaxRetries < 0 {
+		return fmt.Errorf("BIG_QUERY_WRITE_MAX_RETRIES must not be negative, got %d", cfg.BigQueryWriteMaxRetries)
+	}
+
+	if cfg.BigQueryWriteMaxRetries > 0 && cfg.BigQueryWriteRetryBackoff <= 0 {
+		return fmt.Errorf("BIG_QUERY_WRITE_RETRY_BACKOFF must be positive, got %s", cfg.BigQueryWriteRetryBackoff)
+	}
+
+	if cfg.ResumeCursorPages < 0 {
+		return fmt.Errorf("RESUME_CURSOR_PAGES must not be negative, got %d", cfg.ResumeCursorPages)
+	}
+
+	for name, id := range cfg.GitHubInstallations {
+		if installationID, err := strconv.ParseInt(id, 10, 64); name == "" || err != nil || installationID <= 0 {
+			return fmt.Errorf("GITHUB_INSTALLATIONS must map names to installation IDs, got %q=%q", name, id)
+		}
+	}
+
 	// Given this Validate function runs after the ToFlags function, this fallback
 	// is done in case the user has not provided a BIG_QUERY_PROJECT_ID.
 	if cfg.BigQueryProjectID == "" {
 		cfg.BigQueryProjectID = cfg.ProjectID
 	}
 
+	if err := cfg.TLS().Validate(); err != nil {
+		return err //nolint:wrapcheck // Want passthrough
+	}
+
 	return nil
 }
 
+// lockRenewalInterval returns the interval at which the lease of the lock is
+// renewed, or 0 if it is not renewed.
+func (cfg *Config) lockRenewalInterval() time.Duration {
+	return time.Duration(float64(cfg.LockTTL) * cfg.LockRenewalRatio)
+}
+
+// bigQueryWriteRetry returns the retry configuration of BigQuery writes.
+func (cfg *Config) bigQueryWriteRetry() *bqutil.PutRetryConfig {
+	return &bqutil.PutRetryConfig{
+		MaxRetries:     uint64(cfg.BigQueryWriteMaxRetries),
+		InitialBackoff: cfg.BigQueryWriteRetryBackoff,
+	}
+}
+
+// installations returns the installations to retry, ordered by name. A
+// single installation without name or ID, which covers all deliveries of the
+// GitHub App, is returned if none are configured.
+func (cfg *Config) installations() []*installation {
+	if len(cfg.GitHubInstallations) == 0 {
+		return []*installation{{}}
+	}
+
+	installations := make([]*installation, 0, len(cfg.GitHubInstallations))
+	for name, id := range cfg.GitHubInstallations {
+		// the ID is validated to be a positive integer
+		installationID, _ := strconv.ParseInt(id, 10, 64)
+		installations = append(installations, &installation{name: name, id: installationID})
+	}
+	sort.Slice(installations, func(i, j int) bool {
+		return installations[i].name < installations[j].name
+	})
+	return installations
+}
+
+// TLS returns the TLS configuration of the server.
+func (cfg *Config) TLS() *servertls.Config {
+	return &servertls.Config{
+		CertFile:     cfg.TLSCertFile,
+		KeyFile:      cfg.TLSKeyFile,
+		MinVersion:   cfg.TLSMinVersion,
+		CipherSuites: cfg.TLSCipherSuites,
+	}
+}
+
+// LogConfig returns the config for logging, with the values of sensitive
+// fields redacted.
+func (cfg *Config) LogConfig() map[string]any {
+	return redact.Fields(cfg)
+}
+
 // NewConfig creates a new Config from environment variables.
 func NewConfig(ctx context.Context) (*Config, error) {
 	return newConfig(ctx, envconfig.OsLookuper())
@@ -165,6 +314,51 @@ func (cfg *Config) ToFlags(set *cli.FlagSet) *cli.FlagSet {
 		Usage:   "Duration for a lock to be active until it is allowed to be taken.",
 	})
 
+	f.Float64Var(&cli.Float64Var{
+		Name:    "lock-renewal-ratio",
+		Target:  &cfg.LockRenewalRatio,
+		EnvVar:  "LOCK_RENEWAL_RATIO",
+		Default: 0,
+		Usage: "The fraction of the lock TTL after which the lock is renewed while a run is in progress, " +
+			"so that runs longer than the lock TTL keep the lock. Must be less than 1, disabled when 0.",
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "redeliver-concurrency",
+		Target:  &cfg.RedeliverConcurrency,
+		EnvVar:  "REDELIVER_CONCURRENCY",
+		Default: 1,
+		Usage: "The maximum number of failed events to redeliver concurrently. " +
+			"The checkpoint only advances past events once they and all older failed events are redelivered.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "redeliver-order",
+		Target:  &cfg.RedeliverOrder,
+		EnvVar:  "REDELIVER_ORDER",
+		Default: RedeliverOrderOldest,
+		Usage: `The order the failed events of a run are redelivered in, either "oldest" or "newest" first. ` +
+			`The checkpoint only advances past events once they and all older failed events are redelivered.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "checkpoint-retention",
+		Target:  &cfg.CheckpointRetention,
+		EnvVar:  "CHECKPOINT_RETENTION",
+		Default: 0,
+		Usage: "The number of latest checkpoints to keep after writing a new checkpoint, " +
+			"older checkpoints are deleted. All checkpoints are kept when 0.",
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "max-delivery-age",
+		Target:  &cfg.MaxDeliveryAge,
+		EnvVar:  "MAX_DELIVERY_AGE",
+		Default: 0,
+		Usage: "The maximum age of a failed delivery to redeliver. GitHub does not redeliver events " +
+			"older than its retention window, so older failed deliveries are skipped. Disabled when 0.",
+	})
+
 	f.StringVar(&cli.StringVar{
 		Name:   "project-id",
 		Target: &cfg.ProjectID,
@@ -180,5 +374,81 @@ func (cfg *Config) ToFlags(set *cli.FlagSet) *cli.FlagSet {
 		Usage:   `The port the retry server listens to.`,
 	})
 
+	f.IntVar(&cli.IntVar{
+		Name:    "big-query-write-max-retries",
+		Target:  &cfg.BigQueryWriteMaxRetries,
+		EnvVar:  "BIG_QUERY_WRITE_MAX_RETRIES",
+		Default: 3,
+		Usage:   "The maximum number of retries of a BigQuery write that failed with a transient error. Writes are not retried when 0.",
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "big-query-write-retry-backoff",
+		Target:  &cfg.BigQueryWriteRetryBackoff,
+		EnvVar:  "BIG_QUERY_WRITE_RETRY_BACKOFF",
+		Default: 500 * time.Millisecond,
+		Usage:   "The backoff before the first retry of a failed BigQuery write, it doubles with each retry.",
+	})
+
+	f.StringMapVar(&cli.StringMapVar{
+		Name:   "github-installations",
+		Target: &cfg.GitHubInstallations,
+		EnvVar: "GITHUB_INSTALLATIONS",
+		Usage: "Retries the failed deliveries of the GitHub App installation with the given ID separately, " +
+			"with a checkpoint keyed by the given name. Can be repeated. All deliveries of the GitHub App " +
+			"share a single checkpoint when not set.",
+		Example: "my-org=12345678",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "conditional-list-deliveries",
+		Target:  &cfg.ConditionalListDeliveries,
+		EnvVar:  "CONDITIONAL_LIST_DELIVERIES",
+		Default: false,
+		Usage: `Whether to cache the pages of deliveries listed from GitHub in the bucket and list them ` +
+			`with conditional requests on the next runs. A page that did not change is not listed again ` +
+			`and counts less against the rate limit of the GitHub App.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "resume-cursor-pages",
+		Target:  &cfg.ResumeCursorPages,
+		EnvVar:  "RESUME_CURSOR_PAGES",
+		Default: 0,
+		Usage: "The number of pages of deliveries after which the progress of the run is persisted in the bucket, " +
+			"so that a run restarted mid-way, e.g. after a timeout, resumes near where it left off. Disabled when 0.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "tls-cert-file",
+		Target: &cfg.TLSCertFile,
+		EnvVar: "TLS_CERT_FILE",
+		Usage: `The path of the PEM encoded certificate chain to serve HTTPS with, along with ` +
+			`the tls-key-file. The server serves HTTP unless set, e.g. behind a load balancer.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "tls-key-file",
+		Target: &cfg.TLSKeyFile,
+		EnvVar: "TLS_KEY_FILE",
+		Usage:  `The path of the PEM encoded private key of the tls-cert-file.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "tls-min-version",
+		Target:  &cfg.TLSMinVersion,
+		EnvVar:  "TLS_MIN_VERSION",
+		Default: servertls.DefaultMinVersion,
+		Usage:   `The minimum TLS version accepted when serving HTTPS, one of 1.0, 1.1, 1.2 or 1.3.`,
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:   "tls-cipher-suites",
+		Target: &cfg.TLSCipherSuites,
+		EnvVar: "TLS_CIPHER_SUITES",
+		Usage: `Comma-separated list of cipher suites accepted for TLS 1.2 and lower when serving HTTPS, ` +
+			`e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. The Go defaults are accepted unless set.`,
+	})
+
 	return set
 }
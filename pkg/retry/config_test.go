@@ -16,7 +16,9 @@ package retry
 
 import (
 	"testing"
+	"time"
 
+	"github.com/abcxyz/github-metrics-aggregator/pkg/redact"
 	"github.com/abcxyz/pkg/testutil"
 )
 
@@ -118,6 +120,126 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: `PROJECT_ID is required`,
 		},
+		{
+			name: "negative_redelivery_concurrency",
+			cfg: &Config{
+				GitHubAppID:          "test-github-app-id",
+				GitHubPrivateKey:     "test-github-private-key",
+				BigQueryProjectID:    "test-bq-id",
+				BucketName:           "test-bucket-name",
+				CheckpointTableID:    "checkpoint-table-id",
+				EventsTableID:        "events-table-id",
+				DatasetID:            "test-dataset-id",
+				ProjectID:            "test-project-id",
+				RedeliverConcurrency: -1,
+			},
+			wantErr: `REDELIVER_CONCURRENCY must not be negative, got -1`,
+		},
+		{
+			name: "negative_max_delivery_age",
+			cfg: &Config{
+				GitHubAppID:       "test-github-app-id",
+				GitHubPrivateKey:  "test-github-private-key",
+				BigQueryProjectID: "test-bq-id",
+				BucketName:        "test-bucket-name",
+				CheckpointTableID: "checkpoint-table-id",
+				EventsTableID:     "events-table-id",
+				DatasetID:         "test-dataset-id",
+				ProjectID:         "test-project-id",
+				MaxDeliveryAge:    -time.Hour,
+			},
+			wantErr: `MAX_DELIVERY_AGE must not be negative, got -1h0m0s`,
+		},
+		{
+			name: "negative_resume_cursor_pages",
+			cfg: &Config{
+				GitHubAppID:       "test-github-app-id",
+				GitHubPrivateKey:  "test-github-private-key",
+				BigQueryProjectID: "test-bq-id",
+				BucketName:        "test-bucket-name",
+				CheckpointTableID: "checkpoint-table-id",
+				EventsTableID:     "events-table-id",
+				DatasetID:         "test-dataset-id",
+				ProjectID:         "test-project-id",
+				ResumeCursorPages: -1,
+			},
+			wantErr: `RESUME_CURSOR_PAGES must not be negative, got -1`,
+		},
+		{
+			name: "invalid_redeliver_order",
+			cfg: &Config{
+				GitHubAppID:       "test-github-app-id",
+				GitHubPrivateKey:  "test-github-private-key",
+				BigQueryProjectID: "test-bq-id",
+				BucketName:        "test-bucket-name",
+				CheckpointTableID: "checkpoint-table-id",
+				EventsTableID:     "events-table-id",
+				DatasetID:         "test-dataset-id",
+				ProjectID:         "test-project-id",
+				RedeliverOrder:    "random",
+			},
+			wantErr: `REDELIVER_ORDER must be one of "oldest" or "newest", got "random"`,
+		},
+		{
+			name: "invalid_lock_renewal_ratio",
+			cfg: &Config{
+				GitHubAppID:       "test-github-app-id",
+				GitHubPrivateKey:  "test-github-private-key",
+				BigQueryProjectID: "test-bq-id",
+				BucketName:        "test-bucket-name",
+				CheckpointTableID: "checkpoint-table-id",
+				EventsTableID:     "events-table-id",
+				DatasetID:         "test-dataset-id",
+				ProjectID:         "test-project-id",
+				LockRenewalRatio:  1,
+			},
+			wantErr: `LOCK_RENEWAL_RATIO must be at least 0 and less than 1, got 1`,
+		},
+		{
+			name: "big_query_write_retries_without_backoff",
+			cfg: &Config{
+				GitHubAppID:             "test-github-app-id",
+				GitHubPrivateKey:        "test-github-private-key",
+				BigQueryProjectID:       "test-bq-id",
+				BucketName:              "test-bucket-name",
+				CheckpointTableID:       "checkpoint-table-id",
+				EventsTableID:           "events-table-id",
+				DatasetID:               "test-dataset-id",
+				ProjectID:               "test-project-id",
+				BigQueryWriteMaxRetries: 3,
+			},
+			wantErr: `BIG_QUERY_WRITE_RETRY_BACKOFF must be positive, got 0s`,
+		},
+		{
+			name: "invalid_github_installation_id",
+			cfg: &Config{
+				GitHubAppID:         "test-github-app-id",
+				GitHubPrivateKey:    "test-github-private-key",
+				BigQueryProjectID:   "test-bq-id",
+				BucketName:          "test-bucket-name",
+				CheckpointTableID:   "checkpoint-table-id",
+				EventsTableID:       "events-table-id",
+				DatasetID:           "test-dataset-id",
+				ProjectID:           "test-project-id",
+				GitHubInstallations: map[string]string{"my-org": "my-installation"},
+			},
+			wantErr: `GITHUB_INSTALLATIONS must map names to installation IDs, got "my-org"="my-installation"`,
+		},
+		{
+			name: "tls_key_file_without_cert_file",
+			cfg: &Config{
+				GitHubAppID:       "test-github-app-id",
+				GitHubPrivateKey:  "test-github-private-key",
+				BigQueryProjectID: "test-bq-id",
+				BucketName:        "test-bucket-name",
+				CheckpointTableID: "checkpoint-table-id",
+				EventsTableID:     "events-table-id",
+				DatasetID:         "test-dataset-id",
+				ProjectID:         "test-project-id",
+				TLSKeyFile:        "key.pem",
+			},
+			wantErr: `TLS_CERT_FILE and TLS_KEY_FILE must be set together`,
+		},
 		{
 			name: "success_fallback_bq_project_id",
 			cfg: &Config{
@@ -158,3 +280,20 @@ func TestConfig_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_LogConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{
+		GitHubAppID:      "github-app-id",
+		GitHubPrivateKey: "github-private-key",
+	}
+
+	got := cfg.LogConfig()
+	if got, want := got["GITHUB_PRIVATE_KEY"], redact.Mask; got != want {
+		t.Errorf("expected GITHUB_PRIVATE_KEY to be %q, got %v", want, got)
+	}
+	if got, want := got["GITHUB_APP_ID"], "github-app-id"; got != want {
+		t.Errorf("expected GITHUB_APP_ID to be %q, got %v", want, got)
+	}
+}
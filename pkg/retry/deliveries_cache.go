@@ -0,0 +1,166 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/githubclient"
+)
+
+// deliveriesCachePrefix is the prefix of the objects in the bucket that hold
+// the cached pages of deliveries.
+const deliveriesCachePrefix = "deliveries-cache/"
+
+var _ githubclient.DeliveriesPageCache = (*GCSDeliveriesPageCache)(nil)
+
+// GCSDeliveriesPageCache caches the pages of deliveries as JSON objects in a
+// Cloud Storage bucket, one object per cursor. Cursors change as new
+// deliveries arrive, so the objects of the pages that are no longer reached
+// are deleted by [GCSDeliveriesPageCache.Prune].
+type GCSDeliveriesPageCache struct {
+	client *storage.Client
+	bucket string
+
+	mu      sync.Mutex
+	reached map[string]struct{} // objects read or written since the last prune
+}
+
+// NewGCSDeliveriesPageCache creates a cache of the pages of deliveries in the
+// given bucket.
+func NewGCSDeliveriesPageCache(ctx context.Context, bucket string, opts ...option.ClientOption) (*GCSDeliveriesPageCache, error) {
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+	return &GCSDeliveriesPageCache{
+		client:  client,
+		bucket:  bucket,
+		reached: make(map[string]struct{}),
+	}, nil
+}
+
+// Get implements [githubclient.DeliveriesPageCache].
+func (c *GCSDeliveriesPageCache) Get(ctx context.Context, cursor string) (*githubclient.DeliveriesPage, error) {
+	object := deliveriesCacheObject(cursor)
+	c.reach(object)
+	reader, err := c.client.Bucket(c.bucket).Object(object).NewReader(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read object gs://%s/%s: %w", c.bucket, object, err)
+	}
+	defer reader.Close()
+
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object gs://%s/%s: %w", c.bucket, object, err)
+	}
+
+	var page githubclient.DeliveriesPage
+	if err := json.Unmarshal(b, &page); err != nil {
+		return nil, fmt.Errorf("failed to parse object gs://%s/%s: %w", c.bucket, object, err)
+	}
+	return &page, nil
+}
+
+// Put implements [githubclient.DeliveriesPageCache].
+func (c *GCSDeliveriesPageCache) Put(ctx context.Context, cursor string, page *githubclient.DeliveriesPage) error {
+	b, err := json.Marshal(page)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deliveries page: %w", err)
+	}
+
+	object := deliveriesCacheObject(cursor)
+	c.reach(object)
+	writer := c.client.Bucket(c.bucket).Object(object).NewWriter(ctx)
+	writer.ContentType = "application/json"
+	if _, err := writer.Write(b); err != nil {
+		// the object is not created if the writer is not closed cleanly
+		_ = writer.CloseWithError(err)
+		return fmt.Errorf("failed to write object gs://%s/%s: %w", c.bucket, object, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to write object gs://%s/%s: %w", c.bucket, object, err)
+	}
+	return nil
+}
+
+// Prune deletes the cached pages that were not read or written since the last
+// prune, which are those of cursors not reached by the last walk of the
+// deliveries. It is called once a run walked the deliveries of every
+// installation, a failed run leaves the cache as is so its pages are kept for
+// the next run.
+func (c *GCSDeliveriesPageCache) Prune(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	reached := c.reached
+	c.reached = make(map[string]struct{})
+	c.mu.Unlock()
+
+	bucket := c.client.Bucket(c.bucket)
+	it := bucket.Objects(ctx, &storage.Query{Prefix: deliveriesCachePrefix})
+	var deleted int
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("failed to list objects gs://%s/%s: %w", c.bucket, deliveriesCachePrefix, err)
+		}
+		if _, ok := reached[attrs.Name]; ok {
+			continue
+		}
+		if err := bucket.Object(attrs.Name).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			return deleted, fmt.Errorf("failed to delete object gs://%s/%s: %w", c.bucket, attrs.Name, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// reach records that the object was read or written, so it is not pruned.
+func (c *GCSDeliveriesPageCache) reach(object string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reached[object] = struct{}{}
+}
+
+// Close handles the graceful shutdown of the storage client.
+func (c *GCSDeliveriesPageCache) Close() error {
+	if err := c.client.Close(); err != nil {
+		return fmt.Errorf("failed to close storage client: %w", err)
+	}
+	return nil
+}
+
+// deliveriesCacheObject returns the name of the object caching the page of the
+// cursor. Cursors are opaque, so they are hashed into a valid object name.
+func deliveriesCacheObject(cursor string) string {
+	sum := sha256.Sum256([]byte(cursor))
+	return deliveriesCachePrefix + hex.EncodeToString(sum[:]) + ".json"
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+)
+
+// fakeGCSObjects serves the listing and deletion of objects of the Cloud
+// Storage JSON API from an in-memory set of object names.
+type fakeGCSObjects struct {
+	mu      sync.Mutex
+	objects map[string]struct{}
+}
+
+func (f *fakeGCSObjects) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	const objectsPath = "/storage/v1/b/test-bucket/o"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == objectsPath:
+		prefix := r.URL.Query().Get("prefix")
+		items := []map[string]string{}
+		for name := range f.objects {
+			if strings.HasPrefix(name, prefix) {
+				items = append(items, map[string]string{"bucket": "test-bucket", "name": name})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"items": items})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, objectsPath+"/"):
+		name, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), objectsPath+"/"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, ok := f.objects[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeGCSObjects) names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := make([]string, 0, len(f.objects))
+	for name := range f.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestGCSDeliveriesPageCache_Prune(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	reachedPage := deliveriesCacheObject("")
+	stalePage := deliveriesCacheObject("stale-cursor")
+	fakeGCS := &fakeGCSObjects{objects: map[string]struct{}{
+		reachedPage:              {},
+		stalePage:                {},
+		"retry-lock":             {},
+		"checkpoints/1234567890": {},
+	}}
+	srv := httptest.NewServer(fakeGCS)
+	t.Cleanup(srv.Close)
+
+	cache, err := NewGCSDeliveriesPageCache(ctx, "test-bucket",
+		option.WithEndpoint(srv.URL+"/storage/v1/"),
+		option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := cache.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// the first page was walked on the last run
+	cache.reach(reachedPage)
+
+	deleted, err := cache.Prune(ctx)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if got, want := deleted, 1; got != want {
+		t.Errorf("expected %d deleted pages, got %d", want, got)
+	}
+	want := []string{"checkpoints/1234567890", reachedPage, "retry-lock"}
+	sort.Strings(want)
+	if diff := cmp.Diff(fakeGCS.names(), want); diff != "" {
+		t.Errorf("objects (-got,+want):\n%s", diff)
+	}
+
+	// the pages reached are forgotten by a prune, so a page no longer reached
+	// by the next run is deleted
+	deleted, err = cache.Prune(ctx)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if got, want := deleted, 1; got != want {
+		t.Errorf("expected %d deleted pages, got %d", want, got)
+	}
+	if diff := cmp.Diff(fakeGCS.names(), []string{"checkpoints/1234567890", "retry-lock"}); diff != "" {
+		t.Errorf("objects (-got,+want):\n%s", diff)
+	}
+}
@@ -16,6 +16,7 @@ package retry
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/google/go-github/v61/github"
 )
@@ -31,11 +32,26 @@ type redeliverEventRes struct {
 }
 
 type MockGitHub struct {
-	listDeliveries *listDeliveriesRes
-	redeliverEvent *redeliverEventRes
+	listDeliveries   *listDeliveriesRes
+	redeliverEvent   *redeliverEventRes
+	redeliverEventFn func(ctx context.Context, deliveryID int64) error
+
+	// pagesByCursor overrides the listed deliveries of the cursors it
+	// contains, an unknown cursor fails.
+	pagesByCursor map[string]*listDeliveriesRes
+
+	listedCursors []string
 }
 
 func (m *MockGitHub) ListDeliveries(ctx context.Context, opts *github.ListCursorOptions) ([]*github.HookDelivery, *github.Response, error) {
+	m.listedCursors = append(m.listedCursors, opts.Cursor)
+	if m.pagesByCursor != nil {
+		page, ok := m.pagesByCursor[opts.Cursor]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown cursor %q", opts.Cursor)
+		}
+		return page.deliveries, page.res, page.err
+	}
 	if m.listDeliveries != nil {
 		return m.listDeliveries.deliveries, m.listDeliveries.res, m.listDeliveries.err
 	}
@@ -43,6 +59,9 @@ func (m *MockGitHub) ListDeliveries(ctx context.Context, opts *github.ListCursor
 }
 
 func (m *MockGitHub) RedeliverEvent(ctx context.Context, deliveryID int64) error {
+	if m.redeliverEventFn != nil {
+		return m.redeliverEventFn(ctx, deliveryID)
+	}
 	if m.redeliverEvent != nil {
 		return m.redeliverEvent.err
 	}
@@ -0,0 +1,215 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/sethvargo/go-gcslock"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+const (
+	// lockObject is the name of the object in the bucket that holds the lock.
+	lockObject = "retry-lock"
+
+	// lockNotBeforeKey is the metadata key of the lock object that holds the
+	// expiry of the lock, it must match the key used by [gcslock.Lock].
+	lockNotBeforeKey = "nbf"
+)
+
+// errLockLost is returned when renewing a lock that is no longer held, another
+// execution acquired it after its lease expired.
+var errLockLost = errors.New("retry lock was lost to another execution")
+
+// Lock adheres to the interaction the retry service has with its lock. In
+// addition to acquiring the lock, the lease of a held lock can be renewed so
+// that it doesn't expire during a long run.
+type Lock interface {
+	gcslock.Lockable
+	Renew(ctx context.Context, ttl time.Duration) error
+}
+
+// GCSLock is a [gcslock.Lock] whose lease can be renewed.
+type GCSLock struct {
+	*gcslock.Lock
+
+	client *storage.Client
+	bucket string
+	object string
+
+	// the generation and metageneration of the lock object when it was last
+	// acquired or renewed, any other write to it means the lock changed hands
+	mu             sync.Mutex
+	generation     int64
+	metageneration int64
+}
+
+// NewGCSLock creates a lock on the retry lock object in the given bucket.
+func NewGCSLock(ctx context.Context, bucket string, opts ...option.ClientOption) (*GCSLock, error) {
+	lock, err := gcslock.New(ctx, bucket, lockObject, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lock: %w", err)
+	}
+
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+
+	return &GCSLock{
+		Lock:   lock,
+		client: client,
+		bucket: bucket,
+		object: lockObject,
+	}, nil
+}
+
+// Acquire acquires the lock like [gcslock.Lock.Acquire] and records the
+// version of the lock object, so that only this execution renews it.
+func (l *GCSLock) Acquire(ctx context.Context, ttl time.Duration) error {
+	if err := l.Lock.Acquire(ctx, ttl); err != nil {
+		return err //nolint:wrapcheck // Want passthrough
+	}
+
+	// no other execution can acquire the lock before its lease expires
+	attrs, err := l.client.Bucket(l.bucket).Object(l.object).Attrs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get lock object: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.generation = attrs.Generation
+	l.metageneration = attrs.Metageneration
+	return nil
+}
+
+// Renew extends the lease of the held lock to ttl from now. The lock object is
+// only updated if it was not written since this execution acquired or last
+// renewed it, errLockLost is returned otherwise.
+func (l *GCSLock) Renew(ctx context.Context, ttl time.Duration) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.generation == 0 {
+		return errLockLost
+	}
+
+	attrs, err := l.client.Bucket(l.bucket).Object(l.object).
+		If(storage.Conditions{
+			GenerationMatch:     l.generation,
+			MetagenerationMatch: l.metageneration,
+		}).
+		Update(ctx, storage.ObjectAttrsToUpdate{
+			Metadata: map[string]string{
+				lockNotBeforeKey: strconv.FormatInt(now.Add(ttl.Truncate(time.Second)).Unix(), 10),
+			},
+		})
+	if err != nil {
+		var googleErr *googleapi.Error
+		if errors.Is(err, storage.ErrObjectNotExist) ||
+			(errors.As(err, &googleErr) && googleErr.Code == http.StatusPreconditionFailed) {
+			return fmt.Errorf("%w: %w", errLockLost, err)
+		}
+		return fmt.Errorf("failed to update lock object: %w", err)
+	}
+
+	l.metageneration = attrs.Metageneration
+	return nil
+}
+
+// Close closes the clients of the lock. It does not delete the lock.
+func (l *GCSLock) Close(ctx context.Context) error {
+	if err := l.Lock.Close(ctx); err != nil {
+		return fmt.Errorf("failed to close lock: %w", err)
+	}
+	if err := l.client.Close(); err != nil {
+		return fmt.Errorf("failed to close storage client: %w", err)
+	}
+	return nil
+}
+
+// renewLock periodically renews the lease of the retry lock in the background
+// until the returned function is called, which waits for the renewal to stop.
+// A failed renewal is logged and retried on the next interval, unless the lock
+// was lost, in which case the run is canceled with errLockLost as the cause.
+func (s *Server) renewLock(ctx context.Context, cancelRun context.CancelCauseFunc) func() {
+	logger := logging.FromContext(ctx)
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(s.lockRenewalInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := s.gcsLock.Renew(ctx, s.lockTTL); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if errors.Is(err, errLockLost) {
+					logger.ErrorContext(ctx, "lost lock, stopping run",
+						"method", "Renew",
+						"error", err,
+						"lock_ttl", s.lockTTL)
+					cancelRun(errLockLost)
+					return
+				}
+				logger.ErrorContext(ctx, "failed to renew lock",
+					"method", "Renew",
+					"error", err,
+					"lock_ttl", s.lockTTL)
+				continue
+			}
+			logger.DebugContext(ctx, "renewed lock", "lock_ttl", s.lockTTL)
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// lockLost returns errLockLost if the run was canceled because its lock was
+// lost.
+func lockLost(ctx context.Context) error {
+	if errors.Is(context.Cause(ctx), errLockLost) {
+		return errLockLost
+	}
+	return nil
+}
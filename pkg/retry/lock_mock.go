@@ -16,6 +16,7 @@ package retry
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,9 +28,16 @@ type closeRes struct {
 	err error
 }
 
+type renewRes struct {
+	err error
+}
+
 type MockLock struct {
 	acquire *acquireRes
 	close   *closeRes
+	renew   *renewRes
+
+	renewCount atomic.Int64
 }
 
 func (m *MockLock) Acquire(context.Context, time.Duration) error {
@@ -39,3 +47,11 @@ func (m *MockLock) Acquire(context.Context, time.Duration) error {
 func (m *MockLock) Close(context.Context) error {
 	return m.close.err
 }
+
+func (m *MockLock) Renew(context.Context, time.Duration) error {
+	m.renewCount.Add(1)
+	if m.renew == nil {
+		return nil
+	}
+	return m.renew.err
+}
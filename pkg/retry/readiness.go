@@ -0,0 +1,61 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// dependencyBigQuery names the BigQuery dataset in a readiness response.
+const dependencyBigQuery = "bigquery"
+
+// readinessTimeout bounds the time spent checking the dependencies, so that
+// an unreachable dependency fails the check instead of being retried until
+// the client gives up.
+const readinessTimeout = 5 * time.Second
+
+// readinessResponse is the response body rendered by the readiness check.
+type readinessResponse struct {
+	Status             string   `json:"status"`
+	FailedDependencies []string `json:"failed_dependencies,omitempty"`
+}
+
+// handleReadiness responds with 200 when the BigQuery dataset of the retry
+// service is reachable, and with 503 naming the failing dependency otherwise.
+// Unlike /healthz, this fetches the metadata of the dataset.
+func (s *Server) handleReadiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		logger := logging.FromContext(ctx)
+
+		if err := s.datastore.CheckDataset(ctx); err != nil {
+			logger.ErrorContext(ctx, "readiness check failed",
+				"dependency", dependencyBigQuery,
+				"error", err,
+			)
+			s.h.RenderJSON(w, http.StatusServiceUnavailable, &readinessResponse{
+				Status:             "unavailable",
+				FailedDependencies: []string{dependencyBigQuery},
+			})
+			return
+		}
+		s.h.RenderJSON(w, http.StatusOK, &readinessResponse{Status: statusOK["status"]})
+	})
+}
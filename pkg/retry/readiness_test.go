@@ -0,0 +1,92 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abcxyz/pkg/renderer"
+)
+
+func TestHandleReadiness(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cases := []struct {
+		name                    string
+		datastoreClientOverride *MockDatastore
+		expStatusCode           int
+		expRespBody             string
+	}{
+		{
+			name:                    "success",
+			datastoreClientOverride: &MockDatastore{},
+			expStatusCode:           http.StatusOK,
+			expRespBody:             `{"status":"ok"}`,
+		},
+		{
+			name: "bigquery_failure",
+			datastoreClientOverride: &MockDatastore{
+				checkDataset: &checkDatasetRes{err: errors.New("dataset not found")},
+			},
+			expStatusCode: http.StatusServiceUnavailable,
+			expRespBody:   `{"status":"unavailable","failed_dependencies":["bigquery"]}`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, &Config{}, &RetryClientOptions{
+				DatastoreClientOverride: tc.datastoreClientOverride,
+				GCSLockClientOverride:   &MockLock{},
+				GitHubOverride:          &MockGitHub{},
+			})
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			resp := httptest.NewRecorder()
+			srv.handleReadiness().ServeHTTP(resp, req)
+
+			if resp.Code != tc.expStatusCode {
+				t.Errorf("StatusCode got: %d want: %d", resp.Code, tc.expStatusCode)
+			}
+
+			if strings.TrimSpace(resp.Body.String()) != tc.expRespBody {
+				t.Errorf("ResponseBody got: %s want: %s", resp.Body.String(), tc.expRespBody)
+			}
+		})
+	}
+}
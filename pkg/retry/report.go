@@ -0,0 +1,117 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// ReportFormatText renders a report as human-readable text.
+	ReportFormatText = "text"
+
+	// ReportFormatJSON renders a report as a single JSON object.
+	ReportFormatJSON = "json"
+
+	// ReportFormatCSV renders a report as CSV with a row per repository and a
+	// final row with the totals.
+	ReportFormatCSV = "csv"
+)
+
+// ReportFormats are the supported report formats.
+var ReportFormats = []string{ReportFormatText, ReportFormatJSON, ReportFormatCSV}
+
+// Report is the summary of a completed retry run, including the counts of
+// each repository.
+type Report struct {
+	Outcome               Outcome              `json:"outcome"`
+	TotalEventCount       int                  `json:"total_event_count"`
+	NewEventCount         int                  `json:"new_event_count"`
+	FailedEventCount      int                  `json:"failed_event_count"`
+	RedeliveredEventCount int                  `json:"redelivered_event_count"`
+	Repositories          []*RepositorySummary `json:"repositories"`
+}
+
+// NewReport creates the report of a retry run from its result and summary.
+func NewReport(result *RetryResult, summary *RetrySummary) *Report {
+	return &Report{
+		Outcome:               result.Outcome,
+		TotalEventCount:       result.TotalEventCount,
+		NewEventCount:         result.NewEventCount,
+		FailedEventCount:      result.FailedEventCount,
+		RedeliveredEventCount: result.RedeliveredEventCount,
+		Repositories:          summary.Repositories(),
+	}
+}
+
+// Write renders the report to w in the given format.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case ReportFormatText:
+		return r.writeText(w)
+	case ReportFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+		return nil
+	case ReportFormatCSV:
+		return r.writeCSV(w)
+	default:
+		return fmt.Errorf("unsupported report format %q", format)
+	}
+}
+
+func (r *Report) writeText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "outcome: %s\ntotal events: %d\nnew events: %d\nfailed events: %d\nredelivered events: %d\n",
+		r.Outcome, r.TotalEventCount, r.NewEventCount, r.FailedEventCount, r.RedeliveredEventCount); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	for _, repo := range r.Repositories {
+		if _, err := fmt.Fprintf(w, "repository %d: %d new, %d failed, %d redelivered\n",
+			repo.RepositoryID, repo.NewEventCount, repo.FailedEventCount, repo.RedeliveredEventCount); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *Report) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	records := [][]string{{"repository_id", "new_event_count", "failed_event_count", "redelivered_event_count"}}
+	for _, repo := range r.Repositories {
+		records = append(records, []string{
+			strconv.FormatInt(repo.RepositoryID, 10),
+			strconv.Itoa(repo.NewEventCount),
+			strconv.Itoa(repo.FailedEventCount),
+			strconv.Itoa(repo.RedeliveredEventCount),
+		})
+	}
+	records = append(records, []string{
+		"total",
+		strconv.Itoa(r.NewEventCount),
+		strconv.Itoa(r.FailedEventCount),
+		strconv.Itoa(r.RedeliveredEventCount),
+	})
+	if err := cw.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// resumePrefix is the prefix of the objects in the bucket that hold the
+// resume state of the installations.
+const resumePrefix = "retry-resume/"
+
+// ResumeState is the progress of a walk over the deliveries of an
+// installation that did not complete, so that a restarted run can resume the
+// walk at the cursor of the next page instead of walking the pages again.
+type ResumeState struct {
+	// PrevCheckpoint is the checkpoint the walk started from, the state is
+	// only resumed by a run starting from the same checkpoint.
+	PrevCheckpoint string `json:"prev_checkpoint"`
+
+	// FirstCheckpoint is the ID of the newest delivery of the walk, which the
+	// checkpoint is advanced to once the walk completes.
+	FirstCheckpoint string `json:"first_checkpoint"`
+
+	// Cursor is the cursor of the next page of deliveries to walk.
+	Cursor string `json:"cursor"`
+
+	TotalEventCount   int `json:"total_event_count"`
+	NewEventCount     int `json:"new_event_count"`
+	SkippedEventCount int `json:"skipped_event_count"`
+
+	// FailedEvents are the failed deliveries observed on the pages already
+	// walked, from newest to oldest.
+	FailedEvents []*ResumeEvent `json:"failed_events"`
+}
+
+// ResumeEvent is a failed delivery of a [ResumeState].
+type ResumeEvent struct {
+	EventID      int64  `json:"event_id"`
+	GUID         string `json:"guid"`
+	RepositoryID int64  `json:"repository_id"`
+}
+
+// ResumeStore persists the resume state of the installations.
+type ResumeStore interface {
+	// Get returns the resume state of the installation, or nil if there is
+	// none.
+	Get(ctx context.Context, installation string) (*ResumeState, error)
+
+	// Put replaces the resume state of the installation.
+	Put(ctx context.Context, installation string, state *ResumeState) error
+
+	// Delete deletes the resume state of the installation, if any.
+	Delete(ctx context.Context, installation string) error
+
+	Close() error
+}
+
+var _ ResumeStore = (*GCSResumeStore)(nil)
+
+// GCSResumeStore stores the resume state of each installation as a JSON
+// object in a Cloud Storage bucket.
+type GCSResumeStore struct {
+	client *storage.Client
+	bucket string
+}
+
+// NewGCSResumeStore creates a store of the resume state of the installations
+// in the given bucket.
+func NewGCSResumeStore(ctx context.Context, bucket string, opts ...option.ClientOption) (*GCSResumeStore, error) {
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+	return &GCSResumeStore{
+		client: client,
+		bucket: bucket,
+	}, nil
+}
+
+// Get implements [ResumeStore].
+func (s *GCSResumeStore) Get(ctx context.Context, installation string) (*ResumeState, error) {
+	object := resumeObject(installation)
+	reader, err := s.client.Bucket(s.bucket).Object(object).NewReader(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read object gs://%s/%s: %w", s.bucket, object, err)
+	}
+	defer reader.Close()
+
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object gs://%s/%s: %w", s.bucket, object, err)
+	}
+
+	var state ResumeState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse object gs://%s/%s: %w", s.bucket, object, err)
+	}
+	return &state, nil
+}
+
+// Put implements [ResumeStore].
+func (s *GCSResumeStore) Put(ctx context.Context, installation string, state *ResumeState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal resume state: %w", err)
+	}
+
+	object := resumeObject(installation)
+	writer := s.client.Bucket(s.bucket).Object(object).NewWriter(ctx)
+	writer.ContentType = "application/json"
+	if _, err := writer.Write(b); err != nil {
+		// the object is not created if the writer is not closed cleanly
+		_ = writer.CloseWithError(err)
+		return fmt.Errorf("failed to write object gs://%s/%s: %w", s.bucket, object, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to write object gs://%s/%s: %w", s.bucket, object, err)
+	}
+	return nil
+}
+
+// Delete implements [ResumeStore].
+func (s *GCSResumeStore) Delete(ctx context.Context, installation string) error {
+	object := resumeObject(installation)
+	if err := s.client.Bucket(s.bucket).Object(object).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("failed to delete object gs://%s/%s: %w", s.bucket, object, err)
+	}
+	return nil
+}
+
+// Close handles the graceful shutdown of the storage client.
+func (s *GCSResumeStore) Close() error {
+	if err := s.client.Close(); err != nil {
+		return fmt.Errorf("failed to close storage client: %w", err)
+	}
+	return nil
+}
+
+// resumeObject returns the name of the object holding the resume state of the
+// installation. The unnamed installation is kept apart from the named ones,
+// whose names are escaped into a valid object name.
+func resumeObject(installation string) string {
+	if installation == "" {
+		return resumePrefix + "default.json"
+	}
+	return resumePrefix + "installations/" + url.PathEscape(installation) + ".json"
+}
+
+// resumeWalk returns the resume state of the installation if the walk over
+// its deliveries from the given checkpoint was interrupted. A resume state
+// that can't be read or was left by a walk from another checkpoint is ignored,
+// the deliveries are walked from the start.
+func (s *Server) resumeWalk(ctx context.Context, inst *installation, prevCheckpoint string) *ResumeState {
+	if s.resumeStore == nil {
+		return nil
+	}
+
+	logger := logging.FromContext(ctx)
+
+	state, err := s.resumeStore.Get(ctx, inst.name)
+	if err != nil {
+		logger.WarnContext(ctx, "failed to read resume state, walking deliveries from the start",
+			"method", "GetResumeState",
+			"error", err)
+		return nil
+	}
+	if state == nil || state.Cursor == "" {
+		return nil
+	}
+	if state.PrevCheckpoint != prevCheckpoint {
+		logger.InfoContext(ctx, "ignoring resume state of a walk from another checkpoint",
+			"resume_prev_checkpoint", state.PrevCheckpoint)
+		return nil
+	}
+
+	logger.InfoContext(ctx, "resuming walk over deliveries",
+		"cursor", state.Cursor,
+		"first_checkpoint", state.FirstCheckpoint,
+		"failed_event_count", len(state.FailedEvents))
+	return state
+}
+
+// persistWalk persists the progress of the walk over the deliveries of the
+// installation. Failing to persist it does not affect the retry run, a
+// restarted run walks the deliveries from the last persisted state instead.
+func (s *Server) persistWalk(ctx context.Context, inst *installation, state *ResumeState) {
+	if err := s.resumeStore.Put(ctx, inst.name, state); err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to persist resume state",
+			"method", "PutResumeState",
+			"cursor", state.Cursor,
+			"error", err)
+	}
+}
+
+// clearWalk deletes the resume state of the installation once the walk over
+// its deliveries is no longer to be resumed.
+func (s *Server) clearWalk(ctx context.Context, inst *installation) {
+	if s.resumeStore == nil {
+		return
+	}
+
+	if err := s.resumeStore.Delete(ctx, inst.name); err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "failed to delete resume state",
+			"method", "DeleteResumeState",
+			"error", err)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
@@ -26,11 +27,15 @@ import (
 	"github.com/sethvargo/go-gcslock"
 
 	"github.com/abcxyz/pkg/logging"
+	"github.com/abcxyz/pkg/workerpool"
 )
 
+// ErrLockHeld is returned by a retry run if another execution holds the
+// retry lock.
+var ErrLockHeld = errors.New("retry lock is held by another execution")
+
 var (
-	statusOK       = map[string]string{"status": "ok"}
-	statusAccepted = map[string]string{"status": "accepted"}
+	statusOK = map[string]string{"status": "ok"}
 
 	errAcquireLock         = fmt.Errorf("failed to acquire google cloud storage lock")
 	errDeliveryEventExists = fmt.Errorf("failed to check if event exist")
@@ -39,219 +44,583 @@ var (
 	errCallingGitHub       = fmt.Errorf("failed to call github")
 )
 
+const (
+	// RedeliverOrderOldest redelivers the failed events of a run from oldest to
+	// newest.
+	RedeliverOrderOldest = "oldest"
+
+	// RedeliverOrderNewest redelivers the failed events of a run from newest to
+	// oldest, so that the most recent data lands first, e.g. when recovering
+	// from an incident.
+	RedeliverOrderNewest = "newest"
+)
+
+// Outcome describes the overall outcome of a single retry run.
+type Outcome string
+
+const (
+	// OutcomeNoNewDeliveries is the outcome of a run that observed no
+	// deliveries newer than the last checkpoint. A long streak of runs with this
+	// outcome may indicate that the webhook has stopped receiving events.
+	OutcomeNoNewDeliveries Outcome = "NO_NEW_DELIVERIES"
+
+	// OutcomeProcessed is the outcome of a run that processed at least one
+	// delivery newer than the last checkpoint.
+	OutcomeProcessed Outcome = "PROCESSED"
+
+	// OutcomePartiallyProcessed is the outcome of a run that stopped at a failed
+	// redelivery. The events redelivered before the failure are counted and the
+	// checkpoint is advanced past them, so the next run picks up from there.
+	OutcomePartiallyProcessed Outcome = "PARTIALLY_PROCESSED"
+)
+
+// RetryResult summarizes a run of the retry service. It is returned as the
+// response body of the retry endpoint and logged so that it can be used to
+// derive log-based metrics. A run that stopped at a failed redelivery is
+// summarized as well, with the progress made before the failure.
+type RetryResult struct {
+	Status                string  `json:"status"`
+	Outcome               Outcome `json:"outcome"`
+	TotalEventCount       int     `json:"total_event_count"`
+	NewEventCount         int     `json:"new_event_count"`
+	FailedEventCount      int     `json:"failed_event_count"`
+	SkippedEventCount     int     `json:"skipped_event_count"`
+	RedeliveredEventCount int     `json:"redelivered_event_count"`
+}
+
+// add adds the counts of the result of a single installation to the totals of
+// the run. The run processed deliveries if any installation did.
+func (r *RetryResult) add(other *RetryResult) {
+	r.TotalEventCount += other.TotalEventCount
+	r.NewEventCount += other.NewEventCount
+	r.FailedEventCount += other.FailedEventCount
+	r.SkippedEventCount += other.SkippedEventCount
+	r.RedeliveredEventCount += other.RedeliveredEventCount
+	if other.Outcome != OutcomeNoNewDeliveries {
+		r.Outcome = OutcomeProcessed
+	}
+}
+
+// installation identifies an installation of the GitHub App whose failed
+// deliveries are retried with a checkpoint of their own, keyed by its name. The
+// unnamed installation without ID covers all deliveries of the GitHub App.
+type installation struct {
+	name string
+	id   int64
+}
+
+// matches reports whether the delivery belongs to the installation.
+func (i *installation) matches(delivery *github.HookDelivery) bool {
+	return i.id == 0 || delivery.GetInstallationID() == i.id
+}
+
 // eventIdentifier represents the required information used by the retry
 // service for handling a GitHub event.
 type eventIdentifier struct {
-	eventID int64
-	guid    string
+	eventID      int64
+	guid         string
+	repositoryID int64
 }
 
 // handleRetry handles calling GitHub APIs to search and retry for failed
 // events.
 func (s *Server) handleRetry() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		now := time.Now().UTC()
-		ctx := r.Context()
-		logger := logging.FromContext(ctx)
-
-		if err := s.gcsLock.Acquire(ctx, s.lockTTL); err != nil {
-			var lockErr *gcslock.LockHeldError
-			if errors.As(err, &lockErr) {
-				logger.InfoContext(ctx, "lock is already acquired by another execution",
-					"code", http.StatusOK,
-					"body", errAcquireLock,
-					"method", "Acquire",
-					"error", lockErr.Error(),
-				)
-
+		result, _, err := s.Run(r.Context())
+		if err != nil {
+			if errors.Is(err, ErrLockHeld) {
 				// unable to obtain the lock, return a 200 so the scheduler doesn't
 				// attempt to reinvoke
 				s.h.RenderJSON(w, http.StatusOK, statusOK)
 				return
 			}
 
-			logger.ErrorContext(ctx, "failed to call cloud storage",
-				"code", http.StatusInternalServerError,
+			for _, renderedErr := range []error{errAcquireLock, errLockLost, errRetrieveCheckpoint, errWriteCheckpoint} {
+				if errors.Is(err, renderedErr) {
+					s.h.RenderJSON(w, http.StatusInternalServerError, renderedErr)
+					return
+				}
+			}
+
+			if result != nil {
+				// the run stopped part way, report what was redelivered before the
+				// failure
+				s.h.RenderJSON(w, http.StatusInternalServerError, result)
+				return
+			}
+
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		s.h.RenderJSON(w, http.StatusAccepted, result)
+	})
+}
+
+// Run searches for failed events newer than the last checkpoint, attempts to
+// redeliver them and advances the checkpoint, for each configured installation
+// in turn. It returns the totals of the run across all installations as well
+// as their per-repository breakdown. ErrLockHeld is returned if another
+// execution holds the retry lock.
+//
+// If a redelivery fails, the run stops and the error is returned along with a
+// result with the OutcomePartiallyProcessed outcome, which counts the events
+// redelivered before the failure. Installations after the failed one are
+// retried on the next run.
+func (s *Server) Run(ctx context.Context) (*RetryResult, *RetrySummary, error) {
+	now := time.Now().UTC()
+	logger := logging.FromContext(ctx)
+
+	if err := s.gcsLock.Acquire(ctx, s.lockTTL); err != nil {
+		var lockErr *gcslock.LockHeldError
+		if errors.As(err, &lockErr) {
+			logger.InfoContext(ctx, "lock is already acquired by another execution",
+				"code", http.StatusOK,
 				"body", errAcquireLock,
 				"method", "Acquire",
-				"error", err.Error())
+				"error", lockErr.Error(),
+			)
+			return nil, nil, fmt.Errorf("%w: %w", ErrLockHeld, lockErr)
+		}
 
-			// unknown error
-			s.h.RenderJSON(w, http.StatusInternalServerError, errAcquireLock)
-			return
+		logger.ErrorContext(ctx, "failed to call cloud storage",
+			"code", http.StatusInternalServerError,
+			"body", errAcquireLock,
+			"method", "Acquire",
+			"error", err.Error())
+
+		// unknown error
+		return nil, nil, fmt.Errorf("%w: %w", errAcquireLock, err)
+	}
+
+	// keep the lock for the whole run, even if it takes longer than its TTL,
+	// the run is canceled if the lock is lost to another execution
+	if s.lockRenewalInterval > 0 {
+		var cancelRun context.CancelCauseFunc
+		ctx, cancelRun = context.WithCancelCause(ctx)
+		defer cancelRun(nil)
+
+		stopRenewal := s.renewLock(ctx, cancelRun)
+		defer stopRenewal()
+	}
+
+	// per-repository counts across all installations, logged alongside the
+	// totals
+	summary := newRetrySummary()
+
+	result := &RetryResult{
+		Status:  "accepted",
+		Outcome: OutcomeNoNewDeliveries,
+	}
+	for _, inst := range s.installations {
+		if err := lockLost(ctx); err != nil {
+			result.Status = "failed"
+			result.Outcome = OutcomePartiallyProcessed
+			return result, summary, err
 		}
 
-		// read the last checkpoint from checkpoint table
-		prevCheckpoint, err := s.datastore.RetrieveCheckpointID(ctx, s.checkpointTableID)
+		installationResult, err := s.runInstallation(ctx, now, inst, summary)
+		if err != nil {
+			if lostErr := lockLost(ctx); lostErr != nil && !errors.Is(err, errLockLost) {
+				// the run was canceled part way because the lock was lost
+				err = fmt.Errorf("%w: %w", lostErr, err)
+			}
+			if installationResult == nil {
+				return nil, nil, err
+			}
+
+			result.add(installationResult)
+			result.Status = "failed"
+			result.Outcome = OutcomePartiallyProcessed
+			return result, summary, err
+		}
+		result.add(installationResult)
+	}
+
+	s.pruneDeliveriesPageCache(ctx)
+
+	logger.InfoContext(ctx, "successful",
+		"code", http.StatusAccepted,
+		"outcome", result.Outcome,
+		"total_event_count", result.TotalEventCount,
+		"new_event_count", result.NewEventCount,
+		"failed_event_count", result.FailedEventCount,
+		"skipped_event_count", result.SkippedEventCount,
+		"redelivered_event_count", result.RedeliveredEventCount,
+		"repositories", summary.Repositories(),
+	)
+	return result, summary, nil
+}
+
+// runInstallation retries the failed events of a single installation newer
+// than its last checkpoint and advances its checkpoint. Each redelivered event
+// is counted towards its repository in the summary. If a redelivery fails, the
+// error is returned along with the counts of the installation.
+func (s *Server) runInstallation(ctx context.Context, now time.Time, inst *installation, summary *RetrySummary) (*RetryResult, error) {
+	logger := logging.FromContext(ctx)
+	if inst.name != "" {
+		logger = logger.With("installation", inst.name)
+		ctx = logging.WithLogger(ctx, logger)
+	}
+
+	// read the last checkpoint from checkpoint table
+	prevCheckpoint, err := s.datastore.RetrieveCheckpointID(ctx, s.checkpointTableID, inst.name)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to call RetrieveCheckpointID",
+			"code", http.StatusInternalServerError,
+			"body", errRetrieveCheckpoint,
+			"method", "RetrieveCheckpointID",
+			"error", err,
+		)
+		return nil, fmt.Errorf("%w: %w", errRetrieveCheckpoint, err)
+	}
+
+	logger.InfoContext(ctx, "retrieved last checkpoint", "prev_checkpoint", prevCheckpoint)
+
+	var totalEventCount int
+	var newEventCount int
+	var skippedEventCount int
+	var firstCheckpoint string
+	var cursor string
+	newCheckpoint := prevCheckpoint
+
+	// store all observed failures in memory from the latest event up to the prevCheckpoint
+	var failedEventsHistory []*eventIdentifier
+	var found bool
+
+	// resume an interrupted walk from the same checkpoint at the next page
+	// instead of walking the pages again
+	resumed := s.resumeWalk(ctx, inst, prevCheckpoint)
+	if resumed != nil {
+		cursor = resumed.Cursor
+		firstCheckpoint = resumed.FirstCheckpoint
+		totalEventCount = resumed.TotalEventCount
+		newEventCount = resumed.NewEventCount
+		skippedEventCount = resumed.SkippedEventCount
+		for _, event := range resumed.FailedEvents {
+			failedEventsHistory = append(failedEventsHistory, &eventIdentifier{
+				eventID:      event.EventID,
+				guid:         event.GUID,
+				repositoryID: event.RepositoryID,
+			})
+		}
+	}
+	var pages int
+
+	// the first run of this service will not have a cursor therefore we must
+	// ensure we run the loop at least once
+	for ok := true; ok; ok = (cursor != "" && !found) {
+		// call list deliveries API, first call is intentionally an empty string
+		deliveries, res, err := s.github.ListDeliveries(ctx, &github.ListCursorOptions{
+			Cursor:  cursor,
+			PerPage: 100,
+		})
 		if err != nil {
-			logger.ErrorContext(ctx, "failed to call RetrieveCheckpointID",
+			// the cursor of the resume state may have expired, the next run
+			// walks the deliveries from the start
+			if resumed != nil && pages == 0 {
+				s.clearWalk(ctx, inst)
+			}
+			logger.ErrorContext(ctx, "failed to call ListDeliveries",
 				"code", http.StatusInternalServerError,
-				"body", errRetrieveCheckpoint,
-				"method", "RetrieveCheckpointID",
+				"body", errCallingGitHub,
+				"method", "RedeliverEvent",
 				"error", err,
 			)
-			s.h.RenderJSON(w, http.StatusInternalServerError, errRetrieveCheckpoint)
-			return
+			return nil, fmt.Errorf("%w: %w", errCallingGitHub, err)
 		}
 
-		logger.InfoContext(ctx, "retrieved last checkpoint", "prev_checkpoint", prevCheckpoint)
-
-		var totalEventCount int
-		var redeliveredEventCount int
-		var firstCheckpoint string
-		var cursor string
-		newCheckpoint := prevCheckpoint
-
-		// store all observed failures in memory from the latest event up to the prevCheckpoint
-		var failedEventsHistory []*eventIdentifier
-		var found bool
-
-		// the first run of this service will not have a cursor therefore we must
-		// ensure we run the loop at least once
-		for ok := true; ok; ok = (cursor != "" && !found) {
-			// call list deliveries API, first call is intentionally an empty string
-			deliveries, res, err := s.github.ListDeliveries(ctx, &github.ListCursorOptions{
-				Cursor:  cursor,
-				PerPage: 100,
-			})
-			if err != nil {
-				logger.ErrorContext(ctx, "failed to call ListDeliveries",
-					"code", http.StatusInternalServerError,
-					"body", errCallingGitHub,
-					"method", "RedeliverEvent",
-					"error", err,
-				)
-				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-				return
-			}
+		if len(deliveries) == 0 {
+			logger.InfoContext(ctx, "no deliveries from GitHub",
+				"cursor", cursor)
+			break
+		}
 
-			if len(deliveries) == 0 {
-				logger.InfoContext(ctx, "no deliveries from GitHub",
-					"cursor", cursor)
-				break
+		logger.InfoContext(ctx, "retrieve deliveries from GitHub",
+			"cursor", cursor,
+			"size", len(deliveries))
+
+		// update the cursor
+		cursor = res.Cursor
+
+		// for each failed delivery, redeliver
+		for i := 0; i < len(deliveries); i++ {
+			event := deliveries[i]
+
+			// deliveries of other installations are retried with their own
+			// checkpoint
+			if !inst.matches(event) {
+				continue
 			}
 
-			// in anticipation of the happy path, store the first event to advance the
-			// cursor
+			// append to the total events counter
+			totalEventCount += 1
+
+			// in anticipation of the happy path, store the first event to advance
+			// the cursor
 			if firstCheckpoint == "" {
-				firstCheckpoint = strconv.FormatInt(*deliveries[0].ID, 10)
+				firstCheckpoint = strconv.FormatInt(*event.ID, 10)
 			}
 
-			logger.InfoContext(ctx, "retrieve deliveries from GitHub",
-				"cursor", cursor,
-				"size", len(deliveries))
+			// reached the last checkpoint, all events equal to and older than this
+			// one have already been processed
+			if prevCheckpoint == strconv.FormatInt(*event.ID, 10) {
+				found = true
+				break
+			}
+			newEventCount += 1
 
-			// update the cursor
-			cursor = res.Cursor
+			// check payload and see if its been successfully delivered, if so skip over it
+			if *event.StatusCode >= 200 && *event.StatusCode <= 299 {
+				summary.addNewDelivery(event, false)
+				continue
+			}
+			summary.addNewDelivery(event, true)
+
+			// GitHub does not redeliver events older than its retention window, a
+			// redelivery would be guaranteed to fail so count it as skipped instead
+			if s.maxDeliveryAge > 0 && event.DeliveredAt != nil && event.DeliveredAt.Before(now.Add(-s.maxDeliveryAge)) {
+				logger.InfoContext(ctx, "skipping redelivery of failed event older than the max delivery age",
+					"event_id", *event.ID,
+					"delivered_at", event.DeliveredAt.Time,
+					"max_delivery_age", s.maxDeliveryAge)
+				skippedEventCount += 1
+				continue
+			}
 
-			// for each failed delivery, redeliver
-			for i := 0; i < len(deliveries); i++ {
-				// append to the total events counter
-				totalEventCount += 1
+			failedEventsHistory = append(failedEventsHistory, &eventIdentifier{
+				eventID:      *event.ID,
+				guid:         *event.GUID,
+				repositoryID: event.GetRepositoryID(),
+			})
+		}
 
-				event := deliveries[i]
+		// persist the progress of the walk every configured number of pages,
+		// so that a restarted run resumes at the next page
+		pages++
+		if s.resumeCursorPages > 0 && pages%s.resumeCursorPages == 0 && cursor != "" && !found {
+			s.persistWalk(ctx, inst, &ResumeState{
+				PrevCheckpoint:    prevCheckpoint,
+				FirstCheckpoint:   firstCheckpoint,
+				Cursor:            cursor,
+				TotalEventCount:   totalEventCount,
+				NewEventCount:     newEventCount,
+				SkippedEventCount: skippedEventCount,
+				FailedEvents:      resumeEvents(failedEventsHistory),
+			})
+		}
+	}
 
-				// reached the last checkpoint, all events equal to and older than this
-				// one have already been processed
-				if prevCheckpoint == strconv.FormatInt(*event.ID, 10) {
-					found = true
-					break
-				}
+	failedEventCount := len(failedEventsHistory) + skippedEventCount
 
-				// check payload and see if its been successfully delivered, if so skip over it
-				if *event.StatusCode >= 200 && *event.StatusCode <= 299 {
-					continue
-				}
+	// work backwards from the list of failed events then attempt redelivery and
+	// advance the newCheckpoint in an effort to close the gap to the most
+	// recent event, this should alleviate pressure on future runs
+	redeliveredEventCount, redeliveredCheckpoint, err := s.redeliverFailedEvents(ctx, failedEventsHistory, summary)
+	if redeliveredCheckpoint != "" {
+		newCheckpoint = redeliveredCheckpoint
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to redeliver events, stop processing",
+			"code", http.StatusInternalServerError,
+			"method", "RedeliverEvent",
+			"error", err,
+			"total_event_count", totalEventCount,
+			"failed_event_count", failedEventCount,
+			"skipped_event_count", skippedEventCount,
+			"redelivered_event_count", redeliveredEventCount,
+			"repositories", summary.Repositories(),
+		)
 
-				failedEventsHistory = append(failedEventsHistory, &eventIdentifier{eventID: *event.ID, guid: *event.GUID})
-			}
+		if newCheckpoint != prevCheckpoint {
+			// a failure to write the checkpoint is logged, the failed
+			// redelivery is reported regardless
+			_ = s.writeMostRecentCheckpoint(ctx, inst, newCheckpoint, prevCheckpoint, now,
+				totalEventCount, failedEventCount, redeliveredEventCount)
 		}
 
-		failedEventCount := len(failedEventsHistory)
-
-		// work backwards from the list of failed events then attempt redelivery and
-		// increment the newCheckpoint in an effort to close the gap to the most
-		// recent event, this should alleviate pressure on future runs
-		for i := failedEventCount - 1; failedEventCount > 0 && i >= 0; i-- {
-			eventIdentifier := failedEventsHistory[i]
-
-			if err := s.github.RedeliverEvent(ctx, eventIdentifier.eventID); err != nil {
-				var acceptedErr *github.AcceptedError
-				if !errors.As(err, &acceptedErr) {
-					// found an unaccepted error, check if its already in the events table
-					exists, err := s.datastore.DeliveryEventExists(ctx, s.eventsTableID, eventIdentifier.guid)
-					if err != nil {
-						logger.ErrorContext(ctx, "failed to call BigQuery",
-							"method", "DeliveryEventExists",
-							"code", http.StatusInternalServerError,
-							"body", errDeliveryEventExists,
-							"error", err,
-						)
-
-						if newCheckpoint != prevCheckpoint {
-							s.writeMostRecentCheckpoint(ctx, w, newCheckpoint, prevCheckpoint, now,
-								totalEventCount, failedEventCount, redeliveredEventCount)
-						}
-
-						http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-						return
-					}
-					if !exists {
-						logger.ErrorContext(ctx, "failed to redeliver event, stop processing",
-							"code", http.StatusInternalServerError,
-							"body", errCallingGitHub,
-							"method", "RedeliverEvent",
-							"guid", eventIdentifier.guid,
-							"error", err,
-							"total_event_count", totalEventCount,
-							"failed_event_count", failedEventCount,
-						)
-
-						if newCheckpoint != prevCheckpoint {
-							s.writeMostRecentCheckpoint(ctx, w, newCheckpoint, prevCheckpoint, now,
-								totalEventCount, failedEventCount, redeliveredEventCount)
-						}
-
-						http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-						return
-					}
-				}
-			}
-
-			logger.InfoContext(ctx, "detected a failed event and successfully redelivered", "event_id", eventIdentifier.eventID)
-			redeliveredEventCount += 1
+		return &RetryResult{
+			Status:                "failed",
+			Outcome:               OutcomePartiallyProcessed,
+			TotalEventCount:       totalEventCount,
+			NewEventCount:         newEventCount,
+			FailedEventCount:      failedEventCount,
+			SkippedEventCount:     skippedEventCount,
+			RedeliveredEventCount: redeliveredEventCount,
+		}, err
+	}
 
-			newCheckpoint = strconv.FormatInt(eventIdentifier.eventID, 10)
-		}
+	result := &RetryResult{
+		Status:                "accepted",
+		Outcome:               OutcomeProcessed,
+		TotalEventCount:       totalEventCount,
+		NewEventCount:         newEventCount,
+		FailedEventCount:      failedEventCount,
+		SkippedEventCount:     skippedEventCount,
+		RedeliveredEventCount: redeliveredEventCount,
+	}
 
+	if newEventCount == 0 {
+		// either GitHub returned no deliveries at all or the checkpoint is
+		// already current, there is nothing to advance the checkpoint to
+		result.Outcome = OutcomeNoNewDeliveries
+	} else {
 		// advance the checkpoint to the first entry read on this run to avoid
 		// redundant processing
 		newCheckpoint = firstCheckpoint
 
-		s.writeMostRecentCheckpoint(ctx, w, newCheckpoint, prevCheckpoint, now,
-			totalEventCount, failedEventCount, redeliveredEventCount)
+		if err := s.writeMostRecentCheckpoint(ctx, inst, newCheckpoint, prevCheckpoint, now,
+			totalEventCount, failedEventCount, redeliveredEventCount); err != nil {
+			return nil, err
+		}
+	}
 
-		logger.InfoContext(ctx, "successful",
-			"code", http.StatusAccepted,
-			"total_event_count", totalEventCount,
-			"failed_event_count", failedEventCount,
-			"redelivered_event_count", redeliveredEventCount,
-		)
-		s.h.RenderJSON(w, http.StatusAccepted, statusAccepted)
+	// the walk completed and its failed events were redelivered
+	s.clearWalk(ctx, inst)
+	return result, nil
+}
+
+// resumeEvents converts the failed events observed by a walk over the
+// deliveries into the failed events of its resume state.
+func resumeEvents(events []*eventIdentifier) []*ResumeEvent {
+	resumeEvents := make([]*ResumeEvent, 0, len(events))
+	for _, event := range events {
+		resumeEvents = append(resumeEvents, &ResumeEvent{
+			EventID:      event.eventID,
+			GUID:         event.guid,
+			RepositoryID: event.repositoryID,
+		})
+	}
+	return resumeEvents
+}
+
+// redeliverFailedEvents attempts to redeliver the given failed events, which
+// are ordered from newest to oldest. Redeliveries are started oldest first, or
+// newest first if configured, on up to the configured number of concurrent
+// workers and no new redeliveries are started after the first failure.
+//
+// Redeliveries may complete out of order, so the returned checkpoint is the ID
+// of the newest event for which it and every older failed event were
+// redelivered. A failed event is never skipped over, even if newer events were
+// redelivered, and the checkpoint is empty if the oldest failed event was not
+// redelivered. The number of redelivered events is returned as well, and each
+// redelivered event is counted towards its repository in the summary.
+func (s *Server) redeliverFailedEvents(ctx context.Context, failedEvents []*eventIdentifier, summary *RetrySummary) (int, string, error) {
+	// redeliver sequentially unless configured otherwise, the pool would
+	// otherwise default to the number of CPUs
+	pool := workerpool.New[*eventIdentifier](&workerpool.Config{
+		Concurrency: int64(max(s.redeliverConcurrency, 1)),
+		StopOnError: true,
 	})
+
+	ordered := make([]*eventIdentifier, 0, len(failedEvents))
+	for i := len(failedEvents) - 1; i >= 0; i-- {
+		ordered = append(ordered, failedEvents[i])
+	}
+	if s.redeliverOrder == RedeliverOrderNewest {
+		slices.Reverse(ordered)
+	}
+
+	for _, event := range ordered {
+		if err := pool.Do(ctx, func() (*eventIdentifier, error) {
+			return event, s.redeliverEvent(ctx, event)
+		}); err != nil {
+			// the pool was stopped by a failed redelivery or the context is done
+			break
+		}
+	}
+
+	results, err := pool.Done(ctx)
+	if results == nil && err != nil {
+		return 0, "", fmt.Errorf("failed to wait for redeliveries: %w", err)
+	}
+
+	var redeliveredEventCount int
+	var firstErr error
+	redelivered := make(map[*eventIdentifier]bool, len(results))
+	for _, result := range results {
+		if result.Error != nil {
+			if firstErr == nil && !errors.Is(result.Error, workerpool.ErrStopped) {
+				firstErr = result.Error
+			}
+			continue
+		}
+
+		redeliveredEventCount += 1
+		redelivered[result.Value] = true
+		summary.addRedelivered(result.Value)
+	}
+	if firstErr == nil && len(results) < len(failedEvents) {
+		firstErr = fmt.Errorf("stopped after redelivering %d of %d failed events", len(results), len(failedEvents))
+	}
+
+	// advance the checkpoint from the oldest failed event up to the first one
+	// that was not redelivered, regardless of the order of the redeliveries
+	var checkpoint string
+	for i := len(failedEvents) - 1; i >= 0 && redelivered[failedEvents[i]]; i-- {
+		checkpoint = strconv.FormatInt(failedEvents[i].eventID, 10)
+	}
+
+	return redeliveredEventCount, checkpoint, firstErr
+}
+
+// redeliverEvent asks GitHub to redeliver a failed event. A redelivery that
+// GitHub rejects is considered successful if the event already made it into
+// the events table.
+func (s *Server) redeliverEvent(ctx context.Context, event *eventIdentifier) error {
+	logger := logging.FromContext(ctx)
+
+	if err := s.github.RedeliverEvent(ctx, event.eventID); err != nil {
+		var acceptedErr *github.AcceptedError
+		if !errors.As(err, &acceptedErr) {
+			// found an unaccepted error, check if its already in the events table
+			exists, existsErr := s.datastore.DeliveryEventExists(ctx, s.eventsTableID, event.guid)
+			if existsErr != nil {
+				logger.ErrorContext(ctx, "failed to call BigQuery",
+					"method", "DeliveryEventExists",
+					"code", http.StatusInternalServerError,
+					"body", errDeliveryEventExists,
+					"guid", event.guid,
+					"error", existsErr,
+				)
+				return fmt.Errorf("%w: %w", errDeliveryEventExists, existsErr)
+			}
+			if !exists {
+				logger.ErrorContext(ctx, "failed to redeliver event",
+					"code", http.StatusInternalServerError,
+					"body", errCallingGitHub,
+					"method", "RedeliverEvent",
+					"guid", event.guid,
+					"error", err,
+				)
+				return fmt.Errorf("%w: %w", errCallingGitHub, err)
+			}
+		}
+	}
+
+	logger.InfoContext(ctx, "detected a failed event and successfully redelivered", "event_id", event.eventID)
+	return nil
 }
 
 // writeMostRecentCheckpoint is a helper function to write to the checkpoint
-// table with the last successfully processed checkpoint denoted by
-// newCheckpoint.
-func (s *Server) writeMostRecentCheckpoint(ctx context.Context, w http.ResponseWriter,
+// table with the last successfully processed checkpoint of the installation
+// denoted by newCheckpoint.
+func (s *Server) writeMostRecentCheckpoint(ctx context.Context, inst *installation,
 	newCheckpoint, prevCheckpoint string, now time.Time, totalEventCount, failedEventCount, redeliveredEventCount int,
-) {
+) error {
+	// the execution that acquired the lock after this one owns the checkpoint
+	if err := lockLost(ctx); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "lost lock, not writing checkpoint",
+			"prev_checkpoint", prevCheckpoint,
+			"new_checkpoint", newCheckpoint)
+		return err
+	}
+
 	logging.FromContext(ctx).InfoContext(ctx, "write new checkpoint",
 		"prev_checkpoint", prevCheckpoint,
 		"new_checkpoint", newCheckpoint)
 	createdAt := now.Format(time.DateTime)
-	if err := s.datastore.WriteCheckpointID(ctx, s.checkpointTableID, newCheckpoint, createdAt); err != nil {
+	if err := s.datastore.WriteCheckpointID(ctx, s.checkpointTableID, inst.name, newCheckpoint, createdAt); err != nil {
 		logging.FromContext(ctx).ErrorContext(ctx, "failed to call WriteCheckpointID",
 			"code", http.StatusInternalServerError,
 			"body", errWriteCheckpoint,
@@ -261,7 +630,45 @@ func (s *Server) writeMostRecentCheckpoint(ctx context.Context, w http.ResponseW
 			"failed_event_count", failedEventCount,
 			"redelivered_event_count", redeliveredEventCount,
 		)
-		s.h.RenderJSON(w, http.StatusInternalServerError, errWriteCheckpoint)
+		return fmt.Errorf("%w: %w", errWriteCheckpoint, err)
+	}
+
+	s.pruneCheckpoints(ctx, inst)
+	return nil
+}
+
+// pruneCheckpoints deletes all but the configured number of latest
+// checkpoints of the installation. Failing to prune does not affect the retry
+// run, the checkpoints are pruned again on the next run.
+func (s *Server) pruneCheckpoints(ctx context.Context, inst *installation) {
+	if s.checkpointRetention <= 0 {
 		return
 	}
+
+	if err := s.datastore.PruneCheckpoints(ctx, s.checkpointTableID, inst.name, s.checkpointRetention); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to call PruneCheckpoints",
+			"method", "PruneCheckpoints",
+			"error", err,
+			"checkpoint_retention", s.checkpointRetention,
+		)
+	}
+}
+
+// pruneDeliveriesPageCache deletes the cached pages of deliveries that no
+// installation reached during the run, once the deliveries of every
+// installation were walked. Failing to prune does not affect the retry run,
+// the pages are pruned again on the next run.
+func (s *Server) pruneDeliveriesPageCache(ctx context.Context) {
+	if s.pageCache == nil {
+		return
+	}
+
+	deleted, err := s.pageCache.Prune(ctx)
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to call Prune",
+			"method", "Prune",
+			"error", err,
+			"deleted_page_count", deleted,
+		)
+	}
 }
@@ -17,16 +17,23 @@ package retry
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-github/v61/github"
 	"github.com/sethvargo/go-gcslock"
 
 	"github.com/abcxyz/pkg/renderer"
+	"github.com/abcxyz/pkg/testutil"
 )
 
 func TestHandleRetry(t *testing.T) {
@@ -39,7 +46,7 @@ func TestHandleRetry(t *testing.T) {
 		expStatusCode           int
 		expRespBody             string
 		datastoreClientOverride Datastore
-		gcsLockClientOverride   gcslock.Lockable
+		gcsLockClientOverride   Lock
 		githubOverride          GitHubSource
 	}{
 		{
@@ -129,9 +136,10 @@ func TestHandleRetry(t *testing.T) {
 		{
 			name:          "github_list_deliveries_empty",
 			expStatusCode: http.StatusAccepted,
-			expRespBody:   `{"status":"accepted"}`,
+			expRespBody:   `{"status":"accepted","outcome":"NO_NEW_DELIVERIES","total_event_count":0,"new_event_count":0,"failed_event_count":0,"skipped_event_count":0,"redelivered_event_count":0}`,
 			datastoreClientOverride: &MockDatastore{
 				retrieveCheckpointID: &retrieveCheckpointIDRes{res: "checkpoint-id"},
+				writeCheckpointID:    &writeCheckpointIDRes{err: errors.New("checkpoint should not be written")},
 			},
 			gcsLockClientOverride: &MockLock{
 				acquire: &acquireRes{},
@@ -143,10 +151,33 @@ func TestHandleRetry(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:          "checkpoint_already_current",
+			expStatusCode: http.StatusAccepted,
+			expRespBody:   `{"status":"accepted","outcome":"NO_NEW_DELIVERIES","total_event_count":1,"new_event_count":0,"failed_event_count":0,"skipped_event_count":0,"redelivered_event_count":0}`,
+			datastoreClientOverride: &MockDatastore{
+				retrieveCheckpointID: &retrieveCheckpointIDRes{res: "101"},
+				writeCheckpointID:    &writeCheckpointIDRes{err: errors.New("checkpoint should not be written")},
+			},
+			gcsLockClientOverride: &MockLock{
+				acquire: &acquireRes{},
+			},
+			githubOverride: &MockGitHub{
+				listDeliveries: &listDeliveriesRes{
+					deliveries: []*github.HookDelivery{
+						{
+							ID:         toPtr[int64](101),
+							StatusCode: toPtr(http.StatusOK),
+						},
+					},
+					res: &github.Response{},
+				},
+			},
+		},
 		{
 			name:          "github_redeliver_event_failure_big_query_entry_not_exists",
 			expStatusCode: http.StatusInternalServerError,
-			expRespBody:   http.StatusText(http.StatusInternalServerError),
+			expRespBody:   `{"status":"failed","outcome":"PARTIALLY_PROCESSED","total_event_count":1,"new_event_count":1,"failed_event_count":1,"skipped_event_count":0,"redelivered_event_count":0}`,
 			datastoreClientOverride: &MockDatastore{
 				retrieveCheckpointID: &retrieveCheckpointIDRes{res: "checkpoint-id"},
 				deliveryEventExists:  &deliveryEventExistsRes{err: errors.New("error")},
@@ -172,7 +203,7 @@ func TestHandleRetry(t *testing.T) {
 		{
 			name:          "github_redeliver_event_failure_big_query_entry_exists",
 			expStatusCode: http.StatusAccepted,
-			expRespBody:   `{"status":"accepted"}`,
+			expRespBody:   `{"status":"accepted","outcome":"PROCESSED","total_event_count":1,"new_event_count":1,"failed_event_count":1,"skipped_event_count":0,"redelivered_event_count":1}`,
 			datastoreClientOverride: &MockDatastore{
 				retrieveCheckpointID: &retrieveCheckpointIDRes{res: "checkpoint-id"},
 				deliveryEventExists:  &deliveryEventExistsRes{res: true},
@@ -198,7 +229,7 @@ func TestHandleRetry(t *testing.T) {
 		{
 			name:          "github_redeliver_event_failure",
 			expStatusCode: http.StatusInternalServerError,
-			expRespBody:   http.StatusText(http.StatusInternalServerError),
+			expRespBody:   `{"status":"failed","outcome":"PARTIALLY_PROCESSED","total_event_count":1,"new_event_count":1,"failed_event_count":1,"skipped_event_count":0,"redelivered_event_count":0}`,
 			datastoreClientOverride: &MockDatastore{
 				retrieveCheckpointID: &retrieveCheckpointIDRes{res: "checkpoint-id"},
 				deliveryEventExists:  &deliveryEventExistsRes{res: false},
@@ -224,7 +255,7 @@ func TestHandleRetry(t *testing.T) {
 		{
 			name:          "success",
 			expStatusCode: http.StatusAccepted,
-			expRespBody:   `{"status":"accepted"}`,
+			expRespBody:   `{"status":"accepted","outcome":"PROCESSED","total_event_count":1,"new_event_count":1,"failed_event_count":0,"skipped_event_count":0,"redelivered_event_count":0}`,
 			datastoreClientOverride: &MockDatastore{
 				retrieveCheckpointID: &retrieveCheckpointIDRes{res: "checkpoint-id"},
 			},
@@ -287,7 +318,918 @@ func TestHandleRetry(t *testing.T) {
 	}
 }
 
+func TestHandleRetry_ConcurrentRedelivery(t *testing.T) {
+	t.Parallel()
+
+	// deliveries are listed from newest to oldest, the failed events are 104,
+	// 103 and 102
+	deliveries := []*github.HookDelivery{
+		{ID: toPtr[int64](105), StatusCode: toPtr(http.StatusOK), GUID: toPtr("guid-105")},
+		{ID: toPtr[int64](104), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-104")},
+		{ID: toPtr[int64](103), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-103")},
+		{ID: toPtr[int64](102), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-102")},
+		{ID: toPtr[int64](101), StatusCode: toPtr(http.StatusOK), GUID: toPtr("guid-101")},
+	}
+
+	cases := []struct {
+		name            string
+		failedIDs       map[int64]bool
+		expStatusCode   int
+		expResult       *RetryResult
+		expCheckpointID []string
+	}{
+		{
+			name:          "all_redelivered",
+			expStatusCode: http.StatusAccepted,
+			expResult: &RetryResult{
+				Status:                "accepted",
+				Outcome:               OutcomeProcessed,
+				TotalEventCount:       5,
+				NewEventCount:         5,
+				FailedEventCount:      3,
+				RedeliveredEventCount: 3,
+			},
+			expCheckpointID: []string{"105"},
+		},
+		{
+			name:          "middle_failure_advances_to_oldest_contiguous",
+			failedIDs:     map[int64]bool{103: true},
+			expStatusCode: http.StatusInternalServerError,
+			expResult: &RetryResult{
+				Status:                "failed",
+				Outcome:               OutcomePartiallyProcessed,
+				TotalEventCount:       5,
+				NewEventCount:         5,
+				FailedEventCount:      3,
+				RedeliveredEventCount: 2,
+			},
+			expCheckpointID: []string{"102"},
+		},
+		{
+			name:          "oldest_failure_does_not_advance",
+			failedIDs:     map[int64]bool{102: true},
+			expStatusCode: http.StatusInternalServerError,
+			expResult: &RetryResult{
+				Status:                "failed",
+				Outcome:               OutcomePartiallyProcessed,
+				TotalEventCount:       5,
+				NewEventCount:         5,
+				FailedEventCount:      3,
+				RedeliveredEventCount: 2,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			h, err := renderer.New(ctx, nil, renderer.WithDebug(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// every redelivery waits until all of them started, so they all run
+			// concurrently and the newest completes first
+			var started sync.WaitGroup
+			started.Add(3)
+			datastore := &MockDatastore{
+				retrieveCheckpointID: &retrieveCheckpointIDRes{res: "100"},
+				deliveryEventExists:  &deliveryEventExistsRes{res: false},
+			}
+			srv, err := NewServer(ctx, h, &Config{RedeliverConcurrency: 3}, &RetryClientOptions{
+				DatastoreClientOverride: datastore,
+				GCSLockClientOverride:   &MockLock{acquire: &acquireRes{}},
+				GitHubOverride: &MockGitHub{
+					listDeliveries: &listDeliveriesRes{
+						deliveries: deliveries,
+						res:        &github.Response{},
+					},
+					redeliverEventFn: func(ctx context.Context, deliveryID int64) error {
+						started.Done()
+						started.Wait()
+						if deliveryID != 104 {
+							time.Sleep(10 * time.Millisecond)
+						}
+						if tc.failedIDs[deliveryID] {
+							return errors.New("error")
+						}
+						return nil
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/retry", nil)
+			resp := httptest.NewRecorder()
+			srv.handleRetry().ServeHTTP(resp, req)
+
+			if resp.Code != tc.expStatusCode {
+				t.Errorf("StatusCode got: %d want: %d", resp.Code, tc.expStatusCode)
+			}
+			var gotResult RetryResult
+			if err := json.Unmarshal(resp.Body.Bytes(), &gotResult); err != nil {
+				t.Fatalf("failed to unmarshal response body %q: %v", resp.Body.String(), err)
+			}
+			if diff := cmp.Diff(&gotResult, tc.expResult); diff != "" {
+				t.Errorf("result (-got,+want):\n%s", diff)
+			}
+			if diff := cmp.Diff(datastore.writtenCheckpointIDs, tc.expCheckpointID); diff != "" {
+				t.Errorf("written checkpoints (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleRetry_PruneCheckpoints(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cases := []struct {
+		name                string
+		checkpointRetention int
+		pruneErr            error
+		expPrunedTo         []int
+	}{
+		{
+			name:                "disabled",
+			checkpointRetention: 0,
+		},
+		{
+			name:                "pruned_after_checkpoint",
+			checkpointRetention: 5,
+			expPrunedTo:         []int{5},
+		},
+		{
+			name:                "prune_failure_does_not_fail_run",
+			checkpointRetention: 5,
+			pruneErr:            errors.New("error"),
+			expPrunedTo:         []int{5},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			h, err := renderer.New(ctx, nil, renderer.WithDebug(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			datastore := &MockDatastore{
+				retrieveCheckpointID: &retrieveCheckpointIDRes{res: "100"},
+				pruneCheckpoints:     &pruneCheckpointsRes{err: tc.pruneErr},
+			}
+			srv, err := NewServer(ctx, h, &Config{CheckpointRetention: tc.checkpointRetention}, &RetryClientOptions{
+				DatastoreClientOverride: datastore,
+				GCSLockClientOverride: &MockLock{
+					acquire: &acquireRes{},
+				},
+				GitHubOverride: &MockGitHub{
+					listDeliveries: &listDeliveriesRes{
+						deliveries: []*github.HookDelivery{
+							{
+								ID:         toPtr[int64](101),
+								StatusCode: toPtr(http.StatusOK),
+							},
+						},
+						res: &github.Response{},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/retry", nil)
+			resp := httptest.NewRecorder()
+			srv.handleRetry().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, http.StatusAccepted; got != want {
+				t.Errorf("StatusCode got: %d want: %d", got, want)
+			}
+
+			if diff := cmp.Diff(datastore.writtenCheckpointIDs, []string{"101"}); diff != "" {
+				t.Errorf("written checkpoints (-got,+want):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(datastore.prunedCheckpointsTo, tc.expPrunedTo); diff != "" {
+				t.Errorf("pruned checkpoints (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleRetry_MaxDeliveryAge(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	deliveredAt := func(age time.Duration) *github.Timestamp {
+		return &github.Timestamp{Time: now.Add(-age)}
+	}
+
+	// deliveries are listed from newest to oldest, all but 105 failed
+	deliveries := []*github.HookDelivery{
+		{ID: toPtr[int64](105), StatusCode: toPtr(http.StatusOK), GUID: toPtr("guid-105"), DeliveredAt: deliveredAt(time.Hour)},
+		{ID: toPtr[int64](104), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-104"), DeliveredAt: deliveredAt(2 * time.Hour)},
+		{ID: toPtr[int64](103), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-103"), DeliveredAt: deliveredAt(47 * time.Hour)},
+		{ID: toPtr[int64](102), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-102"), DeliveredAt: deliveredAt(49 * time.Hour)},
+		{ID: toPtr[int64](101), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-101"), DeliveredAt: deliveredAt(96 * time.Hour)},
+	}
+
+	cases := []struct {
+		name           string
+		maxDeliveryAge time.Duration
+		expRedelivered []int64
+		expRespBody    string
+	}{
+		{
+			name:           "disabled",
+			expRedelivered: []int64{101, 102, 103, 104},
+			expRespBody:    `{"status":"accepted","outcome":"PROCESSED","total_event_count":5,"new_event_count":5,"failed_event_count":4,"skipped_event_count":0,"redelivered_event_count":4}`,
+		},
+		{
+			name:           "skips_older_deliveries",
+			maxDeliveryAge: 48 * time.Hour,
+			expRedelivered: []int64{103, 104},
+			expRespBody:    `{"status":"accepted","outcome":"PROCESSED","total_event_count":5,"new_event_count":5,"failed_event_count":4,"skipped_event_count":2,"redelivered_event_count":2}`,
+		},
+		{
+			name:           "skips_all_deliveries",
+			maxDeliveryAge: time.Minute,
+			expRespBody:    `{"status":"accepted","outcome":"PROCESSED","total_event_count":5,"new_event_count":5,"failed_event_count":4,"skipped_event_count":4,"redelivered_event_count":0}`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			h, err := renderer.New(ctx, nil, renderer.WithDebug(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotRedelivered []int64
+			datastore := &MockDatastore{
+				retrieveCheckpointID: &retrieveCheckpointIDRes{res: "100"},
+			}
+			srv, err := NewServer(ctx, h, &Config{MaxDeliveryAge: tc.maxDeliveryAge}, &RetryClientOptions{
+				DatastoreClientOverride: datastore,
+				GCSLockClientOverride:   &MockLock{acquire: &acquireRes{}},
+				GitHubOverride: &MockGitHub{
+					listDeliveries: &listDeliveriesRes{
+						deliveries: deliveries,
+						res:        &github.Response{},
+					},
+					redeliverEventFn: func(ctx context.Context, deliveryID int64) error {
+						gotRedelivered = append(gotRedelivered, deliveryID)
+						return nil
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/retry", nil)
+			resp := httptest.NewRecorder()
+			srv.handleRetry().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, http.StatusAccepted; got != want {
+				t.Errorf("StatusCode got: %d want: %d", got, want)
+			}
+			if got := strings.TrimSpace(resp.Body.String()); got != tc.expRespBody {
+				t.Errorf("ResponseBody got: %s want: %s", got, tc.expRespBody)
+			}
+			if diff := cmp.Diff(gotRedelivered, tc.expRedelivered); diff != "" {
+				t.Errorf("redelivered events (-got,+want):\n%s", diff)
+			}
+			if diff := cmp.Diff(datastore.writtenCheckpointIDs, []string{"105"}); diff != "" {
+				t.Errorf("written checkpoints (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRedeliverFailedEvents(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name            string
+		concurrency     int
+		order           string
+		failedIDs       map[int64]bool
+		waitFor         map[int64][]int64
+		wantAttempted   []int64
+		wantOrder       []int64
+		wantRedelivered int
+		wantCheckpoint  string
+		wantErr         string
+	}{
+		{
+			name:            "sequential",
+			concurrency:     1,
+			wantAttempted:   []int64{1, 2, 3},
+			wantOrder:       []int64{1, 2, 3},
+			wantRedelivered: 3,
+			wantCheckpoint:  "3",
+		},
+		{
+			name:            "sequential_oldest_first",
+			concurrency:     1,
+			order:           RedeliverOrderOldest,
+			wantAttempted:   []int64{1, 2, 3},
+			wantOrder:       []int64{1, 2, 3},
+			wantRedelivered: 3,
+			wantCheckpoint:  "3",
+		},
+		{
+			name:            "sequential_newest_first",
+			concurrency:     1,
+			order:           RedeliverOrderNewest,
+			wantAttempted:   []int64{1, 2, 3},
+			wantOrder:       []int64{3, 2, 1},
+			wantRedelivered: 3,
+			wantCheckpoint:  "3",
+		},
+		{
+			// the older events are not redelivered, so the checkpoint can't
+			// advance past them
+			name:            "sequential_newest_first_stops_on_failure",
+			concurrency:     1,
+			order:           RedeliverOrderNewest,
+			failedIDs:       map[int64]bool{2: true},
+			wantAttempted:   []int64{2, 3},
+			wantOrder:       []int64{3, 2},
+			wantRedelivered: 1,
+			wantCheckpoint:  "",
+			wantErr:         errCallingGitHub.Error(),
+		},
+		{
+			name:        "newest_first_out_of_order_completion",
+			concurrency: 3,
+			order:       RedeliverOrderNewest,
+			waitFor: map[int64][]int64{
+				3: {1},
+			},
+			wantAttempted:   []int64{1, 2, 3},
+			wantRedelivered: 3,
+			wantCheckpoint:  "3",
+		},
+		{
+			name:            "sequential_stops_on_failure",
+			concurrency:     1,
+			failedIDs:       map[int64]bool{2: true},
+			wantAttempted:   []int64{1, 2},
+			wantRedelivered: 1,
+			wantCheckpoint:  "1",
+			wantErr:         errCallingGitHub.Error(),
+		},
+		{
+			name:        "out_of_order_completion",
+			concurrency: 3,
+			waitFor: map[int64][]int64{
+				1: {3},
+				3: {2},
+			},
+			wantAttempted:   []int64{1, 2, 3},
+			wantRedelivered: 3,
+			wantCheckpoint:  "3",
+		},
+		{
+			name:        "gap_does_not_advance_checkpoint_past_failure",
+			concurrency: 3,
+			failedIDs:   map[int64]bool{2: true},
+			waitFor: map[int64][]int64{
+				2: {1, 3},
+			},
+			wantAttempted:   []int64{1, 2, 3},
+			wantRedelivered: 2,
+			wantCheckpoint:  "1",
+			wantErr:         errCallingGitHub.Error(),
+		},
+		{
+			name:        "oldest_failure_completes_last",
+			concurrency: 3,
+			failedIDs:   map[int64]bool{1: true},
+			waitFor: map[int64][]int64{
+				1: {2, 3},
+			},
+			wantAttempted:   []int64{1, 2, 3},
+			wantRedelivered: 2,
+			wantCheckpoint:  "",
+			wantErr:         errCallingGitHub.Error(),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			t.Cleanup(cancel)
+
+			// failed events are ordered from newest to oldest
+			failedEvents := []*eventIdentifier{
+				{eventID: 3, guid: "guid-3"},
+				{eventID: 2, guid: "guid-2"},
+				{eventID: 1, guid: "guid-1"},
+			}
+			done := make(map[int64]chan struct{}, len(failedEvents))
+			for _, event := range failedEvents {
+				done[event.eventID] = make(chan struct{})
+			}
+
+			var mu sync.Mutex
+			var gotAttempted []int64
+			srv := &Server{
+				datastore: &MockDatastore{
+					deliveryEventExists: &deliveryEventExistsRes{res: false},
+				},
+				github: &MockGitHub{
+					redeliverEventFn: func(ctx context.Context, deliveryID int64) error {
+						mu.Lock()
+						gotAttempted = append(gotAttempted, deliveryID)
+						mu.Unlock()
+
+						defer close(done[deliveryID])
+						for _, id := range tc.waitFor[deliveryID] {
+							select {
+							case <-done[id]:
+							case <-ctx.Done():
+								return fmt.Errorf("timed out waiting for event %d: %w", id, ctx.Err())
+							}
+						}
+						if tc.failedIDs[deliveryID] {
+							return errors.New("error")
+						}
+						return nil
+					},
+				},
+				redeliverConcurrency: tc.concurrency,
+				redeliverOrder:       tc.order,
+			}
+
+			gotRedelivered, gotCheckpoint, err := srv.redeliverFailedEvents(ctx, failedEvents, newRetrySummary())
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if gotRedelivered != tc.wantRedelivered {
+				t.Errorf("redelivered event count got: %d want: %d", gotRedelivered, tc.wantRedelivered)
+			}
+			if gotCheckpoint != tc.wantCheckpoint {
+				t.Errorf("checkpoint got: %q want: %q", gotCheckpoint, tc.wantCheckpoint)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if tc.wantOrder != nil {
+				if diff := cmp.Diff(gotAttempted, tc.wantOrder); diff != "" {
+					t.Errorf("order of redeliveries (-got,+want):\n%s", diff)
+				}
+			}
+			sort.Slice(gotAttempted, func(i, j int) bool { return gotAttempted[i] < gotAttempted[j] })
+			if diff := cmp.Diff(gotAttempted, tc.wantAttempted); diff != "" {
+				t.Errorf("attempted redeliveries (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
 // toPtr is a helper function to convert a type to a pointer of that same type.
 func toPtr[T any](i T) *T {
 	return &i
 }
+
+func TestHandleRetry_LockRenewal(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		lockRenewalRatio float64
+		wantRenewed      bool
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:             "renewed_during_long_run",
+			lockRenewalRatio: 0.1,
+			wantRenewed:      true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			h, err := renderer.New(ctx, nil, renderer.WithDebug(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the redelivery takes several renewal intervals
+			lock := &MockLock{acquire: &acquireRes{}}
+			srv, err := NewServer(ctx, h, &Config{
+				LockTTL:          100 * time.Millisecond,
+				LockRenewalRatio: tc.lockRenewalRatio,
+			}, &RetryClientOptions{
+				DatastoreClientOverride: &MockDatastore{
+					retrieveCheckpointID: &retrieveCheckpointIDRes{res: "100"},
+				},
+				GCSLockClientOverride: lock,
+				GitHubOverride: &MockGitHub{
+					listDeliveries: &listDeliveriesRes{
+						deliveries: []*github.HookDelivery{
+							{ID: toPtr[int64](101), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-101")},
+						},
+						res: &github.Response{},
+					},
+					redeliverEventFn: func(ctx context.Context, deliveryID int64) error {
+						time.Sleep(100 * time.Millisecond)
+						return nil
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/retry", nil)
+			resp := httptest.NewRecorder()
+			srv.handleRetry().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, http.StatusAccepted; got != want {
+				t.Errorf("StatusCode got: %d want: %d", got, want)
+			}
+
+			renewCount := lock.renewCount.Load()
+			if got := renewCount > 0; got != tc.wantRenewed {
+				t.Errorf("expected lock to be renewed: %t, renewed %d times", tc.wantRenewed, renewCount)
+			}
+
+			// the renewal stops with the run
+			time.Sleep(50 * time.Millisecond)
+			if got := lock.renewCount.Load(); got != renewCount {
+				t.Errorf("lock renewed %d times after the run completed", got-renewCount)
+			}
+		})
+	}
+}
+
+func TestHandleRetry_Installations(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	h, err := renderer.New(ctx, nil, renderer.WithDebug(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// deliveries of both installations are listed together, from newest to
+	// oldest
+	datastore := &MockDatastore{
+		checkpointIDsByInstallation: map[string]string{
+			"org-a": "101",
+			"org-b": "102",
+		},
+	}
+	var redelivered []int64
+	srv, err := NewServer(ctx, h, &Config{
+		GitHubInstallations: map[string]string{
+			"org-b": "2",
+			"org-a": "1",
+		},
+	}, &RetryClientOptions{
+		DatastoreClientOverride: datastore,
+		GCSLockClientOverride: &MockLock{
+			acquire: &acquireRes{},
+		},
+		GitHubOverride: &MockGitHub{
+			listDeliveries: &listDeliveriesRes{
+				deliveries: []*github.HookDelivery{
+					{ID: toPtr[int64](106), InstallationID: toPtr[int64](2), StatusCode: toPtr(http.StatusOK), GUID: toPtr("guid-106")},
+					{ID: toPtr[int64](105), InstallationID: toPtr[int64](1), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-105")},
+					{ID: toPtr[int64](104), InstallationID: toPtr[int64](2), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-104")},
+					{ID: toPtr[int64](103), InstallationID: toPtr[int64](1), StatusCode: toPtr(http.StatusOK), GUID: toPtr("guid-103")},
+					{ID: toPtr[int64](102), InstallationID: toPtr[int64](2), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-102")},
+					{ID: toPtr[int64](101), InstallationID: toPtr[int64](1), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-101")},
+				},
+				res: &github.Response{},
+			},
+			redeliverEventFn: func(ctx context.Context, deliveryID int64) error {
+				redelivered = append(redelivered, deliveryID)
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create new server: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/retry", nil)
+	resp := httptest.NewRecorder()
+	srv.handleRetry().ServeHTTP(resp, req)
+
+	if got, want := resp.Code, http.StatusAccepted; got != want {
+		t.Errorf("StatusCode got: %d want: %d", got, want)
+	}
+
+	expRespBody := `{"status":"accepted","outcome":"PROCESSED","total_event_count":6,"new_event_count":4,"failed_event_count":2,"skipped_event_count":0,"redelivered_event_count":2}`
+	if got, want := strings.TrimSpace(resp.Body.String()), expRespBody; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// installations are retried in order of their name, each from its own
+	// checkpoint
+	if diff := cmp.Diff(datastore.retrievedInstallations, []string{"org-a", "org-b"}); diff != "" {
+		t.Errorf("retrieved checkpoints (-got,+want):\n%s", diff)
+	}
+	if diff := cmp.Diff(redelivered, []int64{105, 104}); diff != "" {
+		t.Errorf("redelivered events (-got,+want):\n%s", diff)
+	}
+	if diff := cmp.Diff(datastore.writtenCheckpointIDsByInstallation, map[string][]string{
+		"org-a": {"105"},
+		"org-b": {"106"},
+	}); diff != "" {
+		t.Errorf("written checkpoints (-got,+want):\n%s", diff)
+	}
+}
+
+// fakeResumeStore keeps the resume state of the installations in memory.
+type fakeResumeStore struct {
+	states map[string]*ResumeState
+}
+
+func (s *fakeResumeStore) Get(ctx context.Context, installation string) (*ResumeState, error) {
+	return s.states[installation], nil
+}
+
+func (s *fakeResumeStore) Put(ctx context.Context, installation string, state *ResumeState) error {
+	if s.states == nil {
+		s.states = make(map[string]*ResumeState)
+	}
+	s.states[installation] = state
+	return nil
+}
+
+func (s *fakeResumeStore) Delete(ctx context.Context, installation string) error {
+	delete(s.states, installation)
+	return nil
+}
+
+func (s *fakeResumeStore) Close() error {
+	return nil
+}
+
+func TestRun_ResumeCursor(t *testing.T) {
+	t.Parallel()
+
+	// four pages of deliveries from newest to oldest, down to the checkpoint
+	pages := map[string]*listDeliveriesRes{
+		"": {
+			deliveries: []*github.HookDelivery{
+				{ID: toPtr[int64](110), StatusCode: toPtr(http.StatusOK), GUID: toPtr("guid-110")},
+				{ID: toPtr[int64](109), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-109")},
+			},
+			res: &github.Response{Cursor: "c1"},
+		},
+		"c1": {
+			deliveries: []*github.HookDelivery{
+				{ID: toPtr[int64](108), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-108")},
+				{ID: toPtr[int64](107), StatusCode: toPtr(http.StatusOK), GUID: toPtr("guid-107")},
+			},
+			res: &github.Response{Cursor: "c2"},
+		},
+		"c2": {
+			deliveries: []*github.HookDelivery{
+				{ID: toPtr[int64](106), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-106")},
+				{ID: toPtr[int64](105), StatusCode: toPtr(http.StatusOK), GUID: toPtr("guid-105")},
+			},
+			res: &github.Response{Cursor: "c3"},
+		},
+		"c3": {
+			deliveries: []*github.HookDelivery{
+				{ID: toPtr[int64](104), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-104")},
+				{ID: toPtr[int64](103), StatusCode: toPtr(http.StatusOK), GUID: toPtr("guid-103")},
+			},
+			res: &github.Response{Cursor: "c4"},
+		},
+	}
+
+	// the first run is killed before listing the last page
+	interruptedPages := make(map[string]*listDeliveriesRes, len(pages))
+	for cursor, page := range pages {
+		if cursor != "c3" {
+			interruptedPages[cursor] = page
+		}
+	}
+
+	cases := []struct {
+		name              string
+		resumeCursorPages int
+		state             *ResumeState
+		wantPersisted     *ResumeState
+		wantListed        []string
+	}{
+		{
+			name:              "resumes_after_restart",
+			resumeCursorPages: 2,
+			wantPersisted: &ResumeState{
+				PrevCheckpoint:  "103",
+				FirstCheckpoint: "110",
+				Cursor:          "c2",
+				TotalEventCount: 4,
+				NewEventCount:   4,
+				FailedEvents: []*ResumeEvent{
+					{EventID: 109, GUID: "guid-109"},
+					{EventID: 108, GUID: "guid-108"},
+				},
+			},
+			wantListed: []string{"c2", "c3"},
+		},
+		{
+			name:              "ignores_state_of_another_checkpoint",
+			resumeCursorPages: 2,
+			state: &ResumeState{
+				PrevCheckpoint:  "99",
+				FirstCheckpoint: "102",
+				Cursor:          "c3",
+			},
+			wantListed: []string{"", "c1", "c2", "c3"},
+		},
+		{
+			name:       "disabled",
+			wantListed: []string{"", "c1", "c2", "c3"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			h, err := renderer.New(ctx, nil, renderer.WithDebug(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			datastore := &MockDatastore{
+				retrieveCheckpointID: &retrieveCheckpointIDRes{res: "103"},
+			}
+			var store *fakeResumeStore
+			if tc.resumeCursorPages > 0 {
+				store = &fakeResumeStore{}
+				if tc.state != nil {
+					store.states = map[string]*ResumeState{"": tc.state}
+				}
+			}
+
+			newServer := func(gh *MockGitHub) *Server {
+				rco := &RetryClientOptions{
+					DatastoreClientOverride: datastore,
+					GCSLockClientOverride:   &MockLock{acquire: &acquireRes{}},
+					GitHubOverride:          gh,
+				}
+				if store != nil {
+					rco.ResumeStoreOverride = store
+				}
+				srv, err := NewServer(ctx, h, &Config{ResumeCursorPages: tc.resumeCursorPages}, rco)
+				if err != nil {
+					t.Fatalf("failed to create new server: %v", err)
+				}
+				return srv
+			}
+
+			if tc.state == nil {
+				if _, _, err := newServer(&MockGitHub{pagesByCursor: interruptedPages}).Run(ctx); err == nil {
+					t.Fatal("expected the interrupted run to fail")
+				}
+				if len(datastore.writtenCheckpointIDs) > 0 {
+					t.Errorf("expected no checkpoint to be written by the interrupted run, got %q", datastore.writtenCheckpointIDs)
+				}
+				if store != nil {
+					if diff := cmp.Diff(store.states[""], tc.wantPersisted); diff != "" {
+						t.Errorf("persisted resume state (-got,+want):\n%s", diff)
+					}
+				}
+			}
+
+			// the restarted run
+			var redelivered []int64
+			gh := &MockGitHub{
+				pagesByCursor: pages,
+				redeliverEventFn: func(ctx context.Context, deliveryID int64) error {
+					redelivered = append(redelivered, deliveryID)
+					return nil
+				},
+			}
+			result, _, err := newServer(gh).Run(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(gh.listedCursors, tc.wantListed); diff != "" {
+				t.Errorf("listed cursors (-got,+want):\n%s", diff)
+			}
+			if diff := cmp.Diff(redelivered, []int64{104, 106, 108, 109}); diff != "" {
+				t.Errorf("redelivered events (-got,+want):\n%s", diff)
+			}
+			if diff := cmp.Diff(datastore.writtenCheckpointIDs, []string{"110"}); diff != "" {
+				t.Errorf("written checkpoints (-got,+want):\n%s", diff)
+			}
+			if got, want := result.NewEventCount, 7; got != want {
+				t.Errorf("expected %d new events, got %d", want, got)
+			}
+			if got, want := result.RedeliveredEventCount, 4; got != want {
+				t.Errorf("expected %d redelivered events, got %d", want, got)
+			}
+			if store != nil && len(store.states) > 0 {
+				t.Errorf("expected the resume state to be deleted after the run, got %v", store.states)
+			}
+		})
+	}
+}
+
+func TestHandleRetry_LockLost(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	h, err := renderer.New(ctx, nil, renderer.WithDebug(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lock is lost on the first renewal, during the redelivery
+	lock := &MockLock{acquire: &acquireRes{}, renew: &renewRes{err: errLockLost}}
+	datastore := &MockDatastore{
+		retrieveCheckpointID: &retrieveCheckpointIDRes{res: "100"},
+	}
+	srv, err := NewServer(ctx, h, &Config{
+		LockTTL:          100 * time.Millisecond,
+		LockRenewalRatio: 0.1,
+	}, &RetryClientOptions{
+		DatastoreClientOverride: datastore,
+		GCSLockClientOverride:   lock,
+		GitHubOverride: &MockGitHub{
+			listDeliveries: &listDeliveriesRes{
+				deliveries: []*github.HookDelivery{
+					{ID: toPtr[int64](101), StatusCode: toPtr(http.StatusInternalServerError), GUID: toPtr("guid-101")},
+				},
+				res: &github.Response{},
+			},
+			redeliverEventFn: func(ctx context.Context, deliveryID int64) error {
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create new server: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/retry", nil)
+	resp := httptest.NewRecorder()
+	srv.handleRetry().ServeHTTP(resp, req)
+
+	if got, want := resp.Code, http.StatusInternalServerError; got != want {
+		t.Errorf("StatusCode got: %d want: %d", got, want)
+	}
+	if got, want := strings.TrimSpace(resp.Body.String()), `{"errors":["retry lock was lost to another execution"]}`; got != want {
+		t.Errorf("expected body %s, got %s", want, got)
+	}
+	// the execution that acquired the lock owns the checkpoint
+	if got := datastore.writtenCheckpointIDs; len(got) != 0 {
+		t.Errorf("expected no checkpoint to be written, got %v", got)
+	}
+	// a lost lock is not renewed again
+	if got, want := lock.renewCount.Load(), int64(1); got != want {
+		t.Errorf("expected %d renewals, got %d", want, got)
+	}
+}
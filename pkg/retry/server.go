@@ -23,7 +23,6 @@ import (
 	"time"
 
 	"github.com/google/go-github/v61/github"
-	"github.com/sethvargo/go-gcslock"
 	"google.golang.org/api/option"
 
 	"github.com/abcxyz/github-metrics-aggregator/pkg/githubclient"
@@ -35,9 +34,11 @@ import (
 
 // Datastore adheres to the interaction the retry service has with a datastore.
 type Datastore interface {
-	RetrieveCheckpointID(ctx context.Context, checkpointTableID string) (string, error)
-	WriteCheckpointID(ctx context.Context, checkpointTableID, deliveryID, createdAt string) error
+	RetrieveCheckpointID(ctx context.Context, checkpointTableID, installation string) (string, error)
+	WriteCheckpointID(ctx context.Context, checkpointTableID, installation, deliveryID, createdAt string) error
+	PruneCheckpoints(ctx context.Context, checkpointTableID, installation string, keepN int) error
 	DeliveryEventExists(ctx context.Context, eventsTableID, deliveryID string) (bool, error)
+	CheckDataset(ctx context.Context) error
 	Close() error
 }
 
@@ -48,14 +49,23 @@ type GitHubSource interface {
 }
 
 type Server struct {
-	h                 *renderer.Renderer
-	datastore         Datastore
-	gcsLock           gcslock.Lockable
-	github            GitHubSource
-	lockTTL           time.Duration
-	checkpointTableID string
-	eventsTableID     string
-	projectID         string
+	h                    *renderer.Renderer
+	datastore            Datastore
+	gcsLock              Lock
+	github               GitHubSource
+	pageCache            *GCSDeliveriesPageCache
+	resumeStore          ResumeStore
+	resumeCursorPages    int
+	installations        []*installation
+	lockTTL              time.Duration
+	lockRenewalInterval  time.Duration
+	redeliverConcurrency int
+	redeliverOrder       string
+	checkpointTableID    string
+	checkpointRetention  int
+	maxDeliveryAge       time.Duration
+	eventsTableID        string
+	projectID            string
 }
 
 // RetryClientOptions encapsulate client config options as well as dependency
@@ -63,9 +73,10 @@ type Server struct {
 type RetryClientOptions struct {
 	BigQueryClientOpts      []option.ClientOption
 	GCSLockClientOpts       []option.ClientOption
-	DatastoreClientOverride Datastore        // used for unit testing
-	GCSLockClientOverride   gcslock.Lockable // used for unit testing
-	GitHubOverride          GitHubSource     // used for unit testing
+	DatastoreClientOverride Datastore    // used for unit testing
+	GCSLockClientOverride   Lock         // used for unit testing
+	GitHubOverride          GitHubSource // used for unit testing
+	ResumeStoreOverride     ResumeStore  // used for unit testing
 }
 
 // NewServer creates a new HTTP server implementation that will handle
@@ -73,7 +84,7 @@ type RetryClientOptions struct {
 func NewServer(ctx context.Context, h *renderer.Renderer, cfg *Config, rco *RetryClientOptions) (*Server, error) {
 	datastore := rco.DatastoreClientOverride
 	if datastore == nil {
-		bq, err := NewBigQuery(ctx, cfg.BigQueryProjectID, cfg.DatasetID, rco.BigQueryClientOpts...)
+		bq, err := NewBigQuery(ctx, cfg.BigQueryProjectID, cfg.DatasetID, cfg.bigQueryWriteRetry(), rco.BigQueryClientOpts...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize BigQuery client: %w", err)
 		}
@@ -82,7 +93,7 @@ func NewServer(ctx context.Context, h *renderer.Renderer, cfg *Config, rco *Retr
 
 	gcsLock := rco.GCSLockClientOverride
 	if gcsLock == nil {
-		lock, err := gcslock.New(ctx, cfg.BucketName, "retry-lock", rco.GCSLockClientOpts...)
+		lock, err := NewGCSLock(ctx, cfg.BucketName, rco.GCSLockClientOpts...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to obtain GCS lock: %w", err)
 		}
@@ -90,23 +101,51 @@ func NewServer(ctx context.Context, h *renderer.Renderer, cfg *Config, rco *Retr
 	}
 
 	github := rco.GitHubOverride
+	var pageCache *GCSDeliveriesPageCache
 	if github == nil {
-		gh, err := githubclient.New(ctx, cfg.GitHubAppID, cfg.GitHubPrivateKey)
+		var cache githubclient.DeliveriesPageCache
+		if cfg.ConditionalListDeliveries {
+			c, err := NewGCSDeliveriesPageCache(ctx, cfg.BucketName, rco.GCSLockClientOpts...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create deliveries page cache: %w", err)
+			}
+			pageCache, cache = c, c
+		}
+
+		gh, err := githubclient.New(ctx, cfg.GitHubAppID, cfg.GitHubPrivateKey, cache)
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize github client: %w", err)
 		}
 		github = gh
 	}
 
+	resumeStore := rco.ResumeStoreOverride
+	if resumeStore == nil && cfg.ResumeCursorPages > 0 {
+		store, err := NewGCSResumeStore(ctx, cfg.BucketName, rco.GCSLockClientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create resume store: %w", err)
+		}
+		resumeStore = store
+	}
+
 	return &Server{
-		h:                 h,
-		datastore:         datastore,
-		gcsLock:           gcsLock,
-		github:            github,
-		projectID:         cfg.ProjectID,
-		lockTTL:           cfg.LockTTL,
-		checkpointTableID: cfg.CheckpointTableID,
-		eventsTableID:     cfg.EventsTableID,
+		h:                    h,
+		datastore:            datastore,
+		gcsLock:              gcsLock,
+		github:               github,
+		pageCache:            pageCache,
+		resumeStore:          resumeStore,
+		resumeCursorPages:    cfg.ResumeCursorPages,
+		installations:        cfg.installations(),
+		projectID:            cfg.ProjectID,
+		lockTTL:              cfg.LockTTL,
+		lockRenewalInterval:  cfg.lockRenewalInterval(),
+		redeliverConcurrency: cfg.RedeliverConcurrency,
+		redeliverOrder:       cfg.RedeliverOrder,
+		checkpointTableID:    cfg.CheckpointTableID,
+		checkpointRetention:  cfg.CheckpointRetention,
+		maxDeliveryAge:       cfg.MaxDeliveryAge,
+		eventsTableID:        cfg.EventsTableID,
 	}, nil
 }
 
@@ -116,6 +155,7 @@ func (s *Server) Routes(ctx context.Context) http.Handler {
 	logger := logging.FromContext(ctx)
 	mux := http.NewServeMux()
 	mux.Handle("/healthz", healthcheck.HandleHTTPHealthCheck())
+	mux.Handle("/readyz", s.handleReadiness())
 	mux.Handle("/retry", s.handleRetry())
 	mux.Handle("/version", s.handleVersion())
 
@@ -145,5 +185,17 @@ func (s *Server) Close() error {
 		return fmt.Errorf("failed to close the GCS lock connection: %w", err)
 	}
 
+	if s.pageCache != nil {
+		if err := s.pageCache.Close(); err != nil {
+			return fmt.Errorf("failed to close the deliveries page cache: %w", err)
+		}
+	}
+
+	if s.resumeStore != nil {
+		if err := s.resumeStore.Close(); err != nil {
+			return fmt.Errorf("failed to close the resume store: %w", err)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,84 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"sort"
+
+	"github.com/google/go-github/v61/github"
+)
+
+// RepositorySummary counts the deliveries of a single repository that were
+// handled by a retry run.
+type RepositorySummary struct {
+	RepositoryID          int64 `json:"repository_id"`
+	NewEventCount         int   `json:"new_event_count"`
+	FailedEventCount      int   `json:"failed_event_count"`
+	RedeliveredEventCount int   `json:"redelivered_event_count"`
+}
+
+// RetrySummary accumulates the counts of a retry run per repository, so that
+// a failing repository or webhook configuration can be told apart from the
+// others. Deliveries of events that are not associated with a repository, such
+// as installation events, are counted under repository ID 0.
+type RetrySummary struct {
+	repositories map[int64]*RepositorySummary
+}
+
+// newRetrySummary creates an empty RetrySummary.
+func newRetrySummary() *RetrySummary {
+	return &RetrySummary{
+		repositories: make(map[int64]*RepositorySummary),
+	}
+}
+
+// repository returns the counts of the given repository, creating them if
+// needed.
+func (s *RetrySummary) repository(repositoryID int64) *RepositorySummary {
+	repo, ok := s.repositories[repositoryID]
+	if !ok {
+		repo = &RepositorySummary{RepositoryID: repositoryID}
+		s.repositories[repositoryID] = repo
+	}
+	return repo
+}
+
+// addNewDelivery counts a delivery newer than the last checkpoint, and whether
+// it failed.
+func (s *RetrySummary) addNewDelivery(delivery *github.HookDelivery, failed bool) {
+	repo := s.repository(delivery.GetRepositoryID())
+	repo.NewEventCount += 1
+	if failed {
+		repo.FailedEventCount += 1
+	}
+}
+
+// addRedelivered counts a failed event that was successfully redelivered.
+func (s *RetrySummary) addRedelivered(event *eventIdentifier) {
+	s.repository(event.repositoryID).RedeliveredEventCount += 1
+}
+
+// Repositories returns the counts of every repository with at least one new
+// delivery, ordered by repository ID.
+func (s *RetrySummary) Repositories() []*RepositorySummary {
+	repos := make([]*RepositorySummary, 0, len(s.repositories))
+	for _, repo := range s.repositories {
+		repos = append(repos, repo)
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].RepositoryID < repos[j].RepositoryID
+	})
+	return repos
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v61/github"
+)
+
+func TestRetrySummary(t *testing.T) {
+	t.Parallel()
+
+	// deliveries are listed from newest to oldest
+	deliveries := []*github.HookDelivery{
+		{ID: toPtr[int64](108), StatusCode: toPtr(http.StatusOK), RepositoryID: toPtr[int64](20)},
+		{ID: toPtr[int64](107), StatusCode: toPtr(http.StatusInternalServerError), RepositoryID: toPtr[int64](10)},
+		{ID: toPtr[int64](106), StatusCode: toPtr(http.StatusBadGateway), RepositoryID: toPtr[int64](20)},
+		{ID: toPtr[int64](105), StatusCode: toPtr(http.StatusInternalServerError)},
+		{ID: toPtr[int64](104), StatusCode: toPtr(http.StatusOK), RepositoryID: toPtr[int64](10)},
+		{ID: toPtr[int64](103), StatusCode: toPtr(http.StatusInternalServerError), RepositoryID: toPtr[int64](20)},
+		{ID: toPtr[int64](102), StatusCode: toPtr(http.StatusOK)},
+		{ID: toPtr[int64](101), StatusCode: toPtr(http.StatusInternalServerError), RepositoryID: toPtr[int64](10)},
+	}
+
+	cases := []struct {
+		name      string
+		failedIDs map[int64]bool
+		want      []*RepositorySummary
+	}{
+		{
+			name: "all_redelivered",
+			want: []*RepositorySummary{
+				{RepositoryID: 0, NewEventCount: 2, FailedEventCount: 1, RedeliveredEventCount: 1},
+				{RepositoryID: 10, NewEventCount: 3, FailedEventCount: 2, RedeliveredEventCount: 2},
+				{RepositoryID: 20, NewEventCount: 3, FailedEventCount: 2, RedeliveredEventCount: 2},
+			},
+		},
+		{
+			// redelivery is sequential and oldest first, so it stops at 105 and
+			// the newer failed events are never attempted
+			name:      "stopped_on_failure",
+			failedIDs: map[int64]bool{105: true},
+			want: []*RepositorySummary{
+				{RepositoryID: 0, NewEventCount: 2, FailedEventCount: 1, RedeliveredEventCount: 0},
+				{RepositoryID: 10, NewEventCount: 3, FailedEventCount: 2, RedeliveredEventCount: 1},
+				{RepositoryID: 20, NewEventCount: 3, FailedEventCount: 2, RedeliveredEventCount: 1},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			summary := newRetrySummary()
+			var failedEvents []*eventIdentifier
+			for _, delivery := range deliveries {
+				failed := delivery.GetStatusCode() >= 300
+				summary.addNewDelivery(delivery, failed)
+				if failed {
+					failedEvents = append(failedEvents, &eventIdentifier{
+						eventID:      delivery.GetID(),
+						repositoryID: delivery.GetRepositoryID(),
+					})
+				}
+			}
+
+			srv := &Server{
+				datastore: &MockDatastore{
+					deliveryEventExists: &deliveryEventExistsRes{res: false},
+				},
+				github: &MockGitHub{
+					redeliverEventFn: func(ctx context.Context, deliveryID int64) error {
+						if tc.failedIDs[deliveryID] {
+							return errors.New("error")
+						}
+						return nil
+					},
+				},
+			}
+
+			// the error is covered by TestRedeliverFailedEvents
+			_, _, _ = srv.redeliverFailedEvents(context.Background(), failedEvents, summary)
+
+			if diff := cmp.Diff(summary.Repositories(), tc.want); diff != "" {
+				t.Errorf("Repositories() (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
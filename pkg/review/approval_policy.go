@@ -0,0 +1,136 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// approvalPolicy is the set of review requirements a commit's pull request
+// must satisfy to be considered approved.
+type approvalPolicy struct {
+	requiredApprovals        int
+	requireCodeOwnerApproval bool
+
+	// requiredDistinctTeams is the number of distinct teams the approving
+	// reviewers must be members of. If zero, team membership is not checked.
+	requiredDistinctTeams int
+
+	// approveMergedWithoutReviews treats a merged pull request without any
+	// recorded reviews as approved by the branch protection at merge time.
+	approveMergedWithoutReviews bool
+
+	// excludedBots matches the logins of bot reviewers whose approvals are not
+	// counted towards the required approvals. If nil, no reviewers are
+	// excluded.
+	excludedBots *regexp.Regexp
+}
+
+// isExcludedBot reports whether the given reviewer login belongs to a bot
+// whose approvals are excluded by the policy.
+func (p *approvalPolicy) isExcludedBot(login string) bool {
+	return p.excludedBots != nil && p.excludedBots.MatchString(login)
+}
+
+// approvalPolicyFor resolves the approval policy for the given repository.
+// Per-repository overrides take precedence over the global defaults.
+func (cfg *Config) approvalPolicyFor(repository string) (*approvalPolicy, error) {
+	policy := &approvalPolicy{
+		requiredApprovals:        cfg.RequiredApprovals,
+		requireCodeOwnerApproval: cfg.RequireCodeOwnerApproval,
+		requiredDistinctTeams:    cfg.RequiredDistinctTeams,
+
+		approveMergedWithoutReviews: cfg.ApproveMergedWithoutReviews,
+	}
+
+	if v, ok := matchRepositoryOverride(cfg.RepoRequiredApprovals, repository); ok {
+		requiredApprovals, err := parseRequiredApprovals(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid required approvals override for repository %q: %w", repository, err)
+		}
+		policy.requiredApprovals = requiredApprovals
+	}
+
+	if v, ok := matchRepositoryOverride(cfg.RepoRequireCodeOwnerApproval, repository); ok {
+		requireCodeOwnerApproval, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid code owner approval override for repository %q: %w", repository, err)
+		}
+		policy.requireCodeOwnerApproval = requireCodeOwnerApproval
+	}
+
+	if cfg.ExcludeBotReviewers {
+		excludedBots, err := regexp.Compile(cfg.BotReviewerPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bot reviewer pattern: %w", err)
+		}
+		policy.excludedBots = excludedBots
+	}
+
+	return policy, nil
+}
+
+// matchRepositoryOverride returns the override value for the given repository.
+// The overrides are keyed by either a repository name or a glob pattern as
+// understood by [path.Match]. An exact match on the repository name takes
+// precedence, otherwise the first matching pattern in lexical order is used.
+func matchRepositoryOverride(overrides map[string]string, repository string) (string, bool) {
+	if v, ok := overrides[repository]; ok {
+		return v, true
+	}
+
+	patterns := make([]string, 0, len(overrides))
+	for pattern := range overrides {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, repository); ok {
+			return overrides[pattern], true
+		}
+	}
+	return "", false
+}
+
+// validateRepositoryOverrides validates that every key of the overrides is a
+// valid repository pattern and every value is accepted by parse.
+func validateRepositoryOverrides(overrides map[string]string, parse func(string) error) error {
+	for pattern, v := range overrides {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid repository pattern %q: %w", pattern, err)
+		}
+		if err := parse(v); err != nil {
+			return fmt.Errorf("invalid value for repository pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// parseRequiredApprovals parses a non-negative number of required approvals.
+func parseRequiredApprovals(v string) (int, error) {
+	requiredApprovals, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse required approvals: %w", err)
+	}
+	if requiredApprovals < 0 {
+		return 0, fmt.Errorf("required approvals must be non-negative, got %d", requiredApprovals)
+	}
+	return requiredApprovals, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestConfig_ApprovalPolicyFor(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{
+		RequiredApprovals:        1,
+		RequireCodeOwnerApproval: false,
+		RepoRequiredApprovals: map[string]string{
+			"critical-repo": "2",
+			"sandbox-*":     "0",
+			"*-infra":       "3",
+			"bad-repo":      "many",
+		},
+		RepoRequireCodeOwnerApproval: map[string]string{
+			"critical-repo": "true",
+		},
+	}
+
+	cases := []struct {
+		name       string
+		repository string
+		want       *approvalPolicy
+		wantErr    string
+	}{
+		{
+			name:       "repository_without_override",
+			repository: "some-repo",
+			want: &approvalPolicy{
+				requiredApprovals:        1,
+				requireCodeOwnerApproval: false,
+			},
+		},
+		{
+			name:       "repository_with_exact_override",
+			repository: "critical-repo",
+			want: &approvalPolicy{
+				requiredApprovals:        2,
+				requireCodeOwnerApproval: true,
+			},
+		},
+		{
+			name:       "repository_with_pattern_override",
+			repository: "sandbox-experiments",
+			want: &approvalPolicy{
+				requiredApprovals:        0,
+				requireCodeOwnerApproval: false,
+			},
+		},
+		{
+			name:       "first_pattern_in_lexical_order_wins",
+			repository: "sandbox-infra",
+			want: &approvalPolicy{
+				requiredApprovals:        3,
+				requireCodeOwnerApproval: false,
+			},
+		},
+		{
+			name:       "invalid_override",
+			repository: "bad-repo",
+			wantErr:    `invalid required approvals override for repository "bad-repo"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := cfg.approvalPolicyFor(tc.repository)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(got, tc.want, cmp.AllowUnexported(approvalPolicy{})); diff != "" {
+				t.Errorf("approvalPolicyFor(%q): unexpected result (-got,+want):\n%s", tc.repository, diff)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate_RepositoryOverrides(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name                         string
+		repoRequiredApprovals        map[string]string
+		repoRequireCodeOwnerApproval map[string]string
+		wantErr                      string
+	}{
+		{
+			name: "valid",
+			repoRequiredApprovals: map[string]string{
+				"my-repo": "2",
+				"infra-*": "0",
+			},
+			repoRequireCodeOwnerApproval: map[string]string{
+				"my-repo": "true",
+			},
+		},
+		{
+			name: "invalid_pattern",
+			repoRequiredApprovals: map[string]string{
+				"[": "2",
+			},
+			wantErr: `invalid REPO_REQUIRED_APPROVALS: invalid repository pattern "["`,
+		},
+		{
+			name: "negative_required_approvals",
+			repoRequiredApprovals: map[string]string{
+				"my-repo": "-1",
+			},
+			wantErr: "required approvals must be non-negative",
+		},
+		{
+			name: "invalid_code_owner_approval",
+			repoRequireCodeOwnerApproval: map[string]string{
+				"my-repo": "sometimes",
+			},
+			wantErr: `invalid REPO_REQUIRE_CODE_OWNER_APPROVAL: invalid value for repository pattern "my-repo"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := *defaultConfig
+			cfg.GitHubAppID = "test-github-app-id"
+			cfg.GitHubInstallID = "test-github-install-id"
+			cfg.GitHubPrivateKeySecret = "test-github-private-key-secret"
+			cfg.RepoRequiredApprovals = tc.repoRequiredApprovals
+			cfg.RepoRequireCodeOwnerApproval = tc.repoRequireCodeOwnerApproval
+
+			if diff := testutil.DiffErrString(cfg.Validate(), tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+
+	"github.com/abcxyz/pkg/cli"
+)
+
+// The modes the review statuses of a backfill can be written in.
+const (
+	BackfillOutputModeAppend   = "append"
+	BackfillOutputModeTruncate = "truncate"
+)
+
+// backfillOutputModes are all modes of writing the review statuses of a
+// backfill.
+var backfillOutputModes = []string{BackfillOutputModeAppend, BackfillOutputModeTruncate}
+
+// statusOutput is where and how the review statuses of a job are written.
+type statusOutput struct {
+	tableID     string
+	disposition bigquery.TableWriteDisposition
+
+	// summaryTableID is the table the pull request summaries are written to
+	// the same way, they are not written if empty.
+	summaryTableID string
+}
+
+// BackfillConfig defines the set of options required for reprocessing the
+// commits of a historical date range.
+type BackfillConfig struct {
+	Config
+
+	StartDate string // The first day of the backfill window (inclusive)
+	EndDate   string // The last day of the backfill window (inclusive)
+
+	OutputMode           string // How the review statuses are written, append or truncate
+	OutputTableID        string // The table replaced in truncate mode, must differ from the commit_review_status table
+	SummaryOutputTableID string // The pull request summary table replaced in truncate mode, must differ from the pull request summary table
+	ConfirmTruncate      bool   // Whether replacing the contents of the output tables was confirmed
+}
+
+// Validate validates the backfill config after load.
+func (cfg *BackfillConfig) Validate() error {
+	if err := cfg.Config.Validate(); err != nil {
+		return err
+	}
+
+	if _, _, err := cfg.window(); err != nil {
+		return err
+	}
+
+	switch cfg.OutputMode {
+	case "", BackfillOutputModeAppend:
+		if cfg.OutputTableID != "" {
+			return fmt.Errorf("OUTPUT_TABLE_ID is only used in %q output mode", BackfillOutputModeTruncate)
+		}
+		if cfg.SummaryOutputTableID != "" {
+			return fmt.Errorf("SUMMARY_OUTPUT_TABLE_ID is only used in %q output mode", BackfillOutputModeTruncate)
+		}
+	case BackfillOutputModeTruncate:
+		if cfg.OutputTableID == "" {
+			return fmt.Errorf("OUTPUT_TABLE_ID is required in %q output mode", BackfillOutputModeTruncate)
+		}
+		// truncating the table the review job appends to would drop the review
+		// statuses of all commits outside of the backfill window
+		if cfg.OutputTableID == cfg.CommitReviewStatusTableID {
+			return fmt.Errorf("OUTPUT_TABLE_ID must not be the COMMIT_REVIEW_STATUS_TABLE_ID %q", cfg.CommitReviewStatusTableID)
+		}
+		if cfg.PullRequestSummaryTableID != "" {
+			// likewise for the summaries of all pull requests outside of the
+			// backfill window
+			if cfg.SummaryOutputTableID == "" {
+				return fmt.Errorf("SUMMARY_OUTPUT_TABLE_ID is required in %q output mode when PULL_REQUEST_SUMMARY_TABLE_ID is set", BackfillOutputModeTruncate)
+			}
+			if cfg.SummaryOutputTableID == cfg.PullRequestSummaryTableID {
+				return fmt.Errorf("SUMMARY_OUTPUT_TABLE_ID must not be the PULL_REQUEST_SUMMARY_TABLE_ID %q", cfg.PullRequestSummaryTableID)
+			}
+			if cfg.SummaryOutputTableID == cfg.OutputTableID {
+				return fmt.Errorf("SUMMARY_OUTPUT_TABLE_ID must not be the OUTPUT_TABLE_ID %q", cfg.OutputTableID)
+			}
+		} else if cfg.SummaryOutputTableID != "" {
+			return fmt.Errorf("SUMMARY_OUTPUT_TABLE_ID is only used when PULL_REQUEST_SUMMARY_TABLE_ID is set")
+		}
+		if !cfg.ConfirmTruncate {
+			return fmt.Errorf("--confirm-truncate is required to replace the contents of %q", cfg.OutputTableID)
+		}
+	default:
+		return fmt.Errorf("OUTPUT_MODE must be one of %q, got %q", backfillOutputModes, cfg.OutputMode)
+	}
+
+	return nil
+}
+
+// statusOutput returns where and how the review statuses of the backfill are
+// written. They are appended to the commit_review_status table like those of
+// the review job, unless the backfill replaces the output table. The pull
+// request summaries are written alike.
+func (cfg *BackfillConfig) statusOutput() *statusOutput {
+	if cfg.OutputMode == BackfillOutputModeTruncate {
+		return &statusOutput{
+			tableID:        cfg.OutputTableID,
+			disposition:    bigquery.WriteTruncate,
+			summaryTableID: cfg.SummaryOutputTableID,
+		}
+	}
+	return &statusOutput{
+		tableID:        cfg.CommitReviewStatusTableID,
+		disposition:    bigquery.WriteAppend,
+		summaryTableID: cfg.PullRequestSummaryTableID,
+	}
+}
+
+// window parses the backfill dates and returns the half-open time range
+// [start, end) they cover.
+func (cfg *BackfillConfig) window() (time.Time, time.Time, error) {
+	if cfg.StartDate == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("START_DATE is required")
+	}
+	start, err := time.Parse(time.DateOnly, cfg.StartDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to parse START_DATE: %w", err)
+	}
+
+	if cfg.EndDate == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("END_DATE is required")
+	}
+	end, err := time.Parse(time.DateOnly, cfg.EndDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to parse END_DATE: %w", err)
+	}
+
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("END_DATE %s must not be before START_DATE %s", cfg.EndDate, cfg.StartDate)
+	}
+
+	// The end date is inclusive, so the window ends at the start of the next day.
+	return start, end.AddDate(0, 0, 1), nil
+}
+
+// ToFlags binds the config to the [cli.FlagSet] and returns it.
+func (cfg *BackfillConfig) ToFlags(set *cli.FlagSet) *cli.FlagSet {
+	set = cfg.Config.ToFlags(set)
+
+	f := set.NewSection("BACKFILL OPTIONS")
+
+	f.StringVar(&cli.StringVar{
+		Name:    "start",
+		Target:  &cfg.StartDate,
+		EnvVar:  "START_DATE",
+		Usage:   `The first day, in UTC, of the commits to reprocess.`,
+		Example: "2024-01-01",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "end",
+		Target:  &cfg.EndDate,
+		EnvVar:  "END_DATE",
+		Usage:   `The last day, in UTC, of the commits to reprocess. The day is included in the backfill.`,
+		Example: "2024-01-31",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "output-mode",
+		Target:  &cfg.OutputMode,
+		EnvVar:  "OUTPUT_MODE",
+		Default: BackfillOutputModeAppend,
+		Usage: `How the review statuses are written. "append" appends them to the ` +
+			`commit-review-status-table-id like the review job, "truncate" replaces the ` +
+			`contents of the output-table-id with them, e.g. for a clean backfill.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "output-table-id",
+		Target:  &cfg.OutputTableID,
+		EnvVar:  "OUTPUT_TABLE_ID",
+		Usage:   `The table replaced in "truncate" output mode, it must not be the commit-review-status-table-id.`,
+		Example: "commit_review_status_backfill",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "summary-output-table-id",
+		Target: &cfg.SummaryOutputTableID,
+		EnvVar: "SUMMARY_OUTPUT_TABLE_ID",
+		Usage: `The pull request summary table replaced in "truncate" output mode, required when the ` +
+			`pull-request-summary-table-id is set. It must not be the pull-request-summary-table-id.`,
+		Example: "pull_request_review_summary_backfill",
+	})
+
+	// the confirmation has no environment variable so that it is given
+	// explicitly for each backfill
+	f.BoolVar(&cli.BoolVar{
+		Name:   "confirm-truncate",
+		Target: &cfg.ConfirmTruncate,
+		Usage:  `Confirms replacing the contents of the output tables in "truncate" output mode.`,
+	})
+
+	return set
+}
+
+// ExecuteBackfillJob reruns the commit review logic for every commit in the
+// configured date range, including commits that were already processed.
+func ExecuteBackfillJob(ctx context.Context, cfg *BackfillConfig) error {
+	start, end, err := cfg.window()
+	if err != nil {
+		return fmt.Errorf("invalid backfill window: %w", err)
+	}
+
+	query, err := makeBackfillCommitQuery(&cfg.Config, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to create backfill commit query: %w", err)
+	}
+
+	return executeJob(ctx, &cfg.Config, query, cfg.statusOutput())
+}
@@ -0,0 +1,256 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestBackfillConfig_Window(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		startDate string
+		endDate   string
+		wantStart time.Time
+		wantEnd   time.Time
+		wantErr   string
+	}{
+		{
+			name:      "single_day",
+			startDate: "2024-01-01",
+			endDate:   "2024-01-01",
+			wantStart: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "end_date_is_inclusive",
+			startDate: "2024-01-01",
+			endDate:   "2024-01-31",
+			wantStart: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "missing_start_date",
+			endDate: "2024-01-31",
+			wantErr: "START_DATE is required",
+		},
+		{
+			name:      "missing_end_date",
+			startDate: "2024-01-01",
+			wantErr:   "END_DATE is required",
+		},
+		{
+			name:      "invalid_start_date",
+			startDate: "01/01/2024",
+			endDate:   "2024-01-31",
+			wantErr:   "failed to parse START_DATE",
+		},
+		{
+			name:      "end_before_start",
+			startDate: "2024-01-31",
+			endDate:   "2024-01-01",
+			wantErr:   "END_DATE 2024-01-01 must not be before START_DATE 2024-01-31",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &BackfillConfig{
+				StartDate: tc.startDate,
+				EndDate:   tc.endDate,
+			}
+			gotStart, gotEnd, err := cfg.window()
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(gotStart, tc.wantStart); diff != "" {
+				t.Errorf("window: unexpected start (-got,+want):\n%s", diff)
+			}
+			if diff := cmp.Diff(gotEnd, tc.wantEnd); diff != "" {
+				t.Errorf("window: unexpected end (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBackfillConfig_Output(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name                 string
+		outputMode           string
+		outputTableID        string
+		summaryTableID       string
+		summaryOutputTableID string
+		confirmTruncate      bool
+		wantOutput           *statusOutput
+		wantErr              string
+	}{
+		{
+			name:       "append_by_default",
+			wantOutput: &statusOutput{tableID: "commit_review_status", disposition: bigquery.WriteAppend},
+		},
+		{
+			name:       "append",
+			outputMode: BackfillOutputModeAppend,
+			wantOutput: &statusOutput{tableID: "commit_review_status", disposition: bigquery.WriteAppend},
+		},
+		{
+			name:            "truncate",
+			outputMode:      BackfillOutputModeTruncate,
+			outputTableID:   "commit_review_status_backfill",
+			confirmTruncate: true,
+			wantOutput:      &statusOutput{tableID: "commit_review_status_backfill", disposition: bigquery.WriteTruncate},
+		},
+		{
+			name:          "truncate_without_confirmation",
+			outputMode:    BackfillOutputModeTruncate,
+			outputTableID: "commit_review_status_backfill",
+			wantErr:       `--confirm-truncate is required to replace the contents of "commit_review_status_backfill"`,
+		},
+		{
+			name:            "truncate_without_output_table",
+			outputMode:      BackfillOutputModeTruncate,
+			confirmTruncate: true,
+			wantErr:         `OUTPUT_TABLE_ID is required in "truncate" output mode`,
+		},
+		{
+			name:            "truncate_commit_review_status_table",
+			outputMode:      BackfillOutputModeTruncate,
+			outputTableID:   "commit_review_status",
+			confirmTruncate: true,
+			wantErr:         `OUTPUT_TABLE_ID must not be the COMMIT_REVIEW_STATUS_TABLE_ID "commit_review_status"`,
+		},
+		{
+			name:          "append_with_output_table",
+			outputMode:    BackfillOutputModeAppend,
+			outputTableID: "commit_review_status_backfill",
+			wantErr:       `OUTPUT_TABLE_ID is only used in "truncate" output mode`,
+		},
+		{
+			name:           "append_summaries",
+			summaryTableID: "pull_request_review_summary",
+			wantOutput: &statusOutput{
+				tableID:        "commit_review_status",
+				disposition:    bigquery.WriteAppend,
+				summaryTableID: "pull_request_review_summary",
+			},
+		},
+		{
+			name:                 "truncate_summaries",
+			outputMode:           BackfillOutputModeTruncate,
+			outputTableID:        "commit_review_status_backfill",
+			summaryTableID:       "pull_request_review_summary",
+			summaryOutputTableID: "pull_request_review_summary_backfill",
+			confirmTruncate:      true,
+			wantOutput: &statusOutput{
+				tableID:        "commit_review_status_backfill",
+				disposition:    bigquery.WriteTruncate,
+				summaryTableID: "pull_request_review_summary_backfill",
+			},
+		},
+		{
+			name:            "truncate_without_summary_output_table",
+			outputMode:      BackfillOutputModeTruncate,
+			outputTableID:   "commit_review_status_backfill",
+			summaryTableID:  "pull_request_review_summary",
+			confirmTruncate: true,
+			wantErr:         `SUMMARY_OUTPUT_TABLE_ID is required in "truncate" output mode when PULL_REQUEST_SUMMARY_TABLE_ID is set`,
+		},
+		{
+			name:                 "truncate_pull_request_summary_table",
+			outputMode:           BackfillOutputModeTruncate,
+			outputTableID:        "commit_review_status_backfill",
+			summaryTableID:       "pull_request_review_summary",
+			summaryOutputTableID: "pull_request_review_summary",
+			confirmTruncate:      true,
+			wantErr:              `SUMMARY_OUTPUT_TABLE_ID must not be the PULL_REQUEST_SUMMARY_TABLE_ID "pull_request_review_summary"`,
+		},
+		{
+			name:                 "truncate_summaries_into_output_table",
+			outputMode:           BackfillOutputModeTruncate,
+			outputTableID:        "commit_review_status_backfill",
+			summaryTableID:       "pull_request_review_summary",
+			summaryOutputTableID: "commit_review_status_backfill",
+			confirmTruncate:      true,
+			wantErr:              `SUMMARY_OUTPUT_TABLE_ID must not be the OUTPUT_TABLE_ID "commit_review_status_backfill"`,
+		},
+		{
+			name:                 "truncate_summary_output_table_without_summaries",
+			outputMode:           BackfillOutputModeTruncate,
+			outputTableID:        "commit_review_status_backfill",
+			summaryOutputTableID: "pull_request_review_summary_backfill",
+			confirmTruncate:      true,
+			wantErr:              `SUMMARY_OUTPUT_TABLE_ID is only used when PULL_REQUEST_SUMMARY_TABLE_ID is set`,
+		},
+		{
+			name:                 "append_with_summary_output_table",
+			summaryTableID:       "pull_request_review_summary",
+			summaryOutputTableID: "pull_request_review_summary_backfill",
+			wantErr:              `SUMMARY_OUTPUT_TABLE_ID is only used in "truncate" output mode`,
+		},
+		{
+			name:       "invalid_output_mode",
+			outputMode: "replace",
+			wantErr:    `OUTPUT_MODE must be one of ["append" "truncate"], got "replace"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &BackfillConfig{
+				Config:               *defaultConfig,
+				StartDate:            "2024-01-01",
+				EndDate:              "2024-01-31",
+				OutputMode:           tc.outputMode,
+				OutputTableID:        tc.outputTableID,
+				SummaryOutputTableID: tc.summaryOutputTableID,
+				ConfirmTruncate:      tc.confirmTruncate,
+			}
+			cfg.PullRequestSummaryTableID = tc.summaryTableID
+			cfg.GitHubAppID = "test-github-app-id"
+			cfg.GitHubInstallID = "test-github-install-id"
+			cfg.GitHubPrivateKeySecret = "test-github-private-key-secret"
+
+			err := cfg.Validate()
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if err != nil {
+				return
+			}
+
+			if diff := cmp.Diff(cfg.statusOutput(), tc.wantOutput, cmp.AllowUnexported(statusOutput{})); diff != "" {
+				t.Errorf("statusOutput: unexpected output (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
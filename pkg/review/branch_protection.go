@@ -0,0 +1,134 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-github/v61/github"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// BranchProtection is a snapshot of the protection of the default branch of
+// a repository, recorded alongside the review status of a commit to tell
+// whether a review was even required when the commit was processed.
+type BranchProtection struct {
+	Branch                       string `bigquery:"branch"`
+	Protected                    bool   `bigquery:"protected"`
+	RequirePullRequestReviews    bool   `bigquery:"require_pull_request_reviews"`
+	RequiredApprovingReviewCount int    `bigquery:"required_approving_review_count"`
+	RequireCodeOwnerReviews      bool   `bigquery:"require_code_owner_reviews"`
+	DismissStaleReviews          bool   `bigquery:"dismiss_stale_reviews"`
+	EnforceAdmins                bool   `bigquery:"enforce_admins"`
+}
+
+// BranchProtectionResolver resolves the protection of the default branch of a
+// repository.
+type BranchProtectionResolver interface {
+	// DefaultBranchProtection returns the protection of the default branch of
+	// the given repository. An unprotected branch is not an error, its
+	// protection is returned with Protected set to false.
+	DefaultBranchProtection(ctx context.Context, org, repository string) (*BranchProtection, error)
+}
+
+// GitHubBranchProtectionResolver resolves branch protections using the GitHub
+// Repositories API. The protection of a repository is fetched the first time
+// it is looked up and cached for the lifetime of the resolver, which is
+// expected to be a single job execution.
+type GitHubBranchProtectionResolver struct {
+	client *github.Client
+
+	mu    sync.Mutex
+	cache map[string]*BranchProtection // org/repository -> protection
+}
+
+// NewGitHubBranchProtectionResolver creates a resolver that uses the given
+// GitHub REST client.
+func NewGitHubBranchProtectionResolver(client *github.Client) *GitHubBranchProtectionResolver {
+	return &GitHubBranchProtectionResolver{
+		client: client,
+		cache:  make(map[string]*BranchProtection),
+	}
+}
+
+// DefaultBranchProtection implements [BranchProtectionResolver].
+func (r *GitHubBranchProtectionResolver) DefaultBranchProtection(ctx context.Context, org, repository string) (*BranchProtection, error) {
+	// Holding the lock while loading a repository ensures its protection is only
+	// fetched once, even when many commits of the repository are processed
+	// concurrently.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := org + "/" + repository
+	protection, ok := r.cache[key]
+	if !ok {
+		var err error
+		protection, err = r.loadProtection(ctx, org, repository)
+		if err != nil {
+			return nil, err
+		}
+		r.cache[key] = protection
+	}
+	return protection, nil
+}
+
+// loadProtection fetches the default branch of the given repository and its
+// protection.
+func (r *GitHubBranchProtectionResolver) loadProtection(ctx context.Context, org, repository string) (*BranchProtection, error) {
+	repo, _, err := r.client.Repositories.Get(ctx, org, repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository %s/%s: %w", org, repository, err)
+	}
+
+	branch := repo.GetDefaultBranch()
+	protection, _, err := r.client.Repositories.GetBranchProtection(ctx, org, repository, branch)
+	if err != nil {
+		if errors.Is(err, github.ErrBranchNotProtected) {
+			return &BranchProtection{Branch: branch}, nil
+		}
+		return nil, fmt.Errorf("failed to get protection of branch %q of %s/%s: %w", branch, org, repository, err)
+	}
+
+	snapshot := &BranchProtection{
+		Branch:        branch,
+		Protected:     true,
+		EnforceAdmins: protection.GetEnforceAdmins().Enabled,
+	}
+	if reviews := protection.GetRequiredPullRequestReviews(); reviews != nil {
+		snapshot.RequirePullRequestReviews = true
+		snapshot.RequiredApprovingReviewCount = reviews.RequiredApprovingReviewCount
+		snapshot.RequireCodeOwnerReviews = reviews.RequireCodeOwnerReviews
+		snapshot.DismissStaleReviews = reviews.DismissStaleReviews
+	}
+	return snapshot, nil
+}
+
+// addBranchProtection records the protection of the default branch of the
+// commit's repository in its review status. Like the other lookups of a
+// commit, nil is returned if the protection can't be resolved so that the
+// commit is retried on the next pipeline execution.
+func addBranchProtection(ctx context.Context, resolver BranchProtectionResolver, commitReviewStatus *CommitReviewStatus) *CommitReviewStatus {
+	protection, err := resolver.DefaultBranchProtection(ctx, commitReviewStatus.Organization, commitReviewStatus.Repository)
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to get branch protection for commit", "error", err)
+		return nil
+	}
+	commitReviewStatus.BranchProtection = protection
+	return commitReviewStatus
+}
@@ -0,0 +1,220 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v61/github"
+)
+
+// fakeBranchProtectionResolver resolves branch protections from a static map
+// keyed by repository.
+type fakeBranchProtectionResolver struct {
+	protections map[string]*BranchProtection
+	err         error
+}
+
+func (f *fakeBranchProtectionResolver) DefaultBranchProtection(ctx context.Context, org, repository string) (*BranchProtection, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.protections[repository], nil
+}
+
+func TestGitHubBranchProtectionResolver_DefaultBranchProtection(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/test-org/protected-repo", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `{"default_branch": "main"}`)
+	})
+	mux.HandleFunc("GET /api/v3/repos/test-org/protected-repo/branches/main/protection", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `{
+			"required_pull_request_reviews": {
+				"dismiss_stale_reviews": true,
+				"require_code_owner_reviews": true,
+				"required_approving_review_count": 2
+			},
+			"enforce_admins": {"enabled": true}
+		}`)
+	})
+	mux.HandleFunc("GET /api/v3/repos/test-org/no-reviews-repo", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `{"default_branch": "trunk"}`)
+	})
+	mux.HandleFunc("GET /api/v3/repos/test-org/no-reviews-repo/branches/trunk/protection", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `{"enforce_admins": {"enabled": false}}`)
+	})
+	mux.HandleFunc("GET /api/v3/repos/test-org/unprotected-repo", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `{"default_branch": "main"}`)
+	})
+	mux.HandleFunc("GET /api/v3/repos/test-org/unprotected-repo/branches/main/protection", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Branch not protected"}`)
+	})
+	mux.HandleFunc("GET /api/v3/repos/test-org/forbidden-repo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch": "main"}`)
+	})
+	mux.HandleFunc("GET /api/v3/repos/test-org/forbidden-repo/branches/main/protection", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+	})
+	fakeGitHub := httptest.NewServer(mux)
+	t.Cleanup(fakeGitHub.Close)
+
+	client, err := github.NewClient(fakeGitHub.Client()).WithEnterpriseURLs(fakeGitHub.URL, fakeGitHub.URL)
+	if err != nil {
+		t.Fatalf("failed to create github client: %v", err)
+	}
+	resolver := NewGitHubBranchProtectionResolver(client)
+
+	ctx := context.Background()
+	cases := []struct {
+		repository string
+		want       *BranchProtection
+	}{
+		{
+			repository: "protected-repo",
+			want: &BranchProtection{
+				Branch:                       "main",
+				Protected:                    true,
+				RequirePullRequestReviews:    true,
+				RequiredApprovingReviewCount: 2,
+				RequireCodeOwnerReviews:      true,
+				DismissStaleReviews:          true,
+				EnforceAdmins:                true,
+			},
+		},
+		{
+			repository: "no-reviews-repo",
+			want: &BranchProtection{
+				Branch:    "trunk",
+				Protected: true,
+			},
+		},
+		{
+			repository: "unprotected-repo",
+			want: &BranchProtection{
+				Branch: "main",
+			},
+		},
+		// cached
+		{
+			repository: "protected-repo",
+			want: &BranchProtection{
+				Branch:                       "main",
+				Protected:                    true,
+				RequirePullRequestReviews:    true,
+				RequiredApprovingReviewCount: 2,
+				RequireCodeOwnerReviews:      true,
+				DismissStaleReviews:          true,
+				EnforceAdmins:                true,
+			},
+		},
+	}
+	for _, tc := range cases {
+		got, err := resolver.DefaultBranchProtection(ctx, "test-org", tc.repository)
+		if err != nil {
+			t.Fatalf("DefaultBranchProtection(%q) failed: %v", tc.repository, err)
+		}
+		if diff := cmp.Diff(got, tc.want); diff != "" {
+			t.Errorf("DefaultBranchProtection(%q): unexpected result (-got,+want):\n%s", tc.repository, diff)
+		}
+	}
+
+	// The protection of each repository is only fetched once.
+	if got, want := requests.Load(), int64(6); got != want {
+		t.Errorf("expected %d requests to github, got %d", want, got)
+	}
+
+	if _, err := resolver.DefaultBranchProtection(ctx, "test-org", "forbidden-repo"); err == nil {
+		t.Errorf("DefaultBranchProtection: expected error for inaccessible branch protection")
+	}
+}
+
+func TestAddBranchProtection(t *testing.T) {
+	t.Parallel()
+
+	protection := &BranchProtection{
+		Branch:                       "main",
+		Protected:                    true,
+		RequirePullRequestReviews:    true,
+		RequiredApprovingReviewCount: 1,
+	}
+
+	cases := []struct {
+		name     string
+		resolver BranchProtectionResolver
+		want     *CommitReviewStatus
+	}{
+		{
+			name: "with_protection",
+			resolver: &fakeBranchProtectionResolver{
+				protections: map[string]*BranchProtection{"test-repo": protection},
+			},
+			want: &CommitReviewStatus{
+				Commit:           &Commit{Organization: "test-org", Repository: "test-repo", SHA: "sha"},
+				ApprovalStatus:   DefaultApprovalStatus,
+				BranchProtection: protection,
+			},
+		},
+		{
+			name: "without_protection",
+			resolver: &fakeBranchProtectionResolver{
+				protections: map[string]*BranchProtection{"test-repo": {Branch: "main"}},
+			},
+			want: &CommitReviewStatus{
+				Commit:           &Commit{Organization: "test-org", Repository: "test-repo", SHA: "sha"},
+				ApprovalStatus:   DefaultApprovalStatus,
+				BranchProtection: &BranchProtection{Branch: "main"},
+			},
+		},
+		{
+			name:     "error_drops_commit",
+			resolver: &fakeBranchProtectionResolver{err: fmt.Errorf("boom")},
+			want:     nil,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			status := &CommitReviewStatus{
+				Commit:         &Commit{Organization: "test-org", Repository: "test-repo", SHA: "sha"},
+				ApprovalStatus: DefaultApprovalStatus,
+			}
+			got := addBranchProtection(context.Background(), tc.resolver, status)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("addBranchProtection: unexpected result (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -23,6 +23,9 @@ import (
 
 // breakGlassIssueSQL is the BigQuery query that searches for a
 // break glass issues created by given user and within a specified time frame.
+// The issue must have been open at some point between WindowStart and
+// WindowEnd. The results are ordered so that they can be read in pages of
+// Limit issues starting at Offset.
 const breakGlassIssueSQL = `
 SELECT
   issues.html_url html_url
@@ -31,8 +34,12 @@ FROM
 WHERE
   issues.repository = 'breakglass'
   AND author = '{{.Author}}'
-  AND issues.created_at <= TIMESTAMP('{{.Timestamp}}')
-  AND issues.closed_at >= TIMESTAMP('{{.Timestamp}}')
+  AND issues.created_at <= TIMESTAMP('{{.WindowEnd}}')
+  AND issues.closed_at >= TIMESTAMP('{{.WindowStart}}')
+ORDER BY
+  issues.created_at,
+  issues.html_url
+LIMIT {{.Limit}} OFFSET {{.Offset}}
 `
 
 type bgQueryParameters struct {
@@ -40,13 +47,18 @@ type bgQueryParameters struct {
 	DatasetID     string
 	IssuesTableID string
 	Author        string
-	Timestamp     string
+	WindowStart   string
+	WindowEnd     string
+	Limit         int
+	Offset        int
 	BT            string
 }
 
 // makeBreakglassQuery returns a BigQuery query that searches for a break glass
-// issue created by given user and within a specified time frame.
-func makeBreakglassQuery(cfg *Config, author string, timestamp *time.Time) (string, error) {
+// issue created by given user and within a specified time frame. The time
+// frame extends cfg.BreakGlassWindow before and after the timestamp. Only the
+// page of at most limit issues starting at offset is returned.
+func makeBreakglassQuery(cfg *Config, author string, timestamp *time.Time, limit, offset int) (string, error) {
 	tmpl, err := template.New("breakglass-query").Parse(breakGlassIssueSQL)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse query template: %w", err)
@@ -58,7 +70,10 @@ func makeBreakglassQuery(cfg *Config, author string, timestamp *time.Time) (stri
 		DatasetID:     cfg.DatasetID,
 		IssuesTableID: cfg.IssuesTableID,
 		Author:        author,
-		Timestamp:     timestamp.Format(time.RFC3339),
+		WindowStart:   timestamp.Add(-cfg.BreakGlassWindow).Format(time.RFC3339),
+		WindowEnd:     timestamp.Add(cfg.BreakGlassWindow).Format(time.RFC3339),
+		Limit:         limit,
+		Offset:        offset,
 		BT:            "`",
 	}); err != nil {
 		return "", fmt.Errorf("failed to apply query template parameters: %w", err)
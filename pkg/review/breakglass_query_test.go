@@ -23,11 +23,17 @@ import (
 
 func TestGetBreakGlassIssueQuery(t *testing.T) {
 	t.Parallel()
+
+	breakGlassWindowConfig := *defaultConfig
+	breakGlassWindowConfig.BreakGlassWindow = 2 * time.Hour
+
 	cases := []struct {
 		name      string
 		cfg       *Config
 		user      string
 		timestamp time.Time
+		limit     int
+		offset    int
 		want      string
 	}{
 		{
@@ -35,6 +41,7 @@ func TestGetBreakGlassIssueQuery(t *testing.T) {
 			cfg:       defaultConfig,
 			user:      "bbechtel",
 			timestamp: time.Date(2023, 8, 15, 23, 21, 34, 0, time.UTC),
+			limit:     100,
 			want: `
 SELECT
   issues.html_url html_url
@@ -45,6 +52,33 @@ WHERE
   AND author = 'bbechtel'
   AND issues.created_at <= TIMESTAMP('2023-08-15T23:21:34Z')
   AND issues.closed_at >= TIMESTAMP('2023-08-15T23:21:34Z')
+ORDER BY
+  issues.created_at,
+  issues.html_url
+LIMIT 100 OFFSET 0
+`,
+		},
+		{
+			name:      "query_window_applied",
+			cfg:       &breakGlassWindowConfig,
+			user:      "bbechtel",
+			timestamp: time.Date(2023, 8, 15, 23, 21, 34, 0, time.UTC),
+			limit:     100,
+			offset:    200,
+			want: `
+SELECT
+  issues.html_url html_url
+FROM
+  ` + "`my_project.my_dataset.issues`" + ` issues
+WHERE
+  issues.repository = 'breakglass'
+  AND author = 'bbechtel'
+  AND issues.created_at <= TIMESTAMP('2023-08-16T01:21:34Z')
+  AND issues.closed_at >= TIMESTAMP('2023-08-15T21:21:34Z')
+ORDER BY
+  issues.created_at,
+  issues.html_url
+LIMIT 100 OFFSET 200
 `,
 		},
 	}
@@ -54,7 +88,7 @@ WHERE
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
-			got, err := makeBreakglassQuery(tc.cfg, tc.user, &tc.timestamp)
+			got, err := makeBreakglassQuery(tc.cfg, tc.user, &tc.timestamp, tc.limit, tc.offset)
 			if err != nil {
 				t.Errorf("unexpected error making breakglass query: %v", err)
 			}
@@ -0,0 +1,293 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// CodeOwners is a parsed representation of a repository's CODEOWNERS file.
+// See: https://docs.github.com/en/repositories/managing-your-repositorys-settings-and-features/customizing-your-repository/about-code-owners
+type CodeOwners struct {
+	rules []*codeOwnersRule
+}
+
+// codeOwnersRule is a single non-comment line of a CODEOWNERS file.
+type codeOwnersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// ParseCodeOwners parses the contents of a CODEOWNERS file. Blank lines and
+// comments are ignored. Owners are normalized to lower case with any leading
+// '@' removed so they can be compared against GitHub logins.
+func ParseCodeOwners(content string) (*CodeOwners, error) {
+	var codeOwners CodeOwners
+	for i, line := range strings.Split(content, "\n") {
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		pattern, err := codeOwnersPatternToRegexp(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q on line %d: %w", fields[0], i+1, err)
+		}
+
+		owners := make([]string, 0, len(fields)-1)
+		for _, owner := range fields[1:] {
+			owners = append(owners, normalizeLogin(owner))
+		}
+		codeOwners.rules = append(codeOwners.rules, &codeOwnersRule{
+			pattern: pattern,
+			owners:  owners,
+		})
+	}
+	return &codeOwners, nil
+}
+
+// OwnersFor returns the owners of the given repository-relative path. As with
+// GitHub, the last matching rule in the file takes precedence. If no rule
+// matches, nil is returned.
+func (c *CodeOwners) OwnersFor(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if c.rules[i].pattern.MatchString(path) {
+			return c.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// codeOwnersPatternToRegexp converts a gitignore style pattern as used in
+// CODEOWNERS files into a regular expression matching repository-relative
+// paths.
+func codeOwnersPatternToRegexp(pattern string) (*regexp.Regexp, error) {
+	// A pattern containing a slash anywhere but the end is relative to the root
+	// of the repository, otherwise it matches at any depth.
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	// A trailing slash matches everything within the directory.
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+
+	var sb strings.Builder
+	if anchored {
+		sb.WriteString("^")
+	} else {
+		sb.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			sb.WriteString("[^/]*")
+		case pattern[i] == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		}
+	}
+	// A pattern matching a directory also matches everything beneath it.
+	sb.WriteString("(?:/.*)?$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile pattern: %w", err)
+	}
+	return re, nil
+}
+
+// normalizeLogin lower cases a GitHub login and strips any leading '@'.
+func normalizeLogin(login string) string {
+	return strings.ToLower(strings.TrimPrefix(login, "@"))
+}
+
+// codeOwnersBlob maps a git object that may be a blob.
+type codeOwnersBlob struct {
+	Blob struct {
+		Text githubv4.String
+	} `graphql:"... on Blob"`
+}
+
+// CodeOwnersGraphQlQuery is a struct that maps to the GitHub GraphQL query
+// that fetches the CODEOWNERS file from each of the locations GitHub supports
+// as of a given commit.
+type CodeOwnersGraphQlQuery struct {
+	Repository struct {
+		GitHubDir *codeOwnersBlob `graphql:"githubDir: object(expression: $githubDirExpression)"`
+		Root      *codeOwnersBlob `graphql:"root: object(expression: $rootExpression)"`
+		DocsDir   *codeOwnersBlob `graphql:"docsDir: object(expression: $docsDirExpression)"`
+	} `graphql:"repository(owner: $githubOrg, name: $repository)"`
+}
+
+// PullRequestFilesGraphQlQuery is a struct that maps to the GitHub GraphQL
+// query that fetches the paths of all files changed by a pull request.
+type PullRequestFilesGraphQlQuery struct {
+	Repository struct {
+		PullRequest struct {
+			Files struct {
+				Nodes []struct {
+					Path githubv4.String
+				}
+				PageInfo *PageInfo
+			} `graphql:"files(first: 100, after: $filesCursor)"`
+		} `graphql:"pullRequest(number: $pullRequestNumber)"`
+	} `graphql:"repository(owner: $githubOrg, name: $repository)"`
+}
+
+// GetCodeOwners retrieves and parses the CODEOWNERS file of a repository as of
+// the given commit. GitHub looks for the file in the .github/ directory, then
+// the repository root, then the docs/ directory and uses the first one found.
+// If the repository has no CODEOWNERS file then nil is returned.
+func GetCodeOwners(ctx context.Context, client *githubv4.Client, githubOrg, repository, commitSha string) (*CodeOwners, error) {
+	var query CodeOwnersGraphQlQuery
+	if err := client.Query(ctx, &query, map[string]any{
+		"githubOrg":           githubv4.String(githubOrg),
+		"repository":          githubv4.String(repository),
+		"githubDirExpression": githubv4.String(commitSha + ":.github/CODEOWNERS"),
+		"rootExpression":      githubv4.String(commitSha + ":CODEOWNERS"),
+		"docsDirExpression":   githubv4.String(commitSha + ":docs/CODEOWNERS"),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to call graphql: %w", err)
+	}
+
+	for _, blob := range []*codeOwnersBlob{
+		query.Repository.GitHubDir,
+		query.Repository.Root,
+		query.Repository.DocsDir,
+	} {
+		if blob == nil {
+			continue
+		}
+		codeOwners, err := ParseCodeOwners(string(blob.Blob.Text))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CODEOWNERS: %w", err)
+		}
+		return codeOwners, nil
+	}
+	return nil, nil
+}
+
+// GetPullRequestFiles retrieves the paths of all files changed by the given
+// pull request.
+func GetPullRequestFiles(ctx context.Context, client *githubv4.Client, githubOrg, repository string, pullRequestNumber int) ([]string, error) {
+	var paths []string
+	// The initial filesCursor must be nil and not the empty string "".
+	filesCursor := (*githubv4.String)(nil)
+	for {
+		var query PullRequestFilesGraphQlQuery
+		if err := client.Query(ctx, &query, map[string]any{
+			"githubOrg":         githubv4.String(githubOrg),
+			"repository":        githubv4.String(repository),
+			"pullRequestNumber": githubv4.Int(pullRequestNumber),
+			"filesCursor":       filesCursor,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to call graphql: %w", err)
+		}
+
+		files := query.Repository.PullRequest.Files
+		for _, node := range files.Nodes {
+			paths = append(paths, string(node.Path))
+		}
+		if files.PageInfo == nil || !files.PageInfo.HasNextPage {
+			break
+		}
+		filesCursor = &files.PageInfo.EndCursor
+	}
+	return paths, nil
+}
+
+// getCodeOwnerApprovers returns the logins of the approving reviewers of the
+// given pull request that are code owners of at least one of the files the
+// pull request changes. The returned boolean reports whether any of the
+// changed files have code owners at all. When it is false, the approval is not
+// subject to code owner review. Team owners (e.g. @org/team) of the commit's
+// organization are expanded to their members using the given resolver, teams
+// of other organizations never match.
+func getCodeOwnerApprovers(ctx context.Context, client *githubv4.Client, teams TeamMembershipResolver, commit *Commit, pullRequest *PullRequest) ([]string, bool, error) {
+	codeOwners, err := GetCodeOwners(ctx, client, commit.Organization, commit.Repository, commit.SHA)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get CODEOWNERS: %w", err)
+	}
+	if codeOwners == nil {
+		return nil, false, nil
+	}
+
+	paths, err := GetPullRequestFiles(ctx, client, commit.Organization, commit.Repository, int(pullRequest.Number))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get pull request files: %w", err)
+	}
+
+	owners := make(map[string]struct{})
+	teamOwners := make(map[string]struct{}) // team slugs of the commit's organization
+	for _, path := range paths {
+		for _, owner := range codeOwners.OwnersFor(path) {
+			owners[owner] = struct{}{}
+			if org, slug, ok := strings.Cut(owner, "/"); ok && org == normalizeLogin(commit.Organization) {
+				teamOwners[slug] = struct{}{}
+			}
+		}
+	}
+	if len(owners) == 0 {
+		return nil, false, nil
+	}
+
+	approvers := make(map[string]struct{})
+	for login, state := range latestReviewStates(pullRequest) {
+		if state != GithubPRApproved {
+			continue
+		}
+		if _, ok := owners[login]; ok {
+			approvers[login] = struct{}{}
+			continue
+		}
+		if len(teamOwners) == 0 || teams == nil {
+			continue
+		}
+		slugs, err := teams.TeamsForUser(ctx, commit.Organization, login)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get teams of %q: %w", login, err)
+		}
+		for _, slug := range slugs {
+			if _, ok := teamOwners[strings.ToLower(slug)]; ok {
+				approvers[login] = struct{}{}
+				break
+			}
+		}
+	}
+
+	result := make([]string, 0, len(approvers))
+	for login := range approvers {
+		result = append(result, login)
+	}
+	sort.Strings(result)
+	return result, true, nil
+}
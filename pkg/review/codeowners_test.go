@@ -0,0 +1,310 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shurcooL/githubv4"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+const testCodeOwners = `
+# Default owners for everything in the repo.
+*                @global-owner
+
+# Go files anywhere in the repo.
+*.go             @Go-Owner # trailing comment
+
+/docs/           @docs-owner
+apps/            @apps-owner
+/scripts/**/*.sh @script-owner
+/pkg/exact.txt   @exact-owner @other-owner
+`
+
+func TestCodeOwners_OwnersFor(t *testing.T) {
+	t.Parallel()
+
+	codeOwners, err := ParseCodeOwners(testCodeOwners)
+	if err != nil {
+		t.Fatalf("ParseCodeOwners failed: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{
+			name: "default_owner",
+			path: "README.md",
+			want: []string{"global-owner"},
+		},
+		{
+			name: "extension_matches_at_any_depth",
+			path: "pkg/review/job.go",
+			want: []string{"go-owner"},
+		},
+		{
+			name: "anchored_directory",
+			path: "docs/guide/index.md",
+			want: []string{"docs-owner"},
+		},
+		{
+			name: "anchored_directory_does_not_match_nested",
+			path: "pkg/docs/index.md",
+			want: []string{"global-owner"},
+		},
+		{
+			name: "unanchored_directory_matches_nested",
+			path: "src/apps/main.py",
+			want: []string{"apps-owner"},
+		},
+		{
+			name: "double_star",
+			path: "scripts/a/b/run.sh",
+			want: []string{"script-owner"},
+		},
+		{
+			name: "double_star_matches_zero_directories",
+			path: "scripts/run.sh",
+			want: []string{"script-owner"},
+		},
+		{
+			name: "multiple_owners",
+			path: "pkg/exact.txt",
+			want: []string{"exact-owner", "other-owner"},
+		},
+		{
+			name: "leading_slash_in_path",
+			path: "/pkg/exact.txt",
+			want: []string{"exact-owner", "other-owner"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := codeOwners.OwnersFor(tc.path)
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("OwnersFor(%q): unexpected result (-got,+want):\n%s", tc.path, diff)
+			}
+		})
+	}
+}
+
+func TestParseCodeOwners_NoRules(t *testing.T) {
+	t.Parallel()
+
+	codeOwners, err := ParseCodeOwners("# only a comment\n\n")
+	if err != nil {
+		t.Fatalf("ParseCodeOwners failed: %v", err)
+	}
+	if got := codeOwners.OwnersFor("main.go"); got != nil {
+		t.Errorf("OwnersFor: expected no owners, got %v", got)
+	}
+}
+
+func TestGetCodeOwnerApprovers(t *testing.T) {
+	t.Parallel()
+
+	codeOwnersResponse := `{
+      "data": {
+        "repository": {
+          "githubDir": null,
+          "root": {
+            "text": "* @owner-a\n/docs/ @owner-b\n"
+          },
+          "docsDir": null
+        }
+      }
+    }`
+	teamCodeOwnersResponse := `{
+      "data": {
+        "repository": {
+          "githubDir": {
+            "text": "* @Test-Org/Platform\n/docs/ @other-org/docs\n"
+          },
+          "root": null,
+          "docsDir": null
+        }
+      }
+    }`
+	noCodeOwnersResponse := `{
+      "data": {
+        "repository": {
+          "githubDir": null,
+          "root": null,
+          "docsDir": null
+        }
+      }
+    }`
+	filesResponse := `{
+      "data": {
+        "repository": {
+          "pullRequest": {
+            "files": {
+              "nodes": [
+                {"path": "main.go"},
+                {"path": "docs/index.md"}
+              ],
+              "pageInfo": {
+                "endCursor": "",
+                "hasNextPage": false
+              }
+            }
+          }
+        }
+      }
+    }`
+
+	commit := &Commit{
+		Organization: "test-org",
+		Repository:   "test-repository",
+		SHA:          "12345678",
+	}
+
+	cases := []struct {
+		name               string
+		codeOwnersResponse string
+		teams              TeamMembershipResolver
+		reviews            map[string]string
+		wantApprovers      []string
+		wantHasOwners      bool
+		wantErr            string
+	}{
+		{
+			name:               "approved_by_owners",
+			codeOwnersResponse: codeOwnersResponse,
+			reviews: map[string]string{
+				"Owner-A":  GithubPRApproved,
+				"owner-b":  GithubPRApproved,
+				"stranger": GithubPRApproved,
+			},
+			wantApprovers: []string{"owner-a", "owner-b"},
+			wantHasOwners: true,
+		},
+		{
+			name:               "approved_by_non_owner",
+			codeOwnersResponse: codeOwnersResponse,
+			reviews: map[string]string{
+				"owner-a":  GithubPRChangesRequested,
+				"stranger": GithubPRApproved,
+			},
+			wantApprovers: []string{},
+			wantHasOwners: true,
+		},
+		{
+			name:               "approved_by_team_owner",
+			codeOwnersResponse: teamCodeOwnersResponse,
+			teams: &fakeTeamMembershipResolver{teams: map[string][]string{
+				"platform-engineer": {"platform"},
+				"docs-writer":       {"docs"},
+			}},
+			reviews: map[string]string{
+				"platform-engineer": GithubPRApproved,
+				"docs-writer":       GithubPRApproved,
+				"stranger":          GithubPRApproved,
+			},
+			wantApprovers: []string{"platform-engineer"},
+			wantHasOwners: true,
+		},
+		{
+			name:               "approved_by_non_member_of_team_owner",
+			codeOwnersResponse: teamCodeOwnersResponse,
+			teams: &fakeTeamMembershipResolver{teams: map[string][]string{
+				"docs-writer": {"docs"},
+			}},
+			reviews: map[string]string{
+				"docs-writer": GithubPRApproved,
+			},
+			wantApprovers: []string{},
+			wantHasOwners: true,
+		},
+		{
+			name:               "team_members_unresolved",
+			codeOwnersResponse: teamCodeOwnersResponse,
+			teams:              &fakeTeamMembershipResolver{err: fmt.Errorf("boom")},
+			reviews: map[string]string{
+				"platform-engineer": GithubPRApproved,
+			},
+			wantErr: `failed to get teams of "platform-engineer": boom`,
+		},
+		{
+			name:               "no_codeowners_file",
+			codeOwnersResponse: noCodeOwnersResponse,
+			reviews: map[string]string{
+				"stranger": GithubPRApproved,
+			},
+			wantHasOwners: false,
+		},
+		{
+			name:               "invalid_response",
+			codeOwnersResponse: `{"errors": [{"message": "boom"}]}`,
+			wantErr:            "failed to get CODEOWNERS",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			fakeGitHub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					w.WriteHeader(500)
+					return
+				}
+				if strings.Contains(string(body), "CODEOWNERS") {
+					fmt.Fprint(w, tc.codeOwnersResponse)
+					return
+				}
+				fmt.Fprint(w, filesResponse)
+			}))
+			t.Cleanup(fakeGitHub.Close)
+
+			client := githubv4.NewEnterpriseClient(fakeGitHub.URL, fakeGitHub.Client())
+
+			pullRequest := &PullRequest{Number: 48}
+			for login, state := range tc.reviews {
+				pullRequest.Reviews.Nodes = append(pullRequest.Reviews.Nodes, newTestReview(login, state))
+			}
+
+			gotApprovers, gotHasOwners, err := getCodeOwnerApprovers(context.Background(), client, tc.teams, commit, pullRequest)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(gotApprovers, tc.wantApprovers); diff != "" {
+				t.Errorf("getCodeOwnerApprovers: unexpected approvers (-got,+want):\n%s", diff)
+			}
+			if gotHasOwners != tc.wantHasOwners {
+				t.Errorf("getCodeOwnerApprovers: expected hasOwners %t, got %t", tc.wantHasOwners, gotHasOwners)
+			}
+		})
+	}
+}
@@ -18,12 +18,17 @@ import (
 	"fmt"
 	"strings"
 	"text/template"
+	"time"
 )
 
 // commitSQL is the BigQuery query that selects the commits that need
 // to be processed. The criteria for a commit that needs to be processed are:
 // 1. The commit was pushed to the repository's default branch.
 // 2. We do not have a record for the commit in the commit_review_status table.
+//
+// When backfilling, the second criteria is replaced by the commit's timestamp
+// falling within the backfill window so that commits are reprocessed even if
+// they already have a record.
 const commitSQL = `
 WITH
   commits AS (
@@ -50,12 +55,18 @@ SELECT
   commits.commit_timestamp
 FROM
   commits
+{{- if .Backfill }}
+WHERE
+  commits.commit_timestamp >= TIMESTAMP('{{.StartTime}}')
+  AND commits.commit_timestamp < TIMESTAMP('{{.EndTime}}')
+{{- else }}
 LEFT JOIN
   {{.BT}}{{.ProjectID}}.{{.DatasetID}}.{{.CommitReviewStatusTableID}}{{.BT}} commit_review_status
 ON
   commit_review_status.commit_sha = commits.commit_sha
 WHERE
   commit_review_status.commit_sha IS NULL
+{{- end }}
 `
 
 type queryParameters struct {
@@ -64,24 +75,48 @@ type queryParameters struct {
 	PushEventsTableID         string
 	CommitReviewStatusTableID string
 	BT                        string
+
+	Backfill  bool
+	StartTime string
+	EndTime   string
 }
 
 // makeCommitQuery returns a BigQuery query that selects the commits that need to be
 // processed.
 func makeCommitQuery(cfg *Config) (string, error) {
-	tmpl, err := template.New("commit-query").Parse(commitSQL)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse query template: %w", err)
-	}
+	return executeCommitQueryTemplate(&queryParameters{
+		ProjectID:                 cfg.ProjectID,
+		DatasetID:                 cfg.DatasetID,
+		PushEventsTableID:         cfg.PushEventsTableID,
+		CommitReviewStatusTableID: cfg.CommitReviewStatusTableID,
+		BT:                        "`",
+	})
+}
 
-	var sb strings.Builder
-	if err := tmpl.Execute(&sb, &queryParameters{
+// makeBackfillCommitQuery returns a BigQuery query that selects all commits
+// with a timestamp in the range [start, end), regardless of whether they have
+// been processed before.
+func makeBackfillCommitQuery(cfg *Config, start, end time.Time) (string, error) {
+	return executeCommitQueryTemplate(&queryParameters{
 		ProjectID:                 cfg.ProjectID,
 		DatasetID:                 cfg.DatasetID,
 		PushEventsTableID:         cfg.PushEventsTableID,
 		CommitReviewStatusTableID: cfg.CommitReviewStatusTableID,
 		BT:                        "`",
-	}); err != nil {
+		Backfill:                  true,
+		StartTime:                 start.UTC().Format(time.RFC3339),
+		EndTime:                   end.UTC().Format(time.RFC3339),
+	})
+}
+
+func executeCommitQueryTemplate(params *queryParameters) (string, error) {
+	tmpl, err := template.New("commit-query").Parse(commitSQL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse query template: %w", err)
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, params); err != nil {
 		return "", fmt.Errorf("failed to apply query template parameters: %w", err)
 	}
 	return sb.String(), nil
@@ -16,6 +16,7 @@ package review
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -78,3 +79,66 @@ WHERE
 		})
 	}
 }
+
+func TestGetBackfillCommitQuery(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name  string
+		cfg   *Config
+		start time.Time
+		end   time.Time
+		want  string
+	}{
+		{
+			name:  "query_template_populated_with_date_filters",
+			cfg:   defaultConfig,
+			start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			want: `
+WITH
+  commits AS (
+  SELECT
+    push_events.pusher author,
+    push_events.organization,
+    push_events.repository,
+    push_events.repository_default_branch branch,
+    push_events.repository_visibility visibility,
+    JSON_VALUE(commit_json, '$.id') commit_sha,
+    TIMESTAMP(JSON_VALUE(commit_json, '$.timestamp')) commit_timestamp,
+  FROM
+    ` + "`my_project.my_dataset.push_events`" + ` push_events,
+    UNNEST(push_events.commits) commit_json
+  WHERE
+    push_events.ref = CONCAT('refs/heads/', push_events.repository_default_branch) )
+SELECT
+  commits.author,
+  commits.organization,
+  commits.repository,
+  commits.branch,
+  commits.visibility,
+  commits.commit_sha,
+  commits.commit_timestamp
+FROM
+  commits
+WHERE
+  commits.commit_timestamp >= TIMESTAMP('2024-01-01T00:00:00Z')
+  AND commits.commit_timestamp < TIMESTAMP('2024-02-01T00:00:00Z')
+`,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := makeBackfillCommitQuery(tc.cfg, tc.start, tc.end)
+			if err != nil {
+				t.Fatalf("makeBackfillCommitQuery failed: %v", err)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("makeBackfillCommitQuery got unexpected result (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -44,10 +46,49 @@ const (
 	// changes need to be made to the PR code.
 	GithubPRChangesRequested = "CHANGES_REQUESTED"
 
+	// GithubPRDismissed is the state of a review that was dismissed after it
+	// was submitted. A dismissed review no longer counts towards the approval
+	// of a PR.
+	GithubPRDismissed = "DISMISSED"
+
 	// DefaultApprovalStatus is the default approval status we assign to a commit.
 	DefaultApprovalStatus = "UNKNOWN"
+
+	// ApprovedByNonOwnerStatus is the approval status we assign to a commit
+	// whose pull request was approved, but only by reviewers that are not code
+	// owners of any of the changed files.
+	ApprovedByNonOwnerStatus = "APPROVED_BY_NON_OWNER"
+
+	// ApprovedByMergeStatus is the approval status we assign to a commit whose
+	// pull request was merged without any recorded reviews, when the approval
+	// policy trusts branch protection to have enforced the review at merge
+	// time.
+	ApprovedByMergeStatus = "APPROVED_BY_MERGE"
+
+	// ApprovedByTooFewTeamsStatus is the approval status we assign to a commit
+	// whose pull request has the required approvals, but the approving
+	// reviewers are not members of enough distinct teams.
+	ApprovedByTooFewTeamsStatus = "APPROVED_BY_TOO_FEW_TEAMS"
+
+	// AccessDeniedStatus is the approval status we assign to a commit whose
+	// repository the GitHub App is not allowed to access, e.g. a private
+	// repository the installation was not granted.
+	AccessDeniedStatus = "ACCESS_DENIED"
 )
 
+// ErrRateLimited is returned when GitHub rejected a GraphQL query because a
+// rate limit was exceeded. The query succeeds once the rate limit resets.
+var ErrRateLimited = errors.New("github graphql rate limit exceeded")
+
+// ErrAccessDenied is returned when GitHub rejected a GraphQL query because the
+// GitHub App is not allowed to access the repository. Unlike a rate limit, the
+// query fails until access is granted.
+var ErrAccessDenied = errors.New("github denied access to the repository")
+
+// ErrNoDefaultBranch is returned when the repository of a commit has no
+// default branch, e.g. because it is empty, so no pull request can target it.
+var ErrNoDefaultBranch = errors.New("repository has no default branch")
+
 // Commit maps the columns from the driving BigQuery query
 // to a usable structure.
 type Commit struct {
@@ -74,6 +115,26 @@ type CommitReviewStatus struct {
 	ApprovalStatus     string   `bigquery:"approval_status"`
 	BreakGlassURLs     []string `bigquery:"break_glass_issue_urls"`
 	Note               string   `bigquery:"note"`
+	CodeOwnerApprovers []string `bigquery:"code_owner_approvers"`
+	BotApproved        bool     `bigquery:"bot_approved"`
+	ApprovingTeams     []string `bigquery:"approving_teams"`
+
+	// BranchProtection is only recorded when enabled, and is null otherwise.
+	BranchProtection *BranchProtection `bigquery:"branch_protection,nullable"`
+
+	// ApprovingPullRequests is only recorded when enabled, and is empty
+	// otherwise.
+	ApprovingPullRequests []*ApprovingPullRequest `bigquery:"approving_pull_requests"`
+}
+
+// ApprovingPullRequest is an approved pull request targeting the default
+// branch that a commit is associated with. A commit may be associated with
+// several, e.g. when it was cherry-picked, of which the first is recorded in
+// the pull request columns of its review status.
+type ApprovingPullRequest struct {
+	ID      int64  `bigquery:"id"`
+	Number  int    `bigquery:"number"`
+	HTMLURL string `bigquery:"html_url"`
 }
 
 // breakGlassIssue is a struct that maps the columns of the result of
@@ -101,6 +162,19 @@ type CommitGraphQlQuery struct {
 	} `graphql:"repository(owner: $githubOrg, name: $repository)"`
 }
 
+// PullRequestReviewsGraphQlQuery is the GraphQL query of a page of the reviews
+// of a single pull request.
+type PullRequestReviewsGraphQlQuery struct {
+	Repository struct {
+		PullRequest struct {
+			Reviews struct {
+				Nodes    []*Review
+				PageInfo *PageInfo
+			} `graphql:"reviews(first: 100, after: $reviewCursor)"`
+		} `graphql:"pullRequest(number: $pullRequestNumber)"`
+	} `graphql:"repository(owner: $githubOrg, name: $repository)"`
+}
+
 // PullRequest represents a pull request in GitHub and contains the
 // GitHub assigned ID, the pull request number in the repository,
 // and the review decision for the pull request.
@@ -112,6 +186,7 @@ type PullRequest struct {
 	// into branch 'main', then BasRefName for this PR would be 'main'.
 	BaseRefName    githubv4.String
 	FullDatabaseID githubv4.String
+	Merged         githubv4.Boolean
 	Number         githubv4.Int
 	Reviews        struct {
 		Nodes    []*Review
@@ -124,6 +199,11 @@ type PullRequest struct {
 // For all potential fields see:
 // https://docs.github.com/en/graphql/reference/objects#pullrequestreview
 type Review struct {
+	Author struct {
+		Login githubv4.String
+	}
+	// State is one of APPROVED, CHANGES_REQUESTED, COMMENTED, DISMISSED or
+	// PENDING. When a review is dismissed GitHub updates its state to DISMISSED.
 	State githubv4.String
 }
 
@@ -142,29 +222,86 @@ type PageInfo struct {
 // CommitReviewStatus.
 // A commit is considered properly reviewed as long as there is an associated
 // PR for the commit targeting the repository's main branch with reviewDecision
-// of 'APPROVED'.
-func processCommit(ctx context.Context, gitHubClient *githubv4.Client, commit *Commit) *CommitReviewStatus {
+// of 'APPROVED'. The number of approvals required and whether at least one of
+// them must come from a code owner of the changed files is determined by the
+// approval policy configured for the commit's repository, as is the number of
+// distinct teams the approving reviewers must be members of. The teams are
+// resolved using the given resolver, which may be nil when the policy does not
+// require distinct teams. If the commit is sampled by the given sampler, which
+// may be nil, the raw GraphQL responses received for it are captured. If the
+// repository of the commit can't be found and renames is not nil, the commit
+// is looked up in the repository under its current name instead.
+func processCommit(ctx context.Context, gitHubClient *githubv4.Client, teams TeamMembershipResolver, renames RepositoryRenameResolver, sampler *RawResponseSampler, cfg *Config, commit *Commit) *CommitReviewStatus {
 	logger := logging.FromContext(ctx)
 	logger.InfoContext(ctx, "process commit", "commit", commit)
 
+	if sampler.Sampled(commit.SHA) {
+		recorder := &rawResponseRecorder{}
+		ctx = withRawResponseRecorder(ctx, recorder)
+		defer sampler.write(ctx, commit, recorder)
+	}
+
+	policy, err := cfg.approvalPolicyFor(commit.Repository)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to resolve approval policy for commit", "error", err)
+		return nil
+	}
+
 	commitReviewStatus := CommitReviewStatus{
 		Commit:         commit,
-		HTMLURL:        getCommitHTMLURL(commit),
+		HTMLURL:        getCommitHTMLURL(cfg.GitHubGraphQLURL, commit),
 		ApprovalStatus: DefaultApprovalStatus,
 		BreakGlassURLs: make([]string, 0),
 	}
+	// lookup is the commit in its repository under its current name, the
+	// review status keeps the name the commit was pushed to
+	lookup := commit
 	requests, err := GetPullRequestsTargetingDefaultBranch(ctx, gitHubClient, commit.Organization, commit.Repository, commit.SHA)
+	if err != nil && renames != nil && isRepositoryNotFound(err) {
+		org, repository, renameErr := renames.CurrentName(ctx, commit.Organization, commit.Repository)
+		if renameErr != nil {
+			logger.WarnContext(ctx, "failed to resolve renamed repository of commit", "error", renameErr)
+		} else if org != commit.Organization || repository != commit.Repository {
+			renamed := *commit
+			renamed.Organization = org
+			renamed.Repository = repository
+			lookup = &renamed
+
+			commitReviewStatus.Note = fmt.Sprintf("repository %s/%s was renamed to %s/%s", commit.Organization, commit.Repository, org, repository)
+			requests, err = GetPullRequestsTargetingDefaultBranch(ctx, gitHubClient, org, repository, commit.SHA)
+		}
+	}
 	if err != nil {
+		if errors.Is(err, ErrRateLimited) {
+			// GitHub will answer the query again once the rate limit resets, so
+			// the commit is dropped to be retried on the next pipeline execution.
+			logger.WarnContext(ctx, "rate limited getting pull requests for commit, retrying on the next run",
+				"error", err,
+				"commit_sha", commit.SHA,
+			)
+			return nil
+		}
+		if errors.Is(err, ErrAccessDenied) {
+			// this is a permanent error, retrying the commit fails the same way
+			// until the GitHub App is granted access to the repository
+			commitReviewStatus.ApprovalStatus = AccessDeniedStatus
+			commitReviewStatus.Note = err.Error()
+			return &commitReviewStatus
+		}
+		if errors.Is(err, ErrNoDefaultBranch) {
+			// this is a permanent error until a branch is pushed to the
+			// repository, the commit is recorded with the reason it has no
+			// pull requests
+			commitReviewStatus.Note = err.Error()
+			return &commitReviewStatus
+		}
 		// Special error cases
-		if strings.HasPrefix(err.Error(), "failed to call graphql") {
-			unwrapped := errors.Unwrap(err)
-			if strings.HasPrefix(unwrapped.Error(), "Could not resolve to a Repository") {
-				// this is a permanent error from GitHub telling us the repository
-				// for the commit no longer exists. Note this in the commit review status
-				// and send it on for further processing
-				commitReviewStatus.Note = unwrapped.Error()
-				return &commitReviewStatus
-			}
+		if isRepositoryNotFound(err) {
+			// this is a permanent error from GitHub telling us the repository
+			// for the commit no longer exists. Note this in the commit review status
+			// and send it on for further processing
+			commitReviewStatus.Note = errors.Unwrap(err).Error()
+			return &commitReviewStatus
 		}
 		// There are essentially two different kind of errors that could happen:
 		// 1. Transient Errors: We aren't able to get the pull requests for a commit
@@ -194,45 +331,121 @@ func processCommit(ctx context.Context, gitHubClient *githubv4.Client, commit *C
 	// Regardless, we only care that there is at least one pull
 	// request for the commit that has been approved by a reviewer. So we
 	// will simply select the first PR we find that matches that criteria.
-	pullRequest := getApprovingPullRequest(requests)
+	pullRequest := getApprovingPullRequest(requests, policy)
 	// if there were no approving PRs, but we do have PRs for this commit, then
 	// just choose the first one
 	if pullRequest == nil && len(requests) > 0 {
 		pullRequest = requests[0]
 	}
 	if pullRequest != nil {
-		id, err := strconv.ParseInt(string(pullRequest.FullDatabaseID), 10, 64)
-		if err != nil {
-			// should never fail to parse as fullDatabaseId is of type BigInt
-			// see: https://docs.github.com/en/graphql/reference/scalars#bigint
-			panic("impossible")
-		}
-		commitReviewStatus.PullRequestID = id
+		commitReviewStatus.PullRequestID = pullRequestID(pullRequest)
 		commitReviewStatus.PullRequestNumber = int(pullRequest.Number)
 		commitReviewStatus.PullRequestHTMLURL = string(pullRequest.URL)
-		commitReviewStatus.ApprovalStatus = getApprovalStatus(pullRequest)
+		commitReviewStatus.ApprovalStatus = getApprovalStatus(pullRequest, policy)
+		commitReviewStatus.BotApproved = getBotApproved(pullRequest, policy)
+		if isApprovedByMerge(pullRequest, policy) {
+			commitReviewStatus.ApprovalStatus = ApprovedByMergeStatus
+		}
+	}
+	if cfg.RecordAllApprovingPullRequests {
+		commitReviewStatus.ApprovingPullRequests = getApprovingPullRequests(requests, policy)
+	}
+	if policy.requireCodeOwnerApproval && commitReviewStatus.ApprovalStatus == GithubPRApproved {
+		approvers, hasOwners, err := getCodeOwnerApprovers(ctx, gitHubClient, teams, lookup, pullRequest)
+		if err != nil {
+			// Like the pull request lookup above, the commit will be retried on
+			// the next pipeline execution.
+			logger.ErrorContext(ctx, "failed to get code owner approvers for commit", "error", err)
+			return nil
+		}
+		commitReviewStatus.CodeOwnerApprovers = approvers
+		if hasOwners && len(approvers) == 0 {
+			commitReviewStatus.ApprovalStatus = ApprovedByNonOwnerStatus
+		}
+	}
+	if policy.requiredDistinctTeams > 0 && commitReviewStatus.ApprovalStatus == GithubPRApproved {
+		approvingTeams, unknown, err := getApprovingTeams(ctx, teams, lookup.Organization, pullRequest, policy)
+		if err != nil {
+			// Like the pull request lookup above, the commit will be retried on
+			// the next pipeline execution.
+			logger.ErrorContext(ctx, "failed to get approving teams for commit", "error", err)
+			return nil
+		}
+		if len(unknown) > 0 {
+			logger.WarnContext(ctx, "approving reviewers are not members of any team",
+				"reviewers", unknown)
+		}
+		commitReviewStatus.ApprovingTeams = approvingTeams
+		if len(approvingTeams) < policy.requiredDistinctTeams {
+			commitReviewStatus.ApprovalStatus = ApprovedByTooFewTeamsStatus
+		}
 	}
 	return &commitReviewStatus
 }
 
-func getApprovalStatus(request *PullRequest) string {
+// getApprovalStatus computes the approval status of a PR given the approval
+// policy it must satisfy.
+func getApprovalStatus(request *PullRequest, policy *approvalPolicy) string {
 	// All PRs start with status of GithubPRReviewRequired
 	approvalStatus := GithubPRReviewRequired
-	for _, review := range request.Reviews.Nodes {
+	var approvals int
+	for login, state := range latestReviewStates(request) {
 		// if GithubPRChangesRequested set approvalStatus to that as we
 		// want to know if a review was conducted but blocked the merge
-		if review.State == GithubPRChangesRequested {
-			approvalStatus = string(review.State)
+		if state == GithubPRChangesRequested {
+			approvalStatus = state
 		}
-		// if GithubPRApproved is found immediately return as we know
-		// the PR was approved and do not need to check other reviews.
-		if review.State == GithubPRApproved {
-			return GithubPRApproved
+		// approvals from bots are not counted towards the required approvals
+		// when they are excluded by the policy.
+		if state == GithubPRApproved && !policy.isExcludedBot(login) {
+			approvals++
 		}
 	}
+	// once the required number of approvals is found we know the PR was
+	// approved regardless of the other reviews.
+	if approvals >= policy.requiredApprovals {
+		return GithubPRApproved
+	}
 	return approvalStatus
 }
 
+// isApprovedByMerge reports whether the PR is considered approved because it
+// was merged without any recorded reviews and the policy trusts branch
+// protection to have enforced the review at merge time. A PR with any recorded
+// review, including one that only requested changes, is subject to the regular
+// approval rules.
+func isApprovedByMerge(request *PullRequest, policy *approvalPolicy) bool {
+	return policy.approveMergedWithoutReviews && bool(request.Merged) && len(request.Reviews.Nodes) == 0
+}
+
+// getBotApproved reports whether any reviewer of the PR that is excluded as a
+// bot by the policy approved it.
+func getBotApproved(request *PullRequest, policy *approvalPolicy) bool {
+	for login, state := range latestReviewStates(request) {
+		if state == GithubPRApproved && policy.isExcludedBot(login) {
+			return true
+		}
+	}
+	return false
+}
+
+// latestReviewStates returns the most recent review state of each reviewer of
+// the given pull request, keyed by the reviewer's login. Reviews are returned
+// by GitHub in chronological order, so a later review by the same reviewer
+// supersedes an earlier one. A dismissed review clears any approval the
+// reviewer had previously given, while reviews that only leave comments do
+// not change the reviewer's state.
+func latestReviewStates(request *PullRequest) map[string]string {
+	states := make(map[string]string)
+	for _, review := range request.Reviews.Nodes {
+		switch state := string(review.State); state {
+		case GithubPRApproved, GithubPRChangesRequested, GithubPRDismissed:
+			states[normalizeLogin(string(review.Author.Login))] = state
+		}
+	}
+	return states
+}
+
 // processReviewStatus is a function that takes a CommitReviewStatus
 // and populates its breakGlassIssue field (if necessary) and then returns
 // it. The process only searches for break glass
@@ -264,33 +477,101 @@ func processReviewStatus(ctx context.Context, fetcher BreakGlassIssueFetcher, cf
 // getApprovingPullRequest retrieves the first *PullRequest that has a
 // review decision status with the value of GithubPRApproved. if no such
 // *PullRequest is present then nil is returned.
-func getApprovingPullRequest(pullRequests []*PullRequest) *PullRequest {
+func getApprovingPullRequest(pullRequests []*PullRequest, policy *approvalPolicy) *PullRequest {
 	for _, pullRequest := range pullRequests {
-		for _, review := range pullRequest.Reviews.Nodes {
-			if review.State == GithubPRApproved {
-				return pullRequest
-			}
+		if getApprovalStatus(pullRequest, policy) == GithubPRApproved {
+			return pullRequest
 		}
 	}
 	return nil
 }
 
-func getCommitHTMLURL(commit *Commit) string {
-	return fmt.Sprintf("https://github.com/%s/%s/commit/%s", commit.Organization, commit.Repository, commit.SHA)
+// getApprovingPullRequests returns all pull requests that are approved
+// according to the approval policy, in the order they were given.
+func getApprovingPullRequests(pullRequests []*PullRequest, policy *approvalPolicy) []*ApprovingPullRequest {
+	approving := make([]*ApprovingPullRequest, 0)
+	for _, pullRequest := range pullRequests {
+		if getApprovalStatus(pullRequest, policy) == GithubPRApproved {
+			approving = append(approving, &ApprovingPullRequest{
+				ID:      pullRequestID(pullRequest),
+				Number:  int(pullRequest.Number),
+				HTMLURL: string(pullRequest.URL),
+			})
+		}
+	}
+	return approving
+}
+
+// pullRequestID returns the database ID of the pull request.
+func pullRequestID(pullRequest *PullRequest) int64 {
+	id, err := strconv.ParseInt(string(pullRequest.FullDatabaseID), 10, 64)
+	if err != nil {
+		// should never fail to parse as fullDatabaseId is of type BigInt
+		// see: https://docs.github.com/en/graphql/reference/scalars#bigint
+		panic("impossible")
+	}
+	return id
+}
+
+// getCommitHTMLURL returns the URL of the commit on github.com if graphQLURL
+// is empty, otherwise on the GitHub Enterprise Server instance whose GraphQL
+// endpoint it is.
+func getCommitHTMLURL(graphQLURL string, commit *Commit) string {
+	baseURL := "https://github.com"
+	if u, err := url.Parse(graphQLURL); graphQLURL != "" && err == nil {
+		baseURL = fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	}
+	return fmt.Sprintf("%s/%s/%s/commit/%s", baseURL, commit.Organization, commit.Repository, commit.SHA)
+}
+
+// NewGitHubGraphQLClient creates a GitHub GraphQL client authenticated with the
+// given access token. If graphQLURL is empty the client targets github.com,
+// otherwise it targets the given GraphQL endpoint of a GitHub Enterprise
+// Server instance, e.g. https://ghe.example.com/api/graphql. Requests that
+// failed with a 5xx response are retried, with the default retry configuration
+// if retryCfg is nil. The connections are pooled as configured by
+// transportCfg, by the default transport if it is nil.
+func NewGitHubGraphQLClient(ctx context.Context, accessToken, graphQLURL string, retryCfg *GraphQLRetryConfig, transportCfg *GraphQLTransportConfig) *githubv4.Client {
+	var base http.RoundTripper
+	if transportCfg != nil {
+		base = newGraphQLTransport(transportCfg)
+	}
+	return newGitHubGraphQLClient(ctx, accessToken, graphQLURL, retryCfg, base)
 }
 
-func NewGitHubGraphQLClient(ctx context.Context, accessToken string) *githubv4.Client {
+// newGitHubGraphQLClient creates a GitHub GraphQL client like
+// [NewGitHubGraphQLClient] whose requests are sent by the base transport, or
+// by the transport of the oauth2 client if it is nil.
+func newGitHubGraphQLClient(ctx context.Context, accessToken, graphQLURL string, retryCfg *GraphQLRetryConfig, base http.RoundTripper) *githubv4.Client {
+	if retryCfg == nil {
+		retryCfg = DefaultGraphQLRetryConfig
+	}
+
 	src := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: accessToken},
 	)
 	httpClient := oauth2.NewClient(ctx, src)
+	if base != nil {
+		httpClient = &http.Client{
+			Transport: &oauth2.Transport{Source: src, Base: base},
+		}
+	}
+	httpClient.Transport = &retryTransport{base: httpClient.Transport, cfg: retryCfg}
+	// the responses of the commits sampled by a RawResponseSampler are
+	// recorded, only the last of a retried request
+	httpClient.Transport = &rawResponseTransport{base: httpClient.Transport}
+	if graphQLURL != "" {
+		return githubv4.NewEnterpriseClient(graphQLURL, httpClient)
+	}
 	return githubv4.NewClient(httpClient)
 }
 
 // GetPullRequestsTargetingDefaultBranch retrieves all associated pull requests
 // for a commit that target the repository's default branch from GitHub based on
 // the given GitHub organization, repository, and commit sha. If the commit
-// has no such associated pull requests then an empty slice is returned.
+// has no such associated pull requests then an empty slice is returned. If
+// GitHub rate limited the queries, the error wraps ErrRateLimited. If the
+// repository has no default branch, ErrNoDefaultBranch is returned.
 func GetPullRequestsTargetingDefaultBranch(ctx context.Context, client *githubv4.Client, githubOrg, repository, commitSha string) ([]*PullRequest, error) {
 	var query CommitGraphQlQuery
 	pullRequests := make([]*PullRequest, 0, query.Repository.Object.Commit.AssociatedPullRequest.TotalCount)
@@ -305,32 +586,22 @@ func GetPullRequestsTargetingDefaultBranch(ctx context.Context, client *githubv4
 			// unlike the pullRequestCursor.
 			"reviewCursor": (*githubv4.String)(nil),
 		}); err != nil {
-			return nil, fmt.Errorf("failed to call graphql: %w", err)
+			return nil, graphQLError(err)
+		}
+		// without a default branch no pull request can match it, so the
+		// commit would silently appear to have no pull requests at all
+		if query.Repository.DefaultBranchRef.Name == "" {
+			return nil, ErrNoDefaultBranch
 		}
 
-		for i := 0; i < len(query.Repository.Object.Commit.AssociatedPullRequest.Nodes); i++ {
-			pr := query.Repository.Object.Commit.AssociatedPullRequest.Nodes[i]
-			if pr.BaseRefName == query.Repository.DefaultBranchRef.Name {
-				// We need to account for when reviewNodes span multiple pages.
-				for pr.Reviews.PageInfo.HasNextPage {
-					// Make a new query object so that our existing query's
-					// state is not obliterated.
-					reviewQuery := CommitGraphQlQuery{}
-					if err := client.Query(ctx, &reviewQuery, map[string]any{
-						"githubOrg":         githubv4.String(githubOrg),
-						"repository":        githubv4.String(repository),
-						"commitSha":         githubv4.GitObjectID(commitSha),
-						"pullRequestCursor": pullRequestCursor,
-						"reviewCursor":      pr.Reviews.PageInfo.EndCursor,
-					}); err != nil {
-						return nil, fmt.Errorf("failed to call graphql: %w", err)
-					}
-					reviews := reviewQuery.Repository.Object.Commit.AssociatedPullRequest.Nodes[i].Reviews
-					pr.Reviews.Nodes = append(pr.Reviews.Nodes, reviews.Nodes...)
-					pr.Reviews.PageInfo = reviews.PageInfo
-				}
-				pullRequests = append(pullRequests, pr)
+		for _, pr := range query.Repository.Object.Commit.AssociatedPullRequest.Nodes {
+			if pr.BaseRefName != query.Repository.DefaultBranchRef.Name {
+				continue
 			}
+			if err := getRemainingReviews(ctx, client, githubOrg, repository, pr); err != nil {
+				return nil, err
+			}
+			pullRequests = append(pullRequests, pr)
 		}
 		pageInfo := query.Repository.Object.Commit.AssociatedPullRequest.PageInfo
 		if pageInfo == nil || !pageInfo.HasNextPage {
@@ -340,3 +611,60 @@ func GetPullRequestsTargetingDefaultBranch(ctx context.Context, client *githubv4
 	}
 	return pullRequests, nil
 }
+
+// getRemainingReviews fetches the pages of reviews of the pull request that
+// follow the first page, which is fetched with the pull requests of a commit.
+// The review cursor of the commit query applies to every pull request on a
+// page, so the remaining pages are queried for the pull request by its number.
+func getRemainingReviews(ctx context.Context, client *githubv4.Client, githubOrg, repository string, pr *PullRequest) error {
+	for pr.Reviews.PageInfo != nil && pr.Reviews.PageInfo.HasNextPage {
+		var query PullRequestReviewsGraphQlQuery
+		if err := client.Query(ctx, &query, map[string]any{
+			"githubOrg":         githubv4.String(githubOrg),
+			"repository":        githubv4.String(repository),
+			"pullRequestNumber": pr.Number,
+			"reviewCursor":      pr.Reviews.PageInfo.EndCursor,
+		}); err != nil {
+			return graphQLError(err)
+		}
+		reviews := query.Repository.PullRequest.Reviews
+		pr.Reviews.Nodes = append(pr.Reviews.Nodes, reviews.Nodes...)
+		pr.Reviews.PageInfo = reviews.PageInfo
+	}
+	return nil
+}
+
+// graphQLError wraps an error returned by the GraphQL client, marking rate
+// limit errors with ErrRateLimited and access errors with ErrAccessDenied.
+func graphQLError(err error) error {
+	if isRateLimitError(err) {
+		return fmt.Errorf("%w: %w", ErrRateLimited, err)
+	}
+	if isAccessDeniedError(err) {
+		return fmt.Errorf("%w: %w", ErrAccessDenied, err)
+	}
+	return fmt.Errorf("failed to call graphql: %w", err)
+}
+
+// isAccessDeniedError reports whether the GraphQL client failed because the
+// GitHub App may not access the repository. GitHub reports this as a GraphQL
+// error of type FORBIDDEN, whose message is the only part the client exposes.
+// A 403 status of the whole request, e.g. from a proxy or an outage, is not
+// about the repository and is left to be retried like other errors.
+func isAccessDeniedError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	if strings.HasPrefix(msg, "non-200 ok status code") {
+		return false
+	}
+	return strings.Contains(msg, "resource not accessible by integration")
+}
+
+// isRateLimitError reports whether the GraphQL client failed because of a
+// rate limit. GitHub reports the primary rate limit as a GraphQL error of type
+// RATE_LIMITED and secondary rate limits with a 403 or 429 status. The client
+// only exposes the messages of GraphQL errors and the body of non-200
+// responses, so rate limits are detected by their message.
+func isRateLimitError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "rate limit") || strings.Contains(msg, "rate_limited")
+}
@@ -21,6 +21,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -38,6 +39,10 @@ var defaultConfig = &Config{
 	PushEventsTableID:         "push_events",
 	CommitReviewStatusTableID: "commit_review_status",
 	IssuesTableID:             "issues",
+	RequiredApprovals:         1,
+	BreakGlassConcurrency:     10,
+	BreakGlassMaxIssues:       1000,
+	SinkConcurrency:           10,
 }
 
 func TestGetPullRequests(t *testing.T) {
@@ -73,9 +78,13 @@ func TestGetPullRequests(t *testing.T) {
                        nodes{
                          baseRefName,
                          fullDatabaseId,
+                         merged,
                          number,
                          reviews(first: 100, after: $reviewCursor) {
                            nodes {
+                             author {
+                               login
+                             },
                              state
                            },
                            pageInfo{
@@ -192,9 +201,13 @@ func TestGetPullRequests(t *testing.T) {
                        nodes{
                          baseRefName,
                          fullDatabaseId,
+                         merged,
                          number,
                          reviews(first: 100, after: $reviewCursor) {
                            nodes {
+                             author {
+                               login
+                             },
                              state
                            },
                            pageInfo{
@@ -339,9 +352,13 @@ func TestGetPullRequests(t *testing.T) {
                        nodes{
                          baseRefName,
                          fullDatabaseId,
+                         merged,
                          number,
                          reviews(first: 100, after: $reviewCursor) {
                            nodes {
+                             author {
+                               login
+                             },
                              state
                            },
                            pageInfo{
@@ -387,9 +404,13 @@ func TestGetPullRequests(t *testing.T) {
                        nodes{
                          baseRefName,
                          fullDatabaseId,
+                         merged,
                          number,
                          reviews(first: 100, after: $reviewCursor) {
                            nodes {
+                             author {
+                               login
+                             },
                              state
                            },
                            pageInfo{
@@ -556,9 +577,13 @@ func TestGetPullRequests(t *testing.T) {
                        nodes{
                          baseRefName,
                          fullDatabaseId,
+                         merged,
                          number,
                          reviews(first: 100, after: $reviewCursor) {
                            nodes {
+                             author {
+                               login
+                             },
                              state
                            },
                            pageInfo{
@@ -637,9 +662,13 @@ func TestGetPullRequests(t *testing.T) {
                        nodes{
                          baseRefName,
                          fullDatabaseId,
+                         merged,
                          number,
                          reviews(first: 100, after: $reviewCursor) {
                            nodes {
+                             author {
+                               login
+                             },
                              state
                            },
                            pageInfo {
@@ -771,9 +800,13 @@ func TestGetPullRequests(t *testing.T) {
                        nodes{
                          baseRefName,
                          fullDatabaseId,
+                         merged,
                          number,
                          reviews(first: 100, after: $reviewCursor) {
                            nodes {
+                             author {
+                               login
+                             },
                              state
                            },
                            pageInfo{
@@ -808,7 +841,134 @@ func TestGetPullRequests(t *testing.T) {
          }`,
 				`{
            "query": "
-             query($commitSha:GitObjectID! $githubOrg:String! $pullRequestCursor:String! $repository:String! $reviewCursor:String!) {
+             query($githubOrg:String! $pullRequestNumber:Int! $repository:String! $reviewCursor:String!) {
+               repository(owner: $githubOrg, name: $repository) {
+                 pullRequest(number: $pullRequestNumber) {
+                   reviews(first: 100, after: $reviewCursor) {
+                     nodes {
+                       author {
+                         login
+                       },
+                       state
+                     },
+                     pageInfo{
+                       hasNextPage,
+                       hasPreviousPage,
+                       endCursor,
+                       startCursor
+                     }
+                   }
+                 }
+               }
+             }
+           ",
+           "variables": {
+             "githubOrg": "test-org",
+             "pullRequestNumber": 23,
+             "repository":"test-repo",
+             "reviewCursor": "XQ"
+           }
+         }`,
+			},
+			want: []*PullRequest{
+				{
+					BaseRefName:    "main",
+					FullDatabaseID: "1",
+					Number:         23,
+					Reviews: struct {
+						Nodes    []*Review
+						PageInfo *PageInfo
+					}{
+						Nodes: []*Review{
+							{
+								State: "CHANGES_REQUESTED",
+							},
+							{
+								State: "APPROVED",
+							},
+						},
+						PageInfo: &PageInfo{},
+					},
+					URL: "https://github.com/my-org/my-repo/pull/23",
+				},
+			},
+			responseBodies: []string{
+				`{
+           "data": {
+             "repository": {
+               "defaultBranchRef": {
+                 "name": "main"
+               },
+               "object": {
+                 "associatedPullRequests": {
+                   "nodes": [
+                     {
+                       "baseRefName": "main",
+                       "fullDatabaseId": "1",
+                       "number": 23,
+                       "reviews": {
+                         "nodes": [
+                           {
+                             "state": "CHANGES_REQUESTED"
+                           }
+                         ],
+                         "pageInfo": {
+                           "hasNextPage": true,
+                           "hasPreviousPage": false,
+                           "endCursor": "XQ",
+                           "startCursor": ""
+                         }
+                       },
+                       "url": "https://github.com/my-org/my-repo/pull/23"
+                     }
+                   ],
+                   "pageInfo": {
+                     "endCursor": "",
+                     "hasNextPage": false,
+                     "hasPreviousPage": false,
+                     "startCursor": ""
+                   },
+                   "totalCount": 2
+                 }
+               }
+             }
+           }
+         }`,
+				`{
+           "data": {
+             "repository": {
+               "pullRequest": {
+                 "reviews": {
+                   "nodes": [
+                     {
+                       "state": "APPROVED"
+                     }
+                   ],
+                   "pageInfo": {
+                     "hasNextPage": false,
+                     "hasPreviousPage": false,
+                     "endCursor": "",
+                     "startCursor": ""
+                   }
+                 }
+               }
+             }
+           }
+         }`,
+			},
+		},
+		{
+			// the remaining reviews of each pull request are fetched for the pull
+			// request itself, on every page of pull requests
+			name:       "pull_requests_on_two_pages_with_several_pages_of_reviews",
+			token:      "fake_token",
+			githubOrg:  "test-org",
+			repository: "test-repo",
+			commitSha:  "kof6p96lr6qvdu81qw49fhmoxrod9qmc2qak51nh",
+			wantRequestBodies: []string{
+				`{
+           "query": "
+             query($commitSha:GitObjectID! $githubOrg:String! $pullRequestCursor:String! $repository:String! $reviewCursor:String) {
                repository(owner: $githubOrg, name: $repository) {
                  defaultBranchRef {
                    name
@@ -819,9 +979,13 @@ func TestGetPullRequests(t *testing.T) {
                        nodes{
                          baseRefName,
                          fullDatabaseId,
+                         merged,
                          number,
                          reviews(first: 100, after: $reviewCursor) {
                            nodes {
+                             author {
+                               login
+                             },
                              state
                            },
                            pageInfo{
@@ -851,7 +1015,149 @@ func TestGetPullRequests(t *testing.T) {
              "githubOrg": "test-org",
              "pullRequestCursor": "",
              "repository":"test-repo",
-						 "reviewCursor": "XQ"
+             "reviewCursor": null
+           }
+         }`,
+				`{
+           "query": "
+             query($githubOrg:String! $pullRequestNumber:Int! $repository:String! $reviewCursor:String!) {
+               repository(owner: $githubOrg, name: $repository) {
+                 pullRequest(number: $pullRequestNumber) {
+                   reviews(first: 100, after: $reviewCursor) {
+                     nodes {
+                       author {
+                         login
+                       },
+                       state
+                     },
+                     pageInfo{
+                       hasNextPage,
+                       hasPreviousPage,
+                       endCursor,
+                       startCursor
+                     }
+                   }
+                 }
+               }
+             }
+           ",
+           "variables": {
+             "githubOrg": "test-org",
+             "pullRequestNumber": 23,
+             "repository":"test-repo",
+             "reviewCursor": "R23"
+           }
+         }`,
+				`{
+           "query": "
+             query($commitSha:GitObjectID! $githubOrg:String! $pullRequestCursor:String! $repository:String! $reviewCursor:String) {
+               repository(owner: $githubOrg, name: $repository) {
+                 defaultBranchRef {
+                   name
+                 },
+                 object(oid: $commitSha) {
+                   ... on Commit{
+                     associatedPullRequests(first: 100, after: $pullRequestCursor) {
+                       nodes{
+                         baseRefName,
+                         fullDatabaseId,
+                         merged,
+                         number,
+                         reviews(first: 100, after: $reviewCursor) {
+                           nodes {
+                             author {
+                               login
+                             },
+                             state
+                           },
+                           pageInfo{
+                             hasNextPage,
+                             hasPreviousPage,
+                             endCursor,
+                             startCursor
+                           }
+                         },
+                         url
+                       },
+                       pageInfo{
+                         hasNextPage,
+                         hasPreviousPage,
+                         endCursor,
+                         startCursor
+                       },
+                       totalCount
+                     }
+                   }
+                 }
+               }
+             }
+           ",
+           "variables": {
+             "commitSha": "kof6p96lr6qvdu81qw49fhmoxrod9qmc2qak51nh",
+             "githubOrg": "test-org",
+             "pullRequestCursor": "P1",
+             "repository":"test-repo",
+             "reviewCursor": null
+           }
+         }`,
+				`{
+           "query": "
+             query($githubOrg:String! $pullRequestNumber:Int! $repository:String! $reviewCursor:String!) {
+               repository(owner: $githubOrg, name: $repository) {
+                 pullRequest(number: $pullRequestNumber) {
+                   reviews(first: 100, after: $reviewCursor) {
+                     nodes {
+                       author {
+                         login
+                       },
+                       state
+                     },
+                     pageInfo{
+                       hasNextPage,
+                       hasPreviousPage,
+                       endCursor,
+                       startCursor
+                     }
+                   }
+                 }
+               }
+             }
+           ",
+           "variables": {
+             "githubOrg": "test-org",
+             "pullRequestNumber": 57,
+             "repository":"test-repo",
+             "reviewCursor": "R57A"
+           }
+         }`,
+				`{
+           "query": "
+             query($githubOrg:String! $pullRequestNumber:Int! $repository:String! $reviewCursor:String!) {
+               repository(owner: $githubOrg, name: $repository) {
+                 pullRequest(number: $pullRequestNumber) {
+                   reviews(first: 100, after: $reviewCursor) {
+                     nodes {
+                       author {
+                         login
+                       },
+                       state
+                     },
+                     pageInfo{
+                       hasNextPage,
+                       hasPreviousPage,
+                       endCursor,
+                       startCursor
+                     }
+                   }
+                 }
+               }
+             }
+           ",
+           "variables": {
+             "githubOrg": "test-org",
+             "pullRequestNumber": 57,
+             "repository":"test-repo",
+             "reviewCursor": "R57B"
            }
          }`,
 			},
@@ -866,9 +1172,15 @@ func TestGetPullRequests(t *testing.T) {
 					}{
 						Nodes: []*Review{
 							{
-								State: "CHANGES_REQUESTED",
+								Author: struct {
+									Login githubv4.String
+								}{Login: "reviewer-a"},
+								State: "COMMENTED",
 							},
 							{
+								Author: struct {
+									Login githubv4.String
+								}{Login: "reviewer-b"},
 								State: "APPROVED",
 							},
 						},
@@ -876,6 +1188,38 @@ func TestGetPullRequests(t *testing.T) {
 					},
 					URL: "https://github.com/my-org/my-repo/pull/23",
 				},
+				{
+					BaseRefName:    "main",
+					FullDatabaseID: "3",
+					Number:         57,
+					Reviews: struct {
+						Nodes    []*Review
+						PageInfo *PageInfo
+					}{
+						Nodes: []*Review{
+							{
+								Author: struct {
+									Login githubv4.String
+								}{Login: "reviewer-c"},
+								State: "COMMENTED",
+							},
+							{
+								Author: struct {
+									Login githubv4.String
+								}{Login: "reviewer-c"},
+								State: "CHANGES_REQUESTED",
+							},
+							{
+								Author: struct {
+									Login githubv4.String
+								}{Login: "reviewer-d"},
+								State: "APPROVED",
+							},
+						},
+						PageInfo: &PageInfo{},
+					},
+					URL: "https://github.com/my-org/my-repo/pull/57",
+				},
 			},
 			responseBodies: []string{
 				`{
@@ -894,26 +1238,51 @@ func TestGetPullRequests(t *testing.T) {
                        "reviews": {
                          "nodes": [
                            {
-                             "state": "CHANGES_REQUESTED"
+                             "author": {
+                               "login": "reviewer-a"
+                             },
+                             "state": "COMMENTED"
                            }
                          ],
                          "pageInfo": {
                            "hasNextPage": true,
                            "hasPreviousPage": false,
-                           "endCursor": "XQ",
+                           "endCursor": "R23",
                            "startCursor": ""
                          }
                        },
                        "url": "https://github.com/my-org/my-repo/pull/23"
+                     },
+                     {
+                       "baseRefName": "feature",
+                       "fullDatabaseId": "2",
+                       "number": 24,
+                       "reviews": {
+                         "nodes": [
+                           {
+                             "author": {
+                               "login": "reviewer-a"
+                             },
+                             "state": "COMMENTED"
+                           }
+                         ],
+                         "pageInfo": {
+                           "hasNextPage": true,
+                           "hasPreviousPage": false,
+                           "endCursor": "R24",
+                           "startCursor": ""
+                         }
+                       },
+                       "url": "https://github.com/my-org/my-repo/pull/24"
                      }
                    ],
                    "pageInfo": {
-                     "endCursor": "",
-                     "hasNextPage": false,
+                     "hasNextPage": true,
                      "hasPreviousPage": false,
+                     "endCursor": "P1",
                      "startCursor": ""
                    },
-                   "totalCount": 2
+                   "totalCount": 3
                  }
                }
              }
@@ -922,30 +1291,57 @@ func TestGetPullRequests(t *testing.T) {
 				`{
            "data": {
              "repository": {
-               "defaultBranchRef": {
-                 "name": "main"
-               },
-               "object": {
-                 "associatedPullRequests": {
+               "pullRequest": {
+                 "reviews": {
                    "nodes": [
                      {
-                       "baseRefName": "main",
-                       "fullDatabaseId": "1",
-                       "number": 23,
-                       "reviews": {
-                         "nodes": [
-                           {
-                             "state": "APPROVED"
+                       "author": {
+                         "login": "reviewer-b"
+                       },
+                       "state": "APPROVED"
+                     }
+                   ],
+                   "pageInfo": {
+                     "hasNextPage": false,
+                     "hasPreviousPage": false,
+                     "endCursor": "",
+                     "startCursor": ""
+                   }
+                 }
+               }
+             }
+           }
+         }`,
+				`{
+           "data": {
+             "repository": {
+               "defaultBranchRef": {
+                 "name": "main"
+               },
+               "object": {
+                 "associatedPullRequests": {
+                   "nodes": [
+                     {
+                       "baseRefName": "main",
+                       "fullDatabaseId": "3",
+                       "number": 57,
+                       "reviews": {
+                         "nodes": [
+                           {
+                             "author": {
+                               "login": "reviewer-c"
+                             },
+                             "state": "COMMENTED"
                            }
                          ],
                          "pageInfo": {
-                           "hasNextPage": false,
+                           "hasNextPage": true,
                            "hasPreviousPage": false,
-                           "endCursor": "",
+                           "endCursor": "R57A",
                            "startCursor": ""
                          }
                        },
-                       "url": "https://github.com/my-org/my-repo/pull/23"
+                       "url": "https://github.com/my-org/my-repo/pull/57"
                      }
                    ],
                    "pageInfo": {
@@ -954,7 +1350,55 @@ func TestGetPullRequests(t *testing.T) {
                      "endCursor": "",
                      "startCursor": ""
                    },
-                   "totalCount": 2
+                   "totalCount": 3
+                 }
+               }
+             }
+           }
+         }`,
+				`{
+           "data": {
+             "repository": {
+               "pullRequest": {
+                 "reviews": {
+                   "nodes": [
+                     {
+                       "author": {
+                         "login": "reviewer-c"
+                       },
+                       "state": "CHANGES_REQUESTED"
+                     }
+                   ],
+                   "pageInfo": {
+                     "hasNextPage": true,
+                     "hasPreviousPage": false,
+                     "endCursor": "R57B",
+                     "startCursor": ""
+                   }
+                 }
+               }
+             }
+           }
+         }`,
+				`{
+           "data": {
+             "repository": {
+               "pullRequest": {
+                 "reviews": {
+                   "nodes": [
+                     {
+                       "author": {
+                         "login": "reviewer-d"
+                       },
+                       "state": "APPROVED"
+                     }
+                   ],
+                   "pageInfo": {
+                     "hasNextPage": false,
+                     "hasPreviousPage": false,
+                     "endCursor": "",
+                     "startCursor": ""
+                   }
                  }
                }
              }
@@ -1004,6 +1448,148 @@ func TestGetPullRequests(t *testing.T) {
 	}
 }
 
+func TestGetPullRequests_RateLimited(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name             string
+		responseCode     int
+		responseBody     string
+		wantRateLimited  bool
+		wantAccessDenied bool
+		wantErr          string
+	}{
+		{
+			name:         "primary_rate_limit",
+			responseCode: http.StatusOK,
+			responseBody: `{
+           "data": null,
+           "errors": [
+             {
+               "type": "RATE_LIMITED",
+               "message": "API rate limit exceeded for installation ID 12345."
+             }
+           ]
+         }`,
+			wantRateLimited: true,
+			wantErr:         "github graphql rate limit exceeded: API rate limit exceeded for installation ID 12345.",
+		},
+		{
+			name:            "secondary_rate_limit",
+			responseCode:    http.StatusForbidden,
+			responseBody:    `{"message": "You have exceeded a secondary rate limit. Please wait a few minutes before you try again."}`,
+			wantRateLimited: true,
+			wantErr:         "github graphql rate limit exceeded",
+		},
+		{
+			name:         "other_graphql_error",
+			responseCode: http.StatusOK,
+			responseBody: `{
+           "data": null,
+           "errors": [
+             {
+               "type": "NOT_FOUND",
+               "message": "Could not resolve to a Repository with the name 'test-repository'."
+             }
+           ]
+         }`,
+			wantErr: "failed to call graphql: Could not resolve to a Repository",
+		},
+		{
+			name:         "access_denied",
+			responseCode: http.StatusOK,
+			responseBody: `{
+           "data": null,
+           "errors": [
+             {
+               "type": "FORBIDDEN",
+               "message": "Resource not accessible by integration"
+             }
+           ]
+         }`,
+			wantAccessDenied: true,
+			wantErr:          "github denied access to the repository: Resource not accessible by integration",
+		},
+		{
+			name:         "http_forbidden",
+			responseCode: http.StatusForbidden,
+			responseBody: `Forbidden`,
+			wantErr:      "failed to call graphql: non-200 OK status code: 403 Forbidden",
+		},
+		{
+			name:         "http_forbidden_resource_not_accessible",
+			responseCode: http.StatusForbidden,
+			responseBody: `{"message": "Resource not accessible by integration"}`,
+			wantErr:      "failed to call graphql: non-200 OK status code: 403 Forbidden",
+		},
+		{
+			name:         "other_forbidden_graphql_error",
+			responseCode: http.StatusOK,
+			responseBody: `{
+           "data": null,
+           "errors": [
+             {
+               "type": "INTERNAL",
+               "message": "Something went wrong, request forbidden by upstream"
+             }
+           ]
+         }`,
+			wantErr: "failed to call graphql: Something went wrong",
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			fakeGitHub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.responseCode)
+				fmt.Fprint(w, tc.responseBody)
+			}))
+			t.Cleanup(fakeGitHub.Close)
+
+			ctx := context.Background()
+			client := githubv4.NewEnterpriseClient(fakeGitHub.URL, fakeGitHub.Client())
+
+			_, err := GetPullRequestsTargetingDefaultBranch(ctx, client, "test-org", "test-repository", "12345678")
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if got, want := errors.Is(err, ErrRateLimited), tc.wantRateLimited; got != want {
+				t.Errorf("expected errors.Is(err, ErrRateLimited) to be %t, got %t", want, got)
+			}
+			if got, want := errors.Is(err, ErrAccessDenied), tc.wantAccessDenied; got != want {
+				t.Errorf("expected errors.Is(err, ErrAccessDenied) to be %t, got %t", want, got)
+			}
+
+			// rate limited commits are dropped to be retried on the next run
+			if tc.wantRateLimited {
+				if got := processCommit(ctx, client, nil, nil, nil, defaultConfig, &Commit{
+					Organization: "test-org",
+					Repository:   "test-repository",
+					SHA:          "12345678",
+				}); got != nil {
+					t.Errorf("processCommit: expected rate limited commit to be dropped, got %+v", got)
+				}
+			}
+
+			// commits of inaccessible repositories are recorded rather than
+			// retried forever
+			if tc.wantAccessDenied {
+				got := processCommit(ctx, client, nil, nil, nil, defaultConfig, &Commit{
+					Organization: "test-org",
+					Repository:   "test-repository",
+					SHA:          "12345678",
+				})
+				if got == nil || got.ApprovalStatus != AccessDeniedStatus {
+					t.Errorf("processCommit: expected commit with approval status %s, got %+v", AccessDeniedStatus, got)
+				}
+			}
+		})
+	}
+}
+
 func TestGetPullRequest(t *testing.T) {
 	t.Parallel()
 	cases := []struct {
@@ -1115,7 +1701,7 @@ func TestGetPullRequest(t *testing.T) {
 
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
-			got := getApprovingPullRequest(tc.pullRequests)
+			got := getApprovingPullRequest(tc.pullRequests, &approvalPolicy{requiredApprovals: 1})
 			if diff := cmp.Diff(got, tc.want); diff != "" {
 				t.Errorf("getCommitHTMLURL unexpected result (-got,+want):\n%s", diff)
 			}
@@ -1123,12 +1709,55 @@ func TestGetPullRequest(t *testing.T) {
 	}
 }
 
+func TestNewGitHubGraphQLClient_EnterpriseURL(t *testing.T) {
+	t.Parallel()
+
+	var gotPath, gotAuth string
+	fakeGitHub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		fmt.Fprint(w, `{
+          "data": {
+            "repository": {
+              "defaultBranchRef": {
+                "name": "main"
+              },
+              "object": {
+                "associatedPullRequests": {
+                  "nodes": [],
+                  "pageInfo": {
+                    "hasNextPage": false
+                  },
+                  "totalCount": 0
+                }
+              }
+            }
+          }
+        }`)
+	}))
+	t.Cleanup(fakeGitHub.Close)
+
+	ctx := context.Background()
+	client := NewGitHubGraphQLClient(ctx, "fake-token", fakeGitHub.URL+"/api/graphql", nil, nil)
+	if _, err := GetPullRequestsTargetingDefaultBranch(ctx, client, "test-org", "test-repository", "12345678"); err != nil {
+		t.Fatalf("GetPullRequestsTargetingDefaultBranch failed: %v", err)
+	}
+
+	if got, want := gotPath, "/api/graphql"; got != want {
+		t.Errorf("expected request to %q, got %q", want, got)
+	}
+	if got, want := gotAuth, "Bearer fake-token"; got != want {
+		t.Errorf("expected authorization header %q, got %q", want, got)
+	}
+}
+
 func TestGetCommitHtmlUrl(t *testing.T) {
 	t.Parallel()
 	cases := []struct {
-		name   string
-		commit *Commit
-		want   string
+		name       string
+		graphQLURL string
+		commit     *Commit
+		want       string
 	}{
 		{
 			name: "url_template_populated_correctly",
@@ -1139,13 +1768,23 @@ func TestGetCommitHtmlUrl(t *testing.T) {
 			},
 			want: "https://github.com/test-org/test-repo/commit/123456",
 		},
+		{
+			name:       "enterprise_server",
+			graphQLURL: "https://ghe.example.com/api/graphql",
+			commit: &Commit{
+				Organization: "test-org",
+				Repository:   "test-repo",
+				SHA:          "123456",
+			},
+			want: "https://ghe.example.com/test-org/test-repo/commit/123456",
+		},
 	}
 	for _, tc := range cases {
 		tc := tc
 
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
-			got := getCommitHTMLURL(tc.commit)
+			got := getCommitHTMLURL(tc.graphQLURL, tc.commit)
 			if diff := cmp.Diff(got, tc.want); diff != "" {
 				t.Errorf("getCommitHTMLURL unexpected result (-got,+want):\n%s", diff)
 			}
@@ -1153,54 +1792,560 @@ func TestGetCommitHtmlUrl(t *testing.T) {
 	}
 }
 
-func TestProcessCommit(t *testing.T) {
+func TestGetApprovalStatus(t *testing.T) {
 	t.Parallel()
 	cases := []struct {
-		name                string
-		token               string
-		graphQlResponseCode int
-		graphQLResponse     string
-		cfg                 *Config
-		commit              *Commit
-		want                *CommitReviewStatus
+		name              string
+		requiredApprovals int
+		reviews           []*Review
+		want              string
 	}{
 		{
-			name:                "converts_commit_to_commit_review_status_correctly",
-			token:               "fake-token",
-			cfg:                 defaultConfig,
-			graphQlResponseCode: 200,
-			graphQLResponse: `{
+			name:              "no_reviews",
+			requiredApprovals: 1,
+			want:              GithubPRReviewRequired,
+		},
+		{
+			name:              "approved",
+			requiredApprovals: 1,
+			reviews: []*Review{
+				newTestReview("reviewer-a", GithubPRApproved),
+			},
+			want: GithubPRApproved,
+		},
+		{
+			name:              "changes_requested",
+			requiredApprovals: 1,
+			reviews: []*Review{
+				newTestReview("reviewer-a", GithubPRChangesRequested),
+			},
+			want: GithubPRChangesRequested,
+		},
+		{
+			name:              "dismissed_approval_without_reapproval",
+			requiredApprovals: 1,
+			reviews: []*Review{
+				newTestReview("reviewer-a", GithubPRApproved),
+				newTestReview("reviewer-a", GithubPRDismissed),
+			},
+			want: GithubPRReviewRequired,
+		},
+		{
+			name:              "dismissed_approval_followed_by_comment",
+			requiredApprovals: 1,
+			reviews: []*Review{
+				newTestReview("reviewer-a", GithubPRDismissed),
+				newTestReview("reviewer-a", "COMMENTED"),
+			},
+			want: GithubPRReviewRequired,
+		},
+		{
+			name:              "dismissed_approval_followed_by_reapproval",
+			requiredApprovals: 1,
+			reviews: []*Review{
+				newTestReview("reviewer-a", GithubPRDismissed),
+				newTestReview("reviewer-a", GithubPRApproved),
+			},
+			want: GithubPRApproved,
+		},
+		{
+			name:              "dismissed_approval_with_approval_from_other_reviewer",
+			requiredApprovals: 1,
+			reviews: []*Review{
+				newTestReview("reviewer-a", GithubPRDismissed),
+				newTestReview("reviewer-b", GithubPRApproved),
+			},
+			want: GithubPRApproved,
+		},
+		{
+			name:              "approval_followed_by_changes_requested",
+			requiredApprovals: 1,
+			reviews: []*Review{
+				newTestReview("reviewer-a", GithubPRApproved),
+				newTestReview("reviewer-a", GithubPRChangesRequested),
+			},
+			want: GithubPRChangesRequested,
+		},
+		{
+			name:              "single_approval_when_two_required",
+			requiredApprovals: 2,
+			reviews: []*Review{
+				newTestReview("reviewer-a", GithubPRApproved),
+				newTestReview("reviewer-a", GithubPRApproved),
+			},
+			want: GithubPRReviewRequired,
+		},
+		{
+			name:              "two_approvals_when_two_required",
+			requiredApprovals: 2,
+			reviews: []*Review{
+				newTestReview("reviewer-a", GithubPRApproved),
+				newTestReview("reviewer-b", GithubPRApproved),
+			},
+			want: GithubPRApproved,
+		},
+		{
+			name:              "changes_requested_when_approvals_insufficient",
+			requiredApprovals: 2,
+			reviews: []*Review{
+				newTestReview("reviewer-a", GithubPRApproved),
+				newTestReview("reviewer-b", GithubPRChangesRequested),
+			},
+			want: GithubPRChangesRequested,
+		},
+		{
+			name:              "no_reviews_when_none_required",
+			requiredApprovals: 0,
+			want:              GithubPRApproved,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			pullRequest := &PullRequest{}
+			pullRequest.Reviews.Nodes = tc.reviews
+			got := getApprovalStatus(pullRequest, &approvalPolicy{requiredApprovals: tc.requiredApprovals})
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("getApprovalStatus unexpected result (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetApprovalStatus_BotReviewers(t *testing.T) {
+	t.Parallel()
+
+	excludeBots := &approvalPolicy{
+		requiredApprovals: 1,
+		excludedBots:      regexp.MustCompile(`\[bot\]$`),
+	}
+	includeBots := &approvalPolicy{
+		requiredApprovals: 1,
+	}
+
+	cases := []struct {
+		name            string
+		policy          *approvalPolicy
+		reviews         []*Review
+		wantStatus      string
+		wantBotApproved bool
+	}{
+		{
+			name:   "bot_approval_excluded",
+			policy: excludeBots,
+			reviews: []*Review{
+				newTestReview("approver[bot]", GithubPRApproved),
+			},
+			wantStatus:      GithubPRReviewRequired,
+			wantBotApproved: true,
+		},
+		{
+			name:   "bot_and_human_approval",
+			policy: excludeBots,
+			reviews: []*Review{
+				newTestReview("approver[bot]", GithubPRApproved),
+				newTestReview("reviewer-a", GithubPRApproved),
+			},
+			wantStatus:      GithubPRApproved,
+			wantBotApproved: true,
+		},
+		{
+			name:   "human_approval_only",
+			policy: excludeBots,
+			reviews: []*Review{
+				newTestReview("reviewer-a", GithubPRApproved),
+			},
+			wantStatus:      GithubPRApproved,
+			wantBotApproved: false,
+		},
+		{
+			name:   "bot_approval_counted_when_not_excluded",
+			policy: includeBots,
+			reviews: []*Review{
+				newTestReview("approver[bot]", GithubPRApproved),
+			},
+			wantStatus:      GithubPRApproved,
+			wantBotApproved: false,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			pullRequest := &PullRequest{}
+			pullRequest.Reviews.Nodes = tc.reviews
+			if diff := cmp.Diff(getApprovalStatus(pullRequest, tc.policy), tc.wantStatus); diff != "" {
+				t.Errorf("getApprovalStatus unexpected result (-got,+want):\n%s", diff)
+			}
+			if got := getBotApproved(pullRequest, tc.policy); got != tc.wantBotApproved {
+				t.Errorf("getBotApproved expected %t, got %t", tc.wantBotApproved, got)
+			}
+		})
+	}
+}
+
+func TestProcessCommit(t *testing.T) {
+	t.Parallel()
+
+	approveMergedConfig := *defaultConfig
+	approveMergedConfig.ApproveMergedWithoutReviews = true
+	recordAllApprovingConfig := *defaultConfig
+	recordAllApprovingConfig.RecordAllApprovingPullRequests = true
+
+	// a cherry-picked commit is associated with several approved pull requests
+	multipleApprovingResponse := `{
            "data": {
              "repository": {
+               "defaultBranchRef": {
+                 "name": "main"
+               },
+               "object": {
+                 "associatedPullRequests": {
+                   "nodes": [
+                     {
+                       "baseRefName": "main",
+                       "fullDatabaseId": "2",
+                       "number": 48,
+                       "reviews": {
+                         "nodes": [
+                           {
+                             "state": "CHANGES_REQUESTED"
+                           }
+                         ],
+                         "pageInfo": {
+                           "hasNextPage": false
+                         }
+                       },
+                       "url": "https://github.com/my-org/my-repo/pull/48"
+                     },
+                     {
+                       "baseRefName": "main",
+                       "fullDatabaseId": "3",
+                       "number": 52,
+                       "reviews": {
+                         "nodes": [
+                           {
+                             "state": "APPROVED"
+                           }
+                         ],
+                         "pageInfo": {
+                           "hasNextPage": false
+                         }
+                       },
+                       "url": "https://github.com/my-org/my-repo/pull/52"
+                     },
+                     {
+                       "baseRefName": "main",
+                       "fullDatabaseId": "4",
+                       "number": 57,
+                       "reviews": {
+                         "nodes": [
+                           {
+                             "state": "APPROVED"
+                           }
+                         ],
+                         "pageInfo": {
+                           "hasNextPage": false
+                         }
+                       },
+                       "url": "https://github.com/my-org/my-repo/pull/57"
+                     }
+                   ],
+                   "pageInfo": {
+                     "hasNextPage": false
+                   },
+                   "totalCount": 3
+                 }
+               }
+             }
+           }
+         }`
+	cases := []struct {
+		name                string
+		token               string
+		graphQlResponseCode int
+		graphQLResponse     string
+		cfg                 *Config
+		commit              *Commit
+		want                *CommitReviewStatus
+	}{
+		{
+			name:                "converts_commit_to_commit_review_status_correctly",
+			token:               "fake-token",
+			cfg:                 defaultConfig,
+			graphQlResponseCode: 200,
+			graphQLResponse: `{
+           "data": {
+             "repository": {
+               "defaultBranchRef": {
+                 "name": "main"
+               },
+               "object": {
+                 "associatedPullRequests": {
+                   "nodes": [
+                     {
+                       "baseRefName": "main",
+                       "fullDatabaseId": "8294967296",
+                       "number": 48,
+                       "reviews": {
+                         "nodes": [
+                           {
+                             "state": "APPROVED"
+                           }
+                         ],
+                         "pageInfo": {
+                           "hasNextPage": false,
+                           "hasPreviousPage": false,
+                           "endCursor": "",
+                           "startCursor": ""
+                         }
+                       },
+                       "url": "https://github.com/my-org/my-repo/pull/48"
+                     }
+                   ],
+                   "pageInfo": {
+                     "endCursor": "FG",
+                     "hasNextPage": false,
+                     "hasPreviousPage": false,
+                     "startCursor": ""
+                   },
+                   "totalCount": 1
+                 }
+               }
+             }
+           }
+         }`,
+			commit: &Commit{
+				Author:       "test-author",
+				Organization: "test-org",
+				Repository:   "test-repository",
+				Branch:       "main",
+				Visibility:   "public",
+				SHA:          "12345678",
+				Timestamp:    time.Date(2023, 10, 6, 14, 22, 33, 0, time.UTC),
+			},
+			want: &CommitReviewStatus{
+				Commit: &Commit{
+					Author:       "test-author",
+					Organization: "test-org",
+					Repository:   "test-repository",
+					Branch:       "main",
+					Visibility:   "public",
+					SHA:          "12345678",
+					Timestamp:    time.Date(2023, 10, 6, 14, 22, 33, 0, time.UTC),
+				},
+				HTMLURL:            "https://github.com/test-org/test-repository/commit/12345678",
+				PullRequestID:      8294967296,
+				PullRequestNumber:  48,
+				PullRequestHTMLURL: "https://github.com/my-org/my-repo/pull/48",
+				ApprovalStatus:     GithubPRApproved,
+				BreakGlassURLs:     []string{},
+			},
+		},
+		{
+			name:                "commit_considered_approved_as_long_as_one_pr_approves",
+			token:               "fake-token",
+			cfg:                 defaultConfig,
+			graphQlResponseCode: 200,
+			graphQLResponse: `{
+           "data": {
+             "repository": {
+               "defaultBranchRef": {
+                 "name": "main"
+               },
+               "object": {
+                 "associatedPullRequests": {
+                   "nodes": [
+                     {
+                       "baseRefName": "main",
+                       "fullDatabaseId": "2",
+                       "number": 48,
+                       "reviews": {
+                         "nodes": [
+                           {
+                             "state": "CHANGES_REQUESTED"
+                           }
+                         ],
+                         "pageInfo": {
+                           "hasNextPage": false,
+                           "hasPreviousPage": false,
+                           "endCursor": "",
+                           "startCursor": ""
+                         }
+                       },
+                       "url": "https://github.com/my-org/my-repo/pull/48"
+                     },
+                     {
+                       "baseRefName": "main",
+                       "fullDatabaseId": "3",
+                       "number": 52,
+                       "reviews": {
+                         "nodes": [
+                           {
+                             "state": "APPROVED"
+                           }
+                         ],
+                         "pageInfo": {
+                           "hasNextPage": false,
+                           "hasPreviousPage": false,
+                           "endCursor": "",
+                           "startCursor": ""
+                         }
+                       },
+                       "url": "https://github.com/my-org/my-repo/pull/52"
+                     }
+                   ],
+                   "pageInfo": {
+                     "endCursor": "FG",
+                     "hasNextPage": false,
+                     "hasPreviousPage": false,
+                     "startCursor": ""
+                   },
+                   "totalCount": 1
+                 }
+               }
+             }
+           }
+         }`,
+			commit: &Commit{
+				Author:       "test-author",
+				Organization: "test-org",
+				Repository:   "test-repository",
+				Branch:       "main",
+				Visibility:   "public",
+				SHA:          "12345678",
+				Timestamp:    time.Date(2023, 10, 6, 14, 22, 33, 0, time.UTC),
+			},
+			want: &CommitReviewStatus{
+				Commit: &Commit{
+					Author:       "test-author",
+					Organization: "test-org",
+					Repository:   "test-repository",
+					Branch:       "main",
+					Visibility:   "public",
+					SHA:          "12345678",
+					Timestamp:    time.Date(2023, 10, 6, 14, 22, 33, 0, time.UTC),
+				},
+				HTMLURL:            "https://github.com/test-org/test-repository/commit/12345678",
+				PullRequestID:      3,
+				PullRequestNumber:  52,
+				PullRequestHTMLURL: "https://github.com/my-org/my-repo/pull/52",
+				ApprovalStatus:     GithubPRApproved,
+				BreakGlassURLs:     []string{},
+			},
+		},
+		{
+			name:                "uses_first_pr_if_no_prs_approve",
+			token:               "fake-token",
+			cfg:                 defaultConfig,
+			graphQlResponseCode: 200,
+			graphQLResponse: `{
+           "data": {
+             "repository": {
+               "defaultBranchRef": {
+                 "name": "main"
+               },
+               "object": {
+                 "associatedPullRequests": {
+                   "nodes": [
+                     {
+                       "baseRefName": "main",
+                       "fullDatabaseId": "2",
+                       "number": 48,
+                       "reviews": {
+                         "nodes": [
+                           {
+                             "state": "CHANGES_REQUESTED"
+                           }
+                         ],
+                         "pageInfo": {
+                           "hasNextPage": false,
+                           "hasPreviousPage": false,
+                           "endCursor": "",
+                           "startCursor": ""
+                         }
+                       },
+                       "url": "https://github.com/my-org/my-repo/pull/48"
+                     },
+                     {
+                       "baseRefName": "main",
+                       "fullDatabaseId": "3",
+                       "number": 52,
+                       "reviews": {
+                         "nodes": [],
+                         "pageInfo": {
+                           "hasNextPage": false,
+                           "hasPreviousPage": false,
+                           "endCursor": "",
+                           "startCursor": ""
+                         }
+                       },
+                       "url": "https://github.com/my-org/my-repo/pull/52"
+                     }
+                   ],
+                   "pageInfo": {
+                     "endCursor": "FG",
+                     "hasNextPage": false,
+                     "hasPreviousPage": false,
+                     "startCursor": ""
+                   },
+                   "totalCount": 1
+                 }
+               }
+             }
+           }
+         }`,
+			commit: &Commit{
+				Author:       "test-author",
+				Organization: "test-org",
+				Repository:   "test-repository",
+				Branch:       "main",
+				Visibility:   "public",
+				SHA:          "12345678",
+				Timestamp:    time.Date(2023, 10, 6, 14, 22, 33, 0, time.UTC),
+			},
+			want: &CommitReviewStatus{
+				Commit: &Commit{
+					Author:       "test-author",
+					Organization: "test-org",
+					Repository:   "test-repository",
+					Branch:       "main",
+					Visibility:   "public",
+					SHA:          "12345678",
+					Timestamp:    time.Date(2023, 10, 6, 14, 22, 33, 0, time.UTC),
+				},
+				HTMLURL:            "https://github.com/test-org/test-repository/commit/12345678",
+				PullRequestID:      2,
+				PullRequestNumber:  48,
+				PullRequestHTMLURL: "https://github.com/my-org/my-repo/pull/48",
+				ApprovalStatus:     "CHANGES_REQUESTED",
+				BreakGlassURLs:     []string{},
+			},
+		},
+		{
+			name:                "default_approval_status_assigned_when_no_associated_prs",
+			cfg:                 defaultConfig,
+			token:               "fake-token",
+			graphQlResponseCode: 200,
+			graphQLResponse: `{
+           "data": {
+             "repository": {
+               "defaultBranchRef": {
+                 "name": "main"
+               },
                "object": {
                  "associatedPullRequests": {
-                   "nodes": [
-                     {
-                       "fullDatabaseId": "8294967296",
-                       "number": 48,
-                       "reviews": {
-                         "nodes": [
-                           {
-                             "state": "APPROVED"
-                           }
-                         ],
-                         "pageInfo": {
-                           "hasNextPage": false,
-                           "hasPreviousPage": false,
-                           "endCursor": "",
-                           "startCursor": ""
-                         }
-                       },
-                       "url": "https://github.com/my-org/my-repo/pull/48"
-                     }
-                   ],
+                   "nodes": [],
                    "pageInfo": {
                      "endCursor": "FG",
                      "hasNextPage": false,
                      "hasPreviousPage": false,
                      "startCursor": ""
                    },
-                   "totalCount": 1
+                   "totalCount": 0
                  }
                }
              }
@@ -1225,34 +2370,32 @@ func TestProcessCommit(t *testing.T) {
 					SHA:          "12345678",
 					Timestamp:    time.Date(2023, 10, 6, 14, 22, 33, 0, time.UTC),
 				},
-				HTMLURL:            "https://github.com/test-org/test-repository/commit/12345678",
-				PullRequestID:      8294967296,
-				PullRequestNumber:  48,
-				PullRequestHTMLURL: "https://github.com/my-org/my-repo/pull/48",
-				ApprovalStatus:     GithubPRApproved,
-				BreakGlassURLs:     []string{},
+				HTMLURL:        "https://github.com/test-org/test-repository/commit/12345678",
+				ApprovalStatus: DefaultApprovalStatus,
+				BreakGlassURLs: []string{},
 			},
 		},
 		{
-			name:                "commit_considered_approved_as_long_as_one_pr_approves",
+			name:                "merged_without_reviews_approved_by_merge",
 			token:               "fake-token",
-			cfg:                 defaultConfig,
+			cfg:                 &approveMergedConfig,
 			graphQlResponseCode: 200,
 			graphQLResponse: `{
            "data": {
              "repository": {
+               "defaultBranchRef": {
+                 "name": "main"
+               },
                "object": {
                  "associatedPullRequests": {
                    "nodes": [
                      {
-                       "fullDatabaseId": "2",
+                       "baseRefName": "main",
+                       "fullDatabaseId": "8294967296",
+                       "merged": true,
                        "number": 48,
                        "reviews": {
-                         "nodes": [
-                           {
-                             "state": "CHANGES_REQUESTED"
-                           }
-                         ],
+                         "nodes": [],
                          "pageInfo": {
                            "hasNextPage": false,
                            "hasPreviousPage": false,
@@ -1261,24 +2404,6 @@ func TestProcessCommit(t *testing.T) {
                          }
                        },
                        "url": "https://github.com/my-org/my-repo/pull/48"
-                     },
-                     {
-                       "fullDatabaseId": "3",
-                       "number": 52,
-                       "reviews": {
-                         "nodes": [
-                           {
-                             "state": "APPROVED"
-                           }
-                         ],
-                         "pageInfo": {
-                           "hasNextPage": false,
-                           "hasPreviousPage": false,
-                           "endCursor": "",
-                           "startCursor": ""
-                         }
-                       },
-                       "url": "https://github.com/my-org/my-repo/pull/52"
                      }
                    ],
                    "pageInfo": {
@@ -1313,45 +2438,32 @@ func TestProcessCommit(t *testing.T) {
 					Timestamp:    time.Date(2023, 10, 6, 14, 22, 33, 0, time.UTC),
 				},
 				HTMLURL:            "https://github.com/test-org/test-repository/commit/12345678",
-				PullRequestID:      3,
-				PullRequestNumber:  52,
-				PullRequestHTMLURL: "https://github.com/my-org/my-repo/pull/52",
-				ApprovalStatus:     GithubPRApproved,
+				PullRequestID:      8294967296,
+				PullRequestNumber:  48,
+				PullRequestHTMLURL: "https://github.com/my-org/my-repo/pull/48",
+				ApprovalStatus:     ApprovedByMergeStatus,
 				BreakGlassURLs:     []string{},
 			},
 		},
 		{
-			name:                "uses_first_pr_if_no_prs_approve",
+			name:                "open_without_reviews_requires_review",
 			token:               "fake-token",
-			cfg:                 defaultConfig,
+			cfg:                 &approveMergedConfig,
 			graphQlResponseCode: 200,
 			graphQLResponse: `{
            "data": {
              "repository": {
+               "defaultBranchRef": {
+                 "name": "main"
+               },
                "object": {
                  "associatedPullRequests": {
                    "nodes": [
                      {
-                       "fullDatabaseId": "2",
+                       "baseRefName": "main",
+                       "fullDatabaseId": "8294967296",
+                       "merged": false,
                        "number": 48,
-                       "reviews": {
-                         "nodes": [
-                           {
-                             "state": "CHANGES_REQUESTED"
-                           }
-                         ],
-                         "pageInfo": {
-                           "hasNextPage": false,
-                           "hasPreviousPage": false,
-                           "endCursor": "",
-                           "startCursor": ""
-                         }
-                       },
-                       "url": "https://github.com/my-org/my-repo/pull/48"
-                     },
-                     {
-                       "fullDatabaseId": "3",
-                       "number": 52,
                        "reviews": {
                          "nodes": [],
                          "pageInfo": {
@@ -1361,7 +2473,7 @@ func TestProcessCommit(t *testing.T) {
                            "startCursor": ""
                          }
                        },
-                       "url": "https://github.com/my-org/my-repo/pull/52"
+                       "url": "https://github.com/my-org/my-repo/pull/48"
                      }
                    ],
                    "pageInfo": {
@@ -1396,31 +2508,51 @@ func TestProcessCommit(t *testing.T) {
 					Timestamp:    time.Date(2023, 10, 6, 14, 22, 33, 0, time.UTC),
 				},
 				HTMLURL:            "https://github.com/test-org/test-repository/commit/12345678",
-				PullRequestID:      2,
+				PullRequestID:      8294967296,
 				PullRequestNumber:  48,
 				PullRequestHTMLURL: "https://github.com/my-org/my-repo/pull/48",
-				ApprovalStatus:     "CHANGES_REQUESTED",
+				ApprovalStatus:     GithubPRReviewRequired,
 				BreakGlassURLs:     []string{},
 			},
 		},
 		{
-			name:                "default_approval_status_assigned_when_no_associated_prs",
-			cfg:                 defaultConfig,
+			name:                "merged_without_reviews_requires_review_when_disabled",
 			token:               "fake-token",
+			cfg:                 defaultConfig,
 			graphQlResponseCode: 200,
 			graphQLResponse: `{
            "data": {
              "repository": {
+               "defaultBranchRef": {
+                 "name": "main"
+               },
                "object": {
                  "associatedPullRequests": {
-                   "nodes": [],
+                   "nodes": [
+                     {
+                       "baseRefName": "main",
+                       "fullDatabaseId": "8294967296",
+                       "merged": true,
+                       "number": 48,
+                       "reviews": {
+                         "nodes": [],
+                         "pageInfo": {
+                           "hasNextPage": false,
+                           "hasPreviousPage": false,
+                           "endCursor": "",
+                           "startCursor": ""
+                         }
+                       },
+                       "url": "https://github.com/my-org/my-repo/pull/48"
+                     }
+                   ],
                    "pageInfo": {
                      "endCursor": "FG",
                      "hasNextPage": false,
                      "hasPreviousPage": false,
                      "startCursor": ""
                    },
-                   "totalCount": 0
+                   "totalCount": 1
                  }
                }
              }
@@ -1445,9 +2577,12 @@ func TestProcessCommit(t *testing.T) {
 					SHA:          "12345678",
 					Timestamp:    time.Date(2023, 10, 6, 14, 22, 33, 0, time.UTC),
 				},
-				HTMLURL:        "https://github.com/test-org/test-repository/commit/12345678",
-				ApprovalStatus: DefaultApprovalStatus,
-				BreakGlassURLs: []string{},
+				HTMLURL:            "https://github.com/test-org/test-repository/commit/12345678",
+				PullRequestID:      8294967296,
+				PullRequestNumber:  48,
+				PullRequestHTMLURL: "https://github.com/my-org/my-repo/pull/48",
+				ApprovalStatus:     GithubPRReviewRequired,
+				BreakGlassURLs:     []string{},
 			},
 		},
 		{
@@ -1502,6 +2637,106 @@ func TestProcessCommit(t *testing.T) {
 				Note:           "Could not resolve to a Repository with the name 'test-repository'",
 			},
 		},
+		{
+			name:                "records_only_first_approving_pr_by_default",
+			token:               "fake-token",
+			cfg:                 defaultConfig,
+			graphQlResponseCode: 200,
+			graphQLResponse:     multipleApprovingResponse,
+			commit: &Commit{
+				Organization: "test-org",
+				Repository:   "test-repository",
+				SHA:          "12345678",
+			},
+			want: &CommitReviewStatus{
+				Commit: &Commit{
+					Organization: "test-org",
+					Repository:   "test-repository",
+					SHA:          "12345678",
+				},
+				HTMLURL:            "https://github.com/test-org/test-repository/commit/12345678",
+				PullRequestID:      3,
+				PullRequestNumber:  52,
+				PullRequestHTMLURL: "https://github.com/my-org/my-repo/pull/52",
+				ApprovalStatus:     GithubPRApproved,
+				BreakGlassURLs:     []string{},
+			},
+		},
+		{
+			name:                "records_all_approving_prs_when_enabled",
+			token:               "fake-token",
+			cfg:                 &recordAllApprovingConfig,
+			graphQlResponseCode: 200,
+			graphQLResponse:     multipleApprovingResponse,
+			commit: &Commit{
+				Organization: "test-org",
+				Repository:   "test-repository",
+				SHA:          "12345678",
+			},
+			want: &CommitReviewStatus{
+				Commit: &Commit{
+					Organization: "test-org",
+					Repository:   "test-repository",
+					SHA:          "12345678",
+				},
+				HTMLURL:            "https://github.com/test-org/test-repository/commit/12345678",
+				PullRequestID:      3,
+				PullRequestNumber:  52,
+				PullRequestHTMLURL: "https://github.com/my-org/my-repo/pull/52",
+				ApprovalStatus:     GithubPRApproved,
+				BreakGlassURLs:     []string{},
+				ApprovingPullRequests: []*ApprovingPullRequest{
+					{ID: 3, Number: 52, HTMLURL: "https://github.com/my-org/my-repo/pull/52"},
+					{ID: 4, Number: 57, HTMLURL: "https://github.com/my-org/my-repo/pull/57"},
+				},
+			},
+		},
+		{
+			name:                "records_no_approving_prs_when_enabled_and_none_approve",
+			token:               "fake-token",
+			cfg:                 &recordAllApprovingConfig,
+			graphQlResponseCode: 200,
+			graphQLResponse:     `{"data": {"repository": {"defaultBranchRef": {"name": "main"}, "object": {"associatedPullRequests": {"nodes": [], "pageInfo": {"hasNextPage": false}, "totalCount": 0}}}}}`,
+			commit: &Commit{
+				Organization: "test-org",
+				Repository:   "test-repository",
+				SHA:          "12345678",
+			},
+			want: &CommitReviewStatus{
+				Commit: &Commit{
+					Organization: "test-org",
+					Repository:   "test-repository",
+					SHA:          "12345678",
+				},
+				HTMLURL:               "https://github.com/test-org/test-repository/commit/12345678",
+				ApprovalStatus:        DefaultApprovalStatus,
+				BreakGlassURLs:        []string{},
+				ApprovingPullRequests: []*ApprovingPullRequest{},
+			},
+		},
+		{
+			name:                "note_when_repository_has_no_default_branch",
+			token:               "fake-token",
+			cfg:                 defaultConfig,
+			graphQlResponseCode: 200,
+			graphQLResponse:     `{"data": {"repository": {"defaultBranchRef": null, "object": null}}}`,
+			commit: &Commit{
+				Organization: "test-org",
+				Repository:   "empty-repository",
+				SHA:          "12345678",
+			},
+			want: &CommitReviewStatus{
+				Commit: &Commit{
+					Organization: "test-org",
+					Repository:   "empty-repository",
+					SHA:          "12345678",
+				},
+				HTMLURL:        "https://github.com/test-org/empty-repository/commit/12345678",
+				ApprovalStatus: DefaultApprovalStatus,
+				BreakGlassURLs: []string{},
+				Note:           "repository has no default branch",
+			},
+		},
 	}
 	for _, tc := range cases {
 		tc := tc
@@ -1524,7 +2759,7 @@ func TestProcessCommit(t *testing.T) {
 			ctx := context.Background()
 			httpClient := oauth2.NewClient(ctx, src)
 			client := githubv4.NewEnterpriseClient(fakeGitHub.URL, httpClient)
-			got := processCommit(ctx, client, tc.commit)
+			got := processCommit(ctx, client, nil, nil, nil, tc.cfg, tc.commit)
 			if got != nil {
 				if diff := cmp.Diff(got, tc.want); diff != "" {
 					t.Errorf("processCommit: unexpected result (-got,+want):\n%s", diff)
@@ -1672,14 +2907,122 @@ func TestProcessReviewStatus(t *testing.T) {
 	}
 }
 
+func TestProcessReviewStatus_BreakGlassPagination(t *testing.T) {
+	t.Parallel()
+
+	const pageSize = 3
+
+	cases := []struct {
+		name          string
+		issueCount    int
+		maxIssues     int
+		wantURLCount  int
+		wantPageCalls int
+	}{
+		{
+			name:          "all_pages_collected",
+			issueCount:    7,
+			maxIssues:     1000,
+			wantURLCount:  7,
+			wantPageCalls: 3,
+		},
+		{
+			name:          "last_page_full",
+			issueCount:    6,
+			maxIssues:     1000,
+			wantURLCount:  6,
+			wantPageCalls: 3,
+		},
+		{
+			name:          "truncated_at_max_issues",
+			issueCount:    7,
+			maxIssues:     5,
+			wantURLCount:  5,
+			wantPageCalls: 2,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			issues := make([]*breakGlassIssue, 0, tc.issueCount)
+			for i := 0; i < tc.issueCount; i++ {
+				issues = append(issues, &breakGlassIssue{
+					HTMLURL: fmt.Sprintf("https://github.com/test-org/breakglass/issues/%d", i),
+				})
+			}
+
+			var pageCalls int
+			fetcher := &TestBreakGlassIssueFetcher{
+				pageSize: pageSize,
+				pageFetcher: func(ctx context.Context, author string, timestamp *time.Time, limit, offset int) ([]*breakGlassIssue, error) {
+					pageCalls++
+					if limit > pageSize {
+						t.Errorf("expected page of at most %d issues, got limit %d", pageSize, limit)
+					}
+					end := min(offset+limit, len(issues))
+					if offset > end {
+						return nil, nil
+					}
+					return issues[offset:end], nil
+				},
+			}
+
+			cfg := *defaultConfig
+			cfg.BreakGlassMaxIssues = tc.maxIssues
+			got := processReviewStatus(context.Background(), fetcher, &cfg, &CommitReviewStatus{
+				Commit: &Commit{
+					Author:    "test-author",
+					Timestamp: time.Date(2024, 7, 12, 10, 20, 17, 70, time.UTC),
+				},
+				ApprovalStatus: DefaultApprovalStatus,
+			})
+			if got == nil {
+				t.Fatalf("processReviewStatus: expected result, got nil")
+			}
+
+			want := make([]string, 0, tc.wantURLCount)
+			for _, issue := range issues[:tc.wantURLCount] {
+				want = append(want, issue.HTMLURL)
+			}
+			if diff := cmp.Diff(got.BreakGlassURLs, want); diff != "" {
+				t.Errorf("processReviewStatus: unexpected break glass urls (-got,+want):\n%s", diff)
+			}
+			if got, want := pageCalls, tc.wantPageCalls; got != want {
+				t.Errorf("expected %d page fetches, got %d", want, got)
+			}
+		})
+	}
+}
+
+// TestBreakGlassIssueFetcher returns the issues of fetcher, or when
+// pageFetcher is set, reads them in pages of pageSize like the BigQuery
+// fetcher does.
 type TestBreakGlassIssueFetcher struct {
-	fetcher func(ctx context.Context, author string, timestamp *time.Time) ([]*breakGlassIssue, error)
+	fetcher     func(ctx context.Context, author string, timestamp *time.Time) ([]*breakGlassIssue, error)
+	pageFetcher func(ctx context.Context, author string, timestamp *time.Time, limit, offset int) ([]*breakGlassIssue, error)
+	pageSize    int
 }
 
 func (tbgif *TestBreakGlassIssueFetcher) fetch(ctx context.Context, cfg *Config, author string, timestamp *time.Time) ([]*breakGlassIssue, error) {
+	if tbgif.pageFetcher != nil {
+		return fetchBreakGlassIssuePages(ctx, cfg.BreakGlassMaxIssues, tbgif.pageSize,
+			func(ctx context.Context, limit, offset int) ([]*breakGlassIssue, error) {
+				return tbgif.pageFetcher(ctx, author, timestamp, limit, offset)
+			})
+	}
 	return tbgif.fetcher(ctx, author, timestamp)
 }
 
+func newTestReview(login, state string) *Review {
+	review := &Review{State: githubv4.String(state)}
+	review.Author.Login = githubv4.String(login)
+	return review
+}
+
 func normalize(strings []string) []string {
 	normalized := make([]string, 0, len(strings))
 	for _, s := range strings {
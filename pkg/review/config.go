@@ -17,9 +17,16 @@ package review
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sethvargo/go-envconfig"
 
+	"github.com/abcxyz/github-metrics-aggregator/pkg/redact"
 	"github.com/abcxyz/pkg/cfgloader"
 	"github.com/abcxyz/pkg/cli"
 )
@@ -27,16 +34,66 @@ import (
 // Config defines the set of environment variables required
 // for running the artifact job.
 type Config struct {
-	GitHubAppID            string `env:"GITHUB_APP_ID,required"`             // The GitHub App ID
-	GitHubInstallID        string `env:"GITHUB_INSTALL_ID,required"`         // The provisioned GitHub App Installation reference
-	GitHubPrivateKeySecret string `env:"GITHUB_PRIVATE_KEY_SECRET,required"` // The secret name & version containing the GitHub App private key
+	GitHubAppID            string `env:"GITHUB_APP_ID,required"`                              // The GitHub App ID
+	GitHubInstallID        string `env:"GITHUB_INSTALL_ID,required"`                          // The provisioned GitHub App Installation reference
+	GitHubPrivateKeySecret string `env:"GITHUB_PRIVATE_KEY_SECRET,required" sensitive:"true"` // The secret name & version containing the GitHub App private key
+	GitHubGraphQLURL       string `env:"GITHUB_GRAPHQL_URL"`                                  // The GitHub Enterprise Server GraphQL endpoint, defaults to github.com
+
+	GraphQLMaxRetries   int           `env:"GRAPHQL_MAX_RETRIES,default=3"`    // The maximum number of retries of a GraphQL request that failed with a 5xx response
+	GraphQLRetryBackoff time.Duration `env:"GRAPHQL_RETRY_BACKOFF,default=1s"` // The backoff before the first retry of a GraphQL request, doubling with each retry
+
+	GraphQLHTTP2               bool          `env:"GRAPHQL_HTTP2,default=true"`                 // Whether HTTP/2 is attempted for GraphQL requests, falling back to HTTP/1.1 when not supported
+	GraphQLMaxIdleConnsPerHost int           `env:"GRAPHQL_MAX_IDLE_CONNS_PER_HOST,default=10"` // The maximum number of idle connections to GitHub kept for reuse by GraphQL requests
+	GraphQLMaxConnsPerHost     int           `env:"GRAPHQL_MAX_CONNS_PER_HOST,default=0"`       // The maximum number of connections to GitHub for GraphQL requests, unlimited when 0
+	GraphQLIdleConnTimeout     time.Duration `env:"GRAPHQL_IDLE_CONN_TIMEOUT,default=90s"`      // How long an idle connection to GitHub is kept for reuse by GraphQL requests
 
 	ProjectID string `env:"PROJECT_ID,required"` // The project id where the tables live
 	DatasetID string `env:"DATASET_ID,required"` // The dataset id where the tables live
 
 	PushEventsTableID         string `env:"PUSH_EVENTS_TABLE_ID,required"`          // The table_name of the push events table
 	CommitReviewStatusTableID string `env:"COMMIT_REVIEW_STATUS_TABLE_ID,required"` // The table_name of the commit_review_status table
-	IssuesTableID             string `env:"ISSUES_TABLE_ID,required"`               // The table_name of the issues table
+	IssuesTableID             string `env:"ISSUES_TABLE_ID"`                        // The table_name of the issues table, required for the bigquery break glass issue source
+
+	RequiredApprovals            int               `env:"REQUIRED_APPROVALS,default=1"`              // The number of distinct approving reviewers a pull request requires
+	RequireCodeOwnerApproval     bool              `env:"REQUIRE_CODE_OWNER_APPROVAL,default=false"` // Whether approvals must come from a code owner of the changed files
+	RepoRequiredApprovals        map[string]string `env:"REPO_REQUIRED_APPROVALS"`                   // Per-repository overrides of REQUIRED_APPROVALS keyed by repository name or glob pattern
+	RepoRequireCodeOwnerApproval map[string]string `env:"REPO_REQUIRE_CODE_OWNER_APPROVAL"`          // Per-repository overrides of REQUIRE_CODE_OWNER_APPROVAL keyed by repository name or glob pattern
+	ExcludeBotReviewers          bool              `env:"EXCLUDE_BOT_REVIEWERS,default=false"`       // Whether approvals from bots are excluded from the required approvals
+	BotReviewerPattern           string            `env:"BOT_REVIEWER_PATTERN,default=\\[bot\\]$"`   // The regular expression matching the logins of bot reviewers
+	RequiredDistinctTeams        int               `env:"REQUIRED_DISTINCT_TEAMS,default=0"`         // The number of distinct teams the approving reviewers must be members of
+
+	ApproveMergedWithoutReviews bool `env:"APPROVE_MERGED_WITHOUT_REVIEWS,default=false"` // Whether a merged pull request without reviews is considered approved by merge
+
+	BreakGlassConcurrency int           `env:"BREAK_GLASS_CONCURRENCY,default=10"` // The maximum number of concurrent break glass issue lookups
+	BreakGlassWindow      time.Duration `env:"BREAK_GLASS_WINDOW,default=0"`       // How long before or after a commit a break glass issue may be open and still cover it
+
+	BreakGlassMaxIssues int `env:"BREAK_GLASS_MAX_ISSUES,default=1000"` // The maximum number of break glass issues recorded for a single commit
+
+	BreakGlassIssueSource string `env:"BREAK_GLASS_ISSUE_SOURCE,default=bigquery"` // Where break glass issues are read from, bigquery or github
+	BreakGlassRepository  string `env:"BREAK_GLASS_REPOSITORY"`                    // The owner/name of the repository holding the labeled break glass issues, for the github source
+	BreakGlassLabel       string `env:"BREAK_GLASS_LABEL,default=breakglass"`      // The label of break glass issues, for the github source
+
+	IncludeBranchProtection bool `env:"INCLUDE_BRANCH_PROTECTION,default=false"` // Whether a snapshot of the default branch protection is recorded with each commit
+
+	RecordAllApprovingPullRequests bool `env:"RECORD_ALL_APPROVING_PULL_REQUESTS,default=false"` // Whether all approving pull requests of each commit are recorded, not only the first
+
+	UnapprovedCommitsTopicID string `env:"UNAPPROVED_COMMITS_TOPIC_ID"` // The pubsub topic that unapproved commits without a break glass issue are published to
+
+	CommitPullRequestsTableID string `env:"COMMIT_PULL_REQUESTS_TABLE_ID"` // The table_name of the table the pull request of each commit is written to
+
+	PullRequestSummaryTableID string `env:"PULL_REQUEST_SUMMARY_TABLE_ID"` // The table_name of the table a summary of the review statuses of each pull request is written to
+
+	PreflightRepositoryAccess bool `env:"PREFLIGHT_REPOSITORY_ACCESS,default=false"` // Whether access to each repository is checked once before processing its commits
+
+	ResolveRenamedRepositories bool `env:"RESOLVE_RENAMED_REPOSITORIES,default=false"` // Whether commits of repositories that can't be found are looked up under the current name of their renamed repository
+
+	SinkConcurrency int      `env:"SINK_CONCURRENCY,default=10"` // The maximum number of commit review statuses written to the sinks concurrently
+	OptionalSinks   []string `env:"OPTIONAL_SINKS"`              // The sinks whose failures don't hold back writing a commit review status to BigQuery
+
+	RawResponseSampleRate float64 `env:"RAW_RESPONSE_SAMPLE_RATE,default=0"` // The fraction of commits whose raw GraphQL responses are captured, between 0 and 1
+	RawResponseLocation   string  `env:"RAW_RESPONSE_LOCATION"`              // The gs:// URI prefix the raw GraphQL responses of sampled commits are written under
+
+	AddMissingColumns bool `env:"ADD_MISSING_COLUMNS,default=false"` // Whether to add the columns of fields the rows have but the BigQuery tables lack before writing them
 }
 
 // Validate validates the artifacts config after load.
@@ -52,6 +109,36 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf("GITHUB_PRIVATE_KEY_SECRET is required")
 	}
 
+	if cfg.GitHubGraphQLURL != "" {
+		u, err := url.Parse(cfg.GitHubGraphQLURL)
+		if err != nil {
+			return fmt.Errorf("failed to parse GITHUB_GRAPHQL_URL: %w", err)
+		}
+		if u.Scheme != "https" && u.Scheme != "http" {
+			return fmt.Errorf("GITHUB_GRAPHQL_URL must be an http(s) URL, got %q", cfg.GitHubGraphQLURL)
+		}
+	}
+
+	if cfg.GraphQLMaxRetries < 0 {
+		return fmt.Errorf("GRAPHQL_MAX_RETRIES must be non-negative, got %d", cfg.GraphQLMaxRetries)
+	}
+
+	if cfg.GraphQLMaxRetries > 0 && cfg.GraphQLRetryBackoff <= 0 {
+		return fmt.Errorf("GRAPHQL_RETRY_BACKOFF must be positive, got %s", cfg.GraphQLRetryBackoff)
+	}
+
+	if cfg.GraphQLMaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("GRAPHQL_MAX_IDLE_CONNS_PER_HOST must be non-negative, got %d", cfg.GraphQLMaxIdleConnsPerHost)
+	}
+
+	if cfg.GraphQLMaxConnsPerHost < 0 {
+		return fmt.Errorf("GRAPHQL_MAX_CONNS_PER_HOST must be non-negative, got %d", cfg.GraphQLMaxConnsPerHost)
+	}
+
+	if cfg.GraphQLIdleConnTimeout < 0 {
+		return fmt.Errorf("GRAPHQL_IDLE_CONN_TIMEOUT must be non-negative, got %s", cfg.GraphQLIdleConnTimeout)
+	}
+
 	if cfg.PushEventsTableID == "" {
 		return fmt.Errorf("PUSH_EVENTS_TABLE_ID is required")
 	}
@@ -60,8 +147,20 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf("COMMIT_REVIEW_STATUS_TABLE_ID is required")
 	}
 
-	if (cfg.IssuesTableID) == "" {
-		return fmt.Errorf("ISSUES_TABLE_ID is required")
+	switch cfg.BreakGlassIssueSource {
+	case "", BreakGlassIssueSourceBigQuery:
+		if (cfg.IssuesTableID) == "" {
+			return fmt.Errorf("ISSUES_TABLE_ID is required")
+		}
+	case BreakGlassIssueSourceGitHub:
+		if owner, name, ok := strings.Cut(cfg.BreakGlassRepository, "/"); !ok || owner == "" || name == "" {
+			return fmt.Errorf("BREAK_GLASS_REPOSITORY must be of the form owner/name, got %q", cfg.BreakGlassRepository)
+		}
+		if cfg.BreakGlassLabel == "" {
+			return fmt.Errorf("BREAK_GLASS_LABEL is required")
+		}
+	default:
+		return fmt.Errorf("BREAK_GLASS_ISSUE_SOURCE must be one of %q, got %q", breakGlassIssueSources, cfg.BreakGlassIssueSource)
 	}
 
 	if cfg.ProjectID == "" {
@@ -72,9 +171,73 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf("DATASET_ID is required")
 	}
 
+	if cfg.RequiredApprovals < 0 {
+		return fmt.Errorf("REQUIRED_APPROVALS must be non-negative, got %d", cfg.RequiredApprovals)
+	}
+
+	if cfg.RequiredDistinctTeams < 0 {
+		return fmt.Errorf("REQUIRED_DISTINCT_TEAMS must be non-negative, got %d", cfg.RequiredDistinctTeams)
+	}
+
+	if cfg.BreakGlassConcurrency <= 0 {
+		return fmt.Errorf("BREAK_GLASS_CONCURRENCY must be positive, got %d", cfg.BreakGlassConcurrency)
+	}
+
+	if cfg.BreakGlassWindow < 0 {
+		return fmt.Errorf("BREAK_GLASS_WINDOW must be non-negative, got %s", cfg.BreakGlassWindow)
+	}
+
+	if cfg.BreakGlassMaxIssues <= 0 {
+		return fmt.Errorf("BREAK_GLASS_MAX_ISSUES must be positive, got %d", cfg.BreakGlassMaxIssues)
+	}
+
+	if cfg.SinkConcurrency <= 0 {
+		return fmt.Errorf("SINK_CONCURRENCY must be positive, got %d", cfg.SinkConcurrency)
+	}
+
+	for _, name := range cfg.OptionalSinks {
+		if !slices.Contains(sinkNames, name) {
+			return fmt.Errorf("OPTIONAL_SINKS contains unknown sink %q, must be one of %q", name, sinkNames)
+		}
+	}
+
+	if cfg.RawResponseSampleRate < 0 || cfg.RawResponseSampleRate > 1 {
+		return fmt.Errorf("RAW_RESPONSE_SAMPLE_RATE must be between 0 and 1, got %v", cfg.RawResponseSampleRate)
+	}
+
+	if cfg.RawResponseSampleRate > 0 && !strings.HasPrefix(cfg.RawResponseLocation, "gs://") {
+		return fmt.Errorf("RAW_RESPONSE_LOCATION must be a gs:// URI when RAW_RESPONSE_SAMPLE_RATE is set, got %q", cfg.RawResponseLocation)
+	}
+
+	if cfg.ExcludeBotReviewers {
+		if _, err := regexp.Compile(cfg.BotReviewerPattern); err != nil {
+			return fmt.Errorf("invalid BOT_REVIEWER_PATTERN: %w", err)
+		}
+	}
+
+	if err := validateRepositoryOverrides(cfg.RepoRequiredApprovals, func(v string) error {
+		_, err := parseRequiredApprovals(v)
+		return err
+	}); err != nil {
+		return fmt.Errorf("invalid REPO_REQUIRED_APPROVALS: %w", err)
+	}
+
+	if err := validateRepositoryOverrides(cfg.RepoRequireCodeOwnerApproval, func(v string) error {
+		_, err := strconv.ParseBool(v)
+		return err //nolint:wrapcheck // Want passthrough
+	}); err != nil {
+		return fmt.Errorf("invalid REPO_REQUIRE_CODE_OWNER_APPROVAL: %w", err)
+	}
+
 	return nil
 }
 
+// LogConfig returns the config for logging, with the values of sensitive
+// fields redacted.
+func (cfg *Config) LogConfig() map[string]any {
+	return redact.Fields(cfg)
+}
+
 // NewConfig creates a new Config from environment variables.
 func NewConfig(ctx context.Context) (*Config, error) {
 	return newConfig(ctx, envconfig.OsLookuper())
@@ -113,6 +276,66 @@ func (cfg *Config) ToFlags(set *cli.FlagSet) *cli.FlagSet {
 		Usage:  `The secret name & version containing the GitHub App private key.`,
 	})
 
+	f.StringVar(&cli.StringVar{
+		Name:    "github-graphql-url",
+		Target:  &cfg.GitHubGraphQLURL,
+		EnvVar:  "GITHUB_GRAPHQL_URL",
+		Usage:   `The GraphQL endpoint of a GitHub Enterprise Server instance. Defaults to github.com when unset.`,
+		Example: "https://ghe.example.com/api/graphql",
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "graphql-max-retries",
+		Target:  &cfg.GraphQLMaxRetries,
+		EnvVar:  "GRAPHQL_MAX_RETRIES",
+		Default: 3,
+		Usage: `The maximum number of retries of a GitHub GraphQL request that failed ` +
+			`with a transient 5xx response. Set to 0 to not retry.`,
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "graphql-retry-backoff",
+		Target:  &cfg.GraphQLRetryBackoff,
+		EnvVar:  "GRAPHQL_RETRY_BACKOFF",
+		Default: time.Second,
+		Usage: `The backoff before the first retry of a failed GitHub GraphQL request, ` +
+			`it doubles with each retry. A Retry-After header of the response takes precedence.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "graphql-http2",
+		Target:  &cfg.GraphQLHTTP2,
+		EnvVar:  "GRAPHQL_HTTP2",
+		Default: true,
+		Usage: `Whether HTTP/2 is attempted for GitHub GraphQL requests, so that concurrent requests ` +
+			`share a connection. Requests fall back to HTTP/1.1 when GitHub or a proxy doesn't support it.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "graphql-max-idle-conns-per-host",
+		Target:  &cfg.GraphQLMaxIdleConnsPerHost,
+		EnvVar:  "GRAPHQL_MAX_IDLE_CONNS_PER_HOST",
+		Default: 10,
+		Usage:   `The maximum number of idle connections to GitHub kept for reuse by GraphQL requests.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "graphql-max-conns-per-host",
+		Target:  &cfg.GraphQLMaxConnsPerHost,
+		EnvVar:  "GRAPHQL_MAX_CONNS_PER_HOST",
+		Default: 0,
+		Usage: `The maximum number of connections to GitHub for GraphQL requests, ` +
+			`requests wait for a connection once reached. Set to 0 for no limit.`,
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "graphql-idle-conn-timeout",
+		Target:  &cfg.GraphQLIdleConnTimeout,
+		EnvVar:  "GRAPHQL_IDLE_CONN_TIMEOUT",
+		Default: 90 * time.Second,
+		Usage:   `How long an idle connection to GitHub is kept for reuse by GraphQL requests.`,
+	})
+
 	f.StringVar(&cli.StringVar{
 		Name:    "push-events-table-id",
 		Target:  &cfg.PushEventsTableID,
@@ -128,11 +351,20 @@ func (cfg *Config) ToFlags(set *cli.FlagSet) *cli.FlagSet {
 		Usage:  `The commit_review_status table ID within the dataset.`,
 	})
 
+	f.BoolVar(&cli.BoolVar{
+		Name:    "add-missing-columns",
+		Target:  &cfg.AddMissingColumns,
+		EnvVar:  "ADD_MISSING_COLUMNS",
+		Default: false,
+		Usage: `Whether to add the columns of fields the commit review statuses have but the BigQuery table ` +
+			`lacks, instead of failing the write until the table is altered manually.`,
+	})
+
 	f.StringVar(&cli.StringVar{
 		Name:   "issues-table-id",
 		Target: &cfg.IssuesTableID,
 		EnvVar: "ISSUES_TABLE_ID",
-		Usage:  `The issues table ID within the dataset.`,
+		Usage:  `The issues table ID within the dataset, required for the bigquery break glass issue source.`,
 	})
 
 	f.StringVar(&cli.StringVar{
@@ -149,5 +381,231 @@ func (cfg *Config) ToFlags(set *cli.FlagSet) *cli.FlagSet {
 		Usage:  `BigQuery dataset ID.`,
 	})
 
+	f.IntVar(&cli.IntVar{
+		Name:    "required-approvals",
+		Target:  &cfg.RequiredApprovals,
+		EnvVar:  "REQUIRED_APPROVALS",
+		Default: 1,
+		Usage:   `The number of distinct approving reviewers a pull request requires for its commits to be considered approved.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "require-code-owner-approval",
+		Target:  &cfg.RequireCodeOwnerApproval,
+		EnvVar:  "REQUIRE_CODE_OWNER_APPROVAL",
+		Default: false,
+		Usage:   `Whether an approving review must come from a code owner of the changed files, per the repository's CODEOWNERS file.`,
+	})
+
+	f.StringMapVar(&cli.StringMapVar{
+		Name:    "repo-required-approvals",
+		Target:  &cfg.RepoRequiredApprovals,
+		EnvVar:  "REPO_REQUIRED_APPROVALS",
+		Usage:   `Overrides the number of required approvals for repositories matching the given name or glob pattern. Can be repeated.`,
+		Example: "infra-*=2",
+	})
+
+	f.StringMapVar(&cli.StringMapVar{
+		Name:    "repo-require-code-owner-approval",
+		Target:  &cfg.RepoRequireCodeOwnerApproval,
+		EnvVar:  "REPO_REQUIRE_CODE_OWNER_APPROVAL",
+		Usage:   `Overrides whether code owner approval is required for repositories matching the given name or glob pattern. Can be repeated.`,
+		Example: "my-repo=true",
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "exclude-bot-reviewers",
+		Target:  &cfg.ExcludeBotReviewers,
+		EnvVar:  "EXCLUDE_BOT_REVIEWERS",
+		Default: false,
+		Usage:   `Whether approvals from bot reviewers are excluded from the required approvals. Bot approvals are recorded separately.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "bot-reviewer-pattern",
+		Target:  &cfg.BotReviewerPattern,
+		EnvVar:  "BOT_REVIEWER_PATTERN",
+		Default: `\[bot\]$`,
+		Usage:   `The regular expression matching the logins of bot reviewers.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "required-distinct-teams",
+		Target:  &cfg.RequiredDistinctTeams,
+		EnvVar:  "REQUIRED_DISTINCT_TEAMS",
+		Default: 0,
+		Usage:   `The number of distinct organization teams that must each be represented by a different approving reviewer. Reviewers that are not a member of any team do not count towards a team. Disabled when 0.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "approve-merged-without-reviews",
+		Target:  &cfg.ApproveMergedWithoutReviews,
+		EnvVar:  "APPROVE_MERGED_WITHOUT_REVIEWS",
+		Default: false,
+		Usage: `Whether a merged pull request without any recorded reviews is considered approved, ` +
+			`for repositories whose branch protection enforces the review at merge time. ` +
+			`Such commits are recorded with the APPROVED_BY_MERGE status.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "break-glass-concurrency",
+		Target:  &cfg.BreakGlassConcurrency,
+		EnvVar:  "BREAK_GLASS_CONCURRENCY",
+		Default: 10,
+		Usage:   `The maximum number of break glass issue lookups for unapproved commits that run concurrently against the break glass issue source.`,
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "break-glass-window",
+		Target:  &cfg.BreakGlassWindow,
+		EnvVar:  "BREAK_GLASS_WINDOW",
+		Default: 0,
+		Usage: `How long before its creation or after its closure a break glass issue ` +
+			`still covers an unapproved commit of its author. By default the issue ` +
+			`must be open at the time of the commit.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "break-glass-issue-source",
+		Target:  &cfg.BreakGlassIssueSource,
+		EnvVar:  "BREAK_GLASS_ISSUE_SOURCE",
+		Default: BreakGlassIssueSourceBigQuery,
+		Usage: `Where break glass issues are read from. "bigquery" reads them from the ` +
+			`issues table, "github" lists the issues of the break-glass-repository with the ` +
+			`break-glass-label from GitHub, for organizations that don't mirror issues into BigQuery.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "break-glass-repository",
+		Target:  &cfg.BreakGlassRepository,
+		EnvVar:  "BREAK_GLASS_REPOSITORY",
+		Example: "my-org/breakglass",
+		Usage: `The owner/name of the repository holding the break glass issues, required ` +
+			`for the github break glass issue source. The GitHub App requires read access to its issues.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "break-glass-label",
+		Target:  &cfg.BreakGlassLabel,
+		EnvVar:  "BREAK_GLASS_LABEL",
+		Default: "breakglass",
+		Usage:   `The label of break glass issues, for the github break glass issue source.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "break-glass-max-issues",
+		Target:  &cfg.BreakGlassMaxIssues,
+		EnvVar:  "BREAK_GLASS_MAX_ISSUES",
+		Default: 1000,
+		Usage: `The maximum number of break glass issues recorded for a single unapproved ` +
+			`commit. The issues are read from BigQuery in pages until this many are found.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "include-branch-protection",
+		Target:  &cfg.IncludeBranchProtection,
+		EnvVar:  "INCLUDE_BRANCH_PROTECTION",
+		Default: false,
+		Usage: `Whether to record a snapshot of the protection of the repository's default branch, ` +
+			`such as the number of required approving reviews, with the review status of each commit. ` +
+			`The GitHub App requires read access to the administration of the repositories.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "record-all-approving-pull-requests",
+		Target:  &cfg.RecordAllApprovingPullRequests,
+		EnvVar:  "RECORD_ALL_APPROVING_PULL_REQUESTS",
+		Default: false,
+		Usage: `Whether to record all approved pull requests a commit is associated with, e.g. when it was ` +
+			`cherry-picked, in the approving_pull_requests column. The first approved pull request is ` +
+			`recorded in the pull request columns regardless.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "unapproved-commits-topic-id",
+		Target: &cfg.UnapprovedCommitsTopicID,
+		EnvVar: "UNAPPROVED_COMMITS_TOPIC_ID",
+		Usage: `The Google PubSub topic ID in the project that a JSON message is published to for ` +
+			`each commit without approval and without a break glass issue, e.g. for alerting. Disabled when unset.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "commit-pull-requests-table-id",
+		Target: &cfg.CommitPullRequestsTableID,
+		EnvVar: "COMMIT_PULL_REQUESTS_TABLE_ID",
+		Usage: `The BigQuery table ID in the dataset that the pull request of each commit is written to, ` +
+			`with the commit_sha, pull_request_id, pull_request_number and pull_request_url columns, ` +
+			`so that commits can be joined to pull requests without recomputing the association. ` +
+			`Commits without a pull request are not written. Disabled when unset.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "pull-request-summary-table-id",
+		Target: &cfg.PullRequestSummaryTableID,
+		EnvVar: "PULL_REQUEST_SUMMARY_TABLE_ID",
+		Usage: `The BigQuery table ID in the dataset that a row per pull request is written to, with the ` +
+			`approval status of the pull request, which is only approved if all of its commits are, and ` +
+			`the SHAs of its commits processed by the run. Commits without a pull request are not ` +
+			`summarized. Disabled when unset.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "preflight-repository-access",
+		Target:  &cfg.PreflightRepositoryAccess,
+		EnvVar:  "PREFLIGHT_REPOSITORY_ACCESS",
+		Default: false,
+		Usage: `Whether to check access to each repository once before processing its commits. ` +
+			`The commits of a repository the GitHub App can't access are skipped, and a single ` +
+			`review status with the ACCESS_DENIED approval status is recorded for the repository.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "resolve-renamed-repositories",
+		Target:  &cfg.ResolveRenamedRepositories,
+		EnvVar:  "RESOLVE_RENAMED_REPOSITORIES",
+		Default: false,
+		Usage: `Whether to look up the commits of a repository GitHub can't find under the ` +
+			`current name of the repository, in case it was renamed or transferred since the ` +
+			`commits were pushed. The rename is recorded in the note of the review status.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "sink-concurrency",
+		Target:  &cfg.SinkConcurrency,
+		EnvVar:  "SINK_CONCURRENCY",
+		Default: 10,
+		Usage: `The maximum number of commit review statuses written to the sinks, such as the ` +
+			`unapproved commits topic, concurrently. Each commit review status is written to all sinks concurrently.`,
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:   "optional-sinks",
+		Target: &cfg.OptionalSinks,
+		EnvVar: "OPTIONAL_SINKS",
+		Usage: `Comma-separated list of sinks whose failures are logged without holding back the commit ` +
+			`review status from BigQuery. By default a commit review status is only written to BigQuery once ` +
+			`it was written to all sinks, so that it is written to them again on the next run. ` +
+			`The sinks are: ` + strings.Join(sinkNames, ", ") + `.`,
+	})
+
+	f.Float64Var(&cli.Float64Var{
+		Name:    "raw-response-sample-rate",
+		Target:  &cfg.RawResponseSampleRate,
+		EnvVar:  "RAW_RESPONSE_SAMPLE_RATE",
+		Default: 0,
+		Usage: `The fraction of commits, between 0 and 1, whose raw GraphQL responses are captured to the ` +
+			`raw-response-location for debugging, e.g. 0.01 for 1%. Commits are sampled by their SHA, so ` +
+			`re-runs capture the same commits. Disabled when 0.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "raw-response-location",
+		Target:  &cfg.RawResponseLocation,
+		EnvVar:  "RAW_RESPONSE_LOCATION",
+		Example: "gs://my-bucket/raw-responses",
+		Usage: `The gs:// URI prefix the raw GraphQL responses of sampled commits are written under, ` +
+			`one object per commit at <prefix>/<organization>/<repository>/<sha>.json.`,
+	})
+
 	return set
 }
@@ -0,0 +1,110 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// DefaultGraphQLRetryConfig is the retry configuration of GraphQL requests
+// used when none is configured.
+var DefaultGraphQLRetryConfig = &GraphQLRetryConfig{
+	MaxRetries:     3,
+	InitialBackoff: time.Second,
+}
+
+// GraphQLRetryConfig configures the retries of GraphQL requests that failed
+// with a transient 5xx response from GitHub.
+type GraphQLRetryConfig struct {
+	// MaxRetries is the maximum number of retries of a failed request. A
+	// failed request is not retried when 0.
+	MaxRetries int
+
+	// InitialBackoff is the backoff before the first retry, it doubles with
+	// each retry. A Retry-After header of the response takes precedence.
+	InitialBackoff time.Duration
+}
+
+// retryTransport retries requests that failed with a 5xx response. Requests
+// whose body can't be replayed are not retried.
+type retryTransport struct {
+	base http.RoundTripper
+	cfg  *GraphQLRetryConfig
+}
+
+// RoundTrip implements [http.RoundTripper].
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	logger := logging.FromContext(ctx)
+
+	backoff := t.cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err //nolint:wrapcheck // Want passthrough
+		}
+		if resp.StatusCode < http.StatusInternalServerError || attempt > t.cfg.MaxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+
+		delay := retryAfter(resp.Header, backoff)
+		logger.WarnContext(ctx, "graphql request failed, retrying",
+			"status", resp.StatusCode,
+			"attempt", attempt,
+			"delay", delay.String(),
+		)
+		// the connection is only reused once the body was read
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("gave up retrying graphql request after status %d: %w", resp.StatusCode, ctx.Err())
+		case <-time.After(delay):
+		}
+		backoff *= 2
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to replay graphql request body: %w", err)
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// retryAfter returns the delay requested by the Retry-After header, in
+// seconds or as an HTTP date, or the backoff if there is none.
+func retryAfter(header http.Header, backoff time.Duration) time.Duration {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return backoff
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(0, time.Until(at))
+	}
+	return backoff
+}
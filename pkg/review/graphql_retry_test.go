@@ -0,0 +1,175 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewGitHubGraphQLClient_Retry(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		statuses     []int
+		retryAfter   string
+		maxRetries   int
+		wantErr      bool
+		wantRequests int
+	}{
+		{
+			name:         "retries_503",
+			statuses:     []int{http.StatusServiceUnavailable},
+			maxRetries:   3,
+			wantRequests: 2,
+		},
+		{
+			name:         "honors_retry_after",
+			statuses:     []int{http.StatusBadGateway},
+			retryAfter:   "0",
+			maxRetries:   3,
+			wantRequests: 2,
+		},
+		{
+			name:         "gives_up_after_max_retries",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			maxRetries:   2,
+			wantErr:      true,
+			wantRequests: 3,
+		},
+		{
+			name:         "retries_disabled",
+			statuses:     []int{http.StatusServiceUnavailable},
+			maxRetries:   0,
+			wantErr:      true,
+			wantRequests: 1,
+		},
+		{
+			name:         "client_errors_not_retried",
+			statuses:     []int{http.StatusUnauthorized},
+			maxRetries:   3,
+			wantErr:      true,
+			wantRequests: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			var bodies []string
+			fakeGitHub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("failed to read request body: %v", err)
+				}
+
+				mu.Lock()
+				bodies = append(bodies, string(body))
+				attempt := len(bodies)
+				mu.Unlock()
+
+				if attempt <= len(tc.statuses) {
+					if tc.retryAfter != "" {
+						w.Header().Set("Retry-After", tc.retryAfter)
+					}
+					w.WriteHeader(tc.statuses[attempt-1])
+					return
+				}
+				fmt.Fprint(w, `{"data":{"repository":{"defaultBranchRef":{"name":"main"},"object":{"associatedPullRequests":{"nodes":[],"pageInfo":{"hasNextPage":false},"totalCount":0}}}}}`)
+			}))
+			t.Cleanup(fakeGitHub.Close)
+
+			ctx := context.Background()
+			client := NewGitHubGraphQLClient(ctx, "fake-token", fakeGitHub.URL, &GraphQLRetryConfig{
+				MaxRetries:     tc.maxRetries,
+				InitialBackoff: time.Millisecond,
+			}, nil)
+
+			_, err := GetPullRequestsTargetingDefaultBranch(ctx, client, "test-org", "test-repository", "12345678")
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("GetPullRequestsTargetingDefaultBranch() error = %v, want error %t", err, tc.wantErr)
+			}
+
+			if got, want := len(bodies), tc.wantRequests; got != want {
+				t.Fatalf("expected %d requests, got %d", want, got)
+			}
+			// each retry replays the query
+			for i, body := range bodies {
+				if body != bodies[0] {
+					t.Errorf("expected request %d to replay the query, got %q", i, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		retryAfter string
+		want       time.Duration
+	}{
+		{
+			name: "no_header",
+			want: time.Second,
+		},
+		{
+			name:       "seconds",
+			retryAfter: "30",
+			want:       30 * time.Second,
+		},
+		{
+			name:       "date_in_the_past",
+			retryAfter: "Fri, 01 Mar 2024 12:00:00 GMT",
+			want:       0,
+		},
+		{
+			name:       "invalid",
+			retryAfter: "soon",
+			want:       time.Second,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			header := http.Header{}
+			if tc.retryAfter != "" {
+				header.Set("Retry-After", tc.retryAfter)
+			}
+			if diff := cmp.Diff(retryAfter(header, time.Second), tc.want); diff != "" {
+				t.Errorf("retryAfter (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// GraphQLTransportConfig configures the pool of connections GraphQL requests
+// are sent over.
+type GraphQLTransportConfig struct {
+	// HTTP2 is whether HTTP/2 is attempted, so that concurrent requests are
+	// multiplexed over a single connection. HTTP/2 is negotiated during the TLS
+	// handshake, requests fall back to HTTP/1.1 when GitHub or a proxy in
+	// between doesn't support it. Only HTTP/1.1 is used when false.
+	HTTP2 bool
+
+	// MaxIdleConnsPerHost is the maximum number of idle connections kept for
+	// reuse, the default of [http.Transport] when 0.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost limits the number of connections, requests wait for a
+	// connection once reached. Unlimited when 0.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept for reuse, the
+	// default of [http.DefaultTransport] when 0.
+	IdleConnTimeout time.Duration
+}
+
+// newGraphQLTransport returns a transport with the connection pool configured
+// by cfg. The proxy and dial settings are those of [http.DefaultTransport].
+func newGraphQLTransport(cfg *GraphQLTransportConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // always an *http.Transport
+	transport.ForceAttemptHTTP2 = cfg.HTTP2
+	if !cfg.HTTP2 {
+		// a non-nil map disables the HTTP/2 support of the transport
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	return transport
+}
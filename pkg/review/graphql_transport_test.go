@@ -0,0 +1,170 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const fakeDefaultBranchResponse = `{"data":{"repository":{"defaultBranchRef":{"name":"main"},"object":{"associatedPullRequests":{"nodes":[],"pageInfo":{"hasNextPage":false},"totalCount":0}}}}}`
+
+// newFakeGitHubTLS starts a TLS server answering GraphQL requests that records
+// the protocol of each request, with HTTP/2 support if http2 is true.
+func newFakeGitHubTLS(tb testing.TB, http2 bool) (*httptest.Server, func() []string) {
+	tb.Helper()
+
+	var mu sync.Mutex
+	var protos []string
+	fakeGitHub := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		protos = append(protos, r.Proto)
+		mu.Unlock()
+		fmt.Fprint(w, fakeDefaultBranchResponse)
+	}))
+	fakeGitHub.EnableHTTP2 = http2
+	fakeGitHub.StartTLS()
+	tb.Cleanup(fakeGitHub.Close)
+
+	return fakeGitHub, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return protos
+	}
+}
+
+// trustingGraphQLTransport returns the transport configured by cfg that trusts
+// the certificate of the fake server.
+func trustingGraphQLTransport(fakeGitHub *httptest.Server, cfg *GraphQLTransportConfig) *http.Transport {
+	transport := newGraphQLTransport(cfg)
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    fakeGitHub.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs, //nolint:forcetypeassert // always an *http.Transport
+		MinVersion: tls.VersionTLS12,
+	}
+	return transport
+}
+
+func TestNewGitHubGraphQLClient_Transport(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		serverHTTP2 bool
+		cfg         *GraphQLTransportConfig
+		wantProto   string
+	}{
+		{
+			name:        "http2",
+			serverHTTP2: true,
+			cfg:         &GraphQLTransportConfig{HTTP2: true, MaxIdleConnsPerHost: 10},
+			wantProto:   "HTTP/2.0",
+		},
+		{
+			name:        "http2_disabled",
+			serverHTTP2: true,
+			cfg:         &GraphQLTransportConfig{HTTP2: false, MaxIdleConnsPerHost: 10},
+			wantProto:   "HTTP/1.1",
+		},
+		{
+			name:        "falls_back_to_http1",
+			serverHTTP2: false,
+			cfg:         &GraphQLTransportConfig{HTTP2: true, MaxIdleConnsPerHost: 10},
+			wantProto:   "HTTP/1.1",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			fakeGitHub, protos := newFakeGitHubTLS(t, tc.serverHTTP2)
+
+			ctx := context.Background()
+			client := newGitHubGraphQLClient(ctx, "fake-token", fakeGitHub.URL, nil, trustingGraphQLTransport(fakeGitHub, tc.cfg))
+			if _, err := GetPullRequestsTargetingDefaultBranch(ctx, client, "test-org", "test-repository", "12345678"); err != nil {
+				t.Fatalf("GetPullRequestsTargetingDefaultBranch failed: %v", err)
+			}
+
+			got := protos()
+			if len(got) != 1 {
+				t.Fatalf("expected 1 request, got %d", len(got))
+			}
+			if got[0] != tc.wantProto {
+				t.Errorf("expected request over %s, got %s", tc.wantProto, got[0])
+			}
+		})
+	}
+}
+
+func TestNewGraphQLTransport(t *testing.T) {
+	t.Parallel()
+
+	transport := newGraphQLTransport(&GraphQLTransportConfig{
+		HTTP2:               true,
+		MaxIdleConnsPerHost: 20,
+		MaxConnsPerHost:     5,
+		IdleConnTimeout:     time.Minute,
+	})
+	if !transport.ForceAttemptHTTP2 {
+		t.Errorf("expected HTTP/2 to be attempted")
+	}
+	if got, want := transport.MaxIdleConnsPerHost, 20; got != want {
+		t.Errorf("expected MaxIdleConnsPerHost %d, got %d", want, got)
+	}
+	if got, want := transport.MaxConnsPerHost, 5; got != want {
+		t.Errorf("expected MaxConnsPerHost %d, got %d", want, got)
+	}
+	if got, want := transport.IdleConnTimeout, time.Minute; got != want {
+		t.Errorf("expected IdleConnTimeout %s, got %s", want, got)
+	}
+	if transport.Proxy == nil {
+		t.Errorf("expected the proxy of the default transport")
+	}
+}
+
+// BenchmarkGitHubGraphQLClient compares concurrent GraphQL requests over
+// HTTP/1.1 and HTTP/2 connections, run with
+// go test -bench GitHubGraphQLClient ./pkg/review.
+func BenchmarkGitHubGraphQLClient(b *testing.B) {
+	for _, http2 := range []bool{false, true} {
+		http2 := http2
+
+		b.Run(fmt.Sprintf("http2=%t", http2), func(b *testing.B) {
+			fakeGitHub, _ := newFakeGitHubTLS(b, true)
+
+			ctx := context.Background()
+			transport := trustingGraphQLTransport(fakeGitHub, &GraphQLTransportConfig{HTTP2: http2, MaxIdleConnsPerHost: 10})
+			b.Cleanup(transport.CloseIdleConnections)
+			client := newGitHubGraphQLClient(ctx, "fake-token", fakeGitHub.URL, nil, transport)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := GetPullRequestsTargetingDefaultBranch(ctx, client, "test-org", "test-repository", "12345678"); err != nil {
+						b.Errorf("GetPullRequestsTargetingDefaultBranch failed: %v", err)
+					}
+				}
+			})
+		})
+	}
+}
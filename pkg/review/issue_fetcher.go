@@ -17,11 +17,27 @@ package review
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/google/go-github/v61/github"
+
 	"github.com/abcxyz/github-metrics-aggregator/pkg/bq"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// breakGlassPageSize is the number of break glass issues read by each query.
+const breakGlassPageSize = 100
+
+// The sources break glass issues can be read from.
+const (
+	BreakGlassIssueSourceBigQuery = "bigquery"
+	BreakGlassIssueSourceGitHub   = "github"
 )
 
+// breakGlassIssueSources are all sources of break glass issues.
+var breakGlassIssueSources = []string{BreakGlassIssueSourceBigQuery, BreakGlassIssueSourceGitHub}
+
 // BreakGlassIssueFetcher fetches break glass issues from a data source.
 type BreakGlassIssueFetcher interface {
 	// getBreakGlassIssues retrieves all break glass issues created by the given
@@ -38,13 +54,118 @@ type BigQueryBreakGlassIssueFetcher struct {
 }
 
 func (bqif *BigQueryBreakGlassIssueFetcher) fetch(ctx context.Context, cfg *Config, author string, timestamp *time.Time) ([]*breakGlassIssue, error) {
-	issueQuery, err := makeBreakglassQuery(cfg, author, timestamp)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create breakglass query: %w", err)
+	return fetchBreakGlassIssuePages(ctx, cfg.BreakGlassMaxIssues, breakGlassPageSize,
+		func(ctx context.Context, limit, offset int) ([]*breakGlassIssue, error) {
+			issueQuery, err := makeBreakglassQuery(cfg, author, timestamp, limit, offset)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create breakglass query: %w", err)
+			}
+			items, err := bq.Query[breakGlassIssue](ctx, bqif.client, issueQuery)
+			if err != nil {
+				return nil, fmt.Errorf("client.Query failed: %w", err)
+			}
+			return items, nil
+		})
+}
+
+// GitHubLabelBreakGlassIssueFetcher implements the BreakGlassIssueFetcher
+// interface and lists the break glass issues from the issues API of GitHub,
+// as the issues of a repository with a label. Like the issues table, only
+// closed issues cover a commit.
+type GitHubLabelBreakGlassIssueFetcher struct {
+	client *github.Client
+	owner  string
+	repo   string
+	label  string
+}
+
+// NewGitHubLabelBreakGlassIssueFetcher creates a fetcher of the issues of the
+// owner/name repository with the given label.
+func NewGitHubLabelBreakGlassIssueFetcher(client *github.Client, repository, label string) (*GitHubLabelBreakGlassIssueFetcher, error) {
+	owner, repo, ok := strings.Cut(repository, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid repository %q, must be of the form owner/name", repository)
+	}
+	return &GitHubLabelBreakGlassIssueFetcher{
+		client: client,
+		owner:  owner,
+		repo:   repo,
+		label:  label,
+	}, nil
+}
+
+func (f *GitHubLabelBreakGlassIssueFetcher) fetch(ctx context.Context, cfg *Config, author string, timestamp *time.Time) ([]*breakGlassIssue, error) {
+	windowStart := timestamp.Add(-cfg.BreakGlassWindow)
+	windowEnd := timestamp.Add(cfg.BreakGlassWindow)
+
+	// an issue closed within or after the window was last updated at or after
+	// its start, so older issues don't need to be listed
+	opts := &github.IssueListByRepoOptions{
+		State:     "all",
+		Labels:    []string{f.label},
+		Creator:   author,
+		Sort:      "created",
+		Direction: "asc",
+		Since:     windowStart,
+		ListOptions: github.ListOptions{
+			PerPage: breakGlassPageSize,
+		},
 	}
-	items, err := bq.Query[breakGlassIssue](ctx, bqif.client, issueQuery)
-	if err != nil {
-		return nil, fmt.Errorf("client.Query failed: %w", err)
+
+	issues := make([]*breakGlassIssue, 0)
+	for {
+		page, resp, err := f.client.Issues.ListByRepo(ctx, f.owner, f.repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list issues of %s/%s: %w", f.owner, f.repo, err)
+		}
+
+		for _, issue := range page {
+			// the issues are listed in the order they were created, none of
+			// the remaining issues was open within the window
+			if issue.GetCreatedAt().After(windowEnd) {
+				return issues, nil
+			}
+			if issue.IsPullRequest() || issue.ClosedAt == nil || issue.GetClosedAt().Before(windowStart) {
+				continue
+			}
+
+			issues = append(issues, &breakGlassIssue{HTMLURL: issue.GetHTMLURL()})
+			if len(issues) >= cfg.BreakGlassMaxIssues {
+				logging.FromContext(ctx).WarnContext(ctx, "reached the maximum number of break glass issues, any remaining issues are ignored",
+					"max_issues", cfg.BreakGlassMaxIssues)
+				return issues, nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			return issues, nil
+		}
+		opts.Page = resp.NextPage
 	}
-	return items, nil
+}
+
+// breakGlassPageFetcher returns the page of at most limit break glass issues
+// starting at offset.
+type breakGlassPageFetcher func(ctx context.Context, limit, offset int) ([]*breakGlassIssue, error)
+
+// fetchBreakGlassIssuePages reads pages of pageSize break glass issues until a
+// page comes back short or maxIssues issues have been read. Reaching maxIssues
+// is logged, as any remaining issues are not returned.
+func fetchBreakGlassIssuePages(ctx context.Context, maxIssues, pageSize int, fetchPage breakGlassPageFetcher) ([]*breakGlassIssue, error) {
+	issues := make([]*breakGlassIssue, 0)
+	for len(issues) < maxIssues {
+		limit := min(pageSize, maxIssues-len(issues))
+		page, err := fetchPage(ctx, limit, len(issues))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch break glass issues at offset %d: %w", len(issues), err)
+		}
+		issues = append(issues, page...)
+		if len(page) < limit {
+			return issues, nil
+		}
+	}
+
+	logging.FromContext(ctx).WarnContext(ctx, "reached the maximum number of break glass issues, any remaining issues are ignored",
+		"max_issues", maxIssues)
+	return issues, nil
 }
@@ -0,0 +1,144 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v61/github"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+func TestGitHubLabelBreakGlassIssueFetcher(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	timestamp := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// the issues of the break glass repository, in the order they were created
+	pages := []string{
+		`[
+			{"html_url": "https://github.com/org/breakglass/issues/1", "created_at": "2024-02-01T00:00:00Z", "closed_at": "2024-02-02T00:00:00Z"},
+			{"html_url": "https://github.com/org/breakglass/issues/2", "created_at": "2024-03-01T11:00:00Z", "closed_at": "2024-03-01T13:00:00Z"},
+			{"html_url": "https://github.com/org/breakglass/pull/3", "created_at": "2024-03-01T11:00:00Z", "closed_at": "2024-03-01T13:00:00Z", "pull_request": {}}
+		]`,
+		`[
+			{"html_url": "https://github.com/org/breakglass/issues/4", "created_at": "2024-03-01T11:30:00Z"},
+			{"html_url": "https://github.com/org/breakglass/issues/5", "created_at": "2024-03-01T11:45:00Z", "closed_at": "2024-03-02T00:00:00Z"},
+			{"html_url": "https://github.com/org/breakglass/issues/6", "created_at": "2024-03-01T14:00:00Z", "closed_at": "2024-03-01T15:00:00Z"}
+		]`,
+	}
+
+	cases := []struct {
+		name      string
+		cfg       *Config
+		wantQuery string
+		want      []*breakGlassIssue
+		wantErr   string
+	}{
+		{
+			name:      "issues_open_at_commit",
+			cfg:       &Config{BreakGlassMaxIssues: 1000},
+			wantQuery: "creator=author&direction=asc&labels=breakglass&per_page=100&since=2024-03-01T12%3A00%3A00Z&sort=created&state=all",
+			want: []*breakGlassIssue{
+				{HTMLURL: "https://github.com/org/breakglass/issues/2"},
+				{HTMLURL: "https://github.com/org/breakglass/issues/5"},
+			},
+		},
+		{
+			name:      "issues_open_within_window",
+			cfg:       &Config{BreakGlassMaxIssues: 1000, BreakGlassWindow: 3 * time.Hour},
+			wantQuery: "creator=author&direction=asc&labels=breakglass&per_page=100&since=2024-03-01T09%3A00%3A00Z&sort=created&state=all",
+			want: []*breakGlassIssue{
+				{HTMLURL: "https://github.com/org/breakglass/issues/2"},
+				{HTMLURL: "https://github.com/org/breakglass/issues/5"},
+				{HTMLURL: "https://github.com/org/breakglass/issues/6"},
+			},
+		},
+		{
+			name:      "max_issues",
+			cfg:       &Config{BreakGlassMaxIssues: 1},
+			wantQuery: "creator=author&direction=asc&labels=breakglass&per_page=100&since=2024-03-01T12%3A00%3A00Z&sort=created&state=all",
+			want: []*breakGlassIssue{
+				{HTMLURL: "https://github.com/org/breakglass/issues/2"},
+			},
+		},
+		{
+			name:    "error",
+			cfg:     &Config{BreakGlassMaxIssues: 1000, BreakGlassLabel: "broken"},
+			wantErr: "failed to list issues of org/breakglass",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotQuery string
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /api/v3/repos/org/breakglass/issues", func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				if query.Get("labels") == "broken" {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				if query.Get("page") == "" {
+					gotQuery = r.URL.RawQuery
+					w.Header().Set("Link", fmt.Sprintf(`<http://%s/api/v3/repos/org/breakglass/issues?page=2>; rel="next"`, r.Host))
+					fmt.Fprint(w, pages[0])
+					return
+				}
+				fmt.Fprint(w, pages[1])
+			})
+			fakeGitHub := httptest.NewServer(mux)
+			t.Cleanup(fakeGitHub.Close)
+
+			client, err := github.NewClient(fakeGitHub.Client()).WithEnterpriseURLs(fakeGitHub.URL, fakeGitHub.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			label := "breakglass"
+			if tc.cfg.BreakGlassLabel != "" {
+				label = tc.cfg.BreakGlassLabel
+			}
+			fetcher, err := NewGitHubLabelBreakGlassIssueFetcher(client, "org/breakglass", label)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := fetcher.fetch(ctx, tc.cfg, "author", &timestamp)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("fetch (-got,+want):\n%s", diff)
+			}
+			if got, want := gotQuery, tc.wantQuery; got != want {
+				t.Errorf("expected query %q, got %q", want, got)
+			}
+		})
+	}
+}
@@ -19,6 +19,9 @@ import (
 	"fmt"
 	"runtime"
 
+	"cloud.google.com/go/bigquery"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/artifact"
 	"github.com/abcxyz/github-metrics-aggregator/pkg/bq"
 	"github.com/abcxyz/github-metrics-aggregator/pkg/version"
 	"github.com/abcxyz/pkg/githubauth"
@@ -26,9 +29,49 @@ import (
 	"github.com/abcxyz/pkg/workerpool"
 )
 
+// InstallationPermissions returns the permissions requested for the access
+// tokens of the GitHub App installation, the app must be granted at least these
+// permissions.
+func InstallationPermissions(cfg *Config) map[string]string {
+	permissions := map[string]string{
+		"actions":       "read",
+		"contents":      "read",
+		"pull_requests": "read",
+	}
+	if cfg.IncludeBranchProtection {
+		// reading branch protection requires access to the repository settings
+		permissions["administration"] = "read"
+	}
+	if cfg.BreakGlassIssueSource == BreakGlassIssueSourceGitHub {
+		permissions["issues"] = "read"
+	}
+	if cfg.RequiredDistinctTeams > 0 || cfg.RequireCodeOwnerApproval || len(cfg.RepoRequireCodeOwnerApproval) > 0 {
+		// resolving the teams of the approving reviewers, or the members of
+		// the teams owning the changed files, requires read access to the
+		// members of the organization
+		permissions["members"] = "read"
+	}
+	return permissions
+}
+
 // ExecuteJob runs the pipeline job to read GitHub commits to check if they were
 // properly reviewed.
 func ExecuteJob(ctx context.Context, cfg *Config) error {
+	query, err := makeCommitQuery(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to created commit query: %w", err)
+	}
+
+	return executeJob(ctx, cfg, query, &statusOutput{
+		tableID:        cfg.CommitReviewStatusTableID,
+		disposition:    bigquery.WriteAppend,
+		summaryTableID: cfg.PullRequestSummaryTableID,
+	})
+}
+
+// executeJob runs the pipeline job for the commits selected by the given
+// BigQuery query and writes their review statuses to the output.
+func executeJob(ctx context.Context, cfg *Config, query string, output *statusOutput) error {
 	logger := logging.FromContext(ctx)
 
 	bqClient, err := bq.NewBigQuery(ctx, cfg.ProjectID, cfg.DatasetID)
@@ -36,6 +79,7 @@ func ExecuteJob(ctx context.Context, cfg *Config) error {
 		return fmt.Errorf("failed to create bigquery client: %w", err)
 	}
 	defer bqClient.Close()
+	bqClient.AddMissingColumns = cfg.AddMissingColumns
 
 	app, err := githubauth.NewApp(cfg.GitHubAppID, cfg.GitHubPrivateKeySecret)
 	if err != nil {
@@ -47,17 +91,43 @@ func ExecuteJob(ctx context.Context, cfg *Config) error {
 		return fmt.Errorf("failed to get github app installation: %w", err)
 	}
 
-	githubTokenSource := installation.AllReposTokenSource(map[string]string{
-		"actions":       "read",
-		"contents":      "read",
-		"pull_requests": "read",
-	})
+	permissions := InstallationPermissions(cfg)
+	githubTokenSource := installation.AllReposTokenSource(permissions)
 
 	gitHubToken, err := githubTokenSource.GitHubToken(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get github token: %w", err)
 	}
-	gitHubClient := NewGitHubGraphQLClient(ctx, gitHubToken)
+	gitHubClient := NewGitHubGraphQLClient(ctx, gitHubToken, cfg.GitHubGraphQLURL, &GraphQLRetryConfig{
+		MaxRetries:     cfg.GraphQLMaxRetries,
+		InitialBackoff: cfg.GraphQLRetryBackoff,
+	}, &GraphQLTransportConfig{
+		HTTP2:               cfg.GraphQLHTTP2,
+		MaxIdleConnsPerHost: cfg.GraphQLMaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.GraphQLMaxConnsPerHost,
+		IdleConnTimeout:     cfg.GraphQLIdleConnTimeout,
+	})
+
+	gitHubRESTClient, err := NewGitHubRESTClient(ctx, gitHubToken, cfg.GitHubGraphQLURL)
+	if err != nil {
+		return fmt.Errorf("failed to create github rest client: %w", err)
+	}
+	teamResolver := NewGitHubTeamMembershipResolver(gitHubRESTClient)
+	protectionResolver := NewGitHubBranchProtectionResolver(gitHubRESTClient)
+
+	var renameResolver RepositoryRenameResolver
+	if cfg.ResolveRenamedRepositories {
+		renameResolver = NewGitHubRepositoryRenameResolver(gitHubRESTClient)
+	}
+
+	var sampler *RawResponseSampler
+	if cfg.RawResponseSampleRate > 0 {
+		store, err := artifact.NewObjectStore(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create raw response object store: %w", err)
+		}
+		sampler = NewRawResponseSampler(cfg.RawResponseSampleRate, cfg.RawResponseLocation, store)
+	}
 
 	logger.InfoContext(ctx, "review job starting",
 		"name", version.Name,
@@ -65,30 +135,47 @@ func ExecuteJob(ctx context.Context, cfg *Config) error {
 		"version", version.Version)
 
 	// Step 1: Get commits that need to be processed from BigQuery.
-	query, err := makeCommitQuery(cfg)
-	if err != nil {
-		return fmt.Errorf("failed to created commit query: %w", err)
-	}
 	commits, err := bq.Query[Commit](ctx, bqClient, query)
 	if err != nil {
 		return fmt.Errorf("failed to query bigquery for commits: %w", err)
 	}
 
+	// Step 1b: Skip the commits of repositories the GitHub App can't access,
+	// recording a single review status per repository instead.
+	var accessDeniedStatuses []*CommitReviewStatus
+	if cfg.PreflightRepositoryAccess {
+		checker := NewGitHubRepositoryAccessChecker(gitHubClient)
+		commits, accessDeniedStatuses = skipInaccessibleRepositories(ctx, checker, cfg.GitHubGraphQLURL, commits)
+	}
+
 	// Step 2: Get review status information for each commit.
-	commitReviewStatuses, err := pooledTransform(ctx, commits,
+	commitReviewStatuses, err := pooledTransform(ctx, int64(runtime.NumCPU()), commits,
 		func(commit *Commit) (*CommitReviewStatus, error) {
-			return processCommit(ctx, gitHubClient, commit), nil
+			status := processCommit(ctx, gitHubClient, teamResolver, renameResolver, sampler, cfg, commit)
+			if status != nil && cfg.IncludeBranchProtection {
+				status = addBranchProtection(ctx, protectionResolver, status)
+			}
+			return status, nil
 		},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to process commits: %w", err)
 	}
+	commitReviewStatuses = append(commitReviewStatuses, accessDeniedStatuses...)
 
 	// Step 3: Look up break glass issue if necessary and tag the review status with it if found.
-	fetcher := &BigQueryBreakGlassIssueFetcher{
+	// The lookups are bound by BigQuery or GitHub latency rather than CPU, so
+	// they use their own concurrency limit.
+	var fetcher BreakGlassIssueFetcher = &BigQueryBreakGlassIssueFetcher{
 		client: bqClient,
 	}
-	taggedReviewStatuses, err := pooledTransform(ctx, commitReviewStatuses,
+	if cfg.BreakGlassIssueSource == BreakGlassIssueSourceGitHub {
+		fetcher, err = NewGitHubLabelBreakGlassIssueFetcher(gitHubRESTClient, cfg.BreakGlassRepository, cfg.BreakGlassLabel)
+		if err != nil {
+			return fmt.Errorf("failed to create break glass issue fetcher: %w", err)
+		}
+	}
+	taggedReviewStatuses, err := pooledTransform(ctx, int64(cfg.BreakGlassConcurrency), commitReviewStatuses,
 		func(status *CommitReviewStatus) (*CommitReviewStatus, error) {
 			return processReviewStatus(ctx, fetcher, cfg, status), nil
 		},
@@ -97,24 +184,68 @@ func ExecuteJob(ctx context.Context, cfg *Config) error {
 		return fmt.Errorf("failed to process commit review statuses: %w", err)
 	}
 
-	// Step 4: Write the commit review status information to BigQuery.
-	if err := bq.Write[CommitReviewStatus](ctx, bqClient, cfg.CommitReviewStatusTableID, taggedReviewStatuses); err != nil {
-		return fmt.Errorf("failed to write commit review statuses to bigquery: %w", err)
+	// Step 4: Write the commit review statuses to the enabled sinks, e.g.
+	// publish the commits that lack approval for alerting or record the pull
+	// request of each commit. They are written
+	// before BigQuery so that a failed write is retried on the next run rather
+	// than never.
+	sinks, closeSinks, err := newSinks(ctx, cfg, bqClient)
+	if err != nil {
+		return fmt.Errorf("failed to create sinks: %w", err)
+	}
+	defer closeSinks()
+
+	completeReviewStatuses, err := writeToSinks(ctx, int64(cfg.SinkConcurrency), sinks, taggedReviewStatuses)
+	if err != nil {
+		return fmt.Errorf("failed to write commit review statuses to sinks: %w", err)
+	}
+
+	// Step 5: Write the commit review status information to BigQuery. They
+	// are streamed when appended, and loaded when they replace the contents of
+	// the table.
+	switch output.disposition {
+	case bigquery.WriteTruncate:
+		if err := bq.Load(ctx, bqClient, output.tableID, completeReviewStatuses, output.disposition); err != nil {
+			return fmt.Errorf("failed to load commit review statuses into bigquery: %w", err)
+		}
+	default:
+		if err := bq.Write[CommitReviewStatus](ctx, bqClient, output.tableID, completeReviewStatuses); err != nil {
+			return fmt.Errorf("failed to write commit review statuses to bigquery: %w", err)
+		}
+	}
+
+	// Step 6: Write a summary of the review statuses of each pull request, if
+	// enabled, the same way as the commit review statuses.
+	if output.summaryTableID != "" {
+		summaries := summarizePullRequests(completeReviewStatuses)
+		switch output.disposition {
+		case bigquery.WriteTruncate:
+			if err := bq.Load(ctx, bqClient, output.summaryTableID, summaries, output.disposition); err != nil {
+				return fmt.Errorf("failed to load pull request summaries into bigquery: %w", err)
+			}
+		default:
+			if err := bq.Write[PullRequestReviewSummary](ctx, bqClient, output.summaryTableID, summaries); err != nil {
+				return fmt.Errorf("failed to write pull request summaries to bigquery: %w", err)
+			}
+		}
 	}
 
+	if incomplete := len(taggedReviewStatuses) - len(completeReviewStatuses); incomplete > 0 {
+		return fmt.Errorf("failed to write %d of %d commit review statuses to the required sinks", incomplete, len(taggedReviewStatuses))
+	}
 	return nil
 }
 
 // pooledTransform transforms each input element of type E into an element of
 // type V using the given transform function. The transform is fanned out using
-// a worker pool so that each input element may be processed asynchronously from
-// the others.
+// a worker pool of the given concurrency so that each input element may be
+// processed asynchronously from the others.
 //
 // Any nil elements or nil results are excluded from the returned values.
-func pooledTransform[E, V any](ctx context.Context, elements []*E, transform func(*E) (*V, error)) ([]*V, error) {
+func pooledTransform[E, V any](ctx context.Context, concurrency int64, elements []*E, transform func(*E) (*V, error)) ([]*V, error) {
 	// Create a pool of workers to manage the transformation
 	workerPool := workerpool.New[*V](&workerpool.Config{
-		Concurrency: int64(runtime.NumCPU()),
+		Concurrency: concurrency,
 		StopOnError: false,
 	})
 
@@ -0,0 +1,149 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPooledTransform_BoundedConcurrency(t *testing.T) {
+	t.Parallel()
+
+	const concurrency = 3
+
+	statuses := make([]*CommitReviewStatus, 0, 20)
+	for i := 0; i < 20; i++ {
+		statuses = append(statuses, &CommitReviewStatus{
+			Commit: &Commit{
+				Author: fmt.Sprintf("author-%d", i),
+				SHA:    fmt.Sprintf("sha-%d", i),
+			},
+			ApprovalStatus: DefaultApprovalStatus,
+		})
+	}
+
+	var inFlight, maxInFlight atomic.Int64
+	fetcher := &TestBreakGlassIssueFetcher{
+		fetcher: func(ctx context.Context, author string, timestamp *time.Time) ([]*breakGlassIssue, error) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				m := maxInFlight.Load()
+				if n <= m || maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+
+			// simulate BigQuery latency so that lookups overlap
+			time.Sleep(5 * time.Millisecond)
+			return []*breakGlassIssue{{HTMLURL: "https://github.com/org/repo/issues/" + author}}, nil
+		},
+	}
+
+	ctx := context.Background()
+	got, err := pooledTransform(ctx, concurrency, statuses,
+		func(status *CommitReviewStatus) (*CommitReviewStatus, error) {
+			return processReviewStatus(ctx, fetcher, defaultConfig, status), nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("pooledTransform failed: %v", err)
+	}
+
+	if got, want := maxInFlight.Load(), int64(concurrency); got > want {
+		t.Errorf("expected at most %d concurrent lookups, got %d", want, got)
+	}
+	if got := maxInFlight.Load(); got < 2 {
+		t.Errorf("expected lookups to run concurrently, got at most %d at a time", got)
+	}
+
+	// each commit is tagged with the break glass issue of its own author
+	if len(got) != len(statuses) {
+		t.Fatalf("expected %d results, got %d", len(statuses), len(got))
+	}
+	for i, status := range got {
+		want := []string{fmt.Sprintf("https://github.com/org/repo/issues/author-%d", i)}
+		if diff := cmp.Diff(status.BreakGlassURLs, want); diff != "" {
+			t.Errorf("result %d (%s): unexpected break glass urls (-got,+want):\n%s", i, status.SHA, diff)
+		}
+	}
+}
+
+func TestInstallationPermissions(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		cfg  *Config
+		want map[string]string
+	}{
+		{
+			name: "default",
+			cfg:  &Config{BreakGlassIssueSource: BreakGlassIssueSourceBigQuery},
+			want: map[string]string{
+				"actions":       "read",
+				"contents":      "read",
+				"pull_requests": "read",
+			},
+		},
+		{
+			name: "code_owner_approval",
+			cfg: &Config{
+				BreakGlassIssueSource:        BreakGlassIssueSourceBigQuery,
+				RepoRequireCodeOwnerApproval: map[string]string{"infra-*": "true"},
+			},
+			want: map[string]string{
+				"actions":       "read",
+				"contents":      "read",
+				"members":       "read",
+				"pull_requests": "read",
+			},
+		},
+		{
+			name: "all_optional_permissions",
+			cfg: &Config{
+				IncludeBranchProtection: true,
+				BreakGlassIssueSource:   BreakGlassIssueSourceGitHub,
+				RequiredDistinctTeams:   2,
+			},
+			want: map[string]string{
+				"actions":        "read",
+				"administration": "read",
+				"contents":       "read",
+				"issues":         "read",
+				"members":        "read",
+				"pull_requests":  "read",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(InstallationPermissions(tc.cfg), tc.want); diff != "" {
+				t.Errorf("permissions (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
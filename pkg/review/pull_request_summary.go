@@ -0,0 +1,104 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"cmp"
+	"slices"
+)
+
+// PullRequestReviewSummary maps the columns of the pull request summary table,
+// which has a row per pull request with the review status of its commits, for
+// dashboards of pull requests rather than commits.
+type PullRequestReviewSummary struct {
+	Organization       string `bigquery:"organization"`
+	Repository         string `bigquery:"repository"`
+	PullRequestID      int64  `bigquery:"pull_request_id"`
+	PullRequestNumber  int    `bigquery:"pull_request_number"`
+	PullRequestHTMLURL string `bigquery:"pull_request_html_url"`
+
+	// ApprovalStatus is the approval status of the pull request, which is
+	// only approved if all of its commits are.
+	ApprovalStatus string   `bigquery:"approval_status"`
+	CommitSHAs     []string `bigquery:"commit_shas"`
+	BreakGlassURLs []string `bigquery:"break_glass_issue_urls"`
+}
+
+// summarizePullRequests groups the review statuses of the commits by their
+// pull request. Commits without a pull request are skipped. The summaries are
+// sorted by repository and pull request number, the commits and break glass
+// issues of each summary by value.
+func summarizePullRequests(statuses []*CommitReviewStatus) []*PullRequestReviewSummary {
+	summaries := make(map[int64]*PullRequestReviewSummary)
+	commitStatuses := make(map[int64]map[string]string)
+	for _, status := range statuses {
+		if status == nil || status.PullRequestID == 0 {
+			continue
+		}
+
+		summary, ok := summaries[status.PullRequestID]
+		if !ok {
+			summary = &PullRequestReviewSummary{
+				PullRequestID:      status.PullRequestID,
+				PullRequestNumber:  status.PullRequestNumber,
+				PullRequestHTMLURL: status.PullRequestHTMLURL,
+			}
+			if status.Commit != nil {
+				summary.Organization = status.Organization
+				summary.Repository = status.Repository
+			}
+			summaries[status.PullRequestID] = summary
+			commitStatuses[status.PullRequestID] = make(map[string]string)
+		}
+
+		var sha string
+		if status.Commit != nil {
+			sha = status.SHA
+		}
+		commitStatuses[status.PullRequestID][sha] = status.ApprovalStatus
+		summary.BreakGlassURLs = append(summary.BreakGlassURLs, status.BreakGlassURLs...)
+	}
+
+	result := make([]*PullRequestReviewSummary, 0, len(summaries))
+	for id, summary := range summaries {
+		summary.ApprovalStatus = GithubPRApproved
+		for sha := range commitStatuses[id] {
+			summary.CommitSHAs = append(summary.CommitSHAs, sha)
+		}
+		slices.Sort(summary.CommitSHAs)
+		// the status of the first commit that is not approved stands for the
+		// pull request, so that the same status is reported on every run
+		for _, sha := range summary.CommitSHAs {
+			if status := commitStatuses[id][sha]; status != GithubPRApproved {
+				summary.ApprovalStatus = status
+				break
+			}
+		}
+
+		slices.Sort(summary.BreakGlassURLs)
+		summary.BreakGlassURLs = slices.Compact(summary.BreakGlassURLs)
+		result = append(result, summary)
+	}
+
+	slices.SortFunc(result, func(a, b *PullRequestReviewSummary) int {
+		return cmp.Or(
+			cmp.Compare(a.Organization, b.Organization),
+			cmp.Compare(a.Repository, b.Repository),
+			cmp.Compare(a.PullRequestNumber, b.PullRequestNumber),
+			cmp.Compare(a.PullRequestID, b.PullRequestID),
+		)
+	})
+	return result
+}
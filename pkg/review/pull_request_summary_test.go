@@ -0,0 +1,160 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSummarizePullRequests(t *testing.T) {
+	t.Parallel()
+
+	status := func(sha string, prID int64, prNumber int, approvalStatus string, breakGlassURLs ...string) *CommitReviewStatus {
+		return &CommitReviewStatus{
+			Commit: &Commit{
+				Organization: "test-org",
+				Repository:   "test-repo",
+				SHA:          sha,
+			},
+			PullRequestID:      prID,
+			PullRequestNumber:  prNumber,
+			PullRequestHTMLURL: fmt.Sprintf("https://github.com/test-org/test-repo/pull/%d", prNumber),
+			ApprovalStatus:     approvalStatus,
+			BreakGlassURLs:     breakGlassURLs,
+		}
+	}
+
+	cases := []struct {
+		name     string
+		statuses []*CommitReviewStatus
+		want     []*PullRequestReviewSummary
+	}{
+		{
+			name: "no_statuses",
+			want: []*PullRequestReviewSummary{},
+		},
+		{
+			name: "commits_grouped_by_pull_request",
+			statuses: []*CommitReviewStatus{
+				status("cccc", 202, 2, GithubPRApproved),
+				status("aaaa", 101, 1, GithubPRApproved),
+				status("bbbb", 101, 1, GithubPRApproved),
+			},
+			want: []*PullRequestReviewSummary{
+				{
+					Organization:       "test-org",
+					Repository:         "test-repo",
+					PullRequestID:      101,
+					PullRequestNumber:  1,
+					PullRequestHTMLURL: "https://github.com/test-org/test-repo/pull/1",
+					ApprovalStatus:     GithubPRApproved,
+					CommitSHAs:         []string{"aaaa", "bbbb"},
+				},
+				{
+					Organization:       "test-org",
+					Repository:         "test-repo",
+					PullRequestID:      202,
+					PullRequestNumber:  2,
+					PullRequestHTMLURL: "https://github.com/test-org/test-repo/pull/2",
+					ApprovalStatus:     GithubPRApproved,
+					CommitSHAs:         []string{"cccc"},
+				},
+			},
+		},
+		{
+			name: "not_approved_if_any_commit_is_not",
+			statuses: []*CommitReviewStatus{
+				status("aaaa", 101, 1, GithubPRApproved),
+				status("cccc", 101, 1, DefaultApprovalStatus),
+				status("bbbb", 101, 1, GithubPRReviewRequired, "https://github.com/test-org/breakglass/issues/2"),
+				status("dddd", 101, 1, GithubPRReviewRequired, "https://github.com/test-org/breakglass/issues/1", "https://github.com/test-org/breakglass/issues/2"),
+			},
+			want: []*PullRequestReviewSummary{
+				{
+					Organization:       "test-org",
+					Repository:         "test-repo",
+					PullRequestID:      101,
+					PullRequestNumber:  1,
+					PullRequestHTMLURL: "https://github.com/test-org/test-repo/pull/1",
+					ApprovalStatus:     GithubPRReviewRequired,
+					CommitSHAs:         []string{"aaaa", "bbbb", "cccc", "dddd"},
+					BreakGlassURLs: []string{
+						"https://github.com/test-org/breakglass/issues/1",
+						"https://github.com/test-org/breakglass/issues/2",
+					},
+				},
+			},
+		},
+		{
+			name: "same_commit_counted_once",
+			statuses: []*CommitReviewStatus{
+				status("aaaa", 101, 1, GithubPRApproved),
+				status("aaaa", 101, 1, GithubPRApproved),
+			},
+			want: []*PullRequestReviewSummary{
+				{
+					Organization:       "test-org",
+					Repository:         "test-repo",
+					PullRequestID:      101,
+					PullRequestNumber:  1,
+					PullRequestHTMLURL: "https://github.com/test-org/test-repo/pull/1",
+					ApprovalStatus:     GithubPRApproved,
+					CommitSHAs:         []string{"aaaa"},
+				},
+			},
+		},
+		{
+			name: "commits_without_pull_request_skipped",
+			statuses: []*CommitReviewStatus{
+				status("aaaa", 0, 0, DefaultApprovalStatus, "https://github.com/test-org/breakglass/issues/1"),
+				nil,
+				status("bbbb", 101, 1, ApprovedByMergeStatus),
+			},
+			want: []*PullRequestReviewSummary{
+				{
+					Organization:       "test-org",
+					Repository:         "test-repo",
+					PullRequestID:      101,
+					PullRequestNumber:  1,
+					PullRequestHTMLURL: "https://github.com/test-org/test-repo/pull/1",
+					ApprovalStatus:     ApprovedByMergeStatus,
+					CommitSHAs:         []string{"bbbb"},
+				},
+			},
+		},
+		{
+			name: "only_commits_without_pull_request",
+			statuses: []*CommitReviewStatus{
+				status("aaaa", 0, 0, DefaultApprovalStatus),
+			},
+			want: []*PullRequestReviewSummary{},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(summarizePullRequests(tc.statuses), tc.want); diff != "" {
+				t.Errorf("summaries (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/artifact"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// RawResponseSampler captures the raw GraphQL responses of a sample of the
+// commits to an object store, to debug how their review status was
+// classified. Commits are sampled by their SHA, so re-running the job for the
+// same commits captures the responses of the same commits again.
+type RawResponseSampler struct {
+	rate     float64
+	location string
+	writer   artifact.ObjectWriter
+}
+
+// NewRawResponseSampler creates a sampler capturing the raw GraphQL responses
+// of the given fraction of commits, between 0 and 1. The responses of a commit
+// are written with the writer to an object under the location, e.g.
+// gs://my-bucket/raw-responses.
+func NewRawResponseSampler(rate float64, location string, writer artifact.ObjectWriter) *RawResponseSampler {
+	return &RawResponseSampler{
+		rate:     rate,
+		location: strings.TrimSuffix(location, "/"),
+		writer:   writer,
+	}
+}
+
+// Sampled reports whether the raw GraphQL responses of the commit with the
+// given SHA are captured. The SHA is hashed into a number in [0, 1) that is
+// compared to the sample rate, so the decision is the same on every run. A nil
+// sampler samples no commits.
+func (s *RawResponseSampler) Sampled(sha string) bool {
+	if s == nil || s.rate <= 0 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(sha))
+	// the top 53 bits are exactly representable as a float64
+	v := float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+	return v < s.rate
+}
+
+// rawResponseCapture is the object the raw GraphQL responses of a commit are
+// written to.
+type rawResponseCapture struct {
+	Organization string            `json:"organization"`
+	Repository   string            `json:"repository"`
+	SHA          string            `json:"sha"`
+	Responses    []json.RawMessage `json:"responses"`
+}
+
+// write writes the raw GraphQL responses recorded for the commit. Failing to
+// write them does not affect the review status of the commit, so the error is
+// only logged.
+func (s *RawResponseSampler) write(ctx context.Context, commit *Commit, recorder *rawResponseRecorder) {
+	logger := logging.FromContext(ctx)
+
+	b, err := json.Marshal(&rawResponseCapture{
+		Organization: commit.Organization,
+		Repository:   commit.Repository,
+		SHA:          commit.SHA,
+		Responses:    recorder.all(),
+	})
+	if err != nil {
+		logger.WarnContext(ctx, "failed to encode raw graphql responses", "error", err)
+		return
+	}
+
+	descriptor := fmt.Sprintf("%s/%s/%s/%s.json", s.location, commit.Organization, commit.Repository, commit.SHA)
+	if _, err := s.writer.Write(ctx, bytes.NewReader(b), descriptor); err != nil {
+		logger.WarnContext(ctx, "failed to write raw graphql responses",
+			"descriptor", descriptor,
+			"error", err)
+		return
+	}
+	logger.InfoContext(ctx, "captured raw graphql responses", "descriptor", descriptor)
+}
+
+// rawResponseRecorder records the bodies of the GraphQL responses received
+// while processing a sampled commit, in the order they were received.
+type rawResponseRecorder struct {
+	mu        sync.Mutex
+	responses []json.RawMessage
+}
+
+// add records a response body. Bodies that are not JSON, e.g. of a failed
+// request, are recorded as a JSON string.
+func (r *rawResponseRecorder) add(body []byte) {
+	response := json.RawMessage(body)
+	if !json.Valid(body) {
+		// encoding a string never fails
+		response, _ = json.Marshal(string(body))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = append(r.responses, response)
+}
+
+// all returns the recorded response bodies.
+func (r *rawResponseRecorder) all() []json.RawMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.responses
+}
+
+type rawResponseRecorderKey struct{}
+
+// withRawResponseRecorder returns a context whose GraphQL responses are
+// recorded by the recorder.
+func withRawResponseRecorder(ctx context.Context, recorder *rawResponseRecorder) context.Context {
+	return context.WithValue(ctx, rawResponseRecorderKey{}, recorder)
+}
+
+// rawResponseTransport records the bodies of the responses to the requests
+// whose context carries a [rawResponseRecorder]. Other requests are passed
+// through untouched.
+type rawResponseTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements [http.RoundTripper].
+func (t *rawResponseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // Want passthrough
+	}
+
+	recorder, ok := req.Context().Value(rawResponseRecorderKey{}).(*rawResponseRecorder)
+	if !ok {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	recorder.add(body)
+	return resp, nil
+}
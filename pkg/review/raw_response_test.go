@@ -0,0 +1,213 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shurcooL/githubv4"
+)
+
+// testObjectWriter keeps the written objects in memory, keyed by their
+// descriptor.
+type testObjectWriter struct {
+	mu      sync.Mutex
+	objects map[string]string
+}
+
+func (w *testObjectWriter) Write(ctx context.Context, content io.Reader, descriptor string) (string, error) {
+	b, err := io.ReadAll(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to read content: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.objects == nil {
+		w.objects = make(map[string]string)
+	}
+	w.objects[descriptor] = string(b)
+	return descriptor, nil
+}
+
+func TestRawResponseSampler_Sampled(t *testing.T) {
+	t.Parallel()
+
+	shas := make([]string, 10000)
+	for i := range shas {
+		shas[i] = fmt.Sprintf("%040x", i)
+	}
+
+	cases := []struct {
+		name        string
+		sampler     *RawResponseSampler
+		wantMin     int
+		wantMax     int
+		wantSampled []string
+	}{
+		{
+			name:    "nil_sampler",
+			wantMax: 0,
+		},
+		{
+			name:    "disabled",
+			sampler: NewRawResponseSampler(0, "gs://my-bucket", nil),
+			wantMax: 0,
+		},
+		{
+			name:    "all",
+			sampler: NewRawResponseSampler(1, "gs://my-bucket", nil),
+			wantMin: len(shas),
+			wantMax: len(shas),
+		},
+		{
+			name:    "one_percent",
+			sampler: NewRawResponseSampler(0.01, "gs://my-bucket", nil),
+			wantMin: 70,
+			wantMax: 130,
+		},
+		{
+			name:    "half",
+			sampler: NewRawResponseSampler(0.5, "gs://my-bucket", nil),
+			wantMin: 4800,
+			wantMax: 5200,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var sampled int
+			for _, sha := range shas {
+				got := tc.sampler.Sampled(sha)
+				if got {
+					sampled++
+				}
+
+				// the decision is the same on every run
+				if again := tc.sampler.Sampled(sha); again != got {
+					t.Fatalf("Sampled(%q) = %t, then %t", sha, got, again)
+				}
+			}
+			if sampled < tc.wantMin || sampled > tc.wantMax {
+				t.Errorf("expected between %d and %d sampled commits, got %d", tc.wantMin, tc.wantMax, sampled)
+			}
+		})
+	}
+}
+
+func TestRawResponseSampler_Sampled_SameCommitsAcrossSamplers(t *testing.T) {
+	t.Parallel()
+
+	// a commit sampled at a lower rate is sampled at any higher rate, and two
+	// samplers of the same rate sample the same commits
+	low := NewRawResponseSampler(0.1, "gs://my-bucket", nil)
+	high := NewRawResponseSampler(0.3, "gs://other-bucket", nil)
+	same := NewRawResponseSampler(0.1, "gs://other-bucket", nil)
+	for i := 0; i < 1000; i++ {
+		sha := fmt.Sprintf("%040x", i)
+		if low.Sampled(sha) && !high.Sampled(sha) {
+			t.Errorf("expected %q sampled at rate 0.1 to be sampled at rate 0.3", sha)
+		}
+		if low.Sampled(sha) != same.Sampled(sha) {
+			t.Errorf("expected %q to be sampled the same by samplers of the same rate", sha)
+		}
+	}
+}
+
+func TestProcessCommit_RawResponseCapture(t *testing.T) {
+	t.Parallel()
+
+	responseBody := `{"data":{"repository":{"defaultBranchRef":{"name":"main"},"object":{"associatedPullRequests":{"nodes":[],"pageInfo":{"hasNextPage":false},"totalCount":0}}}}}`
+
+	cases := []struct {
+		name        string
+		rate        float64
+		wantObjects map[string]string
+	}{
+		{
+			name: "sampled",
+			rate: 1,
+			wantObjects: map[string]string{
+				"gs://my-bucket/raw/test-org/test-repository/12345678.json": `{"organization":"test-org","repository":"test-repository","sha":"12345678","responses":[` + responseBody + `]}`,
+			},
+		},
+		{
+			name: "not_sampled",
+			rate: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			fakeGitHub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, responseBody)
+			}))
+			t.Cleanup(fakeGitHub.Close)
+
+			ctx := context.Background()
+			client := githubv4.NewEnterpriseClient(fakeGitHub.URL, &http.Client{
+				Transport: &rawResponseTransport{base: http.DefaultTransport},
+			})
+			writer := &testObjectWriter{}
+			sampler := NewRawResponseSampler(tc.rate, "gs://my-bucket/raw/", writer)
+
+			got := processCommit(ctx, client, nil, nil, sampler, defaultConfig, &Commit{
+				Organization: "test-org",
+				Repository:   "test-repository",
+				SHA:          "12345678",
+			})
+			if got == nil || got.ApprovalStatus != DefaultApprovalStatus {
+				t.Errorf("processCommit: expected commit with approval status %s, got %+v", DefaultApprovalStatus, got)
+			}
+
+			// compare the objects as JSON, the responses are embedded as is
+			gotObjects := make(map[string]any, len(writer.objects))
+			for descriptor, content := range writer.objects {
+				var v any
+				if err := json.Unmarshal([]byte(content), &v); err != nil {
+					t.Fatalf("failed to decode object %s: %v", descriptor, err)
+				}
+				gotObjects[descriptor] = v
+			}
+			wantObjects := make(map[string]any, len(tc.wantObjects))
+			for descriptor, content := range tc.wantObjects {
+				var v any
+				if err := json.Unmarshal([]byte(content), &v); err != nil {
+					t.Fatal(err)
+				}
+				wantObjects[descriptor] = v
+			}
+			if diff := cmp.Diff(gotObjects, wantObjects); diff != "" {
+				t.Errorf("written objects (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/shurcooL/githubv4"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// RepositoryAccessChecker checks whether the GitHub App can access a
+// repository.
+type RepositoryAccessChecker interface {
+	// HasAccess reports whether the repository can be accessed. An error is
+	// returned if access could not be determined, e.g. because GitHub is
+	// unavailable.
+	HasAccess(ctx context.Context, org, repository string) (bool, error)
+}
+
+// repositoryAccessQuery is the GraphQL query used to check access to a
+// repository.
+type repositoryAccessQuery struct {
+	Repository struct {
+		ID githubv4.ID
+	} `graphql:"repository(owner: $githubOrg, name: $repository)"`
+}
+
+// GitHubRepositoryAccessChecker checks access to repositories using the GitHub
+// GraphQL API. The access to a repository is checked the first time it is
+// looked up and cached for the lifetime of the checker, which is expected to be
+// a single job execution.
+type GitHubRepositoryAccessChecker struct {
+	client *githubv4.Client
+
+	mu    sync.Mutex
+	cache map[string]bool // org/repository -> has access
+}
+
+// NewGitHubRepositoryAccessChecker creates a checker that uses the given
+// GitHub GraphQL client.
+func NewGitHubRepositoryAccessChecker(client *githubv4.Client) *GitHubRepositoryAccessChecker {
+	return &GitHubRepositoryAccessChecker{
+		client: client,
+		cache:  make(map[string]bool),
+	}
+}
+
+// HasAccess implements [RepositoryAccessChecker].
+func (c *GitHubRepositoryAccessChecker) HasAccess(ctx context.Context, org, repository string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := org + "/" + repository
+	hasAccess, ok := c.cache[key]
+	if !ok {
+		var query repositoryAccessQuery
+		if err := c.client.Query(ctx, &query, map[string]any{
+			"githubOrg":  githubv4.String(org),
+			"repository": githubv4.String(repository),
+		}); err != nil {
+			err = graphQLError(err)
+			if !errors.Is(err, ErrAccessDenied) {
+				return false, fmt.Errorf("failed to check access to repository %s: %w", key, err)
+			}
+		} else {
+			hasAccess = true
+		}
+		c.cache[key] = hasAccess
+	}
+	return hasAccess, nil
+}
+
+// skipInaccessibleRepositories checks access to the repository of each commit
+// and returns the commits of the accessible repositories. The commits of an
+// inaccessible repository are skipped, instead a single review status with the
+// AccessDeniedStatus is returned for the first of them, so that the repository
+// is recorded without querying GitHub for each of its commits. The skipped
+// commits are processed again on the next pipeline execution, in case access
+// was granted in the meantime.
+//
+// Commits of repositories whose access could not be checked are returned to be
+// processed as usual. The commit URLs of the review statuses are those of the
+// GitHub instance of graphQLURL, as for [NewGitHubGraphQLClient].
+func skipInaccessibleRepositories(ctx context.Context, checker RepositoryAccessChecker, graphQLURL string, commits []*Commit) ([]*Commit, []*CommitReviewStatus) {
+	logger := logging.FromContext(ctx)
+
+	accessible := make([]*Commit, 0, len(commits))
+	var deniedStatuses []*CommitReviewStatus
+	denied := make(map[string]bool) // org/repository -> access denied
+	skipped := make(map[string]int) // org/repository -> skipped commits
+	for _, commit := range commits {
+		if commit == nil {
+			continue
+		}
+
+		key := commit.Organization + "/" + commit.Repository
+		if denied[key] {
+			skipped[key]++
+			continue
+		}
+
+		hasAccess, err := checker.HasAccess(ctx, commit.Organization, commit.Repository)
+		if err != nil {
+			logger.WarnContext(ctx, "failed to check repository access, processing commit as usual",
+				"error", err,
+				"repository", key,
+			)
+		}
+		if err != nil || hasAccess {
+			accessible = append(accessible, commit)
+			continue
+		}
+
+		denied[key] = true
+		deniedStatuses = append(deniedStatuses, &CommitReviewStatus{
+			Commit:         commit,
+			HTMLURL:        getCommitHTMLURL(graphQLURL, commit),
+			ApprovalStatus: AccessDeniedStatus,
+			BreakGlassURLs: make([]string, 0),
+		})
+	}
+
+	for _, status := range deniedStatuses {
+		key := status.Organization + "/" + status.Repository
+		status.Note = fmt.Sprintf("%s %s, skipped %d more of its commits", ErrAccessDenied, key, skipped[key])
+		logger.WarnContext(ctx, "skipping commits of repository without access",
+			"repository", key,
+			"skipped_commits", skipped[key]+1,
+		)
+	}
+	return accessible, deniedStatuses
+}
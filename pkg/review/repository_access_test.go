@@ -0,0 +1,165 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shurcooL/githubv4"
+)
+
+// fakeRepositoryAccessChecker checks access from a static map keyed by
+// repository and counts the checks per repository.
+type fakeRepositoryAccessChecker struct {
+	access map[string]bool
+	errs   map[string]error
+	checks map[string]int
+}
+
+func (f *fakeRepositoryAccessChecker) HasAccess(ctx context.Context, org, repository string) (bool, error) {
+	f.checks[repository]++
+	if err := f.errs[repository]; err != nil {
+		return false, err
+	}
+	return f.access[repository], nil
+}
+
+func TestGitHubRepositoryAccessChecker_HasAccess(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int64
+	fakeGitHub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		var body struct {
+			Variables map[string]any `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		switch body.Variables["repository"] {
+		case "public-repo":
+			fmt.Fprint(w, `{"data": {"repository": {"id": "R_1"}}}`)
+		case "private-repo":
+			fmt.Fprint(w, `{
+				"data": {"repository": null},
+				"errors": [{"type": "FORBIDDEN", "message": "Resource not accessible by integration"}]
+			}`)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(fakeGitHub.Close)
+
+	ctx := context.Background()
+	checker := NewGitHubRepositoryAccessChecker(githubv4.NewEnterpriseClient(fakeGitHub.URL, fakeGitHub.Client()))
+
+	for i := 0; i < 3; i++ {
+		hasAccess, err := checker.HasAccess(ctx, "test-org", "public-repo")
+		if err != nil {
+			t.Fatalf("HasAccess(public-repo) failed: %v", err)
+		}
+		if !hasAccess {
+			t.Errorf("expected access to public-repo")
+		}
+
+		hasAccess, err = checker.HasAccess(ctx, "test-org", "private-repo")
+		if err != nil {
+			t.Fatalf("HasAccess(private-repo) failed: %v", err)
+		}
+		if hasAccess {
+			t.Errorf("expected no access to private-repo")
+		}
+	}
+
+	// the access to each repository is only checked once
+	if got, want := requests.Load(), int64(2); got != want {
+		t.Errorf("expected %d requests, got %d", want, got)
+	}
+
+	// access that could not be checked is not cached
+	if _, err := checker.HasAccess(ctx, "test-org", "unavailable-repo"); err == nil {
+		t.Errorf("expected HasAccess(unavailable-repo) to fail")
+	}
+	if _, err := checker.HasAccess(ctx, "test-org", "unavailable-repo"); err == nil {
+		t.Errorf("expected HasAccess(unavailable-repo) to fail")
+	}
+	if got, want := requests.Load(), int64(4); got != want {
+		t.Errorf("expected %d requests, got %d", want, got)
+	}
+}
+
+func TestSkipInaccessibleRepositories(t *testing.T) {
+	t.Parallel()
+
+	commit := func(repository, sha string) *Commit {
+		return &Commit{Organization: "test-org", Repository: repository, SHA: sha}
+	}
+	commits := []*Commit{
+		commit("public-repo", "sha-1"),
+		commit("private-repo", "sha-2"),
+		commit("private-repo", "sha-3"),
+		commit("unavailable-repo", "sha-4"),
+		commit("public-repo", "sha-5"),
+		commit("private-repo", "sha-6"),
+	}
+
+	checker := &fakeRepositoryAccessChecker{
+		access: map[string]bool{"public-repo": true},
+		errs:   map[string]error{"unavailable-repo": errors.New("bad gateway")},
+		checks: make(map[string]int),
+	}
+
+	gotCommits, gotStatuses := skipInaccessibleRepositories(context.Background(), checker, "", commits)
+
+	// commits of repositories whose access could not be checked are processed
+	// as usual
+	wantCommits := []*Commit{commits[0], commits[3], commits[4]}
+	if diff := cmp.Diff(gotCommits, wantCommits); diff != "" {
+		t.Errorf("accessible commits (-got,+want):\n%s", diff)
+	}
+
+	wantStatuses := []*CommitReviewStatus{
+		{
+			Commit:         commits[1],
+			HTMLURL:        "https://github.com/test-org/private-repo/commit/sha-2",
+			ApprovalStatus: AccessDeniedStatus,
+			BreakGlassURLs: []string{},
+			Note:           "github denied access to the repository test-org/private-repo, skipped 2 more of its commits",
+		},
+	}
+	if diff := cmp.Diff(gotStatuses, wantStatuses); diff != "" {
+		t.Errorf("access denied statuses (-got,+want):\n%s", diff)
+	}
+
+	// the inaccessible repository is only checked once, not for each of its
+	// commits
+	if diff := cmp.Diff(checker.checks, map[string]int{
+		"public-repo":      2,
+		"private-repo":     1,
+		"unavailable-repo": 1,
+	}); diff != "" {
+		t.Errorf("access checks (-got,+want):\n%s", diff)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v61/github"
+)
+
+// RepositoryRenameResolver resolves the current name of a repository that may
+// have been renamed or transferred to another organization since its commits
+// were pushed.
+type RepositoryRenameResolver interface {
+	// CurrentName returns the current organization and name of the given
+	// repository, which are the given ones if it was not renamed.
+	CurrentName(ctx context.Context, org, repository string) (string, string, error)
+}
+
+// repositoryName is the organization and name of a repository.
+type repositoryName struct {
+	org  string
+	name string
+}
+
+// GitHubRepositoryRenameResolver resolves renamed repositories using the
+// GitHub Repositories API, which redirects requests for the previous name of a
+// repository to the repository. The name of a repository is fetched the first
+// time it is looked up and cached for the lifetime of the resolver, which is
+// expected to be a single job execution.
+type GitHubRepositoryRenameResolver struct {
+	client *github.Client
+
+	mu    sync.Mutex
+	cache map[repositoryName]repositoryName // previous name -> current name
+}
+
+// NewGitHubRepositoryRenameResolver creates a resolver that uses the given
+// GitHub REST client.
+func NewGitHubRepositoryRenameResolver(client *github.Client) *GitHubRepositoryRenameResolver {
+	return &GitHubRepositoryRenameResolver{
+		client: client,
+		cache:  make(map[repositoryName]repositoryName),
+	}
+}
+
+// CurrentName implements [RepositoryRenameResolver].
+func (r *GitHubRepositoryRenameResolver) CurrentName(ctx context.Context, org, repository string) (string, string, error) {
+	// Holding the lock while loading a repository ensures its name is only
+	// fetched once, even when many commits of the repository are processed
+	// concurrently.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := repositoryName{org: org, name: repository}
+	current, ok := r.cache[key]
+	if !ok {
+		// the client follows the redirect of a renamed repository
+		repo, _, err := r.client.Repositories.Get(ctx, org, repository)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get repository %s/%s: %w", org, repository, err)
+		}
+		current = repositoryName{org: repo.GetOwner().GetLogin(), name: repo.GetName()}
+		if current.org == "" || current.name == "" {
+			return "", "", fmt.Errorf("failed to get repository %s/%s: response has no owner or name", org, repository)
+		}
+		r.cache[key] = current
+	}
+	return current.org, current.name, nil
+}
+
+// isRepositoryNotFound reports whether the error of a GraphQL query is GitHub
+// failing to resolve its repository, e.g. because it was deleted or renamed.
+func isRepositoryNotFound(err error) bool {
+	if !strings.HasPrefix(err.Error(), "failed to call graphql") {
+		return false
+	}
+	unwrapped := errors.Unwrap(err)
+	return unwrapped != nil && strings.HasPrefix(unwrapped.Error(), "Could not resolve to a Repository")
+}
@@ -0,0 +1,229 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/abcxyz/pkg/testutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v61/github"
+	"github.com/shurcooL/githubv4"
+)
+
+// newFakeRenamedRepositoryGitHub serves the REST API of a repository
+// test-org/old-repo that was renamed to test-org/new-repo, and the GraphQL API
+// of the renamed repository. The number of REST requests is counted.
+func newFakeRenamedRepositoryGitHub(tb testing.TB, restRequests *atomic.Int64) *httptest.Server {
+	tb.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/test-org/old-repo", func(w http.ResponseWriter, r *http.Request) {
+		restRequests.Add(1)
+		http.Redirect(w, r, "/api/v3/repositories/42", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("GET /api/v3/repositories/42", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 42, "name": "new-repo", "owner": {"login": "test-org"}}`)
+	})
+	mux.HandleFunc("GET /api/v3/repos/test-org/new-repo", func(w http.ResponseWriter, r *http.Request) {
+		restRequests.Add(1)
+		fmt.Fprint(w, `{"id": 42, "name": "new-repo", "owner": {"login": "test-org"}}`)
+	})
+	mux.HandleFunc("GET /api/v3/repos/test-org/deleted-repo", func(w http.ResponseWriter, r *http.Request) {
+		restRequests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	})
+	mux.HandleFunc("POST /graphql", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Variables struct {
+				Repository string `json:"repository"`
+			} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Variables.Repository != "new-repo" {
+			fmt.Fprintf(w, `{"data": null, "errors": [{"type": "NOT_FOUND", "message": "Could not resolve to a Repository with the name 'test-org/%s'."}]}`, request.Variables.Repository)
+			return
+		}
+		fmt.Fprint(w, `{"data": {"repository": {"defaultBranchRef": {"name": "main"}, "object": {"associatedPullRequests": {"nodes": [{
+			"baseRefName": "main",
+			"fullDatabaseId": "7",
+			"number": 3,
+			"url": "https://github.com/test-org/new-repo/pull/3",
+			"reviews": {"nodes": [{"state": "APPROVED", "author": {"login": "reviewer"}}], "pageInfo": {"hasNextPage": false}}
+		}], "pageInfo": {"hasNextPage": false}, "totalCount": 1}}}}}`)
+	})
+	fakeGitHub := httptest.NewServer(mux)
+	tb.Cleanup(fakeGitHub.Close)
+	return fakeGitHub
+}
+
+func TestGitHubRepositoryRenameResolver_CurrentName(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int64
+	fakeGitHub := newFakeRenamedRepositoryGitHub(t, &requests)
+
+	client, err := github.NewClient(fakeGitHub.Client()).WithEnterpriseURLs(fakeGitHub.URL, fakeGitHub.URL)
+	if err != nil {
+		t.Fatalf("failed to create github client: %v", err)
+	}
+	resolver := NewGitHubRepositoryRenameResolver(client)
+
+	ctx := context.Background()
+	cases := []struct {
+		repository string
+		want       string
+		wantErr    string
+	}{
+		{
+			repository: "old-repo",
+			want:       "test-org/new-repo",
+		},
+		{
+			repository: "new-repo",
+			want:       "test-org/new-repo",
+		},
+		{
+			repository: "deleted-repo",
+			wantErr:    "failed to get repository test-org/deleted-repo",
+		},
+		// cached
+		{
+			repository: "old-repo",
+			want:       "test-org/new-repo",
+		},
+	}
+	for _, tc := range cases {
+		org, name, err := resolver.CurrentName(ctx, "test-org", tc.repository)
+		if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+			t.Errorf("CurrentName(%q): %s", tc.repository, diff)
+		}
+		if err != nil {
+			continue
+		}
+		if got := org + "/" + name; got != tc.want {
+			t.Errorf("CurrentName(%q): expected %q to be %q", tc.repository, got, tc.want)
+		}
+	}
+
+	// the rename of a repository is only looked up once
+	if got, want := requests.Load(), int64(3); got != want {
+		t.Errorf("expected %d requests to github, got %d", want, got)
+	}
+}
+
+func TestProcessCommit_RenamedRepository(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		repository string
+		resolve    bool
+		want       *CommitReviewStatus
+	}{
+		{
+			name:       "renamed",
+			repository: "old-repo",
+			resolve:    true,
+			want: &CommitReviewStatus{
+				Commit: &Commit{
+					Organization: "test-org",
+					Repository:   "old-repo",
+					SHA:          "12345678",
+				},
+				HTMLURL:            "https://github.com/test-org/old-repo/commit/12345678",
+				PullRequestID:      7,
+				PullRequestNumber:  3,
+				PullRequestHTMLURL: "https://github.com/test-org/new-repo/pull/3",
+				ApprovalStatus:     GithubPRApproved,
+				BreakGlassURLs:     []string{},
+				Note:               "repository test-org/old-repo was renamed to test-org/new-repo",
+			},
+		},
+		{
+			name:       "renames_not_resolved",
+			repository: "old-repo",
+			want: &CommitReviewStatus{
+				Commit: &Commit{
+					Organization: "test-org",
+					Repository:   "old-repo",
+					SHA:          "12345678",
+				},
+				HTMLURL:        "https://github.com/test-org/old-repo/commit/12345678",
+				ApprovalStatus: DefaultApprovalStatus,
+				BreakGlassURLs: []string{},
+				Note:           "Could not resolve to a Repository with the name 'test-org/old-repo'.",
+			},
+		},
+		{
+			name:       "deleted",
+			repository: "deleted-repo",
+			resolve:    true,
+			want: &CommitReviewStatus{
+				Commit: &Commit{
+					Organization: "test-org",
+					Repository:   "deleted-repo",
+					SHA:          "12345678",
+				},
+				HTMLURL:        "https://github.com/test-org/deleted-repo/commit/12345678",
+				ApprovalStatus: DefaultApprovalStatus,
+				BreakGlassURLs: []string{},
+				Note:           "Could not resolve to a Repository with the name 'test-org/deleted-repo'.",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests atomic.Int64
+			fakeGitHub := newFakeRenamedRepositoryGitHub(t, &requests)
+
+			ctx := context.Background()
+			client := githubv4.NewEnterpriseClient(fakeGitHub.URL+"/graphql", fakeGitHub.Client())
+
+			var renames RepositoryRenameResolver
+			if tc.resolve {
+				restClient, err := github.NewClient(fakeGitHub.Client()).WithEnterpriseURLs(fakeGitHub.URL, fakeGitHub.URL)
+				if err != nil {
+					t.Fatalf("failed to create github client: %v", err)
+				}
+				renames = NewGitHubRepositoryRenameResolver(restClient)
+			}
+
+			got := processCommit(ctx, client, nil, renames, nil, defaultConfig, &Commit{
+				Organization: "test-org",
+				Repository:   tc.repository,
+				SHA:          "12345678",
+			})
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("processCommit: unexpected result (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/abcxyz/github-metrics-aggregator/pkg/bq"
+	"github.com/abcxyz/github-metrics-aggregator/pkg/webhook"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// The names of the sinks.
+const (
+	// SinkUnapprovedCommits is the name of the sink that publishes unapproved
+	// commits to the UNAPPROVED_COMMITS_TOPIC_ID.
+	SinkUnapprovedCommits = "unapproved-commits"
+
+	// SinkCommitPullRequests is the name of the sink that writes the pull
+	// request of each commit to the COMMIT_PULL_REQUESTS_TABLE_ID.
+	SinkCommitPullRequests = "commit-pull-requests"
+)
+
+// sinkNames are the names of all sinks, which may be listed in OPTIONAL_SINKS.
+var sinkNames = []string{SinkUnapprovedCommits, SinkCommitPullRequests}
+
+// recordSink receives the review status of each processed commit before the
+// review statuses are written to BigQuery, e.g. to alert on unapproved
+// commits.
+type recordSink interface {
+	// write writes the review status of a single commit to the sink. It is
+	// called concurrently for different commits.
+	write(ctx context.Context, status *CommitReviewStatus) error
+}
+
+// namedSink is a record sink enabled for a pipeline execution.
+type namedSink struct {
+	name string
+	sink recordSink
+
+	// optional sinks don't hold back the review statuses they failed to write
+	// from being written to BigQuery.
+	optional bool
+}
+
+// unapprovedCommitsSink publishes the review statuses of unapproved commits
+// without a break glass issue to a pubsub topic.
+type unapprovedCommitsSink struct {
+	sender messageSender
+}
+
+func (s *unapprovedCommitsSink) write(ctx context.Context, status *CommitReviewStatus) error {
+	return publishUnapprovedCommit(ctx, s.sender, status)
+}
+
+// CommitPullRequest maps a commit to the pull request it was merged with, so
+// that queries don't need to recompute the association.
+type CommitPullRequest struct {
+	CommitSHA         string `bigquery:"commit_sha"`
+	PullRequestID     int64  `bigquery:"pull_request_id"`
+	PullRequestNumber int    `bigquery:"pull_request_number"`
+	PullRequestURL    string `bigquery:"pull_request_url"`
+}
+
+// commitPullRequestsSink writes the pull request of each commit to a BigQuery
+// table. Commits without a pull request are not written.
+type commitPullRequestsSink struct {
+	putter bq.Putter
+}
+
+func (s *commitPullRequestsSink) write(ctx context.Context, status *CommitReviewStatus) error {
+	if status.PullRequestID == 0 {
+		return nil
+	}
+
+	rows := []*CommitPullRequest{{
+		CommitSHA:         status.SHA,
+		PullRequestID:     status.PullRequestID,
+		PullRequestNumber: status.PullRequestNumber,
+		PullRequestURL:    status.PullRequestHTMLURL,
+	}}
+	if err := bq.PutWithRetry(ctx, s.putter, rows, nil); err != nil {
+		return fmt.Errorf("failed to write commit pull request: %w", err)
+	}
+	return nil
+}
+
+// newSinks creates the record sinks enabled by the config, the BigQuery
+// client is used by the sinks that write to BigQuery. The returned function
+// closes them.
+func newSinks(ctx context.Context, cfg *Config, bqClient *bq.BigQuery) ([]*namedSink, func(), error) {
+	var sinks []*namedSink
+	var closers []func() error
+	closeSinks := func() {
+		for _, c := range closers {
+			if err := c(); err != nil {
+				logging.FromContext(ctx).ErrorContext(ctx, "failed to close sink", "error", err)
+			}
+		}
+	}
+
+	if cfg.UnapprovedCommitsTopicID != "" {
+		messenger, err := webhook.NewPubSubMessenger(ctx, cfg.ProjectID, cfg.UnapprovedCommitsTopicID)
+		if err != nil {
+			closeSinks()
+			return nil, nil, fmt.Errorf("failed to create unapproved commits pubsub: %w", err)
+		}
+		closers = append(closers, messenger.Close)
+		sinks = append(sinks, &namedSink{
+			name: SinkUnapprovedCommits,
+			sink: &unapprovedCommitsSink{sender: messenger},
+		})
+	}
+
+	if cfg.CommitPullRequestsTableID != "" {
+		sinks = append(sinks, &namedSink{
+			name: SinkCommitPullRequests,
+			sink: &commitPullRequestsSink{putter: bqClient.Putter(cfg.CommitPullRequestsTableID)},
+		})
+	}
+
+	for _, sink := range sinks {
+		for _, name := range cfg.OptionalSinks {
+			if sink.name == name {
+				sink.optional = true
+			}
+		}
+	}
+	return sinks, closeSinks, nil
+}
+
+// writeToSinks writes each review status to all sinks, with the sinks of a
+// review status written concurrently and up to the given number of review
+// statuses at a time, so that a slow or failing sink does not hold up the
+// others. A failure is logged per sink and review status.
+//
+// The review statuses written to all required sinks are complete and returned
+// to be written to BigQuery. The others are dropped, so that their commits are
+// processed and written to the sinks again on the next pipeline execution,
+// rather than never.
+func writeToSinks(ctx context.Context, concurrency int64, sinks []*namedSink, statuses []*CommitReviewStatus) ([]*CommitReviewStatus, error) {
+	if len(sinks) == 0 {
+		return statuses, nil
+	}
+
+	logger := logging.FromContext(ctx)
+
+	complete, err := pooledTransform(ctx, max(concurrency, 1), statuses,
+		func(status *CommitReviewStatus) (*CommitReviewStatus, error) {
+			errs := make([]error, len(sinks))
+			var wg sync.WaitGroup
+			for i, sink := range sinks {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs[i] = sink.sink.write(ctx, status)
+				}()
+			}
+			wg.Wait()
+
+			isComplete := true
+			for i, err := range errs {
+				if err == nil {
+					continue
+				}
+				logger.ErrorContext(ctx, "failed to write commit review status to sink",
+					"error", err,
+					"sink", sinks[i].name,
+					"optional", sinks[i].optional,
+					"commit_sha", status.SHA,
+				)
+				if !sinks[i].optional {
+					isComplete = false
+				}
+			}
+			if !isComplete {
+				return nil, nil
+			}
+			return status, nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write to sinks: %w", err)
+	}
+	return complete, nil
+}
@@ -0,0 +1,261 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeRecordSink records the SHAs of the review statuses written to it. It
+// fails the writes of the SHAs in errs and blocks the writes until unblock is
+// closed, if set.
+type fakeRecordSink struct {
+	errs    map[string]error
+	unblock chan struct{}
+
+	mu      sync.Mutex
+	written []string
+}
+
+func (s *fakeRecordSink) write(ctx context.Context, status *CommitReviewStatus) error {
+	if s.unblock != nil {
+		select {
+		case <-s.unblock:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := s.errs[status.SHA]; err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written = append(s.written, status.SHA)
+	return nil
+}
+
+func (s *fakeRecordSink) writtenSHAs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shas := append([]string(nil), s.written...)
+	sort.Strings(shas)
+	return shas
+}
+
+func TestWriteToSinks(t *testing.T) {
+	t.Parallel()
+
+	statuses := []*CommitReviewStatus{
+		{Commit: &Commit{SHA: "a"}},
+		{Commit: &Commit{SHA: "b"}},
+		{Commit: &Commit{SHA: "c"}},
+	}
+
+	cases := []struct {
+		name         string
+		primaryErrs  map[string]error
+		withSinks    bool
+		optionalErrs map[string]error
+		wantComplete []string
+		wantPrimary  []string
+		wantOptional []string
+	}{
+		{
+			name:         "no_sinks",
+			wantComplete: []string{"a", "b", "c"},
+		},
+		{
+			name:         "all_succeed",
+			withSinks:    true,
+			wantComplete: []string{"a", "b", "c"},
+			wantPrimary:  []string{"a", "b", "c"},
+			wantOptional: []string{"a", "b", "c"},
+		},
+		{
+			name:         "required_sink_fails",
+			primaryErrs:  map[string]error{"b": fmt.Errorf("boom")},
+			withSinks:    true,
+			wantComplete: []string{"a", "c"},
+			wantPrimary:  []string{"a", "c"},
+			wantOptional: []string{"a", "b", "c"},
+		},
+		{
+			name:         "optional_sink_fails",
+			withSinks:    true,
+			optionalErrs: map[string]error{"a": fmt.Errorf("boom"), "c": fmt.Errorf("boom")},
+			wantComplete: []string{"a", "b", "c"},
+			wantPrimary:  []string{"a", "b", "c"},
+			wantOptional: []string{"b"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			primary := &fakeRecordSink{errs: tc.primaryErrs}
+			optional := &fakeRecordSink{errs: tc.optionalErrs}
+
+			var sinks []*namedSink
+			if tc.withSinks {
+				sinks = []*namedSink{
+					{name: "primary", sink: primary},
+					{name: "optional", sink: optional, optional: true},
+				}
+			}
+
+			complete, err := writeToSinks(context.Background(), 2, sinks, statuses)
+			if err != nil {
+				t.Fatalf("writeToSinks failed: %v", err)
+			}
+
+			var got []string
+			for _, status := range complete {
+				got = append(got, status.SHA)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(got, tc.wantComplete); diff != "" {
+				t.Errorf("complete review statuses (-got,+want):\n%s", diff)
+			}
+			if diff := cmp.Diff(primary.writtenSHAs(), tc.wantPrimary); diff != "" {
+				t.Errorf("primary sink (-got,+want):\n%s", diff)
+			}
+			if diff := cmp.Diff(optional.writtenSHAs(), tc.wantOptional); diff != "" {
+				t.Errorf("optional sink (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteToSinks_SlowSinkDoesNotBlockOthers(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	slow := &fakeRecordSink{unblock: make(chan struct{})}
+	fast := &fakeRecordSink{}
+	sinks := []*namedSink{
+		{name: "slow", sink: slow},
+		{name: "fast", sink: fast},
+	}
+	statuses := []*CommitReviewStatus{{Commit: &Commit{SHA: "a"}}}
+
+	done := make(chan []*CommitReviewStatus)
+	go func() {
+		complete, err := writeToSinks(ctx, 1, sinks, statuses)
+		if err != nil {
+			t.Errorf("writeToSinks failed: %v", err)
+		}
+		done <- complete
+	}()
+
+	// the fast sink is written while the slow sink is still blocked
+	for len(fast.writtenSHAs()) == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("fast sink was not written while the slow sink was blocked")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	close(slow.unblock)
+
+	if got, want := len(<-done), 1; got != want {
+		t.Errorf("expected %d complete review statuses, got %d", want, got)
+	}
+	if diff := cmp.Diff(slow.writtenSHAs(), []string{"a"}); diff != "" {
+		t.Errorf("slow sink (-got,+want):\n%s", diff)
+	}
+}
+
+// fakePutter records the rows put into it.
+type fakePutter struct {
+	mu   sync.Mutex
+	rows []*CommitPullRequest
+}
+
+func (p *fakePutter) Put(ctx context.Context, src any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rows, ok := src.([]*CommitPullRequest)
+	if !ok {
+		return fmt.Errorf("unexpected rows of type %T", src)
+	}
+	p.rows = append(p.rows, rows...)
+	return nil
+}
+
+func TestCommitPullRequestsSink(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cases := []struct {
+		name   string
+		status *CommitReviewStatus
+		want   []*CommitPullRequest
+	}{
+		{
+			name: "pull_request",
+			status: &CommitReviewStatus{
+				Commit:             &Commit{SHA: "abc123", Organization: "test-org", Repository: "test-repo"},
+				PullRequestID:      42,
+				PullRequestNumber:  7,
+				PullRequestHTMLURL: "https://github.com/test-org/test-repo/pull/7",
+				ApprovalStatus:     GithubPRApproved,
+			},
+			want: []*CommitPullRequest{{
+				CommitSHA:         "abc123",
+				PullRequestID:     42,
+				PullRequestNumber: 7,
+				PullRequestURL:    "https://github.com/test-org/test-repo/pull/7",
+			}},
+		},
+		{
+			name: "no_pull_request",
+			status: &CommitReviewStatus{
+				Commit:         &Commit{SHA: "abc123", Organization: "test-org", Repository: "test-repo"},
+				ApprovalStatus: DefaultApprovalStatus,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			putter := &fakePutter{}
+			sink := &commitPullRequestsSink{putter: putter}
+			if err := sink.write(ctx, tc.status); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+			if diff := cmp.Diff(putter.rows, tc.want); diff != "" {
+				t.Errorf("written rows (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
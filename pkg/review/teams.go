@@ -0,0 +1,216 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/google/go-github/v61/github"
+	"golang.org/x/oauth2"
+)
+
+// TeamMembershipResolver resolves the teams of a GitHub organization that a
+// user is a member of.
+type TeamMembershipResolver interface {
+	// TeamsForUser returns the slugs of the teams in the given organization the
+	// user is a member of. A user that is not a member of any team of the
+	// organization has an unknown team membership and nil is returned.
+	TeamsForUser(ctx context.Context, org, login string) ([]string, error)
+}
+
+// GitHubTeamMembershipResolver resolves team memberships using the GitHub
+// Teams API. The memberships of all teams of an organization are fetched the
+// first time the organization is looked up and cached for the lifetime of the
+// resolver, which is expected to be a single job execution.
+type GitHubTeamMembershipResolver struct {
+	client *github.Client
+
+	mu    sync.Mutex
+	cache map[string]map[string][]string // org -> normalized login -> team slugs
+}
+
+// NewGitHubTeamMembershipResolver creates a resolver that uses the given
+// GitHub REST client.
+func NewGitHubTeamMembershipResolver(client *github.Client) *GitHubTeamMembershipResolver {
+	return &GitHubTeamMembershipResolver{
+		client: client,
+		cache:  make(map[string]map[string][]string),
+	}
+}
+
+// TeamsForUser implements [TeamMembershipResolver].
+func (r *GitHubTeamMembershipResolver) TeamsForUser(ctx context.Context, org, login string) ([]string, error) {
+	// Holding the lock while loading an organization ensures its teams are only
+	// fetched once, even when many commits of the organization are processed
+	// concurrently.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	memberships, ok := r.cache[org]
+	if !ok {
+		var err error
+		memberships, err = r.loadMemberships(ctx, org)
+		if err != nil {
+			return nil, err
+		}
+		r.cache[org] = memberships
+	}
+	return memberships[normalizeLogin(login)], nil
+}
+
+// loadMemberships fetches all teams of the given organization and their
+// members, and returns the sorted team slugs of each member keyed by their
+// normalized login.
+func (r *GitHubTeamMembershipResolver) loadMemberships(ctx context.Context, org string) (map[string][]string, error) {
+	var teams []*github.Team
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := r.client.Teams.ListTeams(ctx, org, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list teams for organization %q: %w", org, err)
+		}
+		teams = append(teams, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	memberships := make(map[string][]string)
+	for _, team := range teams {
+		slug := team.GetSlug()
+		opts := &github.TeamListTeamMembersOptions{
+			ListOptions: github.ListOptions{PerPage: 100},
+		}
+		for {
+			members, resp, err := r.client.Teams.ListTeamMembersBySlug(ctx, org, slug, opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list members of team %q: %w", slug, err)
+			}
+			for _, member := range members {
+				login := normalizeLogin(member.GetLogin())
+				memberships[login] = append(memberships[login], slug)
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+	}
+
+	for _, slugs := range memberships {
+		sort.Strings(slugs)
+	}
+	return memberships, nil
+}
+
+// NewGitHubRESTClient creates a GitHub REST client authenticated with the
+// given access token. If graphQLURL is empty the client targets github.com,
+// otherwise it targets the GitHub Enterprise Server instance serving the given
+// GraphQL endpoint.
+func NewGitHubRESTClient(ctx context.Context, accessToken, graphQLURL string) (*github.Client, error) {
+	src := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: accessToken},
+	)
+	client := github.NewClient(oauth2.NewClient(ctx, src))
+	if graphQLURL == "" {
+		return client, nil
+	}
+
+	u, err := url.Parse(graphQLURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse graphql url: %w", err)
+	}
+	// The REST API of a GitHub Enterprise Server instance is served from
+	// /api/v3/ on the same host, which WithEnterpriseURLs appends.
+	baseURL := fmt.Sprintf("%s://%s/", u.Scheme, u.Host)
+	client, err = client.WithEnterpriseURLs(baseURL, baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure enterprise urls: %w", err)
+	}
+	return client, nil
+}
+
+// getApprovingTeams finds a set of distinct teams of the organization such
+// that each team is represented by a different approving reviewer of the pull
+// request. A reviewer that belongs to several teams can only represent one of
+// them, so a single reviewer cannot satisfy the distinct-team requirement on
+// their own. Approvals from excluded bots and from reviewers with unknown team
+// membership do not represent any team.
+//
+// The returned teams are sorted, and are the largest such set that could be
+// found, so the requirement is satisfied when there are at least as many teams
+// as the policy requires. The logins of approving reviewers with unknown team
+// membership are returned as well.
+func getApprovingTeams(ctx context.Context, resolver TeamMembershipResolver, org string, request *PullRequest, policy *approvalPolicy) ([]string, []string, error) {
+	states := latestReviewStates(request)
+	approvers := make([]string, 0, len(states))
+	for login, state := range states {
+		if state == GithubPRApproved && !policy.isExcludedBot(login) {
+			approvers = append(approvers, login)
+		}
+	}
+	// Sort for a deterministic result since the same team may be reachable
+	// through different reviewers.
+	sort.Strings(approvers)
+
+	unknown := make([]string, 0)
+	reviewerTeams := make(map[string][]string, len(approvers))
+	for _, login := range approvers {
+		teams, err := resolver.TeamsForUser(ctx, org, login)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve teams of reviewer %q: %w", login, err)
+		}
+		if len(teams) == 0 {
+			unknown = append(unknown, login)
+			continue
+		}
+		reviewerTeams[login] = teams
+	}
+
+	// Assigning reviewers to teams is a bipartite matching problem. Find a
+	// maximum matching using augmenting paths, which is cheap for the handful
+	// of reviewers a pull request has.
+	teamReviewer := make(map[string]string)
+	var assign func(login string, visited map[string]bool) bool
+	assign = func(login string, visited map[string]bool) bool {
+		for _, team := range reviewerTeams[login] {
+			if visited[team] {
+				continue
+			}
+			visited[team] = true
+			current, taken := teamReviewer[team]
+			if !taken || assign(current, visited) {
+				teamReviewer[team] = login
+				return true
+			}
+		}
+		return false
+	}
+	for _, login := range approvers {
+		assign(login, make(map[string]bool))
+	}
+
+	teams := make([]string, 0, len(teamReviewer))
+	for team := range teamReviewer {
+		teams = append(teams, team)
+	}
+	sort.Strings(teams)
+	return teams, unknown, nil
+}
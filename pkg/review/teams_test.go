@@ -0,0 +1,246 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v61/github"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// fakeTeamMembershipResolver resolves team memberships from a static map
+// keyed by login.
+type fakeTeamMembershipResolver struct {
+	teams map[string][]string
+	err   error
+}
+
+func (f *fakeTeamMembershipResolver) TeamsForUser(ctx context.Context, org, login string) ([]string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.teams[login], nil
+}
+
+func TestGetApprovingTeams(t *testing.T) {
+	t.Parallel()
+
+	resolver := &fakeTeamMembershipResolver{
+		teams: map[string][]string{
+			"alice":         {"team-a"},
+			"bob":           {"team-a"},
+			"carol":         {"team-b"},
+			"dave":          {"team-a", "team-b"},
+			"erin":          {"team-a", "team-b", "team-c"},
+			"renovate[bot]": {"team-c"},
+		},
+	}
+
+	cases := []struct {
+		name        string
+		reviews     map[string]string
+		policy      *approvalPolicy
+		resolver    TeamMembershipResolver
+		wantTeams   []string
+		wantUnknown []string
+		wantErr     string
+	}{
+		{
+			name: "approvers_from_distinct_teams",
+			reviews: map[string]string{
+				"alice": GithubPRApproved,
+				"carol": GithubPRApproved,
+			},
+			policy:      &approvalPolicy{requiredDistinctTeams: 2},
+			resolver:    resolver,
+			wantTeams:   []string{"team-a", "team-b"},
+			wantUnknown: []string{},
+		},
+		{
+			name: "approvers_from_single_team",
+			reviews: map[string]string{
+				"alice": GithubPRApproved,
+				"bob":   GithubPRApproved,
+			},
+			policy:      &approvalPolicy{requiredDistinctTeams: 2},
+			resolver:    resolver,
+			wantTeams:   []string{"team-a"},
+			wantUnknown: []string{},
+		},
+		{
+			name: "single_reviewer_in_many_teams_represents_one_team",
+			reviews: map[string]string{
+				"erin": GithubPRApproved,
+			},
+			policy:      &approvalPolicy{requiredDistinctTeams: 2},
+			resolver:    resolver,
+			wantTeams:   []string{"team-a"},
+			wantUnknown: []string{},
+		},
+		{
+			name: "reviewers_reassigned_to_cover_most_teams",
+			reviews: map[string]string{
+				// Sorted first, alice can only represent team-a, so dave must
+				// represent team-b.
+				"alice": GithubPRApproved,
+				"dave":  GithubPRApproved,
+				"erin":  GithubPRApproved,
+			},
+			policy:      &approvalPolicy{requiredDistinctTeams: 3},
+			resolver:    resolver,
+			wantTeams:   []string{"team-a", "team-b", "team-c"},
+			wantUnknown: []string{},
+		},
+		{
+			name: "non_approving_reviews_ignored",
+			reviews: map[string]string{
+				"alice": GithubPRApproved,
+				"carol": GithubPRChangesRequested,
+				"dave":  GithubPRDismissed,
+			},
+			policy:      &approvalPolicy{requiredDistinctTeams: 2},
+			resolver:    resolver,
+			wantTeams:   []string{"team-a"},
+			wantUnknown: []string{},
+		},
+		{
+			name: "unknown_team_membership",
+			reviews: map[string]string{
+				"alice":    GithubPRApproved,
+				"stranger": GithubPRApproved,
+			},
+			policy:      &approvalPolicy{requiredDistinctTeams: 2},
+			resolver:    resolver,
+			wantTeams:   []string{"team-a"},
+			wantUnknown: []string{"stranger"},
+		},
+		{
+			name: "excluded_bots_ignored",
+			reviews: map[string]string{
+				"alice":         GithubPRApproved,
+				"renovate[bot]": GithubPRApproved,
+			},
+			policy: &approvalPolicy{
+				requiredDistinctTeams: 2,
+				excludedBots:          regexp.MustCompile(`\[bot\]$`),
+			},
+			resolver:    resolver,
+			wantTeams:   []string{"team-a"},
+			wantUnknown: []string{},
+		},
+		{
+			name: "resolver_error",
+			reviews: map[string]string{
+				"alice": GithubPRApproved,
+			},
+			policy:   &approvalPolicy{requiredDistinctTeams: 2},
+			resolver: &fakeTeamMembershipResolver{err: fmt.Errorf("boom")},
+			wantErr:  `failed to resolve teams of reviewer "alice": boom`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			pullRequest := &PullRequest{}
+			for login, state := range tc.reviews {
+				pullRequest.Reviews.Nodes = append(pullRequest.Reviews.Nodes, newTestReview(login, state))
+			}
+
+			gotTeams, gotUnknown, err := getApprovingTeams(context.Background(), tc.resolver, "test-org", pullRequest, tc.policy)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(gotTeams, tc.wantTeams); diff != "" {
+				t.Errorf("getApprovingTeams: unexpected teams (-got,+want):\n%s", diff)
+			}
+			if diff := cmp.Diff(gotUnknown, tc.wantUnknown); diff != "" {
+				t.Errorf("getApprovingTeams: unexpected unknown reviewers (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGitHubTeamMembershipResolver_TeamsForUser(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/orgs/test-org/teams", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `[{"slug": "team-a"}, {"slug": "team-b"}]`)
+	})
+	mux.HandleFunc("GET /api/v3/orgs/test-org/teams/team-a/members", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `[{"login": "Alice"}, {"login": "dave"}]`)
+	})
+	mux.HandleFunc("GET /api/v3/orgs/test-org/teams/team-b/members", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `[{"login": "carol"}, {"login": "dave"}]`)
+	})
+	mux.HandleFunc("GET /api/v3/orgs/missing-org/teams", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	})
+	fakeGitHub := httptest.NewServer(mux)
+	t.Cleanup(fakeGitHub.Close)
+
+	client, err := github.NewClient(fakeGitHub.Client()).WithEnterpriseURLs(fakeGitHub.URL, fakeGitHub.URL)
+	if err != nil {
+		t.Fatalf("failed to create github client: %v", err)
+	}
+	resolver := NewGitHubTeamMembershipResolver(client)
+
+	ctx := context.Background()
+	cases := []struct {
+		login string
+		want  []string
+	}{
+		{login: "alice", want: []string{"team-a"}},
+		{login: "carol", want: []string{"team-b"}},
+		{login: "Dave", want: []string{"team-a", "team-b"}},
+		{login: "stranger", want: nil},
+	}
+	for _, tc := range cases {
+		got, err := resolver.TeamsForUser(ctx, "test-org", tc.login)
+		if err != nil {
+			t.Fatalf("TeamsForUser(%q) failed: %v", tc.login, err)
+		}
+		if diff := cmp.Diff(got, tc.want); diff != "" {
+			t.Errorf("TeamsForUser(%q): unexpected result (-got,+want):\n%s", tc.login, diff)
+		}
+	}
+
+	// The organization's teams are only fetched once.
+	if got, want := requests.Load(), int64(3); got != want {
+		t.Errorf("expected %d requests to github, got %d", want, got)
+	}
+
+	if _, err := resolver.TeamsForUser(ctx, "missing-org", "alice"); err == nil {
+		t.Errorf("TeamsForUser: expected error for missing organization")
+	}
+}
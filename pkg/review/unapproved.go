@@ -0,0 +1,84 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// messageSender sends a message to a pubsub topic, it is implemented by
+// [webhook.PubSubMessenger].
+type messageSender interface {
+	Send(ctx context.Context, msg []byte) error
+}
+
+// UnapprovedCommitMessage is the message published for each commit that
+// landed without approval and without a break glass issue.
+type UnapprovedCommitMessage struct {
+	Organization       string    `json:"organization"`
+	Repository         string    `json:"repository"`
+	Branch             string    `json:"branch"`
+	SHA                string    `json:"commit_sha"`
+	HTMLURL            string    `json:"commit_html_url"`
+	Author             string    `json:"author"`
+	Timestamp          time.Time `json:"commit_timestamp"`
+	ApprovalStatus     string    `json:"approval_status"`
+	PullRequestHTMLURL string    `json:"pull_request_html_url,omitempty"`
+	Note               string    `json:"note,omitempty"`
+}
+
+// isUnapprovedWithoutBreakGlass reports whether the commit was not approved
+// and is not covered by a break glass issue either. Commits approved by merge
+// count as approved.
+func isUnapprovedWithoutBreakGlass(commitReviewStatus *CommitReviewStatus) bool {
+	switch commitReviewStatus.ApprovalStatus {
+	case GithubPRApproved, ApprovedByMergeStatus:
+		return false
+	}
+	return len(commitReviewStatus.BreakGlassURLs) == 0
+}
+
+// publishUnapprovedCommit publishes a message for the given commit review
+// status if it is unapproved and has no break glass issue, so that it can be
+// alerted on without waiting for the BigQuery tables.
+func publishUnapprovedCommit(ctx context.Context, sender messageSender, status *CommitReviewStatus) error {
+	if !isUnapprovedWithoutBreakGlass(status) {
+		return nil
+	}
+
+	msg, err := json.Marshal(&UnapprovedCommitMessage{
+		Organization:       status.Organization,
+		Repository:         status.Repository,
+		Branch:             status.Branch,
+		SHA:                status.SHA,
+		HTMLURL:            status.HTMLURL,
+		Author:             status.Author,
+		Timestamp:          status.Timestamp,
+		ApprovalStatus:     status.ApprovalStatus,
+		PullRequestHTMLURL: status.PullRequestHTMLURL,
+		Note:               status.Note,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal unapproved commit message: %w", err)
+	}
+
+	if err := sender.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to publish unapproved commit %s: %w", status.SHA, err)
+	}
+	return nil
+}
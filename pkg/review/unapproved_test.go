@@ -0,0 +1,162 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// fakeMessageSender records the messages sent to it.
+type fakeMessageSender struct {
+	messages [][]byte
+	err      error
+}
+
+func (f *fakeMessageSender) Send(ctx context.Context, msg []byte) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.messages = append(f.messages, msg)
+	return nil
+}
+
+func TestPublishUnapprovedCommits(t *testing.T) {
+	t.Parallel()
+
+	timestamp := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	newStatus := func(sha, approvalStatus string, breakGlassURLs ...string) *CommitReviewStatus {
+		return &CommitReviewStatus{
+			Commit: &Commit{
+				Author:       "test-author",
+				Organization: "test-org",
+				Repository:   "test-repo",
+				Branch:       "main",
+				SHA:          sha,
+				Timestamp:    timestamp,
+			},
+			HTMLURL:        "https://github.com/test-org/test-repo/commit/" + sha,
+			ApprovalStatus: approvalStatus,
+			BreakGlassURLs: append(make([]string, 0), breakGlassURLs...),
+		}
+	}
+
+	statuses := []*CommitReviewStatus{
+		newStatus("approved", GithubPRApproved),
+		newStatus("unknown", DefaultApprovalStatus),
+		newStatus("break-glass", DefaultApprovalStatus, "https://github.com/test-org/test-repo/issues/1"),
+		newStatus("changes-requested", GithubPRChangesRequested),
+		newStatus("non-owner", ApprovedByNonOwnerStatus),
+	}
+	statuses[3].PullRequestHTMLURL = "https://github.com/test-org/test-repo/pull/2"
+
+	cases := []struct {
+		name        string
+		statuses    []*CommitReviewStatus
+		sendErr     error
+		expMessages []*UnapprovedCommitMessage
+		expErr      string
+	}{
+		{
+			name:     "only_unapproved_without_break_glass",
+			statuses: statuses,
+			expMessages: []*UnapprovedCommitMessage{
+				{
+					Organization:   "test-org",
+					Repository:     "test-repo",
+					Branch:         "main",
+					SHA:            "unknown",
+					HTMLURL:        "https://github.com/test-org/test-repo/commit/unknown",
+					Author:         "test-author",
+					Timestamp:      timestamp,
+					ApprovalStatus: DefaultApprovalStatus,
+				},
+				{
+					Organization:       "test-org",
+					Repository:         "test-repo",
+					Branch:             "main",
+					SHA:                "changes-requested",
+					HTMLURL:            "https://github.com/test-org/test-repo/commit/changes-requested",
+					Author:             "test-author",
+					Timestamp:          timestamp,
+					ApprovalStatus:     GithubPRChangesRequested,
+					PullRequestHTMLURL: "https://github.com/test-org/test-repo/pull/2",
+				},
+				{
+					Organization:   "test-org",
+					Repository:     "test-repo",
+					Branch:         "main",
+					SHA:            "non-owner",
+					HTMLURL:        "https://github.com/test-org/test-repo/commit/non-owner",
+					Author:         "test-author",
+					Timestamp:      timestamp,
+					ApprovalStatus: ApprovedByNonOwnerStatus,
+				},
+			},
+		},
+		{
+			name:     "none_qualifying",
+			statuses: statuses[:1],
+		},
+		{
+			name:     "approved_by_merge_not_published",
+			statuses: []*CommitReviewStatus{newStatus("approved-by-merge", ApprovedByMergeStatus)},
+		},
+		{
+			name:     "send_error",
+			statuses: statuses,
+			sendErr:  fmt.Errorf("boom"),
+			expErr:   "failed to publish unapproved commit unknown: boom",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sender := &fakeMessageSender{err: tc.sendErr}
+			var err error
+			for _, status := range tc.statuses {
+				if err = publishUnapprovedCommit(context.Background(), sender, status); err != nil {
+					break
+				}
+			}
+			if diff := testutil.DiffErrString(err, tc.expErr); diff != "" {
+				t.Fatal(diff)
+			}
+
+			var got []*UnapprovedCommitMessage
+			for _, msg := range sender.messages {
+				var m UnapprovedCommitMessage
+				if err := json.Unmarshal(msg, &m); err != nil {
+					t.Fatalf("failed to unmarshal message %q: %v", msg, err)
+				}
+				got = append(got, &m)
+			}
+			if diff := cmp.Diff(got, tc.expMessages); diff != "" {
+				t.Errorf("published messages (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
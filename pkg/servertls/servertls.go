@@ -0,0 +1,159 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package servertls configures the servers to serve HTTPS directly, for
+// deployments that are not behind a load balancer terminating TLS.
+package servertls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/abcxyz/pkg/serving"
+)
+
+// DefaultMinVersion is the minimum TLS version used when none is configured.
+const DefaultMinVersion = "1.2"
+
+// versions maps the configurable TLS versions to their crypto/tls constants.
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Config configures the TLS of a server. TLS is disabled unless a certificate
+// is configured.
+type Config struct {
+	// CertFile and KeyFile are the paths of the PEM encoded certificate chain
+	// and private key of the server.
+	CertFile string
+	KeyFile  string
+
+	// MinVersion is the minimum TLS version accepted, e.g. "1.2".
+	MinVersion string
+
+	// CipherSuites are the names of the cipher suites accepted for TLS 1.2 and
+	// lower, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256". The Go defaults are
+	// accepted unless set. The cipher suites of TLS 1.3 are not configurable.
+	CipherSuites []string
+}
+
+// Enabled reports whether the server serves HTTPS directly.
+func (cfg *Config) Enabled() bool {
+	return cfg.CertFile != "" || cfg.KeyFile != ""
+}
+
+// Validate validates the TLS config. The names of the environment variables
+// are used in the errors, since the config is loaded from them.
+func (cfg *Config) Validate() error {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	if _, err := parseMinVersion(cfg.MinVersion); err != nil {
+		return fmt.Errorf("invalid TLS_MIN_VERSION: %w", err)
+	}
+
+	if _, err := parseCipherSuites(cfg.CipherSuites); err != nil {
+		return fmt.Errorf("invalid TLS_CIPHER_SUITES: %w", err)
+	}
+	return nil
+}
+
+// TLSConfig loads the certificate and returns the TLS config of the server,
+// or nil if TLS is not enabled.
+func (cfg *Config) TLSConfig() (*tls.Config, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	minVersion, err := parseMinVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid minimum TLS version: %w", err)
+	}
+
+	cipherSuites, err := parseCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cipher suites: %w", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+	}, nil
+}
+
+// NewServer creates the serving infrastructure listening on the given port,
+// which serves HTTPS with the TLS config if it is enabled and HTTP otherwise.
+func NewServer(port string, cfg *Config) (*serving.Server, error) {
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		return serving.New(port) //nolint:wrapcheck // Want passthrough
+	}
+
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on port %s: %w", port, err)
+	}
+	return serving.NewFromListener(tls.NewListener(listener, tlsConfig)) //nolint:wrapcheck // Want passthrough
+}
+
+// parseMinVersion returns the TLS version of the given name, or the default
+// minimum version if it is empty.
+func parseMinVersion(name string) (uint16, error) {
+	if name == "" {
+		name = DefaultMinVersion
+	}
+
+	version, ok := versions[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, must be one of 1.0, 1.1, 1.2 or 1.3", name)
+	}
+	return version, nil
+}
+
+// parseCipherSuites returns the IDs of the cipher suites with the given names.
+// Only the cipher suites without known security issues are accepted.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
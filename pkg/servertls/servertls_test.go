@@ -0,0 +1,208 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servertls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abcxyz/pkg/testutil"
+)
+
+// writeCertificate writes a self-signed certificate for localhost and its
+// private key to the given directory and returns their paths.
+func writeCertificate(tb testing.TB, dir string) (string, string) {
+	tb.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tb.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		tb.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		tb.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		tb.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		tb.Fatalf("failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		cfg     *Config
+		wantErr string
+	}{
+		{
+			name: "disabled",
+			cfg:  &Config{},
+		},
+		{
+			name: "valid",
+			cfg: &Config{
+				CertFile:     "cert.pem",
+				KeyFile:      "key.pem",
+				MinVersion:   "1.3",
+				CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+			},
+		},
+		{
+			name:    "missing_key_file",
+			cfg:     &Config{CertFile: "cert.pem"},
+			wantErr: "TLS_CERT_FILE and TLS_KEY_FILE must be set together",
+		},
+		{
+			name:    "invalid_min_version",
+			cfg:     &Config{MinVersion: "TLS1.2"},
+			wantErr: `invalid TLS_MIN_VERSION: unknown TLS version "TLS1.2"`,
+		},
+		{
+			name:    "insecure_cipher_suite",
+			cfg:     &Config{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+			wantErr: `invalid TLS_CIPHER_SUITES: unknown or insecure cipher suite "TLS_RSA_WITH_RC4_128_SHA"`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := testutil.DiffErrString(tc.cfg.Validate(), tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	t.Parallel()
+
+	certFile, keyFile := writeCertificate(t, t.TempDir())
+	cfg := &Config{
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		MinVersion: "1.3",
+	}
+
+	server, err := NewServer("0", cfg)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		_ = server.StartHTTPHandler(ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}()
+
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+
+	get := func(maxVersion uint16) (*http.Response, error) {
+		client := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: roots, MaxVersion: maxVersion},
+			},
+		}
+		return client.Get("https://127.0.0.1:" + server.Port()) //nolint:noctx // test request
+	}
+
+	resp, err := get(tls.VersionTLS13)
+	if err != nil {
+		t.Fatalf("failed to connect with TLS 1.3: %v", err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusNoContent; got != want {
+		t.Errorf("expected status %d, got %d", want, got)
+	}
+	if got, want := resp.TLS.Version, uint16(tls.VersionTLS13); got != want {
+		t.Errorf("expected TLS version %x, got %x", want, got)
+	}
+
+	if resp, err := get(tls.VersionTLS12); err == nil {
+		resp.Body.Close()
+		t.Errorf("expected connecting with TLS 1.2 to fail below the minimum version")
+	}
+}
+
+func TestNewServer_Disabled(t *testing.T) {
+	t.Parallel()
+
+	server, err := NewServer("0", &Config{})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		_ = server.StartHTTPHandler(ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}()
+
+	resp, err := http.Get("http://127.0.0.1:" + server.Port()) //nolint:noctx // test request
+	if err != nil {
+		t.Fatalf("failed to connect over HTTP: %v", err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusNoContent; got != want {
+		t.Errorf("expected status %d, got %d", want, got)
+	}
+}
@@ -25,6 +25,8 @@ import (
 	"cloud.google.com/go/bigquery"
 	"google.golang.org/api/iterator"
 
+	bqutil "github.com/abcxyz/github-metrics-aggregator/pkg/bq"
+
 	_ "embed"
 )
 
@@ -34,6 +36,12 @@ import (
 //go:embed sql/publisher_source.sql
 var PublisherSourceQuery string
 
+// ReviewStatusSourceQuery is the source query of the merged pull requests
+// whose review status the teeth job pipeline comments on.
+//
+//go:embed sql/review_status_source.sql
+var ReviewStatusSourceQuery string
+
 // TODO: Add query limit param.
 //
 // BQConfig defines configuration parameters for the BigQuery client
@@ -46,8 +54,35 @@ type BQConfig struct {
 	InvocationCommentStatusTable string
 	EventsTable                  string
 	LeechStatusTable             string
+
+	// CommitReviewStatusTable is the table of the review statuses of commits,
+	// which are commented on the pull requests they were merged with.
+	CommitReviewStatusTable string
+
+	// PutRetry configures the retries of inserts that failed with a transient
+	// error, bqutil.DefaultPutRetryConfig is used if nil.
+	PutRetry *bqutil.PutRetryConfig
+
+	// EventsLookback is how far back the workflow run events of pull requests
+	// are queried, 30 days if 0.
+	EventsLookback time.Duration
+
+	// MergedLookback is how far back merged pull requests are queried, 30 days
+	// if 0.
+	MergedLookback time.Duration
+
+	// MergedDelay is how long after being merged pull requests are queried,
+	// so that the workflow runs of their merge have finished, 1 hour if 0.
+	MergedDelay time.Duration
 }
 
+// The time windows of the source queries used when none are configured.
+const (
+	defaultEventsLookback = 30 * 24 * time.Hour
+	defaultMergedLookback = 30 * 24 * time.Hour
+	defaultMergedDelay    = time.Hour
+)
+
 // PublisherSourceRecord maps the columns from the source query
 // to a struct.
 type PublisherSourceRecord struct {
@@ -59,6 +94,19 @@ type PublisherSourceRecord struct {
 	HeadSHA        string    `bigquery:"head_sha"`
 }
 
+// ReviewStatusSourceRecord maps the columns of the review status source query
+// to a struct.
+type ReviewStatusSourceRecord struct {
+	PullRequestID     int      `bigquery:"pull_request_id"`
+	PullRequestNumber int      `bigquery:"pull_request_number"`
+	PullRequestURL    string   `bigquery:"pull_request_html_url"`
+	Organization      string   `bigquery:"organization"`
+	Repository        string   `bigquery:"repository"`
+	MergeCommitSHA    string   `bigquery:"merge_commit_sha"`
+	ApprovalStatus    string   `bigquery:"approval_status"`
+	BreakGlassURLs    []string `bigquery:"break_glass_issue_urls"`
+}
+
 // InvocationCommentStatusRecord is the output data structure that maps to the
 // teeth pipeline's output table schema for invocation comment statuses.
 type InvocationCommentStatusRecord struct {
@@ -72,9 +120,10 @@ type InvocationCommentStatusRecord struct {
 
 // BigQuery provides a client to BigQuery API.
 type BigQuery struct {
-	config      *BQConfig
-	client      *bigquery.Client
-	sourceQuery string
+	config            *BQConfig
+	client            *bigquery.Client
+	sourceQuery       string
+	reviewStatusQuery string
 }
 
 // NewBigQuery creates a new instance of a BigQuery client with config.
@@ -87,16 +136,44 @@ func NewBigQuery(ctx context.Context, config *BQConfig) (*BigQuery, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to populate publisher source query: %w", err)
 	}
+	rq, err := populateReviewStatusSourceQuery(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to populate review status source query: %w", err)
+	}
 	return &BigQuery{
-		config:      config,
-		client:      c,
-		sourceQuery: q,
+		config:            config,
+		client:            c,
+		sourceQuery:       q,
+		reviewStatusQuery: rq,
 	}, nil
 }
 
 func populatePublisherSourceQuery(ctx context.Context, config *BQConfig) (string, error) {
+	return populateQuery("publisher", PublisherSourceQuery, config)
+}
+
+func populateReviewStatusSourceQuery(ctx context.Context, config *BQConfig) (string, error) {
+	return populateQuery("review_status", ReviewStatusSourceQuery, config)
+}
+
+// populateQuery executes the sql template with the fully qualified names of
+// the tables and the time windows of the config.
+func populateQuery(name, query string, config *BQConfig) (string, error) {
+	eventsLookback, err := window("EventsLookback", config.EventsLookback, defaultEventsLookback)
+	if err != nil {
+		return "", err
+	}
+	mergedLookback, err := window("MergedLookback", config.MergedLookback, defaultMergedLookback)
+	if err != nil {
+		return "", err
+	}
+	mergedDelay, err := window("MergedDelay", config.MergedDelay, defaultMergedDelay)
+	if err != nil {
+		return "", err
+	}
+
 	tablePrefix := fmt.Sprintf("%s.%s.", config.ProjectID, config.DatasetID)
-	tmpl, err := template.New("publisher").Parse(PublisherSourceQuery)
+	tmpl, err := template.New(name).Parse(query)
 	if err != nil {
 		return "", fmt.Errorf("failed to set up sql template: %w", err)
 	}
@@ -106,12 +183,41 @@ func populatePublisherSourceQuery(ctx context.Context, config *BQConfig) (string
 		"InvocationCommentStatusTable": tablePrefix + config.InvocationCommentStatusTable,
 		"EventsTable":                  tablePrefix + config.EventsTable,
 		"LeechStatusTable":             tablePrefix + config.LeechStatusTable,
+		"CommitReviewStatusTable":      tablePrefix + config.CommitReviewStatusTable,
+		"ReviewStatusCommentJobName":   ReviewStatusCommentJobName,
+		"EventsLookback":               eventsLookback,
+		"MergedLookback":               mergedLookback,
+		"MergedDelay":                  mergedDelay,
 	}); err != nil {
 		return "", fmt.Errorf("failed to execute sql template: %w", err)
 	}
 	return b.String(), nil
 }
 
+// window returns the negated interval of the time window d to add to the
+// current timestamp in sql, e.g. "-30 DAY", or of def if d is 0.
+func window(name string, d, def time.Duration) (string, error) {
+	if d < 0 {
+		return "", fmt.Errorf("%s must be non-negative, got %s", name, d)
+	}
+	if d == 0 {
+		d = def
+	}
+
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("-%d DAY", d/(24*time.Hour)), nil
+	case d%time.Hour == 0:
+		return fmt.Sprintf("-%d HOUR", d/time.Hour), nil
+	case d%time.Minute == 0:
+		return fmt.Sprintf("-%d MINUTE", d/time.Minute), nil
+	case d%time.Second == 0:
+		return fmt.Sprintf("-%d SECOND", d/time.Second), nil
+	default:
+		return fmt.Sprintf("-%d MICROSECOND", d/time.Microsecond), nil
+	}
+}
+
 // Close closes the BigQuery client.
 func (bq *BigQuery) Close() error {
 	if err := bq.client.Close(); err != nil {
@@ -123,15 +229,26 @@ func (bq *BigQuery) Close() error {
 // QueryLatest executes the source query for the latest PublisherSourceRecords
 // to process.
 func (bq *BigQuery) QueryLatest(ctx context.Context) ([]*PublisherSourceRecord, error) {
+	return queryAll[PublisherSourceRecord](ctx, bq.client, bq.sourceQuery)
+}
+
+// QueryReviewStatuses executes the review status source query for the merged
+// pull requests whose review status is not commented yet.
+func (bq *BigQuery) QueryReviewStatuses(ctx context.Context) ([]*ReviewStatusSourceRecord, error) {
+	return queryAll[ReviewStatusSourceRecord](ctx, bq.client, bq.reviewStatusQuery)
+}
+
+// queryAll executes the query and maps each row of its results to a T.
+func queryAll[T any](ctx context.Context, client *bigquery.Client, query string) ([]*T, error) {
 	// below copied from https://pkg.go.dev/cloud.google.com/go/bigquery#hdr-Querying
-	q := bq.client.Query(bq.sourceQuery)
+	q := client.Query(query)
 	it, err := q.Read(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read: %w", err)
 	}
-	var results []*PublisherSourceRecord
+	var results []*T
 	for {
-		var r PublisherSourceRecord
+		var r T
 		err := it.Next(&r)
 		if errors.Is(err, iterator.Done) {
 			break
@@ -149,7 +266,7 @@ func (bq *BigQuery) Insert(ctx context.Context, statuses []*InvocationCommentSta
 	datasetID := bq.config.DatasetID
 	tableID := bq.config.InvocationCommentStatusTable
 	inserter := bq.client.Dataset(datasetID).Table(tableID).Inserter()
-	if err := inserter.Put(ctx, statuses); err != nil {
+	if err := bqutil.PutWithRetry(ctx, inserter, statuses, bq.config.PutRetry); err != nil {
 		return fmt.Errorf("failed to insert statuses: %w", err)
 	}
 	return nil
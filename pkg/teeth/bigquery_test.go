@@ -17,23 +17,28 @@ package teeth
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+
+	"github.com/abcxyz/pkg/testutil"
 )
 
 const (
-	testProjectID              = "github_metrics_aggregator"
-	testDatasetID              = "1234-asdf-9876"
-	testPullRequestEventsTable = "pull_request_events"
-	testEventsTable            = "events"
-	testLeechTable             = "leech_status"
-	testInvocationCommentTable = "invocation_comment_status"
+	testProjectID               = "github_metrics_aggregator"
+	testDatasetID               = "1234-asdf-9876"
+	testPullRequestEventsTable  = "pull_request_events"
+	testEventsTable             = "events"
+	testLeechTable              = "leech_status"
+	testInvocationCommentTable  = "invocation_comment_status"
+	testCommitReviewStatusTable = "commit_review_status"
 )
 
 func TestPopulatePublisherSourceQuery(t *testing.T) {
 	t.Parallel()
 
-	want := `-- Copyright 2024 The Authors (see AUTHORS file)
+	wantQuery := func(eventsLookback, mergedLookback, mergedDelay string) string {
+		return `-- Copyright 2024 The Authors (see AUTHORS file)
 --
 -- Licensed under the Apache License, Version 2.0 (the "License");
 -- you may not use this file except in compliance with the License.
@@ -72,7 +77,7 @@ JOIN (
       ` + "`" + testProjectID + "." + testDatasetID + "." + testEventsTable + "`" + ` events,
       UNNEST(JSON_EXTRACT_ARRAY(events.payload.workflow_run.pull_requests)) AS pull_request
     WHERE
-      received >= TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -30 DAY)) AS events
+      received >= TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL ` + eventsLookback + `)) AS events
   USING
     (delivery_id)) AS delivery_events
 ON
@@ -82,27 +87,142 @@ WHERE
   SELECT
     DISTINCT pull_request_id
   FROM
-    ` + "`" + testProjectID + "." + testDatasetID + "." + testInvocationCommentTable + "`" + ` invocation_comment_status)
-  AND merged_at BETWEEN TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -30 DAY)
-  AND TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -1 HOUR)
+    ` + "`" + testProjectID + "." + testDatasetID + "." + testInvocationCommentTable + "`" + ` invocation_comment_status
+  WHERE
+    job_name IS DISTINCT FROM 'review_status_comment')
+  AND merged_at BETWEEN TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL ` + mergedLookback + `)
+  AND TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL ` + mergedDelay + `)
 ORDER BY
   received, 
   pull_request_events.id ASC
 `
+	}
+
+	cases := []struct {
+		name           string
+		eventsLookback time.Duration
+		mergedLookback time.Duration
+		mergedDelay    time.Duration
+		want           string
+		wantErr        string
+	}{
+		{
+			name: "default_windows",
+			want: wantQuery("-30 DAY", "-30 DAY", "-1 HOUR"),
+		},
+		{
+			name:           "custom_windows",
+			eventsLookback: 7 * 24 * time.Hour,
+			mergedLookback: 36 * time.Hour,
+			mergedDelay:    15 * time.Minute,
+			want:           wantQuery("-7 DAY", "-36 HOUR", "-15 MINUTE"),
+		},
+		{
+			name:           "sub_minute_windows",
+			eventsLookback: 90 * time.Second,
+			mergedLookback: 24 * time.Hour,
+			mergedDelay:    1500 * time.Millisecond,
+			want:           wantQuery("-90 SECOND", "-1 DAY", "-1500000 MICROSECOND"),
+		},
+		{
+			name:        "negative_window",
+			mergedDelay: -time.Hour,
+			wantErr:     "MergedDelay must be non-negative, got -1h0m0s",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := &BQConfig{
+				ProjectID:                    testProjectID,
+				DatasetID:                    testDatasetID,
+				PullRequestEventsTable:       testPullRequestEventsTable,
+				InvocationCommentStatusTable: testInvocationCommentTable,
+				EventsTable:                  testEventsTable,
+				LeechStatusTable:             testLeechTable,
+				EventsLookback:               tc.eventsLookback,
+				MergedLookback:               tc.mergedLookback,
+				MergedDelay:                  tc.mergedDelay,
+			}
+			q, err := populatePublisherSourceQuery(context.Background(), config)
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(tc.want, q); diff != "" {
+				t.Errorf("embedded source query mismatch  (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPopulateReviewStatusSourceQuery(t *testing.T) {
+	t.Parallel()
+
+	want := `-- Copyright 2024 The Authors (see AUTHORS file)
+--
+-- Licensed under the Apache License, Version 2.0 (the "License");
+-- you may not use this file except in compliance with the License.
+-- You may obtain a copy of the License at
+--
+--     http://www.apache.org/licenses/LICENSE-2.0
+--
+-- Unless required by applicable law or agreed to in writing, software
+-- distributed under the License is distributed on an "AS IS" BASIS,
+-- WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+-- See the License for the specific language governing permissions and
+-- limitations under the License.
+SELECT
+  pull_request_events.id AS pull_request_id,
+  pull_request_events.number AS pull_request_number,
+  pull_request_events.html_url AS pull_request_html_url,
+  pull_request_events.organization,
+  pull_request_events.repository,
+  pull_request_events.merge_commit_sha,
+  commit_review_status.approval_status,
+  commit_review_status.break_glass_issue_urls
+FROM
+  ` + "`" + testProjectID + "." + testDatasetID + "." + testPullRequestEventsTable + "`" + ` AS pull_request_events
+JOIN
+  ` + "`" + testProjectID + "." + testDatasetID + "." + testCommitReviewStatusTable + "`" + ` AS commit_review_status
+ON
+  commit_review_status.organization = pull_request_events.organization
+  AND commit_review_status.repository = pull_request_events.repository
+  AND commit_review_status.commit_sha = pull_request_events.merge_commit_sha
+WHERE
+  pull_request_events.merged
+  AND pull_request_events.id NOT IN (
+  SELECT
+    DISTINCT pull_request_id
+  FROM
+    ` + "`" + testProjectID + "." + testDatasetID + "." + testInvocationCommentTable + "`" + ` invocation_comment_status
+  WHERE
+    job_name = 'review_status_comment'
+    AND status != 'FAILURE')
+  AND pull_request_events.merged_at BETWEEN TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -30 DAY)
+  AND TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -1 HOUR)
+QUALIFY
+  ROW_NUMBER() OVER (PARTITION BY pull_request_events.id ORDER BY pull_request_events.received DESC) = 1
+ORDER BY
+  pull_request_events.merged_at,
+  pull_request_events.id ASC
+`
 
 	config := &BQConfig{
 		ProjectID:                    testProjectID,
 		DatasetID:                    testDatasetID,
 		PullRequestEventsTable:       testPullRequestEventsTable,
 		InvocationCommentStatusTable: testInvocationCommentTable,
-		EventsTable:                  testEventsTable,
-		LeechStatusTable:             testLeechTable,
+		CommitReviewStatusTable:      testCommitReviewStatusTable,
 	}
-	q, err := populatePublisherSourceQuery(context.Background(), config)
+	q, err := populateReviewStatusSourceQuery(context.Background(), config)
 	if err != nil {
-		t.Errorf("SetUpPublisherSourceQuery returned unexpected error: %v", err)
+		t.Errorf("populateReviewStatusSourceQuery returned unexpected error: %v", err)
 	}
 	if diff := cmp.Diff(want, q); diff != "" {
-		t.Errorf("embedded source query mismatch  (-want +got):\n%s", diff)
+		t.Errorf("embedded review status source query mismatch  (-want +got):\n%s", diff)
 	}
 }
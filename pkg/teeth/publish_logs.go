@@ -26,6 +26,7 @@ import (
 // BigQuery tables.
 type BigQueryClient interface {
 	QueryLatest(context.Context) ([]*PublisherSourceRecord, error)
+	QueryReviewStatuses(context.Context) ([]*ReviewStatusSourceRecord, error)
 	Insert(context.Context, []*InvocationCommentStatusRecord) error
 }
 
@@ -38,6 +39,16 @@ func GetLatestSourceRecords(ctx context.Context, bqClient BigQueryClient) ([]*Pu
 	return res, nil
 }
 
+// GetReviewStatusSourceRecords gets the merged pull requests whose review
+// status is not commented yet.
+func GetReviewStatusSourceRecords(ctx context.Context, bqClient BigQueryClient) ([]*ReviewStatusSourceRecord, error) {
+	res, err := bqClient.QueryReviewStatuses(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query with bigquery client: %w", err)
+	}
+	return res, nil
+}
+
 // SaveInvocationCommentStatus inserts the statuses into the
 // InvocationCommentStatus table.
 func SaveInvocationCommentStatus(ctx context.Context, bqClient BigQueryClient, statuses []*InvocationCommentStatusRecord) error {
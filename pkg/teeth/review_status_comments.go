@@ -0,0 +1,174 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package teeth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-github/v61/github"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// ReviewStatusCommentJobName is the job name the statuses of review status
+// comments are recorded with in the InvocationCommentStatusTable.
+const ReviewStatusCommentJobName = "review_status_comment"
+
+// reviewStatusCommentMarker is an invisible marker in each review status
+// comment, so that a pull request is not commented on twice.
+const reviewStatusCommentMarker = "<!-- github-metrics-aggregator:review-status -->"
+
+// The statuses recorded for each pull request the review status is commented
+// on. Pull requests whose comment failed are commented on again by the next
+// run.
+const (
+	ReviewStatusCommentSuccess = "SUCCESS"
+	ReviewStatusCommentSkipped = "SKIPPED"
+	ReviewStatusCommentFailure = "FAILURE"
+)
+
+// IssueCommenter lists and creates comments on pull requests, it is
+// implemented by [github.IssuesService].
+type IssueCommenter interface {
+	ListComments(ctx context.Context, owner, repo string, number int, opts *github.IssueListCommentsOptions) ([]*github.IssueComment, *github.Response, error)
+	CreateComment(ctx context.Context, owner, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error)
+}
+
+// CommentReviewStatuses comments the review status summary of each record on
+// its merged pull request and returns the status of each comment, to be saved
+// with [SaveInvocationCommentStatus]. A pull request is only commented on once,
+// records of the same pull request are skipped, as are pull requests that
+// already have a review status comment, e.g. because saving the status of the
+// comment failed. Every record is attempted even if commenting on another one
+// failed.
+func CommentReviewStatuses(ctx context.Context, issues IssueCommenter, records []*ReviewStatusSourceRecord, now time.Time) []*InvocationCommentStatusRecord {
+	logger := logging.FromContext(ctx)
+
+	seen := make(map[int]struct{}, len(records))
+	statuses := make([]*InvocationCommentStatusRecord, 0, len(records))
+	for _, record := range records {
+		if _, ok := seen[record.PullRequestID]; ok {
+			continue
+		}
+		seen[record.PullRequestID] = struct{}{}
+
+		status := &InvocationCommentStatusRecord{
+			PullRequestID:  record.PullRequestID,
+			PullRequestURL: record.PullRequestURL,
+			ProcessedAt:    now,
+			JobName:        ReviewStatusCommentJobName,
+		}
+		statuses = append(statuses, status)
+
+		commentID, err := commentReviewStatus(ctx, issues, record)
+		switch {
+		case err != nil:
+			logger.ErrorContext(ctx, "failed to comment review status on pull request",
+				"pull_request_html_url", record.PullRequestURL,
+				"error", err)
+			status.Status = ReviewStatusCommentFailure
+		case commentID == 0:
+			logger.InfoContext(ctx, "skipping review status comment already posted",
+				"pull_request_html_url", record.PullRequestURL)
+			status.Status = ReviewStatusCommentSkipped
+		default:
+			status.Status = ReviewStatusCommentSuccess
+			status.CommentID = bigquery.NullInt64{Int64: commentID, Valid: true}
+		}
+	}
+	return statuses
+}
+
+// commentReviewStatus comments the review status summary of the record on its
+// pull request and returns the id of the comment, or 0 if the pull request
+// already has a review status comment.
+func commentReviewStatus(ctx context.Context, issues IssueCommenter, record *ReviewStatusSourceRecord) (int64, error) {
+	commented, err := hasReviewStatusComment(ctx, issues, record)
+	if err != nil {
+		return 0, err
+	}
+	if commented {
+		return 0, nil
+	}
+
+	comment, _, err := issues.CreateComment(ctx, record.Organization, record.Repository, record.PullRequestNumber, &github.IssueComment{
+		Body: github.String(reviewStatusComment(record)),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to comment on pull request: %w", err)
+	}
+	return comment.GetID(), nil
+}
+
+// hasReviewStatusComment reports whether the pull request of the record
+// already has a review status comment.
+func hasReviewStatusComment(ctx context.Context, issues IssueCommenter, record *ReviewStatusSourceRecord) (bool, error) {
+	opts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		comments, resp, err := issues.ListComments(ctx, record.Organization, record.Repository, record.PullRequestNumber, opts)
+		if err != nil {
+			return false, fmt.Errorf("failed to list comments on pull request: %w", err)
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.GetBody(), reviewStatusCommentMarker) {
+				return true, nil
+			}
+		}
+		if resp == nil || resp.NextPage == 0 {
+			return false, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// reviewSummary returns whether the merge commit of the record was approved,
+// merged with a break glass issue or has an unknown review status.
+func reviewSummary(record *ReviewStatusSourceRecord) string {
+	switch {
+	// the approval statuses of the commit_review_status table
+	case record.ApprovalStatus == "APPROVED" || record.ApprovalStatus == "APPROVED_BY_MERGE":
+		return "approved"
+	case len(record.BreakGlassURLs) > 0:
+		return "break glass"
+	default:
+		return "unknown"
+	}
+}
+
+// reviewStatusComment returns the review status summary comment of the
+// record.
+func reviewStatusComment(record *ReviewStatusSourceRecord) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, reviewStatusCommentMarker)
+	fmt.Fprintf(&b, "**Review status** of merge commit %s: **%s**", record.MergeCommitSHA, reviewSummary(record))
+	if record.ApprovalStatus != "" {
+		fmt.Fprintf(&b, " (`%s`)", record.ApprovalStatus)
+	}
+	fmt.Fprintln(&b)
+	if len(record.BreakGlassURLs) > 0 {
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, "Break glass issues:")
+		for _, url := range record.BreakGlassURLs {
+			fmt.Fprintf(&b, "- %s\n", url)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,170 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package teeth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v61/github"
+)
+
+// fakeIssueCommenter serves the existing comments of each pull request number
+// on pages of one comment, and records the created comments.
+type fakeIssueCommenter struct {
+	comments  map[int][]string
+	createErr map[int]error
+
+	created map[int]string
+	nextID  int64
+}
+
+func (f *fakeIssueCommenter) ListComments(ctx context.Context, owner, repo string, number int, opts *github.IssueListCommentsOptions) ([]*github.IssueComment, *github.Response, error) {
+	comments := f.comments[number]
+	page := max(opts.Page, 1)
+	resp := &github.Response{}
+	if page < len(comments) {
+		resp.NextPage = page + 1
+	}
+	if page > len(comments) {
+		return nil, resp, nil
+	}
+	return []*github.IssueComment{{Body: github.String(comments[page-1])}}, resp, nil
+}
+
+func (f *fakeIssueCommenter) CreateComment(ctx context.Context, owner, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	if err := f.createErr[number]; err != nil {
+		return nil, nil, err
+	}
+	if f.created == nil {
+		f.created = make(map[int]string)
+	}
+	f.created[number] = comment.GetBody()
+	f.nextID++
+	return &github.IssueComment{ID: github.Int64(f.nextID)}, &github.Response{}, nil
+}
+
+func TestCommentReviewStatuses(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	approved := &ReviewStatusSourceRecord{
+		PullRequestID:     101,
+		PullRequestNumber: 1,
+		PullRequestURL:    "https://github.com/test-org/test-repo/pull/1",
+		Organization:      "test-org",
+		Repository:        "test-repo",
+		MergeCommitSHA:    "aaaa",
+		ApprovalStatus:    "APPROVED",
+	}
+	breakGlass := &ReviewStatusSourceRecord{
+		PullRequestID:     102,
+		PullRequestNumber: 2,
+		PullRequestURL:    "https://github.com/test-org/test-repo/pull/2",
+		Organization:      "test-org",
+		Repository:        "test-repo",
+		MergeCommitSHA:    "bbbb",
+		ApprovalStatus:    "REVIEW_REQUIRED",
+		BreakGlassURLs:    []string{"https://github.com/test-org/breakglass/issues/7"},
+	}
+	unknown := &ReviewStatusSourceRecord{
+		PullRequestID:     103,
+		PullRequestNumber: 3,
+		PullRequestURL:    "https://github.com/test-org/test-repo/pull/3",
+		Organization:      "test-org",
+		Repository:        "test-repo",
+		MergeCommitSHA:    "cccc",
+		ApprovalStatus:    "UNKNOWN",
+	}
+
+	cases := []struct {
+		name         string
+		records      []*ReviewStatusSourceRecord
+		comments     map[int][]string
+		createErr    map[int]error
+		wantStatuses []*InvocationCommentStatusRecord
+		wantCreated  map[int]string
+	}{
+		{
+			name:    "comments_summaries",
+			records: []*ReviewStatusSourceRecord{approved, breakGlass, unknown},
+			wantStatuses: []*InvocationCommentStatusRecord{
+				{PullRequestID: 101, PullRequestURL: approved.PullRequestURL, ProcessedAt: now, CommentID: bigquery.NullInt64{Int64: 1, Valid: true}, Status: ReviewStatusCommentSuccess, JobName: ReviewStatusCommentJobName},
+				{PullRequestID: 102, PullRequestURL: breakGlass.PullRequestURL, ProcessedAt: now, CommentID: bigquery.NullInt64{Int64: 2, Valid: true}, Status: ReviewStatusCommentSuccess, JobName: ReviewStatusCommentJobName},
+				{PullRequestID: 103, PullRequestURL: unknown.PullRequestURL, ProcessedAt: now, CommentID: bigquery.NullInt64{Int64: 3, Valid: true}, Status: ReviewStatusCommentSuccess, JobName: ReviewStatusCommentJobName},
+			},
+			wantCreated: map[int]string{
+				1: reviewStatusCommentMarker + "\n**Review status** of merge commit aaaa: **approved** (`APPROVED`)\n",
+				2: reviewStatusCommentMarker + "\n**Review status** of merge commit bbbb: **break glass** (`REVIEW_REQUIRED`)\n\nBreak glass issues:\n- https://github.com/test-org/breakglass/issues/7\n",
+				3: reviewStatusCommentMarker + "\n**Review status** of merge commit cccc: **unknown** (`UNKNOWN`)\n",
+			},
+		},
+		{
+			name:    "duplicate_records_commented_once",
+			records: []*ReviewStatusSourceRecord{approved, approved},
+			wantStatuses: []*InvocationCommentStatusRecord{
+				{PullRequestID: 101, PullRequestURL: approved.PullRequestURL, ProcessedAt: now, CommentID: bigquery.NullInt64{Int64: 1, Valid: true}, Status: ReviewStatusCommentSuccess, JobName: ReviewStatusCommentJobName},
+			},
+			wantCreated: map[int]string{
+				1: reviewStatusCommentMarker + "\n**Review status** of merge commit aaaa: **approved** (`APPROVED`)\n",
+			},
+		},
+		{
+			name:    "already_commented_skipped",
+			records: []*ReviewStatusSourceRecord{approved},
+			comments: map[int][]string{
+				1: {"LGTM", "logs are available", reviewStatusCommentMarker + "\n**Review status** of merge commit aaaa: **approved**"},
+			},
+			wantStatuses: []*InvocationCommentStatusRecord{
+				{PullRequestID: 101, PullRequestURL: approved.PullRequestURL, ProcessedAt: now, Status: ReviewStatusCommentSkipped, JobName: ReviewStatusCommentJobName},
+			},
+		},
+		{
+			name:    "failed_comment_does_not_stop_others",
+			records: []*ReviewStatusSourceRecord{approved, unknown},
+			createErr: map[int]error{
+				1: errors.New("403 Resource not accessible by integration"),
+			},
+			wantStatuses: []*InvocationCommentStatusRecord{
+				{PullRequestID: 101, PullRequestURL: approved.PullRequestURL, ProcessedAt: now, Status: ReviewStatusCommentFailure, JobName: ReviewStatusCommentJobName},
+				{PullRequestID: 103, PullRequestURL: unknown.PullRequestURL, ProcessedAt: now, CommentID: bigquery.NullInt64{Int64: 1, Valid: true}, Status: ReviewStatusCommentSuccess, JobName: ReviewStatusCommentJobName},
+			},
+			wantCreated: map[int]string{
+				3: reviewStatusCommentMarker + "\n**Review status** of merge commit cccc: **unknown** (`UNKNOWN`)\n",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			issues := &fakeIssueCommenter{comments: tc.comments, createErr: tc.createErr}
+			got := CommentReviewStatuses(context.Background(), issues, tc.records, now)
+			if diff := cmp.Diff(got, tc.wantStatuses); diff != "" {
+				t.Errorf("statuses (-got,+want):\n%s", diff)
+			}
+			if diff := cmp.Diff(issues.created, tc.wantCreated); diff != "" {
+				t.Errorf("created comments (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
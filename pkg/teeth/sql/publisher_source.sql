@@ -37,7 +37,7 @@ JOIN (
       `{{.EventsTable}}` events,
       UNNEST(JSON_EXTRACT_ARRAY(events.payload.workflow_run.pull_requests)) AS pull_request
     WHERE
-      received >= TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -30 DAY)) AS events
+      received >= TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL {{.EventsLookback}})) AS events
   USING
     (delivery_id)) AS delivery_events
 ON
@@ -47,9 +47,11 @@ WHERE
   SELECT
     DISTINCT pull_request_id
   FROM
-    `{{.InvocationCommentStatusTable}}` invocation_comment_status)
-  AND merged_at BETWEEN TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -30 DAY)
-  AND TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL -1 HOUR)
+    `{{.InvocationCommentStatusTable}}` invocation_comment_status
+  WHERE
+    job_name IS DISTINCT FROM '{{.ReviewStatusCommentJobName}}')
+  AND merged_at BETWEEN TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL {{.MergedLookback}})
+  AND TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL {{.MergedDelay}})
 ORDER BY
   received, 
   pull_request_events.id ASC
@@ -0,0 +1,47 @@
+-- Copyright 2024 The Authors (see AUTHORS file)
+--
+-- Licensed under the Apache License, Version 2.0 (the "License");
+-- you may not use this file except in compliance with the License.
+-- You may obtain a copy of the License at
+--
+--     http://www.apache.org/licenses/LICENSE-2.0
+--
+-- Unless required by applicable law or agreed to in writing, software
+-- distributed under the License is distributed on an "AS IS" BASIS,
+-- WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+-- See the License for the specific language governing permissions and
+-- limitations under the License.
+SELECT
+  pull_request_events.id AS pull_request_id,
+  pull_request_events.number AS pull_request_number,
+  pull_request_events.html_url AS pull_request_html_url,
+  pull_request_events.organization,
+  pull_request_events.repository,
+  pull_request_events.merge_commit_sha,
+  commit_review_status.approval_status,
+  commit_review_status.break_glass_issue_urls
+FROM
+  `{{.PullRequestEventsTable}}` AS pull_request_events
+JOIN
+  `{{.CommitReviewStatusTable}}` AS commit_review_status
+ON
+  commit_review_status.organization = pull_request_events.organization
+  AND commit_review_status.repository = pull_request_events.repository
+  AND commit_review_status.commit_sha = pull_request_events.merge_commit_sha
+WHERE
+  pull_request_events.merged
+  AND pull_request_events.id NOT IN (
+  SELECT
+    DISTINCT pull_request_id
+  FROM
+    `{{.InvocationCommentStatusTable}}` invocation_comment_status
+  WHERE
+    job_name = '{{.ReviewStatusCommentJobName}}'
+    AND status != 'FAILURE')
+  AND pull_request_events.merged_at BETWEEN TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL {{.MergedLookback}})
+  AND TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL {{.MergedDelay}})
+QUALIFY
+  ROW_NUMBER() OVER (PARTITION BY pull_request_events.id ORDER BY pull_request_events.received DESC) = 1
+ORDER BY
+  pull_request_events.merged_at,
+  pull_request_events.id ASC
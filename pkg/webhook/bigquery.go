@@ -20,10 +20,12 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"cloud.google.com/go/bigquery"
 	"google.golang.org/api/option"
 
+	bqutil "github.com/abcxyz/github-metrics-aggregator/pkg/bq"
 	"github.com/abcxyz/pkg/logging"
 )
 
@@ -32,6 +34,7 @@ type BigQuery struct {
 	projectID string
 	datasetID string
 	client    *bigquery.Client
+	putRetry  *bqutil.PutRetryConfig
 	logger    *slog.Logger
 }
 
@@ -41,8 +44,16 @@ type FailureEventEntry struct {
 	createdAt  string
 }
 
-// NewBigQuery creates a new instance of a BigQuery client.
-func NewBigQuery(ctx context.Context, projectID, datasetID string, opts ...option.ClientOption) (*BigQuery, error) {
+// PayloadHashEntry is the shape of an entry to the payload_hashes table.
+type PayloadHashEntry struct {
+	deliveryID  string
+	payloadHash string
+	createdAt   string
+}
+
+// NewBigQuery creates a new instance of a BigQuery client. Writes that fail
+// with a transient error are retried according to putRetry.
+func NewBigQuery(ctx context.Context, projectID, datasetID string, putRetry *bqutil.PutRetryConfig, opts ...option.ClientOption) (*BigQuery, error) {
 	client, err := bigquery.NewClient(ctx, projectID, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new bigquery client: %w", err)
@@ -52,10 +63,20 @@ func NewBigQuery(ctx context.Context, projectID, datasetID string, opts ...optio
 		projectID: projectID,
 		datasetID: datasetID,
 		client:    client,
+		putRetry:  putRetry,
 		logger:    logging.FromContext(ctx),
 	}, nil
 }
 
+// CheckDataset fetches the metadata of the dataset to verify that BigQuery is
+// reachable and the dataset exists. This is used by the readiness check.
+func (bq *BigQuery) CheckDataset(ctx context.Context) error {
+	if _, err := bq.client.Dataset(bq.datasetID).Metadata(ctx); err != nil {
+		return fmt.Errorf("failed to get metadata of dataset %s: %w", bq.datasetID, err)
+	}
+	return nil
+}
+
 // Close releases any resources held by the BigQuery client.
 func (bq *BigQuery) Close() error {
 	if err := bq.client.Close(); err != nil {
@@ -106,13 +127,53 @@ func (bq *BigQuery) WriteFailureEvent(ctx context.Context, failureEventTableID,
 		// FailureEventEntry implements the ValueSaver interface.
 		{deliveryID: deliveryID, createdAt: createdAt},
 	}
-	if err := inserter.Put(ctx, items); err != nil {
+	if err := bqutil.PutWithRetry(ctx, inserter, items, bq.putRetry); err != nil {
 		return fmt.Errorf("failed to execute WriteFailureEvent for deliveryID %s: %w", deliveryID, err)
 	}
 
 	return nil
 }
 
+// Check if an event with the given payload hash was received since the given
+// time. This is used by the webhook service to skip events whose content
+// duplicates a recent event with a different delivery_id.
+func (bq *BigQuery) PayloadHashExists(ctx context.Context, payloadHashesTableID, payloadHash string, since time.Time) (bool, error) {
+	q := bq.client.Query(fmt.Sprintf("SELECT COUNT(1) FROM `%s.%s.%s` WHERE payload_hash = @payloadHash AND created >= @since", bq.projectID, bq.datasetID, payloadHashesTableID))
+
+	q.Parameters = []bigquery.QueryParameter{
+		{
+			Name:  "payloadHash",
+			Value: payloadHash,
+		},
+		{
+			Name:  "since",
+			Value: since,
+		},
+	}
+
+	count, err := readCount(ctx, q, payloadHashesTableID)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute PayloadHashExists: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// Write the payload hash of an event that was accepted for processing. This is
+// used by the webhook service.
+func (bq *BigQuery) WritePayloadHash(ctx context.Context, payloadHashesTableID, deliveryID, payloadHash, createdAt string) error {
+	inserter := bq.client.Dataset(bq.datasetID).Table(payloadHashesTableID).Inserter()
+	items := []*PayloadHashEntry{
+		// PayloadHashEntry implements the ValueSaver interface.
+		{deliveryID: deliveryID, payloadHash: payloadHash, createdAt: createdAt},
+	}
+	if err := bqutil.PutWithRetry(ctx, inserter, items, bq.putRetry); err != nil {
+		return fmt.Errorf("failed to execute WritePayloadHash for deliveryID %s: %w", deliveryID, err)
+	}
+
+	return nil
+}
+
 // TODO: #138 limit by time period to avoid unnecessary scanning -- low priority
 // Helper method to execute a count query for a given table by deliveryID and
 // return the count.
@@ -126,6 +187,12 @@ func (bq *BigQuery) makeCountQuery(ctx context.Context, tableID, deliveryID stri
 		},
 	}
 
+	return readCount(ctx, q, tableID)
+}
+
+// readCount executes a query that selects a single count and returns the
+// count.
+func readCount(ctx context.Context, q *bigquery.Query, tableID string) (int64, error) {
 	// Execute the query.
 	res, err := q.Read(ctx)
 	if err != nil {
@@ -157,3 +224,13 @@ func (fe *FailureEventEntry) Save() (map[string]bigquery.Value, string, error) {
 		"created":     fe.createdAt,
 	}, "", nil
 }
+
+// Save implements the ValueSaver interface for a PayloadHashEntry. A random
+// insertID is generated by the library to facilitate deduplication.
+func (pe *PayloadHashEntry) Save() (map[string]bigquery.Value, string, error) {
+	return map[string]bigquery.Value{
+		"delivery_id":  pe.deliveryID,
+		"payload_hash": pe.payloadHash,
+		"created":      pe.createdAt,
+	}, "", nil
+}
@@ -14,7 +14,10 @@
 
 package webhook
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type deliveryEventExistsRes struct {
 	res bool
@@ -26,12 +29,32 @@ type failureEventsExceedsRetryLimitRes struct {
 	err error
 }
 
+type payloadHashExistsRes struct {
+	res bool
+	err error
+}
+
+type writePayloadHashRes struct {
+	err error
+}
+
+type checkDatasetRes struct {
+	err error
+}
+
 type MockDatastore struct {
 	deliveryEventExists            *deliveryEventExistsRes
 	failureEventsExceedsRetryLimit *failureEventsExceedsRetryLimitRes
+	payloadHashExists              *payloadHashExistsRes
+	writePayloadHash               *writePayloadHashRes
+	checkDataset                   *checkDatasetRes
+
+	writtenPayloadHashes  []string
+	queriedEventsTableIDs []string
 }
 
 func (m *MockDatastore) DeliveryEventExists(ctx context.Context, eventsTableID, deliveryID string) (bool, error) {
+	m.queriedEventsTableIDs = append(m.queriedEventsTableIDs, eventsTableID)
 	if m.deliveryEventExists != nil {
 		return m.deliveryEventExists.res, m.deliveryEventExists.err
 	}
@@ -49,6 +72,28 @@ func (m *MockDatastore) WriteFailureEvent(ctx context.Context, failureEventTable
 	return nil
 }
 
+func (m *MockDatastore) PayloadHashExists(ctx context.Context, payloadHashesTableID, payloadHash string, since time.Time) (bool, error) {
+	if m.payloadHashExists != nil {
+		return m.payloadHashExists.res, m.payloadHashExists.err
+	}
+	return false, nil
+}
+
+func (m *MockDatastore) WritePayloadHash(ctx context.Context, payloadHashesTableID, deliveryID, payloadHash, createdAt string) error {
+	if m.writePayloadHash != nil {
+		return m.writePayloadHash.err
+	}
+	m.writtenPayloadHashes = append(m.writtenPayloadHashes, payloadHash)
+	return nil
+}
+
+func (m *MockDatastore) CheckDataset(ctx context.Context) error {
+	if m.checkDataset != nil {
+		return m.checkDataset.err
+	}
+	return nil
+}
+
 func (m *MockDatastore) Close() error {
 	return nil
 }
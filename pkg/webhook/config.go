@@ -17,26 +17,131 @@ package webhook
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/sethvargo/go-envconfig"
 
+	bqutil "github.com/abcxyz/github-metrics-aggregator/pkg/bq"
+	"github.com/abcxyz/github-metrics-aggregator/pkg/redact"
+	"github.com/abcxyz/github-metrics-aggregator/pkg/servertls"
 	"github.com/abcxyz/pkg/cfgloader"
 	"github.com/abcxyz/pkg/cli"
 )
 
+// eventTypePattern matches GitHub event types, which are also used as suffix of
+// BigQuery table IDs and in Google PubSub subscription filters.
+var eventTypePattern = regexp.MustCompile(`^[a-z_]+$`)
+
 // Config defines the set over environment variables required
 // for running this application.
 type Config struct {
-	BigQueryProjectID    string `env:"BIG_QUERY_PROJECT_ID,default=$PROJECT_ID"`
-	DatasetID            string `env:"DATASET_ID,required"`
-	EventsTableID        string `env:"EVENTS_TABLE_ID,required"`
-	FailureEventsTableID string `env:"FAILURE_EVENTS_TABLE_ID,required"`
-	Port                 string `env:"PORT,default=8080"`
-	ProjectID            string `env:"PROJECT_ID,required"`
-	RetryLimit           int    `env:"RETRY_LIMIT,required"`
-	EventsTopicID        string `env:"EVENTS_TOPIC_ID,required"`
-	DLQEventsTopicID     string `env:"DLQ_EVENTS_TOPIC_ID,required"`
-	GitHubWebhookSecret  string `env:"GITHUB_WEBHOOK_SECRET,required"`
+	BigQueryProjectID    string        `env:"BIG_QUERY_PROJECT_ID,default=$PROJECT_ID"`
+	DatasetID            string        `env:"DATASET_ID,required"`
+	EventsTableID        string        `env:"EVENTS_TABLE_ID,required"`
+	FailureEventsTableID string        `env:"FAILURE_EVENTS_TABLE_ID,required"`
+	Port                 string        `env:"PORT,default=8080"`
+	ProjectID            string        `env:"PROJECT_ID,required"`
+	RetryLimit           int           `env:"RETRY_LIMIT,required"`
+	EventsTopicID        string        `env:"EVENTS_TOPIC_ID,required"`
+	DLQEventsTopicID     string        `env:"DLQ_EVENTS_TOPIC_ID"`
+	GitHubWebhookSecret  string        `env:"GITHUB_WEBHOOK_SECRET" sensitive:"true"`
+	GitHubWebhookSecrets []string      `env:"GITHUB_WEBHOOK_SECRETS" sensitive:"true"`
+	DedupByContent       bool          `env:"DEDUP_BY_CONTENT,default=false"`
+	DedupWindow          time.Duration `env:"DEDUP_WINDOW,default=24h"`
+	PayloadHashesTableID string        `env:"PAYLOAD_HASHES_TABLE_ID"`
+	ResponseFormat       string        `env:"RESPONSE_FORMAT,default=minimal"`
+
+	// EventTopicRoutes maps event types to additional topics that events of
+	// that type are published to, after being published to the events topic.
+	EventTopicRoutes map[string]string `env:"EVENT_TOPIC_ROUTES"`
+
+	// ExactlyOncePublishing publishes events with their delivery id and event
+	// type as attributes and ordered by repository, for subscriptions with
+	// exactly-once delivery and message ordering enabled.
+	ExactlyOncePublishing bool `env:"EXACTLY_ONCE_PUBLISHING,default=false"`
+
+	// EventTypeTables lists the event types that are stored in a dedicated
+	// events table, named after the events table with the event type as
+	// suffix. BigQuery subscriptions filtered on the event attribute write the
+	// events of each type to its table. The events table is the catch-all for
+	// all other types.
+	EventTypeTables []string `env:"EVENT_TYPE_TABLES"`
+
+	// ReplayServiceAccounts enables the replay endpoint, which ingests
+	// payloads without a webhook signature if the request is authenticated
+	// with a Google ID token of one of these service accounts. The replay
+	// endpoint is disabled unless set.
+	ReplayServiceAccounts []string `env:"REPLAY_SERVICE_ACCOUNTS"`
+
+	// ReplayAudience is the audience of the Google ID tokens accepted by the
+	// replay endpoint, typically the URL of the webhook service.
+	ReplayAudience string `env:"REPLAY_AUDIENCE"`
+
+	// DLQBucketName dead-letters events to the bucket instead of the DLQ
+	// topic. The raw payload of each event is written with its headers and
+	// the reason it was dead-lettered as object metadata.
+	DLQBucketName string `env:"DLQ_BUCKET_NAME"`
+
+	// BigQueryWriteMaxRetries is the maximum number of retries of a BigQuery
+	// write that failed with a transient error. Writes are not retried when 0.
+	BigQueryWriteMaxRetries int `env:"BIG_QUERY_WRITE_MAX_RETRIES,default=3"`
+
+	// BigQueryWriteRetryBackoff is the backoff before the first retry of a
+	// failed BigQuery write, it doubles with each retry.
+	BigQueryWriteRetryBackoff time.Duration `env:"BIG_QUERY_WRITE_RETRY_BACKOFF,default=500ms"`
+
+	// AllowedEventTypes lists the event types that are ingested. Events of
+	// other types are acknowledged and dropped without being published. All
+	// event types are ingested unless set.
+	AllowedEventTypes []string `env:"ALLOWED_EVENT_TYPES"`
+
+	// GitHubEnterpriseURL is the URL of the GitHub Enterprise Server instance
+	// the events are delivered from. Its host is recorded with each event,
+	// otherwise the host is taken from the delivery.
+	GitHubEnterpriseURL string `env:"GITHUB_ENTERPRISE_URL"`
+
+	// MaxPayloadBytes is the maximum size of a webhook payload, larger
+	// requests are rejected with a 413 without being read to the end. GitHub
+	// caps payloads at 25 MB.
+	MaxPayloadBytes int64 `env:"MAX_PAYLOAD_BYTES,default=25000000"`
+
+	// SpoolDir and SpoolBucketName durably store validated events in a local
+	// directory or under spool/ in a Google Cloud Storage bucket, when they
+	// can neither be published nor recorded as failed because BigQuery, and
+	// possibly PubSub, are unavailable. The spooled events are ingested again
+	// every SpoolDrainInterval until the backends recover. Spooling is
+	// disabled unless one of them is set.
+	SpoolDir           string        `env:"SPOOL_DIR"`
+	SpoolBucketName    string        `env:"SPOOL_BUCKET_NAME"`
+	SpoolDrainInterval time.Duration `env:"SPOOL_DRAIN_INTERVAL,default=1m"`
+
+	// TLSCertFile and TLSKeyFile are the PEM encoded certificate chain and
+	// private key the server serves HTTPS with. The server serves HTTP unless
+	// set, e.g. when deployed behind a load balancer that terminates TLS.
+	TLSCertFile string `env:"TLS_CERT_FILE"`
+	TLSKeyFile  string `env:"TLS_KEY_FILE"`
+
+	// TLSMinVersion is the minimum TLS version accepted when serving HTTPS.
+	TLSMinVersion string `env:"TLS_MIN_VERSION,default=1.2"`
+
+	// TLSCipherSuites are the cipher suites accepted for TLS 1.2 and lower when
+	// serving HTTPS. The Go defaults are accepted unless set.
+	TLSCipherSuites []string `env:"TLS_CIPHER_SUITES"`
+
+	// EventsSchemaID is the ID of a pubsub schema in the project that each
+	// event is validated against before it is published, typically the schema
+	// of the events topic. Events that don't conform are dead-lettered instead
+	// of being published. Events are not validated unless set.
+	EventsSchemaID string `env:"EVENTS_SCHEMA_ID"`
+
+	// PayloadSchemaFiles maps event types to JSON schema files that the
+	// payloads of events of that type are validated against. Events whose
+	// payload does not conform are dead-lettered instead of being published.
+	// Payloads of event types without a schema are not validated.
+	PayloadSchemaFiles map[string]string `env:"PAYLOAD_SCHEMA_FILES"`
 }
 
 // Validate validates the service config after load.
@@ -66,17 +171,192 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf("EVENTS_TOPIC_ID is required")
 	}
 
-	if cfg.DLQEventsTopicID == "" {
-		return fmt.Errorf("DLQ_EVENTS_TOPIC_ID is required")
+	if cfg.DLQEventsTopicID == "" && cfg.DLQBucketName == "" {
+		return fmt.Errorf("DLQ_EVENTS_TOPIC_ID is required unless DLQ_BUCKET_NAME is set")
+	}
+
+	if cfg.DLQEventsTopicID != "" && cfg.DLQBucketName != "" {
+		return fmt.Errorf("only one of DLQ_EVENTS_TOPIC_ID and DLQ_BUCKET_NAME may be set")
+	}
+
+	if len(cfg.webhookSecrets()) == 0 {
+		return fmt.Errorf("GITHUB_WEBHOOK_SECRET is required unless GITHUB_WEBHOOK_SECRETS is set")
+	}
+
+	if cfg.DedupByContent {
+		if cfg.PayloadHashesTableID == "" {
+			return fmt.Errorf("PAYLOAD_HASHES_TABLE_ID is required when DEDUP_BY_CONTENT is enabled")
+		}
+
+		if cfg.DedupWindow <= 0 {
+			return fmt.Errorf("DEDUP_WINDOW must be greater than 0")
+		}
+	}
+
+	for eventType, topicID := range cfg.EventTopicRoutes {
+		if eventType == "" || topicID == "" {
+			return fmt.Errorf("EVENT_TOPIC_ROUTES must map event types to topic IDs, got %q=%q", eventType, topicID)
+		}
+	}
+
+	for _, eventType := range cfg.EventTypeTables {
+		if !eventTypePattern.MatchString(eventType) {
+			return fmt.Errorf("EVENT_TYPE_TABLES must only contain event types of lowercase letters and underscores, got %q", eventType)
+		}
+	}
+
+	for _, eventType := range cfg.AllowedEventTypes {
+		if !eventTypePattern.MatchString(eventType) {
+			return fmt.Errorf("ALLOWED_EVENT_TYPES must only contain event types of lowercase letters and underscores, got %q", eventType)
+		}
+	}
+
+	for eventType, file := range cfg.PayloadSchemaFiles {
+		if !eventTypePattern.MatchString(eventType) || file == "" {
+			return fmt.Errorf("PAYLOAD_SCHEMA_FILES must map event types of lowercase letters and underscores to schema files, got %q=%q", eventType, file)
+		}
+	}
+
+	if len(cfg.ReplayServiceAccounts) > 0 {
+		for _, serviceAccount := range cfg.ReplayServiceAccounts {
+			if serviceAccount == "" {
+				return fmt.Errorf("REPLAY_SERVICE_ACCOUNTS must not contain empty service accounts")
+			}
+		}
+
+		if cfg.ReplayAudience == "" {
+			return fmt.Errorf("REPLAY_AUDIENCE is required when REPLAY_SERVICE_ACCOUNTS is set")
+		}
+	}
+
+	if cfg.BigQueryWriteMaxRetries < 0 {
+		return fmt.Errorf("BIG_QUERY_WRITE_MAX_RETRIES must not be negative, got %d", cfg.BigQueryWriteMaxRetries)
+	}
+
+	if cfg.BigQueryWriteMaxRetries > 0 && cfg.BigQueryWriteRetryBackoff <= 0 {
+		return fmt.Errorf("BIG_QUERY_WRITE_RETRY_BACKOFF must be positive, got %s", cfg.BigQueryWriteRetryBackoff)
+	}
+
+	if cfg.GitHubEnterpriseURL != "" {
+		u, err := url.Parse(cfg.GitHubEnterpriseURL)
+		if err != nil {
+			return fmt.Errorf("failed to parse GITHUB_ENTERPRISE_URL: %w", err)
+		}
+		if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("GITHUB_ENTERPRISE_URL must be an http(s) URL, got %q", cfg.GitHubEnterpriseURL)
+		}
+	}
+
+	if cfg.MaxPayloadBytes < 0 {
+		return fmt.Errorf("MAX_PAYLOAD_BYTES must be non-negative, got %d", cfg.MaxPayloadBytes)
 	}
 
-	if cfg.GitHubWebhookSecret == "" {
-		return fmt.Errorf("GITHUB_WEBHOOK_SECRET is required")
+	if cfg.SpoolDir != "" && cfg.SpoolBucketName != "" {
+		return fmt.Errorf("only one of SPOOL_DIR and SPOOL_BUCKET_NAME may be set")
+	}
+
+	if (cfg.SpoolDir != "" || cfg.SpoolBucketName != "") && cfg.SpoolDrainInterval <= 0 {
+		return fmt.Errorf("SPOOL_DRAIN_INTERVAL must be positive, got %s", cfg.SpoolDrainInterval)
+	}
+
+	// an unset format renders the minimal response
+	switch cfg.ResponseFormat {
+	case "", ResponseFormatMinimal, ResponseFormatVerbose:
+	default:
+		return fmt.Errorf("RESPONSE_FORMAT must be one of %q or %q, got %q",
+			ResponseFormatMinimal, ResponseFormatVerbose, cfg.ResponseFormat)
+	}
+
+	if err := cfg.TLS().Validate(); err != nil {
+		return err //nolint:wrapcheck // Want passthrough
 	}
 
 	return nil
 }
 
+// bigQueryWriteRetry returns the retry configuration of BigQuery writes.
+func (cfg *Config) bigQueryWriteRetry() *bqutil.PutRetryConfig {
+	return &bqutil.PutRetryConfig{
+		MaxRetries:     uint64(cfg.BigQueryWriteMaxRetries),
+		InitialBackoff: cfg.BigQueryWriteRetryBackoff,
+	}
+}
+
+// enterpriseHost returns the host of the configured GitHub Enterprise Server
+// instance, or an empty string if none is configured.
+func (cfg *Config) enterpriseHost() string {
+	u, err := url.Parse(cfg.GitHubEnterpriseURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// maxPayloadBytes returns the maximum size of a webhook payload, an unset
+// maximum is GitHub's limit.
+func (cfg *Config) maxPayloadBytes() int64 {
+	if cfg.MaxPayloadBytes == 0 {
+		return defaultMaxPayloadBytes
+	}
+	return cfg.MaxPayloadBytes
+}
+
+// webhookSecrets returns all of the accepted webhook secrets. During a secret
+// rotation both the old and the new secret are accepted.
+func (cfg *Config) webhookSecrets() []string {
+	secrets := make([]string, 0, len(cfg.GitHubWebhookSecrets)+1)
+	if cfg.GitHubWebhookSecret != "" {
+		secrets = append(secrets, cfg.GitHubWebhookSecret)
+	}
+	for _, secret := range cfg.GitHubWebhookSecrets {
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// eventTypeTables returns the dedicated events table of each event type listed
+// in EventTypeTables, which is named after the events table with the event type
+// as suffix, e.g. "events_pull_request".
+func (cfg *Config) eventTypeTables() map[string]string {
+	tables := make(map[string]string, len(cfg.EventTypeTables))
+	for _, eventType := range cfg.EventTypeTables {
+		tables[eventType] = cfg.EventsTableID + "_" + eventType
+	}
+	return tables
+}
+
+// allowedEventTypes returns the set of event types that are ingested, or nil
+// if all event types are ingested.
+func (cfg *Config) allowedEventTypes() map[string]struct{} {
+	if len(cfg.AllowedEventTypes) == 0 {
+		return nil
+	}
+
+	allowed := make(map[string]struct{}, len(cfg.AllowedEventTypes))
+	for _, eventType := range cfg.AllowedEventTypes {
+		allowed[eventType] = struct{}{}
+	}
+	return allowed
+}
+
+// TLS returns the TLS configuration of the server.
+func (cfg *Config) TLS() *servertls.Config {
+	return &servertls.Config{
+		CertFile:     cfg.TLSCertFile,
+		KeyFile:      cfg.TLSKeyFile,
+		MinVersion:   cfg.TLSMinVersion,
+		CipherSuites: cfg.TLSCipherSuites,
+	}
+}
+
+// LogConfig returns the config for logging, with the values of sensitive
+// fields redacted.
+func (cfg *Config) LogConfig() map[string]any {
+	return redact.Fields(cfg)
+}
+
 // NewConfig creates a new Config from environment variables.
 func NewConfig(ctx context.Context) (*Config, error) {
 	return newConfig(ctx, envconfig.OsLookuper())
@@ -151,11 +431,39 @@ func (cfg *Config) ToFlags(set *cli.FlagSet) *cli.FlagSet {
 		Usage:  `Google PubSub topic ID.`,
 	})
 
+	f.StringVar(&cli.StringVar{
+		Name:   "events-schema-id",
+		Target: &cfg.EventsSchemaID,
+		EnvVar: "EVENTS_SCHEMA_ID",
+		Usage: `Google PubSub schema ID each event is validated against before it is published. Events ` +
+			`that don't conform to the schema are dead-lettered. Events are not validated unless set.`,
+		Example: "github-events-schema",
+	})
+
+	f.StringMapVar(&cli.StringMapVar{
+		Name:   "payload-schema-file",
+		Target: &cfg.PayloadSchemaFiles,
+		EnvVar: "PAYLOAD_SCHEMA_FILES",
+		Usage: `Validates the payloads of events of the given type against the given JSON schema file ` +
+			`before they are published, events whose payload does not conform are dead-lettered. Can be repeated.`,
+		Example: "pull_request=/etc/schemas/pull_request.json",
+	})
+
 	f.StringVar(&cli.StringVar{
 		Name:   "dlq-events-topic-id",
 		Target: &cfg.DLQEventsTopicID,
 		EnvVar: "DLQ_EVENTS_TOPIC_ID",
-		Usage:  `Google PubSub topic ID.`,
+		Usage:  `Google PubSub topic ID where events that exceeded the retry limit are written, required unless a DLQ bucket is set.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "dlq-bucket-name",
+		Target: &cfg.DLQBucketName,
+		EnvVar: "DLQ_BUCKET_NAME",
+		Usage: `Google Cloud Storage bucket where events that exceeded the retry limit are written instead ` +
+			`of the DLQ topic. The raw payload of each event is written to <event type>/<delivery id>.json, ` +
+			`with its headers and the reason it was dead-lettered as object metadata.`,
+		Example: "github-webhook-dlq-xxxx",
 	})
 
 	f.StringVar(&cli.StringVar{
@@ -165,5 +473,195 @@ func (cfg *Config) ToFlags(set *cli.FlagSet) *cli.FlagSet {
 		Usage:  `GitHub webhook secret.`,
 	})
 
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:   "github-webhook-secrets",
+		Target: &cfg.GitHubWebhookSecrets,
+		EnvVar: "GITHUB_WEBHOOK_SECRETS",
+		Usage: `Comma-separated list of additional accepted GitHub webhook secrets. ` +
+			`A delivery is valid if it is signed with any of them, which allows rotating the secret without failing deliveries.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "dedup-by-content",
+		Target:  &cfg.DedupByContent,
+		EnvVar:  "DEDUP_BY_CONTENT",
+		Default: false,
+		Usage: `Whether to skip events whose normalized payload matches an event ` +
+			`received within the dedup window, even if their delivery IDs differ.`,
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "dedup-window",
+		Target:  &cfg.DedupWindow,
+		EnvVar:  "DEDUP_WINDOW",
+		Default: 24 * time.Hour,
+		Usage:   `The duration within which events with the same payload are considered duplicates.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "payload-hashes-table-id",
+		Target: &cfg.PayloadHashesTableID,
+		EnvVar: "PAYLOAD_HASHES_TABLE_ID",
+		Usage:  `The payload hashes table ID within the dataset, required when deduplicating by content.`,
+	})
+
+	f.StringMapVar(&cli.StringMapVar{
+		Name:    "event-topic-route",
+		Target:  &cfg.EventTopicRoutes,
+		EnvVar:  "EVENT_TOPIC_ROUTES",
+		Usage:   `Additionally publishes events of the given type to the given Google PubSub topic ID. Can be repeated.`,
+		Example: "workflow_run=workflow-run-events",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "response-format",
+		Target:  &cfg.ResponseFormat,
+		EnvVar:  "RESPONSE_FORMAT",
+		Default: ResponseFormatMinimal,
+		Usage: `The format of the webhook response body, either "minimal" or "verbose". ` +
+			`The verbose format additionally includes the delivery ID, the disposition of the event and the time it was received.`,
+	})
+
+	f.BoolVar(&cli.BoolVar{
+		Name:    "exactly-once-publishing",
+		Target:  &cfg.ExactlyOncePublishing,
+		EnvVar:  "EXACTLY_ONCE_PUBLISHING",
+		Default: false,
+		Usage: `Whether to publish events with their delivery ID and event type as the "delivery_id" and "event" ` +
+			`attributes, and with the full name of their repository as the ordering key. Enable this for ` +
+			`subscriptions with exactly-once delivery and message ordering, and deduplicate on the "delivery_id" ` +
+			`attribute since Google PubSub assigns a new message ID to every published event.`,
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:   "event-type-table",
+		Target: &cfg.EventTypeTables,
+		EnvVar: "EVENT_TYPE_TABLES",
+		Usage: `Stores events of the given type in a dedicated BigQuery table, named after the events table ` +
+			`with the event type as suffix, instead of the events table. Events are published with their event ` +
+			`type as the "event" attribute, which the BigQuery subscription of each table filters on. Can be repeated.`,
+		Example: "pull_request",
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:   "replay-service-account",
+		Target: &cfg.ReplayServiceAccounts,
+		EnvVar: "REPLAY_SERVICE_ACCOUNTS",
+		Usage: `Enables the ` + ReplayPath + ` endpoint for the given service account, which ingests already ` +
+			`validated payloads without a webhook signature. Requests must be authenticated with a Google ID ` +
+			`token of the service account. Can be repeated. The endpoint is disabled unless set.`,
+		Example: "replay@my-project.iam.gserviceaccount.com",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "replay-audience",
+		Target: &cfg.ReplayAudience,
+		EnvVar: "REPLAY_AUDIENCE",
+		Usage:  `The audience of the Google ID tokens accepted by the replay endpoint, required when it is enabled.`,
+	})
+
+	f.IntVar(&cli.IntVar{
+		Name:    "big-query-write-max-retries",
+		Target:  &cfg.BigQueryWriteMaxRetries,
+		EnvVar:  "BIG_QUERY_WRITE_MAX_RETRIES",
+		Default: 3,
+		Usage:   "The maximum number of retries of a BigQuery write that failed with a transient error. Writes are not retried when 0.",
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "big-query-write-retry-backoff",
+		Target:  &cfg.BigQueryWriteRetryBackoff,
+		EnvVar:  "BIG_QUERY_WRITE_RETRY_BACKOFF",
+		Default: 500 * time.Millisecond,
+		Usage:   "The backoff before the first retry of a failed BigQuery write, it doubles with each retry.",
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:   "allowed-event-type",
+		Target: &cfg.AllowedEventTypes,
+		EnvVar: "ALLOWED_EVENT_TYPES",
+		Usage: `An event type that is ingested. Events of other types are acknowledged with a 202 and ` +
+			`dropped without being published. Can be repeated. All event types are ingested unless set.`,
+		Example: "pull_request",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "github-enterprise-url",
+		Target: &cfg.GitHubEnterpriseURL,
+		EnvVar: "GITHUB_ENTERPRISE_URL",
+		Usage: `The URL of the GitHub Enterprise Server instance the events are delivered from, its host ` +
+			`is recorded with each event. The host is taken from the X-GitHub-Enterprise-Host header ` +
+			`unless set, and is github.com for deliveries without it.`,
+		Example: "https://ghe.example.com",
+	})
+
+	f.Int64Var(&cli.Int64Var{
+		Name:    "max-payload-bytes",
+		Target:  &cfg.MaxPayloadBytes,
+		EnvVar:  "MAX_PAYLOAD_BYTES",
+		Default: defaultMaxPayloadBytes,
+		Usage:   "The maximum size of a webhook payload in bytes, larger requests are rejected with a 413.",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "spool-dir",
+		Target: &cfg.SpoolDir,
+		EnvVar: "SPOOL_DIR",
+		Usage: `Local directory where validated events are durably stored when they can neither be ` +
+			`published nor recorded as failed because BigQuery, and possibly PubSub, are unavailable. ` +
+			`Spooled events are acknowledged with a 202 and ingested again once the backends recover. ` +
+			`The directory must be on a persistent disk to survive a restart.`,
+		Example: "/var/spool/github-metrics-aggregator",
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "spool-bucket-name",
+		Target: &cfg.SpoolBucketName,
+		EnvVar: "SPOOL_BUCKET_NAME",
+		Usage: `Google Cloud Storage bucket where events are spooled under spool/ instead of a local ` +
+			`directory, see spool-dir.`,
+		Example: "github-webhook-spool-xxxx",
+	})
+
+	f.DurationVar(&cli.DurationVar{
+		Name:    "spool-drain-interval",
+		Target:  &cfg.SpoolDrainInterval,
+		EnvVar:  "SPOOL_DRAIN_INTERVAL",
+		Default: time.Minute,
+		Usage: `The interval at which the spooled events are ingested again, in the order they were ` +
+			`spooled. A drain stops at the first event that still fails to be ingested.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "tls-cert-file",
+		Target: &cfg.TLSCertFile,
+		EnvVar: "TLS_CERT_FILE",
+		Usage: `The path of the PEM encoded certificate chain to serve HTTPS with, along with ` +
+			`the tls-key-file. The server serves HTTP unless set, e.g. behind a load balancer.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:   "tls-key-file",
+		Target: &cfg.TLSKeyFile,
+		EnvVar: "TLS_KEY_FILE",
+		Usage:  `The path of the PEM encoded private key of the tls-cert-file.`,
+	})
+
+	f.StringVar(&cli.StringVar{
+		Name:    "tls-min-version",
+		Target:  &cfg.TLSMinVersion,
+		EnvVar:  "TLS_MIN_VERSION",
+		Default: servertls.DefaultMinVersion,
+		Usage:   `The minimum TLS version accepted when serving HTTPS, one of 1.0, 1.1, 1.2 or 1.3.`,
+	})
+
+	f.StringSliceVar(&cli.StringSliceVar{
+		Name:   "tls-cipher-suites",
+		Target: &cfg.TLSCipherSuites,
+		EnvVar: "TLS_CIPHER_SUITES",
+		Usage: `Comma-separated list of cipher suites accepted for TLS 1.2 and lower when serving HTTPS, ` +
+			`e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. The Go defaults are accepted unless set.`,
+	})
+
 	return set
 }
@@ -16,7 +16,9 @@ package webhook
 
 import (
 	"testing"
+	"time"
 
+	"github.com/abcxyz/github-metrics-aggregator/pkg/redact"
 	"github.com/abcxyz/pkg/testutil"
 )
 
@@ -112,6 +114,36 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: "DLQ_EVENTS_TOPIC_ID is required",
 		},
+		{
+			name: "dlq_bucket_instead_of_topic",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQBucketName:        "test-dlq-bucket",
+				GitHubWebhookSecret:  "test-github-webhook-secret",
+				RetryLimit:           1,
+			},
+		},
+		{
+			name: "dlq_topic_and_bucket",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQEventsTopicID:     "test-dlq-events-topic-id",
+				DLQBucketName:        "test-dlq-bucket",
+				GitHubWebhookSecret:  "test-github-webhook-secret",
+				RetryLimit:           1,
+			},
+			wantErr: "only one of DLQ_EVENTS_TOPIC_ID and DLQ_BUCKET_NAME may be set",
+		},
 		{
 			name: "missing_webhook_secret",
 			cfg: &Config{
@@ -140,6 +172,217 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: "RETRY_LIMIT is required and must be greater than 0",
 		},
+		{
+			name: "dedup_by_content_missing_payload_hashes_table_id",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQEventsTopicID:     "test-dlq-events-topic-id",
+				GitHubWebhookSecret:  "test-github-webhook-secret",
+				RetryLimit:           1,
+				DedupByContent:       true,
+				DedupWindow:          time.Hour,
+			},
+			wantErr: "PAYLOAD_HASHES_TABLE_ID is required when DEDUP_BY_CONTENT is enabled",
+		},
+		{
+			name: "invalid_response_format",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQEventsTopicID:     "test-dlq-events-topic-id",
+				GitHubWebhookSecret:  "test-github-webhook-secret",
+				RetryLimit:           1,
+				ResponseFormat:       "pretty",
+			},
+			wantErr: `RESPONSE_FORMAT must be one of "minimal" or "verbose", got "pretty"`,
+		},
+		{
+			name: "invalid_event_topic_route",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQEventsTopicID:     "test-dlq-events-topic-id",
+				GitHubWebhookSecret:  "test-github-webhook-secret",
+				RetryLimit:           1,
+				EventTopicRoutes: map[string]string{
+					"workflow_run": "",
+				},
+			},
+			wantErr: `EVENT_TOPIC_ROUTES must map event types to topic IDs, got "workflow_run"=""`,
+		},
+		{
+			name: "invalid_event_type_table",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQEventsTopicID:     "test-dlq-events-topic-id",
+				GitHubWebhookSecret:  "test-github-webhook-secret",
+				RetryLimit:           1,
+				EventTypeTables:      []string{"pull_request", "Workflow-Run"},
+			},
+			wantErr: `EVENT_TYPE_TABLES must only contain event types of lowercase letters and underscores, got "Workflow-Run"`,
+		},
+		{
+			name: "invalid_allowed_event_type",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQEventsTopicID:     "test-dlq-events-topic-id",
+				GitHubWebhookSecret:  "test-github-webhook-secret",
+				RetryLimit:           1,
+				AllowedEventTypes:    []string{"pull_request", ""},
+			},
+			wantErr: `ALLOWED_EVENT_TYPES must only contain event types of lowercase letters and underscores, got ""`,
+		},
+		{
+			name: "invalid_payload_schema_file",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQEventsTopicID:     "test-dlq-events-topic-id",
+				GitHubWebhookSecret:  "test-github-webhook-secret",
+				RetryLimit:           1,
+				PayloadSchemaFiles:   map[string]string{"pull_request": ""},
+			},
+			wantErr: `PAYLOAD_SCHEMA_FILES must map event types of lowercase letters and underscores to schema files, got "pull_request"=""`,
+		},
+		{
+			name: "invalid_tls_min_version",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQEventsTopicID:     "test-dlq-events-topic-id",
+				GitHubWebhookSecret:  "test-github-webhook-secret",
+				RetryLimit:           1,
+				TLSMinVersion:        "1.4",
+			},
+			wantErr: `invalid TLS_MIN_VERSION: unknown TLS version "1.4"`,
+		},
+		{
+			name: "replay_missing_audience",
+			cfg: &Config{
+				BigQueryProjectID:     "test-big-query-project-id",
+				DatasetID:             "test-dataset-id",
+				EventsTableID:         "test-events-table-id",
+				FailureEventsTableID:  "test-failure-events-table-id",
+				ProjectID:             "test-project-id",
+				EventsTopicID:         "test-events-topic-id",
+				DLQEventsTopicID:      "test-dlq-events-topic-id",
+				GitHubWebhookSecret:   "test-github-webhook-secret",
+				RetryLimit:            1,
+				ReplayServiceAccounts: []string{"replay@test-project.iam.gserviceaccount.com"},
+			},
+			wantErr: `REPLAY_AUDIENCE is required when REPLAY_SERVICE_ACCOUNTS is set`,
+		},
+		{
+			name: "invalid_github_enterprise_url",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQEventsTopicID:     "test-dlq-events-topic-id",
+				GitHubWebhookSecret:  "test-github-webhook-secret",
+				RetryLimit:           1,
+				GitHubEnterpriseURL:  "ghe.example.com",
+			},
+			wantErr: `GITHUB_ENTERPRISE_URL must be an http(s) URL, got "ghe.example.com"`,
+		},
+		{
+			name: "negative_max_payload_bytes",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQEventsTopicID:     "test-dlq-events-topic-id",
+				GitHubWebhookSecret:  "test-github-webhook-secret",
+				RetryLimit:           1,
+				MaxPayloadBytes:      -1,
+			},
+			wantErr: "MAX_PAYLOAD_BYTES must be non-negative, got -1",
+		},
+		{
+			name: "spool_dir_and_bucket",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQEventsTopicID:     "test-dlq-events-topic-id",
+				GitHubWebhookSecret:  "test-github-webhook-secret",
+				RetryLimit:           1,
+				SpoolDir:             "/var/spool/test",
+				SpoolBucketName:      "test-spool-bucket",
+				SpoolDrainInterval:   time.Minute,
+			},
+			wantErr: "only one of SPOOL_DIR and SPOOL_BUCKET_NAME may be set",
+		},
+		{
+			name: "spool_invalid_drain_interval",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQEventsTopicID:     "test-dlq-events-topic-id",
+				GitHubWebhookSecret:  "test-github-webhook-secret",
+				RetryLimit:           1,
+				SpoolBucketName:      "test-spool-bucket",
+			},
+			wantErr: "SPOOL_DRAIN_INTERVAL must be positive, got 0s",
+		},
+		{
+			name: "success_with_webhook_secrets",
+			cfg: &Config{
+				BigQueryProjectID:    "test-big-query-project-id",
+				DatasetID:            "test-dataset-id",
+				EventsTableID:        "test-events-table-id",
+				FailureEventsTableID: "test-failure-events-table-id",
+				ProjectID:            "test-project-id",
+				EventsTopicID:        "test-events-topic-id",
+				DLQEventsTopicID:     "test-dlq-events-topic-id",
+				GitHubWebhookSecrets: []string{"test-old-secret", "test-new-secret"},
+				RetryLimit:           1,
+			},
+		},
 		{
 			name: "success",
 			cfg: &Config{
@@ -169,3 +412,23 @@ func TestConfig_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_LogConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{
+		ProjectID:            "test-project-id",
+		GitHubWebhookSecret:  "test-github-webhook-secret",
+		GitHubWebhookSecrets: []string{"test-github-webhook-secret-2"},
+	}
+
+	got := cfg.LogConfig()
+	for _, key := range []string{"GITHUB_WEBHOOK_SECRET", "GITHUB_WEBHOOK_SECRETS"} {
+		if got[key] != redact.Mask {
+			t.Errorf("expected %s to be masked, got %v", key, got[key])
+		}
+	}
+	if got, want := got["PROJECT_ID"], "test-project-id"; got != want {
+		t.Errorf("expected PROJECT_ID to be %q, got %v", want, got)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// payloadHash computes a stable hash of the event type and payload of an
+// event. The payload is normalized before hashing, so payloads that only
+// differ in formatting or key order hash to the same value. Payloads that are
+// not valid JSON are hashed as is.
+func payloadHash(eventType string, payload []byte) string {
+	normalized := payload
+	if v, err := decodePayload(payload); err == nil {
+		// json.Marshal writes object keys in sorted order and without
+		// insignificant whitespace.
+		if b, err := json.Marshal(v); err == nil {
+			normalized = b
+		}
+	}
+
+	h := sha256.New()
+	h.Write([]byte(eventType))
+	h.Write([]byte{0})
+	h.Write(bytes.TrimSpace(normalized))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// decodePayload decodes a single JSON value. Numbers are kept as is rather
+// than converted to float64, which would collapse IDs larger than 2^53 into
+// the same value.
+func decodePayload(payload []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err //nolint:wrapcheck // Want passthrough
+	}
+	// like json.Unmarshal, anything after the value is invalid
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("unexpected data after payload")
+	}
+	return v, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import "testing"
+
+func TestPayloadHash(t *testing.T) {
+	t.Parallel()
+
+	base := payloadHash("pull_request", []byte(`{"action":"opened","number":1,"pull_request":{"id":2,"title":"test"}}`))
+
+	cases := []struct {
+		name      string
+		eventType string
+		payload   string
+		wantSame  bool
+	}{
+		{
+			name:      "identical",
+			eventType: "pull_request",
+			payload:   `{"action":"opened","number":1,"pull_request":{"id":2,"title":"test"}}`,
+			wantSame:  true,
+		},
+		{
+			name:      "different_key_order_and_whitespace",
+			eventType: "pull_request",
+			payload: `{
+  "pull_request": {"title": "test", "id": 2},
+  "number": 1,
+  "action": "opened"
+}`,
+			wantSame: true,
+		},
+		{
+			name:      "different_value",
+			eventType: "pull_request",
+			payload:   `{"action":"closed","number":1,"pull_request":{"id":2,"title":"test"}}`,
+			wantSame:  false,
+		},
+		{
+			name:      "different_event_type",
+			eventType: "issues",
+			payload:   `{"action":"opened","number":1,"pull_request":{"id":2,"title":"test"}}`,
+			wantSame:  false,
+		},
+		{
+			name:      "trailing_data",
+			eventType: "pull_request",
+			payload:   `{"action":"opened","number":1,"pull_request":{"id":2,"title":"test"}} {}`,
+			wantSame:  false,
+		},
+		{
+			name:      "invalid_json",
+			eventType: "pull_request",
+			payload:   `{"action":"opened"`,
+			wantSame:  false,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := payloadHash(tc.eventType, []byte(tc.payload))
+			if same := got == base; same != tc.wantSame {
+				t.Errorf("payloadHash(%q, %q) = %q, expected same as %q to be %t", tc.eventType, tc.payload, got, base, tc.wantSame)
+			}
+		})
+	}
+}
+
+func TestPayloadHash_LargeNumbers(t *testing.T) {
+	t.Parallel()
+
+	// both IDs are the same float64, 2^53 + 1 is not representable
+	a := payloadHash("pull_request", []byte(`{"pull_request":{"id":9007199254740992}}`))
+	b := payloadHash("pull_request", []byte(`{"pull_request":{"id":9007199254740993}}`))
+	if a == b {
+		t.Errorf("expected payloads with different large IDs to hash differently, both hashed to %q", a)
+	}
+}
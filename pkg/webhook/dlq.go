@@ -0,0 +1,154 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+
+	pubsubpb "github.com/abcxyz/github-metrics-aggregator/protos/pubsub_schemas"
+)
+
+// The metadata of the objects written by the GCS DLQ.
+const (
+	metadataDeliveryID     = "delivery_id"
+	metadataEvent          = "event"
+	metadataReceived       = "received"
+	metadataSignature      = "signature"
+	metadataEventTimestamp = "event_timestamp"
+	metadataGitHubHost     = "github_host"
+	metadataReason         = "reason"
+)
+
+// DeadLetterQueue stores the events that exceeded the retry limit, so that
+// they can be recovered manually.
+type DeadLetterQueue interface {
+	// DeadLetter stores the event, eventBytes is the event as it is published
+	// to the events topic and reason describes why the event was
+	// dead-lettered.
+	DeadLetter(ctx context.Context, event *pubsubpb.Event, eventBytes []byte, reason string) error
+	Close() error
+}
+
+// pubSubDeadLetterQueue publishes dead-lettered events to the DLQ topic, the
+// same way events are published to the events topic.
+type pubSubDeadLetterQueue struct {
+	messenger *PubSubMessenger
+	publish   func(messenger *PubSubMessenger, event *pubsubpb.Event, eventBytes []byte) error
+}
+
+// DeadLetter implements [DeadLetterQueue]. The reason is only logged by the
+// caller, the message is the same as on the events topic.
+func (q *pubSubDeadLetterQueue) DeadLetter(ctx context.Context, event *pubsubpb.Event, eventBytes []byte, reason string) error {
+	return q.publish(q.messenger, event, eventBytes)
+}
+
+// Close implements [DeadLetterQueue].
+func (q *pubSubDeadLetterQueue) Close() error {
+	return q.messenger.Close()
+}
+
+// ObjectWriter writes an object with the given content and metadata to a
+// bucket.
+type ObjectWriter interface {
+	WriteObject(ctx context.Context, bucket, object string, content []byte, metadata map[string]string) error
+	Close() error
+}
+
+// GCSObjectWriter is an [ObjectWriter] for Google Cloud Storage.
+type GCSObjectWriter struct {
+	client *storage.Client
+}
+
+// NewGCSObjectWriter creates a new instance of the GCSObjectWriter.
+func NewGCSObjectWriter(ctx context.Context, opts ...option.ClientOption) (*GCSObjectWriter, error) {
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new storage client: %w", err)
+	}
+	return &GCSObjectWriter{client: client}, nil
+}
+
+// WriteObject writes an object to Google Cloud Storage, replacing the object
+// if it already exists.
+func (w *GCSObjectWriter) WriteObject(ctx context.Context, bucket, object string, content []byte, metadata map[string]string) error {
+	writer := w.client.Bucket(bucket).Object(object).NewWriter(ctx)
+	writer.ContentType = "application/json"
+	writer.Metadata = metadata
+
+	if _, err := writer.Write(content); err != nil {
+		// the object is not created if the writer is not closed cleanly
+		_ = writer.CloseWithError(err)
+		return fmt.Errorf("failed to write object gs://%s/%s: %w", bucket, object, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to write object gs://%s/%s: %w", bucket, object, err)
+	}
+	return nil
+}
+
+// Close handles the graceful shutdown of the storage client.
+func (w *GCSObjectWriter) Close() error {
+	if err := w.client.Close(); err != nil {
+		return fmt.Errorf("failed to close storage client: %w", err)
+	}
+	return nil
+}
+
+// gcsDeadLetterQueue writes the raw payload of dead-lettered events to a
+// bucket, with the headers of the event and the reason it was dead-lettered as
+// object metadata.
+type gcsDeadLetterQueue struct {
+	writer ObjectWriter
+	bucket string
+}
+
+// DeadLetter implements [DeadLetterQueue]. The payload is written to
+// <event type>/<delivery id>.json, so a delivery that is dead-lettered again
+// replaces its previous object.
+func (q *gcsDeadLetterQueue) DeadLetter(ctx context.Context, event *pubsubpb.Event, eventBytes []byte, reason string) error {
+	eventType := event.GetEvent()
+	if eventType == "" {
+		eventType = "unknown"
+	}
+	object := fmt.Sprintf("%s/%s.json", eventType, event.GetDeliveryId())
+
+	metadata := map[string]string{
+		metadataDeliveryID: event.GetDeliveryId(),
+		metadataEvent:      event.GetEvent(),
+		metadataReceived:   event.GetReceived(),
+		metadataSignature:  event.GetSignature(),
+		metadataReason:     reason,
+	}
+	if event.EventTimestamp != nil {
+		metadata[metadataEventTimestamp] = event.GetEventTimestamp()
+	}
+	if host := event.GetGithubHost(); host != "" {
+		metadata[metadataGitHubHost] = host
+	}
+
+	if err := q.writer.WriteObject(ctx, q.bucket, object, []byte(event.GetPayload()), metadata); err != nil {
+		return fmt.Errorf("failed to dead-letter event %s: %w", event.GetDeliveryId(), err)
+	}
+	return nil
+}
+
+// Close implements [DeadLetterQueue].
+func (q *gcsDeadLetterQueue) Close() error {
+	return q.writer.Close()
+}
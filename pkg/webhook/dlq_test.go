@@ -0,0 +1,265 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/abcxyz/pkg/renderer"
+	"github.com/abcxyz/pkg/testutil"
+
+	pubsubpb "github.com/abcxyz/github-metrics-aggregator/protos/pubsub_schemas"
+)
+
+type writtenObject struct {
+	bucket   string
+	object   string
+	content  string
+	metadata map[string]string
+}
+
+// fakeObjectWriter records the written objects, or fails every write with err.
+type fakeObjectWriter struct {
+	mu      sync.Mutex
+	err     error
+	objects []*writtenObject
+}
+
+func (w *fakeObjectWriter) WriteObject(ctx context.Context, bucket, object string, content []byte, metadata map[string]string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	w.objects = append(w.objects, &writtenObject{
+		bucket:   bucket,
+		object:   object,
+		content:  string(content),
+		metadata: metadata,
+	})
+	return nil
+}
+
+func (w *fakeObjectWriter) Close() error {
+	return nil
+}
+
+func TestGCSDeadLetterQueue_DeadLetter(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		event       *pubsubpb.Event
+		writeErr    error
+		wantObjects []*writtenObject
+		wantErr     string
+	}{
+		{
+			name: "success",
+			event: &pubsubpb.Event{
+				DeliveryId:     "delivery-id",
+				Signature:      "sha256=signature",
+				Received:       "2024-03-01T12:00:01Z",
+				Event:          "pull_request",
+				Payload:        `{"action":"opened"}`,
+				EventTimestamp: proto.String("2024-03-01T12:00:00Z"),
+				GithubHost:     "ghe.example.com",
+			},
+			wantObjects: []*writtenObject{{
+				bucket:  "test-dlq-bucket",
+				object:  "pull_request/delivery-id.json",
+				content: `{"action":"opened"}`,
+				metadata: map[string]string{
+					"delivery_id":     "delivery-id",
+					"event":           "pull_request",
+					"received":        "2024-03-01T12:00:01Z",
+					"signature":       "sha256=signature",
+					"event_timestamp": "2024-03-01T12:00:00Z",
+					"github_host":     "ghe.example.com",
+					"reason":          "test reason",
+				},
+			}},
+		},
+		{
+			name: "missing_event_type",
+			event: &pubsubpb.Event{
+				DeliveryId: "delivery-id",
+				Payload:    `{}`,
+			},
+			wantObjects: []*writtenObject{{
+				bucket:  "test-dlq-bucket",
+				object:  "unknown/delivery-id.json",
+				content: `{}`,
+				metadata: map[string]string{
+					"delivery_id": "delivery-id",
+					"event":       "",
+					"received":    "",
+					"signature":   "",
+					"reason":      "test reason",
+				},
+			}},
+		},
+		{
+			name: "write_failure",
+			event: &pubsubpb.Event{
+				DeliveryId: "delivery-id",
+				Event:      "pull_request",
+				Payload:    `{}`,
+			},
+			writeErr: errors.New("bucket not found"),
+			wantErr:  "failed to dead-letter event delivery-id: bucket not found",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			writer := &fakeObjectWriter{err: tc.writeErr}
+			dlq := &gcsDeadLetterQueue{writer: writer, bucket: "test-dlq-bucket"}
+
+			err := dlq.DeadLetter(context.Background(), tc.event, []byte("unused"), "test reason")
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(writer.objects, tc.wantObjects, cmp.AllowUnexported(writtenObject{})); diff != "" {
+				t.Errorf("written objects (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleWebhook_GCSDeadLetterQueue(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	testDataBasePath := path.Join("..", "..", "testdata")
+	pubSubErrGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverEventsTopicID, pstest.WithErrorInjection("Publish", codes.NotFound, "topic id not found"))
+
+	cases := []struct {
+		name          string
+		writeErr      error
+		expStatusCode int
+		expRespBody   string
+		expObjects    int
+	}{
+		{
+			name:          "dlq_success",
+			expStatusCode: http.StatusCreated,
+			expRespBody:   `{"status":"ok"}`,
+			expObjects:    1,
+		},
+		{
+			name:          "dlq_failed",
+			writeErr:      errors.New("bucket not found"),
+			expStatusCode: http.StatusInternalServerError,
+			expRespBody:   `{"errors":["failed to write to backend"]}`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			payload, err := os.ReadFile(path.Join(testDataBasePath, "pull_request.json"))
+			if err != nil {
+				t.Fatalf("failed to create payload from file: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Add(DeliveryIDHeader, "delivery-id")
+			req.Header.Add(EventTypeHeader, "pull_request")
+			req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(serverGitHubWebhookSecret), payload)))
+
+			resp := httptest.NewRecorder()
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQBucketName:        "test-dlq-bucket",
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+			}
+
+			writer := &fakeObjectWriter{err: tc.writeErr}
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:   []option.ClientOption{option.WithGRPCConn(pubSubErrGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride: &MockDatastore{failureEventsExceedsRetryLimit: &failureEventsExceedsRetryLimitRes{res: true}},
+				DLQObjectWriterOverride: writer,
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			srv.handleWebhook().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, tc.expStatusCode; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+
+			if got, want := strings.TrimSpace(resp.Body.String()), tc.expRespBody; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+
+			if got, want := len(writer.objects), tc.expObjects; got != want {
+				t.Fatalf("expected %d objects to be written, got %d", want, got)
+			}
+			if tc.expObjects > 0 {
+				if got, want := writer.objects[0].content, string(payload); got != want {
+					t.Errorf("expected the raw payload to be written, got %q", got)
+				}
+				if got := writer.objects[0].metadata[metadataReason]; !strings.Contains(got, "topic id not found") {
+					t.Errorf("expected the reason to contain the publish error, got %q", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// eventTimestampFields maps event types to the payload fields that hold the
+// time the event happened on GitHub, in order of preference. The first field
+// that is set is used. Event types that aren't listed have no clear event
+// time, e.g. because the payload only describes the current state of a
+// resource.
+var eventTimestampFields = map[string][][]string{
+	"check_run":                   {{"check_run", "completed_at"}, {"check_run", "started_at"}},
+	"check_suite":                 {{"check_suite", "updated_at"}},
+	"deployment":                  {{"deployment", "updated_at"}},
+	"deployment_status":           {{"deployment_status", "updated_at"}},
+	"issue_comment":               {{"comment", "updated_at"}},
+	"issues":                      {{"issue", "updated_at"}},
+	"pull_request":                {{"pull_request", "updated_at"}},
+	"pull_request_review":         {{"review", "submitted_at"}},
+	"pull_request_review_comment": {{"comment", "updated_at"}},
+	"push":                        {{"head_commit", "timestamp"}},
+	"release":                     {{"release", "published_at"}, {"release", "created_at"}},
+	"workflow_job":                {{"workflow_job", "completed_at"}, {"workflow_job", "started_at"}},
+	"workflow_run":                {{"workflow_run", "updated_at"}},
+}
+
+// eventTimestamp returns the time the event happened on GitHub according to
+// its payload, formatted like the received time. False is returned if the
+// event type has no clear event time or the payload does not contain it.
+func eventTimestamp(eventType string, payload []byte) (string, bool) {
+	fields, ok := eventTimestampFields[eventType]
+	if !ok {
+		return "", false
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return "", false
+	}
+
+	for _, path := range fields {
+		value, ok := lookupString(body, path)
+		if !ok {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			continue
+		}
+		return t.UTC().Format(time.RFC3339Nano), true
+	}
+	return "", false
+}
+
+// lookupString returns the non-empty string at the given path of nested JSON
+// objects.
+func lookupString(body map[string]any, path []string) (string, bool) {
+	for _, key := range path[:len(path)-1] {
+		nested, ok := body[key].(map[string]any)
+		if !ok {
+			return "", false
+		}
+		body = nested
+	}
+
+	value, ok := body[path[len(path)-1]].(string)
+	return value, ok && value != ""
+}
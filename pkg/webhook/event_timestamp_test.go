@@ -0,0 +1,117 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestEventTimestamp(t *testing.T) {
+	t.Parallel()
+
+	testDataBasePath := path.Join("..", "..", "testdata")
+
+	cases := []struct {
+		name        string
+		eventType   string
+		payloadFile string
+		payload     string
+		want        string
+		wantOK      bool
+	}{
+		{
+			name:        "pull_request",
+			eventType:   "pull_request",
+			payloadFile: "pull_request.json",
+			want:        "2019-05-15T15:20:33Z",
+			wantOK:      true,
+		},
+		{
+			name:        "issues",
+			eventType:   "issues",
+			payloadFile: "issues.json",
+			want:        "2019-05-15T15:20:18Z",
+			wantOK:      true,
+		},
+		{
+			name:        "workflow_job_falls_back_to_started_at",
+			eventType:   "workflow_job",
+			payloadFile: "workflow_job.json",
+			want:        "2021-06-15T19:22:27Z",
+			wantOK:      true,
+		},
+		{
+			name:      "push_converted_to_utc",
+			eventType: "push",
+			payload:   `{"head_commit": {"timestamp": "2024-03-01T09:30:00.5-05:00"}}`,
+			want:      "2024-03-01T14:30:00.5Z",
+			wantOK:    true,
+		},
+		{
+			name:      "release_falls_back_to_created_at",
+			eventType: "release",
+			payload:   `{"release": {"published_at": null, "created_at": "2024-03-01T12:00:00Z"}}`,
+			want:      "2024-03-01T12:00:00Z",
+			wantOK:    true,
+		},
+		{
+			name:      "event_type_without_timestamp",
+			eventType: "star",
+			payload:   `{"starred_at": "2024-03-01T12:00:00Z"}`,
+		},
+		{
+			name:      "missing_field",
+			eventType: "pull_request",
+			payload:   `{"action": "opened"}`,
+		},
+		{
+			name:      "invalid_timestamp",
+			eventType: "pull_request",
+			payload:   `{"pull_request": {"updated_at": "yesterday"}}`,
+		},
+		{
+			name:      "invalid_payload",
+			eventType: "pull_request",
+			payload:   `{`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			payload := []byte(tc.payload)
+			if tc.payloadFile != "" {
+				var err error
+				payload, err = os.ReadFile(path.Join(testDataBasePath, tc.payloadFile))
+				if err != nil {
+					t.Fatalf("failed to read payload: %v", err)
+				}
+			}
+
+			got, ok := eventTimestamp(tc.eventType, payload)
+			if ok != tc.wantOK {
+				t.Errorf("eventTimestamp(%q) ok = %t, want %t", tc.eventType, ok, tc.wantOK)
+			}
+			if got != tc.want {
+				t.Errorf("eventTimestamp(%q) = %q, want %q", tc.eventType, got, tc.want)
+			}
+		})
+	}
+}
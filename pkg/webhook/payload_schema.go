@@ -0,0 +1,277 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// PayloadSchema is a JSON schema that the payloads of an event type are
+// validated against, to catch changes of the GitHub API before malformed
+// events are published. Only the type, required, properties, items and enum
+// keywords are supported, schemas with other keywords are rejected when they
+// are parsed.
+type PayloadSchema struct {
+	Type       schemaTypes               `json:"type"`
+	Required   []string                  `json:"required"`
+	Properties map[string]*PayloadSchema `json:"properties"`
+	Items      *PayloadSchema            `json:"items"`
+	Enum       []any                     `json:"enum"`
+}
+
+// schemaTypes are the types a value may have, either a single type or a list
+// of types in the schema. Values of any type are valid if empty.
+type schemaTypes []string
+
+// UnmarshalJSON implements [json.Unmarshaler].
+func (t *schemaTypes) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings: %w", err)
+	}
+	*t = list
+	return nil
+}
+
+// knownSchemaTypes are the types of JSON schema.
+var knownSchemaTypes = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// supportedSchemaKeywords are the keywords of JSON schema that are validated.
+var supportedSchemaKeywords = []string{"type", "required", "properties", "items", "enum"}
+
+// annotationSchemaKeywords are the keywords of JSON schema that do not
+// constrain values, they are allowed but have no effect.
+var annotationSchemaKeywords = []string{"$schema", "$id", "$comment", "title", "description", "default", "examples"}
+
+// ParsePayloadSchema parses a JSON schema. Schemas using keywords that are not
+// supported are rejected, rather than silently accepting values they would not
+// allow.
+func ParsePayloadSchema(b []byte) (*PayloadSchema, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse payload schema: %w", err)
+	}
+	if err := checkSchemaKeywords(raw, "$"); err != nil {
+		return nil, err
+	}
+
+	var schema PayloadSchema
+	if err := json.Unmarshal(b, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse payload schema: %w", err)
+	}
+	if err := schema.check("$"); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// checkSchemaKeywords returns an error if the raw schema, or one of its
+// subschemas, has a keyword that is not supported.
+func checkSchemaKeywords(raw map[string]any, path string) error {
+	keywords := make([]string, 0, len(raw))
+	for keyword := range raw {
+		keywords = append(keywords, keyword)
+	}
+	// keywords are checked in a stable order, so the same error is reported for
+	// the same schema
+	slices.Sort(keywords)
+	for _, keyword := range keywords {
+		if !slices.Contains(supportedSchemaKeywords, keyword) && !slices.Contains(annotationSchemaKeywords, keyword) {
+			return fmt.Errorf("invalid payload schema: unsupported keyword %q at %s", keyword, path)
+		}
+	}
+
+	if properties, ok := raw["properties"].(map[string]any); ok {
+		names := make([]string, 0, len(properties))
+		for name := range properties {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if property, ok := properties[name].(map[string]any); ok {
+				if err := checkSchemaKeywords(property, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if items, ok := raw["items"].(map[string]any); ok {
+		if err := checkSchemaKeywords(items, path+"[]"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check returns an error if the schema, or one of its subschemas, has an
+// unknown type.
+func (s *PayloadSchema) check(path string) error {
+	for _, typ := range s.Type {
+		if !slices.Contains(knownSchemaTypes, typ) {
+			return fmt.Errorf("invalid payload schema: unknown type %q at %s", typ, path)
+		}
+	}
+	for name, property := range s.Properties {
+		if property == nil {
+			continue
+		}
+		if err := property.check(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.check(path + "[]"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate returns an error describing the first value of the payload that
+// does not conform to the schema.
+func (s *PayloadSchema) Validate(payload []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	// numbers are kept as is to tell integers apart
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
+	return s.validate(v, "$")
+}
+
+func (s *PayloadSchema) validate(v any, path string) error {
+	if s == nil {
+		return nil
+	}
+
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(typ string) bool { return hasSchemaType(v, typ) }) {
+		return fmt.Errorf("%s must be of type %s, got %s", path, strings.Join(s.Type, " or "), valueType(v))
+	}
+
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return jsonEqual(v, e) }) {
+		return fmt.Errorf("%s must be one of the values of its enum", path)
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s is missing required property %q", path, name)
+			}
+		}
+		// properties are validated in a stable order, so the same error is
+		// reported for the same payload
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if value, ok := v[name]; ok {
+				if err := s.Properties[name].validate(value, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		for i, item := range v {
+			if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasSchemaType reports whether the decoded JSON value is of the schema type.
+func hasSchemaType(v any, typ string) bool {
+	if typ == "integer" {
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	}
+	return valueType(v) == typ
+}
+
+// valueType returns the schema type of the decoded JSON value, numbers are of
+// type number.
+func valueType(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number, float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// jsonEqual reports whether both values have the same JSON encoding.
+func jsonEqual(a, b any) bool {
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
+
+// loadPayloadSchemas parses the payload schema files of each event type.
+func loadPayloadSchemas(files map[string]string) (map[string]*PayloadSchema, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	schemas := make(map[string]*PayloadSchema, len(files))
+	for eventType, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read payload schema of %s events: %w", eventType, err)
+		}
+		schema, err := ParsePayloadSchema(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load payload schema of %s events: %w", eventType, err)
+		}
+		schemas[eventType] = schema
+	}
+	return schemas, nil
+}
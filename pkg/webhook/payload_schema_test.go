@@ -0,0 +1,279 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/abcxyz/pkg/renderer"
+	"github.com/abcxyz/pkg/testutil"
+	"google.golang.org/api/option"
+)
+
+const testPullRequestSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["action", "number", "pull_request"],
+	"properties": {
+		"action": {"type": "string", "enum": ["opened", "closed"]},
+		"number": {"type": "integer"},
+		"pull_request": {
+			"type": "object",
+			"required": ["labels"],
+			"properties": {
+				"labels": {"type": "array", "items": {"type": "object", "required": ["name"]}},
+				"merged_at": {"type": ["string", "null"]}
+			}
+		}
+	}
+}`
+
+func TestPayloadSchema_Validate(t *testing.T) {
+	t.Parallel()
+
+	schema, err := ParsePayloadSchema([]byte(testPullRequestSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		payload string
+		wantErr string
+	}{
+		{
+			name:    "valid",
+			payload: `{"action": "opened", "number": 1, "pull_request": {"labels": [{"name": "bug"}], "merged_at": null}, "other": true}`,
+		},
+		{
+			name:    "missing_required_property",
+			payload: `{"action": "opened", "pull_request": {"labels": []}}`,
+			wantErr: `$ is missing required property "number"`,
+		},
+		{
+			name:    "wrong_type",
+			payload: `{"action": "opened", "number": "1", "pull_request": {"labels": []}}`,
+			wantErr: "$.number must be of type integer, got string",
+		},
+		{
+			name:    "not_an_integer",
+			payload: `{"action": "opened", "number": 1.5, "pull_request": {"labels": []}}`,
+			wantErr: "$.number must be of type integer, got number",
+		},
+		{
+			name:    "not_in_enum",
+			payload: `{"action": "reopened", "number": 1, "pull_request": {"labels": []}}`,
+			wantErr: "$.action must be one of the values of its enum",
+		},
+		{
+			name:    "invalid_array_item",
+			payload: `{"action": "closed", "number": 1, "pull_request": {"labels": [{"name": "bug"}, {}]}}`,
+			wantErr: `$.pull_request.labels[1] is missing required property "name"`,
+		},
+		{
+			name:    "one_of_several_types",
+			payload: `{"action": "closed", "number": 1, "pull_request": {"labels": [], "merged_at": 1}}`,
+			wantErr: "$.pull_request.merged_at must be of type string or null, got number",
+		},
+		{
+			name:    "malformed_payload",
+			payload: `{"action": `,
+			wantErr: "failed to parse payload",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := schema.Validate([]byte(tc.payload))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestParsePayloadSchema_UnknownType(t *testing.T) {
+	t.Parallel()
+
+	_, err := ParsePayloadSchema([]byte(`{"type": "object", "properties": {"number": {"type": "int"}}}`))
+	if diff := testutil.DiffErrString(err, `unknown type "int" at $.number`); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestParsePayloadSchema_UnsupportedKeyword(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{
+			name:   "annotations",
+			schema: `{"$schema": "https://json-schema.org/draft/2020-12/schema", "title": "Pull request", "type": "object", "properties": {"number": {"description": "The number", "type": "integer"}}}`,
+		},
+		{
+			name:    "top_level",
+			schema:  `{"type": "object", "additionalProperties": false}`,
+			wantErr: `unsupported keyword "additionalProperties" at $`,
+		},
+		{
+			name:    "property",
+			schema:  `{"type": "object", "properties": {"number": {"type": "integer", "minimum": 1}}}`,
+			wantErr: `unsupported keyword "minimum" at $.number`,
+		},
+		{
+			name:    "array_items",
+			schema:  `{"type": "array", "items": {"$ref": "#/$defs/label"}}`,
+			wantErr: `unsupported keyword "$ref" at $[]`,
+		},
+		{
+			name:    "composition",
+			schema:  `{"properties": {"merged_at": {"oneOf": [{"type": "string"}, {"type": "null"}]}}}`,
+			wantErr: `unsupported keyword "oneOf" at $.merged_at`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParsePayloadSchema([]byte(tc.schema))
+			if diff := testutil.DiffErrString(err, tc.wantErr); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestHandleWebhook_PayloadSchema(t *testing.T) {
+	t.Parallel()
+
+	schemaFile := filepath.Join(t.TempDir(), "pull_request.json")
+	if err := os.WriteFile(schemaFile, []byte(testPullRequestSchema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name           string
+		eventType      string
+		payload        string
+		expEventsCount int
+		expDLQCount    int
+	}{
+		{
+			name:           "valid_payload_published",
+			eventType:      "pull_request",
+			payload:        `{"action": "opened", "number": 1, "pull_request": {"labels": []}}`,
+			expEventsCount: 1,
+		},
+		{
+			name:        "invalid_payload_dead_lettered",
+			eventType:   "pull_request",
+			payload:     `{"action": "opened", "number": "1", "pull_request": {"labels": []}}`,
+			expDLQCount: 1,
+		},
+		{
+			name:           "event_type_without_schema_published",
+			eventType:      "push",
+			payload:        `{"ref": 1}`,
+			expEventsCount: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			eventsPubSub, eventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverEventsTopicID)
+			dlqEventsPubSub, dlqEventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+			payload := []byte(tc.payload)
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Add(DeliveryIDHeader, "delivery-id")
+			req.Header.Add(EventTypeHeader, tc.eventType)
+			req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(serverGitHubWebhookSecret), payload)))
+
+			resp := httptest.NewRecorder()
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQEventsTopicID:     serverDLQEventsTopicID,
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+				PayloadSchemaFiles:   map[string]string{"pull_request": schemaFile},
+			}
+
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:  &MockDatastore{},
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			srv.handleWebhook().ServeHTTP(resp, req)
+
+			// dead-lettered events are acknowledged as well
+			if got, want := resp.Code, http.StatusCreated; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+			if got, want := strings.TrimSpace(resp.Body.String()), `{"status":"ok"}`; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+			if got, want := len(eventsPubSub.Messages()), tc.expEventsCount; got != want {
+				t.Errorf("expected %d messages on the events topic, got %d", want, got)
+			}
+			if got, want := len(dlqEventsPubSub.Messages()), tc.expDLQCount; got != want {
+				t.Errorf("expected %d messages on the dlq topic, got %d", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+
+	pubsubpb "github.com/abcxyz/github-metrics-aggregator/protos/pubsub_schemas"
+)
+
+// The attributes of events published with exactly-once publishing or event
+// type tables enabled.
+const (
+	// AttributeDeliveryID is the GitHub delivery id of the event. Pubsub assigns
+	// a new message id every time an event is published, while the delivery id
+	// is the same for every redelivery of the event by GitHub, so consumers
+	// deduplicate on it.
+	AttributeDeliveryID = "delivery_id"
+
+	// AttributeEvent is the GitHub event type of the event. The BigQuery
+	// subscriptions of event type tables filter on it.
+	AttributeEvent = "event"
+)
+
+// publish sends the event to the topic of the messenger. With exactly-once
+// publishing or event type tables enabled, the message carries the delivery id
+// and event type as attributes. With exactly-once publishing enabled, the full
+// name of the repository of the event is its ordering key as well, so that the
+// events of a repository are delivered in order.
+func (s *Server) publish(messenger *PubSubMessenger, event *pubsubpb.Event, eventBytes []byte) error {
+	if !s.exactlyOncePublishing && len(s.eventTypeTables) == 0 {
+		return messenger.Send(context.Background(), eventBytes)
+	}
+
+	attributes := map[string]string{
+		AttributeDeliveryID: event.GetDeliveryId(),
+		AttributeEvent:      event.GetEvent(),
+	}
+
+	var key string
+	if s.exactlyOncePublishing {
+		key = orderingKey(event.GetPayload())
+	}
+	return messenger.Publish(context.Background(), eventBytes, attributes, key)
+}
+
+// eventsTable returns the table that events of the given type are stored in,
+// which is the events table unless the type has a dedicated table.
+func (s *Server) eventsTable(eventType string) string {
+	if tableID, ok := s.eventTypeTables[eventType]; ok {
+		return tableID
+	}
+	return s.eventsTableID
+}
+
+// orderingKey returns the full name of the repository of the payload. Events
+// that are not associated with a repository, such as installation events, are
+// not ordered.
+func orderingKey(payload string) string {
+	var p struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		return ""
+	}
+	return p.Repository.FullName
+}
@@ -51,16 +51,45 @@ func NewPubSubMessenger(ctx context.Context, projectID, topicID string, opts ...
 
 // Send sends a message to a Google Cloud pubsub topic.
 func (p *PubSubMessenger) Send(ctx context.Context, msg []byte) error {
+	return p.Publish(ctx, msg, nil, "")
+}
+
+// EnableMessageOrdering allows messages to be published with an ordering key.
+// It must be called before the first message is published.
+func (p *PubSubMessenger) EnableMessageOrdering() {
+	p.topic.EnableMessageOrdering = true
+}
+
+// Publish sends a message with the given attributes and ordering key to a
+// Google Cloud pubsub topic. Messages with an ordering key are only accepted
+// once EnableMessageOrdering was called. If publishing a message with an
+// ordering key fails, publishing for that key is resumed so that later
+// messages are not rejected.
+func (p *PubSubMessenger) Publish(ctx context.Context, msg []byte, attributes map[string]string, orderingKey string) error {
 	result := p.topic.Publish(ctx, &pubsub.Message{
-		Data: msg,
+		Data:        msg,
+		Attributes:  attributes,
+		OrderingKey: orderingKey,
 	})
 
 	if _, err := result.Get(ctx); err != nil {
+		if orderingKey != "" {
+			p.topic.ResumePublish(orderingKey)
+		}
 		return fmt.Errorf("pubsub: failed to get result: %w", err)
 	}
 	return nil
 }
 
+// TopicExists reports whether the pubsub topic exists.
+func (p *PubSubMessenger) TopicExists(ctx context.Context) (bool, error) {
+	exists, err := p.topic.Exists(ctx)
+	if err != nil {
+		return false, fmt.Errorf("pubsub: failed to check topic %s: %w", p.topicID, err)
+	}
+	return exists, nil
+}
+
 // Close handles the graceful shutdown of the pubsub client.
 func (p *PubSubMessenger) Close() error {
 	p.topic.Stop()
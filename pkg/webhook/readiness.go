@@ -0,0 +1,114 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/abcxyz/pkg/logging"
+)
+
+// dependencyBigQuery names the BigQuery dataset in a readiness response.
+// Pubsub topics are named "pubsub/<topic id>".
+const dependencyBigQuery = "bigquery"
+
+// readinessTimeout bounds the time spent checking the dependencies, so that
+// an unreachable dependency fails the check instead of being retried until
+// the client gives up.
+const readinessTimeout = 5 * time.Second
+
+// readinessResponse is the response body rendered by the readiness check.
+type readinessResponse struct {
+	Status             string   `json:"status"`
+	FailedDependencies []string `json:"failed_dependencies,omitempty"`
+}
+
+// handleReadiness responds with 200 when the dependencies of the webhook are
+// reachable, and with 503 naming each failing dependency otherwise. Unlike
+// /healthz, this fetches the metadata of the BigQuery dataset and checks that
+// every pubsub topic the webhook publishes to exists.
+func (s *Server) handleReadiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+		logger := logging.FromContext(ctx)
+
+		var failed []string
+		if err := s.datastore.CheckDataset(ctx); err != nil {
+			logger.ErrorContext(ctx, "readiness check failed",
+				"dependency", dependencyBigQuery,
+				"error", err,
+			)
+			failed = append(failed, dependencyBigQuery)
+		}
+
+		for _, messenger := range s.pubsubMessengers() {
+			if err := checkTopic(ctx, messenger); err != nil {
+				dependency := "pubsub/" + messenger.topicID
+				logger.ErrorContext(ctx, "readiness check failed",
+					"dependency", dependency,
+					"error", err,
+				)
+				failed = append(failed, dependency)
+			}
+		}
+
+		if len(failed) > 0 {
+			s.h.RenderJSON(w, http.StatusServiceUnavailable, &readinessResponse{
+				Status:             "unavailable",
+				FailedDependencies: failed,
+			})
+			return
+		}
+		s.h.RenderJSON(w, http.StatusOK, &readinessResponse{Status: statusOK["status"]})
+	})
+}
+
+// pubsubMessengers returns the messengers of the events topic, the DLQ topic
+// unless events are dead-lettered to a bucket, and the routed topics, in that
+// order. Routed topics are ordered by event type.
+func (s *Server) pubsubMessengers() []*PubSubMessenger {
+	eventTypes := make([]string, 0, len(s.routedEventsPubsub))
+	for eventType := range s.routedEventsPubsub {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	messengers := []*PubSubMessenger{s.eventsPubsub}
+	if s.dlqEventsPubsub != nil {
+		messengers = append(messengers, s.dlqEventsPubsub)
+	}
+	for _, eventType := range eventTypes {
+		messengers = append(messengers, s.routedEventsPubsub[eventType])
+	}
+	return messengers
+}
+
+// checkTopic returns an error if the topic of the messenger cannot be reached
+// or does not exist.
+func checkTopic(ctx context.Context, messenger *PubSubMessenger) error {
+	exists, err := messenger.TopicExists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("topic %s does not exist", messenger.topicID)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/pubsub/pstest"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+
+	"github.com/abcxyz/pkg/renderer"
+)
+
+func TestHandleReadiness(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name              string
+		datastoreOverride Datastore
+		eventsTopicID     string
+		eventsPubSubOpts  []pstest.ServerReactorOption
+		dlqEventsTopicID  string
+		expStatusCode     int
+		expRespBody       string
+	}{
+		{
+			name:              "success",
+			datastoreOverride: &MockDatastore{},
+			eventsTopicID:     serverEventsTopicID,
+			dlqEventsTopicID:  serverDLQEventsTopicID,
+			expStatusCode:     http.StatusOK,
+			expRespBody:       `{"status":"ok"}`,
+		},
+		{
+			name: "bigquery_failure",
+			datastoreOverride: &MockDatastore{
+				checkDataset: &checkDatasetRes{err: errors.New("dataset not found")},
+			},
+			eventsTopicID:    serverEventsTopicID,
+			dlqEventsTopicID: serverDLQEventsTopicID,
+			expStatusCode:    http.StatusServiceUnavailable,
+			expRespBody:      `{"status":"unavailable","failed_dependencies":["bigquery"]}`,
+		},
+		{
+			name:              "events_topic_failure",
+			datastoreOverride: &MockDatastore{},
+			eventsTopicID:     serverEventsTopicID,
+			eventsPubSubOpts: []pstest.ServerReactorOption{
+				pstest.WithErrorInjection("GetTopic", codes.PermissionDenied, "permission denied"),
+			},
+			dlqEventsTopicID: serverDLQEventsTopicID,
+			expStatusCode:    http.StatusServiceUnavailable,
+			expRespBody:      `{"status":"unavailable","failed_dependencies":["pubsub/test-events-topic-id"]}`,
+		},
+		{
+			name:              "dlq_topic_missing",
+			datastoreOverride: &MockDatastore{},
+			eventsTopicID:     serverEventsTopicID,
+			dlqEventsTopicID:  "other-topic-id",
+			expStatusCode:     http.StatusServiceUnavailable,
+			expRespBody:       `{"status":"unavailable","failed_dependencies":["pubsub/test-dlq-events-topic-id"]}`,
+		},
+		{
+			name: "all_dependencies_failure",
+			datastoreOverride: &MockDatastore{
+				checkDataset: &checkDatasetRes{err: errors.New("permission denied")},
+			},
+			eventsTopicID:    "other-topic-id",
+			dlqEventsTopicID: "other-topic-id",
+			expStatusCode:    http.StatusServiceUnavailable,
+			expRespBody:      `{"status":"unavailable","failed_dependencies":["bigquery","pubsub/test-events-topic-id","pubsub/test-dlq-events-topic-id"]}`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			// The test servers only create the given topic, so a topic id other
+			// than the configured one simulates a missing topic.
+			eventsGRPCConn := setupPubSubServer(ctx, t, serverProjectID, tc.eventsTopicID, tc.eventsPubSubOpts...)
+			dlqEventsGRPCConn := setupPubSubServer(ctx, t, serverProjectID, tc.dlqEventsTopicID)
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQEventsTopicID:     serverDLQEventsTopicID,
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+			}
+
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:  tc.datastoreOverride,
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			resp := httptest.NewRecorder()
+			srv.handleReadiness().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, tc.expStatusCode; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+
+			if got, want := strings.TrimSpace(resp.Body.String()), tc.expRespBody; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		})
+	}
+}
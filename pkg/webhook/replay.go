@@ -0,0 +1,171 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/api/idtoken"
+
+	pubsubpb "github.com/abcxyz/github-metrics-aggregator/protos/pubsub_schemas"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// ReplayPath is the path of the replay endpoint. It is only served when replay
+// service accounts are configured.
+const ReplayPath = "/replay"
+
+var (
+	errReplayDisabled     = fmt.Errorf("replay is disabled")
+	errReplayUnauthorized = fmt.Errorf("failed to authenticate replay request")
+	errReplayForbidden    = fmt.Errorf("caller is not allowed to replay events")
+	errMissingEventHeader = fmt.Errorf("delivery id and event type headers are required")
+)
+
+// IDTokenValidator validates a Google ID token for the given audience and
+// returns its payload.
+type IDTokenValidator func(ctx context.Context, idToken, audience string) (*idtoken.Payload, error)
+
+// handleReplay handles the re-injection of payloads that were already validated,
+// e.g. events replayed from the DLQ, whose webhook signature can't be recreated.
+// Instead of a webhook signature, the request must carry a Google ID token of
+// one of the replay service accounts. The payload is then ingested like a
+// webhook delivery.
+func (s *Server) handleReplay() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now().UTC()
+		ctx := r.Context()
+		logger := logging.FromContext(ctx)
+
+		received := now.Format(time.RFC3339Nano)
+		deliveryID := r.Header.Get(DeliveryIDHeader)
+		eventType := r.Header.Get(EventTypeHeader)
+
+		render := func(code int, data any, disposition string) {
+			s.renderResponse(w, code, data, deliveryID, disposition, received)
+		}
+
+		// the endpoint is not routed when disabled, this guards against it being
+		// served regardless
+		if len(s.replayServiceAccounts) == 0 {
+			render(http.StatusNotFound, errReplayDisabled, dispositionRejected)
+			return
+		}
+
+		caller, err := s.replayCaller(ctx, r)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to authenticate replay request",
+				"code", http.StatusUnauthorized,
+				"body", errReplayUnauthorized,
+				"error", err)
+			render(http.StatusUnauthorized, errReplayUnauthorized, dispositionRejected)
+			return
+		}
+
+		if !slices.Contains(s.replayServiceAccounts, caller) {
+			logger.ErrorContext(ctx, "caller is not allowed to replay events",
+				"code", http.StatusForbidden,
+				"body", errReplayForbidden,
+				"caller", caller)
+			render(http.StatusForbidden, errReplayForbidden, dispositionRejected)
+			return
+		}
+
+		if deliveryID == "" || eventType == "" {
+			logger.ErrorContext(ctx, "replay request is missing event headers",
+				"code", http.StatusBadRequest,
+				"body", errMissingEventHeader)
+			render(http.StatusBadRequest, errMissingEventHeader, dispositionRejected)
+			return
+		}
+
+		payload, err := s.readPayload(w, r)
+		if errors.Is(err, errPayloadTooLarge) {
+			logger.ErrorContext(ctx, "replay payload too large",
+				"code", http.StatusRequestEntityTooLarge,
+				"body", errPayloadTooLarge,
+				"max_payload_bytes", s.maxPayloadBytes)
+			render(http.StatusRequestEntityTooLarge, errPayloadTooLarge, dispositionRejected)
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "failed read replay request body",
+				"code", http.StatusInternalServerError,
+				"body", errReadingPayload,
+				"error", err)
+			render(http.StatusInternalServerError, errReadingPayload, dispositionFailed)
+			return
+		}
+
+		if len(payload) == 0 {
+			logger.ErrorContext(ctx, "no payload received",
+				"code", http.StatusBadRequest,
+				"body", errNoPayload)
+			render(http.StatusBadRequest, errNoPayload, dispositionRejected)
+			return
+		}
+
+		// replayed payloads are published like those of GitHub, which are
+		// always JSON
+		if !json.Valid(payload) {
+			logger.ErrorContext(ctx, "malformed replay payload received",
+				"code", http.StatusBadRequest,
+				"body", errMalformedPayload)
+			render(http.StatusBadRequest, errMalformedPayload, dispositionRejected)
+			return
+		}
+
+		logger.InfoContext(ctx, "replaying event",
+			"delivery_id", deliveryID,
+			"event_type", eventType,
+			"caller", caller)
+
+		// the payload is not signed by GitHub, so the event has no signature
+		s.ingestEvent(ctx, render, now, &pubsubpb.Event{
+			Received:   received,
+			DeliveryId: deliveryID,
+			Event:      eventType,
+			Payload:    string(payload),
+			GithubHost: s.githubHost(r),
+		}, true)
+	})
+}
+
+// replayCaller validates the Google ID token in the authorization header of a
+// replay request and returns the verified email of the caller.
+func (s *Server) replayCaller(ctx context.Context, r *http.Request) (string, error) {
+	idToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || idToken == "" {
+		return "", fmt.Errorf("missing bearer token")
+	}
+
+	payload, err := s.idTokenValidator(ctx, idToken, s.replayAudience)
+	if err != nil {
+		return "", fmt.Errorf("invalid id token: %w", err)
+	}
+
+	email, _ := payload.Claims["email"].(string)
+	if verified, _ := payload.Claims["email_verified"].(bool); email == "" || !verified {
+		return "", fmt.Errorf("id token has no verified email")
+	}
+	return email, nil
+}
@@ -0,0 +1,248 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/idtoken"
+	"google.golang.org/api/option"
+
+	pubsubpb "github.com/abcxyz/github-metrics-aggregator/protos/pubsub_schemas"
+	"github.com/abcxyz/pkg/renderer"
+)
+
+const (
+	testReplayAudience       = "https://webhook.example.com"
+	testReplayServiceAccount = "replay@test-project.iam.gserviceaccount.com"
+)
+
+// testIDTokenValidator accepts the tokens of the given claims for the test
+// replay audience.
+func testIDTokenValidator(tokens map[string]map[string]any) IDTokenValidator {
+	return func(ctx context.Context, idToken, audience string) (*idtoken.Payload, error) {
+		claims, ok := tokens[idToken]
+		if !ok || audience != testReplayAudience {
+			return nil, errors.New("invalid token")
+		}
+		return &idtoken.Payload{Audience: audience, Claims: claims}, nil
+	}
+}
+
+func TestHandleReplay(t *testing.T) {
+	t.Parallel()
+
+	payload, err := os.ReadFile(path.Join("..", "..", "testdata", "pull_request.json"))
+	if err != nil {
+		t.Fatalf("failed to create payload from file: %v", err)
+	}
+
+	validator := testIDTokenValidator(map[string]map[string]any{
+		"allowed-token": {
+			"email":          testReplayServiceAccount,
+			"email_verified": true,
+		},
+		"other-token": {
+			"email":          "other@test-project.iam.gserviceaccount.com",
+			"email_verified": true,
+		},
+		"unverified-token": {
+			"email":          testReplayServiceAccount,
+			"email_verified": false,
+		},
+	})
+
+	cases := []struct {
+		name                  string
+		replayServiceAccounts []string
+		path                  string
+		token                 string
+		omitDeliveryID        bool
+		payload               string
+		expStatusCode         int
+		expRespBody           string
+		expPublished          bool
+	}{
+		{
+			name:                  "webhook_requires_signature",
+			replayServiceAccounts: []string{testReplayServiceAccount},
+			path:                  "/webhook",
+			token:                 "allowed-token",
+			expStatusCode:         http.StatusUnauthorized,
+		},
+		{
+			name:          "replay_disabled_by_default",
+			path:          ReplayPath,
+			token:         "allowed-token",
+			expStatusCode: http.StatusNotFound,
+		},
+		{
+			name:                  "replay_accepts_unsigned_payload",
+			replayServiceAccounts: []string{testReplayServiceAccount},
+			path:                  ReplayPath,
+			token:                 "allowed-token",
+			expStatusCode:         http.StatusCreated,
+			expPublished:          true,
+		},
+		{
+			name:                  "replay_missing_token",
+			replayServiceAccounts: []string{testReplayServiceAccount},
+			path:                  ReplayPath,
+			expStatusCode:         http.StatusUnauthorized,
+		},
+		{
+			name:                  "replay_invalid_token",
+			replayServiceAccounts: []string{testReplayServiceAccount},
+			path:                  ReplayPath,
+			token:                 "invalid-token",
+			expStatusCode:         http.StatusUnauthorized,
+		},
+		{
+			name:                  "replay_unverified_email",
+			replayServiceAccounts: []string{testReplayServiceAccount},
+			path:                  ReplayPath,
+			token:                 "unverified-token",
+			expStatusCode:         http.StatusUnauthorized,
+		},
+		{
+			name:                  "replay_service_account_not_allowed",
+			replayServiceAccounts: []string{testReplayServiceAccount},
+			path:                  ReplayPath,
+			token:                 "other-token",
+			expStatusCode:         http.StatusForbidden,
+		},
+		{
+			name:                  "replay_missing_delivery_id",
+			replayServiceAccounts: []string{testReplayServiceAccount},
+			path:                  ReplayPath,
+			token:                 "allowed-token",
+			omitDeliveryID:        true,
+			expStatusCode:         http.StatusBadRequest,
+		},
+		{
+			name:                  "replay_malformed_payload",
+			replayServiceAccounts: []string{testReplayServiceAccount},
+			path:                  ReplayPath,
+			token:                 "allowed-token",
+			payload:               "{bad json",
+			expStatusCode:         http.StatusBadRequest,
+			expRespBody:           errMalformedPayload.Error(),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			eventsPubSub, eventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverEventsTopicID)
+			dlqEventsGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+			cfg := &Config{
+				DatasetID:             serverDatasetID,
+				EventsTableID:         serverEventsTableID,
+				EventsTopicID:         serverEventsTopicID,
+				DLQEventsTopicID:      serverDLQEventsTopicID,
+				FailureEventsTableID:  serverFailureEventsTableID,
+				ProjectID:             serverProjectID,
+				RetryLimit:            1,
+				GitHubWebhookSecret:   serverGitHubWebhookSecret,
+				ReplayServiceAccounts: tc.replayServiceAccounts,
+				ReplayAudience:        testReplayAudience,
+			}
+
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:  &MockDatastore{},
+				IDTokenValidatorOverride: validator,
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			body := payload
+			if tc.payload != "" {
+				body = []byte(tc.payload)
+			}
+			req := httptest.NewRequest(http.MethodPost, tc.path, bytes.NewReader(body))
+			if !tc.omitDeliveryID {
+				req.Header.Add(DeliveryIDHeader, "delivery-id")
+			}
+			req.Header.Add(EventTypeHeader, "pull_request")
+			if tc.token != "" {
+				req.Header.Add("Authorization", "Bearer "+tc.token)
+			}
+
+			resp := httptest.NewRecorder()
+			srv.Routes(ctx).ServeHTTP(resp, req)
+
+			if got, want := resp.Code, tc.expStatusCode; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+			if got := resp.Body.String(); !strings.Contains(got, tc.expRespBody) {
+				t.Errorf("expected response body %q to contain %q", got, tc.expRespBody)
+			}
+
+			messages := eventsPubSub.Messages()
+			if !tc.expPublished {
+				if got := len(messages); got != 0 {
+					t.Errorf("expected no messages on the events topic, got %d", got)
+				}
+				return
+			}
+
+			if got, want := len(messages), 1; got != want {
+				t.Fatalf("expected %d messages on the events topic, got %d", want, got)
+			}
+			var event pubsubpb.Event
+			if err := json.Unmarshal(messages[0].Data, &event); err != nil {
+				t.Fatalf("failed to unmarshal event: %v", err)
+			}
+			if got, want := event.GetDeliveryId(), "delivery-id"; got != want {
+				t.Errorf("expected delivery id %q to be %q", got, want)
+			}
+			if got := event.GetSignature(); got != "" {
+				t.Errorf("expected replayed event to have no signature, got %q", got)
+			}
+			if got, want := event.GetPayload(), string(payload); got != want {
+				t.Errorf("expected payload of replayed event to be unchanged")
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"net/http"
+)
+
+const (
+	// ResponseFormatMinimal renders only the status or errors of a request.
+	ResponseFormatMinimal = "minimal"
+
+	// ResponseFormatVerbose additionally renders the delivery id, the
+	// disposition of the event and the time it was received.
+	ResponseFormatVerbose = "verbose"
+)
+
+// The dispositions describe what the webhook did with a received event.
+const (
+	dispositionAccepted         = "accepted"
+	dispositionDuplicateID      = "duplicate_delivery"
+	dispositionDuplicatePayload = "duplicate_payload"
+	dispositionDeadLettered     = "dead_lettered"
+	dispositionSpooled          = "spooled"
+	dispositionDropped          = "dropped"
+	dispositionPong             = "pong"
+	dispositionRejected         = "rejected"
+	dispositionFailed           = "failed"
+)
+
+// verboseResponse is the response body rendered by the webhook when the
+// verbose response format is configured.
+type verboseResponse struct {
+	Status      string   `json:"status,omitempty"`
+	Errors      []string `json:"errors,omitempty"`
+	DeliveryID  string   `json:"delivery_id"`
+	Disposition string   `json:"disposition"`
+	Received    string   `json:"received"`
+}
+
+// renderResponse renders the response to a webhook request in the configured
+// format. data is either statusOK or an error. The status code is the same
+// regardless of the format.
+func (s *Server) renderResponse(w http.ResponseWriter, code int, data any, deliveryID, disposition, received string) {
+	if s.responseFormat != ResponseFormatVerbose {
+		s.h.RenderJSON(w, code, data)
+		return
+	}
+
+	resp := &verboseResponse{
+		DeliveryID:  deliveryID,
+		Disposition: disposition,
+		Received:    received,
+	}
+	if err, ok := data.(error); ok {
+		resp.Errors = []string{err.Error()}
+	} else {
+		resp.Status = statusOK["status"]
+	}
+	s.h.RenderJSON(w, code, resp)
+}
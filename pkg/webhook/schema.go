@@ -0,0 +1,74 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errNonConformingEvent is returned when an event does not conform to the
+// events schema, or its payload to the schema of its event type.
+var errNonConformingEvent = errors.New("event does not conform to schema")
+
+// SchemaValidator validates events against a schema registered with Google
+// Cloud pubsub, before they are published to the events topic. Events are
+// validated in their JSON encoding, the same way they are published.
+type SchemaValidator struct {
+	schemaID string
+
+	client *pubsub.SchemaClient
+}
+
+// NewSchemaValidator creates a new instance of the SchemaValidator for the
+// schema of the given project.
+func NewSchemaValidator(ctx context.Context, projectID, schemaID string, opts ...option.ClientOption) (*SchemaValidator, error) {
+	client, err := pubsub.NewSchemaClient(ctx, projectID, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new pubsub schema client: %w", err)
+	}
+
+	return &SchemaValidator{
+		schemaID: schemaID,
+		client:   client,
+	}, nil
+}
+
+// Validate validates the message against the schema. The error wraps
+// errNonConformingEvent if the message does not conform, any other error
+// means the message could not be validated.
+func (v *SchemaValidator) Validate(ctx context.Context, msg []byte) error {
+	if _, err := v.client.ValidateMessageWithID(ctx, msg, pubsub.EncodingJSON, v.schemaID); err != nil {
+		if status.Code(err) == codes.InvalidArgument {
+			return fmt.Errorf("%w %s: %w", errNonConformingEvent, v.schemaID, err)
+		}
+		return fmt.Errorf("pubsub: failed to validate message against schema %s: %w", v.schemaID, err)
+	}
+	return nil
+}
+
+// Close handles the graceful shutdown of the pubsub schema client.
+func (v *SchemaValidator) Close() error {
+	if err := v.client.Close(); err != nil {
+		return fmt.Errorf("failed to close pubsub schema client: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+
+	"github.com/abcxyz/pkg/renderer"
+)
+
+const serverEventsSchemaID = "test-events-schema-id"
+
+func TestHandleWebhook_EventsSchema(t *testing.T) {
+	t.Parallel()
+
+	payload := []byte(`{"action": "opened", "number": 1}`)
+
+	cases := []struct {
+		name           string
+		validateOpts   []pstest.ServerReactorOption
+		expStatusCode  int
+		expRespBody    string
+		expEventsCount int
+		expDLQCount    int
+	}{
+		{
+			name:           "conforming_event_published",
+			expStatusCode:  http.StatusCreated,
+			expRespBody:    `{"status":"ok"}`,
+			expEventsCount: 1,
+		},
+		{
+			name:          "non_conforming_event_dead_lettered",
+			validateOpts:  []pstest.ServerReactorOption{pstest.WithErrorInjection("ValidateMessage", codes.InvalidArgument, "message does not match schema")},
+			expStatusCode: http.StatusCreated,
+			expRespBody:   `{"status":"ok"}`,
+			expDLQCount:   1,
+		},
+		{
+			name:          "validation_failed",
+			validateOpts:  []pstest.ServerReactorOption{pstest.WithErrorInjection("ValidateMessage", codes.PermissionDenied, "permission denied")},
+			expStatusCode: http.StatusInternalServerError,
+			expRespBody:   fmt.Sprintf(`{"errors":["%s"]}`, errWritingToBackend),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			eventsPubSub, eventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverEventsTopicID, tc.validateOpts...)
+			dlqEventsPubSub, dlqEventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+			schemaClient, err := pubsub.NewSchemaClient(ctx, serverProjectID, option.WithGRPCConn(eventsGRPCConn))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := schemaClient.CreateSchema(ctx, serverEventsSchemaID, pubsub.SchemaConfig{
+				Type:       pubsub.SchemaAvro,
+				Definition: `{"type":"record","name":"Event","fields":[{"name":"delivery_id","type":"string"}]}`,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Add(DeliveryIDHeader, "delivery-id")
+			req.Header.Add(EventTypeHeader, "pull_request")
+			req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(serverGitHubWebhookSecret), payload)))
+
+			resp := httptest.NewRecorder()
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQEventsTopicID:     serverDLQEventsTopicID,
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+				EventsSchemaID:       serverEventsSchemaID,
+			}
+
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsGRPCConn), option.WithoutAuthentication()},
+				SchemaPubsubClientOpts:   []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:  &MockDatastore{},
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			srv.handleWebhook().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, tc.expStatusCode; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+			if got, want := strings.TrimSpace(resp.Body.String()), tc.expRespBody; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+			if got, want := len(eventsPubSub.Messages()), tc.expEventsCount; got != want {
+				t.Errorf("expected %d messages on the events topic, got %d", want, got)
+			}
+			if got, want := len(dlqEventsPubSub.Messages()), tc.expDLQCount; got != want {
+				t.Errorf("expected %d messages on the dlq topic, got %d", want, got)
+			}
+		})
+	}
+}
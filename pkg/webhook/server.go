@@ -19,7 +19,9 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
+	"google.golang.org/api/idtoken"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
 
@@ -34,6 +36,9 @@ type Datastore interface {
 	DeliveryEventExists(ctx context.Context, eventsTableID, deliveryID string) (bool, error)
 	FailureEventsExceedsRetryLimit(ctx context.Context, failureEventTableID, deliveryID string, retryLimit int) (bool, error)
 	WriteFailureEvent(ctx context.Context, failureEventTableID, deliveryID, createdAt string) error
+	PayloadHashExists(ctx context.Context, payloadHashesTableID, payloadHash string, since time.Time) (bool, error)
+	WritePayloadHash(ctx context.Context, payloadHashesTableID, deliveryID, payloadHash, createdAt string) error
+	CheckDataset(ctx context.Context) error
 	Close() error
 }
 
@@ -44,10 +49,68 @@ type Server struct {
 	eventsTableID       string
 	failureEventTableID string
 	eventsPubsub        *PubSubMessenger
-	dlqEventsPubsub     *PubSubMessenger
+	dlqEventsPubsub     *PubSubMessenger // nil when dead-lettering to a bucket
+	dlq                 DeadLetterQueue
+	routedEventsPubsub  map[string]*PubSubMessenger // keyed by event type
 	retryLimit          int
-	webhookSecret       string
+	webhookSecrets      []string
 	projectID           string
+
+	// dedupByContent enables skipping events whose payload hash was seen
+	// within dedupWindow, in addition to skipping known delivery ids.
+	dedupByContent       bool
+	dedupWindow          time.Duration
+	payloadHashesTableID string
+
+	// responseFormat is either ResponseFormatMinimal or ResponseFormatVerbose.
+	responseFormat string
+
+	// exactlyOncePublishing publishes events with attributes and ordering keys
+	// for subscriptions with exactly-once delivery.
+	exactlyOncePublishing bool
+
+	// eventTypeTables maps event types to their dedicated events tables, events
+	// of other types are stored in eventsTableID.
+	eventTypeTables map[string]string
+
+	// replayServiceAccounts are allowed to replay events without a webhook
+	// signature, the replay endpoint is disabled if empty.
+	replayServiceAccounts []string
+	replayAudience        string
+	idTokenValidator      IDTokenValidator
+
+	// allowedEventTypes are the event types that are ingested, events of all
+	// types are ingested if nil.
+	allowedEventTypes map[string]struct{}
+
+	// spool stores the events that can't be ingested while the backends are
+	// unavailable, it is drained every spoolDrainInterval. Spooling is
+	// disabled if nil.
+	spool              Spool
+	spoolDrainInterval time.Duration
+
+	// maxPayloadBytes is the maximum size of a payload, larger requests are
+	// rejected.
+	maxPayloadBytes int64
+
+	// enterpriseHost is the host recorded with all events, the host is taken
+	// from each request if empty.
+	enterpriseHost string
+
+	// eventsSchema validates events before they are published, events are not
+	// validated if nil.
+	eventsSchema EventValidator
+
+	// payloadSchemas maps event types to the schema their payloads are
+	// validated against, payloads of other types are not validated.
+	payloadSchemas map[string]*PayloadSchema
+}
+
+// EventValidator validates an event before it is published to the events
+// topic.
+type EventValidator interface {
+	Validate(ctx context.Context, msg []byte) error
+	Close() error
 }
 
 // PubSubClientConfig are the pubsub client config options.
@@ -58,10 +121,17 @@ type PubSubClientConfig struct {
 
 // WebhookClientOptions encapsulate client config options as well as dependency implementation overrides.
 type WebhookClientOptions struct {
-	EventPubsubClientOpts    []option.ClientOption
-	DLQEventPubsubClientOpts []option.ClientOption
-	BigQueryClientOpts       []option.ClientOption
-	DatastoreClientOverride  Datastore // used for unit testing
+	EventPubsubClientOpts       []option.ClientOption
+	DLQEventPubsubClientOpts    []option.ClientOption
+	DLQStorageClientOpts        []option.ClientOption
+	RoutedEventPubsubClientOpts []option.ClientOption
+	BigQueryClientOpts          []option.ClientOption
+	SpoolStorageClientOpts      []option.ClientOption
+	SchemaPubsubClientOpts      []option.ClientOption
+	DatastoreClientOverride     Datastore        // used for unit testing
+	IDTokenValidatorOverride    IDTokenValidator // used for unit testing
+	DLQObjectWriterOverride     ObjectWriter     // used for unit testing
+	SpoolOverride               Spool            // used for unit testing
 }
 
 // NewServer creates a new HTTP server implementation that will handle
@@ -72,31 +142,122 @@ func NewServer(ctx context.Context, h *renderer.Renderer, cfg *Config, wco *Webh
 		return nil, fmt.Errorf("failed to create event pubsub: %w", err)
 	}
 
-	dlqEventsPubsub, err := NewPubSubMessenger(ctx, cfg.ProjectID, cfg.DLQEventsTopicID, wco.DLQEventPubsubClientOpts...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create DLQ pubsub: %w", err)
+	var dlqEventsPubsub *PubSubMessenger
+	var dlqObjectWriter ObjectWriter
+	if cfg.DLQBucketName != "" {
+		dlqObjectWriter = wco.DLQObjectWriterOverride
+		if dlqObjectWriter == nil {
+			writer, err := NewGCSObjectWriter(ctx, wco.DLQStorageClientOpts...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create DLQ storage writer: %w", err)
+			}
+			dlqObjectWriter = writer
+		}
+	} else {
+		dlqEventsPubsub, err = NewPubSubMessenger(ctx, cfg.ProjectID, cfg.DLQEventsTopicID, wco.DLQEventPubsubClientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create DLQ pubsub: %w", err)
+		}
+	}
+
+	routedEventsPubsub := make(map[string]*PubSubMessenger, len(cfg.EventTopicRoutes))
+	for eventType, topicID := range cfg.EventTopicRoutes {
+		routedPubsub, err := NewPubSubMessenger(ctx, cfg.ProjectID, topicID, wco.RoutedEventPubsubClientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pubsub for %s events: %w", eventType, err)
+		}
+		routedEventsPubsub[eventType] = routedPubsub
+	}
+
+	if cfg.ExactlyOncePublishing {
+		eventsPubsub.EnableMessageOrdering()
+		if dlqEventsPubsub != nil {
+			dlqEventsPubsub.EnableMessageOrdering()
+		}
+		for _, routedPubsub := range routedEventsPubsub {
+			routedPubsub.EnableMessageOrdering()
+		}
 	}
 
 	datastore := wco.DatastoreClientOverride
 	if datastore == nil {
-		bq, err := NewBigQuery(ctx, cfg.BigQueryProjectID, cfg.DatasetID, wco.BigQueryClientOpts...)
+		bq, err := NewBigQuery(ctx, cfg.BigQueryProjectID, cfg.DatasetID, cfg.bigQueryWriteRetry(), wco.BigQueryClientOpts...)
 		if err != nil {
 			return nil, fmt.Errorf("server.NewBigQuery: %w", err)
 		}
 		datastore = bq
 	}
 
-	return &Server{
-		h:                   h,
-		datastore:           datastore,
-		eventsTableID:       cfg.EventsTableID,
-		failureEventTableID: cfg.FailureEventsTableID,
-		eventsPubsub:        eventsPubsub,
-		dlqEventsPubsub:     dlqEventsPubsub,
-		projectID:           cfg.ProjectID,
-		retryLimit:          cfg.RetryLimit,
-		webhookSecret:       cfg.GitHubWebhookSecret,
-	}, nil
+	spool := wco.SpoolOverride
+	if spool == nil {
+		switch {
+		case cfg.SpoolDir != "":
+			spool, err = NewDirSpool(cfg.SpoolDir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create spool: %w", err)
+			}
+		case cfg.SpoolBucketName != "":
+			spool, err = NewGCSSpool(ctx, cfg.SpoolBucketName, wco.SpoolStorageClientOpts...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create spool: %w", err)
+			}
+		}
+	}
+
+	var eventsSchema EventValidator
+	if cfg.EventsSchemaID != "" {
+		eventsSchema, err = NewSchemaValidator(ctx, cfg.ProjectID, cfg.EventsSchemaID, wco.SchemaPubsubClientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create events schema validator: %w", err)
+		}
+	}
+
+	payloadSchemas, err := loadPayloadSchemas(cfg.PayloadSchemaFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	idTokenValidator := wco.IDTokenValidatorOverride
+	if idTokenValidator == nil {
+		idTokenValidator = idtoken.Validate
+	}
+
+	s := &Server{
+		h:                    h,
+		datastore:            datastore,
+		eventsTableID:        cfg.EventsTableID,
+		failureEventTableID:  cfg.FailureEventsTableID,
+		eventsPubsub:         eventsPubsub,
+		dlqEventsPubsub:      dlqEventsPubsub,
+		routedEventsPubsub:   routedEventsPubsub,
+		projectID:            cfg.ProjectID,
+		retryLimit:           cfg.RetryLimit,
+		webhookSecrets:       cfg.webhookSecrets(),
+		dedupByContent:       cfg.DedupByContent,
+		dedupWindow:          cfg.DedupWindow,
+		payloadHashesTableID: cfg.PayloadHashesTableID,
+		responseFormat:       cfg.ResponseFormat,
+
+		exactlyOncePublishing: cfg.ExactlyOncePublishing,
+		eventTypeTables:       cfg.eventTypeTables(),
+		replayServiceAccounts: cfg.ReplayServiceAccounts,
+		replayAudience:        cfg.ReplayAudience,
+		idTokenValidator:      idTokenValidator,
+		allowedEventTypes:     cfg.allowedEventTypes(),
+		spool:                 spool,
+		spoolDrainInterval:    cfg.SpoolDrainInterval,
+		maxPayloadBytes:       cfg.maxPayloadBytes(),
+		enterpriseHost:        cfg.enterpriseHost(),
+		eventsSchema:          eventsSchema,
+		payloadSchemas:        payloadSchemas,
+	}
+
+	if dlqEventsPubsub != nil {
+		s.dlq = &pubSubDeadLetterQueue{messenger: dlqEventsPubsub, publish: s.publish}
+	} else {
+		s.dlq = &gcsDeadLetterQueue{writer: dlqObjectWriter, bucket: cfg.DLQBucketName}
+	}
+	return s, nil
 }
 
 // Routes creates a ServeMux of all of the routes that
@@ -105,9 +266,16 @@ func (s *Server) Routes(ctx context.Context) http.Handler {
 	logger := logging.FromContext(ctx)
 	mux := http.NewServeMux()
 	mux.Handle("/healthz", healthcheck.HandleHTTPHealthCheck())
+	mux.Handle("/readyz", s.handleReadiness())
 	mux.Handle("/webhook", s.handleWebhook())
 	mux.Handle("/version", s.handleVersion())
 
+	// payloads are ingested without a webhook signature, only serve them when
+	// explicitly enabled
+	if len(s.replayServiceAccounts) > 0 {
+		mux.Handle(ReplayPath, s.handleReplay())
+	}
+
 	// Middleware
 	root := logging.HTTPInterceptor(logger, s.projectID)(mux)
 
@@ -130,8 +298,26 @@ func (s *Server) Close() error {
 		return fmt.Errorf("failed to shutdown event pubsub connection: %w", err)
 	}
 
-	if err := s.dlqEventsPubsub.Close(); err != nil {
-		return fmt.Errorf("failed to shutdown DLQ pubsub connection: %w", err)
+	if err := s.dlq.Close(); err != nil {
+		return fmt.Errorf("failed to shutdown DLQ connection: %w", err)
+	}
+
+	for eventType, routedPubsub := range s.routedEventsPubsub {
+		if err := routedPubsub.Close(); err != nil {
+			return fmt.Errorf("failed to shutdown pubsub connection for %s events: %w", eventType, err)
+		}
+	}
+
+	if s.eventsSchema != nil {
+		if err := s.eventsSchema.Close(); err != nil {
+			return fmt.Errorf("failed to close the events schema validator: %w", err)
+		}
+	}
+
+	if s.spool != nil {
+		if err := s.spool.Close(); err != nil {
+			return fmt.Errorf("failed to close the spool: %w", err)
+		}
 	}
 
 	if err := s.datastore.Close(); err != nil {
@@ -0,0 +1,352 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+
+	pubsubpb "github.com/abcxyz/github-metrics-aggregator/protos/pubsub_schemas"
+	"github.com/abcxyz/pkg/logging"
+)
+
+// spoolPrefix is the prefix of the objects of spooled events in the spool
+// bucket.
+const spoolPrefix = "spool/"
+
+// Spool durably stores validated events that can neither be ingested nor
+// recorded as failed because the backends are unavailable, so that they are
+// ingested once the backends recover rather than lost when GitHub stops
+// retrying them.
+type Spool interface {
+	// Spool stores the event.
+	Spool(ctx context.Context, event *pubsubpb.Event) error
+
+	// List returns the names of the spooled events, in the order they were
+	// spooled.
+	List(ctx context.Context) ([]string, error)
+
+	// Read returns the spooled event with the given name.
+	Read(ctx context.Context, name string) (*pubsubpb.Event, error)
+
+	// Remove deletes the spooled event with the given name.
+	Remove(ctx context.Context, name string) error
+
+	Close() error
+}
+
+// spoolName returns the name of a spooled event, which sorts in the order the
+// events were spooled. The delivery id is escaped, as it is taken from a
+// request header that is not covered by the webhook signature.
+func spoolName(now time.Time, event *pubsubpb.Event) string {
+	return fmt.Sprintf("%020d-%s.json", now.UnixNano(), url.PathEscape(event.GetDeliveryId()))
+}
+
+// decodeSpooledEvent decodes a spooled event, which is stored the same way as
+// it is published to the events topic.
+func decodeSpooledEvent(name string, b []byte) (*pubsubpb.Event, error) {
+	var event pubsubpb.Event
+	if err := json.Unmarshal(b, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode spooled event %s: %w", name, err)
+	}
+	return &event, nil
+}
+
+// DirSpool is a [Spool] that stores each event as a file in a local
+// directory.
+type DirSpool struct {
+	dir string
+}
+
+// NewDirSpool creates a new DirSpool in the given directory, creating it if it
+// does not exist.
+func NewDirSpool(dir string) (*DirSpool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory %s: %w", dir, err)
+	}
+	return &DirSpool{dir: dir}, nil
+}
+
+// Spool implements [Spool]. The event is written to a temporary file that is
+// synced and renamed, so that a spooled event is never partially written.
+func (s *DirSpool) Spool(ctx context.Context, event *pubsubpb.Event) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event %s: %w", event.GetDeliveryId(), err)
+	}
+
+	f, err := os.CreateTemp(s.dir, ".spool-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create spool file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync spool file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close spool file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), filepath.Join(s.dir, spoolName(time.Now(), event))); err != nil {
+		return fmt.Errorf("failed to spool event %s: %w", event.GetDeliveryId(), err)
+	}
+	return nil
+}
+
+// List implements [Spool].
+func (s *DirSpool) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spool directory %s: %w", s.dir, err)
+	}
+
+	// the entries are sorted by name, which is the order they were spooled in
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+// Read implements [Spool].
+func (s *DirSpool) Read(ctx context.Context, name string) (*pubsubpb.Event, error) {
+	b, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spooled event %s: %w", name, err)
+	}
+	return decodeSpooledEvent(name, b)
+}
+
+// Remove implements [Spool].
+func (s *DirSpool) Remove(ctx context.Context, name string) error {
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("failed to remove spooled event %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close implements [Spool].
+func (s *DirSpool) Close() error {
+	return nil
+}
+
+// GCSSpool is a [Spool] that stores each event as an object in a Google Cloud
+// Storage bucket, under spool/.
+type GCSSpool struct {
+	client *storage.Client
+	bucket string
+}
+
+// NewGCSSpool creates a new GCSSpool in the given bucket.
+func NewGCSSpool(ctx context.Context, bucket string, opts ...option.ClientOption) (*GCSSpool, error) {
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new storage client: %w", err)
+	}
+	return &GCSSpool{client: client, bucket: bucket}, nil
+}
+
+// Spool implements [Spool].
+func (s *GCSSpool) Spool(ctx context.Context, event *pubsubpb.Event) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event %s: %w", event.GetDeliveryId(), err)
+	}
+
+	object := spoolPrefix + spoolName(time.Now(), event)
+	writer := s.client.Bucket(s.bucket).Object(object).NewWriter(ctx)
+	writer.ContentType = "application/json"
+	if _, err := writer.Write(b); err != nil {
+		// the object is not created if the writer is not closed cleanly
+		_ = writer.CloseWithError(err)
+		return fmt.Errorf("failed to write object gs://%s/%s: %w", s.bucket, object, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to write object gs://%s/%s: %w", s.bucket, object, err)
+	}
+	return nil
+}
+
+// List implements [Spool].
+func (s *GCSSpool) List(ctx context.Context) ([]string, error) {
+	// objects are listed in lexicographic order, which is the order they were
+	// spooled in
+	var names []string
+	it := s.client.Bucket(s.bucket).Objects(ctx, &storage.Query{Prefix: spoolPrefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects of gs://%s/%s: %w", s.bucket, spoolPrefix, err)
+		}
+		names = append(names, strings.TrimPrefix(attrs.Name, spoolPrefix))
+	}
+	return names, nil
+}
+
+// Read implements [Spool].
+func (s *GCSSpool) Read(ctx context.Context, name string) (*pubsubpb.Event, error) {
+	reader, err := s.client.Bucket(s.bucket).Object(spoolPrefix + name).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spooled event %s: %w", name, err)
+	}
+	defer reader.Close()
+
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spooled event %s: %w", name, err)
+	}
+	return decodeSpooledEvent(name, b)
+}
+
+// Remove implements [Spool].
+func (s *GCSSpool) Remove(ctx context.Context, name string) error {
+	if err := s.client.Bucket(s.bucket).Object(spoolPrefix + name).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to remove spooled event %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close handles the graceful shutdown of the storage client.
+func (s *GCSSpool) Close() error {
+	if err := s.client.Close(); err != nil {
+		return fmt.Errorf("failed to close storage client: %w", err)
+	}
+	return nil
+}
+
+// spoolEvent spools an event that can neither be ingested nor recorded as
+// failed and renders the response. The event is accepted once spooled, so
+// that GitHub does not report a failed delivery for it.
+func (s *Server) spoolEvent(ctx context.Context, render func(code int, data any, disposition string), event *pubsubpb.Event) {
+	logger := logging.FromContext(ctx)
+
+	if err := s.spool.Spool(ctx, event); err != nil {
+		logger.ErrorContext(ctx, "failed to spool event",
+			"method", "Spool",
+			"code", http.StatusInternalServerError,
+			"body", errWritingToBackend,
+			"error", err)
+		render(http.StatusInternalServerError, errWritingToBackend, dispositionFailed)
+		return
+	}
+
+	logger.WarnContext(ctx, "spooled event while the backends are unavailable",
+		"delivery_id", event.GetDeliveryId())
+	render(http.StatusAccepted, statusOK, dispositionSpooled)
+}
+
+// StartSpoolDrain drains the spool every spool drain interval in the
+// background, until the context is done. Nothing is started if spooling is
+// disabled.
+func (s *Server) StartSpoolDrain(ctx context.Context) {
+	if s.spool == nil {
+		return
+	}
+
+	go func() {
+		logger := logging.FromContext(ctx)
+		ticker := time.NewTicker(s.spoolDrainInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			drained, err := s.drainSpool(ctx)
+			if err != nil {
+				logger.WarnContext(ctx, "failed to drain spool",
+					"drained_event_count", drained,
+					"error", err)
+				continue
+			}
+			if drained > 0 {
+				logger.InfoContext(ctx, "drained spool", "drained_event_count", drained)
+			}
+		}
+	}()
+}
+
+// drainSpool ingests the spooled events in the order they were spooled,
+// removing each once it was ingested, and returns the number of drained
+// events. It stops at the first event that fails to be ingested, as the
+// backends are likely still unavailable. Spooled events that can't be read are
+// skipped and left in the spool.
+func (s *Server) drainSpool(ctx context.Context) (int, error) {
+	logger := logging.FromContext(ctx)
+
+	names, err := s.spool.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list spooled events: %w", err)
+	}
+
+	var drained int
+	for _, name := range names {
+		event, err := s.spool.Read(ctx, name)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to read spooled event, skipping it",
+				"name", name,
+				"error", err)
+			continue
+		}
+
+		var code int
+		var disposition string
+		render := func(c int, data any, d string) {
+			code, disposition = c, d
+		}
+		s.ingestEvent(ctx, render, time.Now().UTC(), event, false)
+		if code >= http.StatusInternalServerError {
+			return drained, fmt.Errorf("failed to ingest spooled event %s with status %d", event.GetDeliveryId(), code)
+		}
+
+		if err := s.spool.Remove(ctx, name); err != nil {
+			return drained, err
+		}
+		drained++
+
+		logger.InfoContext(ctx, "ingested spooled event",
+			"delivery_id", event.GetDeliveryId(),
+			"disposition", disposition)
+	}
+	return drained, nil
+}
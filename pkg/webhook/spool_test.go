@@ -0,0 +1,296 @@
+// Copyright 2024 The Authors (see AUTHORS file)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	pubsubpb "github.com/abcxyz/github-metrics-aggregator/protos/pubsub_schemas"
+	"github.com/abcxyz/pkg/renderer"
+)
+
+func TestDirSpool(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	spool, err := NewDirSpool(path.Join(t.TempDir(), "spool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []*pubsubpb.Event{
+		{DeliveryId: "first", Event: "push", Received: "2024-03-01T12:00:00Z", Payload: `{"a": 1}`},
+		// the delivery id is not signed, it must not escape the directory
+		{DeliveryId: "../second", Event: "push", Received: "2024-03-01T12:00:01Z", Payload: `{"b": 2}`},
+	}
+	for _, event := range events {
+		if err := spool.Spool(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := spool.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(names), len(events); got != want {
+		t.Fatalf("expected %d spooled events, got %d: %q", want, got, names)
+	}
+
+	for i, name := range names {
+		if strings.Contains(name, "/") {
+			t.Errorf("expected spooled event name without separators, got %q", name)
+		}
+
+		got, err := spool.Read(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(got, events[i], protocmp.Transform()); diff != "" {
+			t.Errorf("spooled event %d (-got,+want):\n%s", i, diff)
+		}
+
+		if err := spool.Remove(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err = spool.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("expected no spooled events after removing them, got %q", names)
+	}
+}
+
+// failingPublish fails the publishes of the fake PubSub server until it
+// recovers.
+type failingPublish struct {
+	recovered atomic.Bool
+}
+
+// React implements [pstest.Reactor].
+func (r *failingPublish) React(_ any) (bool, any, error) {
+	if r.recovered.Load() {
+		return false, nil, nil
+	}
+	// unlike codes.Unavailable, the client does not retry the publish
+	return true, nil, status.Error(codes.PermissionDenied, "pubsub unavailable")
+}
+
+func TestServer_SpoolAndDrain(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		pubSubErr      bool
+		pubSubRecovers bool
+		datastore      *MockDatastore
+		wantSpooled    bool
+		wantDrained    int
+		wantDrainErr   bool
+		wantPublished  int
+		wantRemaining  int
+	}{
+		{
+			name: "bigquery_down_still_published",
+			datastore: &MockDatastore{
+				deliveryEventExists: &deliveryEventExistsRes{err: errors.New("bigquery unavailable")},
+			},
+			wantPublished: 1,
+		},
+		{
+			name:           "pubsub_and_bigquery_down_then_recovered",
+			pubSubErr:      true,
+			pubSubRecovers: true,
+			datastore: &MockDatastore{
+				deliveryEventExists: &deliveryEventExistsRes{err: errors.New("bigquery unavailable")},
+			},
+			wantSpooled:   true,
+			wantDrained:   1,
+			wantPublished: 1,
+		},
+		{
+			name:      "pubsub_and_bigquery_down",
+			pubSubErr: true,
+			datastore: &MockDatastore{
+				failureEventsExceedsRetryLimit: &failureEventsExceedsRetryLimitRes{err: errors.New("bigquery unavailable")},
+			},
+			wantSpooled:   true,
+			wantDrainErr:  true,
+			wantRemaining: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			publishes := &failingPublish{}
+			publishes.recovered.Store(!tc.pubSubErr)
+			pubSubOpts := []pstest.ServerReactorOption{{FuncName: "Publish", Reactor: publishes}}
+			eventsPubSub, eventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverEventsTopicID, pubSubOpts...)
+			dlqEventsGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+			spool, err := NewDirSpool(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQEventsTopicID:     serverDLQEventsTopicID,
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+				ResponseFormat:       ResponseFormatVerbose,
+			}
+
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:  tc.datastore,
+				SpoolOverride:            spool,
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			payload, err := os.ReadFile(path.Join("..", "..", "testdata", "pull_request.json"))
+			if err != nil {
+				t.Fatalf("failed to create payload from file: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Add(DeliveryIDHeader, "delivery-id")
+			req.Header.Add(EventTypeHeader, "pull_request")
+			req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(serverGitHubWebhookSecret), payload)))
+
+			resp := httptest.NewRecorder()
+			srv.handleWebhook().ServeHTTP(resp, req)
+
+			wantCode, wantDisposition, wantSpooledCount := http.StatusCreated, dispositionAccepted, 0
+			if tc.wantSpooled {
+				wantCode, wantDisposition, wantSpooledCount = http.StatusAccepted, dispositionSpooled, 1
+			}
+			if got, want := resp.Code, wantCode; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+			var body verboseResponse
+			if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if got, want := body.Disposition, wantDisposition; got != want {
+				t.Errorf("expected disposition %q, got %q", want, got)
+			}
+
+			names, err := spool.List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(names), wantSpooledCount; got != want {
+				t.Fatalf("expected %d spooled events, got %d", want, got)
+			}
+			if !tc.wantSpooled {
+				if got, want := len(eventsPubSub.Messages()), tc.wantPublished; got != want {
+					t.Errorf("expected %d messages on the events topic, got %d", want, got)
+				}
+				return
+			}
+
+			// draining while the backends are still down leaves the event in
+			// the spool without spooling it again
+			if drained, err := srv.drainSpool(ctx); err == nil || drained != 0 {
+				t.Errorf("expected drain to fail while the backends are down, drained %d: %v", drained, err)
+			}
+
+			// the backends recover
+			tc.datastore.deliveryEventExists = nil
+			tc.datastore.failureEventsExceedsRetryLimit = nil
+			publishes.recovered.Store(tc.pubSubRecovers)
+
+			drained, err := srv.drainSpool(ctx)
+			if gotErr := err != nil; gotErr != tc.wantDrainErr {
+				t.Errorf("drainSpool() error = %v, want error %t", err, tc.wantDrainErr)
+			}
+			if got, want := drained, tc.wantDrained; got != want {
+				t.Errorf("expected %d drained events, got %d", want, got)
+			}
+
+			messages := eventsPubSub.Messages()
+			if got, want := len(messages), tc.wantPublished; got != want {
+				t.Errorf("expected %d messages on the events topic, got %d", want, got)
+			}
+			for _, msg := range messages {
+				var event pubsubpb.Event
+				if err := json.Unmarshal(msg.Data, &event); err != nil {
+					t.Fatalf("failed to decode message: %v", err)
+				}
+				if got, want := event.GetDeliveryId(), "delivery-id"; got != want {
+					t.Errorf("expected delivery id %q, got %q", want, got)
+				}
+				if got, want := event.GetPayload(), string(payload); got != want {
+					t.Errorf("expected the spooled payload to be published")
+				}
+			}
+
+			names, err = spool.List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(names), tc.wantRemaining; got != want {
+				t.Errorf("expected %d events left in the spool, got %d", want, got)
+			}
+		})
+	}
+}
@@ -17,13 +17,17 @@ package webhook
 import (
 	"context"
 	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // GitHub still signs payloads with sha1 for compatibility.
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	pubsubpb "github.com/abcxyz/github-metrics-aggregator/protos/pubsub_schemas"
@@ -34,21 +38,42 @@ const (
 	// SHA256SignatureHeader is the GitHub header key used to pass the HMAC-SHA256 hexdigest.
 	SHA256SignatureHeader = "X-Hub-Signature-256"
 
+	// SHA1SignatureHeader is the legacy GitHub header key used to pass the HMAC-SHA1 hexdigest.
+	SHA1SignatureHeader = "X-Hub-Signature"
+
 	// EventTypeHeader is the GitHub header key used to pass the event type.
 	EventTypeHeader = "X-Github-Event"
 
+	// pingEventType is the type of the event GitHub sends when a webhook is
+	// created, to check that it is reachable.
+	pingEventType = "ping"
+
 	// DeliveryIDHeader is the GitHub header key used to pass the unique ID for the webhook event.
 	DeliveryIDHeader = "X-Github-Delivery"
 
+	// EnterpriseHostHeader is the GitHub Enterprise Server header key used to
+	// pass the hostname of the instance that sent the webhook event.
+	EnterpriseHostHeader = "X-Github-Enterprise-Host"
+
+	// defaultGitHubHost is the host of the events without an enterprise host.
+	defaultGitHubHost = "github.com"
+
 	// mb is used for conversion to megabytes.
 	mb = 1000000
+
+	// defaultMaxPayloadBytes is the maximum size of a webhook payload GitHub
+	// sends.
+	defaultMaxPayloadBytes = 25 * mb
 )
 
 var (
-	statusOK = map[string]string{"status": "ok"}
+	statusOK   = map[string]string{"status": "ok"}
+	statusPong = map[string]string{"status": "pong"}
 
 	errReadingPayload    = fmt.Errorf("failed to read webhook payload")
+	errPayloadTooLarge   = fmt.Errorf("payload too large")
 	errNoPayload         = fmt.Errorf("no payload received")
+	errMalformedPayload  = fmt.Errorf("malformed payload")
 	errInvalidSignature  = fmt.Errorf("failed to validate webhook signature")
 	errCreatingEventJSON = fmt.Errorf("failed to create event json")
 	errWritingToBackend  = fmt.Errorf("failed to write to backend")
@@ -65,15 +90,28 @@ func (s *Server) handleWebhook() http.Handler {
 		received := now.Format(time.RFC3339Nano)
 		deliveryID := r.Header.Get(DeliveryIDHeader)
 		eventType := r.Header.Get(EventTypeHeader)
-		signature := r.Header.Get(SHA256SignatureHeader)
+		sha256Signature := r.Header.Get(SHA256SignatureHeader)
+		sha1Signature := r.Header.Get(SHA1SignatureHeader)
 
-		payload, err := io.ReadAll(io.LimitReader(r.Body, 25*mb))
+		render := func(code int, data any, disposition string) {
+			s.renderResponse(w, code, data, deliveryID, disposition, received)
+		}
+
+		payload, err := s.readPayload(w, r)
+		if errors.Is(err, errPayloadTooLarge) {
+			logger.ErrorContext(ctx, "webhook payload too large",
+				"code", http.StatusRequestEntityTooLarge,
+				"body", errPayloadTooLarge,
+				"max_payload_bytes", s.maxPayloadBytes)
+			render(http.StatusRequestEntityTooLarge, errPayloadTooLarge, dispositionRejected)
+			return
+		}
 		if err != nil {
 			logger.ErrorContext(ctx, "failed read webhook request body",
 				"code", http.StatusInternalServerError,
 				"body", errReadingPayload,
 				"error", err)
-			s.h.RenderJSON(w, http.StatusInternalServerError, errReadingPayload)
+			render(http.StatusInternalServerError, errReadingPayload, dispositionFailed)
 			return
 		}
 
@@ -81,110 +119,342 @@ func (s *Server) handleWebhook() http.Handler {
 			logger.ErrorContext(ctx, "no payload received",
 				"code", http.StatusBadRequest,
 				"body", errNoPayload)
-			s.h.RenderJSON(w, http.StatusBadRequest, errNoPayload)
+			render(http.StatusBadRequest, errNoPayload, dispositionRejected)
 			return
 		}
 
-		if !s.isValidSignature(signature, payload) {
+		signature, ok := s.validSignature(sha256Signature, sha1Signature, payload)
+		if !ok {
 			logger.ErrorContext(ctx, "failed to validate webhook payload",
 				"code", http.StatusUnauthorized,
 				"body", errInvalidSignature,
 				"error", err)
-			s.h.RenderJSON(w, http.StatusUnauthorized, errInvalidSignature)
+			render(http.StatusUnauthorized, errInvalidSignature, dispositionRejected)
 			return
 		}
 
-		exists, err := s.datastore.DeliveryEventExists(ctx, s.eventsTableID, deliveryID)
-		if err != nil {
-			logger.ErrorContext(ctx, "failed to call BigQuery",
-				"method", "DeliveryEventExists",
-				"code", http.StatusInternalServerError,
-				"body", errWritingToBackend,
-				"error", err)
-			s.h.RenderJSON(w, http.StatusInternalServerError, errWritingToBackend)
+		// a ping only checks that the webhook is reachable, it is not an event
+		// of the repositories and is not ingested
+		if eventType == pingEventType {
+			logger.InfoContext(ctx, "received ping", "delivery_id", deliveryID)
+			render(http.StatusOK, statusPong, dispositionPong)
 			return
 		}
 
-		// event was already processed, don't resubmit it to PubSub
-		if exists {
-			s.h.RenderJSON(w, http.StatusAlreadyReported, statusOK)
+		// GitHub always sends JSON payloads, anything else would fail to be
+		// processed once published
+		if !json.Valid(payload) {
+			logger.ErrorContext(ctx, "malformed payload received",
+				"code", http.StatusBadRequest,
+				"body", errMalformedPayload)
+			render(http.StatusBadRequest, errMalformedPayload, dispositionRejected)
 			return
 		}
 
-		event := &pubsubpb.Event{
+		s.ingestEvent(ctx, render, now, &pubsubpb.Event{
 			Received:   received,
 			DeliveryId: deliveryID,
 			Signature:  signature,
 			Event:      eventType,
 			Payload:    string(payload),
+			GithubHost: s.githubHost(r),
+		}, true)
+	})
+}
+
+// ingestEvent publishes an event with a validated payload to the events topic,
+// unless it is a duplicate or its type is not allowed, and renders the
+// response. Events that repeatedly fail to publish are sent to the DLQ once
+// they exceed the retry limit. If spool is true and spooling is enabled, events
+// are still published while BigQuery is unavailable, without being
+// deduplicated, and are spooled until the backends recover if publishing them
+// fails as well.
+func (s *Server) ingestEvent(ctx context.Context, render func(code int, data any, disposition string), now time.Time, event *pubsubpb.Event, spool bool) {
+	logger := logging.FromContext(ctx)
+	deliveryID := event.GetDeliveryId()
+	eventType := event.GetEvent()
+
+	// the event is acknowledged so GitHub doesn't report a failed delivery or
+	// redeliver it
+	if !s.isAllowedEventType(eventType) {
+		logger.InfoContext(ctx, "dropping event of a type that is not allowed",
+			"delivery_id", deliveryID,
+			"event_type", eventType)
+		render(http.StatusAccepted, statusOK, dispositionDropped)
+		return
+	}
+
+	var bigQueryUnavailable bool
+	exists, err := s.datastore.DeliveryEventExists(ctx, s.eventsTable(eventType), deliveryID)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to call BigQuery",
+			"method", "DeliveryEventExists",
+			"code", http.StatusInternalServerError,
+			"body", errWritingToBackend,
+			"error", err)
+
+		// without BigQuery the event can't be deduplicated, nor can a failure
+		// to publish it be recorded, it is only spooled if publishing it fails
+		// too
+		if !spool || s.spool == nil {
+			render(http.StatusInternalServerError, errWritingToBackend, dispositionFailed)
+			return
 		}
+		bigQueryUnavailable = true
+	}
+
+	// event was already processed, don't resubmit it to PubSub
+	if exists {
+		render(http.StatusAlreadyReported, statusOK, dispositionDuplicateID)
+		return
+	}
 
-		eventBytes, err := json.Marshal(event)
+	var contentHash string
+	if s.dedupByContent && !bigQueryUnavailable {
+		contentHash = payloadHash(eventType, []byte(event.GetPayload()))
+		seen, err := s.datastore.PayloadHashExists(ctx, s.payloadHashesTableID, contentHash, now.Add(-s.dedupWindow))
 		if err != nil {
-			logger.ErrorContext(ctx, "failed to marshal event json",
+			logger.ErrorContext(ctx, "failed to call BigQuery",
+				"method", "PayloadHashExists",
 				"code", http.StatusInternalServerError,
-				"body", errCreatingEventJSON,
+				"body", errWritingToBackend,
 				"error", err)
-			s.h.RenderJSON(w, http.StatusInternalServerError, errCreatingEventJSON)
+			render(http.StatusInternalServerError, errWritingToBackend, dispositionFailed)
+			return
+		}
+
+		// an event with the same content was recently processed under a
+		// different delivery id, don't submit it to PubSub
+		if seen {
+			logger.InfoContext(ctx, "skipping event with duplicate payload",
+				"delivery_id", deliveryID,
+				"payload_hash", contentHash)
+			render(http.StatusAlreadyReported, statusOK, dispositionDuplicatePayload)
+			return
+		}
+	}
+
+	// the received time is when the event was ingested, the event timestamp is
+	// when it happened on GitHub, if the payload tells
+	if timestamp, ok := eventTimestamp(eventType, []byte(event.GetPayload())); ok {
+		event.EventTimestamp = &timestamp
+	}
+
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to marshal event json",
+			"code", http.StatusInternalServerError,
+			"body", errCreatingEventJSON,
+			"error", err)
+		render(http.StatusInternalServerError, errCreatingEventJSON, dispositionFailed)
+		return
+	}
+
+	if schema, ok := s.payloadSchemas[eventType]; ok {
+		if err := schema.Validate([]byte(event.GetPayload())); err != nil {
+			err = fmt.Errorf("%w of %s payloads: %w", errNonConformingEvent, eventType, err)
+			s.deadLetterNonConformingEvent(ctx, render, event, eventBytes, err)
+			return
+		}
+	}
+
+	if s.eventsSchema != nil {
+		if err := s.eventsSchema.Validate(ctx, eventBytes); err != nil {
+			s.deadLetterNonConformingEvent(ctx, render, event, eventBytes, err)
+			return
+		}
+	}
+
+	if err := s.publish(s.eventsPubsub, event, eventBytes); err != nil {
+		logger.ErrorContext(ctx, "failed to write messages to event pubsub",
+			"code", http.StatusInternalServerError,
+			"body", errWritingToBackend,
+			"error", err)
+
+		// both PubSub and BigQuery are unavailable
+		if bigQueryUnavailable {
+			s.spoolEvent(ctx, render, event)
 			return
 		}
 
-		if err := s.eventsPubsub.Send(context.Background(), eventBytes); err != nil {
-			logger.ErrorContext(ctx, "failed to write messages to event pubsub",
+		exceeds, bqQueryErr := s.datastore.
+			FailureEventsExceedsRetryLimit(ctx, s.failureEventTableID, deliveryID, s.retryLimit)
+		if bqQueryErr != nil {
+			logger.ErrorContext(ctx, "failed to call BigQuery",
+				"method", "FailureEventsExceedsRetryLimit",
 				"code", http.StatusInternalServerError,
 				"body", errWritingToBackend,
-				"error", err)
+				"error", bqQueryErr)
 
-			exceeds, bqQueryErr := s.datastore.
-				FailureEventsExceedsRetryLimit(ctx, s.failureEventTableID, deliveryID, s.retryLimit)
-			if bqQueryErr != nil {
-				logger.ErrorContext(ctx, "failed to call BigQuery",
-					"method", "FailureEventsExceedsRetryLimit",
+			// both PubSub and BigQuery are unavailable
+			if spool && s.spool != nil {
+				s.spoolEvent(ctx, render, event)
+				return
+			}
+		} else if exceeds {
+			// exceeds the limit, write to DLQ
+			reason := fmt.Sprintf("failed to publish event after %d attempts: %s", s.retryLimit, err)
+			if err := s.dlq.DeadLetter(ctx, event, eventBytes, reason); err != nil {
+				logger.ErrorContext(ctx, "failed to write messages to pubsub DLQ",
+					"method", "SendDLQ",
 					"code", http.StatusInternalServerError,
 					"body", errWritingToBackend,
-					"error", bqQueryErr)
-			} else if exceeds {
-				// exceeds the limit, write to DLQ
-				if err := s.dlqEventsPubsub.Send(context.Background(), eventBytes); err != nil {
-					logger.ErrorContext(ctx, "failed to write messages to pubsub DLQ",
-						"method", "SendDLQ",
-						"code", http.StatusInternalServerError,
-						"body", errWritingToBackend,
-						"error", err)
-
-					// potential outage with PubSub, fail this iteration so an additional
-					// attempt can be made in the future
-					s.h.RenderJSON(w, http.StatusInternalServerError, errWritingToBackend)
-					return
-				}
-
-				// return a 200 so GitHub doesn't report a failed delivery
-				s.h.RenderJSON(w, http.StatusCreated, statusOK)
+					"error", err)
+
+				// potential outage with PubSub, fail this iteration so an additional
+				// attempt can be made in the future
+				render(http.StatusInternalServerError, errWritingToBackend, dispositionFailed)
 				return
-			} else {
-				// record an entry in the failure events table
-				if err := s.datastore.
-					WriteFailureEvent(ctx, s.failureEventTableID, deliveryID, now.Format(time.DateTime)); err != nil {
-					logger.ErrorContext(ctx, "failed to call BigQuery",
-						"method", "WriteFailureEvent",
-						"code", http.StatusInternalServerError,
-						"body", errWritingToBackend,
-						"error", err)
-				}
 			}
 
-			s.h.RenderJSON(w, http.StatusInternalServerError, errWritingToBackend)
+			// return a 200 so GitHub doesn't report a failed delivery
+			render(http.StatusCreated, statusOK, dispositionDeadLettered)
 			return
+		} else {
+			// record an entry in the failure events table
+			if err := s.datastore.
+				WriteFailureEvent(ctx, s.failureEventTableID, deliveryID, now.Format(time.DateTime)); err != nil {
+				logger.ErrorContext(ctx, "failed to call BigQuery",
+					"method", "WriteFailureEvent",
+					"code", http.StatusInternalServerError,
+					"body", errWritingToBackend,
+					"error", err)
+			}
 		}
 
-		s.h.RenderJSON(w, http.StatusCreated, statusOK)
-	})
+		render(http.StatusInternalServerError, errWritingToBackend, dispositionFailed)
+		return
+	}
+
+	if routedPubsub, ok := s.routedEventsPubsub[eventType]; ok {
+		// the event was already accepted, failing the request would not
+		// help since its redelivery is skipped as a duplicate
+		if err := s.publish(routedPubsub, event, eventBytes); err != nil {
+			logger.ErrorContext(ctx, "failed to write messages to routed event pubsub",
+				"method", "SendRouted",
+				"event_type", eventType,
+				"code", http.StatusInternalServerError,
+				"body", errWritingToBackend,
+				"error", err)
+		}
+	}
+
+	if s.dedupByContent && !bigQueryUnavailable {
+		// the event was already accepted, failing to record its hash only
+		// means a duplicate of it will not be detected
+		if err := s.datastore.
+			WritePayloadHash(ctx, s.payloadHashesTableID, deliveryID, contentHash, now.Format(time.DateTime)); err != nil {
+			logger.ErrorContext(ctx, "failed to call BigQuery",
+				"method", "WritePayloadHash",
+				"code", http.StatusInternalServerError,
+				"body", errWritingToBackend,
+				"error", err)
+		}
+	}
+
+	render(http.StatusCreated, statusOK, dispositionAccepted)
+}
+
+// deadLetterNonConformingEvent dead-letters an event that failed to validate
+// against the events schema or the schema of its payload. An event that could not be validated fails the
+// request, so that it is validated again when GitHub redelivers it.
+func (s *Server) deadLetterNonConformingEvent(ctx context.Context, render func(code int, data any, disposition string), event *pubsubpb.Event, eventBytes []byte, validateErr error) {
+	logger := logging.FromContext(ctx)
+
+	if !errors.Is(validateErr, errNonConformingEvent) {
+		logger.ErrorContext(ctx, "failed to validate event against the events schema",
+			"code", http.StatusInternalServerError,
+			"body", errWritingToBackend,
+			"error", validateErr)
+		render(http.StatusInternalServerError, errWritingToBackend, dispositionFailed)
+		return
+	}
+
+	logger.WarnContext(ctx, "dead-lettering event that does not conform to its schema",
+		"delivery_id", event.GetDeliveryId(),
+		"event_type", event.GetEvent(),
+		"error", validateErr)
+	if err := s.dlq.DeadLetter(ctx, event, eventBytes, validateErr.Error()); err != nil {
+		logger.ErrorContext(ctx, "failed to write messages to pubsub DLQ",
+			"method", "SendDLQ",
+			"code", http.StatusInternalServerError,
+			"body", errWritingToBackend,
+			"error", err)
+		render(http.StatusInternalServerError, errWritingToBackend, dispositionFailed)
+		return
+	}
+
+	// the event would never conform on redelivery, return a 201 so GitHub
+	// doesn't report a failed delivery
+	render(http.StatusCreated, statusOK, dispositionDeadLettered)
+}
+
+// isAllowedEventType reports whether events of the given type are ingested.
+func (s *Server) isAllowedEventType(eventType string) bool {
+	if s.allowedEventTypes == nil {
+		return true
+	}
+	_, ok := s.allowedEventTypes[eventType]
+	return ok
 }
 
-// isValidSignature validates the http request signature against the signature of the payload.
-func (s *Server) isValidSignature(signature string, payload []byte) bool {
-	mac := hmac.New(sha256.New, []byte(s.webhookSecret))
-	mac.Write(payload)
-	got := "sha256=" + hex.EncodeToString(mac.Sum(nil))
-	return subtle.ConstantTimeCompare([]byte(signature), []byte(got)) == 1
+// githubHost returns the host of the GitHub instance a request was delivered
+// from. The configured enterprise host takes precedence over the header, which
+// is not covered by the webhook signature.
+func (s *Server) githubHost(r *http.Request) string {
+	if s.enterpriseHost != "" {
+		return s.enterpriseHost
+	}
+	if host := r.Header.Get(EnterpriseHostHeader); host != "" {
+		return strings.ToLower(host)
+	}
+	return defaultGitHubHost
+}
+
+// readPayload reads the body of a request up to the maximum payload size. A
+// larger body is not read to the end, errPayloadTooLarge is returned instead.
+func (s *Server) readPayload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxPayloadBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, errPayloadTooLarge
+		}
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	return payload, nil
+}
+
+// validSignature validates the http request signatures against the signature
+// of the payload and returns the valid one. GitHub sends both a sha256 and a
+// legacy sha1 signature, but proxies may strip either of them. The sha256
+// signature must be valid when present, the sha1 signature is only checked
+// when it is absent so that a forged sha256 signature cannot be bypassed by
+// the weaker one. A signature is valid if it matches any of the configured
+// secrets.
+func (s *Server) validSignature(sha256Signature, sha1Signature string, payload []byte) (string, bool) {
+	if sha256Signature != "" {
+		if !s.isValidSignature(sha256.New, "sha256=", sha256Signature, payload) {
+			return "", false
+		}
+		return sha256Signature, true
+	}
+	if sha1Signature != "" && s.isValidSignature(sha1.New, "sha1=", sha1Signature, payload) {
+		return sha1Signature, true
+	}
+	return "", false
+}
+
+// isValidSignature validates the http request signature against the signature
+// of the payload computed with the given hash and any of the webhook secrets.
+func (s *Server) isValidSignature(h func() hash.Hash, prefix, signature string, payload []byte) bool {
+	for _, secret := range s.webhookSecrets {
+		mac := hmac.New(h, []byte(secret))
+		mac.Write(payload)
+		got := prefix + hex.EncodeToString(mac.Sum(nil))
+		if subtle.ConstantTimeCompare([]byte(signature), []byte(got)) == 1 {
+			return true
+		}
+	}
+	return false
 }
@@ -18,8 +18,10 @@ import (
 	"bytes"
 	"context"
 	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // GitHub still signs payloads with sha1 for compatibility.
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -28,9 +30,11 @@ import (
 	"path"
 	"strings"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/pubsub/pstest"
+	"github.com/google/go-cmp/cmp"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -48,11 +52,21 @@ const (
 	serverDatasetID            = "test-dataset-id"
 	serverEventsTableID        = "test-events-table-id"
 	serverFailureEventsTableID = "test-failure-events-table-id"
+	serverPayloadHashesTableID = "test-payload-hashes-table-id"
 )
 
 func setupPubSubServer(ctx context.Context, t *testing.T, projectID, topicID string, opts ...pstest.ServerReactorOption) *grpc.ClientConn {
 	t.Helper()
 
+	_, conn := setupPubSubTestServer(ctx, t, projectID, topicID, opts...)
+	return conn
+}
+
+// setupPubSubTestServer is like setupPubSubServer, but also returns the test
+// server so that the published messages can be inspected.
+func setupPubSubTestServer(ctx context.Context, t *testing.T, projectID, topicID string, opts ...pstest.ServerReactorOption) (*pstest.Server, *grpc.ClientConn) {
+	t.Helper()
+
 	// Create PubSub test server
 	srv := pstest.NewServer(opts...)
 
@@ -84,7 +98,7 @@ func setupPubSubServer(ctx context.Context, t *testing.T, projectID, topicID str
 		}
 	})
 
-	return conn
+	return srv, conn
 }
 
 func TestHandleWebhook(t *testing.T) {
@@ -108,6 +122,9 @@ func TestHandleWebhook(t *testing.T) {
 		expStatusCode           int
 		expRespBody             string
 		datastoreOverride       Datastore
+		dedupByContent          bool
+		expPayloadHashWritten   bool
+		responseFormat          string
 	}{
 		{
 			name:                    "success",
@@ -120,6 +137,18 @@ func TestHandleWebhook(t *testing.T) {
 			expRespBody:             `{"status":"ok"}`,
 			datastoreOverride:       &MockDatastore{},
 		},
+		{
+			name:                    "success_minimal_response_format",
+			pubSubGRPCConn:          pubSubGRPCConn,
+			dlqEventsPubSubGRPCConn: dlqEventsPubSubGRPCConn,
+			payloadFile:             path.Join(testDataBasePath, "pull_request.json"),
+			payloadType:             "pull_request",
+			payloadWebhookSecret:    serverGitHubWebhookSecret,
+			expStatusCode:           http.StatusCreated,
+			expRespBody:             `{"status":"ok"}`,
+			datastoreOverride:       &MockDatastore{},
+			responseFormat:          ResponseFormatMinimal,
+		},
 		{
 			name:                    "success_empty_payload",
 			pubSubGRPCConn:          pubSubGRPCConn,
@@ -163,6 +192,54 @@ func TestHandleWebhook(t *testing.T) {
 			expRespBody:             `{"status":"ok"}`,
 			datastoreOverride:       &MockDatastore{deliveryEventExists: &deliveryEventExistsRes{res: true}},
 		},
+		{
+			name:                    "content_dedup_new_payload",
+			pubSubGRPCConn:          pubSubGRPCConn,
+			dlqEventsPubSubGRPCConn: dlqEventsPubSubGRPCConn,
+			payloadFile:             path.Join(testDataBasePath, "pull_request.json"),
+			payloadType:             "pull_request",
+			payloadWebhookSecret:    serverGitHubWebhookSecret,
+			expStatusCode:           http.StatusCreated,
+			expRespBody:             `{"status":"ok"}`,
+			datastoreOverride:       &MockDatastore{},
+			dedupByContent:          true,
+			expPayloadHashWritten:   true,
+		},
+		{
+			name:                    "content_dedup_duplicate_payload",
+			pubSubGRPCConn:          pubSubGRPCConn,
+			dlqEventsPubSubGRPCConn: dlqEventsPubSubGRPCConn,
+			payloadFile:             path.Join(testDataBasePath, "pull_request.json"),
+			payloadType:             "pull_request",
+			payloadWebhookSecret:    serverGitHubWebhookSecret,
+			expStatusCode:           http.StatusAlreadyReported,
+			expRespBody:             `{"status":"ok"}`,
+			datastoreOverride:       &MockDatastore{payloadHashExists: &payloadHashExistsRes{res: true}},
+			dedupByContent:          true,
+		},
+		{
+			name:                    "content_dedup_lookup_failed",
+			pubSubGRPCConn:          pubSubGRPCConn,
+			dlqEventsPubSubGRPCConn: dlqEventsPubSubGRPCConn,
+			payloadFile:             path.Join(testDataBasePath, "pull_request.json"),
+			payloadType:             "pull_request",
+			payloadWebhookSecret:    serverGitHubWebhookSecret,
+			expStatusCode:           http.StatusInternalServerError,
+			expRespBody:             `{"errors":["failed to write to backend"]}`,
+			datastoreOverride:       &MockDatastore{payloadHashExists: &payloadHashExistsRes{err: errors.New("error")}},
+			dedupByContent:          true,
+		},
+		{
+			name:                    "content_dedup_disabled",
+			pubSubGRPCConn:          pubSubGRPCConn,
+			dlqEventsPubSubGRPCConn: dlqEventsPubSubGRPCConn,
+			payloadFile:             path.Join(testDataBasePath, "pull_request.json"),
+			payloadType:             "pull_request",
+			payloadWebhookSecret:    serverGitHubWebhookSecret,
+			expStatusCode:           http.StatusCreated,
+			expRespBody:             `{"status":"ok"}`,
+			datastoreOverride:       &MockDatastore{payloadHashExists: &payloadHashExistsRes{res: true}},
+		},
 		{
 			name:                    "error_write_backend_failed_marshal",
 			pubSubGRPCConn:          pubSubErrGRPCConn,
@@ -251,6 +328,10 @@ func TestHandleWebhook(t *testing.T) {
 				ProjectID:            serverProjectID,
 				RetryLimit:           1,
 				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+				DedupByContent:       tc.dedupByContent,
+				DedupWindow:          time.Hour,
+				PayloadHashesTableID: serverPayloadHashesTableID,
+				ResponseFormat:       tc.responseFormat,
 			}
 
 			wco := &WebhookClientOptions{
@@ -282,13 +363,1240 @@ func TestHandleWebhook(t *testing.T) {
 			if got, want := strings.TrimSpace(resp.Body.String()), tc.expRespBody; got != want {
 				t.Errorf("expected %q to be %q", got, want)
 			}
+
+			if datastore, ok := tc.datastoreOverride.(*MockDatastore); ok {
+				if got, want := len(datastore.writtenPayloadHashes) > 0, tc.expPayloadHashWritten; got != want {
+					t.Errorf("expected payload hash written to be %t, got %t", want, got)
+				}
+			}
 		})
 	}
 }
 
-// createSignature creates a HMAC 256 signature for the test request payload.
-func createSignature(key, payload []byte) string {
-	mac := hmac.New(sha256.New, key)
-	mac.Write(payload)
-	return hex.EncodeToString(mac.Sum(nil))
+func TestHandleWebhook_VerboseResponse(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	testDataBasePath := path.Join("..", "..", "testdata")
+	pubSubGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverEventsTopicID)
+	pubSubErrGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverEventsTopicID, pstest.WithErrorInjection("Publish", codes.NotFound, "topic id not found"))
+	dlqEventsPubSubGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+	cases := []struct {
+		name                 string
+		pubSubGRPCConn       *grpc.ClientConn
+		payloadWebhookSecret string
+		datastoreOverride    Datastore
+		dedupByContent       bool
+		expStatusCode        int
+		expResp              *verboseResponse
+	}{
+		{
+			name:                 "accepted",
+			pubSubGRPCConn:       pubSubGRPCConn,
+			payloadWebhookSecret: serverGitHubWebhookSecret,
+			datastoreOverride:    &MockDatastore{},
+			expStatusCode:        http.StatusCreated,
+			expResp: &verboseResponse{
+				Status:      "ok",
+				DeliveryID:  "delivery-id",
+				Disposition: "accepted",
+			},
+		},
+		{
+			name:                 "duplicate_delivery",
+			pubSubGRPCConn:       pubSubGRPCConn,
+			payloadWebhookSecret: serverGitHubWebhookSecret,
+			datastoreOverride:    &MockDatastore{deliveryEventExists: &deliveryEventExistsRes{res: true}},
+			expStatusCode:        http.StatusAlreadyReported,
+			expResp: &verboseResponse{
+				Status:      "ok",
+				DeliveryID:  "delivery-id",
+				Disposition: "duplicate_delivery",
+			},
+		},
+		{
+			name:                 "duplicate_payload",
+			pubSubGRPCConn:       pubSubGRPCConn,
+			payloadWebhookSecret: serverGitHubWebhookSecret,
+			datastoreOverride:    &MockDatastore{payloadHashExists: &payloadHashExistsRes{res: true}},
+			dedupByContent:       true,
+			expStatusCode:        http.StatusAlreadyReported,
+			expResp: &verboseResponse{
+				Status:      "ok",
+				DeliveryID:  "delivery-id",
+				Disposition: "duplicate_payload",
+			},
+		},
+		{
+			name:                 "dead_lettered",
+			pubSubGRPCConn:       pubSubErrGRPCConn,
+			payloadWebhookSecret: serverGitHubWebhookSecret,
+			datastoreOverride:    &MockDatastore{failureEventsExceedsRetryLimit: &failureEventsExceedsRetryLimitRes{res: true}},
+			expStatusCode:        http.StatusCreated,
+			expResp: &verboseResponse{
+				Status:      "ok",
+				DeliveryID:  "delivery-id",
+				Disposition: "dead_lettered",
+			},
+		},
+		{
+			name:                 "rejected",
+			pubSubGRPCConn:       pubSubGRPCConn,
+			payloadWebhookSecret: "not-valid",
+			datastoreOverride:    &MockDatastore{},
+			expStatusCode:        http.StatusUnauthorized,
+			expResp: &verboseResponse{
+				Errors:      []string{"failed to validate webhook signature"},
+				DeliveryID:  "delivery-id",
+				Disposition: "rejected",
+			},
+		},
+		{
+			name:                 "failed",
+			pubSubGRPCConn:       pubSubGRPCConn,
+			payloadWebhookSecret: serverGitHubWebhookSecret,
+			datastoreOverride:    &MockDatastore{deliveryEventExists: &deliveryEventExistsRes{err: errors.New("error")}},
+			expStatusCode:        http.StatusInternalServerError,
+			expResp: &verboseResponse{
+				Errors:      []string{"failed to write to backend"},
+				DeliveryID:  "delivery-id",
+				Disposition: "failed",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			payload, err := os.ReadFile(path.Join(testDataBasePath, "pull_request.json"))
+			if err != nil {
+				t.Fatalf("failed to create payload from file: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Add(DeliveryIDHeader, "delivery-id")
+			req.Header.Add(EventTypeHeader, "pull_request")
+			req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(tc.payloadWebhookSecret), payload)))
+
+			resp := httptest.NewRecorder()
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQEventsTopicID:     serverDLQEventsTopicID,
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+				DedupByContent:       tc.dedupByContent,
+				DedupWindow:          time.Hour,
+				PayloadHashesTableID: serverPayloadHashesTableID,
+				ResponseFormat:       ResponseFormatVerbose,
+			}
+
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(tc.pubSubGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsPubSubGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:  tc.datastoreOverride,
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			srv.handleWebhook().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, tc.expStatusCode; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+
+			var got verboseResponse
+			if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode response body %q: %v", resp.Body.String(), err)
+			}
+
+			// the received time is not deterministic, only check it is set
+			if _, err := time.Parse(time.RFC3339Nano, got.Received); err != nil {
+				t.Errorf("expected received to be an RFC 3339 timestamp: %v", err)
+			}
+			got.Received = ""
+
+			if diff := cmp.Diff(&got, tc.expResp); diff != "" {
+				t.Errorf("unexpected response body (-got,+want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandleWebhook_EventTopicRoutes(t *testing.T) {
+	t.Parallel()
+
+	const routedTopicID = "test-workflow-run-events-topic-id"
+
+	cases := []struct {
+		name                string
+		payloadType         string
+		routedPubSubErr     bool
+		expStatusCode       int
+		expEventsCount      int
+		expRoutedEventCount int
+	}{
+		{
+			name:                "routed_event_type",
+			payloadType:         "workflow_run",
+			expStatusCode:       http.StatusCreated,
+			expEventsCount:      1,
+			expRoutedEventCount: 1,
+		},
+		{
+			name:                "unrouted_event_type",
+			payloadType:         "pull_request",
+			expStatusCode:       http.StatusCreated,
+			expEventsCount:      1,
+			expRoutedEventCount: 0,
+		},
+		{
+			name:                "routed_publish_failure_does_not_fail_request",
+			payloadType:         "workflow_run",
+			routedPubSubErr:     true,
+			expStatusCode:       http.StatusCreated,
+			expEventsCount:      1,
+			expRoutedEventCount: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			eventsPubSub, eventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverEventsTopicID)
+			dlqEventsGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+			var routedOpts []pstest.ServerReactorOption
+			if tc.routedPubSubErr {
+				routedOpts = append(routedOpts, pstest.WithErrorInjection("Publish", codes.NotFound, "topic id not found"))
+			}
+			routedPubSub, routedGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, routedTopicID, routedOpts...)
+
+			payload, err := os.ReadFile(path.Join("..", "..", "testdata", "pull_request.json"))
+			if err != nil {
+				t.Fatalf("failed to create payload from file: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Add(DeliveryIDHeader, "delivery-id")
+			req.Header.Add(EventTypeHeader, tc.payloadType)
+			req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(serverGitHubWebhookSecret), payload)))
+
+			resp := httptest.NewRecorder()
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQEventsTopicID:     serverDLQEventsTopicID,
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+				EventTopicRoutes: map[string]string{
+					"workflow_run": routedTopicID,
+				},
+			}
+
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:       []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(dlqEventsGRPCConn), option.WithoutAuthentication()},
+				RoutedEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(routedGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:     &MockDatastore{},
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			srv.handleWebhook().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, tc.expStatusCode; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+
+			if got, want := len(eventsPubSub.Messages()), tc.expEventsCount; got != want {
+				t.Errorf("expected %d messages on the events topic, got %d", want, got)
+			}
+
+			routedMessages := routedPubSub.Messages()
+			if got, want := len(routedMessages), tc.expRoutedEventCount; got != want {
+				t.Errorf("expected %d messages on the routed topic, got %d", want, got)
+			}
+			for _, msg := range routedMessages {
+				var event map[string]any
+				if err := json.Unmarshal(msg.Data, &event); err != nil {
+					t.Fatalf("failed to decode routed message: %v", err)
+				}
+				if got, want := event["event"], tc.payloadType; got != want {
+					t.Errorf("expected routed event type %q, got %q", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleWebhook_MalformedPayload(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	eventsPubSub, eventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverEventsTopicID)
+	dlqEventsGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+	payload := []byte(`{bad json`)
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+	req.Header.Add(DeliveryIDHeader, "delivery-id")
+	req.Header.Add(EventTypeHeader, "pull_request")
+	req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(serverGitHubWebhookSecret), payload)))
+
+	resp := httptest.NewRecorder()
+
+	cfg := &Config{
+		DatasetID:            serverDatasetID,
+		EventsTableID:        serverEventsTableID,
+		EventsTopicID:        serverEventsTopicID,
+		DLQEventsTopicID:     serverDLQEventsTopicID,
+		FailureEventsTableID: serverFailureEventsTableID,
+		ProjectID:            serverProjectID,
+		RetryLimit:           1,
+		GitHubWebhookSecret:  serverGitHubWebhookSecret,
+	}
+
+	wco := &WebhookClientOptions{
+		EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+		DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsGRPCConn), option.WithoutAuthentication()},
+		DatastoreClientOverride:  &MockDatastore{},
+	}
+
+	h, err := renderer.New(ctx, nil,
+		renderer.WithDebug(true),
+		renderer.WithOnError(func(err error) {
+			t.Error(err)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := NewServer(ctx, h, cfg, wco)
+	if err != nil {
+		t.Fatalf("failed to create new server: %v", err)
+	}
+
+	srv.handleWebhook().ServeHTTP(resp, req)
+
+	if got, want := resp.Code, http.StatusBadRequest; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	if got, want := strings.TrimSpace(resp.Body.String()), `{"errors":["malformed payload"]}`; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	if got := len(eventsPubSub.Messages()); got != 0 {
+		t.Errorf("expected no messages on the events topic, got %d", got)
+	}
+}
+
+func TestHandleWebhook_PayloadTooLarge(t *testing.T) {
+	t.Parallel()
+
+	payload := []byte(`{"action": "opened"}`)
+
+	cases := []struct {
+		name            string
+		maxPayloadBytes int64
+		expStatusCode   int
+		expRespBody     string
+		expMessages     int
+	}{
+		{
+			name:            "within_limit",
+			maxPayloadBytes: int64(len(payload)),
+			expStatusCode:   http.StatusCreated,
+			expRespBody:     `{"status":"ok"}`,
+			expMessages:     1,
+		},
+		{
+			name:            "exceeds_limit",
+			maxPayloadBytes: int64(len(payload)) - 1,
+			expStatusCode:   http.StatusRequestEntityTooLarge,
+			expRespBody:     `{"errors":["payload too large"]}`,
+		},
+		{
+			name:          "default_limit",
+			expStatusCode: http.StatusCreated,
+			expRespBody:   `{"status":"ok"}`,
+			expMessages:   1,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			eventsPubSub, eventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverEventsTopicID)
+			dlqEventsGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Add(DeliveryIDHeader, "delivery-id")
+			req.Header.Add(EventTypeHeader, "pull_request")
+			req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(serverGitHubWebhookSecret), payload)))
+
+			resp := httptest.NewRecorder()
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQEventsTopicID:     serverDLQEventsTopicID,
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+				MaxPayloadBytes:      tc.maxPayloadBytes,
+			}
+
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:  &MockDatastore{},
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			srv.handleWebhook().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, tc.expStatusCode; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+
+			if got, want := strings.TrimSpace(resp.Body.String()), tc.expRespBody; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+
+			if got, want := len(eventsPubSub.Messages()), tc.expMessages; got != want {
+				t.Errorf("expected %d messages on the events topic, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestHandleWebhook_GitHubHost(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name                string
+		githubEnterpriseURL string
+		enterpriseHost      string
+		want                string
+	}{
+		{
+			name: "github_com",
+			want: "github.com",
+		},
+		{
+			name:           "enterprise_host_header",
+			enterpriseHost: "GHE.example.com",
+			want:           "ghe.example.com",
+		},
+		{
+			name:                "configured_enterprise_url",
+			githubEnterpriseURL: "https://ghe.example.com/",
+			want:                "ghe.example.com",
+		},
+		{
+			name:                "configured_enterprise_url_over_header",
+			githubEnterpriseURL: "https://ghe.example.com:8443",
+			enterpriseHost:      "other.example.com",
+			want:                "ghe.example.com",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			eventsPubSub, eventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverEventsTopicID)
+			dlqEventsGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+			payload := []byte(`{"action": "opened"}`)
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Add(DeliveryIDHeader, "delivery-id")
+			req.Header.Add(EventTypeHeader, "pull_request")
+			req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(serverGitHubWebhookSecret), payload)))
+			if tc.enterpriseHost != "" {
+				req.Header.Add(EnterpriseHostHeader, tc.enterpriseHost)
+			}
+
+			resp := httptest.NewRecorder()
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQEventsTopicID:     serverDLQEventsTopicID,
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+				GitHubEnterpriseURL:  tc.githubEnterpriseURL,
+			}
+
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:  &MockDatastore{},
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			srv.handleWebhook().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, http.StatusCreated; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+
+			messages := eventsPubSub.Messages()
+			if got, want := len(messages), 1; got != want {
+				t.Fatalf("expected %d messages on the events topic, got %d", want, got)
+			}
+
+			var event map[string]any
+			if err := json.Unmarshal(messages[0].Data, &event); err != nil {
+				t.Fatalf("failed to decode message: %v", err)
+			}
+			if got, want := event["github_host"], tc.want; got != want {
+				t.Errorf("expected github host %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestHandleWebhook_AllowedEventTypes(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		payloadType    string
+		expStatusCode  int
+		expEventsCount int
+	}{
+		{
+			name:           "allowed_event_type",
+			payloadType:    "pull_request",
+			expStatusCode:  http.StatusCreated,
+			expEventsCount: 1,
+		},
+		{
+			name:           "disallowed_event_type",
+			payloadType:    "star",
+			expStatusCode:  http.StatusAccepted,
+			expEventsCount: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			eventsPubSub, eventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverEventsTopicID)
+			dlqEventsGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+			payload, err := os.ReadFile(path.Join("..", "..", "testdata", "pull_request.json"))
+			if err != nil {
+				t.Fatalf("failed to create payload from file: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Add(DeliveryIDHeader, "delivery-id")
+			req.Header.Add(EventTypeHeader, tc.payloadType)
+			req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(serverGitHubWebhookSecret), payload)))
+
+			resp := httptest.NewRecorder()
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQEventsTopicID:     serverDLQEventsTopicID,
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+				AllowedEventTypes:    []string{"pull_request", "push"},
+			}
+
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:  &MockDatastore{},
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			srv.handleWebhook().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, tc.expStatusCode; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+
+			if got, want := len(eventsPubSub.Messages()), tc.expEventsCount; got != want {
+				t.Errorf("expected %d messages on the events topic, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestHandleWebhook_Ping(t *testing.T) {
+	t.Parallel()
+
+	payload := []byte(`{"zen": "Keep it logically awesome.", "hook_id": 12345678}`)
+
+	cases := []struct {
+		name          string
+		secret        string
+		expStatusCode int
+		expRespBody   string
+	}{
+		{
+			name:          "pong",
+			secret:        serverGitHubWebhookSecret,
+			expStatusCode: http.StatusOK,
+			expRespBody:   `{"status":"pong"}`,
+		},
+		{
+			name:          "invalid_signature",
+			secret:        "not-the-secret",
+			expStatusCode: http.StatusUnauthorized,
+			expRespBody:   fmt.Sprintf(`{"errors":["%s"]}`, errInvalidSignature),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			eventsPubSub, eventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverEventsTopicID)
+			dlqEventsPubSub, dlqEventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Add(DeliveryIDHeader, "delivery-id")
+			req.Header.Add(EventTypeHeader, "ping")
+			req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(tc.secret), payload)))
+
+			resp := httptest.NewRecorder()
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQEventsTopicID:     serverDLQEventsTopicID,
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+			}
+
+			// a ping must not reach BigQuery either
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride: &MockDatastore{
+					deliveryEventExists: &deliveryEventExistsRes{err: errors.New("unexpected call to BigQuery")},
+				},
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			srv.handleWebhook().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, tc.expStatusCode; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+			if got, want := strings.TrimSpace(resp.Body.String()), tc.expRespBody; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+			if got := len(eventsPubSub.Messages()); got != 0 {
+				t.Errorf("expected no messages on the events topic, got %d", got)
+			}
+			if got := len(dlqEventsPubSub.Messages()); got != 0 {
+				t.Errorf("expected no messages on the dlq topic, got %d", got)
+			}
+		})
+	}
+}
+
+func TestHandleWebhook_SignatureHeaders(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	pubSubGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverEventsTopicID)
+	dlqEventsPubSubGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+	payload, err := os.ReadFile(path.Join("..", "..", "testdata", "pull_request.json"))
+	if err != nil {
+		t.Fatalf("failed to create payload from file: %v", err)
+	}
+	validSHA256 := fmt.Sprintf("sha256=%s", createSignature([]byte(serverGitHubWebhookSecret), payload))
+	validSHA1 := fmt.Sprintf("sha1=%s", createSHA1Signature([]byte(serverGitHubWebhookSecret), payload))
+	corruptSHA256 := fmt.Sprintf("sha256=%s", createSignature([]byte("not-valid"), payload))
+	corruptSHA1 := fmt.Sprintf("sha1=%s", createSHA1Signature([]byte("not-valid"), payload))
+
+	cases := []struct {
+		name            string
+		sha256Signature string
+		sha1Signature   string
+		expStatusCode   int
+	}{
+		{
+			name:          "only_sha1",
+			sha1Signature: validSHA1,
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name:            "only_sha256",
+			sha256Signature: validSHA256,
+			expStatusCode:   http.StatusCreated,
+		},
+		{
+			name:            "both_valid",
+			sha256Signature: validSHA256,
+			sha1Signature:   validSHA1,
+			expStatusCode:   http.StatusCreated,
+		},
+		{
+			name:            "valid_sha1_corrupt_sha256",
+			sha256Signature: corruptSHA256,
+			sha1Signature:   validSHA1,
+			expStatusCode:   http.StatusUnauthorized,
+		},
+		{
+			name:            "valid_sha256_corrupt_sha1",
+			sha256Signature: validSHA256,
+			sha1Signature:   corruptSHA1,
+			expStatusCode:   http.StatusCreated,
+		},
+		{
+			name:            "both_corrupt",
+			sha256Signature: corruptSHA256,
+			sha1Signature:   corruptSHA1,
+			expStatusCode:   http.StatusUnauthorized,
+		},
+		{
+			name:            "sha1_signature_in_sha256_header",
+			sha256Signature: validSHA1,
+			expStatusCode:   http.StatusUnauthorized,
+		},
+		{
+			name:          "both_absent",
+			expStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Add(DeliveryIDHeader, "delivery-id")
+			req.Header.Add(EventTypeHeader, "pull_request")
+			if tc.sha256Signature != "" {
+				req.Header.Add(SHA256SignatureHeader, tc.sha256Signature)
+			}
+			if tc.sha1Signature != "" {
+				req.Header.Add(SHA1SignatureHeader, tc.sha1Signature)
+			}
+
+			resp := httptest.NewRecorder()
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQEventsTopicID:     serverDLQEventsTopicID,
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+			}
+
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(pubSubGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsPubSubGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:  &MockDatastore{},
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			srv.handleWebhook().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, tc.expStatusCode; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+		})
+	}
+}
+
+func TestHandleWebhook_MultipleSecrets(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	pubSubGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverEventsTopicID)
+	dlqEventsPubSubGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+	payload, err := os.ReadFile(path.Join("..", "..", "testdata", "pull_request.json"))
+	if err != nil {
+		t.Fatalf("failed to create payload from file: %v", err)
+	}
+
+	cases := []struct {
+		name          string
+		secret        string
+		secrets       []string
+		signingSecret string
+		expStatusCode int
+	}{
+		{
+			name:          "signed_with_first_secret_in_list",
+			secrets:       []string{"old-secret", "new-secret"},
+			signingSecret: "old-secret",
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name:          "signed_with_second_secret_in_list",
+			secrets:       []string{"old-secret", "new-secret"},
+			signingSecret: "new-secret",
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name:          "signed_with_single_secret_alongside_list",
+			secret:        "old-secret",
+			secrets:       []string{"new-secret"},
+			signingSecret: "old-secret",
+			expStatusCode: http.StatusCreated,
+		},
+		{
+			name:          "signed_with_unknown_secret",
+			secrets:       []string{"old-secret", "new-secret"},
+			signingSecret: "other-secret",
+			expStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Add(DeliveryIDHeader, "delivery-id")
+			req.Header.Add(EventTypeHeader, "pull_request")
+			req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(tc.signingSecret), payload)))
+
+			resp := httptest.NewRecorder()
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQEventsTopicID:     serverDLQEventsTopicID,
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  tc.secret,
+				GitHubWebhookSecrets: tc.secrets,
+			}
+
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(pubSubGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsPubSubGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:  &MockDatastore{},
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			srv.handleWebhook().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, tc.expStatusCode; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+		})
+	}
+}
+
+// createSignature creates a HMAC 256 signature for the test request payload.
+func createSignature(key, payload []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// createSHA1Signature creates a HMAC SHA1 signature for the test request payload.
+func createSHA1Signature(key, payload []byte) string {
+	mac := hmac.New(sha1.New, key)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandleWebhook_ExactlyOncePublishing(t *testing.T) {
+	t.Parallel()
+
+	pullRequestPayload, err := os.ReadFile(path.Join("..", "..", "testdata", "pull_request.json"))
+	if err != nil {
+		t.Fatalf("failed to create payload from file: %v", err)
+	}
+
+	cases := []struct {
+		name           string
+		exactlyOnce    bool
+		payload        []byte
+		expAttributes  map[string]string
+		expOrderingKey string
+	}{
+		{
+			name:    "disabled",
+			payload: pullRequestPayload,
+		},
+		{
+			name:        "enabled",
+			exactlyOnce: true,
+			payload:     pullRequestPayload,
+			expAttributes: map[string]string{
+				AttributeDeliveryID: "delivery-id",
+				AttributeEvent:      "pull_request",
+			},
+			expOrderingKey: "Codertocat/Hello-World",
+		},
+		{
+			name:        "enabled_without_repository",
+			exactlyOnce: true,
+			payload:     []byte(`{"action": "created"}`),
+			expAttributes: map[string]string{
+				AttributeDeliveryID: "delivery-id",
+				AttributeEvent:      "pull_request",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			eventsPubSub, eventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverEventsTopicID)
+			dlqEventsGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+			cfg := &Config{
+				DatasetID:             serverDatasetID,
+				EventsTableID:         serverEventsTableID,
+				EventsTopicID:         serverEventsTopicID,
+				DLQEventsTopicID:      serverDLQEventsTopicID,
+				FailureEventsTableID:  serverFailureEventsTableID,
+				ProjectID:             serverProjectID,
+				RetryLimit:            1,
+				GitHubWebhookSecret:   serverGitHubWebhookSecret,
+				ExactlyOncePublishing: tc.exactlyOnce,
+			}
+
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:  &MockDatastore{},
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			// GitHub redelivers an event with the same delivery id, which must
+			// result in the same attributes and ordering key.
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(tc.payload))
+				req.Header.Add(DeliveryIDHeader, "delivery-id")
+				req.Header.Add(EventTypeHeader, "pull_request")
+				req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(serverGitHubWebhookSecret), tc.payload)))
+
+				resp := httptest.NewRecorder()
+				srv.handleWebhook().ServeHTTP(resp, req)
+
+				if got, want := resp.Code, http.StatusCreated; got != want {
+					t.Errorf("expected %d to be %d", got, want)
+				}
+			}
+
+			messages := eventsPubSub.Messages()
+			if got, want := len(messages), 2; got != want {
+				t.Fatalf("expected %d messages on the events topic, got %d", want, got)
+			}
+			for _, msg := range messages {
+				if diff := cmp.Diff(msg.Attributes, tc.expAttributes); diff != "" {
+					t.Errorf("unexpected message attributes (-got,+want):\n%s", diff)
+				}
+				if got, want := msg.OrderingKey, tc.expOrderingKey; got != want {
+					t.Errorf("expected ordering key %q, got %q", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleWebhook_EventTypeTables(t *testing.T) {
+	t.Parallel()
+
+	payload, err := os.ReadFile(path.Join("..", "..", "testdata", "pull_request.json"))
+	if err != nil {
+		t.Fatalf("failed to create payload from file: %v", err)
+	}
+
+	eventTypeTables := []string{"pull_request", "workflow_run"}
+
+	cases := []struct {
+		name            string
+		eventTypeTables []string
+		eventType       string
+		expTableID      string
+		expAttributes   map[string]string
+	}{
+		{
+			name:       "disabled",
+			eventType:  "pull_request",
+			expTableID: serverEventsTableID,
+		},
+		{
+			name:            "mapped_event_type",
+			eventTypeTables: eventTypeTables,
+			eventType:       "pull_request",
+			expTableID:      serverEventsTableID + "_pull_request",
+			expAttributes: map[string]string{
+				AttributeDeliveryID: "delivery-id",
+				AttributeEvent:      "pull_request",
+			},
+		},
+		{
+			name:            "unmapped_event_type_uses_catch_all",
+			eventTypeTables: eventTypeTables,
+			eventType:       "issues",
+			expTableID:      serverEventsTableID,
+			expAttributes: map[string]string{
+				AttributeDeliveryID: "delivery-id",
+				AttributeEvent:      "issues",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			eventsPubSub, eventsGRPCConn := setupPubSubTestServer(ctx, t, serverProjectID, serverEventsTopicID)
+			dlqEventsGRPCConn := setupPubSubServer(ctx, t, serverProjectID, serverDLQEventsTopicID)
+
+			cfg := &Config{
+				DatasetID:            serverDatasetID,
+				EventsTableID:        serverEventsTableID,
+				EventsTopicID:        serverEventsTopicID,
+				DLQEventsTopicID:     serverDLQEventsTopicID,
+				FailureEventsTableID: serverFailureEventsTableID,
+				ProjectID:            serverProjectID,
+				RetryLimit:           1,
+				GitHubWebhookSecret:  serverGitHubWebhookSecret,
+				EventTypeTables:      tc.eventTypeTables,
+			}
+
+			datastore := &MockDatastore{}
+			wco := &WebhookClientOptions{
+				EventPubsubClientOpts:    []option.ClientOption{option.WithGRPCConn(eventsGRPCConn), option.WithoutAuthentication()},
+				DLQEventPubsubClientOpts: []option.ClientOption{option.WithGRPCConn(dlqEventsGRPCConn), option.WithoutAuthentication()},
+				DatastoreClientOverride:  datastore,
+			}
+
+			h, err := renderer.New(ctx, nil,
+				renderer.WithDebug(true),
+				renderer.WithOnError(func(err error) {
+					t.Error(err)
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv, err := NewServer(ctx, h, cfg, wco)
+			if err != nil {
+				t.Fatalf("failed to create new server: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+			req.Header.Add(DeliveryIDHeader, "delivery-id")
+			req.Header.Add(EventTypeHeader, tc.eventType)
+			req.Header.Add(SHA256SignatureHeader, fmt.Sprintf("sha256=%s", createSignature([]byte(serverGitHubWebhookSecret), payload)))
+
+			resp := httptest.NewRecorder()
+			srv.handleWebhook().ServeHTTP(resp, req)
+
+			if got, want := resp.Code, http.StatusCreated; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+
+			// duplicates are looked up in the table the event is stored in
+			if diff := cmp.Diff(datastore.queriedEventsTableIDs, []string{tc.expTableID}); diff != "" {
+				t.Errorf("unexpected queried events tables (-got,+want):\n%s", diff)
+			}
+
+			messages := eventsPubSub.Messages()
+			if got, want := len(messages), 1; got != want {
+				t.Fatalf("expected %d messages on the events topic, got %d", want, got)
+			}
+			if diff := cmp.Diff(messages[0].Attributes, tc.expAttributes); diff != "" {
+				t.Errorf("unexpected message attributes (-got,+want):\n%s", diff)
+			}
+			if got := messages[0].OrderingKey; got != "" {
+				t.Errorf("expected no ordering key, got %q", got)
+			}
+		})
+	}
 }
@@ -14,7 +14,7 @@
 
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.28.1
+// 	protoc-gen-go v1.34.2
 // 	protoc        v3.21.9
 // source: pubsub_schemas/event.proto
 
@@ -40,11 +40,13 @@ type Event struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	DeliveryId string `protobuf:"bytes,1,opt,name=delivery_id,json=deliveryId,proto3" json:"delivery_id,omitempty"`
-	Signature  string `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
-	Received   string `protobuf:"bytes,3,opt,name=received,proto3" json:"received,omitempty"`
-	Event      string `protobuf:"bytes,4,opt,name=event,proto3" json:"event,omitempty"`
-	Payload    string `protobuf:"bytes,5,opt,name=payload,proto3" json:"payload,omitempty"`
+	DeliveryId     string  `protobuf:"bytes,1,opt,name=delivery_id,json=deliveryId,proto3" json:"delivery_id,omitempty"`
+	Signature      string  `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
+	Received       string  `protobuf:"bytes,3,opt,name=received,proto3" json:"received,omitempty"`
+	Event          string  `protobuf:"bytes,4,opt,name=event,proto3" json:"event,omitempty"`
+	Payload        string  `protobuf:"bytes,5,opt,name=payload,proto3" json:"payload,omitempty"`
+	EventTimestamp *string `protobuf:"bytes,6,opt,name=event_timestamp,json=eventTimestamp,proto3,oneof" json:"event_timestamp,omitempty"`
+	GithubHost     string  `protobuf:"bytes,7,opt,name=github_host,json=githubHost,proto3" json:"github_host,omitempty"`
 }
 
 func (x *Event) Reset() {
@@ -114,11 +116,25 @@ func (x *Event) GetPayload() string {
 	return ""
 }
 
+func (x *Event) GetEventTimestamp() string {
+	if x != nil && x.EventTimestamp != nil {
+		return *x.EventTimestamp
+	}
+	return ""
+}
+
+func (x *Event) GetGithubHost() string {
+	if x != nil {
+		return x.GithubHost
+	}
+	return ""
+}
+
 var File_pubsub_schemas_event_proto protoreflect.FileDescriptor
 
 var file_pubsub_schemas_event_proto_rawDesc = []byte{
 	0x0a, 0x1a, 0x70, 0x75, 0x62, 0x73, 0x75, 0x62, 0x5f, 0x73, 0x63, 0x68, 0x65, 0x6d, 0x61, 0x73,
-	0x2f, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x92, 0x01, 0x0a,
+	0x2f, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xf5, 0x01, 0x0a,
 	0x05, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x64, 0x65, 0x6c, 0x69, 0x76, 0x65,
 	0x72, 0x79, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x64, 0x65, 0x6c,
 	0x69, 0x76, 0x65, 0x72, 0x79, 0x49, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x73, 0x69, 0x67, 0x6e, 0x61,
@@ -128,8 +144,14 @@ var file_pubsub_schemas_event_proto_rawDesc = []byte{
 	0x64, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09,
 	0x52, 0x05, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f,
 	0x61, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61,
-	0x64, 0x42, 0x0a, 0x5a, 0x08, 0x2e, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73, 0x62, 0x06, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x64, 0x12, 0x2c, 0x0a, 0x0f, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x0e, 0x65, 0x76,
+	0x65, 0x6e, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x88, 0x01, 0x01, 0x12,
+	0x1f, 0x0a, 0x0b, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x5f, 0x68, 0x6f, 0x73, 0x74, 0x18, 0x07,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x48, 0x6f, 0x73, 0x74,
+	0x42, 0x12, 0x0a, 0x10, 0x5f, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x42, 0x0a, 0x5a, 0x08, 0x2e, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x73,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -144,13 +166,10 @@ func file_pubsub_schemas_event_proto_rawDescGZIP() []byte {
 	return file_pubsub_schemas_event_proto_rawDescData
 }
 
-var (
-	file_pubsub_schemas_event_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
-	file_pubsub_schemas_event_proto_goTypes  = []interface{}{
-		(*Event)(nil), // 0: Event
-	}
-)
-
+var file_pubsub_schemas_event_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_pubsub_schemas_event_proto_goTypes = []any{
+	(*Event)(nil), // 0: Event
+}
 var file_pubsub_schemas_event_proto_depIdxs = []int32{
 	0, // [0:0] is the sub-list for method output_type
 	0, // [0:0] is the sub-list for method input_type
@@ -165,7 +184,7 @@ func file_pubsub_schemas_event_proto_init() {
 		return
 	}
 	if !protoimpl.UnsafeEnabled {
-		file_pubsub_schemas_event_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+		file_pubsub_schemas_event_proto_msgTypes[0].Exporter = func(v any, i int) any {
 			switch v := v.(*Event); i {
 			case 0:
 				return &v.state
@@ -178,6 +197,7 @@ func file_pubsub_schemas_event_proto_init() {
 			}
 		}
 	}
+	file_pubsub_schemas_event_proto_msgTypes[0].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
@@ -125,6 +125,18 @@ resource "google_bigquery_table" "events_table" {
       "type" : "STRING",
       "mode" : "NULLABLE",
       "description" : "Event payload JSON string"
+    },
+    {
+      "name" : "event_timestamp",
+      "type" : "TIMESTAMP",
+      "mode" : "NULLABLE",
+      "description" : "Timestamp for when the event happened on GitHub according to its payload, null for event types without a clear event time"
+    },
+    {
+      "name" : "github_host",
+      "type" : "STRING",
+      "mode" : "NULLABLE",
+      "description" : "Host of the GitHub instance the event was delivered from, e.g. github.com or the host of a GitHub Enterprise Server"
     }
   ])
 }
@@ -169,6 +181,39 @@ resource "google_bigquery_table_iam_member" "event_webhook_editor" {
   member     = google_service_account.webhook_run_service_account.member
 }
 
+resource "google_bigquery_table" "event_type_tables" {
+  for_each = toset(var.event_type_tables)
+
+  project = data.google_project.default.project_id
+
+  deletion_protection = true
+  table_id            = "${var.events_table_id}_${each.value}"
+  dataset_id          = google_bigquery_dataset.default.dataset_id
+  schema              = google_bigquery_table.events_table.schema
+}
+
+resource "google_bigquery_table_iam_member" "event_type_table_pubsub_agent_editors" {
+  for_each = google_bigquery_table.event_type_tables
+
+  project = data.google_project.default.project_id
+
+  dataset_id = google_bigquery_dataset.default.dataset_id
+  table_id   = each.value.id
+  role       = "roles/bigquery.dataEditor"
+  member     = "serviceAccount:service-${data.google_project.default.number}@gcp-sa-pubsub.iam.gserviceaccount.com"
+}
+
+resource "google_bigquery_table_iam_member" "event_type_table_webhook_editors" {
+  for_each = google_bigquery_table.event_type_tables
+
+  project = data.google_project.default.project_id
+
+  dataset_id = google_bigquery_dataset.default.dataset_id
+  table_id   = each.value.id
+  role       = "roles/bigquery.dataEditor"
+  member     = google_service_account.webhook_run_service_account.member
+}
+
 resource "google_bigquery_table_iam_member" "event_viewers" {
   for_each = toset(var.events_table_iam.viewers)
 
@@ -217,6 +262,18 @@ resource "google_bigquery_table" "raw_events_table" {
       "type" : "JSON",
       "mode" : "NULLABLE",
       "description" : "Event payload JSON"
+    },
+    {
+      "name" : "event_timestamp",
+      "type" : "TIMESTAMP",
+      "mode" : "NULLABLE",
+      "description" : "Timestamp for when the event happened on GitHub according to its payload, null for event types without a clear event time"
+    },
+    {
+      "name" : "github_host",
+      "type" : "STRING",
+      "mode" : "NULLABLE",
+      "description" : "Host of the GitHub instance the event was delivered from, e.g. github.com or the host of a GitHub Enterprise Server"
     }
   ])
 
@@ -300,6 +357,12 @@ resource "google_bigquery_table" "checkpoint_table" {
       "mode" : "REQUIRED",
       "description" : "Timestamp for when the checkpoint record was created."
     },
+    {
+      "name" : "installation",
+      "type" : "STRING",
+      "mode" : "NULLABLE",
+      "description" : "Name of the GitHub App installation the checkpoint belongs to, empty when all deliveries share a single checkpoint."
+    },
   ])
 }
 
@@ -411,6 +474,45 @@ resource "google_bigquery_table_iam_member" "failure_events_viewers" {
   member     = each.value
 }
 
+# Payload Hashes Table / IAM
+
+resource "google_bigquery_table" "payload_hashes_table" {
+  project = data.google_project.default.project_id
+
+  deletion_protection = true
+  table_id            = var.payload_hashes_table_id
+  dataset_id          = google_bigquery_dataset.default.dataset_id
+  schema = jsonencode([
+    {
+      "name" : "delivery_id",
+      "type" : "STRING",
+      "mode" : "REQUIRED",
+      "description" : "GUID that represents the accepted event."
+    },
+    {
+      "name" : "payload_hash",
+      "type" : "STRING",
+      "mode" : "REQUIRED",
+      "description" : "Hash of the event type and normalized payload of the event."
+    },
+    {
+      "name" : "created",
+      "type" : "TIMESTAMP",
+      "mode" : "REQUIRED",
+      "description" : "Timestamp of when the event was received."
+    },
+  ])
+}
+
+resource "google_bigquery_table_iam_member" "payload_hashes_webhook_editor" {
+  project = data.google_project.default.project_id
+
+  dataset_id = google_bigquery_dataset.default.dataset_id
+  table_id   = google_bigquery_table.payload_hashes_table.id
+  role       = "roles/bigquery.dataEditor"
+  member     = google_service_account.webhook_run_service_account.member
+}
+
 # Unique Events - deduplicate rows
 
 resource "google_bigquery_table" "unique_events_view" {
@@ -428,6 +530,8 @@ resource "google_bigquery_table" "unique_events_view" {
       received,
       event,
       payload,
+      event_timestamp,
+      github_host,
       JSON_VALUE(payload, "$.organization.login") organization,
       SAFE_CAST(JSON_VALUE(payload, "$.organization.id") AS INT64) organization_id,
       JSON_VALUE(payload, "$.repository.full_name") repository_full_name,
@@ -464,6 +568,8 @@ resource "google_bigquery_routine" "unique_events_by_date_type" {
       received,
       event,
       payload,
+      event_timestamp,
+      github_host,
       LAX_STRING(payload.organization.login) organization,
       SAFE.INT64(payload.organization.id) organization_id,
       LAX_STRING(payload.repository.full_name) repository_full_name,
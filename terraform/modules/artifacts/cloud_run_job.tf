@@ -49,15 +49,26 @@ resource "google_cloud_run_v2_job" "default" {
           name  = "GITHUB_INSTALL_ID"
           value = var.github_install_id
         }
-        env {
-          name = "GITHUB_PRIVATE_KEY_SECRET"
-          value_source {
-            secret_key_ref {
-              secret  = var.github_private_key_secret_id
-              version = var.github_private_key_secret_version
+        # the private key is either read from the secret or held by Cloud KMS
+        dynamic "env" {
+          for_each = var.github_private_key_kms_key_id == null ? [1] : []
+          content {
+            name = "GITHUB_PRIVATE_KEY_SECRET"
+            value_source {
+              secret_key_ref {
+                secret  = var.github_private_key_secret_id
+                version = var.github_private_key_secret_version
+              }
             }
           }
         }
+        dynamic "env" {
+          for_each = var.github_private_key_kms_key_id == null ? [] : [1]
+          content {
+            name  = "GITHUB_PRIVATE_KEY_KMS_KEY_ID"
+            value = var.github_private_key_kms_key_id
+          }
+        }
         env {
           name  = "PROJECT_ID"
           value = var.project_id
@@ -144,6 +155,16 @@ resource "google_project_iam_member" "secret_accessor_role" {
   role   = "roles/secretmanager.secretAccessor"
 }
 
+// give the service account permission to sign with the GitHub App private key
+// held by Cloud KMS
+resource "google_kms_crypto_key_iam_member" "github_private_key_signer_role" {
+  count = var.github_private_key_kms_key_id == null ? 0 : 1
+
+  crypto_key_id = regex("^(.+)/cryptoKeyVersions/[^/]+$", var.github_private_key_kms_key_id)[0]
+  role          = "roles/cloudkms.signer"
+  member        = google_service_account.default.member
+}
+
 // Give the service account invoker permission
 resource "google_project_iam_member" "invoker_role" {
   project = var.project_id
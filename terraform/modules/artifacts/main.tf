@@ -79,6 +79,48 @@ resource "google_bigquery_table" "leech_table" {
       "mode" : "REQUIRED",
       "description" : "Apache Beam job name of the pipeline that processed this event."
     },
+    {
+      "name" : "attempts",
+      "type" : "INTEGER",
+      "mode" : "NULLABLE",
+      "description" : "The number of attempts made to ingest the logs of the event, including this one."
+    },
+    {
+      "name" : "repository_visibility",
+      "type" : "STRING",
+      "mode" : "NULLABLE",
+      "description" : "Visibility of the repository, only recorded when repository metadata enrichment is enabled."
+    },
+    {
+      "name" : "repository_language",
+      "type" : "STRING",
+      "mode" : "NULLABLE",
+      "description" : "Primary language of the repository, only recorded when repository metadata enrichment is enabled."
+    },
+    {
+      "name" : "repository_topics",
+      "type" : "STRING",
+      "mode" : "REPEATED",
+      "description" : "Topics of the repository, only recorded when repository metadata enrichment is enabled."
+    },
+    {
+      "name" : "github_actor_teams",
+      "type" : "STRING",
+      "mode" : "REPEATED",
+      "description" : "Slugs of the teams of the organization the GitHub actor is a member of, only recorded when actor team enrichment is enabled."
+    },
+    {
+      "name" : "conclusion",
+      "type" : "STRING",
+      "mode" : "NULLABLE",
+      "description" : "Conclusion of the workflow run, e.g. success, failure or cancelled."
+    },
+    {
+      "name" : "error",
+      "type" : "STRING",
+      "mode" : "NULLABLE",
+      "description" : "Message of the panic of an event whose processing failed unexpectedly, e.g. on a malformed event."
+    },
   ])
 }
 
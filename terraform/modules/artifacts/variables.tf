@@ -107,6 +107,12 @@ variable "github_private_key_secret_version" {
   default     = "latest"
 }
 
+variable "github_private_key_kms_key_id" {
+  description = "The Cloud KMS crypto key version holding the private key for the GitHub app, used instead of the secret when set"
+  type        = string
+  default     = null
+}
+
 variable "events_table_id" {
   description = "The BigQuery events table id to create."
   type        = string
@@ -103,6 +103,100 @@ resource "google_bigquery_table" "commit_review_status_table" {
       mode : "NULLABLE",
       description : "Optional context on the about the commit (e.g. a processing error message)"
     },
+    {
+      name : "code_owner_approvers",
+      type : "STRING",
+      mode : "REPEATED",
+      description : "The logins of the CODEOWNERS of the changed files that approved the pull request."
+    },
+    {
+      name : "bot_approved",
+      type : "BOOLEAN",
+      mode : "NULLABLE",
+      description : "Whether a bot reviewer approved the pull request. Bot approvals are excluded from the required approvals when configured."
+    },
+    {
+      name : "approving_teams",
+      type : "STRING",
+      mode : "REPEATED",
+      description : "The slugs of the distinct teams represented by the approving reviewers of the pull request. Only populated when distinct team approvals are required."
+    },
+    {
+      name : "branch_protection",
+      type : "RECORD",
+      mode : "NULLABLE",
+      description : "A snapshot of the protection of the default branch of the repository when the commit was processed. Only populated when branch protection snapshots are enabled.",
+      fields : [
+        {
+          name : "branch",
+          type : "STRING",
+          mode : "REQUIRED",
+          description : "The default branch of the repository."
+        },
+        {
+          name : "protected",
+          type : "BOOLEAN",
+          mode : "REQUIRED",
+          description : "Whether the default branch is protected."
+        },
+        {
+          name : "require_pull_request_reviews",
+          type : "BOOLEAN",
+          mode : "REQUIRED",
+          description : "Whether pull requests targeting the default branch require reviews."
+        },
+        {
+          name : "required_approving_review_count",
+          type : "INT64",
+          mode : "REQUIRED",
+          description : "The number of approving reviews required to merge a pull request."
+        },
+        {
+          name : "require_code_owner_reviews",
+          type : "BOOLEAN",
+          mode : "REQUIRED",
+          description : "Whether an approving review from a code owner is required."
+        },
+        {
+          name : "dismiss_stale_reviews",
+          type : "BOOLEAN",
+          mode : "REQUIRED",
+          description : "Whether approving reviews are dismissed when new commits are pushed."
+        },
+        {
+          name : "enforce_admins",
+          type : "BOOLEAN",
+          mode : "REQUIRED",
+          description : "Whether the protection is enforced for administrators."
+        },
+      ]
+    },
+    {
+      name : "approving_pull_requests",
+      type : "RECORD",
+      mode : "REPEATED",
+      description : "All approved pull requests targeting the default branch that the commit is associated with, e.g. when it was cherry-picked. Only populated when recording all approving pull requests is enabled.",
+      fields : [
+        {
+          name : "id",
+          type : "INT64",
+          mode : "REQUIRED",
+          description : "The ID of the pull request."
+        },
+        {
+          name : "number",
+          type : "INT64",
+          mode : "REQUIRED",
+          description : "The number of the pull request."
+        },
+        {
+          name : "html_url",
+          type : "STRING",
+          mode : "REQUIRED",
+          description : "The URL of the pull request."
+        },
+      ]
+    },
   ])
 }
 
@@ -66,6 +66,11 @@ output "bigquery_failure_events_table_id" {
   value       = google_bigquery_table.failure_events_table.table_id
 }
 
+output "bigquery_payload_hashes_table_id" {
+  description = "BigQuery payload_hashes table resource."
+  value       = google_bigquery_table.payload_hashes_table.table_id
+}
+
 output "bigquery_unique_events_view_id" {
   description = "BigQuery unique events view resource."
   value       = google_bigquery_table.unique_events_view.table_id
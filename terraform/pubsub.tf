@@ -80,6 +80,15 @@ resource "google_pubsub_topic_iam_member" "dead_letter_publisher_webhook" {
   member = google_service_account.webhook_run_service_account.member
 }
 
+# Allow the webhook to check that the topic exists in its readiness check
+resource "google_pubsub_topic_iam_member" "dead_letter_viewer_webhook" {
+  project = google_pubsub_topic.dead_letter.project
+
+  topic  = google_pubsub_topic.dead_letter.name
+  role   = "roles/pubsub.viewer"
+  member = google_service_account.webhook_run_service_account.member
+}
+
 # Allow the PubSub SA to publish the DLQ
 resource "google_pubsub_topic_iam_member" "dead_letter_publisher_default" {
   project = google_pubsub_topic.dead_letter.project
@@ -223,12 +232,26 @@ resource "google_pubsub_topic_iam_member" "topic_publisher_webhook" {
   member = google_service_account.webhook_run_service_account.member
 }
 
+# Allow the webhook to check that the topic exists in its readiness check
+resource "google_pubsub_topic_iam_member" "topic_viewer_webhook" {
+  project = google_pubsub_topic.default.project
+
+  topic  = google_pubsub_topic.default.name
+  role   = "roles/pubsub.viewer"
+  member = google_service_account.webhook_run_service_account.member
+}
+
 resource "google_pubsub_subscription" "default" {
   project = var.project_id
 
   name  = "${var.prefix_name}-bq-sub"
   topic = google_pubsub_topic.default.name
 
+  # the events table is the catch-all for event types without their own table
+  filter = length(var.event_type_tables) == 0 ? null : format("NOT (%s)", join(" OR ", [
+    for event_type in var.event_type_tables : format("attributes.event = \"%s\"", event_type)
+  ]))
+
   bigquery_config {
     table            = format("${google_bigquery_table.events_table.project}:${google_bigquery_table.events_table.dataset_id}.${google_bigquery_table.events_table.table_id}")
     use_topic_schema = true
@@ -245,6 +268,31 @@ resource "google_pubsub_subscription" "default" {
   }
 }
 
+resource "google_pubsub_subscription" "event_type_tables" {
+  for_each = google_bigquery_table.event_type_tables
+
+  project = var.project_id
+
+  name   = "${var.prefix_name}-bq-${replace(each.key, "_", "-")}-sub"
+  topic  = google_pubsub_topic.default.name
+  filter = format("attributes.event = \"%s\"", each.key)
+
+  bigquery_config {
+    table            = format("${each.value.project}:${each.value.dataset_id}.${each.value.table_id}")
+    use_topic_schema = true
+  }
+
+  # set to never expire
+  expiration_policy {
+    ttl = ""
+  }
+
+  dead_letter_policy {
+    dead_letter_topic     = google_pubsub_topic.dead_letter.id
+    max_delivery_attempts = 5
+  }
+}
+
 resource "google_pubsub_subscription" "json" {
   project = var.project_id
 
@@ -61,6 +61,11 @@ module "webhook_cloud_run" {
     "RETRY_LIMIT" : var.event_delivery_retry_limit,
     "EVENTS_TOPIC_ID" : google_pubsub_topic.default.name,
     "DLQ_EVENTS_TOPIC_ID" : google_pubsub_topic.dead_letter.name,
+    "DEDUP_BY_CONTENT" : tostring(var.dedup_events_by_content),
+    "DEDUP_WINDOW" : var.dedup_window,
+    "PAYLOAD_HASHES_TABLE_ID" : google_bigquery_table.payload_hashes_table.table_id,
+    "RESPONSE_FORMAT" : var.webhook_response_format,
+    "EVENT_TYPE_TABLES" : join(",", var.event_type_tables),
   }
   secret_envvars = {
     "GITHUB_WEBHOOK_SECRET" : {
@@ -224,6 +224,41 @@ variable "failure_events_table_iam" {
   }
 }
 
+variable "payload_hashes_table_id" {
+  description = "The BigQuery payload hashes table id to create."
+  type        = string
+  default     = "payload_hashes"
+}
+
+variable "dedup_events_by_content" {
+  description = "Whether to skip events whose payload matches an event received within the dedup window, in addition to deduplicating by delivery id."
+  type        = bool
+  default     = false
+}
+
+variable "dedup_window" {
+  description = "The duration within which events with the same payload are considered duplicates."
+  type        = string
+  default     = "24h"
+}
+
+variable "webhook_response_format" {
+  description = "The format of the webhook response body, either minimal or verbose."
+  type        = string
+  default     = "minimal"
+
+  validation {
+    condition     = contains(["minimal", "verbose"], var.webhook_response_format)
+    error_message = "webhook_response_format must be one of minimal or verbose."
+  }
+}
+
+variable "event_type_tables" {
+  description = "The event types to store in a dedicated BigQuery table named after the events table with the event type as suffix, e.g. events_pull_request, instead of the events table. Changing the event types recreates the events table subscription, since its filter cannot be updated."
+  type        = list(string)
+  default     = []
+}
+
 variable "event_delivery_retry_limit" {
   description = "Number of attempts to delivery a failed event from GitHub."
   type        = string